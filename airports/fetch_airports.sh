@@ -0,0 +1,8 @@
+#!/bin/bash
+echo "Fetching airports.csv from ourairports.com"
+wget -qO airports.csv https://davidmegginson.github.io/ourairports-data/airports.csv
+if [ "$?" -ne 0 ]; then
+	echo "Error downloading the file. Using the existing copy stored in airports.csv.copy"
+	cp -f airports.csv.copy airports.csv
+fi
+exit 0
@@ -339,6 +339,26 @@ func CalcAltitude(press float64, altoffset int) (altitude float64) {
 	return
 }
 
+// CalcPressure is the inverse of CalcAltitude: the atmospheric pressure (hPa) at a pressure altitude (feet)
+func CalcPressure(altitude float64, altoffset int) (press float64) {
+	press = 1013.25 * math.Pow(1.0-(altitude-float64(altoffset))/145366.45, 1/0.190284)
+	return
+}
+
+// CalcIndicatedAltitude is what an altimeter set to qnh (hPa) shows at a pressure altitude (feet)
+func CalcIndicatedAltitude(pressAltitude, qnh float64) (altitude float64) {
+	altitude = 145366.45 * (1.0 - math.Pow(CalcPressure(pressAltitude, 0)/qnh, 0.190284))
+	return
+}
+
+// CalcDensityAltitude determines the density altitude (feet) from the pressure altitude (feet) and the outside air
+// temperature (°C)
+func CalcDensityAltitude(pressAltitude, temp float64) (altitude float64) {
+	density := (CalcPressure(pressAltitude, 0) / 1013.25) / ((temp + 273.15) / 288.15)
+	altitude = 145442.16 * (1.0 - math.Pow(density, 0.234969))
+	return
+}
+
 // golang only defines min/max for float64. Really.
 func IMin(x, y int) int {
 	if x < y {
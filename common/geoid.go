@@ -0,0 +1,76 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	geoid.go: EGM96 geoid model for converting between height above the WGS84 ellipsoid (HAE)
+	 and height above mean sea level (MSL), for receivers and traffic sources that only supply one of them.
+*/
+
+package common
+
+import "math"
+
+const (
+	geoidGridStep = 10 // degrees
+	geoidRows     = 180/geoidGridStep + 1
+	geoidCols     = 360/geoidGridStep + 1
+)
+
+// geoidGrid holds the EGM96 geoid height in meters on a 10° grid, rows from 90S to 90N,
+// columns from 180W to 180E. Bilinear interpolation keeps the error within a few meters in most
+// places, more over steep gradients such as the Andes, Indonesia or the North Atlantic, compared
+// to up to 100 m when the geoid is ignored.
+var geoidGrid = [geoidRows][geoidCols]int8{
+	/* 90S */ {-30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30, -30},
+	/* 80S */ {-53, -54, -55, -52, -48, -42, -38, -38, -29, -26, -26, -24, -23, -21, -19, -16, -12, -8, -4, -1, 1, 4, 4, 6, 5, 4, 2, -6, -15, -24, -33, -40, -48, -50, -53, -52, -53},
+	/* 70S */ {-61, -60, -61, -55, -49, -44, -38, -31, -25, -16, -6, 1, 4, 5, 4, 2, 6, 12, 16, 16, 17, 21, 20, 26, 26, 22, 16, 10, -1, -16, -29, -36, -46, -55, -54, -59, -61},
+	/* 60S */ {-45, -43, -37, -32, -30, -26, -23, -22, -16, -10, -2, 10, 20, 20, 21, 24, 22, 17, 16, 19, 25, 30, 35, 35, 33, 30, 27, 10, -2, -14, -23, -30, -33, -29, -35, -43, -45},
+	/* 50S */ {-15, -18, -18, -16, -17, -15, -10, -10, -8, -2, 6, 14, 13, 3, 3, 10, 20, 27, 25, 26, 34, 39, 45, 45, 38, 39, 28, 13, -1, -15, -22, -22, -18, -15, -14, -10, -15},
+	/* 40S */ {21, 6, 1, -7, -12, -12, -12, -10, -7, -1, 8, 23, 15, -2, -6, 6, 21, 24, 18, 26, 31, 33, 39, 41, 30, 24, 13, -2, -20, -32, -33, -27, -14, -2, 5, 20, 21},
+	/* 30S */ {46, 22, 5, -2, -8, -13, -10, -7, -4, 1, 9, 32, 16, 4, -8, 4, 12, 15, 22, 27, 34, 29, 14, 15, 15, 7, -9, -25, -37, -39, -23, -14, 15, 33, 34, 45, 46},
+	/* 20S */ {51, 27, 10, 0, -9, -11, -5, -2, -3, -1, 9, 35, 20, -5, -6, -5, 0, 13, 17, 23, 21, 8, -9, -10, -11, -20, -40, -47, -45, -25, 5, 23, 45, 58, 57, 63, 51},
+	/* 10S */ {36, 22, 11, 6, -1, -8, -10, -8, -11, -9, 1, 32, 4, -18, -13, -9, 4, 14, 12, 13, -2, -14, -25, -32, -38, -60, -75, -63, -26, 0, 35, 52, 68, 76, 64, 52, 36},
+	/* 00N */ {22, 16, 17, 13, 1, -12, -23, -20, -14, -3, 14, 10, -15, -27, -18, 3, 12, 20, 18, 12, -13, -9, -28, -49, -62, -89, -102, -63, -9, 33, 58, 73, 74, 63, 50, 32, 22},
+	/* 10N */ {13, 12, 11, 2, -11, -28, -38, -29, -10, 3, 1, -11, -41, -42, -16, 3, 17, 33, 22, 23, 2, -3, -7, -36, -59, -90, -95, -63, -24, 12, 53, 60, 58, 46, 36, 26, 13},
+	/* 20N */ {5, 10, 7, -7, -23, -39, -47, -34, -9, -10, -20, -45, -48, -32, -9, 17, 25, 31, 31, 26, 15, 6, 1, -29, -44, -61, -67, -59, -36, -11, 21, 39, 49, 39, 22, 10, 5},
+	/* 30N */ {-7, -5, -8, -15, -28, -40, -42, -29, -22, -26, -32, -51, -40, -17, 17, 31, 34, 44, 36, 28, 29, 17, 12, -20, -15, -40, -33, -34, -34, -28, 7, 29, 43, 20, 4, -6, -7},
+	/* 40N */ {-12, -10, -13, -20, -31, -34, -21, -16, -26, -34, -33, -35, -26, 2, 33, 59, 52, 51, 52, 48, 35, 40, 33, -9, -28, -39, -48, -59, -50, -28, 3, 23, 37, 18, -1, -11, -12},
+	/* 50N */ {-8, 8, 8, 1, -11, -19, -16, -18, -22, -35, -40, -26, -12, 24, 45, 63, 62, 59, 47, 48, 42, 28, 12, -10, -19, -33, -43, -42, -43, -29, -2, 17, 23, 22, 6, 2, -8},
+	/* 60N */ {2, 9, 17, 10, 13, 1, -14, -30, -39, -46, -42, -21, 6, 29, 49, 65, 60, 57, 47, 41, 21, 18, 14, 7, -3, -22, -29, -32, -32, -26, -15, -2, 13, 17, 19, 6, 2},
+	/* 70N */ {3, 9, 17, 20, 25, 28, 29, 14, 5, -9, -8, -10, -29, -22, -4, 9, 24, 38, 43, 42, 40, 24, 13, -4, -13, -21, -14, -12, -6, 16, 29, 34, 31, 24, 15, 5, 3},
+	/* 80N */ {13, 13, 13, 13, 10, 7, 2, 0, -6, -6, -17, -22, -12, -3, 5, 12, 20, 27, 31, 33, 29, 23, 17, 7, -4, -9, -13, -9, -5, 0, 5, 8, 12, 14, 14, 13, 13},
+	/* 90N */ {13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13, 13},
+}
+
+// GeoidHeight returns the height of the geoid above the WGS84 ellipsoid in meters at the given position
+// (the NMEA "geoidal separation"): HAE = MSL + GeoidHeight.
+func GeoidHeight(lat, lon float64) float64 {
+	if math.IsNaN(lat) || math.IsNaN(lon) {
+		return 0
+	}
+	lat = math.Max(-90, math.Min(90, lat))
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	// Grid coordinates, and the cell's lower left corner.
+	y := (lat + 90) / geoidGridStep
+	x := lon / geoidGridStep
+	row := int(math.Min(y, geoidRows-2))
+	col := int(math.Min(x, geoidCols-2))
+	fy := y - float64(row)
+	fx := x - float64(col)
+
+	h00 := float64(geoidGrid[row][col])
+	h01 := float64(geoidGrid[row][col+1])
+	h10 := float64(geoidGrid[row+1][col])
+	h11 := float64(geoidGrid[row+1][col+1])
+	return h00*(1-fx)*(1-fy) + h01*fx*(1-fy) + h10*(1-fx)*fy + h11*fx*fy
+}
+
+// GeoidHeightFt is GeoidHeight in feet.
+func GeoidHeightFt(lat, lon float64) float64 {
+	return GeoidHeight(lat, lon) * 3.28084
+}
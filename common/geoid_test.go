@@ -0,0 +1,63 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	geoid_test.go: Unit tests for the EGM96 geoid model
+*/
+
+package common
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGeoidHeight compares against approximate EGM96 values, with the tolerance of the coarse grid
+func TestGeoidHeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     float64
+		tol      float64
+	}{
+		{"Oshkosh", 43.9844, -88.557, -34, 3},
+		{"Denver", 39.8617, -104.6731, -17, 6},
+		{"Frankfurt", 50.03, 8.57, 48, 3},
+		{"Sydney", -33.95, 151.18, 22, 5},
+		{"Indian Ocean low", 5, 80, -100, 6},
+		{"New Guinea high", -5, 145, 72, 12},
+		{"Grid point", 40, 0, 52, 0.001},
+		{"South pole", -90, 45, -30, 0.001},
+		{"North pole", 90, -120, 13, 0.001},
+		{"Dateline east", 0, 180, 22, 0.001},
+		{"Dateline west", 0, -180, 22, 0.001},
+		{"Wrapped longitude", 50.03, 8.57 + 360, 48, 3},
+	}
+	for _, tt := range tests {
+		if got := GeoidHeight(tt.lat, tt.lon); math.Abs(got-tt.want) > tt.tol {
+			t.Errorf("%s: GeoidHeight(%.4f, %.4f) = %.1f, want %.0f ± %.0f", tt.name, tt.lat, tt.lon, got, tt.want, tt.tol)
+		}
+	}
+}
+
+// TestGeoidHeightContinuous checks there are no steps in the interpolation, e.g. at cell or dateline boundaries
+func TestGeoidHeightContinuous(t *testing.T) {
+	for lat := -90.0; lat <= 90; lat += 0.5 {
+		prev := GeoidHeight(lat, -180)
+		for lon := -180.0; lon <= 180; lon += 0.25 {
+			h := GeoidHeight(lat, lon)
+			// Steepest grid gradient is ~4 m/degree.
+			if math.Abs(h-prev) > 1.5 {
+				t.Fatalf("step at %.2f, %.2f: %.1f -> %.1f", lat, lon, prev, h)
+			}
+			prev = h
+		}
+	}
+	if h := GeoidHeight(math.NaN(), 0); h != 0 {
+		t.Errorf("GeoidHeight(NaN) = %f", h)
+	}
+	if h := GeoidHeightFt(40, 0); math.Abs(h-52*3.28084) > 0.01 {
+		t.Errorf("GeoidHeightFt = %f", h)
+	}
+}
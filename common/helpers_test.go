@@ -304,6 +304,53 @@ func TestCalcAltitude(t *testing.T) {
 	}
 }
 
+// TestCalcPressure tests that CalcPressure inverts CalcAltitude
+func TestCalcPressure(t *testing.T) {
+	for _, press := range []float64{1050, 1013.25, 843.08, 500, 200} {
+		for _, offset := range []int{0, -150} {
+			if p := CalcPressure(CalcAltitude(press, offset), offset); math.Abs(p-press) > 1e-6 {
+				t.Errorf("CalcPressure(CalcAltitude(%f, %d)) = %f", press, offset, p)
+			}
+		}
+	}
+}
+
+// TestCalcIndicatedAltitude tests the altimeter setting correction
+func TestCalcIndicatedAltitude(t *testing.T) {
+	tests := []struct {
+		pressAlt, qnh, want, tolerance float64
+	}{
+		{0, 1013.25, 0, 1e-6},
+		{5000, 1013.25, 5000, 1e-6},
+		{0, 1023.25, 273, 2}, // About 27 ft per hPa at sea level.
+		{0, 1003.25, -276, 2},
+		{8000, 29.42 * 33.8639, 7560, 10}, // 0.5 inHg low, less than 500 ft up there.
+	}
+	for _, tt := range tests {
+		if got := CalcIndicatedAltitude(tt.pressAlt, tt.qnh); math.Abs(got-tt.want) > tt.tolerance {
+			t.Errorf("CalcIndicatedAltitude(%.0f, %.2f) = %.1f, want %.0f", tt.pressAlt, tt.qnh, got, tt.want)
+		}
+	}
+}
+
+// TestCalcDensityAltitude tests density altitude against the rule of thumb of 120 ft per °C above ISA
+func TestCalcDensityAltitude(t *testing.T) {
+	tests := []struct {
+		pressAlt, temp, want, tolerance float64
+	}{
+		{0, 15, 0, 1e-6},
+		{5000, 15 - 1.98*5, 5000, 10}, // ISA.
+		{5000, 15 - 1.98*5 + 20, 7400, 150},
+		{0, 35, 2400, 150},
+		{3000, -20, 3000 - 120*29, 300},
+	}
+	for _, tt := range tests {
+		if got := CalcDensityAltitude(tt.pressAlt, tt.temp); math.Abs(got-tt.want) > tt.tolerance {
+			t.Errorf("CalcDensityAltitude(%.0f, %.1f) = %.0f, want %.0f", tt.pressAlt, tt.temp, got, tt.want)
+		}
+	}
+}
+
 // TestArrayMinMax tests array min/max functions
 func TestArrayMinMax(t *testing.T) {
 	testData := []float64{3.5, 1.2, 5.7, 2.1, 4.9}
@@ -0,0 +1,216 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	wmm.go: World Magnetic Model, for converting between magnetic and true heading.
+	 WMM.COF is the coefficient file as published by NOAA NCEI, replace it when a new epoch is released
+	 (every five years, the current one is valid 2025.0 - 2030.0).
+*/
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	wmmMaxDegree     = 12
+	wmmRefRadius     = 6371.2 // km, geomagnetic reference radius.
+	wgs84A           = 6378.137
+	wgs84F           = 1 / 298.257223563
+	wmmValidityYears = 5
+)
+
+//go:embed WMM.COF
+var wmmCOF []byte
+
+// WMMModel holds the Gauss coefficients of a World Magnetic Model epoch, in nT and nT/year.
+type WMMModel struct {
+	Name         string
+	Epoch        float64 // decimal year
+	g, h, gd, hd [wmmMaxDegree + 1][wmmMaxDegree + 1]float64
+}
+
+// MagneticField is the main geomagnetic field at a point, in nT, in the local geodetic frame.
+type MagneticField struct {
+	North, East, Down float64
+	Declination       float64 // deg, east positive: true = magnetic + declination.
+	Inclination       float64 // deg, down positive.
+}
+
+var (
+	wmmOnce    sync.Once
+	wmmDefault *WMMModel
+	wmmErr     error
+)
+
+// ParseWMM reads a coefficient file in the NOAA WMM.COF format.
+func ParseWMM(data []byte) (*WMMModel, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("empty WMM coefficient file")
+	}
+	header := strings.Fields(scanner.Text())
+	if len(header) < 2 {
+		return nil, fmt.Errorf("invalid WMM header %q", scanner.Text())
+	}
+	epoch, err := strconv.ParseFloat(header[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WMM epoch %q", header[0])
+	}
+	model := &WMMModel{Name: header[1], Epoch: epoch}
+	terms := 0
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "9999") {
+			break
+		}
+		if len(f) < 6 {
+			return nil, fmt.Errorf("invalid WMM line %q", scanner.Text())
+		}
+		var v [6]float64
+		for i := range v {
+			if v[i], err = strconv.ParseFloat(f[i], 64); err != nil {
+				return nil, fmt.Errorf("invalid WMM line %q", scanner.Text())
+			}
+		}
+		n, m := int(v[0]), int(v[1])
+		if n < 1 || n > wmmMaxDegree || m < 0 || m > n {
+			return nil, fmt.Errorf("invalid WMM degree/order %d/%d", n, m)
+		}
+		model.g[n][m], model.h[n][m], model.gd[n][m], model.hd[n][m] = v[2], v[3], v[4], v[5]
+		terms++
+	}
+	if terms == 0 {
+		return nil, fmt.Errorf("no WMM coefficients")
+	}
+	return model, nil
+}
+
+// DefaultWMM returns the bundled model.
+func DefaultWMM() (*WMMModel, error) {
+	wmmOnce.Do(func() {
+		wmmDefault, wmmErr = ParseWMM(wmmCOF)
+	})
+	return wmmDefault, wmmErr
+}
+
+// DecimalYear converts a time to a decimal year, e.g. 2025.5 for early July 2025.
+func DecimalYear(t time.Time) float64 {
+	t = t.UTC()
+	start := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	return float64(t.Year()) + float64(t.Sub(start))/float64(end.Sub(start))
+}
+
+// Valid is whether the model may be used at decimal year.
+func (w *WMMModel) Valid(year float64) bool {
+	return year >= w.Epoch && year < w.Epoch+wmmValidityYears
+}
+
+// Field computes the main field at geodetic lat/lon (deg) and altitude (ft above the ellipsoid) at decimal year.
+func (w *WMMModel) Field(lat, lon, altFt, year float64) MagneticField {
+	dt := year - w.Epoch
+	h := altFt * 0.3048 / 1000 // km
+
+	// Geodetic to geocentric spherical coordinates.
+	phi := Radians(lat)
+	e2 := wgs84F * (2 - wgs84F)
+	rc := wgs84A / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+	p := (rc + h) * math.Cos(phi)
+	z := (rc*(1-e2) + h) * math.Sin(phi)
+	r := math.Hypot(p, z)
+	phiC := math.Asin(z / r)
+
+	// Legendre functions of cos(colatitude) with Gauss normalization, and the Schmidt semi-normalization factors.
+	theta := math.Pi/2 - phiC
+	cosT, sinT := math.Cos(theta), math.Sin(theta)
+	var pnm, dpnm, schmidt [wmmMaxDegree + 1][wmmMaxDegree + 1]float64
+	pnm[0][0] = 1
+	schmidt[0][0] = 1
+	for n := 1; n <= wmmMaxDegree; n++ {
+		schmidt[n][0] = schmidt[n-1][0] * float64(2*n-1) / float64(n)
+		for m := 0; m <= n; m++ {
+			switch {
+			case n == m:
+				pnm[n][m] = sinT * pnm[n-1][m-1]
+				dpnm[n][m] = sinT*dpnm[n-1][m-1] + cosT*pnm[n-1][m-1]
+			case n == 1:
+				pnm[n][m] = cosT * pnm[n-1][m]
+				dpnm[n][m] = cosT*dpnm[n-1][m] - sinT*pnm[n-1][m]
+			default:
+				k := float64((n-1)*(n-1)-m*m) / float64((2*n-1)*(2*n-3))
+				pnm[n][m] = cosT*pnm[n-1][m] - k*pnm[n-2][m]
+				dpnm[n][m] = cosT*dpnm[n-1][m] - sinT*pnm[n-1][m] - k*dpnm[n-2][m]
+			}
+			if m > 0 {
+				f := 1.0
+				if m == 1 {
+					f = 2
+				}
+				schmidt[n][m] = schmidt[n][m-1] * math.Sqrt(float64(n-m+1)*f/float64(n+m))
+			}
+		}
+	}
+
+	// Field components in the geocentric frame.
+	lambda := Radians(lon)
+	var br, bt, bp float64
+	ratio := wmmRefRadius / r
+	aor := ratio * ratio
+	for n := 1; n <= wmmMaxDegree; n++ {
+		aor *= ratio
+		for m := 0; m <= n; m++ {
+			g := (w.g[n][m] + dt*w.gd[n][m]) * schmidt[n][m]
+			hh := (w.h[n][m] + dt*w.hd[n][m]) * schmidt[n][m]
+			cosM, sinM := math.Cos(float64(m)*lambda), math.Sin(float64(m)*lambda)
+			br += aor * float64(n+1) * (g*cosM + hh*sinM) * pnm[n][m]
+			bt -= aor * (g*cosM + hh*sinM) * dpnm[n][m]
+			if sinT > 1e-10 {
+				bp += aor * float64(m) * (g*sinM - hh*cosM) * pnm[n][m] / sinT
+			}
+		}
+	}
+	north, east, down := -bt, bp, -br
+
+	// Rotate to the geodetic frame.
+	psi := phiC - phi
+	var f MagneticField
+	f.North = north*math.Cos(psi) - down*math.Sin(psi)
+	f.East = east
+	f.Down = north*math.Sin(psi) + down*math.Cos(psi)
+	f.Declination = Degrees(math.Atan2(f.East, f.North))
+	f.Inclination = Degrees(math.Atan2(f.Down, math.Hypot(f.North, f.East)))
+	return f
+}
+
+// MagneticDeclination returns the declination (variation) in degrees, east positive, from the bundled model.
+// ok is false outside the model's validity period; the declination is still the best available then.
+func MagneticDeclination(lat, lon, altFt float64, t time.Time) (decl float64, ok bool) {
+	w, err := DefaultWMM()
+	if err != nil {
+		return 0, false
+	}
+	year := DecimalYear(t)
+	return w.Field(lat, lon, altFt, year).Declination, w.Valid(year)
+}
+
+// TrueToMagnetic converts a true heading to magnetic with a declination, into [0, 360).
+func TrueToMagnetic(hdg, decl float64) float64 {
+	return math.Mod(hdg-decl+720, 360)
+}
+
+// MagneticToTrue converts a magnetic heading to true with a declination, into [0, 360).
+func MagneticToTrue(hdg, decl float64) float64 {
+	return math.Mod(hdg+decl+720, 360)
+}
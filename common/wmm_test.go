@@ -0,0 +1,132 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	wmm_test.go: Unit tests for the World Magnetic Model
+*/
+
+package common
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestMagneticDeclination compares against the declinations published on charts and by NOAA for 2025.
+func TestMagneticDeclination(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     float64
+	}{
+		{"Oshkosh", 43.98, -88.56, -3.7},
+		{"Seattle", 47.45, -122.31, 15.0},
+		{"Denver", 39.86, -104.67, 7.5},
+		{"Miami", 25.79, -80.29, -7.2},
+		{"Boston", 42.36, -71.01, -14.0},
+		{"London", 51.47, -0.45, 0.9},
+		{"Sydney", -33.94, 151.18, 12.8},
+		{"Cape Town", -33.97, 18.60, -26.6},
+		{"Tokyo", 35.55, 139.78, -7.8},
+	}
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		decl, ok := MagneticDeclination(tt.lat, tt.lon, 0, now)
+		if !ok || math.Abs(decl-tt.want) > 0.5 {
+			t.Errorf("%s: declination %.2f (valid %v), want %.1f", tt.name, decl, ok, tt.want)
+		}
+	}
+
+	if _, ok := MagneticDeclination(43.98, -88.56, 0, time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("model valid in 2031")
+	}
+}
+
+func TestWMMField(t *testing.T) {
+	w, err := DefaultWMM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Epoch != 2025 || w.Name != "WMM-2025" {
+		t.Errorf("model %s epoch %f", w.Name, w.Epoch)
+	}
+	// Oshkosh: ~54000 nT total field, 70° down.
+	f := w.Field(43.98, -88.56, 0, 2025.5)
+	total := math.Sqrt(f.North*f.North + f.East*f.East + f.Down*f.Down)
+	if math.Abs(total-54000) > 1500 || math.Abs(f.Inclination-70) > 1 {
+		t.Errorf("total %.0f nT, inclination %.1f", total, f.Inclination)
+	}
+	// Pointing up in the southern hemisphere.
+	if f := w.Field(-33.94, 151.18, 0, 2025.5); f.Inclination > -60 {
+		t.Errorf("Sydney inclination %.1f", f.Inclination)
+	}
+	// The field gets weaker with altitude (r^-3): ~0.3% at 10000 ft.
+	high := w.Field(43.98, -88.56, 10000, 2025.5)
+	ratio := math.Hypot(high.North, high.Down) / math.Hypot(f.North, f.Down)
+	if ratio > 0.999 || ratio < 0.99 {
+		t.Errorf("field ratio at 10000 ft %f", ratio)
+	}
+	// Defined at the poles.
+	for _, lat := range []float64{90, -90} {
+		if f := w.Field(lat, 0, 0, 2025.5); math.IsNaN(f.Declination) || math.IsNaN(f.Down) {
+			t.Errorf("NaN at %.0f", lat)
+		}
+	}
+}
+
+func TestParseWMM(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"Dipole", "2020.0 TEST 01/01/2020\n  1  0  -30000.0  0.0  10.0  0.0\n9999999999\n", false},
+		{"Empty", "", true},
+		{"Bad epoch", "x TEST\n  1  0  -30000.0  0.0  10.0  0.0\n", true},
+		{"No coefficients", "2020.0 TEST\n9999\n", true},
+		{"Bad degree", "2020.0 TEST\n 13  0  1.0  0.0  0.0  0.0\n", true},
+		{"Short line", "2020.0 TEST\n  1  0  1.0\n", true},
+	}
+	for _, tt := range tests {
+		w, err := ParseWMM([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		// An axial dipole: no declination, tan(inclination) = 2 tan(geocentric latitude).
+		f := w.Field(45, 30, 0, 2022)
+		if math.Abs(f.Declination) > 1e-9 {
+			t.Errorf("%s: declination %f", tt.name, f.Declination)
+		}
+		if want := Degrees(math.Atan(2 * math.Tan(Radians(44.81)))); math.Abs(f.Inclination-want) > 0.3 {
+			t.Errorf("%s: inclination %f, want %f", tt.name, f.Inclination, want)
+		}
+	}
+}
+
+func TestHeadingConversion(t *testing.T) {
+	tests := []struct {
+		hdg, decl, mag float64
+	}{
+		{90, 10, 80},
+		{5, 10, 355},
+		{355, -10, 5},
+		{0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := TrueToMagnetic(tt.hdg, tt.decl); math.Abs(got-tt.mag) > 1e-9 {
+			t.Errorf("TrueToMagnetic(%f, %f) = %f", tt.hdg, tt.decl, got)
+		}
+		if got := MagneticToTrue(tt.mag, tt.decl); math.Abs(got-tt.hdg) > 1e-9 {
+			t.Errorf("MagneticToTrue(%f, %f) = %f", tt.mag, tt.decl, got)
+		}
+	}
+	if y := DecimalYear(time.Date(2025, 7, 2, 12, 0, 0, 0, time.UTC)); math.Abs(y-2025.5) > 0.001 {
+		t.Errorf("DecimalYear = %f", y)
+	}
+}
@@ -8,7 +8,7 @@
 apt update
 
 on_chroot << EOF
-    apt install --yes dnsmasq ifplugd
+    apt install --yes dnsmasq ifplugd chrony pps-tools
 
     # try to reduce writing to SD card as much as possible, so they don't get
     # bricked when yanking the power cable
@@ -20,6 +20,7 @@ on_chroot << EOF
     systemctl disable triggerhappy
     systemctl disable wpa_supplicant
     systemctl disable systemd-timesyncd # We sync time with GPS. Make sure there is no conflict if we have internet connection
+    systemctl enable chrony # Disciplined by GPS/PPS via NTP SHM (see main/timesync.go), serves NTP to Wi-Fi clients
     systemctl disable resize2fs_once
 
     systemctl disable apt-daily.timer
@@ -114,6 +115,9 @@ install -m 644 files/motd "${ROOTFS_DIR}/etc/motd"
 # network default config. TODO: can't we just implement gen_gdl90 -write_network_settings or something to generate them from template?
 install files/stratux-dnsmasq.conf ${ROOTFS_DIR}/etc/dnsmasq.d/stratux-dnsmasq.conf
 
+# GPS time source for chrony
+install -m 644 files/chrony-stratux.conf ${ROOTFS_DIR}/etc/chrony/conf.d/stratux.conf
+
 install files/wpa_supplicant_ap.conf ${ROOTFS_DIR}/etc/wpa_supplicant/wpa_supplicant_ap.conf
 install files/interfaces ${ROOTFS_DIR}/etc/network/interfaces
 
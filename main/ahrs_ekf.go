@@ -0,0 +1,551 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	ahrs_ekf.go: Error state extended Kalman filter for attitude.
+	 The gyros propagate the attitude quaternion and the accelerometers the velocity (east, north, up). Nine
+	 error states - attitude (earth frame), velocity and gyro bias - are corrected by GPS ground velocity,
+	 GNSS vertical velocity, baro vertical speed and the magnetometer heading. Without GPS the accelerometer
+	 is taken as the gravity vector whenever the aircraft isn't accelerating or turning. As the velocity ties
+	 the specific force to the attitude, the filter doesn't mistake the load factor of a long coordinated
+	 turn for a tilt and keeps estimating the gyro bias that makes the simple filter drift.
+*/
+
+package main
+
+import (
+	"math"
+
+	"github.com/stratux/goflying/ahrs"
+)
+
+const (
+	ekfGravity = 9.80665       // m/s²
+	ekfKt      = 1852.0 / 3600 // m/s per kt
+	ekfMinDT   = 1e-6          // s, below this the sample is skipped
+	ekfMaxDT   = 2.0           // s, above this the filter restarts
+
+	// Process noise, variance growth per second.
+	ekfQAttitude = (0.5 * ahrs.Deg) * (0.5 * ahrs.Deg) // rad²
+	ekfQVelocity = 0.25                                // (m/s)²
+	ekfQBias     = (0.005 * ahrs.Deg) * (0.005 * ahrs.Deg)
+
+	// Initial uncertainty.
+	ekfP0Tilt    = (5 * ahrs.Deg) * (5 * ahrs.Deg)
+	ekfP0Heading = (30 * ahrs.Deg) * (30 * ahrs.Deg)
+	ekfP0Bias    = (0.5 * ahrs.Deg) * (0.5 * ahrs.Deg)
+
+	// Measurement noise (1 sigma).
+	ekfRGPSVelocity  = 0.5           // m/s, horizontal
+	ekfRGPSVS        = 0.8           // m/s
+	ekfRBaroVS       = 1.0           // m/s, the baro vertical speed lags
+	ekfRMagHeading   = 10 * ahrs.Deg // rad, per 20Hz sample
+	ekfRTrack        = 15 * ahrs.Deg // rad, the GPS track differs from the heading by the wind correction angle
+	ekfRGravity      = 0.5           // m/s²
+	ekfMinTrackGS    = 10.0          // m/s, the track isn't a heading below this
+	ekfGravityLimit  = 0.05          // G, deviation from 1 G that still counts as unaccelerated
+	ekfGravityRate   = 2 * ahrs.Deg  // rad/s, rotation rate that still counts as straight
+	ekfGate          = 25.0          // Normalized innovation squared (5 sigma) rejecting a measurement
+	ekfAidTimeout    = 5.0           // s, without GPS velocity for this long the velocity is unaided
+	ekfMagTimeout    = 5.0           // s, without magnetometer heading for this long the GPS track is used
+	ekfMaxRejectDur  = 5.0           // s of rejected GPS velocity after which the filter restarts
+	ekfTestSmoothing = 0.05          // Smoothing of the reported test ratios
+	ekfHealthyTilt   = 3.0           // degrees, largest roll/pitch sigma reported healthy
+	ekfHeadingLimit  = 30.0          // degrees, largest heading sigma to report a heading
+)
+
+// ahrsEKF implements ahrsEstimator. Attitude errors are small rotations in the earth frame,
+// q_true = exp(δθ)⊗q.
+type ahrsEKF struct {
+	q    [4]float64    // Aircraft to earth (east, north, up) frame.
+	v    [3]float64    // Velocity, earth frame, m/s.
+	bias [3]float64    // Gyro bias, aircraft frame, rad/s, on top of the calibration d.
+	p    [9][9]float64 // Error covariance: attitude, velocity, bias.
+
+	sensorQ [4]float64
+	f       [3][3]float64 // Sensor to aircraft frame.
+	c, d    [3]float64    // Calibrations: level accelerometer (G) and gyro (°/s), sensor frame.
+	aNorm   float64
+
+	initialized    bool
+	headingAligned bool // The heading has been set from the magnetometer or GPS track.
+	velAided       bool // The velocity is being corrected by GPS.
+	t, tW, tBaro   float64
+	tVel, tMag     float64 // Last fused GPS velocity and magnetometer heading.
+	tVelReject     float64 // Start of consecutive GPS velocity rejections, 0 if none.
+
+	fA [3]float64 // Last specific force, aircraft frame, m/s².
+	w  [3]float64 // Last bias corrected rotation rates, aircraft frame, rad/s.
+
+	derived ahrsDerived
+	health  AHRSFilterHealth
+	state   ahrs.State
+	logMap  map[string]interface{}
+}
+
+func newAHRSEKF() *ahrsEKF {
+	s := &ahrsEKF{aNorm: 1}
+	s.SetSensorQuaternion(&[4]float64{1, 0, 0, 0})
+	s.health.Filter = ahrsFilterEKF
+	s.logMap = make(map[string]interface{})
+	s.updateLogMap(ahrs.NewMeasurement())
+	return s
+}
+
+func (s *ahrsEKF) Name() string {
+	return ahrsFilterEKF
+}
+
+func (s *ahrsEKF) SetCalibrations(c, d *[3]float64) {
+	if c != nil {
+		s.c = *c
+		s.aNorm = 1
+		if n := math.Sqrt(c[0]*c[0] + c[1]*c[1] + c[2]*c[2]); n > 0.5 {
+			s.aNorm = n
+		}
+	}
+	if d != nil {
+		s.d = *d
+	}
+}
+
+func (s *ahrsEKF) SetSensorQuaternion(f *[4]float64) {
+	s.sensorQ = *f
+	s.f = ahrsRotationMatrix(*f)
+}
+
+func (s *ahrsEKF) Valid() bool {
+	return s.initialized
+}
+
+func (s *ahrsEKF) Reset() {
+	s.initialized = false
+	s.derived = ahrsDerived{}
+}
+
+// restart resets the filter after it diverged.
+func (s *ahrsEKF) restart() {
+	s.Reset()
+	s.bias = [3]float64{}
+	s.health.Resets++
+}
+
+func (s *ahrsEKF) RollPitchHeading() (roll, pitch, heading float64) {
+	roll, pitch, heading = ahrs.FromQuaternion(s.q[0], s.q[1], s.q[2], s.q[3])
+	if !s.headingAligned || math.Sqrt(s.p[2][2])/ahrs.Deg > ekfHeadingLimit {
+		heading = ahrs.Invalid
+	}
+	return
+}
+
+func (s *ahrsEKF) SlipSkid() float64 {
+	return s.derived.slipSkid
+}
+
+func (s *ahrsEKF) RateOfTurn() float64 {
+	return s.derived.turnRate
+}
+
+func (s *ahrsEKF) GLoad() float64 {
+	return s.derived.gLoad
+}
+
+func (s *ahrsEKF) GetState() *ahrs.State {
+	return &s.state
+}
+
+func (s *ahrsEKF) GetLogMap() map[string]interface{} {
+	return s.logMap
+}
+
+func (s *ahrsEKF) Health() AHRSFilterHealth {
+	h := s.health
+	if !s.initialized {
+		h.Healthy = false
+		return h
+	}
+	h.RollPitchSigma = math.Sqrt(math.Max(s.p[0][0], s.p[1][1])) / ahrs.Deg
+	h.HeadingSigma = math.Sqrt(s.p[2][2]) / ahrs.Deg
+	for i := range h.GyroBias {
+		h.GyroBias[i] = s.bias[i] / ahrs.Deg
+	}
+	h.Healthy = h.RollPitchSigma < ekfHealthyTilt && h.GPSTestRatio < 1 && h.BaroTestRatio < 1 && h.MagTestRatio < 1
+	return h
+}
+
+func (s *ahrsEKF) Compute(in *ahrsInput) {
+	if !in.SValid {
+		return
+	}
+	// Into the aircraft frame.
+	s.fA = ahrsRotate(s.f, [3]float64{in.A1, in.A2, in.A3})
+	for i := range s.fA {
+		s.fA[i] *= ekfGravity / s.aNorm
+	}
+	w := ahrsRotate(s.f, [3]float64{(in.B1 - s.d[0]) * ahrs.Deg, (in.B2 - s.d[1]) * ahrs.Deg, (in.B3 - s.d[2]) * ahrs.Deg})
+
+	dt := in.T - s.t
+	if !s.initialized || dt > ekfMaxDT || dt < 0 {
+		s.init(in)
+	} else if dt > ekfMinDT {
+		for i := range w {
+			s.w[i] = w[i] - s.bias[i]
+		}
+		s.predict(dt)
+		s.update(in)
+	}
+	s.t = in.T
+
+	if !s.finite() {
+		s.restart()
+		return
+	}
+	r := ahrsRotationMatrix(s.q)
+	var a [3]float64
+	for i := range a {
+		a[i] = s.fA[i] / ekfGravity
+	}
+	s.derived.update(a, -(r[2][0]*s.w[0] + r[2][1]*s.w[1] + r[2][2]*s.w[2]))
+	s.updateLogMap(in.Measurement)
+}
+
+// init levels the filter from the accelerometer, taking the heading from the magnetometer or GPS track if
+// there is one.
+func (s *ahrsEKF) init(in *ahrsInput) {
+	roll := math.Atan2(s.fA[1], s.fA[2])
+	pitch := math.Atan2(s.fA[0], math.Hypot(s.fA[1], s.fA[2]))
+	s.q[0], s.q[1], s.q[2], s.q[3] = ahrs.ToQuaternion(roll, pitch, 0)
+	s.v = [3]float64{}
+	s.p = [9][9]float64{}
+	s.p[0][0], s.p[1][1], s.p[2][2] = ekfP0Tilt, ekfP0Tilt, ekfP0Heading
+	for i := 3; i < 6; i++ {
+		s.p[i][i] = ekfRGPSVelocity * ekfRGPSVelocity
+	}
+	for i := 6; i < 9; i++ {
+		s.p[i][i] = ekfP0Bias
+	}
+	s.w = [3]float64{}
+	s.initialized = true
+	s.headingAligned = false
+	s.velAided = false
+	s.tW, s.tBaro = in.TW, in.TBaro
+	s.tVel, s.tMag, s.tVelReject = in.T, in.T, 0
+	s.health.GPSTestRatio, s.health.BaroTestRatio, s.health.MagTestRatio = 0, 0, 0
+	s.health.Rejected = 0
+	s.derived = ahrsDerived{}
+
+	if heading, ok := s.magHeading(in); ok {
+		s.alignHeading(heading, ekfRMagHeading)
+	} else if in.WValid && math.Hypot(in.W1, in.W2)*ekfKt > ekfMinTrackGS {
+		s.alignHeading(math.Atan2(in.W1, in.W2), ekfRTrack)
+	}
+	if in.WValid {
+		s.v = [3]float64{in.W1 * ekfKt, in.W2 * ekfKt, 0}
+		s.velAided = true
+	}
+}
+
+// predict propagates the state and covariance by dt with the last IMU sample.
+func (s *ahrsEKF) predict(dt float64) {
+	r := ahrsRotationMatrix(s.q)
+	fE := ahrsRotate(r, s.fA)
+
+	s.q = ahrsQuaternionProduct(s.q, ahrsRotationQuaternion([3]float64{s.w[0] * dt, s.w[1] * dt, s.w[2] * dt}))
+	s.q = ahrsNormalizeQuaternion(s.q)
+	for i := 0; i < 3; i++ {
+		s.v[i] += fE[i] * dt
+	}
+	s.v[2] -= ekfGravity * dt
+
+	// Error dynamics: δθ' = -R δb, δv' = -[R f]× δθ, δb' = 0.
+	var phi [9][9]float64
+	for i := 0; i < 9; i++ {
+		phi[i][i] = 1
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			phi[i][6+j] = -r[i][j] * dt
+		}
+	}
+	sk := ahrsSkew(fE)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			phi[3+i][j] = -sk[i][j] * dt
+		}
+	}
+	var tmp [9][9]float64
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			for k := 0; k < 9; k++ {
+				tmp[i][j] += phi[i][k] * s.p[k][j]
+			}
+		}
+	}
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			var x float64
+			for k := 0; k < 9; k++ {
+				x += tmp[i][k] * phi[j][k]
+			}
+			s.p[i][j] = x
+		}
+	}
+	for i := 0; i < 3; i++ {
+		s.p[i][i] += ekfQAttitude * dt
+		s.p[3+i][3+i] += ekfQVelocity * dt
+		s.p[6+i][6+i] += ekfQBias * dt
+	}
+	if !s.velAided {
+		s.clearVelocity()
+	}
+}
+
+// clearVelocity drops the velocity states while nothing measures them, so that the accelerometer
+// integrating without bound doesn't feed back into the attitude.
+func (s *ahrsEKF) clearVelocity() {
+	s.v = [3]float64{}
+	for i := 3; i < 6; i++ {
+		for j := 0; j < 9; j++ {
+			s.p[i][j], s.p[j][i] = 0, 0
+		}
+	}
+}
+
+func (s *ahrsEKF) update(in *ahrsInput) {
+	t := in.T
+	if in.WValid && in.TW != s.tW {
+		s.tW = in.TW
+		vel := [3]float64{in.W1 * ekfKt, in.W2 * ekfKt}
+		if !s.velAided {
+			s.v[0], s.v[1] = vel[0], vel[1]
+			s.p[3][3], s.p[4][4] = ekfRGPSVelocity*ekfRGPSVelocity, ekfRGPSVelocity*ekfRGPSVelocity
+			s.p[5][5] = ekfRGPSVS * ekfRGPSVS
+			s.velAided = true
+		} else {
+			nisE, okE := s.fuse(velocityRow(0), vel[0]-s.v[0], ekfRGPSVelocity*ekfRGPSVelocity)
+			nisN, okN := s.fuse(velocityRow(1), vel[1]-s.v[1], ekfRGPSVelocity*ekfRGPSVelocity)
+			s.testRatio(&s.health.GPSTestRatio, math.Max(nisE, nisN))
+			if okE && okN {
+				s.tVelReject = 0
+			} else if s.tVelReject == 0 {
+				s.tVelReject = t
+			} else if t-s.tVelReject > ekfMaxRejectDur {
+				s.restart()
+				return
+			}
+			if in.GPSVSValid {
+				s.fuse(velocityRow(2), in.GPSVS*ekfKt-s.v[2], ekfRGPSVS*ekfRGPSVS)
+			}
+		}
+		s.tVel = t
+	}
+	if s.velAided && t-s.tVel > ekfAidTimeout {
+		s.velAided = false
+		s.clearVelocity()
+	}
+	if s.velAided && in.BaroVSValid && in.TBaro != s.tBaro {
+		s.tBaro = in.TBaro
+		nis, _ := s.fuse(velocityRow(2), in.BaroVS*ekfKt-s.v[2], ekfRBaroVS*ekfRBaroVS)
+		s.testRatio(&s.health.BaroTestRatio, nis)
+	}
+
+	if heading, ok := s.magHeading(in); ok {
+		if !s.headingAligned {
+			s.alignHeading(heading, ekfRMagHeading)
+		} else {
+			nis, _ := s.fuseHeading(heading, ekfRMagHeading)
+			s.testRatio(&s.health.MagTestRatio, nis)
+		}
+		s.tMag = t
+	} else if in.WValid && t-s.tMag > ekfMagTimeout && math.Hypot(s.v[0], s.v[1]) > ekfMinTrackGS {
+		// No compass: like the simple filter, take the track as heading, but loosely.
+		track := math.Atan2(in.W1, in.W2)
+		if !s.headingAligned {
+			s.alignHeading(track, ekfRTrack)
+		} else {
+			s.fuseHeading(track, ekfRTrack)
+		}
+	}
+
+	if !s.velAided {
+		s.fuseGravity()
+	}
+}
+
+// fuse applies the scalar measurement with innovation y, observation row h and noise variance r. It returns
+// the normalized innovation squared and whether the measurement passed the gate.
+func (s *ahrsEKF) fuse(h [9]float64, y, r float64) (nis float64, ok bool) {
+	var ph [9]float64 // P·hᵀ
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			ph[i] += s.p[i][j] * h[j]
+		}
+	}
+	sv := r
+	for i := 0; i < 9; i++ {
+		sv += h[i] * ph[i]
+	}
+	nis = y * y / sv
+	if nis > ekfGate {
+		s.health.Rejected++
+		return nis, false
+	}
+	var dx [9]float64
+	for i := 0; i < 9; i++ {
+		k := ph[i] / sv
+		dx[i] = k * y
+		for j := 0; j < 9; j++ {
+			s.p[i][j] -= k * ph[j]
+		}
+	}
+	for i := 0; i < 9; i++ {
+		for j := i + 1; j < 9; j++ {
+			m := (s.p[i][j] + s.p[j][i]) / 2
+			s.p[i][j], s.p[j][i] = m, m
+		}
+		s.p[i][i] = math.Max(s.p[i][i], 1e-12)
+	}
+	s.correct(dx)
+	return nis, true
+}
+
+// correct moves the state by the error estimate dx.
+func (s *ahrsEKF) correct(dx [9]float64) {
+	s.q = ahrsNormalizeQuaternion(ahrsQuaternionProduct(ahrsRotationQuaternion([3]float64{dx[0], dx[1], dx[2]}), s.q))
+	for i := 0; i < 3; i++ {
+		s.v[i] += dx[3+i]
+		s.bias[i] += dx[6+i]
+	}
+}
+
+// fuseHeading corrects the heading towards heading (radians true) with uncertainty sigma.
+func (s *ahrsEKF) fuseHeading(heading, sigma float64) (nis float64, ok bool) {
+	_, _, psi := ahrs.FromQuaternion(s.q[0], s.q[1], s.q[2], s.q[3])
+	// Only the rotation about the vertical: a magnetic disturbance shouldn't tilt the attitude.
+	var h [9]float64
+	h[2] = -1
+	return s.fuse(h, ahrs.AngleDiff(heading, psi), sigma*sigma)
+}
+
+// alignHeading sets the heading to heading (radians true), as the first heading measurement can be too far off
+// for the linearized update.
+func (s *ahrsEKF) alignHeading(heading, sigma float64) {
+	_, _, psi := ahrs.FromQuaternion(s.q[0], s.q[1], s.q[2], s.q[3])
+	s.q = ahrsNormalizeQuaternion(ahrsQuaternionProduct(
+		ahrsRotationQuaternion([3]float64{0, 0, -ahrs.AngleDiff(heading, psi)}), s.q))
+	for j := 0; j < 9; j++ {
+		s.p[2][j], s.p[j][2] = 0, 0
+	}
+	s.p[2][2] = sigma * sigma
+	s.headingAligned = true
+}
+
+// magHeading returns the true heading measured by the magnetometer with the current tilt: the heading that
+// turns the horizontal field towards the declination.
+func (s *ahrsEKF) magHeading(in *ahrsInput) (heading float64, ok bool) {
+	if !in.MValid || !in.DeclinationValid {
+		return 0, false
+	}
+	mA := ahrsRotate(s.f, [3]float64{in.M1, in.M2, in.M3})
+	mE := ahrsRotate(ahrsRotationMatrix(s.q), mA)
+	if math.Hypot(mE[0], mE[1]) < 1e-3 {
+		return 0, false
+	}
+	_, _, psi := ahrs.FromQuaternion(s.q[0], s.q[1], s.q[2], s.q[3])
+	heading = psi + ahrs.AngleDiff(in.Declination*ahrs.Deg, math.Atan2(mE[0], mE[1]))
+	return math.Mod(heading+4*math.Pi, 2*math.Pi), true
+}
+
+// fuseGravity takes the specific force as pointing up while the aircraft is neither accelerating nor turning.
+func (s *ahrsEKF) fuseGravity() {
+	n := math.Sqrt(s.fA[0]*s.fA[0] + s.fA[1]*s.fA[1] + s.fA[2]*s.fA[2])
+	if math.Abs(n/ekfGravity-1) > ekfGravityLimit ||
+		math.Sqrt(s.w[0]*s.w[0]+s.w[1]*s.w[1]+s.w[2]*s.w[2]) > ekfGravityRate {
+		return
+	}
+	fE := ahrsRotate(ahrsRotationMatrix(s.q), s.fA)
+	// y = g - R·f, H = -[R·f]×, east and north rows.
+	sk := ahrsSkew(fE)
+	for i := 0; i < 2; i++ {
+		var h [9]float64
+		for j := 0; j < 3; j++ {
+			h[j] = -sk[i][j]
+		}
+		s.fuse(h, -fE[i], ekfRGravity*ekfRGravity)
+	}
+}
+
+func (s *ahrsEKF) testRatio(ratio *float64, nis float64) {
+	*ratio += ekfTestSmoothing * (nis/ekfGate - *ratio)
+}
+
+func (s *ahrsEKF) finite() bool {
+	for _, x := range s.q {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return false
+		}
+	}
+	for i := 0; i < 9; i++ {
+		if math.IsNaN(s.p[i][i]) || math.IsInf(s.p[i][i], 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ahrsEKF) updateLogMap(m *ahrs.Measurement) {
+	s.state.E0, s.state.E1, s.state.E2, s.state.E3 = s.q[0], s.q[1], s.q[2], s.q[3]
+	s.state.F0, s.state.F1, s.state.F2, s.state.F3 = s.sensorQ[0], s.sensorQ[1], s.sensorQ[2], s.sensorQ[3]
+	s.state.C1, s.state.C2, s.state.C3 = s.c[0], s.c[1], s.c[2]
+	s.state.D1, s.state.D2, s.state.D3 = s.d[0], s.d[1], s.d[2]
+	s.state.H1, s.state.H2, s.state.H3 = s.w[0]/ahrs.Deg, s.w[1]/ahrs.Deg, s.w[2]/ahrs.Deg
+	s.state.Z1, s.state.Z2, s.state.Z3 = s.fA[0]/ekfGravity, s.fA[1]/ekfGravity, s.fA[2]/ekfGravity
+	s.state.T = m.T
+
+	roll, pitch, heading := ahrs.FromQuaternion(s.q[0], s.q[1], s.q[2], s.q[3])
+	h := s.Health()
+	for k, v := range map[string]float64{
+		"T": m.T, "TW": m.TW,
+		"A1": m.A1, "A2": m.A2, "A3": m.A3, "B1": m.B1, "B2": m.B2, "B3": m.B3, "M1": m.M1, "M2": m.M2, "M3": m.M3,
+		"W1": m.W1, "W2": m.W2,
+		"Roll": roll / ahrs.Deg, "Pitch": pitch / ahrs.Deg, "Heading": heading / ahrs.Deg,
+		"V1": s.v[0] / ekfKt, "V2": s.v[1] / ekfKt, "V3": s.v[2] / ekfKt,
+		"Bias1": h.GyroBias[0], "Bias2": h.GyroBias[1], "Bias3": h.GyroBias[2],
+		"RollPitchSigma": h.RollPitchSigma, "HeadingSigma": h.HeadingSigma,
+		"GPSTestRatio": h.GPSTestRatio, "BaroTestRatio": h.BaroTestRatio, "MagTestRatio": h.MagTestRatio,
+	} {
+		s.logMap[k] = v
+	}
+}
+
+// velocityRow observes the velocity component i.
+func velocityRow(i int) (h [9]float64) {
+	h[3+i] = 1
+	return
+}
+
+// ahrsSkew returns the cross product matrix [v]×.
+func ahrsSkew(v [3]float64) [3][3]float64 {
+	return [3][3]float64{
+		{0, -v[2], v[1]},
+		{v[2], 0, -v[0]},
+		{-v[1], v[0], 0},
+	}
+}
+
+// ahrsRotationQuaternion returns the quaternion of the rotation vector phi (radians).
+func ahrsRotationQuaternion(phi [3]float64) [4]float64 {
+	angle := math.Sqrt(phi[0]*phi[0] + phi[1]*phi[1] + phi[2]*phi[2])
+	if angle < 1e-12 {
+		return [4]float64{1, phi[0] / 2, phi[1] / 2, phi[2] / 2}
+	}
+	sin, cos := math.Sincos(angle / 2)
+	return [4]float64{cos, sin * phi[0] / angle, sin * phi[1] / angle, sin * phi[2] / angle}
+}
+
+func ahrsNormalizeQuaternion(q [4]float64) [4]float64 {
+	q[0], q[1], q[2], q[3] = ahrs.QuaternionNormalize(q[0], q[1], q[2], q[3])
+	return q
+}
@@ -0,0 +1,288 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	ahrs_ekf_test.go: Simulated flights through the attitude Kalman filter
+*/
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/goflying/ahrs"
+)
+
+// ekfTruth returns the attitude (degrees) and velocity (east, north, up, m/s) at time t.
+type ekfTruth func(t float64) (roll, pitch, heading float64, vel [3]float64)
+
+type ekfFlight struct {
+	truth       ekfTruth
+	gyroBias    [3]float64 // °/s
+	gps, mag    bool
+	declination float64 // degrees
+	duration    float64 // s
+	// check is called for every sample after the input was computed.
+	check func(t float64, in *ahrsInput)
+	// corrupt may alter the input before it's computed.
+	corrupt func(t float64, in *ahrsInput)
+}
+
+const ekfTestDT = 0.05
+
+func ekfTruthQuaternion(truth ekfTruth, t float64) [4]float64 {
+	roll, pitch, heading, _ := truth(t)
+	var q [4]float64
+	q[0], q[1], q[2], q[3] = ahrs.ToQuaternion(roll*ahrs.Deg, pitch*ahrs.Deg, heading*ahrs.Deg)
+	return q
+}
+
+// fly feeds the IMU, GPS and magnetometer readings of the flight to the estimator.
+func (f ekfFlight) fly(s ahrsEstimator) {
+	const h = 1e-3
+	// Earth's field with 60° inclination.
+	field := [3]float64{20 * math.Sin(f.declination*ahrs.Deg), 20 * math.Cos(f.declination*ahrs.Deg), -35}
+	m := ahrs.NewMeasurement()
+	in := &ahrsInput{Measurement: m, Declination: f.declination, DeclinationValid: f.gps || f.mag}
+	for i := 0; float64(i)*ekfTestDT <= f.duration; i++ {
+		t := float64(i) * ekfTestDT
+		q := ekfTruthQuaternion(f.truth, t)
+		r := ahrsRotationMatrix(q)
+
+		// Body rates from the change in attitude, specific force from the change in velocity.
+		q0, q1 := ekfTruthQuaternion(f.truth, t-h), ekfTruthQuaternion(f.truth, t+h)
+		dq := ahrsQuaternionProduct([4]float64{q0[0], -q0[1], -q0[2], -q0[3]}, q1)
+		if dq[0] < 0 {
+			dq = [4]float64{-dq[0], -dq[1], -dq[2], -dq[3]}
+		}
+		_, _, _, v0 := f.truth(t - h)
+		_, _, _, v1 := f.truth(t + h)
+		_, _, _, v := f.truth(t)
+		var fE [3]float64
+		for j := range fE {
+			fE[j] = (v1[j] - v0[j]) / (2 * h)
+		}
+		fE[2] += ekfGravity
+		fA := ahrsRotateT(r, fE)
+		mA := ahrsRotateT(r, field)
+
+		m.T = t
+		m.SValid = true
+		m.A1, m.A2, m.A3 = fA[0]/ekfGravity, fA[1]/ekfGravity, fA[2]/ekfGravity
+		m.B1 = 2*dq[1]/(2*h)/ahrs.Deg + f.gyroBias[0]
+		m.B2 = 2*dq[2]/(2*h)/ahrs.Deg + f.gyroBias[1]
+		m.B3 = 2*dq[3]/(2*h)/ahrs.Deg + f.gyroBias[2]
+		m.MValid = f.mag
+		m.M1, m.M2, m.M3 = mA[0], mA[1], mA[2]
+		m.WValid = f.gps
+		if f.gps && i%4 == 0 { // 5Hz
+			m.TW = t
+			m.W1, m.W2 = v[0]/ekfKt, v[1]/ekfKt
+			in.GPSVS, in.GPSVSValid = v[2]/ekfKt, true
+			in.BaroVS, in.BaroVSValid, in.TBaro = v[2]/ekfKt, true, t
+		}
+		if f.corrupt != nil {
+			f.corrupt(t, in)
+		}
+		s.Compute(in)
+		if f.check != nil {
+			f.check(t, in)
+		}
+	}
+}
+
+func ekfAttitudeErrors(s ahrsEstimator, truth ekfTruth, t float64) (roll, pitch, heading float64) {
+	r, p, h := s.RollPitchHeading()
+	tr, tp, th, _ := truth(t)
+	heading = ahrs.Invalid
+	if !isAHRSInvalidValue(h) {
+		heading = math.Abs(simAngleDiff(h/ahrs.Deg, th))
+	}
+	return math.Abs(r/ahrs.Deg - tr), math.Abs(p/ahrs.Deg - tp), heading
+}
+
+func TestAHRSEKFStatic(t *testing.T) {
+	// On the ground without GPS: gravity levels the filter, the compass gives the heading, and together they
+	// observe the gyro bias.
+	truth := func(t float64) (float64, float64, float64, [3]float64) {
+		return 2, -3, 120, [3]float64{}
+	}
+	bias := [3]float64{0.3, -0.2, 0.4}
+	s := newAHRSEKF()
+	ekfFlight{truth: truth, gyroBias: bias, mag: true, declination: 10, duration: 300}.fly(s)
+
+	roll, pitch, heading := ekfAttitudeErrors(s, truth, 300)
+	if roll > 0.5 || pitch > 0.5 || heading > 2 {
+		t.Errorf("attitude errors roll %.2f° pitch %.2f° heading %.2f°", roll, pitch, heading)
+	}
+	h := s.Health()
+	for i := range bias {
+		if math.Abs(h.GyroBias[i]-bias[i]) > 0.05 {
+			t.Errorf("gyro bias %v, want %v", h.GyroBias, bias)
+			break
+		}
+	}
+	if !h.Healthy || h.Filter != ahrsFilterEKF || h.Resets != 0 {
+		t.Errorf("health %+v", h)
+	}
+}
+
+// ekfTurn is a straight flight at 100kt heading 030, rolling into a coordinated standard rate turn at 60 s
+// and holding it.
+func ekfTurn(t float64) (roll, pitch, heading float64, vel [3]float64) {
+	const (
+		speed  = 100 * ekfKt
+		start  = 60.0
+		rollIn = 5.0
+		rate   = 3 * ahrs.Deg
+	)
+	psi, omega := 30*ahrs.Deg, 0.0
+	switch {
+	case t > start+rollIn:
+		omega = rate
+		psi += rate*rollIn/2 + rate*(t-start-rollIn)
+	case t > start:
+		omega = rate * (t - start) / rollIn
+		psi += omega * (t - start) / 2
+	}
+	roll = math.Atan(speed*omega/ekfGravity) / ahrs.Deg
+	vel = [3]float64{speed * math.Sin(psi), speed * math.Cos(psi), 0}
+	return roll, 0, math.Mod(psi/ahrs.Deg, 360), vel
+}
+
+func TestAHRSEKFCoordinatedTurn(t *testing.T) {
+	tests := []struct {
+		name string
+		mag  bool
+	}{
+		{"GPS", false},
+		{"GPS and compass", true},
+	}
+	for _, tt := range tests {
+		s := newAHRSEKF()
+		var worstRoll, worstPitch, worstHeading float64
+		ekfFlight{truth: ekfTurn, gyroBias: [3]float64{0.2, -0.3, 0.5}, gps: true, mag: tt.mag, declination: -5,
+			duration: 600,
+			check: func(ts float64, in *ahrsInput) {
+				if ts < 30 {
+					return
+				}
+				roll, pitch, heading := ekfAttitudeErrors(s, ekfTurn, ts)
+				worstRoll, worstPitch = math.Max(worstRoll, roll), math.Max(worstPitch, pitch)
+				worstHeading = math.Max(worstHeading, heading)
+			},
+		}.fly(s)
+		// Nine minutes in a standard rate turn is where the simple filter drifts away.
+		if worstRoll > 2 || worstPitch > 2 || worstHeading > 5 {
+			t.Errorf("%s: worst errors roll %.2f° pitch %.2f° heading %.2f°", tt.name, worstRoll, worstPitch, worstHeading)
+		}
+		if turnRate := s.RateOfTurn(); math.Abs(turnRate-3) > 0.1 {
+			t.Errorf("%s: rate of turn %.2f°/s", tt.name, turnRate)
+		}
+		if g := s.GLoad(); math.Abs(g-1/math.Cos(ekfTurnRoll())) > 0.01 {
+			t.Errorf("%s: G load %.3f", tt.name, g)
+		}
+		if slip := s.SlipSkid(); math.Abs(slip) > 0.1 {
+			t.Errorf("%s: slip/skid %.2f°", tt.name, slip)
+		}
+		h := s.Health()
+		if !h.Healthy || h.Rejected > 0 {
+			t.Errorf("%s: health %+v", tt.name, h)
+		}
+		for i, b := range []float64{0.2, -0.3, 0.5} {
+			if math.Abs(h.GyroBias[i]-b) > 0.05 {
+				t.Errorf("%s: gyro bias %v", tt.name, h.GyroBias)
+				break
+			}
+		}
+	}
+}
+
+// ekfTurnRoll is the bank angle of the standard rate turn in ekfTurn, radians.
+func ekfTurnRoll() float64 {
+	roll, _, _, _ := ekfTurn(1000)
+	return roll * ahrs.Deg
+}
+
+func TestAHRSEKFHeadingValidity(t *testing.T) {
+	tests := []struct {
+		name     string
+		gps, mag bool
+		valid    bool
+	}{
+		{"Nothing to tell the heading", false, false, false},
+		{"Compass", false, true, true},
+		{"GPS track", true, false, true},
+	}
+	for _, tt := range tests {
+		s := newAHRSEKF()
+		ekfFlight{truth: ekfTurn, gps: tt.gps, mag: tt.mag, duration: 20}.fly(s)
+		if _, _, heading := s.RollPitchHeading(); isAHRSInvalidValue(heading) == tt.valid {
+			t.Errorf("%s: heading %f", tt.name, heading)
+		}
+	}
+}
+
+func TestAHRSEKFRejectsOutliers(t *testing.T) {
+	s := newAHRSEKF()
+	var worstRoll float64
+	ekfFlight{truth: ekfTurn, gps: true, duration: 120,
+		corrupt: func(ts float64, in *ahrsInput) {
+			if ts > 40 && ts < 42 && in.TW == ts { // A GPS glitch.
+				in.W1 += 80
+			}
+		},
+		check: func(ts float64, in *ahrsInput) {
+			if ts > 30 {
+				roll, _, _ := ekfAttitudeErrors(s, ekfTurn, ts)
+				worstRoll = math.Max(worstRoll, roll)
+			}
+		},
+	}.fly(s)
+	h := s.Health()
+	if h.Rejected == 0 || h.Resets != 0 || worstRoll > 2 {
+		t.Errorf("glitch: health %+v, worst roll error %.2f°", h, worstRoll)
+	}
+
+	// A velocity that never agrees means the filter itself is off, so it starts over.
+	s = newAHRSEKF()
+	ekfFlight{truth: ekfTurn, gps: true, duration: 60,
+		corrupt: func(ts float64, in *ahrsInput) {
+			if ts > 30 && in.TW == ts {
+				in.W1 += 80
+			}
+		},
+	}.fly(s)
+	if h := s.Health(); h.Resets == 0 {
+		t.Errorf("persistent disagreement: health %+v", h)
+	}
+}
+
+func TestAHRSEKFMounting(t *testing.T) {
+	// The sensor standing on its side, turned 90°: readings are rotated into the aircraft frame.
+	f := axisQuaternion(90, [3]float64{0, 0, 1})
+	f = ahrsQuaternionProduct(f, axisQuaternion(-90, [3]float64{0, 1, 0}))
+	s := newAHRSEKF()
+	s.SetSensorQuaternion(&f)
+	fr := ahrsRotationMatrix(f)
+
+	truth := func(t float64) (float64, float64, float64, [3]float64) {
+		return 10, 5, 200, [3]float64{}
+	}
+	// Re-express the simulated aircraft frame readings in the sensor frame.
+	flight := ekfFlight{truth: truth, mag: true, duration: 60}
+	flight.corrupt = func(ts float64, in *ahrsInput) {
+		a := ahrsRotateT(fr, [3]float64{in.A1, in.A2, in.A3})
+		b := ahrsRotateT(fr, [3]float64{in.B1, in.B2, in.B3})
+		m := ahrsRotateT(fr, [3]float64{in.M1, in.M2, in.M3})
+		in.A1, in.A2, in.A3 = a[0], a[1], a[2]
+		in.B1, in.B2, in.B3 = b[0], b[1], b[2]
+		in.M1, in.M2, in.M3 = m[0], m[1], m[2]
+	}
+	flight.fly(s)
+	if roll, pitch, heading := ekfAttitudeErrors(s, truth, 60); roll > 0.5 || pitch > 0.5 || heading > 2 {
+		t.Errorf("attitude errors roll %.2f° pitch %.2f° heading %.2f°", roll, pitch, heading)
+	}
+}
@@ -0,0 +1,287 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	ahrs_estimator.go: Selectable attitude estimators for the IMU.
+	 sensorAttitudeSender feeds every IMU sample to the estimator chosen by the AHRSFilter setting:
+	  simple - goflying's complementary filter, aided by the GPS ground track.
+	  ekf    - extended Kalman filter fusing GPS velocity, baro vertical speed and magnetometer (ahrs_ekf.go).
+	  fusion - the IMU's own sensor fusion (BNO085).
+	 Left empty, the IMU's own fusion is used when available and the simple filter otherwise.
+*/
+
+package main
+
+import (
+	"math"
+
+	"github.com/stratux/goflying/ahrs"
+	"github.com/stratux/stratux/common"
+	"github.com/stratux/stratux/sensors"
+)
+
+const (
+	ahrsFilterSimple = "simple"
+	ahrsFilterEKF    = "ekf"
+	ahrsFilterFusion = "fusion"
+)
+
+// ahrsInput is one IMU sample together with the aiding measurements available at that time.
+type ahrsInput struct {
+	*ahrs.Measurement         // IMU in the sensor frame, GPS ground velocity in W1/W2 (kt)
+	BaroVS            float64 // Baro vertical speed, kt
+	BaroVSValid       bool
+	TBaro             float64 // Time of the last baro measurement, s
+	GPSVS             float64 // GNSS vertical velocity, kt
+	GPSVSValid        bool
+	Declination       float64 // Magnetic declination, degrees east
+	DeclinationValid  bool
+}
+
+// AHRSFilterHealth describes how the active attitude estimator is doing. It's part of the situation so the
+// web interface and the logs can show why an attitude isn't trusted.
+type AHRSFilterHealth struct {
+	Filter         string     // Active estimator, see ahrsFilter*.
+	Healthy        bool       // Converged, and the aiding measurements agree with the prediction.
+	RollPitchSigma float64    // Attitude uncertainty (1 sigma), degrees. 0 if not estimated.
+	HeadingSigma   float64    // Heading uncertainty (1 sigma), degrees. 0 if not estimated.
+	GyroBias       [3]float64 // Estimated gyro bias on top of the calibration, aircraft frame, °/s.
+	GPSTestRatio   float64    // Smoothed normalized innovations, 1 is the rejection threshold.
+	BaroTestRatio  float64
+	MagTestRatio   float64
+	Rejected       uint32 // Measurements rejected as outliers since the last reset.
+	Resets         uint32 // Times the estimator restarted because it diverged.
+}
+
+// ahrsEstimator is implemented by the attitude filters sensorAttitudeSender can run. Angles follow the
+// goflying conventions: radians out of RollPitchHeading, with heading ahrs.Invalid when it isn't observable.
+type ahrsEstimator interface {
+	Name() string
+	Compute(in *ahrsInput)
+	SetCalibrations(c, d *[3]float64)
+	SetSensorQuaternion(f *[4]float64)
+	Valid() bool
+	Reset()
+	RollPitchHeading() (roll, pitch, heading float64)
+	SlipSkid() float64   // degrees
+	RateOfTurn() float64 // degrees per second, right turns positive
+	GLoad() float64
+	GetState() *ahrs.State
+	GetLogMap() map[string]interface{}
+	Health() AHRSFilterHealth
+}
+
+// ahrsFilterName resolves the AHRSFilter setting for the connected IMU.
+func ahrsFilterName(setting string, reader sensors.IMUReader) string {
+	_, fusion := reader.(sensors.FusionReader)
+	switch setting {
+	case ahrsFilterSimple, ahrsFilterEKF:
+		return setting
+	case ahrsFilterFusion:
+		if fusion {
+			return setting
+		}
+	}
+	if fusion {
+		return ahrsFilterFusion
+	}
+	return ahrsFilterSimple
+}
+
+// newAHRSEstimator creates the estimator named by ahrsFilterName.
+func newAHRSEstimator(name string, reader sensors.IMUReader) ahrsEstimator {
+	switch name {
+	case ahrsFilterEKF:
+		return newAHRSEKF()
+	case ahrsFilterFusion:
+		if fusion, ok := reader.(sensors.FusionReader); ok {
+			return newFusionEstimator(fusion)
+		}
+	}
+	return &simpleEstimator{SimpleState: ahrs.NewSimpleAHRS()}
+}
+
+// simpleEstimator runs goflying's SimpleState.
+type simpleEstimator struct {
+	*ahrs.SimpleState
+}
+
+func (s *simpleEstimator) Name() string {
+	return ahrsFilterSimple
+}
+
+func (s *simpleEstimator) Compute(in *ahrsInput) {
+	// The simple filter takes the vertical speed as the third ground speed component.
+	if in.BaroVSValid {
+		in.W3 = in.BaroVS
+	} else if in.GPSVSValid {
+		in.W3 = in.GPSVS
+	}
+	s.SimpleState.Compute(in.Measurement)
+}
+
+func (s *simpleEstimator) Health() AHRSFilterHealth {
+	return AHRSFilterHealth{Filter: ahrsFilterSimple, Healthy: s.Valid()}
+}
+
+// ahrsDerived tracks the values every estimator reports besides the attitude, from the IMU in the aircraft
+// frame, smoothed like the simple filter does.
+type ahrsDerived struct {
+	slipSkid, gLoad, turnRate float64 // degrees, G, degrees per second
+	initialized               bool
+}
+
+const ahrsDerivedSmoothing = 0.1
+
+// update takes the specific force in the aircraft frame (G) and the rotation rate about the vertical, positive
+// for right turns (rad/s).
+func (d *ahrsDerived) update(a [3]float64, yawRate float64) {
+	slipSkid := math.Atan2(-a[1], a[2]) / ahrs.Deg
+	turnRate := yawRate / ahrs.Deg
+	if !d.initialized {
+		d.slipSkid, d.gLoad, d.turnRate = slipSkid, a[2], turnRate
+		d.initialized = true
+		return
+	}
+	d.slipSkid += ahrsDerivedSmoothing * (slipSkid - d.slipSkid)
+	d.gLoad += ahrsDerivedSmoothing * (a[2] - d.gLoad)
+	d.turnRate += ahrsDerivedSmoothing * (turnRate - d.turnRate)
+}
+
+// fusionEstimator reports the orientation an IMU with its own sensor fusion computes.
+type fusionEstimator struct {
+	reader          sensors.FusionReader
+	state           ahrs.State
+	f               [3][3]float64 // Sensor to aircraft frame.
+	aNorm           float64
+	d               [3]float64
+	roll, pitch     float64 // radians
+	heading         float64 // radians true, or ahrs.Invalid
+	magHeading      float64 // degrees magnetic
+	headingAccuracy float64
+	valid           bool
+	derived         ahrsDerived
+	logMap          map[string]interface{}
+}
+
+func newFusionEstimator(reader sensors.FusionReader) *fusionEstimator {
+	s := &fusionEstimator{reader: reader, aNorm: 1}
+	s.SetSensorQuaternion(&[4]float64{1, 0, 0, 0})
+	s.logMap = map[string]interface{}{"Roll": 0.0, "Pitch": 0.0, "Heading": 0.0, "HeadingAccuracy": 0.0}
+	return s
+}
+
+func (s *fusionEstimator) Name() string {
+	return ahrsFilterFusion
+}
+
+func (s *fusionEstimator) Compute(in *ahrsInput) {
+	s.state.T = in.T
+	q, accuracy, err := s.reader.Orientation()
+	s.valid = err == nil
+	if !s.valid {
+		return
+	}
+	f := [4]float64{s.state.F0, s.state.F1, s.state.F2, s.state.F3}
+	roll, pitch, heading := fusedAttitude(q, f)
+	s.roll, s.pitch, s.heading, s.magHeading = roll*ahrs.Deg, pitch*ahrs.Deg, ahrs.Invalid, heading
+	if in.DeclinationValid {
+		s.heading = common.MagneticToTrue(heading, in.Declination) * ahrs.Deg
+	}
+	s.headingAccuracy = accuracy
+	e := ahrsQuaternionProduct(q, [4]float64{f[0], -f[1], -f[2], -f[3]})
+	s.state.E0, s.state.E1, s.state.E2, s.state.E3 = e[0], e[1], e[2], e[3]
+
+	a := ahrsRotate(s.f, [3]float64{in.A1 / s.aNorm, in.A2 / s.aNorm, in.A3 / s.aNorm})
+	w := ahrsRotate(s.f, [3]float64{(in.B1 - s.d[0]) * ahrs.Deg, (in.B2 - s.d[1]) * ahrs.Deg, (in.B3 - s.d[2]) * ahrs.Deg})
+	r := ahrsRotationMatrix(e)
+	s.derived.update(a, -(r[2][0]*w[0] + r[2][1]*w[1] + r[2][2]*w[2]))
+
+	s.logMap["Roll"], s.logMap["Pitch"], s.logMap["Heading"], s.logMap["HeadingAccuracy"] = roll, pitch, heading, accuracy
+}
+
+func (s *fusionEstimator) SetCalibrations(c, d *[3]float64) {
+	if c != nil {
+		s.aNorm = 1
+		if n := math.Sqrt(c[0]*c[0] + c[1]*c[1] + c[2]*c[2]); n > 0.5 {
+			s.aNorm = n
+		}
+	}
+	if d != nil {
+		s.d = *d
+	}
+}
+
+func (s *fusionEstimator) SetSensorQuaternion(f *[4]float64) {
+	s.state.F0, s.state.F1, s.state.F2, s.state.F3 = f[0], f[1], f[2], f[3]
+	s.f = ahrsRotationMatrix(*f)
+}
+
+func (s *fusionEstimator) Valid() bool {
+	return s.valid
+}
+
+func (s *fusionEstimator) Reset() {
+	s.derived = ahrsDerived{}
+}
+
+func (s *fusionEstimator) RollPitchHeading() (roll, pitch, heading float64) {
+	return s.roll, s.pitch, s.heading
+}
+
+func (s *fusionEstimator) SlipSkid() float64 {
+	return s.derived.slipSkid
+}
+
+func (s *fusionEstimator) RateOfTurn() float64 {
+	return s.derived.turnRate
+}
+
+func (s *fusionEstimator) GLoad() float64 {
+	return s.derived.gLoad
+}
+
+func (s *fusionEstimator) GetState() *ahrs.State {
+	return &s.state
+}
+
+func (s *fusionEstimator) GetLogMap() map[string]interface{} {
+	return s.logMap
+}
+
+func (s *fusionEstimator) Health() AHRSFilterHealth {
+	return AHRSFilterHealth{Filter: ahrsFilterFusion, Healthy: s.valid, HeadingSigma: s.headingAccuracy}
+}
+
+// ahrsRotationMatrix returns the rotation matrix of the unit quaternion q.
+func ahrsRotationMatrix(q [4]float64) [3][3]float64 {
+	return *ahrs.QuaternionToRotationMatrix(q[0], q[1], q[2], q[3])
+}
+
+// ahrsRotate returns r·v.
+func ahrsRotate(r [3][3]float64, v [3]float64) (x [3]float64) {
+	for i := 0; i < 3; i++ {
+		x[i] = r[i][0]*v[0] + r[i][1]*v[1] + r[i][2]*v[2]
+	}
+	return
+}
+
+// ahrsRotateT returns rᵀ·v.
+func ahrsRotateT(r [3][3]float64, v [3]float64) (x [3]float64) {
+	for i := 0; i < 3; i++ {
+		x[i] = r[0][i]*v[0] + r[1][i]*v[1] + r[2][i]*v[2]
+	}
+	return
+}
+
+// ahrsQuaternionProduct returns the Hamilton product a⊗b.
+func ahrsQuaternionProduct(a, b [4]float64) [4]float64 {
+	return [4]float64{
+		a[0]*b[0] - a[1]*b[1] - a[2]*b[2] - a[3]*b[3],
+		a[0]*b[1] + a[1]*b[0] + a[2]*b[3] - a[3]*b[2],
+		a[0]*b[2] - a[1]*b[3] + a[2]*b[0] + a[3]*b[1],
+		a[0]*b[3] + a[1]*b[2] - a[2]*b[1] + a[3]*b[0],
+	}
+}
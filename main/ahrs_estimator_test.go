@@ -0,0 +1,109 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	ahrs_estimator_test.go: Unit tests for the attitude estimator selection
+*/
+
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stratux/goflying/ahrs"
+)
+
+type testIMU struct{}
+
+func (testIMU) Read() (T int64, G1, G2, G3, A1, A2, A3, M1, M2, M3 float64, GAError, MagError error) {
+	return
+}
+
+func (testIMU) ReadOne() (T int64, G1, G2, G3, A1, A2, A3, M1, M2, M3 float64, GAError, MagError error) {
+	return
+}
+
+func (testIMU) Close() {}
+
+type testFusionIMU struct {
+	testIMU
+	q   [4]float64
+	err error
+}
+
+func (imu *testFusionIMU) Orientation() ([4]float64, float64, error) {
+	return imu.q, 2, imu.err
+}
+
+func TestAHRSFilterName(t *testing.T) {
+	tests := []struct {
+		setting      string
+		plain, fused string
+	}{
+		{"", ahrsFilterSimple, ahrsFilterFusion},
+		{"simple", ahrsFilterSimple, ahrsFilterSimple},
+		{"ekf", ahrsFilterEKF, ahrsFilterEKF},
+		{"fusion", ahrsFilterSimple, ahrsFilterFusion},
+		{"unknown", ahrsFilterSimple, ahrsFilterFusion},
+	}
+	for _, tt := range tests {
+		if got := ahrsFilterName(tt.setting, testIMU{}); got != tt.plain {
+			t.Errorf("%q without fusion: %s, want %s", tt.setting, got, tt.plain)
+		}
+		if got := ahrsFilterName(tt.setting, &testFusionIMU{}); got != tt.fused {
+			t.Errorf("%q with fusion: %s, want %s", tt.setting, got, tt.fused)
+		}
+	}
+	for _, name := range []string{ahrsFilterSimple, ahrsFilterEKF} {
+		if s := newAHRSEstimator(name, testIMU{}); s.Name() != name {
+			t.Errorf("%s estimator is %s", name, s.Name())
+		}
+	}
+}
+
+func TestFusionEstimator(t *testing.T) {
+	// Level, heading 100° magnetic, the sensor turned 90° to the left in the aircraft.
+	f := axisQuaternion(90, [3]float64{0, 0, 1})
+	q := ahrsQuaternionProduct(axisQuaternion(90-100, [3]float64{0, 0, 1}), f)
+	imu := &testFusionIMU{q: q}
+	s := newAHRSEstimator(ahrsFilterFusion, imu)
+	if s.Name() != ahrsFilterFusion {
+		t.Fatalf("estimator %s", s.Name())
+	}
+	s.SetSensorQuaternion(&f)
+
+	m := ahrs.NewMeasurement()
+	m.SValid = true
+	m.A1, m.A2, m.A3 = 0, 0, 1 // Level in any mounting about the vertical.
+	in := &ahrsInput{Measurement: m, Declination: 8, DeclinationValid: true}
+	s.Compute(in)
+	roll, pitch, heading := s.RollPitchHeading()
+	if !s.Valid() || math.Abs(roll) > 1e-9 || math.Abs(pitch) > 1e-9 || math.Abs(heading/ahrs.Deg-108) > 1e-9 {
+		t.Errorf("attitude %f %f %f", roll/ahrs.Deg, pitch/ahrs.Deg, heading/ahrs.Deg)
+	}
+	if fusion := s.(*fusionEstimator); math.Abs(fusion.magHeading-100) > 1e-9 {
+		t.Errorf("magnetic heading %f", fusion.magHeading)
+	}
+	if math.Abs(s.GLoad()-1) > 1e-9 || math.Abs(s.SlipSkid()) > 1e-9 {
+		t.Errorf("G load %f, slip/skid %f", s.GLoad(), s.SlipSkid())
+	}
+	if h := s.Health(); !h.Healthy || h.HeadingSigma != 2 {
+		t.Errorf("health %+v", h)
+	}
+
+	// Without a declination there is no true heading.
+	in.DeclinationValid = false
+	s.Compute(in)
+	if _, _, heading := s.RollPitchHeading(); !isAHRSInvalidValue(heading) {
+		t.Errorf("heading without declination %f", heading)
+	}
+
+	imu.err = errors.New("no report")
+	s.Compute(in)
+	if s.Valid() || s.Health().Healthy {
+		t.Error("valid without orientation")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	airports.go: Airport/weather station location database. Loaded lazily from the
+	 OurAirports CSV dump installed by 'make optinstall' (airports/fetch_airports.sh).
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stratux/stratux/common"
+)
+
+var airportDbFile = STRATUX_HOME + "/airports/airports.csv"
+
+type Airport struct {
+	Ident       string // ICAO (or local) identifier, e.g. "KOSH".
+	Name        string
+	Type        string // OurAirports type: small_airport, medium_airport, large_airport, heliport, ...
+	Lat         float64
+	Lon         float64
+	ElevationFt float32
+}
+
+var airportDb map[string]Airport
+var airportDbMutex sync.Mutex
+var airportDbLoaded bool
+
+// parseAirportCSV reads an OurAirports style CSV file. Columns are located by their header
+// names, so additional or reordered columns don't matter.
+func parseAirportCSV(r io.Reader) (map[string]Airport, error) {
+	rdr := csv.NewReader(r)
+	rdr.FieldsPerRecord = -1
+	header, err := rdr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.TrimSpace(h)] = i
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	ret := make(map[string]Airport)
+	for {
+		rec, err := rdr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ret, err
+		}
+		var apt Airport
+		apt.Ident = strings.ToUpper(field(rec, "ident"))
+		apt.Name = field(rec, "name")
+		apt.Type = field(rec, "type")
+		if apt.Ident == "" || apt.Type == "closed" {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(field(rec, "latitude_deg"), 64)
+		lon, err2 := strconv.ParseFloat(field(rec, "longitude_deg"), 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		apt.Lat = lat
+		apt.Lon = lon
+		if elev, err := strconv.ParseFloat(field(rec, "elevation_ft"), 32); err == nil {
+			apt.ElevationFt = float32(elev)
+		}
+		ret[apt.Ident] = apt
+		// FIS-B reports use the ICAO code, which is 'gps_code' in OurAirports if it differs from 'ident'.
+		if gps := strings.ToUpper(field(rec, "gps_code")); gps != "" && gps != apt.Ident {
+			if _, exists := ret[gps]; !exists {
+				ret[gps] = apt
+			}
+		}
+	}
+	return ret, nil
+}
+
+func loadAirportDb() {
+	airportDbLoaded = true
+	fd, err := os.Open(airportDbFile)
+	if err != nil {
+		log.Printf("Failed to read airport db %s: %s\n", airportDbFile, err.Error())
+		return
+	}
+	defer fd.Close()
+	db, err := parseAirportCSV(fd)
+	if err != nil {
+		log.Printf("Failed to parse airport db %s: %s\n", airportDbFile, err.Error())
+	}
+	airportDb = db
+	log.Printf("Loaded %d airports from %s\n", len(airportDb), airportDbFile)
+}
+
+// lookupAirport returns the airport for an identifier. FIS-B METARs for US stations sometimes
+// come without the leading 'K', so that is tried as well.
+func lookupAirport(ident string) (Airport, bool) {
+	airportDbMutex.Lock()
+	defer airportDbMutex.Unlock()
+	if !airportDbLoaded {
+		loadAirportDb()
+	}
+	ident = strings.ToUpper(ident)
+	if apt, ok := airportDb[ident]; ok {
+		return apt, true
+	}
+	if len(ident) == 3 {
+		if apt, ok := airportDb["K"+ident]; ok {
+			return apt, true
+		}
+	}
+	return Airport{}, false
+}
+
+// findNearestAirport returns the closest airport within maxDistNm. Heliports and seaplane
+// bases are skipped unless includeAll is set.
+func findNearestAirport(lat, lon float64, maxDistNm float64, includeAll bool) (apt Airport, distNm float64, found bool) {
+	airportDbMutex.Lock()
+	defer airportDbMutex.Unlock()
+	if !airportDbLoaded {
+		loadAirportDb()
+	}
+	// Rough pre-filter in degrees to avoid computing the distance for every airport in the world.
+	latWindow := maxDistNm / 60.0
+	lonWindow := latWindow / math.Max(math.Cos(common.Radians(lat)), 0.01)
+	distNm = math.MaxFloat64
+	for _, a := range airportDb {
+		if !includeAll && !strings.HasSuffix(a.Type, "_airport") {
+			continue
+		}
+		if math.Abs(a.Lat-lat) > latWindow || math.Abs(a.Lon-lon) > lonWindow {
+			continue
+		}
+		d, _, _, _ := common.DistRect(lat, lon, a.Lat, a.Lon)
+		d = d / 1852.0
+		if d <= maxDistNm && d < distNm {
+			apt = a
+			distNm = d
+			found = true
+		}
+	}
+	return
+}
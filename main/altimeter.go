@@ -0,0 +1,151 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	altimeter.go: Altimeter setting (QNH) from the nearest recent METAR in the weather store, or entered in the
+	 settings, and the indicated and density altitude from the pressure sensor. The results are in
+	 mySituation.Baro*. The protocols sent to EFBs (GDL90, Levil AHRS, $PGRMZ, $LXWP0, $POV, $LK8EX1) are defined
+	 with pressure altitude and stay that way, the EFB applies its own altimeter setting.
+*/
+
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	altimeterUpdateInterval = 200 * time.Millisecond
+	altimeterLookupInterval = 30 * time.Second
+	altimeterMaxAge         = 2 * time.Hour // METARs are hourly, allow one to be missed.
+	altimeterMaxDistance    = 100.0         // NM
+	altimeterHPaPerInHg     = 33.8639
+)
+
+const (
+	ALTIMETER_SOURCE_MANUAL = "Manual"
+)
+
+// altimeterSetting is a QNH and where it came from: a METAR station or ALTIMETER_SOURCE_MANUAL.
+type altimeterSetting struct {
+	QNH      float64 // hPa, 0 if none.
+	Source   string
+	Received time.Time
+	Distance float64 // NM to the station.
+}
+
+// metarAltimeter returns the altimeter setting of a METAR in hPa, from the A group in hundredths of inHg or the
+// Q group in hPa. The remarks (SLP etc.) are not looked at.
+func metarAltimeter(data string) (qnh float64, ok bool) {
+	for _, tok := range strings.Fields(data) {
+		if tok == "RMK" {
+			break
+		}
+		if len(tok) != 5 || (tok[0] != 'A' && tok[0] != 'Q') {
+			continue
+		}
+		v, err := strconv.Atoi(tok[1:])
+		if err != nil {
+			continue
+		}
+		qnh = float64(v)
+		if tok[0] == 'A' {
+			qnh = qnh / 100 * altimeterHPaPerInHg
+		}
+		if qnh >= 850 && qnh <= 1090 {
+			return qnh, true
+		}
+	}
+	return 0, false
+}
+
+// nearestMETARAltimeter returns the altimeter setting of the nearest METAR station with a report younger than
+// altimeterMaxAge. Reports only located by the uplink tower are too far off to be used.
+func nearestMETARAltimeter(store *weatherStore, lat, lon float64, now time.Time) (best altimeterSetting, ok bool) {
+	if store == nil {
+		return best, false
+	}
+	reports := store.Query("METAR", weatherQuery{HasNear: true, Lat: lat, Lon: lon, RadiusNm: altimeterMaxDistance})
+	for _, r := range reports {
+		if r.Position_src != "airport" || now.Sub(r.LocaltimeReceived) > altimeterMaxAge {
+			continue
+		}
+		qnh, valid := metarAltimeter(r.Data)
+		if !valid {
+			continue
+		}
+		dist, _ := common.Distance(lat, lon, r.Lat, r.Lon)
+		if math.IsNaN(dist) { // acos() rounding for identical points.
+			dist = 0
+		}
+		dist /= 1852.0
+		if !ok || dist < best.Distance {
+			best = altimeterSetting{QNH: qnh, Source: r.Location, Received: r.LocaltimeReceived, Distance: dist}
+			ok = true
+		}
+	}
+	return best, ok
+}
+
+// altimeterSettingHPa takes an entered altimeter setting in hPa, or in inHg for values below 50.
+func altimeterSettingHPa(v float64) float64 {
+	if v > 0 && v < 50 {
+		return v * altimeterHPaPerInHg
+	}
+	return v
+}
+
+// updateBaroAltitudes sets the altimeter setting and the altitudes derived from it in mySituation. Density
+// altitude needs the temperature of the pressure sensor, which reads a bit warm inside a closed case.
+func updateBaroAltitudes(s altimeterSetting) {
+	mySituation.muBaro.Lock()
+	defer mySituation.muBaro.Unlock()
+	valid := isTempPressValid() && mySituation.BaroSourceType != BARO_TYPE_NONE
+	mySituation.BaroQNH, mySituation.BaroQNHSource = float32(s.QNH), s.Source
+	mySituation.BaroIndicatedAltitude, mySituation.BaroDensityAltitude = 0, 0
+	if valid && s.QNH > 0 {
+		mySituation.BaroIndicatedAltitude = float32(common.CalcIndicatedAltitude(float64(mySituation.BaroPressureAltitude), s.QNH))
+	}
+	if valid && mySituation.BaroSourceType == BARO_TYPE_BMP280 {
+		mySituation.BaroDensityAltitude = float32(common.CalcDensityAltitude(float64(mySituation.BaroPressureAltitude),
+			float64(mySituation.BaroTemperature)))
+	}
+}
+
+func altimeterLoop() {
+	ticker := time.NewTicker(altimeterUpdateInterval)
+	var metar altimeterSetting
+	var lastLookup time.Time
+	for range ticker.C {
+		now := stratuxClock.Time
+		if now.Sub(lastLookup) >= altimeterLookupInterval {
+			lastLookup = now
+			mySituation.muGPS.Lock()
+			valid := isGPSValid()
+			lat, lon := float64(mySituation.GPSLatitude), float64(mySituation.GPSLongitude)
+			mySituation.muGPS.Unlock()
+			if valid {
+				metar, _ = nearestMETARAltimeter(weatherReports, lat, lon, now)
+			} else if now.Sub(metar.Received) > altimeterMaxAge {
+				// Keep the last one through a GPS outage.
+				metar = altimeterSetting{}
+			}
+		}
+		setting := metar
+		if globalSettings.AltimeterSetting > 0 {
+			setting = altimeterSetting{QNH: globalSettings.AltimeterSetting, Source: ALTIMETER_SOURCE_MANUAL}
+		}
+		updateBaroAltitudes(setting)
+	}
+}
+
+func initAltimeter() {
+	go altimeterLoop()
+}
@@ -0,0 +1,114 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	altimeter_test.go: Unit tests for the altimeter setting from METARs and the derived altitudes.
+*/
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMetarAltimeter(t *testing.T) {
+	tests := []struct {
+		data string
+		want float64
+		ok   bool
+	}{
+		{"AUTO 27010KT 10SM CLR 22/10 A2992 RMK AO2 SLP132", 29.92 * altimeterHPaPerInHg, true},
+		{"24008KT 9999 FEW030 18/09 Q1021 NOSIG", 1021, true},
+		{"AUTO 27015G25KT 3SM BR", 0, false},
+		{"AUTO 27010KT 10SM CLR RMK A3001", 0, false}, // Only in the remarks.
+		{"AUTO 27010KT 10SM CLR A0000", 0, false},
+		{"AUTO 27010KT 10SM CLR AXXXX Q0999", 999, true},
+	}
+	for _, tt := range tests {
+		got, ok := metarAltimeter(tt.data)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("metarAltimeter(%q) = %f, %t, want %f, %t", tt.data, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNearestMETARAltimeter(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, ok := nearestMETARAltimeter(nil, 43.9, -88.5, now); ok {
+		t.Error("setting without a weather store")
+	}
+	store.Add(makeTestReport("METAR", "KOSH", "011153Z", "27010KT 10SM CLR 22/10 A3002", now.Add(-30*time.Minute)))
+	store.Add(makeTestReport("METAR", "KMSN", "011153Z", "27010KT 10SM CLR 22/10 A2998", now.Add(-10*time.Minute)))
+	store.Add(makeTestReport("METAR", "KDEN", "011153Z", "27010KT 10SM CLR 22/10 A2980", now))
+	// Unknown station, only located by the tower that sent it.
+	r := makeTestReport("METAR", "K9XY", "011153Z", "27010KT 10SM CLR 22/10 A2950", now)
+	r.locate(43.9, -88.5, true)
+	store.Add(r)
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		now      time.Time
+		source   string
+		qnh      float64
+	}{
+		{"Near KOSH", 43.9, -88.5, now, "KOSH", 30.02 * altimeterHPaPerInHg},
+		{"Near KMSN", 43.2, -89.3, now, "KMSN", 29.98 * altimeterHPaPerInHg},
+		{"KOSH too old", 43.9, -88.5, now.Add(100 * time.Minute), "KMSN", 29.98 * altimeterHPaPerInHg},
+		{"Nothing in range", 41.0, -95.0, now, "", 0},
+	}
+	for _, tt := range tests {
+		s, ok := nearestMETARAltimeter(store, tt.lat, tt.lon, tt.now)
+		if ok != (tt.source != "") || s.Source != tt.source || math.Abs(s.QNH-tt.qnh) > 1e-9 {
+			t.Errorf("%s: %+v, %t", tt.name, s, ok)
+		}
+	}
+}
+
+func TestAltimeterSettingHPa(t *testing.T) {
+	for _, tt := range []struct{ in, want float64 }{{0, 0}, {1013.2, 1013.2}, {29.92, 1013.21}, {30.12, 1019.98}} {
+		if got := altimeterSettingHPa(tt.in); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("altimeterSettingHPa(%.2f) = %.2f, want %.2f", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateBaroAltitudes(t *testing.T) {
+	resetGPSState()
+	mySituation.muBaro.Lock()
+	mySituation.BaroLastMeasurementTime = stratuxClock.Time
+	mySituation.BaroSourceType = BARO_TYPE_BMP280
+	mySituation.BaroPressureAltitude = 5000
+	mySituation.BaroTemperature = 25.1 // ISA+20
+	mySituation.muBaro.Unlock()
+
+	updateBaroAltitudes(altimeterSetting{QNH: 1023.25, Source: "KOSH"})
+	if mySituation.BaroQNH != 1023.25 || mySituation.BaroQNHSource != "KOSH" ||
+		math.Abs(float64(mySituation.BaroIndicatedAltitude)-5262) > 5 || math.Abs(float64(mySituation.BaroDensityAltitude)-7400) > 150 {
+		t.Errorf("QNH %.2f from %s: indicated %.0f, density %.0f ft", mySituation.BaroQNH, mySituation.BaroQNHSource,
+			mySituation.BaroIndicatedAltitude, mySituation.BaroDensityAltitude)
+	}
+
+	// No temperature from an OGN tracker, no QNH.
+	mySituation.BaroSourceType = BARO_TYPE_OGNTRACKER
+	updateBaroAltitudes(altimeterSetting{})
+	if mySituation.BaroQNH != 0 || mySituation.BaroIndicatedAltitude != 0 || mySituation.BaroDensityAltitude != 0 {
+		t.Errorf("without QNH and temperature: QNH %.2f, indicated %.0f, density %.0f ft", mySituation.BaroQNH,
+			mySituation.BaroIndicatedAltitude, mySituation.BaroDensityAltitude)
+	}
+
+	// Pressure too old.
+	mySituation.BaroSourceType = BARO_TYPE_BMP280
+	mySituation.BaroLastMeasurementTime = stratuxClock.Time.Add(-time.Minute)
+	updateBaroAltitudes(altimeterSetting{QNH: 1023.25, Source: ALTIMETER_SOURCE_MANUAL})
+	if mySituation.BaroQNH != 1023.25 || mySituation.BaroIndicatedAltitude != 0 || mySituation.BaroDensityAltitude != 0 {
+		t.Errorf("with an old pressure: indicated %.0f, density %.0f ft", mySituation.BaroIndicatedAltitude, mySituation.BaroDensityAltitude)
+	}
+	mySituation.BaroLastMeasurementTime = time.Time{}
+}
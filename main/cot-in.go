@@ -19,6 +19,8 @@ import (
 	"net"
 	"strings"
 	"time"
+
+	"github.com/stratux/stratux/common"
 )
 
 type CotEvent struct {
@@ -117,13 +119,14 @@ func processCotMessage(msg string) {
 	ti.Track = event.Detail.Track.Course
 
 	// convert altitudes..
-	alt := event.Point.Hae * 3.28084 // to feet
+	hae := event.Point.Hae * 3.28084 // to feet
 	if isGPSValid() && isTempPressValid() {
+		alt := hae - float32(common.GeoidHeightFt(float64(event.Point.Lat), float64(event.Point.Lon)))
 		ti.Alt = int32(alt - mySituation.GPSAltitudeMSL + mySituation.BaroPressureAltitude)
 		ti.AltIsGNSS = false
 	} else {
 		// Fall back to GNSS alt
-		ti.Alt = int32(alt)
+		ti.Alt = int32(hae)
 		ti.AltIsGNSS = true
 	}
 
@@ -0,0 +1,353 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	crash.go: Crash detection. An impact is a high acceleration peak from the IMU shortly after moving at flying
+	 speed. If the aircraft then comes to rest (GPS speed collapsed, acceleration steady), a countdown starts on
+	 the status page and as $PFLAE message on NMEA connections. Unless it is canceled, the ownship GDL90 report
+	 then carries the emergency code and the last known position is logged and saved.
+	 This only reaches the EFBs connected to Stratux, nothing is broadcast. The ownship report isn't transmitted.
+	 Setting the emergency flag on an attached tracker is still open: the OGN packet has an emergency bit, but
+	 neither $POGNS, $PGXCF nor $PSRFS can set it yet. That needs a configuration key from the tracker firmware
+	 projects, after which it belongs in the Tracker interface and is called where the emergency is set below.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	crashFile           = "crash.json"
+	crashSampleInterval = 100 * time.Millisecond
+	crashImpactG        = 3.5  // G, acceleration magnitude. IMUs are mostly set up for ±4 G.
+	crashArmSpeed       = 30.0 // kts, flying this fast within crashArmTime before the impact
+	crashArmTime        = 10 * time.Second
+	crashStopSpeed      = 5.0  // kts, slower is at rest
+	crashMoveSpeed      = 15.0 // kts, moving this fast again during the countdown cancels it
+	crashStillG         = 0.15 // G, acceleration change while at rest
+	crashAccelTau       = 1.0  // s, averaging of the acceleration for crashStillG
+	crashStillTime      = 10 * time.Second
+	crashSettleTime     = 60 * time.Second // Not at rest this long after the impact: no crash.
+	crashCountdown      = 60 * time.Second
+	crashNMEAInterval   = 1 * time.Second
+)
+
+// Crash detector states, as in globalStatus.CrashState.
+const (
+	CRASH_STATE_NONE      = ""
+	CRASH_STATE_IMPACT    = "Impact" // Waiting for the aircraft to come to rest.
+	CRASH_STATE_COUNTDOWN = "Countdown"
+	CRASH_STATE_EMERGENCY = "Emergency" // Emergency code in the ownship report.
+)
+
+// CrashEvent is a detected crash with the last known position, saved to crashFile when the emergency is set.
+type CrashEvent struct {
+	ImpactTime    time.Time
+	ImpactG       float64
+	EmergencyTime time.Time
+	PositionValid bool
+	PositionTime  time.Time
+	Lat           float64
+	Lon           float64
+	Altitude      float64 // ft MSL
+}
+
+// crashSample is what the detector looks at every crashSampleInterval.
+type crashSample struct {
+	time          time.Time
+	accel         float64 // G, largest acceleration magnitude since the last sample.
+	accelValid    bool
+	speed         float64 // kts
+	speedValid    bool
+	positionValid bool
+	lat, lon      float64
+	altitude      float64
+}
+
+type crashDetector struct {
+	mu           sync.Mutex
+	state        string
+	lastFast     time.Time
+	accelMean    float64
+	accelTime    time.Time
+	stillSince   time.Time
+	countdownEnd time.Time
+	event        CrashEvent
+	fileName     string
+}
+
+var crashes = newCrashDetector("")
+
+func newCrashDetector(fileName string) *crashDetector {
+	return &crashDetector{fileName: fileName}
+}
+
+// moving tells if the aircraft moves: too fast, or the acceleration isn't steady.
+func (d *crashDetector) moving(s crashSample) bool {
+	return (s.speedValid && s.speed > crashStopSpeed) || (s.accelValid && math.Abs(s.accel-d.accelMean) > crashStillG)
+}
+
+// update runs the detector on a sample. It returns true when the countdown ran out and the emergency is set.
+func (d *crashDetector) update(s crashSample) (emergency bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s.speedValid && s.speed >= crashArmSpeed {
+		d.lastFast = s.time
+	}
+	if s.positionValid && d.state != CRASH_STATE_EMERGENCY {
+		d.event.PositionValid, d.event.PositionTime = true, s.time
+		d.event.Lat, d.event.Lon, d.event.Altitude = s.lat, s.lon, s.altitude
+	}
+
+	switch d.state {
+	case CRASH_STATE_NONE:
+		if s.accelValid && s.accel >= crashImpactG && !d.lastFast.IsZero() && s.time.Sub(d.lastFast) <= crashArmTime {
+			d.state = CRASH_STATE_IMPACT
+			d.event.ImpactTime, d.event.ImpactG = s.time, s.accel
+			d.stillSince = time.Time{}
+			log.Printf("Crash detection: impact of %.1f G\n", s.accel)
+		}
+	case CRASH_STATE_IMPACT:
+		if s.accelValid && s.accel > d.event.ImpactG {
+			d.event.ImpactG = s.accel
+		}
+		if d.moving(s) {
+			d.stillSince = time.Time{}
+		} else if d.stillSince.IsZero() {
+			d.stillSince = s.time
+		}
+		if !d.stillSince.IsZero() && s.time.Sub(d.stillSince) >= crashStillTime {
+			d.state = CRASH_STATE_COUNTDOWN
+			d.countdownEnd = s.time.Add(crashCountdown)
+			log.Printf("Crash detection: at rest after the impact, emergency in %s unless canceled\n", crashCountdown)
+		} else if s.time.Sub(d.event.ImpactTime) > crashSettleTime {
+			// A hard landing or turbulence.
+			d.state = CRASH_STATE_NONE
+			log.Printf("Crash detection: still moving after the impact, no crash\n")
+		}
+	case CRASH_STATE_COUNTDOWN:
+		if s.speedValid && s.speed > crashMoveSpeed {
+			d.state = CRASH_STATE_NONE
+			log.Printf("Crash detection: moving again, countdown canceled\n")
+		} else if !s.time.Before(d.countdownEnd) {
+			d.state = CRASH_STATE_EMERGENCY
+			d.event.EmergencyTime = s.time
+			emergency = true
+		}
+	}
+
+	// After the impact check, so that the impact itself doesn't count as steady.
+	if s.accelValid {
+		if d.accelTime.IsZero() {
+			d.accelMean = s.accel
+		} else {
+			dt := s.time.Sub(d.accelTime).Seconds()
+			d.accelMean += dt / (crashAccelTau + dt) * (s.accel - d.accelMean)
+		}
+		d.accelTime = s.time
+	}
+	return emergency
+}
+
+// Cancel ends a countdown or emergency. It returns the state it was in.
+func (d *crashDetector) Cancel() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := d.state
+	d.state = CRASH_STATE_NONE
+	if state != CRASH_STATE_NONE {
+		log.Printf("Crash detection: %s canceled\n", state)
+	}
+	return state
+}
+
+// State returns the state and the time left in a countdown.
+func (d *crashDetector) State(now time.Time) (state string, countdown time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state == CRASH_STATE_COUNTDOWN {
+		countdown = d.countdownEnd.Sub(now)
+	}
+	return d.state, countdown
+}
+
+// Emergency tells if the emergency code is set.
+func (d *crashDetector) Emergency() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state == CRASH_STATE_EMERGENCY
+}
+
+// Event returns the last impact with the last known position.
+func (d *crashDetector) Event() CrashEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.event
+}
+
+// Save writes the crash event to disk.
+func (d *crashDetector) Save() error {
+	if len(d.fileName) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(d.Event())
+	if err != nil {
+		return err
+	}
+	tmpFile := d.fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, d.fileName)
+}
+
+// crashAccel keeps the largest acceleration between two samples, the IMU is read faster than that.
+var crashAccel struct {
+	mu   sync.Mutex
+	peak float64
+	time time.Time
+}
+
+// registerCrashAccel is called for every IMU reading with the acceleration in G.
+func registerCrashAccel(t time.Time, a1, a2, a3 float64) {
+	a := math.Sqrt(a1*a1 + a2*a2 + a3*a3)
+	crashAccel.mu.Lock()
+	if a > crashAccel.peak {
+		crashAccel.peak = a
+	}
+	crashAccel.time = t
+	crashAccel.mu.Unlock()
+}
+
+func sampleCrash() (s crashSample) {
+	s.time = stratuxClock.Time
+	crashAccel.mu.Lock()
+	if s.time.Sub(crashAccel.time) < time.Second {
+		s.accel, s.accelValid = crashAccel.peak, true
+	}
+	crashAccel.peak = 0
+	crashAccel.mu.Unlock()
+
+	mySituation.muGPS.Lock()
+	if isGPSValid() {
+		s.positionValid = true
+		s.lat, s.lon = float64(mySituation.GPSLatitude), float64(mySituation.GPSLongitude)
+		s.altitude = float64(mySituation.GPSAltitudeMSL)
+	}
+	if isGPSGroundTrackValid() {
+		s.speed, s.speedValid = mySituation.GPSGroundSpeed, true
+	}
+	mySituation.muGPS.Unlock()
+	return s
+}
+
+// makeCrashPFLAEString makes the FLARM error sentence that EFBs and glider computers show for the countdown and
+// the emergency. Error code F1 is "other". The text says that nothing is broadcast, so nobody waits for help.
+func makeCrashPFLAEString(state string, countdown time.Duration) string {
+	var msg string
+	switch state {
+	case CRASH_STATE_COUNTDOWN:
+		msg = fmt.Sprintf("$PFLAE,A,3,F1,CRASH DETECTED - EMERGENCY IN %dS - NOT BROADCAST - CANCEL ON STRATUX", int(math.Ceil(countdown.Seconds())))
+	case CRASH_STATE_EMERGENCY:
+		msg = "$PFLAE,A,3,F1,CRASH DETECTED - EMERGENCY SET - NOT BROADCAST - CANCEL ON STRATUX"
+	default:
+		msg = "$PFLAE,A,0,0"
+	}
+	return appendNmeaChecksum(msg) + "\r\n"
+}
+
+// cancelCrash ends a countdown or emergency from the web interface.
+func cancelCrash() {
+	crashes.Cancel()
+	updateCrashStatus(stratuxClock.Time)
+}
+
+// updateCrashStatus shows the countdown or emergency in the status and on NMEA connections.
+func updateCrashStatus(now time.Time) {
+	state, countdown := crashes.State(now)
+	wasActive := globalStatus.CrashState != CRASH_STATE_NONE && globalStatus.CrashState != CRASH_STATE_IMPACT
+	globalStatus.CrashState = state
+	globalStatus.CrashCountdown = int(math.Ceil(countdown.Seconds()))
+	switch state {
+	case CRASH_STATE_COUNTDOWN:
+		updateSingleSystemErrorf("crash", "Crash detected! Emergency code to EFBs in %d s unless canceled, nothing is broadcast.", globalStatus.CrashCountdown)
+	case CRASH_STATE_EMERGENCY:
+		e := crashes.Event()
+		updateSingleSystemErrorf("crash", "Crash detected! Emergency code to EFBs since %s, nothing is broadcast.", e.EmergencyTime.Format("15:04:05"))
+	default:
+		removeSingleSystemError("crash")
+		if wasActive {
+			sendNetFLARM(makeCrashPFLAEString(state, 0), crashNMEAInterval, 0)
+		}
+		return
+	}
+	sendNetFLARM(makeCrashPFLAEString(state, countdown), crashNMEAInterval, 0)
+}
+
+func crashDetectorLoop() {
+	ticker := time.NewTicker(crashSampleInterval)
+	var lastStatus time.Time
+	for range ticker.C {
+		if !globalSettings.CrashDetection {
+			if globalStatus.CrashState != CRASH_STATE_NONE {
+				cancelCrash()
+			}
+			continue
+		}
+		if crashes.update(sampleCrash()) {
+			e := crashes.Event()
+			log.Printf("Crash detection: emergency, impact %.1f G at %s, last known position %.5f %.5f %.0f ft MSL at %s (valid: %t)\n",
+				e.ImpactG, e.ImpactTime.Format(time.RFC3339), e.Lat, e.Lon, e.Altitude, e.PositionTime.Format(time.RFC3339), e.PositionValid)
+			if err := crashes.Save(); err != nil {
+				log.Printf("Crash detection: failed to save %s: %s\n", crashes.fileName, err.Error())
+			}
+			// TODO: set the tracker's emergency flag once its firmware has a configuration key for it (see header).
+		}
+		if now := stratuxClock.Time; now.Sub(lastStatus) >= crashNMEAInterval {
+			lastStatus = now
+			updateCrashStatus(now)
+		}
+	}
+}
+
+func initCrashDetector(fileName string) {
+	crashes = newCrashDetector(fileName)
+	go crashDetectorLoop()
+}
+
+// AJAX call - /api/crash. Responds with the crash detector state and the last impact. POST /api/crash/cancel
+// cancels a countdown or emergency.
+func handleCrashRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	if r.URL.Path == "/api/crash/cancel" {
+		if r.Method != "POST" {
+			http.Error(w, "use POST to cancel", http.StatusMethodNotAllowed)
+			return
+		}
+		cancelCrash()
+	}
+	state, countdown := crashes.State(stratuxClock.Time)
+	ret := struct {
+		State     string
+		Countdown int
+		Event     CrashEvent
+	}{state, int(math.Ceil(countdown.Seconds())), crashes.Event()}
+	retJSON, err := json.Marshal(&ret)
+	if err != nil {
+		log.Printf("Error sending crash JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", retJSON)
+}
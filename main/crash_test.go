@@ -0,0 +1,167 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	crash_test.go: Unit tests for the crash detector.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// crashPhase is a stretch of samples at crashSampleInterval with the same speed and acceleration.
+type crashPhase struct {
+	secs  float64
+	speed float64
+	accel float64
+}
+
+// runCrashPhases feeds the phases to d and returns the state at the end and when the emergency was set.
+func runCrashPhases(d *crashDetector, start time.Time, phases []crashPhase) (state string, emergencyAt time.Duration) {
+	now := start
+	for _, p := range phases {
+		for i := 0; i < int(p.secs*10); i++ {
+			s := crashSample{time: now, accel: p.accel, accelValid: true, speed: p.speed, speedValid: true,
+				positionValid: p.speed > 0, lat: 47.5, lon: 8.5, altitude: 1500}
+			if d.update(s) {
+				emergencyAt = now.Sub(start)
+			}
+			now = now.Add(crashSampleInterval)
+		}
+	}
+	state, _ = d.State(now)
+	return state, emergencyAt
+}
+
+func TestCrashDetector(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cruise := crashPhase{30, 90, 1}
+	// Crash: impact at 30 s, sliding to 32 s, steady from 33.4 s, countdown from 43.4 s.
+	tests := []struct {
+		name        string
+		phases      []crashPhase
+		state       string
+		emergencyAt time.Duration
+	}{
+		{"Crash", []crashPhase{cruise, {0.1, 60, 6}, {2, 10, 1.5}, {80, 0, 1}}, CRASH_STATE_EMERGENCY, 103400 * time.Millisecond},
+		{"Countdown", []crashPhase{cruise, {0.1, 60, 6}, {2, 10, 1.5}, {40, 0, 1}}, CRASH_STATE_COUNTDOWN, 0},
+		{"Hard landing, taxiing", []crashPhase{cruise, {0.1, 60, 4}, {70, 12, 1}}, CRASH_STATE_NONE, 0},
+		{"Moving again in the countdown", []crashPhase{cruise, {0.1, 60, 6}, {20, 0, 1}, {10, 20, 1}}, CRASH_STATE_NONE, 0},
+		{"Dropped on the ground", []crashPhase{{30, 0, 1}, {0.1, 0, 8}, {80, 0, 1}}, CRASH_STATE_NONE, 0},
+		{"Too long after flying", []crashPhase{cruise, {20, 0, 1}, {0.1, 0, 8}, {80, 0, 1}}, CRASH_STATE_NONE, 0},
+		{"Turbulence", []crashPhase{cruise, {0.1, 90, 3}, {80, 90, 1}}, CRASH_STATE_NONE, 0},
+	}
+	for _, tt := range tests {
+		d := newCrashDetector("")
+		state, emergencyAt := runCrashPhases(d, start, tt.phases)
+		if state != tt.state || emergencyAt != tt.emergencyAt {
+			t.Errorf("%s: state %q, emergency at %s, want %q, %s", tt.name, state, emergencyAt, tt.state, tt.emergencyAt)
+		}
+	}
+}
+
+func TestCrashDetectorEvent(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fileName := filepath.Join(t.TempDir(), crashFile)
+	d := newCrashDetector(fileName)
+	runCrashPhases(d, start, []crashPhase{{30, 90, 1}, {0.1, 60, 5}, {0.1, 40, 7}, {80, 0, 1}})
+	if !d.Emergency() {
+		t.Fatal("no emergency")
+	}
+	e := d.Event()
+	// The last position is from the last sample with a speed, the GPS doesn't stop there.
+	if e.ImpactG != 7 || !e.ImpactTime.Equal(start.Add(30*time.Second)) || !e.PositionValid ||
+		!e.PositionTime.Equal(start.Add(30*time.Second+100*time.Millisecond)) || e.Lat != 47.5 || e.Altitude != 1500 {
+		t.Errorf("event %+v", e)
+	}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(fileName)
+	var saved CrashEvent
+	if err != nil || json.Unmarshal(buf, &saved) != nil || !saved.EmergencyTime.Equal(e.EmergencyTime) {
+		t.Errorf("saved %s, %v", buf, err)
+	}
+
+	if state := d.Cancel(); state != CRASH_STATE_EMERGENCY || d.Emergency() {
+		t.Errorf("cancel in state %q, emergency %t", state, d.Emergency())
+	}
+	if state := d.Cancel(); state != CRASH_STATE_NONE {
+		t.Errorf("second cancel in state %q", state)
+	}
+}
+
+func TestMakeCrashPFLAEString(t *testing.T) {
+	tests := []struct {
+		state     string
+		countdown time.Duration
+		want      string
+	}{
+		{CRASH_STATE_COUNTDOWN, 41500 * time.Millisecond, "$PFLAE,A,3,F1,CRASH DETECTED - EMERGENCY IN 42S - NOT BROADCAST - CANCEL ON STRATUX*60\r\n"},
+		{CRASH_STATE_EMERGENCY, 0, "$PFLAE,A,3,F1,CRASH DETECTED - EMERGENCY SET - NOT BROADCAST - CANCEL ON STRATUX*50\r\n"},
+		{CRASH_STATE_NONE, 0, "$PFLAE,A,0,0*33\r\n"},
+	}
+	for _, tt := range tests {
+		if got := makeCrashPFLAEString(tt.state, tt.countdown); got != tt.want {
+			t.Errorf("makeCrashPFLAEString(%q, %s) = %q, want %q", tt.state, tt.countdown, got, tt.want)
+		}
+	}
+}
+
+func TestHandleCrashRequest(t *testing.T) {
+	resetGPSState()
+	if systemErrsMutex == nil {
+		systemErrsMutex = &sync.Mutex{}
+	}
+	if systemErrs == nil {
+		systemErrs = make(map[string]string)
+	}
+	if netMutex == nil {
+		netMutex = &sync.Mutex{}
+	}
+	orig, origStatus := crashes, globalStatus
+	defer func() { crashes, globalStatus = orig, origStatus }()
+
+	crashes = newCrashDetector("")
+	now := stratuxClock.Time
+	crashes.state = CRASH_STATE_COUNTDOWN
+	crashes.countdownEnd = now.Add(30 * time.Second)
+	updateCrashStatus(now)
+	if globalStatus.CrashState != CRASH_STATE_COUNTDOWN || globalStatus.CrashCountdown != 30 || len(systemErrs["crash"]) == 0 {
+		t.Errorf("status %q, %d s, error %q", globalStatus.CrashState, globalStatus.CrashCountdown, systemErrs["crash"])
+	}
+
+	var ret struct {
+		State     string
+		Countdown int
+	}
+	w := httptest.NewRecorder()
+	handleCrashRequest(w, httptest.NewRequest("GET", "/api/crash", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil || ret.State != CRASH_STATE_COUNTDOWN || ret.Countdown < 29 || ret.Countdown > 30 {
+		t.Errorf("crash = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handleCrashRequest(w, httptest.NewRequest("GET", "/api/crash/cancel", nil))
+	if w.Code != 405 || crashes.state != CRASH_STATE_COUNTDOWN {
+		t.Errorf("GET cancel: %d, state %q", w.Code, crashes.state)
+	}
+
+	w = httptest.NewRecorder()
+	handleCrashRequest(w, httptest.NewRequest("POST", "/api/crash/cancel", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil || ret.State != CRASH_STATE_NONE || ret.Countdown != 0 {
+		t.Errorf("crash after cancel = %s", w.Body.String())
+	}
+	if globalStatus.CrashState != CRASH_STATE_NONE || len(systemErrs["crash"]) != 0 {
+		t.Errorf("status after cancel %q, error %q", globalStatus.CrashState, systemErrs["crash"])
+	}
+}
@@ -477,6 +477,7 @@ func dataLog() {
 		makeTable(Dump1090TermMessage{}, "dump1090_terminal", db)
 		makeTable(gpsPerfStats{}, "gps_attitude", db)
 		makeTable(StratuxStartup{}, "startup", db)
+		makeTable(Exceedance{}, "exceedances", db)
 	}
 
 	// The first entry to be created is the "startup" entry.
@@ -555,6 +556,12 @@ func logTraffic(ti TrafficInfo) {
 	}
 }
 
+func logExceedance(e Exceedance) {
+	if globalSettings.ReplayLog && isDataLogReady() {
+		dataLogChan <- DataLogRow{tbl: "exceedances", data: e}
+	}
+}
+
 func logMsg(m msg) {
 	if globalSettings.ReplayLog && isDataLogReady() {
 		dataLogChan <- DataLogRow{tbl: "messages", data: m}
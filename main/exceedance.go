@@ -0,0 +1,449 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	exceedance.go: Flight exceedance monitoring. G load is checked against the GLimits setting, bank, pitch,
+	 vertical speed, altitude and speed against ExceedanceLimits. Every exceedance is recorded with its start,
+	 end, peak and the position at the peak, kept in exceedances.json and the replay log, served at
+	 /api/exceedances and shown to connected clients as a system alert while it lasts and shortly after.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	exceedanceFile           = "exceedances.json"
+	exceedancesMax           = 1000
+	exceedanceSampleInterval = 100 * time.Millisecond
+	exceedanceEndTime        = 1 * time.Second  // Back within the limit this long ends an exceedance.
+	exceedanceAlertHold      = 30 * time.Second // The alert stays up this long after the exceedance ended.
+	exceedanceAttitudeMaxAge = 1 * time.Second
+
+	// G limits of the normal category, also the G meter's default.
+	exceedanceDefaultGMin = -1.76
+	exceedanceDefaultGMax = 4.4
+)
+
+// Parameters the monitor checks.
+const (
+	EXCEEDANCE_G_POSITIVE = "GLoadPositive"
+	EXCEEDANCE_G_NEGATIVE = "GLoadNegative"
+	EXCEEDANCE_BANK       = "Bank"
+	EXCEEDANCE_PITCH_UP   = "PitchUp"
+	EXCEEDANCE_PITCH_DOWN = "PitchDown"
+	EXCEEDANCE_CLIMB      = "Climb"
+	EXCEEDANCE_DESCENT    = "Descent"
+	EXCEEDANCE_ALTITUDE   = "Altitude"
+	EXCEEDANCE_SPEED      = "Speed"
+)
+
+// ExceedanceLimits holds the limits besides the G limits. Zero disables a limit.
+type ExceedanceLimits struct {
+	Bank        float64 // degrees, either side
+	PitchUp     float64 // degrees
+	PitchDown   float64 // degrees
+	Climb       float64 // ft/min
+	Descent     float64 // ft/min
+	Altitude    float64 // ft, indicated altitude with a QNH, else pressure altitude, GPS altitude without baro
+	GroundSpeed float64 // kts, there is no airspeed
+}
+
+// Bank and pitch beyond which 14 CFR 91.307 considers a maneuver aerobatic.
+var defaultExceedanceLimits = ExceedanceLimits{Bank: 60, PitchUp: 30, PitchDown: 30}
+
+type Exceedance struct {
+	ID            int
+	Parameter     string // EXCEEDANCE_*
+	Limit         float64
+	Unit          string
+	Start         time.Time
+	End           time.Time // Zero while in progress.
+	InProgress    bool
+	Peak          float64
+	PeakTime      time.Time
+	PositionValid bool // Position at the peak.
+	Lat           float64
+	Lon           float64
+	Altitude      float64 // ft MSL
+	FlightID      string  // Flight in progress, see flights.go.
+}
+
+// exceedanceCheck is one limit on one parameter.
+type exceedanceCheck struct {
+	parameter  string
+	unit       string
+	format     string
+	limit      float64
+	above      bool    // Exceeded above the limit, otherwise below.
+	hysteresis float64 // How far back within the limit the value has to be to end the exceedance.
+}
+
+func (c exceedanceCheck) exceeded(v float64) bool {
+	if c.above {
+		return v > c.limit
+	}
+	return v < c.limit
+}
+
+func (c exceedanceCheck) within(v float64) bool {
+	if c.above {
+		return v <= c.limit-c.hysteresis
+	}
+	return v >= c.limit+c.hysteresis
+}
+
+// beyond returns whether v is further from the limit than peak.
+func (c exceedanceCheck) beyond(v, peak float64) bool {
+	if c.above {
+		return v > peak
+	}
+	return v < peak
+}
+
+func (c exceedanceCheck) describe(e *Exceedance) string {
+	return fmt.Sprintf("%s %s (limit "+c.format+")", exceedanceNames[c.parameter], fmt.Sprintf(c.format, e.Peak), c.limit)
+}
+
+var exceedanceNames = map[string]string{
+	EXCEEDANCE_G_POSITIVE: "G load",
+	EXCEEDANCE_G_NEGATIVE: "Negative G load",
+	EXCEEDANCE_BANK:       "Bank",
+	EXCEEDANCE_PITCH_UP:   "Pitch up",
+	EXCEEDANCE_PITCH_DOWN: "Pitch down",
+	EXCEEDANCE_CLIMB:      "Climb",
+	EXCEEDANCE_DESCENT:    "Descent",
+	EXCEEDANCE_ALTITUDE:   "Altitude",
+	EXCEEDANCE_SPEED:      "Ground speed",
+}
+
+// parseGLimits reads the GLimits setting, "<negative> <positive>" as the G meter takes it.
+func parseGLimits(s string) (min, max float64) {
+	if _, err := fmt.Sscan(s, &min, &max); err != nil || min >= 1 || max <= 1 {
+		return exceedanceDefaultGMin, exceedanceDefaultGMax
+	}
+	return min, max
+}
+
+// exceedanceChecks returns the enabled checks for the settings.
+func exceedanceChecks(gLimits string, l ExceedanceLimits) []exceedanceCheck {
+	gMin, gMax := parseGLimits(gLimits)
+	checks := []exceedanceCheck{
+		{EXCEEDANCE_G_POSITIVE, "G", "%.2f G", gMax, true, 0.1},
+		{EXCEEDANCE_G_NEGATIVE, "G", "%.2f G", gMin, false, 0.1},
+	}
+	for _, c := range []exceedanceCheck{
+		{EXCEEDANCE_BANK, "deg", "%.0f°", l.Bank, true, 2},
+		{EXCEEDANCE_PITCH_UP, "deg", "%.0f°", l.PitchUp, true, 2},
+		{EXCEEDANCE_PITCH_DOWN, "deg", "%.0f°", l.PitchDown, true, 2},
+		{EXCEEDANCE_CLIMB, "ft/min", "%.0f ft/min", l.Climb, true, 100},
+		{EXCEEDANCE_DESCENT, "ft/min", "%.0f ft/min", l.Descent, true, 100},
+		{EXCEEDANCE_ALTITUDE, "ft", "%.0f ft", l.Altitude, true, 50},
+		{EXCEEDANCE_SPEED, "kts", "%.0f kts", l.GroundSpeed, true, 2},
+	} {
+		if c.limit > 0 {
+			checks = append(checks, c)
+		}
+	}
+	return checks
+}
+
+// exceedanceSample is the situation the monitor looks at, values by parameter. Parameters without a valid
+// value are left out.
+type exceedanceSample struct {
+	time          time.Time
+	values        map[string]float64
+	positionValid bool
+	lat, lon      float64
+	altitude      float64 // ft MSL
+	flightID      string
+}
+
+type activeExceedance struct {
+	Exceedance
+	check       exceedanceCheck
+	withinSince time.Time
+}
+
+type exceedanceAlert struct {
+	text  string
+	until time.Time
+}
+
+type exceedanceMonitor struct {
+	mu       sync.Mutex
+	fileName string
+	history  []Exceedance // Finished, oldest first.
+	active   map[string]*activeExceedance
+	alerts   map[string]exceedanceAlert // Alerts of finished exceedances, by parameter.
+	lastID   int
+	dirty    bool
+}
+
+var exceedances *exceedanceMonitor
+
+func newExceedanceMonitor(fileName string) *exceedanceMonitor {
+	return &exceedanceMonitor{
+		fileName: fileName,
+		active:   make(map[string]*activeExceedance),
+		alerts:   make(map[string]exceedanceAlert),
+	}
+}
+
+// update checks the sample against the limits. It returns the exceedances that ended.
+func (m *exceedanceMonitor) update(s exceedanceSample, checks []exceedanceCheck) (finished []Exceedance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checked := make(map[string]bool)
+	for _, c := range checks {
+		checked[c.parameter] = true
+		v, ok := s.values[c.parameter]
+		a := m.active[c.parameter]
+		switch {
+		case !ok:
+			// No value, nothing to decide. A lost AHRS doesn't end a bank exceedance.
+		case a == nil && c.exceeded(v):
+			m.lastID++
+			a = &activeExceedance{check: c}
+			a.Exceedance = Exceedance{ID: m.lastID, Parameter: c.parameter, Limit: c.limit, Unit: c.unit,
+				Start: s.time, InProgress: true, FlightID: s.flightID}
+			a.setPeak(s, v)
+			m.active[c.parameter] = a
+			log.Printf("Exceedance: %s\n", c.describe(&a.Exceedance))
+		case a != nil:
+			if c.beyond(v, a.Peak) {
+				a.setPeak(s, v)
+			}
+			if !c.within(v) {
+				a.withinSince = time.Time{}
+			} else if a.withinSince.IsZero() {
+				a.withinSince = s.time
+			} else if s.time.Sub(a.withinSince) >= exceedanceEndTime {
+				finished = append(finished, m.finish(a, a.withinSince))
+			}
+		}
+	}
+	// A limit that was switched off ends its exceedance.
+	for p, a := range m.active {
+		if !checked[p] {
+			finished = append(finished, m.finish(a, s.time))
+		}
+	}
+	return finished
+}
+
+func (a *activeExceedance) setPeak(s exceedanceSample, v float64) {
+	a.Peak = v
+	a.PeakTime = s.time
+	a.PositionValid, a.Lat, a.Lon, a.Altitude = s.positionValid, s.lat, s.lon, s.altitude
+}
+
+func (m *exceedanceMonitor) finish(a *activeExceedance, end time.Time) Exceedance {
+	delete(m.active, a.Parameter)
+	e := a.Exceedance
+	e.End = end
+	e.InProgress = false
+	m.history = append(m.history, e)
+	if len(m.history) > exceedancesMax {
+		m.history = m.history[len(m.history)-exceedancesMax:]
+	}
+	m.dirty = true
+	text := fmt.Sprintf("%s for %s", a.check.describe(&e), end.Sub(e.Start).Round(100*time.Millisecond))
+	m.alerts[e.Parameter] = exceedanceAlert{text, end.Add(exceedanceAlertHold)}
+	log.Printf("Exceedance ended: %s\n", text)
+	return e
+}
+
+// Alerts returns the alert text of every parameter that is or was recently exceeded.
+func (m *exceedanceMonitor) Alerts(now time.Time) map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alerts := make(map[string]string)
+	for p, a := range m.active {
+		alerts[p] = "Exceedance: " + a.check.describe(&a.Exceedance) + "."
+	}
+	for p, a := range m.alerts {
+		if now.After(a.until) {
+			delete(m.alerts, p)
+		} else if _, ok := alerts[p]; !ok {
+			alerts[p] = "Exceedance: " + a.text + "."
+		}
+	}
+	return alerts
+}
+
+// List returns the exceedances, newest first, including those in progress. With flightID set, only those of
+// that flight.
+func (m *exceedanceMonitor) List(flightID string) []Exceedance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]Exceedance, 0)
+	for _, a := range m.active {
+		if flightID == "" || a.FlightID == flightID {
+			ret = append(ret, a.Exceedance)
+		}
+	}
+	for i := len(m.history) - 1; i >= 0; i-- {
+		if flightID == "" || m.history[i].FlightID == flightID {
+			ret = append(ret, m.history[i])
+		}
+	}
+	return ret
+}
+
+func (m *exceedanceMonitor) Save() error {
+	m.mu.Lock()
+	if !m.dirty || len(m.fileName) == 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	buf, err := json.Marshal(&m.history)
+	m.dirty = false
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmpFile := m.fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, m.fileName)
+}
+
+func (m *exceedanceMonitor) Load() error {
+	buf, err := ioutil.ReadFile(m.fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var history []Exceedance
+	if err := json.Unmarshal(buf, &history); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = history
+	for _, e := range history {
+		if e.ID > m.lastID {
+			m.lastID = e.ID
+		}
+	}
+	return nil
+}
+
+// sampleExceedances reads the current situation for the exceedance monitor.
+func sampleExceedances() exceedanceSample {
+	s := exceedanceSample{time: time.Now().UTC(), values: make(map[string]float64)}
+	mySituation.muGPS.Lock()
+	if isGPSValid() {
+		if !mySituation.GPSTime.IsZero() {
+			s.time = mySituation.GPSTime.Add(stratuxClock.Since(mySituation.GPSLastGPSTimeStratuxTime)).UTC()
+		}
+		s.positionValid = true
+		s.lat, s.lon = float64(mySituation.GPSLatitude), float64(mySituation.GPSLongitude)
+		s.altitude = float64(mySituation.GPSAltitudeMSL)
+		s.values[EXCEEDANCE_SPEED] = mySituation.GPSGroundSpeed
+		s.values[EXCEEDANCE_ALTITUDE] = s.altitude
+		s.values[EXCEEDANCE_CLIMB] = float64(mySituation.GPSVerticalSpeed) * 60
+	}
+	mySituation.muGPS.Unlock()
+
+	if isTempPressValid() && mySituation.BaroSourceType != BARO_TYPE_NONE && mySituation.BaroSourceType != BARO_TYPE_ADSBESTIMATE {
+		s.values[EXCEEDANCE_ALTITUDE] = float64(mySituation.BaroPressureAltitude)
+		if mySituation.BaroQNH > 0 {
+			s.values[EXCEEDANCE_ALTITUDE] = float64(mySituation.BaroIndicatedAltitude)
+		}
+		s.values[EXCEEDANCE_CLIMB] = float64(mySituation.BaroVerticalSpeed)
+	}
+	if vs, ok := s.values[EXCEEDANCE_CLIMB]; ok {
+		s.values[EXCEEDANCE_DESCENT] = -vs
+	}
+
+	mySituation.muAttitude.Lock()
+	if !mySituation.AHRSLastAttitudeTime.IsZero() && stratuxClock.Since(mySituation.AHRSLastAttitudeTime) < exceedanceAttitudeMaxAge {
+		if !isAHRSInvalidValue(mySituation.AHRSRoll) && !isAHRSInvalidValue(mySituation.AHRSPitch) {
+			s.values[EXCEEDANCE_BANK] = math.Abs(mySituation.AHRSRoll)
+			s.values[EXCEEDANCE_PITCH_UP] = mySituation.AHRSPitch
+			s.values[EXCEEDANCE_PITCH_DOWN] = -mySituation.AHRSPitch
+		}
+		if !isAHRSInvalidValue(mySituation.AHRSGLoad) {
+			s.values[EXCEEDANCE_G_POSITIVE] = mySituation.AHRSGLoad
+			s.values[EXCEEDANCE_G_NEGATIVE] = mySituation.AHRSGLoad
+		}
+	}
+	mySituation.muAttitude.Unlock()
+
+	if flightLog != nil {
+		s.flightID = flightLog.CurrentID()
+	}
+	return s
+}
+
+func exceedanceMonitorLoop() {
+	ticker := time.NewTicker(exceedanceSampleInterval)
+	alerted := make(map[string]bool)
+	for range ticker.C {
+		s := sampleExceedances()
+		finished := exceedances.update(s, exceedanceChecks(globalSettings.GLimits, globalSettings.ExceedanceLimits))
+		for _, e := range finished {
+			logExceedance(e)
+		}
+		if len(finished) > 0 {
+			if err := exceedances.Save(); err != nil {
+				log.Printf("Exceedance monitor: failed to save %s: %s\n", exceedances.fileName, err.Error())
+			}
+		}
+
+		alerts := exceedances.Alerts(s.time)
+		for p, msg := range alerts {
+			updateSingleSystemErrorf("exceedance-"+p, "%s", msg)
+			alerted[p] = true
+		}
+		for p := range alerted {
+			if _, ok := alerts[p]; !ok {
+				removeSingleSystemError("exceedance-" + p)
+				delete(alerted, p)
+			}
+		}
+	}
+}
+
+func initExceedanceMonitor(fileName string) {
+	exceedances = newExceedanceMonitor(fileName)
+	if err := exceedances.Load(); err != nil {
+		log.Printf("Exceedance monitor: failed to load %s: %s\n", fileName, err.Error())
+	}
+	go exceedanceMonitorLoop()
+}
+
+// AJAX call - /api/exceedances. Responds with all recorded exceedances, newest first.
+// /api/exceedances?flight=<id> only lists those of one flight.
+func handleExceedancesRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	if exceedances == nil {
+		http.Error(w, "exceedance monitor not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	list := exceedances.List(strings.TrimSpace(r.URL.Query().Get("flight")))
+	listJSON, err := json.Marshal(&list)
+	if err != nil {
+		log.Printf("Error sending exceedances JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", listJSON)
+}
@@ -0,0 +1,226 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	exceedance_test.go: Unit tests for the exceedance monitor
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGLimits(t *testing.T) {
+	tests := []struct {
+		s        string
+		min, max float64
+	}{
+		{"-1.76 4.4", -1.76, 4.4},
+		{" -3  6 ", -3, 6},
+		{"", exceedanceDefaultGMin, exceedanceDefaultGMax},
+		{"4.4", exceedanceDefaultGMin, exceedanceDefaultGMax},
+		{"4.4 -1.76", exceedanceDefaultGMin, exceedanceDefaultGMax},
+		{"abc def", exceedanceDefaultGMin, exceedanceDefaultGMax},
+	}
+	for _, tt := range tests {
+		if min, max := parseGLimits(tt.s); min != tt.min || max != tt.max {
+			t.Errorf("%q: %v %v, want %v %v", tt.s, min, max, tt.min, tt.max)
+		}
+	}
+}
+
+func TestExceedanceChecks(t *testing.T) {
+	checks := exceedanceChecks("-1 3.8", ExceedanceLimits{Bank: 60, Descent: 2000})
+	want := map[string]float64{EXCEEDANCE_G_POSITIVE: 3.8, EXCEEDANCE_G_NEGATIVE: -1, EXCEEDANCE_BANK: 60, EXCEEDANCE_DESCENT: 2000}
+	if len(checks) != len(want) {
+		t.Fatalf("%d checks, want %d: %+v", len(checks), len(want), checks)
+	}
+	for _, c := range checks {
+		if limit, ok := want[c.parameter]; !ok || c.limit != limit {
+			t.Errorf("check %+v", c)
+		}
+	}
+}
+
+// exceedanceRun feeds one value per 100 ms for a parameter to a new monitor.
+func exceedanceRun(m *exceedanceMonitor, checks []exceedanceCheck, start time.Time, parameter string, values []float64) []Exceedance {
+	var finished []Exceedance
+	for i, v := range values {
+		s := exceedanceSample{
+			time:          start.Add(time.Duration(i) * exceedanceSampleInterval),
+			values:        map[string]float64{parameter: v},
+			positionValid: true,
+			lat:           47 + float64(i)/1000,
+			lon:           8,
+			altitude:      3000 + float64(i),
+			flightID:      "20250601T120000Z",
+		}
+		finished = append(finished, m.update(s, checks)...)
+	}
+	return finished
+}
+
+func TestExceedanceMonitor(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	repeat := func(v float64, n int) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = v
+		}
+		return values
+	}
+	join := func(parts ...[]float64) []float64 {
+		var values []float64
+		for _, p := range parts {
+			values = append(values, p...)
+		}
+		return values
+	}
+	tests := []struct {
+		name      string
+		parameter string
+		values    []float64
+		count     int     // Finished exceedances.
+		peak      float64 // Of the first.
+		peakIndex int
+		duration  time.Duration
+		active    bool // Still in progress at the end.
+	}{
+		{"Within", EXCEEDANCE_G_POSITIVE, repeat(3, 50), 0, 0, 0, 0, false},
+		{"Over G", EXCEEDANCE_G_POSITIVE, join(repeat(1, 5), []float64{4.6, 5.1, 4.8}, repeat(1, 20)), 1, 5.1, 6, 300 * time.Millisecond, false},
+		{"Negative G", EXCEEDANCE_G_NEGATIVE, join(repeat(1, 5), []float64{-2.5, -1.9}, repeat(0, 20)), 1, -2.5, 5, 200 * time.Millisecond, false},
+		// Within the hysteresis the exceedance goes on.
+		{"Hysteresis", EXCEEDANCE_BANK, join([]float64{62, 65}, repeat(59, 30), repeat(50, 12)), 1, 65, 1, 3200 * time.Millisecond, false},
+		// Back within the limit for less than a second doesn't split an exceedance.
+		{"Short dip", EXCEEDANCE_BANK, join([]float64{65}, repeat(50, 5), []float64{70}, repeat(50, 12)), 1, 70, 6, 700 * time.Millisecond, false},
+		{"Two", EXCEEDANCE_BANK, join([]float64{65}, repeat(50, 12), []float64{61}, repeat(50, 12)), 2, 65, 0, 100 * time.Millisecond, false},
+		{"In progress", EXCEEDANCE_DESCENT, join(repeat(500, 3), repeat(2500, 30)), 0, 0, 0, 0, true},
+	}
+	checks := exceedanceChecks("-1.76 4.4", ExceedanceLimits{Bank: 60, Descent: 2000})
+	for _, tt := range tests {
+		m := newExceedanceMonitor("")
+		finished := exceedanceRun(m, checks, start, tt.parameter, tt.values)
+		if len(finished) != tt.count {
+			t.Errorf("%s: %d exceedances, want %d: %+v", tt.name, len(finished), tt.count, finished)
+			continue
+		}
+		if _, active := m.active[tt.parameter]; active != tt.active {
+			t.Errorf("%s: in progress %v", tt.name, active)
+		}
+		if len(m.List("")) != tt.count+len(m.active) {
+			t.Errorf("%s: listed %d", tt.name, len(m.List("")))
+		}
+		if tt.count == 0 {
+			continue
+		}
+		e := finished[0]
+		peakTime := start.Add(time.Duration(tt.peakIndex) * exceedanceSampleInterval)
+		if e.Parameter != tt.parameter || e.Peak != tt.peak || !e.PeakTime.Equal(peakTime) || e.InProgress {
+			t.Errorf("%s: %+v", tt.name, e)
+		}
+		if e.End.Sub(e.Start) != tt.duration {
+			t.Errorf("%s: lasted %s, want %s", tt.name, e.End.Sub(e.Start), tt.duration)
+		}
+		if !e.PositionValid || e.Lat != 47+float64(tt.peakIndex)/1000 || e.Altitude != 3000+float64(tt.peakIndex) || e.FlightID != "20250601T120000Z" {
+			t.Errorf("%s: position %+v", tt.name, e)
+		}
+	}
+}
+
+func TestExceedanceMissingValues(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	m := newExceedanceMonitor("")
+	checks := exceedanceChecks("", ExceedanceLimits{Bank: 60})
+	exceedanceRun(m, checks, start, EXCEEDANCE_BANK, []float64{70})
+	// The AHRS dropping out doesn't end the exceedance.
+	for i := 1; i <= 20; i++ {
+		m.update(exceedanceSample{time: start.Add(time.Duration(i) * exceedanceSampleInterval)}, checks)
+	}
+	if m.active[EXCEEDANCE_BANK] == nil {
+		t.Fatal("exceedance ended without values")
+	}
+	// Switching the limit off does.
+	finished := m.update(exceedanceSample{time: start.Add(3 * time.Second)}, exceedanceChecks("", ExceedanceLimits{}))
+	if len(finished) != 1 || len(m.active) != 0 {
+		t.Errorf("limit turned off: %+v", finished)
+	}
+}
+
+func TestExceedanceAlerts(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	m := newExceedanceMonitor("")
+	checks := exceedanceChecks("-1.76 4.4", ExceedanceLimits{})
+	exceedanceRun(m, checks, start, EXCEEDANCE_G_POSITIVE, []float64{5.2, 5.6})
+	alerts := m.Alerts(start)
+	if len(alerts) != 1 || !strings.Contains(alerts[EXCEEDANCE_G_POSITIVE], "G load 5.60 G (limit 4.40 G)") {
+		t.Errorf("alerts in progress: %v", alerts)
+	}
+
+	finished := exceedanceRun(m, checks, start.Add(200*time.Millisecond), EXCEEDANCE_G_POSITIVE, []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1})
+	if len(finished) != 1 {
+		t.Fatalf("%d finished", len(finished))
+	}
+	alerts = m.Alerts(finished[0].End.Add(exceedanceAlertHold / 2))
+	if !strings.Contains(alerts[EXCEEDANCE_G_POSITIVE], "for 200ms") {
+		t.Errorf("alerts after the end: %v", alerts)
+	}
+	if alerts = m.Alerts(finished[0].End.Add(exceedanceAlertHold + time.Second)); len(alerts) != 0 {
+		t.Errorf("alerts after the hold time: %v", alerts)
+	}
+}
+
+func TestExceedancePersistence(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), exceedanceFile)
+	start := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	m := newExceedanceMonitor(fileName)
+	if err := m.Load(); err != nil {
+		t.Fatalf("load without a file: %v", err)
+	}
+	checks := exceedanceChecks("", ExceedanceLimits{Bank: 60})
+	exceedanceRun(m, checks, start, EXCEEDANCE_BANK, []float64{70, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50, 65, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50})
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newExceedanceMonitor(fileName)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	list := loaded.List("")
+	if len(list) != 2 || list[0].Peak != 65 || list[1].Peak != 70 || !list[1].Start.Equal(start) {
+		t.Fatalf("loaded %+v", list)
+	}
+	if len(loaded.List("20250601T120000Z")) != 2 || len(loaded.List("20250602T120000Z")) != 0 {
+		t.Errorf("flight filter")
+	}
+	// IDs continue after the loaded ones.
+	f := exceedanceRun(loaded, checks, start.Add(time.Hour), EXCEEDANCE_BANK, []float64{61, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50})
+	if len(f) != 1 || f[0].ID != 3 {
+		t.Errorf("new exceedance %+v", f)
+	}
+}
+
+func TestHandleExceedancesRequest(t *testing.T) {
+	saved := exceedances
+	defer func() { exceedances = saved }()
+	exceedances = newExceedanceMonitor("")
+	start := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	exceedanceRun(exceedances, exceedanceChecks("", ExceedanceLimits{}), start, EXCEEDANCE_G_NEGATIVE, []float64{-2})
+
+	w := httptest.NewRecorder()
+	handleExceedancesRequest(w, httptest.NewRequest("GET", "/api/exceedances", nil))
+	var list []Exceedance
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Parameter != EXCEEDANCE_G_NEGATIVE || !list[0].InProgress {
+		t.Errorf("response %s", w.Body.String())
+	}
+}
@@ -101,7 +101,7 @@ func computeRelativeVertical(ti TrafficInfo) (relativeVertical int32) {
 		altf = mySituation.GPSAltitudeMSL
 	}
 	if ti.AltIsGNSS && isGPSValid() {
-		// Altitude coming from OGN. We set the geoid separation to 0 in the OGN config, so OGN reports ellipsoid alt - we need to compare to that
+		// GNSS altitudes of traffic are HAE, as in ADS-B.
 		altf = mySituation.GPSHeightAboveEllipsoid
 	}
 	relativeVertical = int32(float32(ti.Alt)*0.3048 - altf*0.3048) // convert to meters
@@ -507,7 +507,7 @@ func relativeGpsAltToBaro(relVert float32) (alt int32, altIsGnss bool) {
 	if isTempPressValid() {
 		return int32(mySituation.BaroPressureAltitude + relVert*3.28084), false
 	} else if isGPSValid() {
-		return int32(mySituation.GPSAltitudeMSL + relVert*3.28084), true
+		return int32(mySituation.GPSHeightAboveEllipsoid + relVert*3.28084), true
 	}
 	return 0, false
 }
@@ -719,6 +719,7 @@ func parseFlarmPFLAA(message []string) {
 
 	// notify
 	registerTrafficUpdate(ti)
+	registerThermalReport(ti)
 
 	// mark traffic as seen
 	seenTraffic[key] = true
@@ -0,0 +1,587 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	flights.go: Automatic flight recording. Detects takeoff and landing from GPS ground speed,
+	 baro vertical speed and AHRS bank, records the track of each flight, names the departure
+	 and arrival airports and exports flights as GPX, KML or IGC via /api/flights.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	flightsDir              = "flights"
+	flightCurrentFile       = "current.json"
+	flightIDFormat          = "20060102T150405Z"
+	flightTakeoffSpeed      = 40  // kts
+	flightClimbOutSpeed     = 20  // kts, with flightClimbOutRate: slow aircraft, winch launches.
+	flightClimbOutRate      = 300 // ft/min
+	flightTakeoffTime       = 5 * time.Second
+	flightLandingSpeed      = 25  // kts
+	flightLandingVertSpeed  = 150 // ft/min
+	flightAirborneBank      = 10  // degrees. Nobody taxis banked, e.g. a slow turn or a hover.
+	flightLandingTime       = 30 * time.Second
+	flightMinDuration       = 1 * time.Minute // Shorter "flights" are discarded (high speed taxi tests) ...
+	flightMinAltitudeGain   = 200             // ft, ... as are those that never climbed (car rides).
+	flightTrackInterval     = 2 * time.Second
+	flightPreTakeoffBuffer  = 30 * time.Second // Ground roll recorded before the takeoff is detected.
+	flightAirportRadius     = 3                // NM
+	flightsMax              = 100
+	flightRecorderSaveEvery = 1 * time.Minute
+	flightGPXContentType    = "application/gpx+xml"
+	flightKMLContentType    = "application/vnd.google-earth.kml+xml"
+	flightIGCContentType    = "application/octet-stream"
+)
+
+type FlightPoint struct {
+	Time                  time.Time
+	Lat                   float64
+	Lon                   float64
+	GPSAltitude           float64 // ft MSL
+	PressureAltitude      float64 // ft
+	PressureAltitudeValid bool
+	GroundSpeed           float64 // kts
+	Track                 float64 // degrees true
+	VerticalSpeed         float64 // ft/min, baro if available, GPS otherwise
+}
+
+type Flight struct {
+	ID            string // Takeoff time, flightIDFormat.
+	Takeoff       time.Time
+	Landing       time.Time // Zero while in flight.
+	InProgress    bool
+	Departure     string // Airport ident, "" if not near an airport.
+	DepartureName string
+	Arrival       string
+	ArrivalName   string
+	Distance_nm   float64
+	MaxAltitude   float64 // ft MSL
+	Points        int
+	Track         []FlightPoint `json:",omitempty"`
+}
+
+// flightSample is the situation the flight detector looks at once per second.
+type flightSample struct {
+	valid         bool // Valid GPS fix.
+	time          time.Time
+	lat, lon      float64
+	gpsAltitude   float64
+	groundSpeed   float64
+	track         float64
+	gpsVertSpeed  float64
+	baroValid     bool
+	pressAltitude float64
+	baroVertSpeed float64
+	ahrsValid     bool
+	roll          float64
+}
+
+type flightRecorder struct {
+	mu           sync.Mutex
+	dir          string
+	flights      []Flight // Finished flights without track, oldest first.
+	current      *Flight
+	pending      []FlightPoint // Recent points while on the ground.
+	takeoffSince time.Time
+	landingSince time.Time
+	lastPoint    time.Time
+	dirty        bool
+}
+
+var flightLog *flightRecorder
+
+func newFlightRecorder(dir string) *flightRecorder {
+	return &flightRecorder{dir: dir}
+}
+
+func (s *flightSample) point() FlightPoint {
+	p := FlightPoint{
+		Time:                  s.time,
+		Lat:                   s.lat,
+		Lon:                   s.lon,
+		GPSAltitude:           s.gpsAltitude,
+		PressureAltitude:      s.pressAltitude,
+		PressureAltitudeValid: s.baroValid,
+		GroundSpeed:           s.groundSpeed,
+		Track:                 s.track,
+		VerticalSpeed:         s.gpsVertSpeed,
+	}
+	if s.baroValid {
+		p.VerticalSpeed = s.baroVertSpeed
+	}
+	return p
+}
+
+func (s *flightSample) takeoffCondition() bool {
+	return s.groundSpeed >= flightTakeoffSpeed || (s.groundSpeed >= flightClimbOutSpeed && s.baroValid && s.baroVertSpeed >= flightClimbOutRate)
+}
+
+func (s *flightSample) landedCondition() bool {
+	if s.groundSpeed >= flightLandingSpeed {
+		return false
+	}
+	if s.baroValid && math.Abs(s.baroVertSpeed) >= flightLandingVertSpeed {
+		return false
+	}
+	return !s.ahrsValid || math.Abs(s.roll) < flightAirborneBank
+}
+
+// update runs the takeoff/landing detector and records the track.
+func (fr *flightRecorder) update(s flightSample) {
+	if !s.valid {
+		return
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if s.time.Sub(fr.lastPoint) >= flightTrackInterval || s.time.Before(fr.lastPoint) {
+		fr.lastPoint = s.time
+		if fr.current != nil {
+			fr.current.Track = append(fr.current.Track, s.point())
+			fr.dirty = true
+		} else {
+			fr.pending = append(fr.pending, s.point())
+			for len(fr.pending) > 0 && s.time.Sub(fr.pending[0].Time) > flightPreTakeoffBuffer {
+				fr.pending = fr.pending[1:]
+			}
+		}
+	}
+
+	if fr.current == nil {
+		if !s.takeoffCondition() {
+			fr.takeoffSince = time.Time{}
+			return
+		}
+		if fr.takeoffSince.IsZero() {
+			fr.takeoffSince = s.time
+		}
+		if s.time.Sub(fr.takeoffSince) >= flightTakeoffTime {
+			fr.startFlight(fr.takeoffSince)
+		}
+		return
+	}
+
+	if !s.landedCondition() {
+		fr.landingSince = time.Time{}
+		return
+	}
+	if fr.landingSince.IsZero() {
+		fr.landingSince = s.time
+	}
+	if s.time.Sub(fr.landingSince) >= flightLandingTime {
+		fr.finishFlight(fr.landingSince)
+	}
+}
+
+func (fr *flightRecorder) startFlight(takeoff time.Time) {
+	f := &Flight{
+		ID:         takeoff.UTC().Format(flightIDFormat),
+		Takeoff:    takeoff,
+		InProgress: true,
+		Track:      fr.pending,
+	}
+	fr.pending = nil
+	fr.takeoffSince = time.Time{}
+	fr.landingSince = time.Time{}
+	if len(f.Track) > 0 {
+		if apt, _, ok := findNearestAirport(f.Track[0].Lat, f.Track[0].Lon, flightAirportRadius, false); ok {
+			f.Departure = apt.Ident
+			f.DepartureName = apt.Name
+		}
+	}
+	fr.current = f
+	fr.dirty = true
+	log.Printf("Flight recorder: takeoff at %s from %s\n", takeoff.UTC().Format(time.RFC3339), f.Departure)
+}
+
+// finishFlight closes the current flight and stores it, unless it was too short to be a flight.
+func (fr *flightRecorder) finishFlight(landing time.Time) {
+	f := fr.current
+	fr.current = nil
+	fr.landingSince = time.Time{}
+	fr.dirty = false
+	os.Remove(filepath.Join(fr.dir, flightCurrentFile))
+	f.summarize()
+	if landing.Sub(f.Takeoff) < flightMinDuration || len(f.Track) == 0 || f.MaxAltitude-f.Track[0].GPSAltitude < flightMinAltitudeGain {
+		log.Printf("Flight recorder: discarding %s, %s long, max altitude %.0f ft\n", f.ID, landing.Sub(f.Takeoff).String(), f.MaxAltitude)
+		return
+	}
+	f.Landing = landing
+	f.InProgress = false
+	last := f.Track[len(f.Track)-1]
+	if apt, _, ok := findNearestAirport(last.Lat, last.Lon, flightAirportRadius, false); ok {
+		f.Arrival = apt.Ident
+		f.ArrivalName = apt.Name
+	}
+	log.Printf("Flight recorder: landing at %s at %s, flight %s\n", landing.UTC().Format(time.RFC3339), f.Arrival, f.ID)
+	if err := fr.writeFlight(f, f.ID+".json"); err != nil {
+		log.Printf("Flight recorder: failed to save flight %s: %s\n", f.ID, err.Error())
+	}
+	summary := *f
+	summary.Track = nil
+	fr.flights = append(fr.flights, summary)
+	for len(fr.flights) > flightsMax {
+		os.Remove(filepath.Join(fr.dir, fr.flights[0].ID+".json"))
+		fr.flights = fr.flights[1:]
+	}
+}
+
+// summarize computes distance, maximum altitude and point count from the track.
+func (f *Flight) summarize() {
+	f.Distance_nm = 0
+	f.MaxAltitude = 0
+	for i, p := range f.Track {
+		if i > 0 {
+			if d, _ := common.Distance(f.Track[i-1].Lat, f.Track[i-1].Lon, p.Lat, p.Lon); !math.IsNaN(d) {
+				f.Distance_nm += d / 1852
+			}
+		}
+		if i == 0 || p.GPSAltitude > f.MaxAltitude {
+			f.MaxAltitude = p.GPSAltitude
+		}
+	}
+	f.Points = len(f.Track)
+}
+
+func (fr *flightRecorder) writeFlight(f *Flight, name string) error {
+	if err := os.MkdirAll(fr.dir, 0755); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	fname := filepath.Join(fr.dir, name)
+	if err := ioutil.WriteFile(fname+".tmp", buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(fname+".tmp", fname)
+}
+
+func readFlight(fname string) (*Flight, error) {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var f Flight
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Save writes the flight in progress, so that not much of it is lost if the power is cut.
+func (fr *flightRecorder) Save() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.current == nil || !fr.dirty {
+		return nil
+	}
+	fr.current.summarize()
+	fr.dirty = false
+	return fr.writeFlight(fr.current, flightCurrentFile)
+}
+
+// Load reads the list of recorded flights. A flight that was still in progress when we were switched
+// off (usually right after landing, before the landing was detected) is closed at its last point.
+func (fr *flightRecorder) Load() error {
+	files, err := filepath.Glob(filepath.Join(fr.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.flights = nil
+	var unfinished *Flight
+	for _, fname := range files {
+		f, err := readFlight(fname)
+		if err != nil {
+			log.Printf("Flight recorder: can't read %s: %s\n", fname, err.Error())
+			continue
+		}
+		if filepath.Base(fname) == flightCurrentFile {
+			unfinished = f
+			continue
+		}
+		f.Track = nil
+		fr.flights = append(fr.flights, *f)
+	}
+	sort.Slice(fr.flights, func(i, j int) bool { return fr.flights[i].Takeoff.Before(fr.flights[j].Takeoff) })
+	if unfinished != nil && len(unfinished.Track) > 0 {
+		fr.current = unfinished
+		fr.finishFlight(unfinished.Track[len(unfinished.Track)-1].Time)
+	} else {
+		os.Remove(filepath.Join(fr.dir, flightCurrentFile))
+	}
+	return nil
+}
+
+// List returns all flights without track, newest first, including the one in progress.
+func (fr *flightRecorder) List() []Flight {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	ret := make([]Flight, 0, len(fr.flights)+1)
+	if fr.current != nil {
+		f := *fr.current
+		f.summarize()
+		f.Track = nil
+		ret = append(ret, f)
+	}
+	for i := len(fr.flights) - 1; i >= 0; i-- {
+		ret = append(ret, fr.flights[i])
+	}
+	return ret
+}
+
+// CurrentID returns the ID of the flight in progress, empty on the ground.
+func (fr *flightRecorder) CurrentID() string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.current == nil {
+		return ""
+	}
+	return fr.current.ID
+}
+
+// Get returns a flight including its track.
+func (fr *flightRecorder) Get(id string) (*Flight, bool) {
+	fr.mu.Lock()
+	if fr.current != nil && fr.current.ID == id {
+		f := *fr.current
+		f.Track = append([]FlightPoint(nil), fr.current.Track...)
+		fr.mu.Unlock()
+		f.summarize()
+		return &f, true
+	}
+	known := false
+	for _, f := range fr.flights {
+		known = known || f.ID == id
+	}
+	fr.mu.Unlock()
+	if !known {
+		return nil, false
+	}
+	f, err := readFlight(filepath.Join(fr.dir, id+".json"))
+	if err != nil {
+		log.Printf("Flight recorder: can't read flight %s: %s\n", id, err.Error())
+		return nil, false
+	}
+	return f, true
+}
+
+func (f *Flight) title() string {
+	dep, arr := f.Departure, f.Arrival
+	if dep == "" {
+		dep = "?"
+	}
+	if arr == "" {
+		arr = "?"
+	}
+	if f.InProgress {
+		arr = "..."
+	}
+	return fmt.Sprintf("%s %s-%s", f.Takeoff.UTC().Format("2006-01-02 15:04Z"), dep, arr)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeFlightGPX(w io.Writer, f *Flight) {
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<gpx version=\"1.1\" creator=\"Stratux %s\" xmlns=\"http://www.topografix.com/GPX/1/1\">\n", xmlEscape(stratuxVersion))
+	fmt.Fprintf(w, "<trk><name>%s</name><trkseg>\n", xmlEscape(f.title()))
+	for _, p := range f.Track {
+		fmt.Fprintf(w, "<trkpt lat=\"%.6f\" lon=\"%.6f\"><ele>%.1f</ele><time>%s</time></trkpt>\n",
+			p.Lat, p.Lon, p.GPSAltitude*0.3048, p.Time.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	fmt.Fprintf(w, "</trkseg></trk>\n</gpx>\n")
+}
+
+func writeFlightKML(w io.Writer, f *Flight) {
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<kml xmlns=\"http://www.opengis.net/kml/2.2\" xmlns:gx=\"http://www.google.com/kml/ext/2.2\">\n<Document>\n")
+	fmt.Fprintf(w, "<name>%s</name>\n", xmlEscape(f.title()))
+	fmt.Fprintf(w, "<Style id=\"track\"><LineStyle><color>ff0000ff</color><width>3</width></LineStyle></Style>\n")
+	fmt.Fprintf(w, "<Placemark><name>%s</name><styleUrl>#track</styleUrl>\n", xmlEscape(f.title()))
+	fmt.Fprintf(w, "<gx:Track><altitudeMode>absolute</altitudeMode>\n")
+	for _, p := range f.Track {
+		fmt.Fprintf(w, "<when>%s</when>\n", p.Time.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	for _, p := range f.Track {
+		fmt.Fprintf(w, "<gx:coord>%.6f %.6f %.1f</gx:coord>\n", p.Lon, p.Lat, p.GPSAltitude*0.3048)
+	}
+	fmt.Fprintf(w, "</gx:Track></Placemark>\n</Document>\n</kml>\n")
+}
+
+// igcCoord formats a coordinate as DDMMmmmN / DDDMMmmmE.
+func igcCoord(v float64, degDigits int, pos, neg byte) string {
+	hemi := pos
+	if v < 0 {
+		hemi = neg
+		v = -v
+	}
+	milliMinutes := int(math.Round(v * 60000))
+	return fmt.Sprintf("%0*d%05d%c", degDigits, milliMinutes/60000, milliMinutes%60000, hemi)
+}
+
+// writeFlightIGC writes an IGC file. It carries no security (G) record, so it is not a validated log.
+func writeFlightIGC(w io.Writer, f *Flight) {
+	start := f.Takeoff.UTC()
+	if len(f.Track) > 0 {
+		start = f.Track[0].Time.UTC()
+	}
+	lines := []string{
+		"AXSXSTX Stratux",
+		fmt.Sprintf("HFDTE%s", start.Format("020106")),
+		"HFFXA050",
+		"HFPLTPILOTINCHARGE:",
+		"HFGTYGLIDERTYPE:",
+		"HFGIDGLIDERID:",
+		"HFDTM100GPSDATUM:WGS-1984",
+		fmt.Sprintf("HFRFWFIRMWAREVERSION:%s", stratuxVersion),
+		"HFFTYFRTYPE:Stratux",
+		"HFALGALTGPS:GEO",
+		"HFALPALTPRESSURE:ISA",
+	}
+	for _, l := range lines {
+		fmt.Fprintf(w, "%s\r\n", l)
+	}
+	for _, p := range f.Track {
+		pressAlt := 0
+		if p.PressureAltitudeValid {
+			pressAlt = int(math.Round(p.PressureAltitude * 0.3048))
+		}
+		fmt.Fprintf(w, "B%s%s%sA%05d%05d\r\n", p.Time.UTC().Format("150405"), igcCoord(p.Lat, 2, 'N', 'S'), igcCoord(p.Lon, 3, 'E', 'W'),
+			pressAlt, int(math.Round(p.GPSAltitude*0.3048)))
+	}
+}
+
+// sampleFlightRecorder reads the current situation for the flight detector.
+func sampleFlightRecorder() flightSample {
+	var s flightSample
+	mySituation.muGPS.Lock()
+	s.valid = isGPSValid()
+	s.time = time.Now().UTC()
+	if !mySituation.GPSTime.IsZero() {
+		s.time = mySituation.GPSTime.Add(stratuxClock.Since(mySituation.GPSLastGPSTimeStratuxTime)).UTC()
+	}
+	s.lat = float64(mySituation.GPSLatitude)
+	s.lon = float64(mySituation.GPSLongitude)
+	s.gpsAltitude = float64(mySituation.GPSAltitudeMSL)
+	s.groundSpeed = mySituation.GPSGroundSpeed
+	s.track = float64(mySituation.GPSTrueCourse)
+	s.gpsVertSpeed = float64(mySituation.GPSVerticalSpeed) * 60
+	mySituation.muGPS.Unlock()
+
+	s.baroValid = isTempPressValid() && mySituation.BaroSourceType != BARO_TYPE_NONE && mySituation.BaroSourceType != BARO_TYPE_ADSBESTIMATE
+	s.pressAltitude = float64(mySituation.BaroPressureAltitude)
+	s.baroVertSpeed = float64(mySituation.BaroVerticalSpeed)
+	s.ahrsValid = isAHRSValid() && globalStatus.IMUConnected
+	s.roll = mySituation.AHRSRoll
+	return s
+}
+
+func updateFlightRecorder() {
+	if flightLog != nil {
+		flightLog.update(sampleFlightRecorder())
+	}
+}
+
+func flightRecorderSaver() {
+	ticker := time.NewTicker(flightRecorderSaveEvery)
+	for {
+		<-ticker.C
+		if err := flightLog.Save(); err != nil {
+			log.Printf("Flight recorder: failed to save current flight: %s\n", err.Error())
+		}
+	}
+}
+
+func initFlightRecorder(dir string) {
+	flightLog = newFlightRecorder(dir)
+	if err := flightLog.Load(); err != nil {
+		log.Printf("Flight recorder: failed to load flights from %s: %s\n", dir, err.Error())
+	}
+	go flightRecorderSaver()
+}
+
+// AJAX call - /api/flights. Responds with the list of recorded flights, newest first.
+// /api/flights/<id> responds with one flight including its track, /api/flights/<id>.gpx, .kml or .igc
+// downloads it in that format.
+func handleFlightsRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	if flightLog == nil {
+		http.Error(w, "flight recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/flights"), "/")
+	if name == "" {
+		setJSONHeaders(w)
+		flightsJSON, err := json.Marshal(flightLog.List())
+		if err != nil {
+			log.Printf("Error sending flights JSON data: %s\n", err.Error())
+		}
+		fmt.Fprintf(w, "%s\n", flightsJSON)
+		return
+	}
+
+	ext := filepath.Ext(name)
+	id := strings.TrimSuffix(name, ext)
+	if _, err := time.Parse(flightIDFormat, id); err != nil {
+		http.Error(w, "invalid flight id", http.StatusBadRequest)
+		return
+	}
+	f, ok := flightLog.Get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var write func(io.Writer, *Flight)
+	var contentType string
+	switch strings.ToLower(ext) {
+	case "":
+		setJSONHeaders(w)
+		flightJSON, err := json.Marshal(f)
+		if err != nil {
+			log.Printf("Error sending flight JSON data: %s\n", err.Error())
+		}
+		fmt.Fprintf(w, "%s\n", flightJSON)
+		return
+	case ".gpx":
+		write, contentType = writeFlightGPX, flightGPXContentType
+	case ".kml":
+		write, contentType = writeFlightKML, flightKMLContentType
+	case ".igc":
+		write, contentType = writeFlightIGC, flightIGCContentType
+	default:
+		http.Error(w, "unsupported format "+ext, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=stratux-%s%s", id, strings.ToLower(ext)))
+	write(w, f)
+}
@@ -0,0 +1,389 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	flights_test.go: Unit tests for takeoff/landing detection and GPX/KML/IGC flight export.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+// Airports from setupWeatherTest.
+const (
+	testKOSHLat, testKOSHLon = 43.9844, -88.557
+	testKMSNLat, testKMSNLon = 43.1399, -89.3375
+)
+
+// flightSegment flies towards the destination with the given speeds until the time is up or it is
+// within untilNM of the destination.
+type flightSegment struct {
+	seconds int
+	gs, vs  float64 // kts, ft/min
+	roll    float64
+	untilNM float64
+}
+
+type flightSimulator struct {
+	s                  flightSample
+	destLat, destLon   float64
+	baroValid, ahrsVal bool
+}
+
+func newFlightSimulator(start time.Time, lat, lon, alt float64) *flightSimulator {
+	sim := &flightSimulator{destLat: testKMSNLat, destLon: testKMSNLon, baroValid: true, ahrsVal: true}
+	sim.s = flightSample{valid: true, time: start, lat: lat, lon: lon, gpsAltitude: alt, pressAltitude: alt - 120}
+	return sim
+}
+
+func (sim *flightSimulator) fly(fr *flightRecorder, segments []flightSegment) {
+	for _, seg := range segments {
+		for i := 0; i < seg.seconds; i++ {
+			dist, brg, _, _ := common.DistRect(sim.s.lat, sim.s.lon, sim.destLat, sim.destLon)
+			if seg.untilNM > 0 && dist/1852 < seg.untilNM {
+				break
+			}
+			sim.s.time = sim.s.time.Add(time.Second)
+			sim.s.lat, sim.s.lon = calcLocationForBearingDistance(sim.s.lat, sim.s.lon, brg, seg.gs/3600)
+			sim.s.gpsAltitude += seg.vs / 60
+			sim.s.pressAltitude += seg.vs / 60
+			sim.s.groundSpeed = seg.gs
+			sim.s.track = brg
+			sim.s.gpsVertSpeed = seg.vs
+			sim.s.baroValid = sim.baroValid
+			sim.s.baroVertSpeed = seg.vs
+			sim.s.ahrsValid = sim.ahrsVal
+			sim.s.roll = seg.roll
+			fr.update(sim.s)
+		}
+	}
+}
+
+var testFlightKOSHKMSN = []flightSegment{
+	{seconds: 60, gs: 8},                  // Taxi.
+	{seconds: 20, gs: 55},                 // Takeoff roll.
+	{seconds: 180, gs: 90, vs: 700},       // Climb.
+	{seconds: 3600, gs: 120, untilNM: 5},  // Cruise.
+	{seconds: 150, gs: 100, vs: -800},     // Descent.
+	{seconds: 30, gs: 60, vs: -300},       // Final.
+	{seconds: 120, gs: 10, untilNM: 0.05}, // Rollout and taxi.
+	{seconds: 300, gs: 0},                 // Parked.
+}
+
+func TestFlightDetection(t *testing.T) {
+	_, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		segments []flightSegment
+		noBaro   bool
+		flights  int
+	}{
+		{"Cross country", testFlightKOSHKMSN, false, 1},
+		{"Cross country without baro", testFlightKOSHKMSN, true, 1},
+		{"High speed taxi", []flightSegment{{seconds: 20, gs: 45}, {seconds: 60, gs: 5}}, false, 0},
+		{"Car ride", []flightSegment{{seconds: 1200, gs: 55}, {seconds: 60, gs: 0}}, false, 0},
+		{"Touch and go", []flightSegment{
+			{seconds: 20, gs: 55}, {seconds: 300, gs: 80, vs: 500}, {seconds: 300, gs: 80, vs: -500},
+			{seconds: 20, gs: 20}, {seconds: 20, gs: 55}, {seconds: 300, gs: 80, vs: 500}, {seconds: 300, gs: 80, vs: -500},
+			{seconds: 60, gs: 5}}, false, 1},
+		{"Slow flight in a turn", []flightSegment{
+			{seconds: 20, gs: 55}, {seconds: 300, gs: 80, vs: 500},
+			{seconds: 120, gs: 15, roll: 25}, // Into a strong headwind, not landed.
+			{seconds: 300, gs: 80, vs: -500}, {seconds: 60, gs: 5}}, false, 1},
+		{"Winch launch", []flightSegment{
+			{seconds: 30, gs: 30, vs: 1500}, {seconds: 600, gs: 45, vs: -300}, {seconds: 60, gs: 0}}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "stratux-flights-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			fr := newFlightRecorder(dir)
+			sim := newFlightSimulator(start, testKOSHLat, testKOSHLon, 800)
+			sim.baroValid = !tt.noBaro
+			sim.fly(fr, tt.segments)
+			flights := fr.List()
+			if len(flights) != tt.flights {
+				t.Fatalf("%d flights, want %d: %+v", len(flights), tt.flights, flights)
+			}
+			for _, f := range flights {
+				if f.InProgress || f.Landing.IsZero() || f.Track != nil {
+					t.Errorf("flight not finished: %+v", f)
+				}
+			}
+		})
+	}
+}
+
+func TestFlightRecording(t *testing.T) {
+	_, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "stratux-flights-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fr := newFlightRecorder(dir)
+	sim := newFlightSimulator(start, testKOSHLat, testKOSHLon, 800)
+	sim.fly(fr, testFlightKOSHKMSN[:3])
+	if l := fr.List(); len(l) != 1 || !l[0].InProgress || l[0].Departure != "KOSH" {
+		t.Fatalf("in flight: %+v", l)
+	}
+	// Takeoff roll started after 60 s of taxi.
+	if f := fr.List()[0]; !f.Takeoff.Equal(start.Add(61 * time.Second)) {
+		t.Errorf("takeoff at %v", f.Takeoff)
+	}
+	if err := fr.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, flightCurrentFile)); err != nil {
+		t.Errorf("flight in progress not saved: %v", err)
+	}
+	sim.fly(fr, testFlightKOSHKMSN[3:])
+
+	l := fr.List()
+	if len(l) != 1 {
+		t.Fatalf("flights = %+v", l)
+	}
+	f := l[0]
+	if f.Departure != "KOSH" || f.Arrival != "KMSN" || f.DepartureName != "Wittman Regional" {
+		t.Errorf("departure %q, arrival %q", f.Departure, f.Arrival)
+	}
+	if f.Distance_nm < 58 || f.Distance_nm > 64 {
+		t.Errorf("distance = %.1f nm", f.Distance_nm)
+	}
+	if f.MaxAltitude < 2800 || f.MaxAltitude > 2950 {
+		t.Errorf("max altitude = %.0f ft", f.MaxAltitude)
+	}
+	if d := f.Landing.Sub(f.Takeoff); d < 30*time.Minute || d > 40*time.Minute {
+		t.Errorf("flight time = %v", d)
+	}
+	if _, err := os.Stat(filepath.Join(dir, flightCurrentFile)); !os.IsNotExist(err) {
+		t.Errorf("in progress file not removed")
+	}
+
+	full, ok := fr.Get(f.ID)
+	if !ok || len(full.Track) != f.Points || f.Points < 900 {
+		t.Fatalf("Get(%s) = %v, %d points, summary says %d", f.ID, ok, len(full.Track), f.Points)
+	}
+	// Ground roll before the takeoff detection is part of the track.
+	if full.Track[0].GroundSpeed != 8 {
+		t.Errorf("track starts at %.0f kts", full.Track[0].GroundSpeed)
+	}
+
+	// Reload from disk.
+	fr2 := newFlightRecorder(dir)
+	if err := fr2.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if l2 := fr2.List(); len(l2) != 1 || l2[0].ID != f.ID || l2[0].Arrival != "KMSN" {
+		t.Errorf("reloaded flights = %+v", l2)
+	}
+	if _, ok := fr2.Get("20250601T000000Z"); ok {
+		t.Errorf("Get of unknown flight succeeded")
+	}
+}
+
+func TestFlightRecorderLoadUnfinished(t *testing.T) {
+	_, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "stratux-flights-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Switched off right after landing, before the landing was detected.
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fr := newFlightRecorder(dir)
+	sim := newFlightSimulator(start, testKOSHLat, testKOSHLon, 800)
+	sim.fly(fr, testFlightKOSHKMSN[:6])
+	sim.fly(fr, []flightSegment{{seconds: 15, gs: 10}})
+	if err := fr.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	fr2 := newFlightRecorder(dir)
+	if err := fr2.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	l := fr2.List()
+	if len(l) != 1 || l[0].InProgress || l[0].Arrival != "KMSN" || sim.s.time.Sub(l[0].Landing) >= flightTrackInterval {
+		t.Fatalf("flights = %+v", l)
+	}
+	if _, err := os.Stat(filepath.Join(dir, l[0].ID+".json")); err != nil {
+		t.Errorf("recovered flight not saved: %v", err)
+	}
+}
+
+func makeTestFlight() *Flight {
+	t0 := time.Date(2025, 6, 1, 23, 59, 58, 0, time.UTC)
+	return &Flight{
+		ID:        t0.Format(flightIDFormat),
+		Takeoff:   t0,
+		Landing:   t0.Add(4 * time.Second),
+		Departure: "KOSH",
+		Arrival:   "A&B",
+		Track: []FlightPoint{
+			{Time: t0, Lat: 43.9844, Lon: -88.557, GPSAltitude: 1000, PressureAltitude: 900, PressureAltitudeValid: true},
+			{Time: t0.Add(2 * time.Second), Lat: -33.5, Lon: 151.25, GPSAltitude: 3280.84},
+			{Time: t0.Add(4 * time.Second), Lat: 0.00001, Lon: -0.00001, GPSAltitude: -50},
+		},
+	}
+}
+
+func TestWriteFlightGPX(t *testing.T) {
+	var buf bytes.Buffer
+	writeFlightGPX(&buf, makeTestFlight())
+	var gpx struct {
+		Trk struct {
+			Name   string `xml:"name"`
+			Trkseg struct {
+				Trkpt []struct {
+					Lat  float64 `xml:"lat,attr"`
+					Lon  float64 `xml:"lon,attr"`
+					Ele  float64 `xml:"ele"`
+					Time string  `xml:"time"`
+				} `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &gpx); err != nil {
+		t.Fatalf("invalid GPX: %v\n%s", err, buf.String())
+	}
+	if gpx.Trk.Name != "2025-06-01 23:59Z KOSH-A&B" {
+		t.Errorf("name = %q", gpx.Trk.Name)
+	}
+	pts := gpx.Trk.Trkseg.Trkpt
+	if len(pts) != 3 || pts[1].Lat != -33.5 || pts[1].Lon != 151.25 || pts[1].Ele != 1000 || pts[2].Time != "2025-06-02T00:00:02Z" {
+		t.Errorf("points = %+v", pts)
+	}
+}
+
+func TestWriteFlightKML(t *testing.T) {
+	var buf bytes.Buffer
+	writeFlightKML(&buf, makeTestFlight())
+	var kml struct {
+		Document struct {
+			Placemark struct {
+				Track struct {
+					When  []string `xml:"when"`
+					Coord []string `xml:"coord"`
+				} `xml:"Track"`
+			} `xml:"Placemark"`
+		} `xml:"Document"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &kml); err != nil {
+		t.Fatalf("invalid KML: %v\n%s", err, buf.String())
+	}
+	tr := kml.Document.Placemark.Track
+	if len(tr.When) != 3 || len(tr.Coord) != 3 || tr.Coord[1] != "151.250000 -33.500000 1000.0" {
+		t.Errorf("track = %+v", tr)
+	}
+}
+
+func TestWriteFlightIGC(t *testing.T) {
+	var buf bytes.Buffer
+	writeFlightIGC(&buf, makeTestFlight())
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	var b []string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "B") {
+			b = append(b, l)
+		}
+	}
+	if lines[0][0] != 'A' || lines[1] != "HFDTE010625" {
+		t.Errorf("header = %q", lines[:2])
+	}
+	want := []string{
+		"B2359584359064N08833420WA0027400305",
+		"B0000003330000S15115000EA0000001000",
+		"B0000020000001N00000001WA00000-0015",
+	}
+	if strings.Join(b, "\n") != strings.Join(want, "\n") {
+		t.Errorf("B records:\n%s\nwant\n%s", strings.Join(b, "\n"), strings.Join(want, "\n"))
+	}
+	for _, l := range b {
+		if len(l) != 35 {
+			t.Errorf("B record %q is %d characters, want 35", l, len(l))
+		}
+	}
+}
+
+func TestHandleFlightsRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stratux-flights-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := flightLog
+	defer func() { flightLog = saved }()
+	flightLog = newFlightRecorder(dir)
+	f := makeTestFlight()
+	if err := flightLog.writeFlight(f, f.ID+".json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := flightLog.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{"/api/flights", 200, "application/json", `"ID":"20250601T235958Z"`},
+		{"/api/flights/20250601T235958Z", 200, "application/json", `"Track":[`},
+		{"/api/flights/20250601T235958Z.gpx", 200, flightGPXContentType, "<trkpt"},
+		{"/api/flights/20250601T235958Z.kml", 200, flightKMLContentType, "<gx:coord>"},
+		{"/api/flights/20250601T235958Z.igc", 200, flightIGCContentType, "HFDTE010625"},
+		{"/api/flights/20250601T235958Z.csv", 400, "", ""},
+		{"/api/flights/20250602T000000Z.gpx", 404, "", ""},
+		{"/api/flights/..%2F..%2Fetc%2Fpasswd", 400, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handleFlightsRequest(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: code %d, want %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code != 200 {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: Content-Type %q", tt.path, ct)
+		}
+		if !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("%s: body doesn't contain %q: %s", tt.path, tt.contains, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handleFlightsRequest(w, httptest.NewRequest("GET", "/api/flights", nil))
+	var list []Flight
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].Track != nil {
+		t.Errorf("list = %+v, %v", list, err)
+	}
+}
@@ -114,6 +114,7 @@ const (
 
 	// upper nibble is used for the protocol
 	GPS_PROTOCOL_NMEA = 0x10
+	GPS_PROTOCOL_UBX  = 0x20
 )
 
 var STRATUX_WWW_DIR = STRATUX_HOME + "/www/"
@@ -234,6 +235,13 @@ type ADSBTower struct {
 	Energy_last_minute          uint64  // Summation of power observed for this tower across all messages last minute
 	Signal_strength_last_minute float64 // Average RSSI (dB) observed for this tower last minute
 	Messages_last_minute        uint64
+	Messages_total              uint64
+	TISB_site_id                uint8
+	Slots_used                  []uint8 // Uplink slots this tower transmitted in during the last two minutes
+	First_seen                  time.Time
+	Last_seen                   time.Time
+	Products                    map[uint32]ADSBTowerProduct // FIS-B products received from this tower, by product id
+	slotsSeen                   map[uint8]time.Time
 }
 
 var ADSBTowers map[string]ADSBTower // Running list of all towers seen. (lat,lng) -> ADSBTower
@@ -387,7 +395,7 @@ func makeOwnshipReport() bool {
 		msg[12] = msg[12] | 0x09 // "Airborne" + "True Track"
 	}
 
-	msg[13] = byte(0x80 | (mySituation.GPSNACp & 0x0F)) //Set NIC = 8 and use NACp from gps.go.
+	msg[13] = byte(0x80 | (ownshipNACp() & 0x0F)) //Set NIC = 8 and use NACp from gps.go, degraded by the GNSS integrity monitor.
 
 	gdSpeed := uint16(0) // 1kt resolution.
 	if useReceivedOwnshipInfo && curOwnship.Speed_valid {
@@ -464,6 +472,11 @@ func makeOwnshipReport() bool {
 		msg[19+i] = myReg[i]
 	}
 
+	// Emergency/priority code 1, general emergency, after a crash.
+	if crashes.Emergency() {
+		msg[27] = 0x10
+	}
+
 	sendGDL90(prepareMessage(msg), time.Second, -1)
 	sendXPlane(createXPlaneGpsMsg(lat, lon, mySituation.GPSAltitudeMSL, groundTrack, float32(gdSpeed)), time.Second, -1)
 
@@ -753,6 +766,11 @@ func makeHeartbeat() []byte {
 	}
 	msg[1] = msg[1] | 0x10 //FIXME: Addr talkback.
 
+	// "RATCS". Ownship is listed as a client in the TIS-B/ADS-R service status uplinks.
+	if globalStatus.TISB_ownship_client {
+		msg[1] = msg[1] | 0x04
+	}
+
 	// "Maintenance Req'd". Add flag if there are any current critical system errors.
 	if len(globalStatus.Errors) > 0 {
 		msg[1] = msg[1] | 0x40
@@ -846,6 +864,7 @@ func heartBeatSender() {
 			if isTempPressValid() && mySituation.BaroSourceType != BARO_TYPE_NONE && mySituation.BaroSourceType != BARO_TYPE_ADSBESTIMATE {
 				sendNetFLARM(makePGRMZString(), time.Second, 0)
 			}
+			sendVarioNMEA() // The wind without a baro, the sensor loop sends it otherwise.
 			sendNetFLARM("$GPGSA,A,3,,,,,,,,,,,,,1.0,1.0,1.0*33\r\n", time.Second, 1)
 
 			// --- debug code: traffic demo ---
@@ -868,9 +887,15 @@ func heartBeatSender() {
 			// ---end traffic demo code ---
 			sendTrafficUpdates()
 			updateStatus()
+			updateGNSSIntegrity(stratuxClock.Time)
+			updateTimeSyncStatus()
+			updateFlightRecorder()
 		case <-timerMessageStats.C:
 			// Save a bit of CPU by not pruning the message log every 1 second.
 			updateMessageStats()
+			updateTowerHealth(stratuxClock.Time)
+			updateInterferenceMap(stratuxClock.Time)
+			updateThermals(stratuxClock.Time)
 		}
 	}
 }
@@ -1054,6 +1079,13 @@ func registerADSBTextMessageReceived(msg string, uatMsg *uatparse.UATMsg) {
 	wm.Data = strings.Join(x[3:], " ")
 	wm.LocaltimeReceived = stratuxClock.Time
 
+	// Keep the latest report per station for clients that connect later.
+	if uatMsg != nil {
+		registerWeatherReport(wm, uatMsg.Lat, uatMsg.Lon, true)
+	} else {
+		registerWeatherReport(wm, 0, 0, false)
+	}
+
 	// Send to weatherUpdate channel for any connected clients.
 	weatherUpdate.SendJSON(wm)
 }
@@ -1169,10 +1201,19 @@ func parseInput(buf string) ([]byte, uint16) {
 			uatMsg.DecodeUplink()
 			towerid := fmt.Sprintf("(%f,%f)", uatMsg.Lat, uatMsg.Lon)
 			thisMsg.ADSBTowerID = towerid
+			registerTowerUplink(towerid, uatMsg, thisMsg.Signal_strength)
 			// Get all of the "product ids".
 			for _, f := range uatMsg.Frames {
+				if f.Frame_type == uatparse.INFO_FRAME_TYPE_SERVICE_STATUS {
+					registerTISBServiceStatus(f.ServiceStatus)
+					continue
+				}
 				thisMsg.Products = append(thisMsg.Products, f.Product_id)
 				UpdateUATStats(f.Product_id)
+				registerNEXRADReceived(f.Product_id)
+				if len(f.Points) > 0 {
+					registerWeatherOverlay(f)
+				}
 				weatherRawUpdate.SendJSON(f)
 			}
 			// Get all of the text reports.
@@ -1225,9 +1266,10 @@ type settings struct {
 	AHRSLog              bool
 	PersistentLogging    bool
 	ClearLogOnStart      bool
-	IMUMapping           [2]int     // Map from aircraft axis to sensor axis: accelerometer
-	SensorQuaternion     [4]float64 // Quaternion mapping from sensor frame to aircraft frame
-	C, D                 [3]float64 // IMU Accel, Gyro zero bias
+	IMUMapping           [2]int         // Map from aircraft axis to sensor axis: accelerometer
+	SensorQuaternion     [4]float64     // Quaternion mapping from sensor frame to aircraft frame
+	C, D                 [3]float64     // IMU Accel, Gyro zero bias
+	MagCalibration       MagCalibration // Magnetometer hard/soft iron calibration, zero if not calibrated
 	PPM                  int
 	Dump1090Gain         float64 // SDR RTL ES Gain
 	AltitudeOffset       int
@@ -1235,6 +1277,15 @@ type settings struct {
 	WatchList            string
 	DeveloperMode        bool
 	GLimits              string
+	AHRSFilter           string // Attitude estimator, see ahrsFilterName. Empty picks one for the IMU.
+	ExceedanceLimits     ExceedanceLimits
+	VarioLXWP0           bool // Vario sentences on FLARM NMEA connections, see vario.go
+	VarioPOV             bool
+	VarioLK8EX1          bool
+	WindTAS              int     // kts, true airspeed for the straight flight wind estimate, 0 to use the one found while circling
+	ThermalNMEA          bool    // Thermals from OGN/FLARM traffic as $GPWPL waypoints, see thermal.go
+	AltimeterSetting     float64 // hPa, 0 to take it from the nearest METAR, see altimeter.go
+	CrashDetection       bool    // Emergency code to EFBs after an impact and the countdown, see crash.go
 	StaticIps            []string
 	WiFiCountry          string
 	WiFiSSID             string
@@ -1270,6 +1321,7 @@ type settings struct {
 	GpsManualDevice     string // default: /dev/ttyAMA0
 	GpsManualChip       string // ublox8, ublox9, ublox
 	GpsManualTargetBaud int    // default: 115200
+	GPS_UBX_Binary      bool   // u-blox: use binary UBX NAV messages instead of NMEA for position, velocity and satellites
 	RegionSelected      int    // 0 - none, 1 = US, 2 = EU
 }
 
@@ -1307,7 +1359,12 @@ type status struct {
 	GPS_connected                  bool
 	GPS_solution                   string
 	GPS_detected_type              uint
-	GPS_NetworkRemoteIp            string // for NMEA via TCP from OGN tracker: display remote IP to configure the OGN tracker
+	GPS_NetworkRemoteIp            string   // for NMEA via TCP from OGN tracker: display remote IP to configure the OGN tracker
+	GPS_source                     string   // active GNSS position source, see gnss_sources.go
+	GPS_integrity_alerts           []string // active GNSS jamming/spoofing alerts, see gnss_integrity.go
+	Time_source                    string   // "GPS+PPS", "GPS" or "" if the clock isn't disciplined by GPS, see timesync.go
+	Time_service                   string   // NTP daemon fed with GPS time ("chrony", "ntpd") or "" if we set the clock ourselves
+	Time_offset_ms                 float64  // GPS time minus system time
 	Uptime                         int64
 	UptimeClock                    time.Time
 	CPUTemp                        float32
@@ -1324,7 +1381,12 @@ type status struct {
 	UAT_PIREP_total                uint32
 	UAT_NOTAM_total                uint32
 	UAT_OTHER_total                uint32
+	FISB_last_uplink_age           int64 // Seconds since the last FIS-B uplink was received, -1 if none yet
+	TISB_service                   bool  // TIS-B/ADS-R targets are being received for the ownship
+	TISB_ownship_client            bool  // Ownship address is listed in the TIS-B/ADS-R service status uplinks
 	Errors                         []string
+	CrashState                     string // CRASH_STATE_*, see crash.go
+	CrashCountdown                 int    // Seconds until the emergency
 	Logfile_Size                   int64
 	AHRS_LogFiles_Size             int64
 	BMPConnected                   bool
@@ -1393,6 +1455,7 @@ func defaultSettings() {
 	globalSettings.RadarLimits = 2000
 	globalSettings.RadarRange = 10
 	globalSettings.AltitudeOffset = 0
+	globalSettings.ExceedanceLimits = defaultExceedanceLimits
 
 	globalSettings.PWMDutyMin = 0
 
@@ -1462,6 +1525,25 @@ func addSingleSystemErrorf(ident string, format string, a ...interface{}) {
 	systemErrsMutex.Unlock()
 }
 
+// Like addSingleSystemErrorf, but replaces the message text if the error has already been thrown.
+func updateSingleSystemErrorf(ident string, format string, a ...interface{}) {
+	systemErrsMutex.Lock()
+	msg := fmt.Sprintf(format, a...)
+	if oldMsg, ok := systemErrs[ident]; ok {
+		for i, v := range globalStatus.Errors {
+			if v == oldMsg {
+				globalStatus.Errors[i] = msg
+				break
+			}
+		}
+	} else {
+		globalStatus.Errors = append(globalStatus.Errors, msg)
+		log.Printf("Added critical system error: %s\n", msg)
+	}
+	systemErrs[ident] = msg
+	systemErrsMutex.Unlock()
+}
+
 func overlayctl(cmd string) {
 	out, err := exec.Command("/bin/sh", "/sbin/overlayctl", cmd).Output()
 	if err != nil {
@@ -1656,6 +1738,12 @@ func gracefulShutdown() {
 		closeDataLog()
 	}
 
+	// Keep the current weather for the next start.
+	saveTowerHistory()
+	if weatherReports != nil {
+		weatherReports.Save(stratuxClock.Time, weatherRealTime())
+	}
+
 	pprof.StopCPUProfile()
 
 	//TODO: Any other graceful shutdown functions.
@@ -1729,6 +1817,7 @@ func main() {
 
 	globalStatus.Build = stratuxBuild
 	globalStatus.Errors = make([]string, 0)
+	globalStatus.FISB_last_uplink_age = -1
 	//FlightBox: detect via presence of /etc/FlightBox file.
 	if _, err := os.Stat("/etc/FlightBox"); !os.IsNotExist(err) {
 		globalStatus.HardwareBuild = "FlightBox"
@@ -1753,6 +1842,8 @@ func main() {
 	traceReplaySpeed := flag.Float64("traceSpeed", 1.0, "Trace replay speed multiplier")
 	traceReplayFilter := flag.String("traceFilter", "", "Filter trace data by context. Comma separated list of: ais,nmea,aprs,ogn-rx,dump1090,godump978,lowpower_uat")
 	traceSkip := flag.Int64("traceSkip", 0, "Minutes to skip forward in recorded trace")
+	simRoute := flag.String("sim", "", "Simulate ownship, attitude and scripted traffic along a route file (JSON or GPX), for bench testing without GPS")
+	flightSimPort := flag.Int("flightsim", 0, "Take ownship, attitude and traffic from X-Plane or FlightGear UDP packets on this port, for sim training")
 	ManagementAddrTmp := flag.Int("port", defaultManagementAddr, "Specify the port to use")
 
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
@@ -1796,6 +1887,15 @@ func main() {
 	ADSBTowerMutex = &sync.Mutex{}
 	msgLog = make([]msg, 0)
 
+	// Restore the weather received before the last shutdown.
+	initWeatherStore(filepath.Join(logDirf, weatherStoreFile))
+	initTowerHistory(filepath.Join(logDirf, towerHistoryFile))
+	initFlightRecorder(filepath.Join(logDirf, flightsDir))
+	initExceedanceMonitor(filepath.Join(logDirf, exceedanceFile))
+	initWindEstimator()
+	initAltimeter()
+	initCrashDetector(filepath.Join(logDirf, crashFile))
+
 	// Start the management interface.
 	go managementInterface()
 	go traceLoggerWatchdog()
@@ -1824,8 +1924,21 @@ func main() {
 		//FIXME: Only do this if data logging is enabled.
 		initDataLog()
 
-		// Start the AHRS sensor monitoring.
-		initI2CSensors()
+		// Start the AHRS sensor monitoring. The simulator and flight simulator input replace the sensors.
+		if *simRoute != "" {
+			if err := initSimulator(*simRoute); err != nil {
+				log.Fatalf("Can't start simulator with route %s: %s\n", *simRoute, err.Error())
+			}
+		} else if *flightSimPort != 0 {
+			if err := initFlightSimInput(*flightSimPort); err != nil {
+				log.Fatalf("Can't start flight simulator input on port %d: %s\n", *flightSimPort, err.Error())
+			}
+		} else {
+			initI2CSensors()
+			// Feed GPS time (and PPS) to chrony/ntpd, if running. Not with a simulator: its GPS time is the system
+			// clock, which chrony would then serve as stratum 1 to the Wi-Fi clients.
+			initTimeSync()
+		}
 	}
 
 	// Start the GPS external sensor monitoring.
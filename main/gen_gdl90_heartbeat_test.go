@@ -294,3 +294,33 @@ func TestMakeFFIDMessageShortNames(t *testing.T) {
 
 	t.Logf("makeFFIDMessage() with short strings generated %d-byte message", len(msg))
 }
+
+// TestMakeHeartbeatRATCS tests that the RATCS bit reflects TIS-B client status of the ownship
+func TestMakeHeartbeatRATCS(t *testing.T) {
+	crcInit()
+	if stratuxClock == nil {
+		stratuxClock = NewMonotonic()
+	}
+
+	origStatus := globalStatus
+	defer func() { globalStatus = origStatus }()
+	globalStatus.Errors = nil
+
+	tests := []struct {
+		name   string
+		client bool
+	}{
+		{"Not a TIS-B client", false},
+		{"TIS-B client", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globalStatus.TISB_ownship_client = tt.client
+			msg := makeHeartbeat()
+			// msg[0] is the flag byte, msg[1] the message id.
+			if got := msg[2]&0x04 != 0; got != tt.client {
+				t.Errorf("RATCS bit = %v, want %v (status byte 0x%02X)", got, tt.client, msg[2])
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	gnss_integrity.go: GNSS integrity monitor. Cross-checks the GNSS solution against its own recent track,
+	 the AHRS, the baro altitude and the satellite signal strengths to detect jamming and spoofing.
+*/
+
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	GNSS_ALERT_JAMMING       = "jamming"             // Sudden, uniform C/N0 drop.
+	GNSS_ALERT_POSITION_JUMP = "position-jump"       // Position inconsistent with the previous position and velocity.
+	GNSS_ALERT_VELOCITY_JUMP = "velocity-jump"       // Ground speed or track change no aircraft can do, or that the AHRS didn't see.
+	GNSS_ALERT_ALTITUDE      = "altitude-divergence" // GNSS altitude departed from the baro altitude trend.
+	GNSS_ALERT_TIME_JUMP     = "time-jump"           // GNSS time doesn't advance with the local clock.
+	GNSS_ALERT_UNIFORM       = "uniform-signals"     // All satellites received with the same strength: typical for a spoofer.
+	GNSS_ALERT_RAIM          = "receiver-integrity"  // The receiver's own integrity monitoring (RAIM, NMEA navigational status) flagged the solution.
+
+	gnssAlertHoldTime = 30 * time.Second // Alerts stay active this long after the last detection.
+
+	gnssJammingMinSats        = 4
+	gnssJammingMeanDropDb     = 8.0  // Average C/N0 drop vs. the per-satellite baseline.
+	gnssJammingSatDropDb      = 5.0  // A satellite counts as "dropped" below baseline minus this.
+	gnssJammingDroppedRatio   = 0.8  // ... and this fraction of satellites must have dropped.
+	gnssSignalBaselineAlpha   = 0.05 // Per-sample EMA weight of the C/N0 baselines (~20 s at 1 Hz).
+	gnssSignalBaselineSamples = 10   // Samples before a satellite's baseline is trusted.
+	gnssSignalLostTimeout     = 10 * time.Second
+
+	gnssUniformMinSats    = 6
+	gnssUniformMaxStdevDb = 1.5
+
+	gnssJumpMinMeters     = 250.0 // Position error allowance, plus twice the reported accuracy.
+	gnssJumpMaxAccuracy   = 1000.0
+	gnssJumpMetersPerSec  = 25.0 // ... plus this per second between fixes, for acceleration.
+	gnssMaxAccelKtsPerSec = 20.0 // ~1 g
+	gnssMaxTurnRate       = 30.0 // deg/s without AHRS.
+	gnssAHRSTurnTolerance = 20.0 // deg, plus 10 deg per second, between GNSS track change and AHRS turn.
+	gnssTrackMinSpeed     = 30.0 // kts, below this the track is too noisy to check.
+	gnssMaxSampleGap      = 5 * time.Second
+
+	gnssAltitudeMaxDivergence = 400.0 // ft
+	gnssAltitudeBaselineAlpha = 1.0 / 60
+	gnssAltitudeMinSamples    = 30
+
+	gnssTimeJumpTolerance = 2 * time.Second
+)
+
+// gnssIntegritySample is a snapshot of everything the integrity checks look at, taken once per second.
+type gnssIntegritySample struct {
+	fixValid     bool
+	fixTime      time.Time // stratuxClock time of the position fix.
+	lat, lon     float64
+	groundSpeed  float64 // kts
+	track        float64 // deg true
+	altitude     float64 // ft MSL
+	accuracy     float64 // m, 95%
+	baroValid    bool
+	baroAltitude float64 // ft
+	ahrsValid    bool
+	ahrsTurnRate float64 // deg/s
+	gpsTime      time.Time
+	gpsTimeLocal time.Time          // stratuxClock time gpsTime was received.
+	signals      map[string]float64 // C/N0 in dB-Hz of the satellites currently received.
+}
+
+type gnssSignalBaseline struct {
+	cn0      float64
+	samples  int
+	lastSeen time.Time
+}
+
+type gnssIntegrityMonitor struct {
+	mu             sync.Mutex
+	last           *gnssIntegritySample
+	baselines      map[string]*gnssSignalBaseline
+	altOffset      float64 // EMA of GNSS minus baro altitude, ft.
+	altOffsetCount int
+	lastDetected   map[string]time.Time
+}
+
+var gnssIntegrity = newGNSSIntegrityMonitor()
+
+func newGNSSIntegrityMonitor() *gnssIntegrityMonitor {
+	return &gnssIntegrityMonitor{
+		baselines:    make(map[string]*gnssSignalBaseline),
+		lastDetected: make(map[string]time.Time),
+	}
+}
+
+func (m *gnssIntegrityMonitor) detect(alert string, now time.Time, format string, a ...interface{}) {
+	if !m.activeAt(alert, now) {
+		log.Printf("GNSS integrity: "+alert+": "+format+"\n", a...)
+	}
+	m.lastDetected[alert] = now
+}
+
+// report records an alert detected outside the periodic checks, e.g. by the receiver itself.
+func (m *gnssIntegrityMonitor) report(alert string, now time.Time, format string, a ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detect(alert, now, format, a...)
+}
+
+func (m *gnssIntegrityMonitor) activeAt(alert string, now time.Time) bool {
+	t, ok := m.lastDetected[alert]
+	return ok && now.Sub(t) < gnssAlertHoldTime
+}
+
+// update runs all checks on a new sample.
+func (m *gnssIntegrityMonitor) update(s gnssIntegritySample, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkSignals(s, now)
+	m.checkAltitude(s, now)
+	if m.last != nil {
+		m.checkMotion(*m.last, s, now)
+		m.checkTime(*m.last, s, now)
+	}
+	if s.fixValid {
+		m.last = &s
+	} else if m.last != nil && now.Sub(m.last.fixTime) > gnssMaxSampleGap {
+		m.last = nil
+	}
+}
+
+// checkSignals looks for a sudden drop of all C/N0 values (jamming) and for suspiciously uniform C/N0 (spoofing).
+func (m *gnssIntegrityMonitor) checkSignals(s gnssIntegritySample, now time.Time) {
+	var sumDrop float64
+	var n, dropped int
+	for id, b := range m.baselines {
+		if b.samples < gnssSignalBaselineSamples {
+			continue
+		}
+		cn0, ok := s.signals[id]
+		if !ok {
+			if now.Sub(b.lastSeen) > gnssSignalLostTimeout {
+				continue // Satellite set or was lost long ago.
+			}
+			cn0 = 0
+		}
+		drop := b.cn0 - cn0
+		sumDrop += drop
+		n++
+		if drop >= gnssJammingSatDropDb {
+			dropped++
+		}
+	}
+	jammed := n >= gnssJammingMinSats && sumDrop/float64(n) >= gnssJammingMeanDropDb && float64(dropped) >= gnssJammingDroppedRatio*float64(n)
+	if jammed {
+		m.detect(GNSS_ALERT_JAMMING, now, "C/N0 dropped by %.1f dB on average, %d of %d satellites affected", sumDrop/float64(n), dropped, n)
+	}
+
+	// Only learn the baselines from an undisturbed sky.
+	if !jammed && !m.activeAt(GNSS_ALERT_JAMMING, now) {
+		for id, cn0 := range s.signals {
+			b, ok := m.baselines[id]
+			if !ok {
+				b = &gnssSignalBaseline{cn0: cn0}
+				m.baselines[id] = b
+			}
+			b.cn0 += gnssSignalBaselineAlpha * (cn0 - b.cn0)
+			b.samples++
+			b.lastSeen = now
+		}
+		for id, b := range m.baselines {
+			if now.Sub(b.lastSeen) > 6*gnssSignalLostTimeout {
+				delete(m.baselines, id)
+			}
+		}
+	}
+
+	if len(s.signals) >= gnssUniformMinSats {
+		cn0s := make([]float64, 0, len(s.signals))
+		for _, cn0 := range s.signals {
+			cn0s = append(cn0s, cn0)
+		}
+		if stdev, ok := common.Stdev(cn0s); ok && stdev < gnssUniformMaxStdevDb {
+			mean, _ := common.Mean(cn0s)
+			m.detect(GNSS_ALERT_UNIFORM, now, "%d satellites at %.1f dB-Hz with only %.1f dB spread", len(cn0s), mean, stdev)
+		}
+	}
+}
+
+// trackDiff returns the change from track a to b in degrees, -180..180.
+func trackDiff(a, b float64) float64 {
+	return common.DegreesRel(common.Radians(b - a))
+}
+
+// checkMotion compares the new fix with the position, speed and track predicted from the previous one.
+func (m *gnssIntegrityMonitor) checkMotion(prev, s gnssIntegritySample, now time.Time) {
+	if !prev.fixValid || !s.fixValid {
+		return
+	}
+	dt := s.fixTime.Sub(prev.fixTime).Seconds()
+	if dt <= 0 || dt > gnssMaxSampleGap.Seconds() {
+		return
+	}
+
+	speedMs := (prev.groundSpeed + s.groundSpeed) / 2 * 0.514444
+	track := common.Radians(prev.track + trackDiff(prev.track, s.track)/2)
+	_, _, distN, distE := common.DistRect(prev.lat, prev.lon, s.lat, s.lon)
+	errN := distN - speedMs*dt*math.Cos(track)
+	errE := distE - speedMs*dt*math.Sin(track)
+	posErr := math.Sqrt(errN*errN + errE*errE)
+	allowed := gnssJumpMinMeters + 2*math.Min(s.accuracy, gnssJumpMaxAccuracy) + gnssJumpMetersPerSec*dt
+	if posErr > allowed {
+		m.detect(GNSS_ALERT_POSITION_JUMP, now, "position %.0f m off the predicted track in %.1f s", posErr, dt)
+	}
+
+	if accel := math.Abs(s.groundSpeed-prev.groundSpeed) / dt; accel > gnssMaxAccelKtsPerSec {
+		m.detect(GNSS_ALERT_VELOCITY_JUMP, now, "ground speed changed from %.0f to %.0f kts in %.1f s", prev.groundSpeed, s.groundSpeed, dt)
+	} else if prev.groundSpeed >= gnssTrackMinSpeed && s.groundSpeed >= gnssTrackMinSpeed {
+		trackChange := trackDiff(prev.track, s.track)
+		if s.ahrsValid {
+			if diff := math.Abs(trackChange - s.ahrsTurnRate*dt); diff > gnssAHRSTurnTolerance+10*dt {
+				m.detect(GNSS_ALERT_VELOCITY_JUMP, now, "track changed by %.0f deg in %.1f s, AHRS turn rate %.1f deg/s", trackChange, dt, s.ahrsTurnRate)
+			}
+		} else if math.Abs(trackChange)/dt > gnssMaxTurnRate {
+			m.detect(GNSS_ALERT_VELOCITY_JUMP, now, "track changed by %.0f deg in %.1f s", trackChange, dt)
+		}
+	}
+}
+
+// checkAltitude follows the GNSS-baro altitude offset, which only changes slowly with the weather,
+// and flags a GNSS altitude that departs from it.
+func (m *gnssIntegrityMonitor) checkAltitude(s gnssIntegritySample, now time.Time) {
+	if !s.fixValid || !s.baroValid {
+		return
+	}
+	offset := s.altitude - s.baroAltitude
+	if m.altOffsetCount == 0 {
+		m.altOffset = offset
+	}
+	if m.altOffsetCount >= gnssAltitudeMinSamples {
+		if diff := offset - m.altOffset; math.Abs(diff) > gnssAltitudeMaxDivergence {
+			m.detect(GNSS_ALERT_ALTITUDE, now, "GNSS altitude %.0f ft off the baro altitude trend", diff)
+			return // Don't learn the disturbed offset.
+		}
+	}
+	m.altOffset += gnssAltitudeBaselineAlpha * (offset - m.altOffset)
+	m.altOffsetCount++
+}
+
+// checkTime expects the GNSS time to advance like the local clock.
+func (m *gnssIntegrityMonitor) checkTime(prev, s gnssIntegritySample, now time.Time) {
+	if prev.gpsTime.IsZero() || s.gpsTime.IsZero() || !s.gpsTimeLocal.After(prev.gpsTimeLocal) {
+		return
+	}
+	expected := prev.gpsTime.Add(s.gpsTimeLocal.Sub(prev.gpsTimeLocal))
+	if diff := s.gpsTime.Sub(expected); diff > gnssTimeJumpTolerance || diff < -gnssTimeJumpTolerance {
+		m.detect(GNSS_ALERT_TIME_JUMP, now, "GNSS time jumped by %v", diff)
+	}
+}
+
+// alerts returns the active alerts, sorted.
+func (m *gnssIntegrityMonitor) alerts(now time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]string, 0)
+	for alert := range m.lastDetected {
+		if m.activeAt(alert, now) {
+			ret = append(ret, alert)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// degradeNACp lowers the NACp we advertise while integrity alerts are active: position-related alerts
+// mean the position can't be trusted at all, jamming alone reduces the accuracy category by two.
+func degradeNACp(nacp uint8, alerts []string) uint8 {
+	for _, alert := range alerts {
+		if alert != GNSS_ALERT_JAMMING {
+			return 0
+		}
+	}
+	if len(alerts) > 0 {
+		if nacp <= 2 {
+			return 0
+		}
+		return nacp - 2
+	}
+	return nacp
+}
+
+// ownshipNACp is the NACp for the ownship report.
+func ownshipNACp() uint8 {
+	return degradeNACp(mySituation.GPSNACp, globalStatus.GPS_integrity_alerts)
+}
+
+func sampleGNSSIntegrity() gnssIntegritySample {
+	var s gnssIntegritySample
+	mySituation.muGPS.Lock()
+	s.fixValid = isGPSValid()
+	s.fixTime = mySituation.GPSLastFixLocalTime
+	s.lat = float64(mySituation.GPSLatitude)
+	s.lon = float64(mySituation.GPSLongitude)
+	s.groundSpeed = mySituation.GPSGroundSpeed
+	s.track = float64(mySituation.GPSTrueCourse)
+	s.altitude = float64(mySituation.GPSAltitudeMSL)
+	s.accuracy = float64(mySituation.GPSHorizontalAccuracy)
+	s.gpsTime = mySituation.GPSTime
+	s.gpsTimeLocal = mySituation.GPSLastGPSTimeStratuxTime
+	mySituation.muGPS.Unlock()
+
+	// The ADS-B estimate is derived from GNSS altitude, useless for cross-checking.
+	s.baroValid = isTempPressValid() && mySituation.BaroSourceType != BARO_TYPE_NONE && mySituation.BaroSourceType != BARO_TYPE_ADSBESTIMATE
+	s.baroAltitude = float64(mySituation.BaroPressureAltitude)
+	s.ahrsValid = isAHRSValid() && globalStatus.IMUConnected && math.Abs(mySituation.AHRSTurnRate) < 360
+	s.ahrsTurnRate = mySituation.AHRSTurnRate
+
+	s.signals = make(map[string]float64)
+	mySituation.muSatellite.Lock()
+	for id, sat := range Satellites {
+		if sat.Signal > 0 && stratuxClock.Since(sat.TimeLastSeen) < gnssSignalLostTimeout {
+			s.signals[id] = float64(sat.Signal)
+		}
+	}
+	mySituation.muSatellite.Unlock()
+	return s
+}
+
+// updateGNSSIntegrity samples the GNSS state, runs the checks and publishes the result.
+func updateGNSSIntegrity(now time.Time) {
+	if !globalSettings.GPS_Enabled {
+		return
+	}
+	gnssIntegrity.update(sampleGNSSIntegrity(), now)
+	alerts := gnssIntegrity.alerts(now)
+	globalStatus.GPS_integrity_alerts = alerts
+	if len(alerts) > 0 {
+		updateSingleSystemErrorf("gnss-integrity", "GNSS interference suspected (%s). Position may be unreliable, NACp reduced.", strings.Join(alerts, ", "))
+	} else {
+		removeSingleSystemError("gnss-integrity")
+	}
+}
@@ -0,0 +1,163 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	gnss_integrity_test.go: Unit tests for the GNSS jamming/spoofing monitor.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testGNSSSignals = map[string]float64{"G1": 44, "G5": 38, "G12": 31, "G17": 47, "R3": 35, "R9": 41, "E4": 29, "E11": 43}
+
+// makeTestIntegritySample returns the state after i seconds of straight flight north at 100 kts and 5000 ft.
+func makeTestIntegritySample(start time.Time, i int) gnssIntegritySample {
+	lat, lon := calcLocationForBearingDistance(47, -122, 0, 100*float64(i)/3600)
+	signals := make(map[string]float64)
+	for id, cn0 := range testGNSSSignals {
+		signals[id] = cn0 + float64(i%3)*0.5 // A little noise.
+	}
+	t := start.Add(time.Duration(i) * time.Second)
+	return gnssIntegritySample{
+		fixValid:     true,
+		fixTime:      t,
+		lat:          lat,
+		lon:          lon,
+		groundSpeed:  100,
+		track:        0,
+		altitude:     5000,
+		accuracy:     5,
+		baroValid:    true,
+		baroAltitude: 4850 + float64(i%5),
+		ahrsValid:    false,
+		gpsTime:      time.Date(2025, 6, 1, 12, 0, i, 0, time.UTC),
+		gpsTimeLocal: t,
+		signals:      signals,
+	}
+}
+
+func TestGNSSIntegrityChecks(t *testing.T) {
+	const disturbAt = 40
+	tests := []struct {
+		name    string
+		disturb func(i int, s *gnssIntegritySample)
+		want    []string
+	}{
+		{"Nominal", func(i int, s *gnssIntegritySample) {}, []string{}},
+		{"Jamming", func(i int, s *gnssIntegritySample) {
+			for id := range s.signals {
+				s.signals[id] -= 15
+			}
+			delete(s.signals, "E4")
+		}, []string{GNSS_ALERT_JAMMING}},
+		{"Setting satellite", func(i int, s *gnssIntegritySample) {
+			s.signals["E4"] -= 12
+		}, []string{}},
+		{"Uniform signals", func(i int, s *gnssIntegritySample) {
+			for id := range s.signals {
+				s.signals[id] = 45 + float64(len(id)%2)*0.3
+			}
+		}, []string{GNSS_ALERT_UNIFORM}},
+		{"Position jump", func(i int, s *gnssIntegritySample) {
+			s.lat += 0.05 * float64(i-disturbAt+1)
+		}, []string{GNSS_ALERT_POSITION_JUMP}},
+		{"Speed jump", func(i int, s *gnssIntegritySample) {
+			if i == disturbAt {
+				s.groundSpeed = 160
+			}
+		}, []string{GNSS_ALERT_VELOCITY_JUMP}},
+		{"Track jump", func(i int, s *gnssIntegritySample) {
+			if i == disturbAt {
+				s.track = 90
+			}
+		}, []string{GNSS_ALERT_VELOCITY_JUMP}},
+		{"Turn seen by AHRS", func(i int, s *gnssIntegritySample) {
+			s.ahrsValid = true
+			s.ahrsTurnRate = 3
+			s.track = float64(3 * (i - disturbAt + 1))
+		}, []string{}},
+		{"Turn not seen by AHRS", func(i int, s *gnssIntegritySample) {
+			s.ahrsValid = true
+			s.ahrsTurnRate = 0
+			s.track = float64(45 * (i - disturbAt + 1))
+		}, []string{GNSS_ALERT_VELOCITY_JUMP}},
+		{"Altitude divergence", func(i int, s *gnssIntegritySample) {
+			s.altitude += 1000
+		}, []string{GNSS_ALERT_ALTITUDE}},
+		{"Time jump", func(i int, s *gnssIntegritySample) {
+			s.gpsTime = s.gpsTime.Add(-time.Hour)
+		}, []string{GNSS_ALERT_TIME_JUMP}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+			m := newGNSSIntegrityMonitor()
+			var now time.Time
+			for i := 0; i < disturbAt+5; i++ {
+				s := makeTestIntegritySample(start, i)
+				if i >= disturbAt {
+					tt.disturb(i, &s)
+				}
+				now = s.fixTime
+				m.update(s, now)
+				if i == disturbAt-1 {
+					if got := m.alerts(now); len(got) != 0 {
+						t.Fatalf("alerts before disturbance: %v", got)
+					}
+				}
+			}
+			if got := m.alerts(now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("alerts = %v, want %v", got, tt.want)
+			}
+			// Alerts expire after the hold time.
+			if got := m.alerts(now.Add(gnssAlertHoldTime)); len(got) != 0 {
+				t.Errorf("alerts after hold time = %v", got)
+			}
+		})
+	}
+}
+
+func TestGNSSIntegrityFixLoss(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newGNSSIntegrityMonitor()
+	for i := 0; i < 10; i++ {
+		m.update(makeTestIntegritySample(start, i), start.Add(time.Duration(i)*time.Second))
+	}
+	// No fix for a minute, then the fix comes back far away: not a jump.
+	for i := 10; i < 70; i++ {
+		s := makeTestIntegritySample(start, 9)
+		s.fixValid = false
+		m.update(s, start.Add(time.Duration(i)*time.Second))
+	}
+	s := makeTestIntegritySample(start, 70)
+	s.lat += 1
+	m.update(s, s.fixTime)
+	if got := m.alerts(s.fixTime); len(got) != 0 {
+		t.Errorf("alerts = %v", got)
+	}
+}
+
+func TestDegradeNACp(t *testing.T) {
+	tests := []struct {
+		nacp   uint8
+		alerts []string
+		want   uint8
+	}{
+		{10, nil, 10},
+		{10, []string{GNSS_ALERT_JAMMING}, 8},
+		{1, []string{GNSS_ALERT_JAMMING}, 0},
+		{10, []string{GNSS_ALERT_POSITION_JUMP}, 0},
+		{10, []string{GNSS_ALERT_JAMMING, GNSS_ALERT_UNIFORM}, 0},
+	}
+	for _, tt := range tests {
+		if got := degradeNACp(tt.nacp, tt.alerts); got != tt.want {
+			t.Errorf("degradeNACp(%d, %v) = %d, want %d", tt.nacp, tt.alerts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	gnss_interference.go: Crowd-sourced GNSS interference map. Aggregates the NACp that received ADS-B
+	 targets report per grid cell: where many aircraft degrade at once, GNSS is being jammed.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	interferenceCellSize      = 0.5              // Grid cell size in degrees latitude and longitude.
+	interferenceWindow        = 15 * time.Minute // Aircraft are counted in a cell for this long after their last report there.
+	interferenceCapableWindow = time.Hour        // Aircraft must have reported a good NACp within this time to be counted.
+	interferenceGoodNACp      = 8                // EPU < 30 m. Below that, an aircraft counts as degraded.
+	interferenceMinAircraft   = 3
+	interferenceMediumRatio   = 0.02
+	interferenceHighRatio     = 0.10
+	interferenceAlertDegraded = 2  // Alert for cells with a high level and at least this many degraded aircraft...
+	interferenceAlertRadiusNM = 20 // ... that are this close.
+
+	INTERFERENCE_LEVEL_LOW    = "low"
+	INTERFERENCE_LEVEL_MEDIUM = "medium"
+	INTERFERENCE_LEVEL_HIGH   = "high"
+)
+
+type interferenceCellKey struct {
+	lat, lon int // Cell index: floor(degrees / interferenceCellSize)
+}
+
+type interferenceAircraft struct {
+	lastSeen     time.Time
+	lastDegraded time.Time
+	nacp         int // Lowest NACp reported in this cell within the window.
+}
+
+type interferenceCell struct {
+	aircraft map[uint32]*interferenceAircraft
+}
+
+// InterferenceCell is the state of one grid cell as returned by /api/interference.
+type InterferenceCell struct {
+	Lat_min     float64
+	Lon_min     float64
+	Lat_max     float64
+	Lon_max     float64
+	Aircraft    int     // Aircraft with a GNSS capable of NACp >= 8, seen in the cell within the window.
+	Degraded    int     // Of those, aircraft that reported a lower NACp in the cell.
+	Ratio       float64 // Degraded / Aircraft
+	Level       string  // low, medium, high
+	Min_NACp    int
+	Distance_nm float64 // From ownship to the nearest point of the cell, 0 inside, -1 if our position is invalid.
+}
+
+type interferenceMap struct {
+	mu      sync.Mutex
+	cells   map[interferenceCellKey]*interferenceCell
+	capable map[uint32]time.Time // ICAO address -> time of the last report with a good NACp.
+}
+
+var gnssInterference = newInterferenceMap()
+
+func newInterferenceMap() *interferenceMap {
+	return &interferenceMap{
+		cells:   make(map[interferenceCellKey]*interferenceCell),
+		capable: make(map[uint32]time.Time),
+	}
+}
+
+func interferenceKey(lat, lon float64) interferenceCellKey {
+	return interferenceCellKey{int(math.Floor(lat / interferenceCellSize)), int(math.Floor(lon / interferenceCellSize))}
+}
+
+// interferenceLevel classifies the fraction of degraded aircraft, like the public GPS jamming maps do.
+func interferenceLevel(aircraft, degraded int) string {
+	if aircraft < interferenceMinAircraft {
+		return INTERFERENCE_LEVEL_LOW
+	}
+	ratio := float64(degraded) / float64(aircraft)
+	if ratio > interferenceHighRatio {
+		return INTERFERENCE_LEVEL_HIGH
+	} else if ratio >= interferenceMediumRatio {
+		return INTERFERENCE_LEVEL_MEDIUM
+	}
+	return INTERFERENCE_LEVEL_LOW
+}
+
+// Add records a position report. Aircraft that never report a good NACp (no or an old GNSS) are ignored,
+// as they would show up as degraded everywhere.
+func (m *interferenceMap) Add(icao uint32, lat, lon float64, nacp int, now time.Time) {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 || (lat == 0 && lon == 0) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	degraded := nacp < interferenceGoodNACp
+	if !degraded {
+		m.capable[icao] = now
+	} else if t, ok := m.capable[icao]; !ok || now.Sub(t) > interferenceCapableWindow {
+		return
+	}
+	key := interferenceKey(lat, lon)
+	cell, ok := m.cells[key]
+	if !ok {
+		cell = &interferenceCell{aircraft: make(map[uint32]*interferenceAircraft)}
+		m.cells[key] = cell
+	}
+	a, ok := cell.aircraft[icao]
+	if !ok || now.Sub(a.lastSeen) > interferenceWindow {
+		a = &interferenceAircraft{nacp: nacp}
+		cell.aircraft[icao] = a
+	}
+	a.lastSeen = now
+	if !a.lastDegraded.IsZero() && now.Sub(a.lastDegraded) > interferenceWindow {
+		// Recovered long ago.
+		a.lastDegraded = time.Time{}
+		a.nacp = nacp
+	}
+	if nacp < a.nacp {
+		a.nacp = nacp
+	}
+	if degraded {
+		a.lastDegraded = now
+	}
+}
+
+// Prune drops aircraft that left the window, empty cells and stale capability records.
+func (m *interferenceMap) Prune(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, cell := range m.cells {
+		for icao, a := range cell.aircraft {
+			if now.Sub(a.lastSeen) > interferenceWindow {
+				delete(cell.aircraft, icao)
+			}
+		}
+		if len(cell.aircraft) == 0 {
+			delete(m.cells, key)
+		}
+	}
+	for icao, t := range m.capable {
+		if now.Sub(t) > interferenceCapableWindow {
+			delete(m.capable, icao)
+		}
+	}
+}
+
+// Cells returns the state of all cells with aircraft, sorted by latitude and longitude.
+// If ownshipValid, Distance_nm is the distance from ownLat/ownLon.
+func (m *interferenceMap) Cells(now time.Time, ownshipValid bool, ownLat, ownLon float64) []InterferenceCell {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]InterferenceCell, 0, len(m.cells))
+	for key, cell := range m.cells {
+		c := InterferenceCell{
+			Lat_min:  float64(key.lat) * interferenceCellSize,
+			Lon_min:  float64(key.lon) * interferenceCellSize,
+			Lat_max:  float64(key.lat+1) * interferenceCellSize,
+			Lon_max:  float64(key.lon+1) * interferenceCellSize,
+			Min_NACp: interferenceGoodNACp,
+		}
+		for _, a := range cell.aircraft {
+			if now.Sub(a.lastSeen) > interferenceWindow {
+				continue
+			}
+			c.Aircraft++
+			if !a.lastDegraded.IsZero() && now.Sub(a.lastDegraded) <= interferenceWindow {
+				c.Degraded++
+			}
+			if a.nacp < c.Min_NACp {
+				c.Min_NACp = a.nacp
+			}
+		}
+		if c.Aircraft == 0 {
+			continue
+		}
+		c.Ratio = float64(c.Degraded) / float64(c.Aircraft)
+		c.Level = interferenceLevel(c.Aircraft, c.Degraded)
+		c.Distance_nm = -1
+		if ownshipValid {
+			c.Distance_nm = c.distanceNM(ownLat, ownLon)
+		}
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Lat_min != ret[j].Lat_min {
+			return ret[i].Lat_min < ret[j].Lat_min
+		}
+		return ret[i].Lon_min < ret[j].Lon_min
+	})
+	return ret
+}
+
+// distanceNM returns the distance from a point to the nearest point of the cell, 0 if inside.
+func (c *InterferenceCell) distanceNM(lat, lon float64) float64 {
+	nearLat := math.Max(c.Lat_min, math.Min(c.Lat_max, lat))
+	nearLon := math.Max(c.Lon_min, math.Min(c.Lon_max, lon))
+	if nearLat == lat && nearLon == lon {
+		return 0
+	}
+	dist, _ := common.Distance(lat, lon, nearLat, nearLon)
+	if math.IsNaN(dist) {
+		return 0
+	}
+	return dist / 1852
+}
+
+// isAlerting is true for cells where enough aircraft report degraded GNSS for us to warn the pilot.
+func (c *InterferenceCell) isAlerting() bool {
+	return c.Level == INTERFERENCE_LEVEL_HIGH && c.Degraded >= interferenceAlertDegraded
+}
+
+func (c *InterferenceCell) geoJSON() geoJSONFeature {
+	ring := [][2]float64{{c.Lon_min, c.Lat_min}, {c.Lon_max, c.Lat_min}, {c.Lon_max, c.Lat_max}, {c.Lon_min, c.Lat_max}, {c.Lon_min, c.Lat_min}}
+	props := map[string]interface{}{
+		"aircraft": c.Aircraft,
+		"degraded": c.Degraded,
+		"ratio":    c.Ratio,
+		"level":    c.Level,
+		"min_nacp": c.Min_NACp,
+	}
+	if c.Distance_nm >= 0 {
+		props["distance_nm"] = c.Distance_nm
+	}
+	return geoJSONFeature{
+		Type:       "Feature",
+		Id:         fmt.Sprintf("%.1f,%.1f", c.Lat_min, c.Lon_min),
+		Geometry:   geoJSONGeometry{Type: "Polygon", Coordinates: [][][2]float64{ring}},
+		Properties: props,
+	}
+}
+
+// registerInterferenceReport feeds a received ADS-B/ADS-R position report into the interference map.
+// TIS-B NACp is made up by the ground station and tells nothing about the aircraft's GNSS.
+func registerInterferenceReport(ti TrafficInfo) {
+	if !ti.Position_valid || ti.ExtrapolatedPosition || (ti.TargetType != TARGET_TYPE_ADSB && ti.TargetType != TARGET_TYPE_ADSR) {
+		return
+	}
+	gnssInterference.Add(ti.Icao_addr, float64(ti.Lat), float64(ti.Lng), ti.NACp, stratuxClock.Time)
+}
+
+func ownshipInterferenceCells(now time.Time) []InterferenceCell {
+	mySituation.muGPS.Lock()
+	valid := isGPSValid()
+	lat, lon := float64(mySituation.GPSLatitude), float64(mySituation.GPSLongitude)
+	mySituation.muGPS.Unlock()
+	return gnssInterference.Cells(now, valid, lat, lon)
+}
+
+// updateInterferenceMap prunes the map and warns when we are in or near a jammed area.
+func updateInterferenceMap(now time.Time) {
+	gnssInterference.Prune(now)
+	if !isGPSValid() {
+		removeSingleSystemError("gnss-interference-area")
+		return
+	}
+	var nearest *InterferenceCell
+	cells := ownshipInterferenceCells(now)
+	for i := range cells {
+		c := &cells[i]
+		if c.isAlerting() && c.Distance_nm >= 0 && c.Distance_nm <= interferenceAlertRadiusNM && (nearest == nil || c.Distance_nm < nearest.Distance_nm) {
+			nearest = c
+		}
+	}
+	if nearest == nil {
+		removeSingleSystemError("gnss-interference-area")
+	} else if nearest.Distance_nm == 0 {
+		updateSingleSystemErrorf("gnss-interference-area", "Flying in a GPS interference area: %d of %d aircraft report degraded GPS accuracy.", nearest.Degraded, nearest.Aircraft)
+	} else {
+		updateSingleSystemErrorf("gnss-interference-area", "GPS interference area %.0f NM away: %d of %d aircraft report degraded GPS accuracy.", nearest.Distance_nm, nearest.Degraded, nearest.Aircraft)
+	}
+}
+
+// AJAX call - /api/interference. Responds with the GNSS interference grid.
+func handleInterferenceRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	cells := ownshipInterferenceCells(stratuxClock.Time)
+	cellsJSON, err := json.Marshal(&cells)
+	if err != nil {
+		log.Printf("Error sending interference JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", cellsJSON)
+}
+
+// AJAX call - /api/interference.geojson. The GNSS interference grid as a GeoJSON heat-map layer.
+func handleInterferenceGeoJSONRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	w.Header().Set("Content-Type", "application/geo+json")
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0)}
+	for _, c := range ownshipInterferenceCells(stratuxClock.Time) {
+		fc.Features = append(fc.Features, c.geoJSON())
+	}
+	fcJSON, err := json.Marshal(&fc)
+	if err != nil {
+		log.Printf("Error sending interference GeoJSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", fcJSON)
+}
@@ -0,0 +1,143 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	gnss_interference_test.go: Unit tests for the crowd-sourced GNSS interference map.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInterferenceLevel(t *testing.T) {
+	tests := []struct {
+		aircraft, degraded int
+		want               string
+	}{
+		{0, 0, INTERFERENCE_LEVEL_LOW},
+		{2, 2, INTERFERENCE_LEVEL_LOW}, // Too few aircraft.
+		{100, 1, INTERFERENCE_LEVEL_LOW},
+		{100, 2, INTERFERENCE_LEVEL_MEDIUM},
+		{10, 1, INTERFERENCE_LEVEL_MEDIUM},
+		{10, 2, INTERFERENCE_LEVEL_HIGH},
+	}
+	for _, tt := range tests {
+		if got := interferenceLevel(tt.aircraft, tt.degraded); got != tt.want {
+			t.Errorf("interferenceLevel(%d, %d) = %s, want %s", tt.aircraft, tt.degraded, got, tt.want)
+		}
+	}
+}
+
+func TestInterferenceMap(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newInterferenceMap()
+
+	// Cell 54.5-55N 18-18.5E: 5 aircraft, 3 of them lose GNSS accuracy over the area.
+	for i := uint32(1); i <= 5; i++ {
+		m.Add(i, 53.2, 18.2, 9, now) // Good NACp further south: these are capable.
+		nacp := 9
+		if i <= 3 {
+			nacp = int(i) // 1, 2, 3
+		}
+		m.Add(i, 54.7, 18.2, nacp, now.Add(time.Minute))
+	}
+	// An old transponder without GNSS always reports NACp 0: ignored.
+	m.Add(6, 54.7, 18.3, 0, now.Add(time.Minute))
+	// Invalid position.
+	m.Add(7, 0, 0, 10, now)
+
+	cells := m.Cells(now.Add(2*time.Minute), true, 54.2, 18.25)
+	if len(cells) != 2 {
+		t.Fatalf("got %d cells, want 2: %+v", len(cells), cells)
+	}
+	south, north := cells[0], cells[1]
+	if south.Lat_min != 53 || south.Lon_min != 18 || south.Aircraft != 5 || south.Degraded != 0 || south.Level != INTERFERENCE_LEVEL_LOW {
+		t.Errorf("south cell = %+v", south)
+	}
+	if north.Lat_min != 54.5 || north.Lat_max != 55 || north.Aircraft != 5 || north.Degraded != 3 || north.Min_NACp != 1 || north.Level != INTERFERENCE_LEVEL_HIGH || !north.isAlerting() {
+		t.Errorf("north cell = %+v", north)
+	}
+	if north.Distance_nm < 17 || north.Distance_nm > 19 {
+		t.Errorf("distance to north cell = %.1f NM, want ~18", north.Distance_nm)
+	}
+	if c := m.Cells(now, false, 0, 0); c[0].Distance_nm != -1 {
+		t.Errorf("distance without ownship position = %f", c[0].Distance_nm)
+	}
+
+	// Inside the cell.
+	if d := north.distanceNM(54.7, 18.2); d != 0 {
+		t.Errorf("distance inside cell = %f", d)
+	}
+
+	// Aircraft age out of the window.
+	m.Prune(now.Add(interferenceWindow + 90*time.Second))
+	if cells := m.Cells(now.Add(interferenceWindow+90*time.Second), false, 0, 0); len(cells) != 0 {
+		t.Errorf("cells after window = %+v", cells)
+	}
+}
+
+func TestInterferenceMapRecovery(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newInterferenceMap()
+	m.Add(1, 54.7, 18.2, 9, now)
+	m.Add(1, 54.7, 18.2, 2, now.Add(time.Minute))
+	// Still in the cell with a good NACp, after the degraded report left the window.
+	for i := 2; i < 20; i++ {
+		m.Add(1, 54.7, 18.2, 9, now.Add(time.Duration(i)*time.Minute))
+	}
+	c := m.Cells(now.Add(19*time.Minute), false, 0, 0)
+	if len(c) != 1 || c[0].Degraded != 0 || c[0].Min_NACp != 8 {
+		t.Errorf("cells = %+v", c)
+	}
+}
+
+func TestRegisterInterferenceReport(t *testing.T) {
+	resetGPSState()
+	orig := gnssInterference
+	gnssInterference = newInterferenceMap()
+	defer func() { gnssInterference = orig }()
+
+	ti := TrafficInfo{Icao_addr: 0xABCDEF, Position_valid: true, Lat: 54.7, Lng: 18.2, NACp: 9, TargetType: TARGET_TYPE_ADSB}
+	registerInterferenceReport(ti)
+	tisb := ti
+	tisb.Icao_addr = 0x123456
+	tisb.TargetType = TARGET_TYPE_TISB
+	registerInterferenceReport(tisb)
+
+	w := httptest.NewRecorder()
+	handleInterferenceGeoJSONRequest(w, httptest.NewRequest("GET", "/api/interference.geojson", nil))
+	var fc struct {
+		Type     string
+		Features []struct {
+			Id       string
+			Geometry struct {
+				Type        string
+				Coordinates [][][2]float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &fc); err != nil {
+		t.Fatalf("invalid JSON: %v: %s", err, w.Body.String())
+	}
+	if len(fc.Features) != 1 || fc.Features[0].Properties["aircraft"] != 1.0 || fc.Features[0].Properties["level"] != INTERFERENCE_LEVEL_LOW {
+		t.Fatalf("unexpected collection: %s", w.Body.String())
+	}
+	ring := fc.Features[0].Geometry.Coordinates[0]
+	if fc.Features[0].Geometry.Type != "Polygon" || len(ring) != 5 || ring[0] != ring[4] || ring[0] != [2]float64{18, 54.5} {
+		t.Errorf("geometry = %+v", fc.Features[0].Geometry)
+	}
+
+	w = httptest.NewRecorder()
+	handleInterferenceRequest(w, httptest.NewRequest("GET", "/api/interference", nil))
+	var cells []InterferenceCell
+	if err := json.Unmarshal(w.Body.Bytes(), &cells); err != nil || len(cells) != 1 || cells[0].Aircraft != 1 {
+		t.Errorf("cells = %s", w.Body.String())
+	}
+}
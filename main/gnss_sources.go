@@ -0,0 +1,300 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	gnss_sources.go: Keeps a separate GNSS solution per position source (serial GPS, network NMEA input),
+	 ranks them and selects the one that feeds mySituation, with hysteresis and failover.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	GNSS_SOURCE_SERIAL        = "serial"   // Serial/USB GPS, including OGN trackers and SoftRF dongles.
+	GNSS_SOURCE_NETWORK       = "network " // Prefix, followed by the remote IP of the TCP 30011 NMEA input.
+	gnssFixTimeout            = 3 * time.Second
+	gnssSwitchHoldTime        = 10 * time.Second // A better source must stay better this long before we switch to it.
+	gnssSwitchAccuracyRatio   = 0.5              // ... and have less than half the horizontal uncertainty of the active one.
+	gnssUnknownAccuracyMeters = 999999
+)
+
+type gnssSource struct {
+	name        string
+	solution    SituationData // GPS fields only.
+	perf        gpsPerfStats
+	betterSince time.Time // Since when this source has been significantly better than the active one.
+}
+
+// GNSSSourceStatus is the per-source summary reported by /getGNSSSources.
+type GNSSSourceStatus struct {
+	Name               string
+	Active             bool
+	Valid              bool
+	FixQuality         uint8
+	Satellites         uint16
+	HorizontalAccuracy float32 // meters, 95%
+	FixAge             float64 // seconds since last position fix, -1 if never
+	LastMessage        string
+}
+
+type gnssSourceManager struct {
+	sources map[string]*gnssSource
+	active  *gnssSource // Source selected to feed mySituation.
+	shown   *gnssSource // Source whose solution is currently in mySituation.
+	current *gnssSource // Source whose message is being parsed.
+}
+
+// All access must be protected by mySituation.muGPS.
+var gnssSources = newGNSSSourceManager()
+
+func newGNSSSourceManager() *gnssSourceManager {
+	return &gnssSourceManager{sources: make(map[string]*gnssSource)}
+}
+
+// copyGPSSolution copies the GPS part of a SituationData, leaving mutexes, baro and AHRS alone.
+func copyGPSSolution(dst, src *SituationData) {
+	dst.GPSLastFixSinceMidnightUTC = src.GPSLastFixSinceMidnightUTC
+	dst.GPSLatitude = src.GPSLatitude
+	dst.GPSLongitude = src.GPSLongitude
+	dst.GPSFixQuality = src.GPSFixQuality
+	dst.GPSHeightAboveEllipsoid = src.GPSHeightAboveEllipsoid
+	dst.GPSGeoidSep = src.GPSGeoidSep
+	dst.GPSSatellites = src.GPSSatellites
+	dst.GPSSatellitesTracked = src.GPSSatellitesTracked
+	dst.GPSSatellitesSeen = src.GPSSatellitesSeen
+	dst.GPSHorizontalAccuracy = src.GPSHorizontalAccuracy
+	dst.GPSNACp = src.GPSNACp
+	dst.GPSAltitudeMSL = src.GPSAltitudeMSL
+	dst.GPSVerticalAccuracy = src.GPSVerticalAccuracy
+	dst.GPSPositionDOP = src.GPSPositionDOP
+	dst.GPSHorizontalDOP = src.GPSHorizontalDOP
+	dst.GPSVerticalDOP = src.GPSVerticalDOP
+	dst.GPSVerticalSpeed = src.GPSVerticalSpeed
+	dst.GPSLastFixLocalTime = src.GPSLastFixLocalTime
+	dst.GPSTrueCourse = src.GPSTrueCourse
+	dst.GPSTurnRate = src.GPSTurnRate
+	dst.GPSGroundSpeed = src.GPSGroundSpeed
+	dst.GPSLastGroundTrackTime = src.GPSLastGroundTrackTime
+	dst.GPSTime = src.GPSTime
+	dst.GPSLastGPSTimeStratuxTime = src.GPSLastGPSTimeStratuxTime
+	dst.GPSLastValidNMEAMessageTime = src.GPSLastValidNMEAMessageTime
+	dst.GPSLastValidNMEAMessage = src.GPSLastValidNMEAMessage
+	dst.GPSLastAccuracyTime = src.GPSLastAccuracyTime
+	dst.GPSPositionSampleRate = src.GPSPositionSampleRate
+}
+
+func (s *gnssSource) valid(now time.Time) bool {
+	return s.solution.GPSFixQuality > 0 && !s.solution.GPSLastFixLocalTime.IsZero() && now.Sub(s.solution.GPSLastFixLocalTime) < gnssFixTimeout
+}
+
+// accuracy returns the horizontal uncertainty in meters, or gnssUnknownAccuracyMeters if the source doesn't report one.
+func (s *gnssSource) accuracy() float32 {
+	if s.solution.GPSHorizontalAccuracy <= 0 || s.solution.GPSHorizontalAccuracy > gnssUnknownAccuracyMeters {
+		return gnssUnknownAccuracyMeters
+	}
+	return s.solution.GPSHorizontalAccuracy
+}
+
+// gnssFixRank orders NMEA fix quality indicators: RTK fixed > RTK float > DGPS/SBAS > GPS > dead reckoning.
+func gnssFixRank(q uint8) int {
+	switch q {
+	case 4:
+		return 4
+	case 5:
+		return 3
+	case 2:
+		return 2
+	case 6:
+		return 0
+	}
+	return 1
+}
+
+// gnssSourceBetter returns true if a ranks above b: valid before invalid, then by accuracy, fix quality and fix age.
+func gnssSourceBetter(a, b *gnssSource, now time.Time) bool {
+	if va, vb := a.valid(now), b.valid(now); va != vb {
+		return va
+	}
+	if accA, accB := a.accuracy(), b.accuracy(); accA != accB {
+		return accA < accB
+	}
+	if ra, rb := gnssFixRank(a.solution.GPSFixQuality), gnssFixRank(b.solution.GPSFixQuality); ra != rb {
+		return ra > rb
+	}
+	return a.solution.GPSLastFixLocalTime.After(b.solution.GPSLastFixLocalTime)
+}
+
+// significantlyBetter is the switch criterion while the active source is still valid.
+func (m *gnssSourceManager) significantlyBetter(s *gnssSource, now time.Time) bool {
+	if !s.valid(now) {
+		return false
+	}
+	if gnssFixRank(s.solution.GPSFixQuality) > gnssFixRank(m.active.solution.GPSFixQuality) && s.accuracy() <= m.active.accuracy() {
+		return true
+	}
+	return s.accuracy() < m.active.accuracy()*gnssSwitchAccuracyRatio
+}
+
+// selectSource picks the active source. Fails over immediately if the active one has no valid fix,
+// otherwise only switches to a source that has been significantly better for gnssSwitchHoldTime.
+func (m *gnssSourceManager) selectSource(now time.Time) {
+	var best *gnssSource
+	for _, s := range m.sources {
+		if best == nil || gnssSourceBetter(s, best, now) || (!gnssSourceBetter(best, s, now) && s.name < best.name) {
+			best = s
+		}
+	}
+	if best == nil {
+		m.setActive(nil, now)
+		return
+	}
+	if m.active == nil || !m.active.valid(now) {
+		if best.valid(now) {
+			m.setActive(best, now)
+		}
+		return
+	}
+	for _, s := range m.sources {
+		if s == m.active || !m.significantlyBetter(s, now) {
+			s.betterSince = time.Time{}
+		} else if s.betterSince.IsZero() {
+			s.betterSince = now
+		}
+	}
+	if best != m.active && !best.betterSince.IsZero() && now.Sub(best.betterSince) >= gnssSwitchHoldTime {
+		m.setActive(best, now)
+	}
+}
+
+func (m *gnssSourceManager) setActive(s *gnssSource, now time.Time) {
+	if m.active == s {
+		return
+	}
+	if s != nil && m.active != nil {
+		log.Printf("GNSS: switching position source from %s to %s\n", m.active.name, s.name)
+	} else if s != nil && len(m.sources) > 1 {
+		log.Printf("GNSS: using position source %s\n", s.name)
+	}
+	m.active = s
+	for _, src := range m.sources {
+		src.betterSince = time.Time{}
+	}
+	globalStatus.GPS_source = ""
+	if s != nil {
+		globalStatus.GPS_source = s.name
+	}
+}
+
+// begin loads the solution of the named source into mySituation before a message from it is parsed.
+func (m *gnssSourceManager) begin(name string) {
+	s, ok := m.sources[name]
+	if !ok {
+		s = &gnssSource{name: name}
+		if m.shown == nil {
+			// First source: adopt whatever is in mySituation.
+			copyGPSSolution(&s.solution, &mySituation)
+			s.perf = gpsPerf
+			m.shown = s
+		} else {
+			s.solution.GPSHorizontalAccuracy = gnssUnknownAccuracyMeters
+			s.solution.GPSVerticalAccuracy = gnssUnknownAccuracyMeters
+		}
+		m.sources[name] = s
+	}
+	if m.shown != s {
+		copyGPSSolution(&mySituation, &s.solution)
+		gpsPerf = s.perf
+	}
+	m.shown = s
+	m.current = s
+}
+
+// end stores the parse result back into the current source, reselects and restores the active source's solution.
+func (m *gnssSourceManager) end() {
+	s := m.current
+	m.current = nil
+	if s == nil {
+		return
+	}
+	copyGPSSolution(&s.solution, &mySituation)
+	s.perf = gpsPerf
+	m.selectSource(stratuxClock.Time)
+	if m.active != nil && m.active != s {
+		copyGPSSolution(&mySituation, &m.active.solution)
+		gpsPerf = m.active.perf
+		m.shown = m.active
+	}
+}
+
+// currentIsActive returns true if the message being parsed is from the source that feeds mySituation.
+// Side effects such as setting the system clock or feeding the GPS attitude statistics are limited to that source.
+func (m *gnssSourceManager) currentIsActive() bool {
+	return m.current == nil || m.active == nil || m.current == m.active
+}
+
+// remove forgets a source, e.g. when its network connection is closed, and fails over to the next one.
+func (m *gnssSourceManager) remove(name string) {
+	s, ok := m.sources[name]
+	if !ok {
+		return
+	}
+	delete(m.sources, name)
+	if m.shown == s {
+		m.shown = nil
+	}
+	if m.active == s {
+		m.setActive(nil, stratuxClock.Time)
+		m.selectSource(stratuxClock.Time)
+		if m.active != nil {
+			copyGPSSolution(&mySituation, &m.active.solution)
+			gpsPerf = m.active.perf
+			m.shown = m.active
+		}
+	}
+}
+
+func (m *gnssSourceManager) status(now time.Time) []GNSSSourceStatus {
+	ret := make([]GNSSSourceStatus, 0, len(m.sources))
+	for _, s := range m.sources {
+		age := -1.0
+		if !s.solution.GPSLastFixLocalTime.IsZero() {
+			age = now.Sub(s.solution.GPSLastFixLocalTime).Seconds()
+		}
+		ret = append(ret, GNSSSourceStatus{
+			Name:               s.name,
+			Active:             s == m.active,
+			Valid:              s.valid(now),
+			FixQuality:         s.solution.GPSFixQuality,
+			Satellites:         s.solution.GPSSatellites,
+			HorizontalAccuracy: s.accuracy(),
+			FixAge:             age,
+			LastMessage:        s.solution.GPSLastValidNMEAMessage,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// AJAX call - /getGNSSSources. Responds with the state of all GNSS position sources.
+func handleGNSSSourcesRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	mySituation.muGPS.Lock()
+	sources := gnssSources.status(stratuxClock.Time)
+	mySituation.muGPS.Unlock()
+	sourcesJSON, err := json.Marshal(&sources)
+	if err != nil {
+		log.Printf("Error sending GNSS source JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", sourcesJSON)
+}
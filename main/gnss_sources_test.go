@@ -0,0 +1,162 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	gnss_sources_test.go: Unit tests for GNSS source ranking, selection and failover.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func addTestGNSSSource(m *gnssSourceManager, name string, quality uint8, accuracy float32, fixTime time.Time) *gnssSource {
+	s := &gnssSource{name: name}
+	s.solution.GPSFixQuality = quality
+	s.solution.GPSHorizontalAccuracy = accuracy
+	s.solution.GPSLastFixLocalTime = fixTime
+	m.sources[name] = s
+	return s
+}
+
+func TestGNSSSourceBetter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newGNSSSourceManager()
+	tests := []struct {
+		name string
+		a, b *gnssSource
+		want bool
+	}{
+		{"Valid beats invalid", addTestGNSSSource(m, "a1", 1, 50, now), addTestGNSSSource(m, "b1", 1, 2, now.Add(-5*time.Second)), true},
+		{"No fix", addTestGNSSSource(m, "a2", 0, 2, now), addTestGNSSSource(m, "b2", 1, 50, now), false},
+		{"Accuracy", addTestGNSSSource(m, "a3", 1, 3, now), addTestGNSSSource(m, "b3", 1, 10, now), true},
+		{"Unknown accuracy", addTestGNSSSource(m, "a4", 1, 0, now), addTestGNSSSource(m, "b4", 1, 100, now), false},
+		{"Fix quality", addTestGNSSSource(m, "a5", 2, 0, now), addTestGNSSSource(m, "b5", 1, 0, now), true},
+		{"RTK", addTestGNSSSource(m, "a6", 5, 5, now), addTestGNSSSource(m, "b6", 4, 5, now), false},
+		{"Fresher", addTestGNSSSource(m, "a7", 1, 5, now), addTestGNSSSource(m, "b7", 1, 5, now.Add(-time.Second)), true},
+	}
+	for _, tt := range tests {
+		if got := gnssSourceBetter(tt.a, tt.b, now); got != tt.want {
+			t.Errorf("%s: gnssSourceBetter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGNSSSourceSelectHysteresis(t *testing.T) {
+	resetGPSState()
+	defer resetGPSState()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newGNSSSourceManager()
+	a := addTestGNSSSource(m, "a", 1, 10, now)
+	b := addTestGNSSSource(m, "b", 1, 12, now)
+
+	m.selectSource(now)
+	if m.active != a || globalStatus.GPS_source != "a" {
+		t.Fatalf("active = %v, want a", m.active)
+	}
+
+	// Slightly better: no switch, ever.
+	b.solution.GPSHorizontalAccuracy = 8
+	for i := 1; i <= 20; i++ {
+		now = now.Add(time.Second)
+		a.solution.GPSLastFixLocalTime, b.solution.GPSLastFixLocalTime = now, now
+		m.selectSource(now)
+		if m.active != a {
+			t.Fatalf("switched to %s on a marginal improvement", m.active.name)
+		}
+	}
+
+	// Significantly better: switch after the hold time.
+	b.solution.GPSHorizontalAccuracy = 3
+	start := now
+	for now.Sub(start) < gnssSwitchHoldTime+time.Second {
+		now = now.Add(time.Second)
+		a.solution.GPSLastFixLocalTime, b.solution.GPSLastFixLocalTime = now, now
+		m.selectSource(now)
+		if held := now.Sub(start); held < gnssSwitchHoldTime && m.active != a {
+			t.Fatalf("switched after %v", held)
+		}
+	}
+	if m.active != b || globalStatus.GPS_source != "b" {
+		t.Fatalf("active = %s, want b", m.active.name)
+	}
+
+	// b stops delivering fixes: immediate failover.
+	now = now.Add(gnssFixTimeout)
+	a.solution.GPSLastFixLocalTime = now
+	m.selectSource(now)
+	if m.active != a {
+		t.Errorf("no failover, active = %s", m.active.name)
+	}
+
+	// Nothing valid: keep the last active source.
+	now = now.Add(time.Minute)
+	m.selectSource(now)
+	if m.active != a {
+		t.Errorf("active = %v, want a", m.active)
+	}
+}
+
+func TestGNSSSourcesNoOscillation(t *testing.T) {
+	resetGPSState()
+	defer resetGPSState()
+	globalStatus.GPS_connected = true
+
+	ggaA := appendNmeaChecksum("$GPGGA,120000.000,4727.030,N,12218.528,W,1,08,0.9,420.9,M,46.9,M,,")
+	ggaB := appendNmeaChecksum("$GPGGA,120000.000,4800.000,N,01100.000,E,1,08,0.9,500.0,M,46.9,M,,")
+	for i := 0; i < 5; i++ {
+		if !processNMEALineSource(GNSS_SOURCE_SERIAL, ggaA, true) {
+			t.Fatal("GGA from serial not used")
+		}
+		processNMEALineSource(GNSS_SOURCE_NETWORK+"192.168.1.10", ggaB, true)
+	}
+
+	mySituation.muGPS.Lock()
+	lat := mySituation.GPSLatitude
+	sources := gnssSources.status(stratuxClock.Time)
+	mySituation.muGPS.Unlock()
+	if math.Abs(float64(lat)-47.45) > 0.01 {
+		t.Errorf("latitude = %f, want the serial source's 47.45", lat)
+	}
+	if globalStatus.GPS_source != GNSS_SOURCE_SERIAL {
+		t.Errorf("GPS_source = %q", globalStatus.GPS_source)
+	}
+	if len(sources) != 2 || sources[0].Name != "network 192.168.1.10" || sources[0].Active || !sources[0].Valid || !sources[1].Active {
+		t.Errorf("sources = %+v", sources)
+	}
+	if b := gnssSources.sources["network 192.168.1.10"]; b == nil || b.solution.GPSLatitude != 48 {
+		t.Errorf("network source solution not kept separately")
+	}
+
+	// Serial source goes away: fail over to the network source.
+	mySituation.muGPS.Lock()
+	gnssSources.remove(GNSS_SOURCE_SERIAL)
+	lat = mySituation.GPSLatitude
+	mySituation.muGPS.Unlock()
+	if lat != 48 || globalStatus.GPS_source != "network 192.168.1.10" {
+		t.Errorf("after failover: latitude = %f, source = %q", lat, globalStatus.GPS_source)
+	}
+}
+
+func TestHandleGNSSSourcesRequest(t *testing.T) {
+	resetGPSState()
+	defer resetGPSState()
+	globalStatus.GPS_connected = true
+	processNMEALineSource(GNSS_SOURCE_SERIAL, appendNmeaChecksum("$GPGGA,120000.000,4727.030,N,12218.528,W,2,08,0.9,420.9,M,46.9,M,,"), true)
+
+	w := httptest.NewRecorder()
+	handleGNSSSourcesRequest(w, httptest.NewRequest("GET", "/getGNSSSources", nil))
+	var sources []GNSSSourceStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &sources); err != nil {
+		t.Fatalf("invalid JSON: %v: %s", err, w.Body.String())
+	}
+	if len(sources) != 1 || sources[0].Name != GNSS_SOURCE_SERIAL || !sources[0].Active || sources[0].FixQuality != 2 {
+		t.Errorf("sources = %+v", sources)
+	}
+}
@@ -38,6 +38,7 @@ const (
 	SAT_TYPE_GALILEO = 3  // GAxxx; NMEA IDs
 	SAT_TYPE_BEIDOU  = 4  // GBxxx; NMEA IDs 201-235
 	SAT_TYPE_QZSS    = 5  // QZSS
+	SAT_TYPE_NAVIC   = 6  // GIxxx; NavIC (IRNSS)
 	SAT_TYPE_SBAS    = 10 // NMEA IDs 33-54
 )
 
@@ -50,16 +51,17 @@ const (
 )
 
 type SatelliteInfo struct {
-	SatelliteNMEA    uint8     // NMEA ID of the satellite. 1-32 is GPS, 33-54 is SBAS, 65-88 is Glonass.
-	SatelliteID      string    // Formatted code indicating source and PRN code. e.g. S138==WAAS satellite 138, G2==GPS satellites 2
-	Elevation        int16     // Angle above local horizon, -xx to +90
-	Azimuth          int16     // Bearing (degrees true), 0-359
-	Signal           int8      // Signal strength, 0 - 99; -99 indicates no reception
-	Type             uint8     // Type of satellite (GPS, GLONASS, Galileo, SBAS)
-	TimeLastSolution time.Time // Time (system ticker) a solution was last calculated using this satellite
-	TimeLastSeen     time.Time // Time (system ticker) a signal was last received from this satellite
-	TimeLastTracked  time.Time // Time (system ticker) this satellite was tracked (almanac data)
-	InSolution       bool      // True if satellite is used in the position solution (reported by GSA message or PUBX,03)
+	SatelliteNMEA    uint8           // NMEA ID of the satellite. 1-32 is GPS, 33-54 is SBAS, 65-88 is Glonass.
+	SatelliteID      string          // Formatted code indicating source and PRN code. e.g. S138==WAAS satellite 138, G2==GPS satellites 2
+	Elevation        int16           // Angle above local horizon, -xx to +90
+	Azimuth          int16           // Bearing (degrees true), 0-359
+	Signal           int8            // Signal strength, 0 - 99; -99 indicates no reception
+	Type             uint8           // Type of satellite (GPS, GLONASS, Galileo, SBAS)
+	TimeLastSolution time.Time       // Time (system ticker) a solution was last calculated using this satellite
+	TimeLastSeen     time.Time       // Time (system ticker) a signal was last received from this satellite
+	TimeLastTracked  time.Time       // Time (system ticker) this satellite was tracked (almanac data)
+	InSolution       bool            // True if satellite is used in the position solution (reported by GSA message or PUBX,03)
+	Signals          map[string]int8 // Signal strength per signal, e.g. "L1 C/A" or "L5 Q", from NMEA 4.10 GSV. Signal is the strongest of these.
 }
 
 type SituationData struct {
@@ -72,7 +74,7 @@ type SituationData struct {
 	GPSLongitude                float32
 	GPSFixQuality               uint8
 	GPSHeightAboveEllipsoid     float32 // GPS height above WGS84 ellipsoid, ft. This is specified by the GDL90 protocol, but most EFBs use MSL altitude instead. HAE is about 70-100 ft below GPS MSL altitude over most of the US.
-	GPSGeoidSep                 float32 // geoid separation, ft, MSL minus HAE (used in altitude calculation)
+	GPSGeoidSep                 float32 // geoid separation, ft, HAE minus MSL (used in altitude calculation)
 	GPSSatellites               uint16  // satellites used in solution
 	GPSSatellitesTracked        uint16  // satellites tracked (almanac data received)
 	GPSSatellitesSeen           uint16  // satellites seen (signal received)
@@ -80,6 +82,9 @@ type SituationData struct {
 	GPSNACp                     uint8   // NACp categories are defined in AC 20-165A
 	GPSAltitudeMSL              float32 // Feet MSL
 	GPSVerticalAccuracy         float32 // 95% confidence for vertical position, meters
+	GPSPositionDOP              float32 // PDOP, from GSA or UBX NAV-DOP
+	GPSHorizontalDOP            float32 // HDOP, from GSA or UBX NAV-DOP
+	GPSVerticalDOP              float32 // VDOP, from GSA or UBX NAV-DOP
 	GPSVerticalSpeed            float32 // GPS vertical velocity, feet per second
 	GPSLastFixLocalTime         time.Time
 	GPSTrueCourse               float32
@@ -90,14 +95,26 @@ type SituationData struct {
 	GPSLastGPSTimeStratuxTime   time.Time // stratuxClock time since last GPS time received.
 	GPSLastValidNMEAMessageTime time.Time // time valid NMEA message last seen
 	GPSLastValidNMEAMessage     string    // last NMEA message processed.
-	GPSLastAccuracyTime         time.Time // time of last GNGST
+	GPSLastAccuracyTime         time.Time // time of last GST/GBS accuracy
 	GPSPositionSampleRate       float64   // calculated sample rate of GPS positions
 
+	// Wind estimate from the GPS track, see wind.go.
+	WindDirection float64 // degrees true, where the wind comes from
+	WindSpeed     float64 // kts
+	WindQuality   uint8   // 0 no estimate, 1 (poor) to 5
+	WindMethod    string  // WIND_METHOD_*
+
 	// From pressure sensor.
 	muBaro                  *sync.Mutex
 	BaroTemperature         float32
 	BaroPressureAltitude    float32
 	BaroVerticalSpeed       float32
+	BaroVario               float32 // ft/min, faster than BaroVerticalSpeed, see vario.go
+	BaroTEVario             float32 // ft/min, total energy compensated with the GPS ground speed
+	BaroQNH                 float32 // hPa, altimeter setting from the nearest METAR or entered, 0 if none. See altimeter.go
+	BaroQNHSource           string  // METAR station or "Manual"
+	BaroIndicatedAltitude   float32 // ft, what an altimeter set to BaroQNH shows, 0 without BaroQNH
+	BaroDensityAltitude     float32 // ft, from BaroTemperature
 	BaroLastMeasurementTime time.Time
 	BaroSourceType          uint8
 
@@ -114,6 +131,7 @@ type SituationData struct {
 	AHRSGLoadMax         float64
 	AHRSLastAttitudeTime time.Time
 	AHRSStatus           uint8
+	AHRSFilter           AHRSFilterHealth
 }
 
 /*
@@ -429,8 +447,11 @@ func initGPSSerial() bool {
 		cfg[12] = 0x03
 		cfg[13] = 0x00
 
-		// outProtoMask. NMEA. Little endian.
+		// outProtoMask. NMEA, plus UBX if binary navigation output is enabled. Little endian.
 		cfg[14] = 0x02
+		if globalSettings.GPS_UBX_Binary {
+			cfg[14] |= 0x01
+		}
 		cfg[15] = 0x00
 
 		cfg[16] = 0x00 // flags.
@@ -597,6 +618,11 @@ func writeUbloxGenericCommands(navrate uint16, p *serial.Port) {
 	p.Write(makeUBXCFG(0x06, 0x01, 8, []byte{0xF1, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})) // Ublox - Satellite Status
 	p.Write(makeUBXCFG(0x06, 0x01, 8, []byte{0xF1, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})) // Ublox - Time of Day and Clock Information
 
+	// UBX-CFG-MSG (UBX NAV Messages). NMEA output stays enabled as a fallback.
+	for _, cmd := range makeUbloxNavMsgConfig(globalSettings.GPS_UBX_Binary) {
+		p.Write(cmd)
+	}
+
 	if navrate == 10 {
 		p.Write(makeUBXCFG(0x06, 0x08, 6, []byte{0x64, 0x00, 0x01, 0x00, 0x01, 0x00})) // 100ms & 1 cycle -> 10Hz (UBX-CFG-RATE payload bytes: little endian!)
 	} else if navrate == 5 {
@@ -823,7 +849,7 @@ func calcGPSAttitude() bool {
 	tempRegWeights = make([]float64, 0)
 
 	for i := 0; i < length; i++ {
-		if myGPSPerfStats[i].msgType == "GPRMC" || myGPSPerfStats[i].msgType == "GNRMC" {
+		if myGPSPerfStats[i].msgType == "GPRMC" || myGPSPerfStats[i].msgType == "GNRMC" || myGPSPerfStats[i].msgType == "NAV-PVT" {
 			tempSpeed = append(tempSpeed, float64(myGPSPerfStats[i].gsf))
 			tempSpeedTime = append(tempSpeedTime, float64(myGPSPerfStats[i].nmeaTime))
 			tempRegWeights = append(tempRegWeights, common.TriCubeWeight(center, halfwidth, float64(myGPSPerfStats[i].nmeaTime)))
@@ -852,7 +878,7 @@ func calcGPSAttitude() bool {
 	tempRegWeights = make([]float64, 0)
 
 	for i := 0; i < length; i++ {
-		if myGPSPerfStats[i].msgType == "GPGGA" || myGPSPerfStats[i].msgType == "GNGGA" {
+		if myGPSPerfStats[i].msgType == "GPGGA" || myGPSPerfStats[i].msgType == "GNGGA" || myGPSPerfStats[i].msgType == "NAV-PVT" {
 			tempVV = append(tempVV, float64(myGPSPerfStats[i].alt))
 			tempSpeedTime = append(tempSpeedTime, float64(myGPSPerfStats[i].nmeaTime))
 			tempRegWeights = append(tempRegWeights, common.TriCubeWeight(center, halfwidth, float64(myGPSPerfStats[i].nmeaTime)))
@@ -1070,6 +1096,35 @@ func calculateNavRate() float64 {
 	return halfwidth
 }
 
+// setGPSTime records a GPS time fix in the situation and sets the system clock from it if it is off.
+func setGPSTime(sit *SituationData, gpsTime time.Time) {
+	if !gpsTime.After(time.Date(2016, time.January, 0, 0, 0, 0, 0, time.UTC)) { // Ignore dates before 2016-JAN-01.
+		return
+	}
+	sit.GPSLastGPSTimeStratuxTime = stratuxClock.Time
+	sit.GPSTime = gpsTime
+	if !gnssSources.currentIsActive() {
+		return // Only the active GNSS source sets the clock.
+	}
+	stratuxClock.SetRealTimeReference(gpsTime)
+	if feedTimeService(gpsTime, time.Now()) {
+		// chrony/ntpd disciplines the system clock, don't step it behind its back.
+	} else if time.Since(gpsTime) > 300*time.Millisecond || time.Since(gpsTime) < -300*time.Millisecond {
+		setStr := gpsTime.Format("20060102 15:04:05.000") + " UTC"
+		log.Printf("setting system time from %s to: '%s'\n", time.Now().Format("20060102 15:04:05.000"), setStr)
+		var err error
+		if common.IsRunningAsRoot() {
+			err = exec.Command("date", "-s", setStr).Run()
+		}
+		if err != nil {
+			log.Printf("Set Date failure: %s error\n", err)
+		} else {
+			log.Printf("Time set from GPS. Current time is %v\n", time.Now())
+		}
+	}
+	TraceLog.OnTimestamp(gpsTime)
+}
+
 /*
 processNMEALine parses NMEA-0183 formatted strings against several message types.
 
@@ -1083,10 +1138,17 @@ func processNMEALine(l string) (sentenceUsed bool) {
 }
 
 func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
+	return processNMEALineSource(GNSS_SOURCE_SERIAL, l, fakeGpsTimeToCurr)
+}
+
+// processNMEALineSource parses a sentence into the solution of the given GNSS source, see gnss_sources.go.
+func processNMEALineSource(source string, l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 	mySituation.muGPS.Lock()
 	TraceLog.Record(CONTEXT_NMEA, []byte(l))
+	gnssSources.begin(source)
 
 	defer func() {
+		gnssSources.end()
 		if sentenceUsed || globalSettings.DEBUG {
 			registerSituationUpdate()
 		}
@@ -1126,7 +1188,18 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 	mySituation.GPSLastValidNMEAMessageTime = stratuxClock.Time
 	mySituation.GPSLastValidNMEAMessage = l
 
-	if (x[0] == "GNVTG") || (x[0] == "GPVTG") { // Ground track information.
+	// While UBX NAV messages are received, they replace the NMEA position, velocity and satellite sentences.
+	if ubxSupersedesNMEA(x[0]) {
+		return false
+	}
+
+	// Sentences of the GNSS talkers (GP, GL, GA, GB, GQ, GI, GN, ...) have the same format for every constellation.
+	nmea, isGNSS := parseNMEAAddress(x)
+	if parse, ok := nmeaSentenceParsers[nmea.sentence]; ok && isGNSS {
+		return parse(nmea)
+	}
+
+	if isGNSS && nmea.sentence == "VTG" { // Ground track information.
 		tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
 		if len(x) < 9 {             // Reduce from 10 to 9 to allow parsing by devices pre-NMEA v2.3
 			return false
@@ -1157,7 +1230,7 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 		mySituation = tmpSituation
 		return true
 
-	} else if (x[0] == "GNGGA") || (x[0] == "GPGGA") { // Position fix.
+	} else if isGNSS && nmea.sentence == "GGA" { // Position fix.
 		tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
 
 		if len(x) < 15 {
@@ -1235,14 +1308,18 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 			return false
 		}
 		tmpSituation.GPSAltitudeMSL = float32(alt * 3.28084) // Convert to feet.
-		thisGpsPerf.alt = float32(tmpSituation.GPSAltitudeMSL)
 
 		// Geoid separation (Sep = HAE - MSL)
-
 		geoidSep, err1 := strconv.ParseFloat(x[11], 32)
-		if err1 != nil {
+		if x[11] != "" && err1 != nil {
 			return false
 		}
+		if geoidSep == 0 {
+			// Receiver without geoid model (or an OGN tracker configured that way): the altitude is HAE.
+			geoidSep = common.GeoidHeight(float64(tmpSituation.GPSLatitude), float64(tmpSituation.GPSLongitude))
+			tmpSituation.GPSAltitudeMSL -= float32(geoidSep * 3.28084)
+		}
+		thisGpsPerf.alt = float32(tmpSituation.GPSAltitudeMSL)
 		tmpSituation.GPSGeoidSep = float32(geoidSep * 3.28084) // Convert to feet.
 		tmpSituation.GPSHeightAboveEllipsoid = tmpSituation.GPSGeoidSep + tmpSituation.GPSAltitudeMSL
 
@@ -1256,19 +1333,12 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 		mySituation = tmpSituation
 
 		if updateGPSPerf {
-			mySituation.muGPSPerformance.Lock()
-			myGPSPerfStats = append(myGPSPerfStats, thisGpsPerf)
-			lenGPSPerfStats := len(myGPSPerfStats)
-			//	log.Printf("GPSPerf array has %n elements. Contents are: %v\n",lenGPSPerfStats,myGPSPerfStats)
-			if lenGPSPerfStats > 299 { //30 seconds @ 10 Hz for UBX, 30 seconds @ 5 Hz for MTK or SIRF with 2x messages per 200 ms)
-				myGPSPerfStats = myGPSPerfStats[(lenGPSPerfStats - 299):] // remove the first n entries if more than 300 in the slice
-			}
-			mySituation.muGPSPerformance.Unlock()
+			recordGPSPerf(thisGpsPerf)
 		}
 
 		return true
 
-	} else if (x[0] == "GNRMC") || (x[0] == "GPRMC") { // Recommended Minimum data.
+	} else if isGNSS && nmea.sentence == "RMC" { // Recommended Minimum data.
 		tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
 
 		//$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A
@@ -1284,6 +1354,7 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 		     230394       Date - 23rd of March 1994
 		     003.1,W      Magnetic Variation
 		     D				mode field (nmea 2.3 and higher)
+		     S				navigational status (nmea 4.10 and higher)
 		     *6A          The checksum data, always begins with *
 		*/
 		if len(x) < 11 {
@@ -1299,6 +1370,13 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 			tmpSituation.GPSFixQuality = 0 // Just a note.
 			return false
 		}
+		// NMEA 2.3 mode indicator (field 12) and NMEA 4.10 navigational status (field 13).
+		if len(x) > 12 && x[12] == "N" {
+			return false
+		}
+		if len(x) > 13 && !nmeaNavStatusUsable(x[13]) {
+			return false
+		}
 
 		// Timestamp.
 		if len(x[1]) < 7 {
@@ -1324,24 +1402,8 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 				gpsTime = time.Now().UTC()
 			}
 
-			if err == nil && gpsTime.After(time.Date(2016, time.January, 0, 0, 0, 0, 0, time.UTC)) { // Ignore dates before 2016-JAN-01.
-				tmpSituation.GPSLastGPSTimeStratuxTime = stratuxClock.Time
-				tmpSituation.GPSTime = gpsTime
-				stratuxClock.SetRealTimeReference(gpsTime)
-				if time.Since(gpsTime) > 300*time.Millisecond || time.Since(gpsTime) < -300*time.Millisecond {
-					setStr := gpsTime.Format("20060102 15:04:05.000") + " UTC"
-					log.Printf("setting system time from %s to: '%s'\n", time.Now().Format("20060102 15:04:05.000"), setStr)
-					var err error
-					if common.IsRunningAsRoot() {
-						err = exec.Command("date", "-s", setStr).Run()
-					}
-					if err != nil {
-						log.Printf("Set Date failure: %s error\n", err)
-					} else {
-						log.Printf("Time set from GPS. Current time is %v\n", time.Now())
-					}
-				}
-				TraceLog.OnTimestamp(gpsTime)
+			if err == nil {
+				setGPSTime(&tmpSituation, gpsTime)
 			}
 		}
 
@@ -1406,160 +1468,15 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 		mySituation = tmpSituation
 
 		if updateGPSPerf {
-			mySituation.muGPSPerformance.Lock()
-			myGPSPerfStats = append(myGPSPerfStats, thisGpsPerf)
-			lenGPSPerfStats := len(myGPSPerfStats)
-			//	log.Printf("GPSPerf array has %n elements. Contents are: %v\n",lenGPSPerfStats,myGPSPerfStats)
-			if lenGPSPerfStats > 299 { //30 seconds @ 10 Hz for UBX, 30 seconds @ 5 Hz for MTK or SIRF with 2x messages per 200 ms)
-				myGPSPerfStats = myGPSPerfStats[(lenGPSPerfStats - 299):] // remove the first n entries if more than 300 in the slice
-			}
-			mySituation.muGPSPerformance.Unlock()
+			recordGPSPerf(thisGpsPerf)
 		}
 
 		setDataLogTimeWithGPS(mySituation)
 		return true
 
-	} else if (x[0] == "GNGSA") || (x[0] == "GPGSA") { // Satellite data.
-		tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
-
-		if len(x) < 18 {
-			return false
-		}
-
-		// field 1: operation mode
-		// M: manual forced to 2D or 3D mode
-		// A: automatic switching between 2D and 3D modes
-
-		/*
-			if (x[1] != "A") && (x[1] != "M") { // invalid fix ... but x[2] is a better indicator of fix quality. Deprecating this.
-				tmpSituation.GPSFixQuality = 0 // Just a note.
-				return false
-			}
-		*/
-
-		// field 2: solution type
-		// 1 = no solution; 2 = 2D fix, 3 = 3D fix. WAAS status is parsed from GGA message, so no need to get here
-		if (x[2] == "") || (x[2] == "1") { // missing or no solution
-			tmpSituation.GPSFixQuality = 0 // Just a note.
-			return false
-		}
-
-		// fields 3-14: satellites in solution
-		var svStr string
-		var svType uint8
-
-		// START OF PROTECTED BLOCK
-		mySituation.muSatellite.Lock()
-
-		for _, svtxt := range x[3:15] {
-			sv, err := strconv.Atoi(svtxt)
-			if err == nil {
-				if sv <= 32 {
-					svType = SAT_TYPE_GPS
-					svStr = fmt.Sprintf("G%d", sv) // GPS 1-32
-				} else if sv <= 64 {
-					svType = SAT_TYPE_SBAS
-					svStr = fmt.Sprintf("S%d", sv+87) // SBAS 33-64, 33 = SBAS PRN 120
-				} else if sv <= 96 {
-					svType = SAT_TYPE_GLONASS
-					svStr = fmt.Sprintf("R%d", sv-64) // GLONASS 65-96
-				} else if sv <= 158 {
-					svType = SAT_TYPE_SBAS
-					svStr = fmt.Sprintf("S%d", sv) // SBAS 152-158
-				} else if sv <= 202 {
-					svType = SAT_TYPE_QZSS
-					svStr = fmt.Sprintf("Q%d", sv-192) // QZSS 193-202
-				} else if sv <= 336 {
-					svType = SAT_TYPE_GALILEO
-					svStr = fmt.Sprintf("E%d", sv-300) // GALILEO 301-336
-				} else if sv <= 463 {
-					svType = SAT_TYPE_BEIDOU
-					svStr = fmt.Sprintf("B%d", sv-400) // BEIDOU 401-463
-				} else {
-					svType = SAT_TYPE_UNKNOWN
-					svStr = fmt.Sprintf("U%d", sv)
-				}
-
-				var thisSatellite SatelliteInfo
-
-				// Retrieve previous information on this satellite code.
-				if val, ok := Satellites[svStr]; ok { // if we've already seen this satellite identifier, copy it in to do updates
-					thisSatellite = val
-					//log.Printf("Satellite %s already seen. Retrieving from 'Satellites'.\n", svStr)
-				} else { // this satellite isn't in the Satellites data structure, so create it
-					thisSatellite.SatelliteID = svStr
-					// Bounds checking: ensure satellite number fits in uint8 range
-					if sv < 0 || sv > 255 {
-						thisSatellite.SatelliteNMEA = 255 // Use max value if out of range
-					} else {
-						thisSatellite.SatelliteNMEA = uint8(sv)
-					}
-					// Bounds checking: ensure type fits in uint8 range
-					if svType < 0 || svType > 255 {
-						thisSatellite.Type = 0 // Use 0 (unknown) if out of range
-					} else {
-						thisSatellite.Type = uint8(svType)
-					}
-					//log.Printf("Creating new satellite %s from GSA message\n", svStr) // DEBUG
-				}
-				thisSatellite.InSolution = true
-				thisSatellite.TimeLastSolution = stratuxClock.Time
-				thisSatellite.TimeLastSeen = stratuxClock.Time    // implied, since this satellite is used in the position solution
-				thisSatellite.TimeLastTracked = stratuxClock.Time // implied, since this satellite is used in the position solution
-
-				Satellites[thisSatellite.SatelliteID] = thisSatellite // Update constellation with this satellite
-			}
-		}
-		updateConstellation()
-		tmpSituation.GPSSatellites = mySituation.GPSSatellites
-		tmpSituation.GPSSatellitesTracked = mySituation.GPSSatellitesTracked
-		tmpSituation.GPSSatellitesSeen = mySituation.GPSSatellitesSeen
-		mySituation.muSatellite.Unlock()
-		// END OF PROTECTED BLOCK
-
-		// Prefer accuracy from G?GST. Only if not received, estimate from hdop/vdop
-		if stratuxClock.Since(tmpSituation.GPSLastAccuracyTime) > 10*time.Second {
-			// field 16: HDOP
-			// Accuracy estimate
-			hdop, err1 := strconv.ParseFloat(x[16], 32)
-			if err1 != nil {
-				return false
-			}
-			if tmpSituation.GPSFixQuality == 2 { // Rough 95% confidence estimate for SBAS solution
-				if globalStatus.GPS_detected_type == GPS_TYPE_UBX9 || globalStatus.GPS_detected_type == GPS_TYPE_UBX10 {
-					tmpSituation.GPSHorizontalAccuracy = float32(hdop * 3.0) // ublox 9
-				} else {
-					tmpSituation.GPSHorizontalAccuracy = float32(hdop * 4.0) // ublox 6/7/8
-				}
-			} else { // Rough 95% confidence estimate non-SBAS solution
-				if globalStatus.GPS_detected_type == GPS_TYPE_UBX9 || globalStatus.GPS_detected_type == GPS_TYPE_UBX10 {
-					tmpSituation.GPSHorizontalAccuracy = float32(hdop * 4.0) // ublox 9
-				} else {
-					tmpSituation.GPSHorizontalAccuracy = float32(hdop * 5.0) // ublox 6/7/8
-				}
-			}
-
-			// NACp estimate.
-			tmpSituation.GPSNACp = calculateNACp(tmpSituation.GPSHorizontalAccuracy)
-
-			// field 17: VDOP
-			// accuracy estimate
-			vdop, err1 := strconv.ParseFloat(x[17], 32)
-			if err1 != nil {
-				return false
-			}
-			tmpSituation.GPSVerticalAccuracy = float32(vdop * 5) // rough estimate for 95% confidence
-
-			//fmt.Println("hdop hacc: ", tmpSituation.GPSHorizontalAccuracy, ", vacc: ", tmpSituation.GPSVerticalAccuracy)
-		}
-
-		// We've made it this far, so that means we've processed "everything" and can now make the change to mySituation.
-		mySituation = tmpSituation
-		return true
-
 	}
 
-	if x[0] == "GNGST" || x[0] == "GPGST" {
+	if isGNSS && nmea.sentence == "GST" {
 		if len(x) < 9 {
 			return false
 		}
@@ -1584,6 +1501,7 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 		//fmt.Println("gst hacc: ", hacc, ", vacc: ", vacc)
 
 		tmpSituation := mySituation
+		gpsLastGSTTime = stratuxClock.Time
 		tmpSituation.GPSLastAccuracyTime = stratuxClock.Time
 		tmpSituation.GPSHorizontalAccuracy = float32(hacc)
 		tmpSituation.GPSVerticalAccuracy = float32(vacc)
@@ -1593,182 +1511,6 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 
 	}
 
-	if (x[0] == "GPGSV") || (x[0] == "GLGSV") || (x[0] == "GAGSV") || (x[0] == "GBGSV") { // GPS + SBAS or GLONASS or Galileo or Beidou satellites in view message.
-		if len(x) < 4 {
-			return false
-		}
-
-		// field 1 = number of GSV messages of this type
-		msgNum, err := strconv.Atoi(x[2])
-		if err != nil {
-			return false
-		}
-
-		// field 2 = index of this GSV message
-
-		msgIndex, err := strconv.Atoi(x[2])
-		if err != nil {
-			return false
-		}
-
-		// field 3 = number of GPS satellites tracked
-		/* Is this redundant if parsing from full constellation?
-		satTracked, err := strconv.Atoi(x[3])
-		if err != nil {
-			return false
-		}
-		*/
-
-		//mySituation.GPSSatellitesTracked = uint16(satTracked) // Replaced with parsing of 'Satellites' data structure
-
-		// field 4-7 = repeating block with satellite id, elevation, azimuth, and signal strengh (Cno)
-
-		lenGSV := len(x)
-		satsThisMsg := (lenGSV - 4) / 4
-
-		logDbg("%s message [%d of %d] is %v fields long and describes %v satellites\n", x[0], msgIndex, msgNum, lenGSV, satsThisMsg)
-
-		var sv, elev, az, cno int
-		var svType uint8
-		var svStr string
-
-		for i := 0; i < satsThisMsg; i++ {
-
-			sv, err = strconv.Atoi(x[4+4*i]) // sv number
-			if err != nil {
-				return false
-			}
-
-			if sv <= 32 {
-				svType = SAT_TYPE_GPS
-				svStr = fmt.Sprintf("G%d", sv) // GPS 1-32
-			} else if sv <= 64 {
-				svType = SAT_TYPE_SBAS
-				svStr = fmt.Sprintf("S%d", sv+87) // SBAS 33-64, 33 = SBAS PRN 120
-			} else if sv <= 96 {
-				svType = SAT_TYPE_GLONASS
-				svStr = fmt.Sprintf("R%d", sv-64) // GLONASS 65-96
-			} else if sv <= 158 {
-				svType = SAT_TYPE_SBAS
-				svStr = fmt.Sprintf("S%d", sv) // SBAS 152-158
-			} else if sv <= 202 {
-				svType = SAT_TYPE_QZSS
-				svStr = fmt.Sprintf("Q%d", sv-192) // QZSS 193-202
-			} else if sv <= 336 {
-				svType = SAT_TYPE_GALILEO
-				svStr = fmt.Sprintf("E%d", sv-300) // GALILEO 301-336
-			} else if sv <= 463 {
-				svType = SAT_TYPE_BEIDOU
-				svStr = fmt.Sprintf("B%d", sv-400) // BEIDOU 401-463
-			} else {
-				svType = SAT_TYPE_UNKNOWN
-				svStr = fmt.Sprintf("U%d", sv)
-			}
-
-			var thisSatellite SatelliteInfo
-
-			// START OF PROTECTED BLOCK
-			mySituation.muSatellite.Lock()
-
-			// Retrieve previous information on this satellite code.
-			if val, ok := Satellites[svStr]; ok { // if we've already seen this satellite identifier, copy it in to do updates
-				thisSatellite = val
-				//log.Printf("Satellite %s already seen. Retrieving from 'Satellites'.\n", svStr) // DEBUG
-			} else { // this satellite isn't in the Satellites data structure, so create it new
-				thisSatellite.SatelliteID = svStr
-				// Bounds checking: ensure satellite number fits in uint8 range
-				if sv < 0 || sv > 255 {
-					thisSatellite.SatelliteNMEA = 255 // Use max value if out of range
-				} else {
-					thisSatellite.SatelliteNMEA = uint8(sv)
-				}
-				// Bounds checking: ensure type fits in uint8 range
-				if svType < 0 || svType > 255 {
-					thisSatellite.Type = 0 // Use 0 (unknown) if out of range
-				} else {
-					thisSatellite.Type = uint8(svType)
-				}
-				//log.Printf("Creating new satellite %s\n", svStr) // DEBUG
-			}
-			thisSatellite.TimeLastTracked = stratuxClock.Time
-
-			elev, err = strconv.Atoi(x[5+4*i]) // elevation
-			if err != nil {                    // some firmwares leave this blank if there's no position fix. Represent as -999.
-				elev = -999
-			}
-			// Bounds checking: ensure elevation fits in int16 range (-32768 to 32767)
-			// Clamp and convert to int16 in single expression for data flow analysis
-			if elev < -32768 {
-				thisSatellite.Elevation = -999 // Use invalid marker if out of range
-			} else if elev > 32767 {
-				thisSatellite.Elevation = -999 // Use invalid marker if out of range
-			} else {
-				thisSatellite.Elevation = int16(elev)
-			}
-
-			az, err = strconv.Atoi(x[6+4*i]) // azimuth
-			if err != nil {                  // UBX allows tracking up to 5(?) degrees below horizon. Some firmwares leave this blank if no position fix. Represent invalid as -999.
-				az = -999
-			}
-			// Bounds checking: ensure azimuth fits in int16 range (-32768 to 32767)
-			// Clamp and convert to int16 in single expression for data flow analysis
-			if az < -32768 {
-				thisSatellite.Azimuth = -999 // Use invalid marker if out of range
-			} else if az > 32767 {
-				thisSatellite.Azimuth = -999 // Use invalid marker if out of range
-			} else {
-				thisSatellite.Azimuth = int16(az)
-			}
-
-			cno, err = strconv.Atoi(x[7+4*i]) // signal
-			if err != nil {                   // will be blank if satellite isn't being received. Represent as -99.
-				cno = -99
-				thisSatellite.InSolution = false // resets the "InSolution" status if the satellite disappears out of solution due to no signal. FIXME
-				//log.Printf("Satellite %s is no longer in solution due to cno parse error - GSV\n", svStr) // DEBUG
-			} else if cno > 0 {
-				thisSatellite.TimeLastSeen = stratuxClock.Time // Is this needed?
-			}
-			// Bounds checking: ensure signal fits in int8 range (-128 to 127)
-			// Clamp and convert to int8 in single expression for data flow analysis
-			if cno < -128 {
-				thisSatellite.Signal = -99 // Use invalid marker if out of range
-			} else if cno > 127 {
-				thisSatellite.Signal = 127 // Make sure strong signals don't overflow. Normal range is 0-99.
-			} else {
-				thisSatellite.Signal = int8(cno)
-			}
-
-			// hack workaround for GSA 12-sv limitation... if this is a SBAS satellite, we have a SBAS solution, and signal is greater than some arbitrary threshold, set InSolution
-			// drawback is this will show all tracked SBAS satellites as being in solution.
-			if thisSatellite.Type == SAT_TYPE_SBAS {
-				if mySituation.GPSFixQuality == 2 {
-					if thisSatellite.Signal > 16 {
-						thisSatellite.InSolution = true
-						thisSatellite.TimeLastSolution = stratuxClock.Time
-					}
-				} else { // quality == 0 or 1
-					thisSatellite.InSolution = false
-					//log.Printf("WAAS satellite %s is marked as out of solution GSV\n", svStr) // DEBUG
-				}
-			}
-
-			if globalSettings.DEBUG {
-				inSolnStr := " "
-				if thisSatellite.InSolution {
-					inSolnStr = "+"
-				}
-				log.Printf("GSV: Satellite %s%s at index %d. Type = %d, NMEA-ID = %d, Elev = %d, Azimuth = %d, Cno = %d\n", inSolnStr, svStr, i, svType, sv, elev, az, cno) // remove later?
-			}
-
-			Satellites[thisSatellite.SatelliteID] = thisSatellite // Update constellation with this satellite
-			updateConstellation()
-			mySituation.muSatellite.Unlock()
-			// END OF PROTECTED BLOCK
-		}
-
-		return true
-	}
-
 	// OGN Tracker pressure data:
 	// $POGNB,22.0,+29.1,100972.3,3.8,+29.4,+87.2,-0.04,+32.6,*6B
 	if x[0] == "POGNB" {
@@ -1791,9 +1533,12 @@ func processNMEALineLow(l string, fakeGpsTimeToCurr bool) (sentenceUsed bool) {
 			mySituation.muBaro.Lock()
 			mySituation.BaroPressureAltitude = float32(pressureAlt * 3.28084) // meters to feet
 			mySituation.BaroVerticalSpeed = float32(vspeed * 196.85)          // m/s in ft/min
+			mySituation.BaroVario = mySituation.BaroVerticalSpeed
+			mySituation.BaroTEVario = mySituation.BaroVerticalSpeed
 			mySituation.BaroLastMeasurementTime = stratuxClock.Time
 			mySituation.BaroSourceType = BARO_TYPE_OGNTRACKER
 			mySituation.muBaro.Unlock()
+			sendVarioNMEA()
 		}
 		return true
 	}
@@ -1985,12 +1730,17 @@ func gpsSerialReader() {
 
 	i := 0 //debug monitor
 	scanner := bufio.NewScanner(serialPort)
+	scanner.Split(scanNMEAUBX) // u-blox receivers may interleave binary UBX messages with the NMEA sentences.
 	for scanner.Scan() && globalStatus.GPS_connected && globalSettings.GPS_Enabled {
 		i++
 		if globalSettings.DEBUG && i%100 == 0 {
 			log.Printf("gpsSerialReader() scanner loop iteration i=%d\n", i) // debug monitor
 		}
 
+		if isUBXFrame(scanner.Bytes()) {
+			processUBXMessage(scanner.Bytes())
+			continue
+		}
 		s := scanner.Text()
 		// Split the line into individual NMEA messages
 		messages := strings.Split(s, "$")
@@ -2211,6 +1961,19 @@ func gpsAttitudeSender() {
 	}
 }
 
+// recordGPSPerf appends a position / velocity sample to myGPSPerfStats, if it is from the active GNSS source.
+func recordGPSPerf(perf gpsPerfStats) {
+	if !gnssSources.currentIsActive() {
+		return
+	}
+	mySituation.muGPSPerformance.Lock()
+	myGPSPerfStats = append(myGPSPerfStats, perf)
+	if lenGPSPerfStats := len(myGPSPerfStats); lenGPSPerfStats > 299 { //30 seconds @ 10 Hz for UBX, 30 seconds @ 5 Hz for MTK or SIRF with 2x messages per 200 ms)
+		myGPSPerfStats = myGPSPerfStats[(lenGPSPerfStats - 299):] // remove the first n entries if more than 300 in the slice
+	}
+	mySituation.muGPSPerformance.Unlock()
+}
+
 /*
 	updateConstellation(): Periodic cleanup and statistics calculation for 'Satellites'
 		data structure. Calling functions must protect this in a mySituation.muSatellite.
@@ -0,0 +1,618 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	gps_nmea.go: NMEA 4.x GNSS sentences (GNS, GBS, GSA, GSV) for every talker, with the NMEA 4.10
+	 system and signal IDs, so multi-constellation, multi-band receivers report each satellite once.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+// nmeaSentence is a checksum-validated sentence of a GNSS talker, split at the commas.
+type nmeaSentence struct {
+	talker   string   // e.g. "GP", "GN"
+	sentence string   // e.g. "GGA"
+	system   uint8    // SAT_TYPE_* of the talker. SAT_TYPE_UNKNOWN for the combined "GN" talker.
+	fields   []string // fields[0] is the address, e.g. "GPGGA"
+}
+
+// nmeaTalkerSystems maps the talker IDs of GNSS receivers onto the constellation they report.
+var nmeaTalkerSystems = map[string]uint8{
+	"GN": SAT_TYPE_UNKNOWN, // Combined solution of several constellations.
+	"GP": SAT_TYPE_GPS,
+	"GL": SAT_TYPE_GLONASS,
+	"GA": SAT_TYPE_GALILEO,
+	"GB": SAT_TYPE_BEIDOU,
+	"BD": SAT_TYPE_BEIDOU, // Pre-4.10 BeiDou talker.
+	"GQ": SAT_TYPE_QZSS,
+	"QZ": SAT_TYPE_QZSS, // Pre-4.10 QZSS talker.
+	"GI": SAT_TYPE_NAVIC,
+}
+
+// nmeaSystemIDs maps the NMEA 4.10 GNSS system ID of GSA, GBS (and GRS, GST in 4.11) onto our satellite types.
+var nmeaSystemIDs = map[uint64]uint8{
+	1: SAT_TYPE_GPS,
+	2: SAT_TYPE_GLONASS,
+	3: SAT_TYPE_GALILEO,
+	4: SAT_TYPE_BEIDOU,
+	5: SAT_TYPE_QZSS,
+	6: SAT_TYPE_NAVIC,
+}
+
+// nmeaSignalNames maps the NMEA 4.10 signal IDs (GSV, GBS) of each system onto the signal name. 0 means "all signals".
+var nmeaSignalNames = map[uint8]map[uint64]string{
+	SAT_TYPE_GPS:     {1: "L1 C/A", 2: "L1 P(Y)", 3: "L1 M", 4: "L2 P(Y)", 5: "L2C-M", 6: "L2C-L", 7: "L5-I", 8: "L5-Q"},
+	SAT_TYPE_GLONASS: {1: "G1 C/A", 2: "G1 P", 3: "G2 C/A", 4: "G2 P"},
+	SAT_TYPE_GALILEO: {1: "E5a", 2: "E5b", 3: "E5 AltBOC", 4: "E6-A", 5: "E6-BC", 6: "E1-A", 7: "E1-BC"},
+	SAT_TYPE_BEIDOU:  {1: "B1I", 2: "B1Q", 3: "B1C", 4: "B1A", 5: "B2a", 6: "B2b", 7: "B2a+b", 8: "B3I", 9: "B3Q", 10: "B3A", 11: "B2I", 12: "B2Q"},
+	SAT_TYPE_QZSS:    {1: "L1 C/A", 2: "L1C (D)", 3: "L1C (P)", 4: "LIS", 5: "L2C-M", 6: "L2C-L", 7: "L5-I", 8: "L5-Q", 9: "L6D", 10: "L6E"},
+	SAT_TYPE_NAVIC:   {1: "L5 SPS", 2: "S SPS", 3: "L5 RS", 4: "S RS", 5: "L1 SPS"},
+}
+
+// nmeaSentenceParsers handles the sentences that are the same for every GNSS talker. VTG, GGA, RMC and GST
+// are parsed in processNMEALineSource, as they share the GPS performance bookkeeping there.
+var nmeaSentenceParsers = map[string]func(nmeaSentence) bool{
+	"GNS": processNMEAGNS,
+	"GBS": processNMEAGBS,
+	"GSA": processNMEAGSA,
+	"GSV": processNMEAGSV,
+}
+
+// nmeaModeQualities ranks the GNS/RMC mode indicators, best first, with the GGA fix quality they correspond to.
+var nmeaModeQualities = []struct {
+	mode    byte
+	quality uint8
+}{
+	{'R', 4}, // RTK fixed
+	{'F', 5}, // RTK float
+	{'D', 2}, // Differential (SBAS)
+	{'P', 1}, // Precise
+	{'A', 1}, // Autonomous
+	{'E', 6}, // Estimated (dead reckoning)
+}
+
+// gpsLastGSTTime is the last time a GST sentence supplied the accuracy. It's preferred over GBS.
+var gpsLastGSTTime time.Time
+
+// parseNMEAAddress splits the address field into talker and sentence. Returns false if it's not a GNSS talker.
+func parseNMEAAddress(x []string) (nmeaSentence, bool) {
+	if len(x[0]) != 5 {
+		return nmeaSentence{fields: x}, false
+	}
+	system, ok := nmeaTalkerSystems[x[0][:2]]
+	return nmeaSentence{talker: x[0][:2], sentence: x[0][2:], system: system, fields: x}, ok
+}
+
+// nmeaSystem returns the system of an NMEA 4.10 system ID field, or def if the field is empty or unknown.
+func nmeaSystem(field string, def uint8) uint8 {
+	id, err := strconv.ParseUint(field, 16, 8)
+	if err != nil {
+		return def
+	}
+	if system, ok := nmeaSystemIDs[id]; ok {
+		return system
+	}
+	return def
+}
+
+// nmeaSignalName returns the name of an NMEA 4.10 signal ID, "" for "all signals" or pre-4.10 sentences.
+func nmeaSignalName(system uint8, field string) string {
+	id, err := strconv.ParseUint(field, 16, 8)
+	if err != nil || id == 0 {
+		return ""
+	}
+	if name, ok := nmeaSignalNames[system][id]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %X", id)
+}
+
+// nmeaModeFixQuality returns the GGA fix quality for the GNS mode indicator (one character per system) or the
+// RMC mode indicator. 0 if no system has a fix.
+func nmeaModeFixQuality(mode string) uint8 {
+	for _, m := range nmeaModeQualities {
+		if strings.IndexByte(mode, m.mode) >= 0 {
+			return m.quality
+		}
+	}
+	return 0
+}
+
+// nmeaNavStatusUsable checks the NMEA 4.10 navigational status of RMC and GNS: S = safe, C = caution,
+// U = unsafe, V = not valid. An unsafe solution is used, but raises an integrity alert.
+func nmeaNavStatusUsable(status string) bool {
+	switch status {
+	case "V":
+		return false
+	case "U":
+		gnssIntegrity.report(GNSS_ALERT_RAIM, stratuxClock.Time, "receiver reports the navigational status as unsafe")
+	}
+	return true
+}
+
+/*
+nmeaSatelliteID maps the satellite number of a GSA, GSV or GBS sentence onto the satellite naming used in
+'Satellites' (e.g. G5, R3, E12), the NMEA-ID and the satellite type.
+
+With a known system (talker or NMEA 4.10 system ID), the number may be the PRN within that system, as
+sent by NMEA 4.10+ receivers. Otherwise, or if the number doesn't fit that, the pre-4.10 extended
+numbering is assumed, in which every constellation has its own range.
+*/
+func nmeaSatelliteID(system uint8, sv int) (svStr string, nmeaId int, svType uint8) {
+	switch system {
+	case SAT_TYPE_GLONASS:
+		if sv >= 65 && sv <= 96 {
+			return fmt.Sprintf("R%d", sv-64), sv, SAT_TYPE_GLONASS
+		} else if sv >= 1 && sv <= 32 {
+			return fmt.Sprintf("R%d", sv), sv + 64, SAT_TYPE_GLONASS
+		}
+	case SAT_TYPE_GALILEO:
+		if sv >= 1 && sv <= 36 {
+			return fmt.Sprintf("E%d", sv), sv + 300, SAT_TYPE_GALILEO
+		} else if sv >= 301 && sv <= 336 {
+			return fmt.Sprintf("E%d", sv-300), sv, SAT_TYPE_GALILEO
+		}
+	case SAT_TYPE_BEIDOU:
+		if sv >= 1 && sv <= 63 {
+			return fmt.Sprintf("B%d", sv), sv + 400, SAT_TYPE_BEIDOU
+		} else if sv >= 201 && sv <= 263 {
+			return fmt.Sprintf("B%d", sv-200), sv + 200, SAT_TYPE_BEIDOU
+		} else if sv >= 401 && sv <= 463 {
+			return fmt.Sprintf("B%d", sv-400), sv, SAT_TYPE_BEIDOU
+		}
+	case SAT_TYPE_QZSS:
+		if sv >= 1 && sv <= 10 {
+			return fmt.Sprintf("Q%d", sv), sv + 192, SAT_TYPE_QZSS
+		} else if sv >= 193 && sv <= 202 {
+			return fmt.Sprintf("Q%d", sv-192), sv, SAT_TYPE_QZSS
+		}
+	case SAT_TYPE_NAVIC:
+		if sv >= 1 && sv <= 14 {
+			return fmt.Sprintf("I%d", sv), sv, SAT_TYPE_NAVIC
+		}
+	}
+
+	// GPS, SBAS, and the extended numbering of NMEA before 4.10.
+	if sv <= 32 {
+		return fmt.Sprintf("G%d", sv), sv, SAT_TYPE_GPS // GPS 1-32
+	} else if sv <= 64 {
+		return fmt.Sprintf("S%d", sv+87), sv, SAT_TYPE_SBAS // SBAS 33-64, 33 = SBAS PRN 120
+	} else if sv <= 96 {
+		return fmt.Sprintf("R%d", sv-64), sv, SAT_TYPE_GLONASS // GLONASS 65-96
+	} else if sv <= 158 {
+		return fmt.Sprintf("S%d", sv), sv, SAT_TYPE_SBAS // SBAS 152-158
+	} else if sv <= 202 {
+		return fmt.Sprintf("Q%d", sv-192), sv, SAT_TYPE_QZSS // QZSS 193-202
+	} else if sv <= 336 {
+		return fmt.Sprintf("E%d", sv-300), sv, SAT_TYPE_GALILEO // GALILEO 301-336
+	} else if sv <= 463 {
+		return fmt.Sprintf("B%d", sv-400), sv, SAT_TYPE_BEIDOU // BEIDOU 401-463
+	}
+	return fmt.Sprintf("U%d", sv), sv, SAT_TYPE_UNKNOWN
+}
+
+// nmeaSatellite returns the current record of a satellite, or a new one if it isn't in 'Satellites' yet.
+// muSatellite must be held.
+func nmeaSatellite(svStr string, nmeaId int, svType uint8) SatelliteInfo {
+	if val, ok := Satellites[svStr]; ok { // if we've already seen this satellite identifier, copy it in to do updates
+		return val
+	}
+	thisSatellite := SatelliteInfo{SatelliteID: svStr, Type: svType}
+	// Bounds checking: ensure satellite number fits in uint8 range
+	if nmeaId < 0 || nmeaId > 255 {
+		thisSatellite.SatelliteNMEA = 255 // Use max value if out of range
+	} else {
+		thisSatellite.SatelliteNMEA = uint8(nmeaId)
+	}
+	return thisSatellite
+}
+
+// parseNMEATimeOfDay parses a hhmmss.ss time field into seconds since midnight UTC.
+func parseNMEATimeOfDay(field string) (float32, bool) {
+	if len(field) < 7 {
+		return 0, false
+	}
+	hr, err1 := strconv.Atoi(field[0:2])
+	min, err2 := strconv.Atoi(field[2:4])
+	sec, err3 := strconv.ParseFloat(field[4:], 32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return float32(3600*hr+60*min) + float32(sec), true
+}
+
+// parseNMEALatLon parses the ddmm.mmm,N/S,dddmm.mmm,E/W position fields.
+func parseNMEALatLon(latField, ns, lonField, ew string) (lat, lon float32, ok bool) {
+	if len(latField) < 4 || len(lonField) < 5 {
+		return 0, 0, false
+	}
+	latDeg, err1 := strconv.Atoi(latField[0:2])
+	latMin, err2 := strconv.ParseFloat(latField[2:], 32)
+	lonDeg, err3 := strconv.Atoi(lonField[0:3])
+	lonMin, err4 := strconv.ParseFloat(lonField[3:], 32)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return 0, 0, false
+	}
+	lat = float32(latDeg) + float32(latMin/60.0)
+	if ns == "S" { // South = negative.
+		lat = -lat
+	}
+	lon = float32(lonDeg) + float32(lonMin/60.0)
+	if ew == "W" { // West = negative.
+		lon = -lon
+	}
+	return lat, lon, true
+}
+
+/*
+processNMEAGNS: GNSS fix data, the multi-constellation successor of GGA.
+
+	$GNGNS,123519.00,4807.038,N,01131.000,E,ADNN,12,0.9,545.4,46.9,,,S*xx
+	fields: time, lat, N/S, lon, E/W, mode (one character per system: GPS, GLONASS, Galileo, BeiDou,
+	QZSS, NavIC), satellites used, HDOP, altitude MSL (m), geoid separation (m), age and station of
+	differential data, navigational status (NMEA 4.10).
+*/
+func processNMEAGNS(s nmeaSentence) bool {
+	x := s.fields
+	if len(x) < 13 {
+		return false
+	}
+
+	// use RMC / GGA message detection to sense "NMEA" type.
+	if (globalStatus.GPS_detected_type & 0xf0) == 0 {
+		globalStatus.GPS_detected_type |= GPS_PROTOCOL_NMEA
+	}
+
+	quality := nmeaModeFixQuality(x[6])
+	if quality == 0 {
+		return false
+	}
+	if len(x) > 13 && !nmeaNavStatusUsable(x[13]) {
+		return false
+	}
+
+	tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
+	tmpSituation.GPSFixQuality = quality
+
+	fixTime, ok := parseNMEATimeOfDay(x[1])
+	if !ok {
+		return false
+	}
+	tmpSituation.GPSLastFixSinceMidnightUTC = fixTime
+
+	tmpSituation.GPSLatitude, tmpSituation.GPSLongitude, ok = parseNMEALatLon(x[2], x[3], x[4], x[5])
+	if !ok {
+		return false
+	}
+
+	alt, err := strconv.ParseFloat(x[9], 32)
+	if err != nil {
+		return false
+	}
+	tmpSituation.GPSAltitudeMSL = float32(alt * 3.28084) // Convert to feet.
+
+	// Geoid separation (Sep = HAE - MSL). Same fallback as GGA for receivers without geoid model.
+	geoidSep, err := strconv.ParseFloat(x[10], 32)
+	if x[10] != "" && err != nil {
+		return false
+	}
+	if geoidSep == 0 {
+		geoidSep = common.GeoidHeight(float64(tmpSituation.GPSLatitude), float64(tmpSituation.GPSLongitude))
+		tmpSituation.GPSAltitudeMSL -= float32(geoidSep * 3.28084)
+	}
+	tmpSituation.GPSGeoidSep = float32(geoidSep * 3.28084) // Convert to feet.
+	tmpSituation.GPSHeightAboveEllipsoid = tmpSituation.GPSGeoidSep + tmpSituation.GPSAltitudeMSL
+
+	tmpSituation.GPSLastFixLocalTime = stratuxClock.Time
+
+	// We've made it this far, so that means we've processed "everything" and can now make the change to mySituation.
+	mySituation = tmpSituation
+
+	thisGpsPerf := gpsPerf
+	thisGpsPerf.stratuxTime = stratuxClock.Milliseconds
+	thisGpsPerf.coursef = -999.9
+	thisGpsPerf.nmeaTime = fixTime
+	thisGpsPerf.alt = mySituation.GPSAltitudeMSL
+	thisGpsPerf.msgType = x[0]
+	recordGPSPerf(thisGpsPerf)
+	return true
+}
+
+/*
+processNMEAGBS: GNSS satellite fault detection (RAIM).
+
+	$GPGBS,123519.00,1.2,0.9,2.1,05,0.01,25.3,3.1,1,0*xx
+	fields: time, expected 1-sigma error of latitude, longitude and altitude (m), ID of the most likely
+	failed satellite (empty if none), probability of missed detection, bias estimate and its standard
+	deviation (m), system ID and signal ID (NMEA 4.10).
+*/
+func processNMEAGBS(s nmeaSentence) bool {
+	x := s.fields
+	if len(x) < 9 {
+		return false
+	}
+	used := false
+
+	if sv, err := strconv.Atoi(x[5]); err == nil {
+		system := s.system
+		if len(x) > 9 {
+			system = nmeaSystem(x[9], system)
+		}
+		svStr, _, _ := nmeaSatelliteID(system, sv)
+		// START OF PROTECTED BLOCK
+		mySituation.muSatellite.Lock()
+		if thisSatellite, ok := Satellites[svStr]; ok {
+			thisSatellite.InSolution = false
+			Satellites[svStr] = thisSatellite
+			updateConstellation()
+		}
+		mySituation.muSatellite.Unlock()
+		// END OF PROTECTED BLOCK
+		gnssIntegrity.report(GNSS_ALERT_RAIM, stratuxClock.Time, "receiver RAIM detected a faulty satellite %s", svStr)
+		used = true
+	}
+
+	// Expected errors, if the receiver doesn't send the (equivalent) GST.
+	errLat, err1 := strconv.ParseFloat(x[2], 32)
+	errLon, err2 := strconv.ParseFloat(x[3], 32)
+	errAlt, err3 := strconv.ParseFloat(x[4], 32)
+	if err1 != nil || err2 != nil || err3 != nil || stratuxClock.Since(gpsLastGSTTime) < 10*time.Second {
+		return used
+	}
+	// Care: 1-sigma (68%) deviation like GST. We use 2-sigma (~95%)
+	tmpSituation := mySituation
+	tmpSituation.GPSLastAccuracyTime = stratuxClock.Time
+	tmpSituation.GPSHorizontalAccuracy = float32(2 * math.Sqrt(errLat*errLat+errLon*errLon))
+	tmpSituation.GPSVerticalAccuracy = float32(2 * errAlt)
+	tmpSituation.GPSNACp = calculateNACp(tmpSituation.GPSHorizontalAccuracy)
+	mySituation = tmpSituation
+	return true
+}
+
+/*
+processNMEAGSA: DOP and active satellites.
+
+	$GNGSA,A,3,05,07,13,,,,,,,,,,1.6,0.9,1.3,1*xx
+	fields: mode (M/A), fix type (1 = none, 2 = 2D, 3 = 3D), 12 satellites used in the solution, PDOP,
+	HDOP, VDOP, system ID (NMEA 4.10). Receivers using the GN talker send one GSA per system.
+*/
+func processNMEAGSA(s nmeaSentence) bool {
+	x := s.fields
+	tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
+
+	if len(x) < 18 {
+		return false
+	}
+
+	// field 1: operation mode
+	// M: manual forced to 2D or 3D mode
+	// A: automatic switching between 2D and 3D modes
+
+	// field 2: solution type
+	// 1 = no solution; 2 = 2D fix, 3 = 3D fix. WAAS status is parsed from GGA message, so no need to get here
+	if (x[2] == "") || (x[2] == "1") { // missing or no solution
+		tmpSituation.GPSFixQuality = 0 // Just a note.
+		return false
+	}
+
+	// field 18: system ID. Without it, the satellite numbers of the GN talker are in the extended numbering.
+	system := s.system
+	if len(x) > 18 {
+		system = nmeaSystem(x[18], system)
+	}
+
+	// fields 3-14: satellites in solution
+
+	// START OF PROTECTED BLOCK
+	mySituation.muSatellite.Lock()
+
+	for _, svtxt := range x[3:15] {
+		sv, err := strconv.Atoi(svtxt)
+		if err != nil {
+			continue
+		}
+		thisSatellite := nmeaSatellite(nmeaSatelliteID(system, sv))
+		thisSatellite.InSolution = true
+		thisSatellite.TimeLastSolution = stratuxClock.Time
+		thisSatellite.TimeLastSeen = stratuxClock.Time    // implied, since this satellite is used in the position solution
+		thisSatellite.TimeLastTracked = stratuxClock.Time // implied, since this satellite is used in the position solution
+
+		Satellites[thisSatellite.SatelliteID] = thisSatellite // Update constellation with this satellite
+	}
+	updateConstellation()
+	tmpSituation.GPSSatellites = mySituation.GPSSatellites
+	tmpSituation.GPSSatellitesTracked = mySituation.GPSSatellitesTracked
+	tmpSituation.GPSSatellitesSeen = mySituation.GPSSatellitesSeen
+	mySituation.muSatellite.Unlock()
+	// END OF PROTECTED BLOCK
+
+	// fields 15-17: PDOP, HDOP, VDOP
+	if pdop, err := strconv.ParseFloat(x[15], 32); err == nil {
+		tmpSituation.GPSPositionDOP = float32(pdop)
+	}
+	if hdop, err := strconv.ParseFloat(x[16], 32); err == nil {
+		tmpSituation.GPSHorizontalDOP = float32(hdop)
+	}
+	if vdop, err := strconv.ParseFloat(x[17], 32); err == nil {
+		tmpSituation.GPSVerticalDOP = float32(vdop)
+	}
+
+	// Prefer accuracy from G?GST or G?GBS. Only if not received, estimate from hdop/vdop
+	if stratuxClock.Since(tmpSituation.GPSLastAccuracyTime) > 10*time.Second {
+		// field 16: HDOP
+		// Accuracy estimate
+		hdop, err1 := strconv.ParseFloat(x[16], 32)
+		if err1 != nil {
+			return false
+		}
+		if tmpSituation.GPSFixQuality == 2 { // Rough 95% confidence estimate for SBAS solution
+			if globalStatus.GPS_detected_type == GPS_TYPE_UBX9 || globalStatus.GPS_detected_type == GPS_TYPE_UBX10 {
+				tmpSituation.GPSHorizontalAccuracy = float32(hdop * 3.0) // ublox 9
+			} else {
+				tmpSituation.GPSHorizontalAccuracy = float32(hdop * 4.0) // ublox 6/7/8
+			}
+		} else { // Rough 95% confidence estimate non-SBAS solution
+			if globalStatus.GPS_detected_type == GPS_TYPE_UBX9 || globalStatus.GPS_detected_type == GPS_TYPE_UBX10 {
+				tmpSituation.GPSHorizontalAccuracy = float32(hdop * 4.0) // ublox 9
+			} else {
+				tmpSituation.GPSHorizontalAccuracy = float32(hdop * 5.0) // ublox 6/7/8
+			}
+		}
+
+		// NACp estimate.
+		tmpSituation.GPSNACp = calculateNACp(tmpSituation.GPSHorizontalAccuracy)
+
+		// field 17: VDOP
+		// accuracy estimate
+		vdop, err1 := strconv.ParseFloat(x[17], 32)
+		if err1 != nil {
+			return false
+		}
+		tmpSituation.GPSVerticalAccuracy = float32(vdop * 5) // rough estimate for 95% confidence
+	}
+
+	// We've made it this far, so that means we've processed "everything" and can now make the change to mySituation.
+	mySituation = tmpSituation
+	return true
+}
+
+/*
+processNMEAGSV: satellites in view.
+
+	$GPGSV,3,1,11,05,45,300,42,07,30,060,38,13,12,180,,15,70,045,47,1*xx
+	fields: number of GSV messages, index of this message, satellites in view, then up to four blocks of
+	satellite ID, elevation, azimuth and C/N0 (empty if not received), signal ID (NMEA 4.10).
+	Multi-band receivers send one set of GSV messages per signal.
+*/
+func processNMEAGSV(s nmeaSentence) bool {
+	x := s.fields
+	if len(x) < 4 {
+		return false
+	}
+
+	// field 1 = number of GSV messages of this type
+	msgNum, err := strconv.Atoi(x[1])
+	if err != nil {
+		return false
+	}
+
+	// field 2 = index of this GSV message
+	msgIndex, err := strconv.Atoi(x[2])
+	if err != nil {
+		return false
+	}
+
+	// field 3 = number of satellites in view. Counted from 'Satellites' instead.
+
+	// field 4-7 = repeating block with satellite id, elevation, azimuth, and signal strengh (Cno)
+	// NMEA 4.10 appends the signal ID, which makes the number of fields after the header odd.
+	lenGSV := len(x)
+	satsThisMsg := (lenGSV - 4) / 4
+	signal := ""
+	if (lenGSV-4)%4 == 1 {
+		signal = nmeaSignalName(s.system, x[lenGSV-1])
+	}
+
+	logDbg("%s message [%d of %d] is %v fields long and describes %v satellites\n", x[0], msgIndex, msgNum, lenGSV, satsThisMsg)
+
+	// START OF PROTECTED BLOCK
+	mySituation.muSatellite.Lock()
+	defer mySituation.muSatellite.Unlock()
+
+	for i := 0; i < satsThisMsg; i++ {
+		sv, err := strconv.Atoi(x[4+4*i]) // sv number
+		if err != nil {
+			return false
+		}
+		svStr, nmeaId, svType := nmeaSatelliteID(s.system, sv)
+		thisSatellite := nmeaSatellite(svStr, nmeaId, svType)
+		thisSatellite.TimeLastTracked = stratuxClock.Time
+
+		elev, err := strconv.Atoi(x[5+4*i]) // elevation
+		if err != nil {                     // some firmwares leave this blank if there's no position fix. Represent as -999.
+			elev = -999
+		}
+		if elev < -32768 || elev > 32767 {
+			thisSatellite.Elevation = -999 // Use invalid marker if out of range
+		} else {
+			thisSatellite.Elevation = int16(elev)
+		}
+
+		az, err := strconv.Atoi(x[6+4*i]) // azimuth
+		if err != nil {                   // UBX allows tracking up to 5(?) degrees below horizon. Some firmwares leave this blank if no position fix. Represent invalid as -999.
+			az = -999
+		}
+		if az < -32768 || az > 32767 {
+			thisSatellite.Azimuth = -999 // Use invalid marker if out of range
+		} else {
+			thisSatellite.Azimuth = int16(az)
+		}
+
+		cno, err := strconv.Atoi(x[7+4*i]) // signal
+		if err != nil {                    // will be blank if satellite isn't being received. Represent as -99.
+			cno = -99
+		} else if cno > 127 {
+			cno = 127 // Make sure strong signals don't overflow. Normal range is 0-99.
+		} else if cno < -99 {
+			cno = -99
+		}
+		if signal != "" {
+			// Multi-band: the satellite is received as long as one of its signals is.
+			if thisSatellite.Signals == nil {
+				thisSatellite.Signals = make(map[string]int8)
+			}
+			thisSatellite.Signals[signal] = int8(cno)
+			for _, c := range thisSatellite.Signals {
+				if int(c) > cno {
+					cno = int(c)
+				}
+			}
+		}
+		thisSatellite.Signal = int8(cno)
+		if cno < 0 {
+			thisSatellite.InSolution = false // resets the "InSolution" status if the satellite disappears out of solution due to no signal. FIXME
+		} else if cno > 0 {
+			thisSatellite.TimeLastSeen = stratuxClock.Time // Is this needed?
+		}
+
+		// hack workaround for GSA 12-sv limitation... if this is a SBAS satellite, we have a SBAS solution, and signal is greater than some arbitrary threshold, set InSolution
+		// drawback is this will show all tracked SBAS satellites as being in solution.
+		if thisSatellite.Type == SAT_TYPE_SBAS {
+			if mySituation.GPSFixQuality == 2 {
+				if thisSatellite.Signal > 16 {
+					thisSatellite.InSolution = true
+					thisSatellite.TimeLastSolution = stratuxClock.Time
+				}
+			} else { // quality == 0 or 1
+				thisSatellite.InSolution = false
+			}
+		}
+
+		if globalSettings.DEBUG {
+			inSolnStr := " "
+			if thisSatellite.InSolution {
+				inSolnStr = "+"
+			}
+			log.Printf("GSV: Satellite %s%s at index %d. Type = %d, NMEA-ID = %d, Elev = %d, Azimuth = %d, Cno = %d %s\n", inSolnStr, svStr, i, svType, sv, elev, az, cno, signal) // remove later?
+		}
+
+		Satellites[thisSatellite.SatelliteID] = thisSatellite // Update constellation with this satellite
+	}
+	updateConstellation()
+	// END OF PROTECTED BLOCK
+
+	return true
+}
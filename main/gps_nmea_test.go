@@ -0,0 +1,286 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	gps_nmea_test.go: Unit tests for the NMEA 4.x GNS, GBS, GSA and GSV parsers
+*/
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func resetNMEA4State() {
+	resetGPSState()
+	mySituation.muSatellite.Lock()
+	Satellites = make(map[string]SatelliteInfo)
+	mySituation.muSatellite.Unlock()
+	mySituation.GPSLastAccuracyTime = time.Time{}
+	gpsLastGSTTime = time.Time{}
+	gnssIntegrity = newGNSSIntegrityMonitor()
+}
+
+func TestNMEASatelliteID(t *testing.T) {
+	tests := []struct {
+		name       string
+		system     uint8
+		sv         int
+		wantID     string
+		wantNMEA   int
+		wantSVType uint8
+	}{
+		{"GPS", SAT_TYPE_GPS, 5, "G5", 5, SAT_TYPE_GPS},
+		{"SBAS in GPGSV", SAT_TYPE_GPS, 46, "S133", 46, SAT_TYPE_SBAS},
+		{"GLONASS extended", SAT_TYPE_GLONASS, 67, "R3", 67, SAT_TYPE_GLONASS},
+		{"Galileo 4.10", SAT_TYPE_GALILEO, 12, "E12", 312, SAT_TYPE_GALILEO},
+		{"Galileo extended", SAT_TYPE_GALILEO, 312, "E12", 312, SAT_TYPE_GALILEO},
+		{"BeiDou 4.10", SAT_TYPE_BEIDOU, 30, "B30", 430, SAT_TYPE_BEIDOU},
+		{"BeiDou 201-263", SAT_TYPE_BEIDOU, 214, "B14", 414, SAT_TYPE_BEIDOU},
+		{"QZSS 4.11", SAT_TYPE_QZSS, 3, "Q3", 195, SAT_TYPE_QZSS},
+		{"QZSS extended", SAT_TYPE_QZSS, 195, "Q3", 195, SAT_TYPE_QZSS},
+		{"NavIC", SAT_TYPE_NAVIC, 7, "I7", 7, SAT_TYPE_NAVIC},
+		{"GN talker GLONASS", SAT_TYPE_UNKNOWN, 70, "R6", 70, SAT_TYPE_GLONASS},
+		{"GN talker Galileo", SAT_TYPE_UNKNOWN, 305, "E5", 305, SAT_TYPE_GALILEO},
+		{"Unknown", SAT_TYPE_UNKNOWN, 600, "U600", 600, SAT_TYPE_UNKNOWN},
+	}
+	for _, tt := range tests {
+		id, nmeaId, svType := nmeaSatelliteID(tt.system, tt.sv)
+		if id != tt.wantID || nmeaId != tt.wantNMEA || svType != tt.wantSVType {
+			t.Errorf("%s: nmeaSatelliteID(%d, %d) = %s, %d, %d, want %s, %d, %d", tt.name, tt.system, tt.sv, id, nmeaId, svType, tt.wantID, tt.wantNMEA, tt.wantSVType)
+		}
+	}
+}
+
+func TestParseNMEAAddress(t *testing.T) {
+	tests := []struct {
+		address      string
+		wantGNSS     bool
+		wantSentence string
+		wantSystem   uint8
+	}{
+		{"GPGGA", true, "GGA", SAT_TYPE_GPS},
+		{"GNGNS", true, "GNS", SAT_TYPE_UNKNOWN},
+		{"GQGSV", true, "GSV", SAT_TYPE_QZSS},
+		{"GIGSV", true, "GSV", SAT_TYPE_NAVIC},
+		{"BDGSA", true, "GSA", SAT_TYPE_BEIDOU},
+		{"PGRMZ", false, "", 0},
+		{"POGNB", false, "", 0},
+		{"PFLAU", false, "", 0},
+		{"GPGGAX", false, "", 0},
+	}
+	for _, tt := range tests {
+		s, ok := parseNMEAAddress([]string{tt.address})
+		if ok != tt.wantGNSS || (ok && (s.sentence != tt.wantSentence || s.system != tt.wantSystem)) {
+			t.Errorf("parseNMEAAddress(%s) = %+v, %v", tt.address, s, ok)
+		}
+	}
+}
+
+func TestNMEAGNS(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		navStatus   string
+		wantUsed    bool
+		wantQuality uint8
+		wantAlert   bool
+	}{
+		{"Autonomous", "AANN", "", true, 1, false},
+		{"SBAS", "DAAN", "S", true, 2, false},
+		{"RTK float", "FAAA", "S", true, 5, false},
+		{"Dead reckoning", "EENN", "C", true, 6, false},
+		{"Unsafe", "AAAN", "U", true, 1, true},
+		{"No fix", "NNNN", "", false, 0, false},
+		{"Not valid", "AAAN", "V", false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetNMEA4State()
+			defer resetNMEA4State()
+			nmea := appendNmeaChecksum("$GNGNS,123519.00,4807.038,N,01131.000,W," + tt.mode + ",14,0.8,545.4,46.9,,," + tt.navStatus)
+			if used := processNMEALineLow(nmea, true); used != tt.wantUsed {
+				t.Fatalf("%s: used = %v", nmea, used)
+			}
+			if alert := gnssIntegrity.activeAt(GNSS_ALERT_RAIM, stratuxClock.Time); alert != tt.wantAlert {
+				t.Errorf("integrity alert = %v", alert)
+			}
+			if !tt.wantUsed {
+				return
+			}
+			mySituation.muGPS.Lock()
+			defer mySituation.muGPS.Unlock()
+			if mySituation.GPSFixQuality != tt.wantQuality {
+				t.Errorf("GPSFixQuality = %d, want %d", mySituation.GPSFixQuality, tt.wantQuality)
+			}
+			if math.Abs(float64(mySituation.GPSLatitude)-48.1173) > 0.0001 || math.Abs(float64(mySituation.GPSLongitude)+11.5167) > 0.0001 {
+				t.Errorf("position = %f, %f", mySituation.GPSLatitude, mySituation.GPSLongitude)
+			}
+			if math.Abs(float64(mySituation.GPSAltitudeMSL)-545.4*3.28084) > 0.1 || math.Abs(float64(mySituation.GPSHeightAboveEllipsoid)-592.3*3.28084) > 0.1 {
+				t.Errorf("MSL = %f ft, HAE = %f ft", mySituation.GPSAltitudeMSL, mySituation.GPSHeightAboveEllipsoid)
+			}
+			if mySituation.GPSLastFixSinceMidnightUTC != 12*3600+35*60+19 {
+				t.Errorf("GPSLastFixSinceMidnightUTC = %f", mySituation.GPSLastFixSinceMidnightUTC)
+			}
+		})
+	}
+}
+
+func TestNMEARMCNavStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		tail     string // mode indicator, navigational status
+		wantUsed bool
+	}{
+		{"NMEA 2.2", "", true},
+		{"NMEA 2.3 autonomous", ",A", true},
+		{"NMEA 2.3 not valid", ",N", false},
+		{"NMEA 4.10 safe", ",D,S", true},
+		{"NMEA 4.10 caution", ",A,C", true},
+		{"NMEA 4.10 unsafe", ",A,U", true},
+		{"NMEA 4.10 not valid", ",A,V", false},
+	}
+	for _, tt := range tests {
+		resetNMEA4State()
+		nmea := appendNmeaChecksum("$GNRMC,123519.00,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W" + tt.tail)
+		if used := processNMEALineLow(nmea, true); used != tt.wantUsed {
+			t.Errorf("%s: %s used = %v", tt.name, nmea, used)
+		}
+	}
+	resetNMEA4State()
+}
+
+func TestNMEAGSVSignals(t *testing.T) {
+	resetNMEA4State()
+	defer resetNMEA4State()
+
+	sentences := []string{
+		// NMEA 4.10 multi-band: GPS L1 C/A and L5-Q, Galileo E1 and E5a, in separate GSV sets.
+		"$GPGSV,1,1,02,05,45,300,42,13,12,180,,1",
+		"$GPGSV,1,1,02,05,45,300,47,13,12,180,31,8",
+		"$GAGSV,1,1,01,12,60,090,44,7",
+		"$GAGSV,1,1,01,12,60,090,40,1",
+		// QZSS and NavIC talkers.
+		"$GQGSV,1,1,01,03,70,010,39,1",
+		"$GIGSV,1,1,01,07,30,270,35,1",
+		// Pre-4.10, no signal ID.
+		"$GLGSV,1,1,01,70,20,120,33",
+	}
+	for _, s := range sentences {
+		if !processNMEALine(appendNmeaChecksum(s)) {
+			t.Fatalf("%s not used", s)
+		}
+	}
+
+	tests := []struct {
+		id          string
+		wantSignal  int8
+		wantSignals map[string]int8
+		wantType    uint8
+	}{
+		{"G5", 47, map[string]int8{"L1 C/A": 42, "L5-Q": 47}, SAT_TYPE_GPS},
+		{"G13", 31, map[string]int8{"L1 C/A": -99, "L5-Q": 31}, SAT_TYPE_GPS},
+		{"E12", 44, map[string]int8{"E1-BC": 44, "E5a": 40}, SAT_TYPE_GALILEO},
+		{"Q3", 39, map[string]int8{"L1 C/A": 39}, SAT_TYPE_QZSS},
+		{"I7", 35, map[string]int8{"L5 SPS": 35}, SAT_TYPE_NAVIC},
+		{"R6", 33, nil, SAT_TYPE_GLONASS},
+	}
+	mySituation.muSatellite.Lock()
+	defer mySituation.muSatellite.Unlock()
+	if len(Satellites) != len(tests) {
+		t.Errorf("%d satellites, want %d: one record per satellite, not per signal", len(Satellites), len(tests))
+	}
+	for _, tt := range tests {
+		sat, ok := Satellites[tt.id]
+		if !ok {
+			t.Errorf("%s missing", tt.id)
+			continue
+		}
+		if sat.Signal != tt.wantSignal || sat.Type != tt.wantType || len(sat.Signals) != len(tt.wantSignals) {
+			t.Errorf("%s: Signal = %d, Type = %d, Signals = %v", tt.id, sat.Signal, sat.Type, sat.Signals)
+		}
+		for name, cno := range tt.wantSignals {
+			if sat.Signals[name] != cno {
+				t.Errorf("%s: Signals[%s] = %d, want %d", tt.id, name, sat.Signals[name], cno)
+			}
+		}
+	}
+}
+
+func TestNMEAGSASystemID(t *testing.T) {
+	resetNMEA4State()
+	defer resetNMEA4State()
+
+	// One GSA per system with the GN talker, satellites numbered within the system.
+	sentences := []string{
+		"$GNGSA,A,3,05,07,13,,,,,,,,,,1.6,0.9,1.3,1",
+		"$GNGSA,A,3,12,19,,,,,,,,,,,1.6,0.9,1.3,3",
+		"$GNGSA,A,3,14,,,,,,,,,,,,1.6,0.9,1.3,4",
+		// Pre-4.10 extended numbering.
+		"$GNGSA,A,3,70,,,,,,,,,,,,1.6,0.9,1.3",
+	}
+	for _, s := range sentences {
+		if !processNMEALine(appendNmeaChecksum(s)) {
+			t.Fatalf("%s not used", s)
+		}
+	}
+	mySituation.muSatellite.Lock()
+	for _, id := range []string{"G5", "G7", "G13", "E12", "E19", "B14", "R6"} {
+		if sat, ok := Satellites[id]; !ok || !sat.InSolution {
+			t.Errorf("%s not in solution", id)
+		}
+	}
+	mySituation.muSatellite.Unlock()
+	mySituation.muGPS.Lock()
+	defer mySituation.muGPS.Unlock()
+	if mySituation.GPSSatellites != 7 || mySituation.GPSHorizontalDOP != 0.9 {
+		t.Errorf("GPSSatellites = %d, HDOP = %f", mySituation.GPSSatellites, mySituation.GPSHorizontalDOP)
+	}
+}
+
+func TestNMEAGBS(t *testing.T) {
+	resetNMEA4State()
+	defer resetNMEA4State()
+
+	processNMEALine(appendNmeaChecksum("$GNGSA,A,3,12,19,,,,,,,,,,,1.6,0.9,1.3,3"))
+
+	// No fault: accuracy only.
+	if !processNMEALine(appendNmeaChecksum("$GNGBS,123519.00,1.2,1.6,3.0,,,,,,")) {
+		t.Fatalf("GBS not used")
+	}
+	mySituation.muGPS.Lock()
+	hacc, vacc := mySituation.GPSHorizontalAccuracy, mySituation.GPSVerticalAccuracy
+	mySituation.muGPS.Unlock()
+	if math.Abs(float64(hacc)-4) > 0.001 || math.Abs(float64(vacc)-6) > 0.001 {
+		t.Errorf("accuracy = %f, %f, want 4, 6", hacc, vacc)
+	}
+	if gnssIntegrity.activeAt(GNSS_ALERT_RAIM, stratuxClock.Time) {
+		t.Errorf("RAIM alert without faulty satellite")
+	}
+
+	// GST is preferred.
+	processNMEALine("$GNGST,205246.00,1.19,0.02,0.01,-2.4501,0.02,0.01,0.03*5B")
+	processNMEALine(appendNmeaChecksum("$GNGBS,123520.00,1.2,1.6,3.0,,,,,,"))
+	mySituation.muGPS.Lock()
+	hacc = mySituation.GPSHorizontalAccuracy
+	mySituation.muGPS.Unlock()
+	if hacc > 0.1 {
+		t.Errorf("GBS accuracy %f overrides GST", hacc)
+	}
+
+	// Galileo E19 failed.
+	if !processNMEALine(appendNmeaChecksum("$GNGBS,123521.00,1.2,1.6,3.0,19,0.01,25.3,3.1,3,7")) {
+		t.Fatalf("GBS not used")
+	}
+	if !gnssIntegrity.activeAt(GNSS_ALERT_RAIM, stratuxClock.Time) {
+		t.Errorf("no RAIM alert")
+	}
+	mySituation.muSatellite.Lock()
+	defer mySituation.muSatellite.Unlock()
+	if !Satellites["E12"].InSolution || Satellites["E19"].InSolution {
+		t.Errorf("E12 in solution = %v, E19 in solution = %v", Satellites["E12"].InSolution, Satellites["E19"].InSolution)
+	}
+}
@@ -0,0 +1,404 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	gps_ubx.go: Native u-blox UBX binary navigation input (NAV-PVT, NAV-SAT, NAV-DOP, NAV-TIMEUTC),
+	 framing of mixed NMEA/UBX serial streams.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	UBX_SYNC1 = 0xB5
+	UBX_SYNC2 = 0x62
+
+	UBX_CLASS_NAV   = 0x01
+	UBX_NAV_DOP     = 0x04
+	UBX_NAV_PVT     = 0x07
+	UBX_NAV_TIMEUTC = 0x21
+	UBX_NAV_SAT     = 0x35
+
+	ubxMaxPayload = 4096            // Largest message we accept. NAV-SAT with 255 satellites is 3068 bytes.
+	ubxNavTimeout = 2 * time.Second // NMEA position data is used again if no UBX NAV message was received for this long.
+)
+
+// stratuxClock time of the last UBX NAV-PVT and NAV-SAT messages. Protected by mySituation.muGPS.
+var ubxLastNavPVT time.Time
+var ubxLastNavSat time.Time
+
+/*
+makeUbloxNavMsgConfig()
+
+	returns the UBX-CFG-MSG commands that enable or disable the UBX NAV messages
+	on UART1 and USB. NAV-PVT and NAV-TIMEUTC every navigation solution, NAV-SAT and
+	NAV-DOP every 5th, like GSV and GSA.
+*/
+func makeUbloxNavMsgConfig(enable bool) [][]byte {
+	rate := func(r byte) byte {
+		if enable {
+			return r
+		}
+		return 0
+	}
+	//                         Class          ID               I2C   UART1    UART2 USB      SPI   Res
+	msgs := [][]byte{
+		{UBX_CLASS_NAV, UBX_NAV_PVT, 0x00, rate(1), 0x00, rate(1), 0x00, 0x00},
+		{UBX_CLASS_NAV, UBX_NAV_TIMEUTC, 0x00, rate(1), 0x00, rate(1), 0x00, 0x00},
+		{UBX_CLASS_NAV, UBX_NAV_SAT, 0x00, rate(5), 0x00, rate(5), 0x00, 0x00},
+		{UBX_CLASS_NAV, UBX_NAV_DOP, 0x00, rate(5), 0x00, rate(5), 0x00, 0x00},
+	}
+	ret := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		ret = append(ret, makeUBXCFG(0x06, 0x01, 8, m))
+	}
+	return ret
+}
+
+// isUBXFrame returns true if b starts with the UBX sync characters.
+func isUBXFrame(b []byte) bool {
+	return len(b) >= 2 && b[0] == UBX_SYNC1 && b[1] == UBX_SYNC2
+}
+
+/*
+scanNMEAUBX()
+
+	bufio.SplitFunc for serial streams carrying both NMEA sentences and binary UBX messages.
+	Tokens are either a complete, checksum-verified UBX message (including sync characters and
+	checksum) or one NMEA line without the line ending. Garbage and corrupted UBX messages are skipped.
+*/
+func scanNMEAUBX(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// Need more data. At EOF, whatever is left is an incomplete UBX message: drop it.
+	more := func(start int) (int, []byte, error) {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return start, nil, nil
+	}
+	start := 0
+	for start < len(data) {
+		d := data[start:]
+		if d[0] != UBX_SYNC1 {
+			// NMEA (or other text) line. Ends at the line feed, or where a UBX message starts.
+			for i, c := range d {
+				if c == '\n' {
+					return start + i + 1, bytes.TrimRight(d[:i], "\r"), nil
+				}
+				if c == UBX_SYNC1 {
+					return start + i, bytes.TrimRight(d[:i], "\r"), nil
+				}
+			}
+			if atEOF {
+				return len(data), bytes.TrimRight(d, "\r"), nil
+			}
+			return start, nil, nil
+		}
+		if len(d) < 2 {
+			return more(start)
+		}
+		if d[1] != UBX_SYNC2 {
+			start++ // Not a UBX message. 0xB5 doesn't appear in NMEA.
+			continue
+		}
+		if len(d) < 6 {
+			return more(start)
+		}
+		payloadLen := int(binary.LittleEndian.Uint16(d[4:6]))
+		if payloadLen > ubxMaxPayload {
+			start += 2 // Resync.
+			continue
+		}
+		frameLen := payloadLen + 8
+		if len(d) < frameLen {
+			return more(start)
+		}
+		if !bytes.Equal(chksumUBX(d[2:frameLen-2]), d[frameLen-2:frameLen]) {
+			start += 2 // Corrupted. Resync after the sync characters.
+			continue
+		}
+		return start + frameLen, d[:frameLen], nil
+	}
+	return start, nil, nil
+}
+
+// parseUBXFrame splits a complete UBX message into class, id and payload after verifying length and checksum.
+func parseUBXFrame(b []byte) (class, id byte, payload []byte, ok bool) {
+	if !isUBXFrame(b) || len(b) < 8 {
+		return 0, 0, nil, false
+	}
+	payloadLen := int(binary.LittleEndian.Uint16(b[4:6]))
+	if len(b) != payloadLen+8 || !bytes.Equal(chksumUBX(b[2:len(b)-2]), b[len(b)-2:]) {
+		return 0, 0, nil, false
+	}
+	return b[2], b[3], b[6 : 6+payloadLen], true
+}
+
+// ubxSupersedesNMEA returns true if the given NMEA sentence carries data we currently receive from UBX NAV messages.
+// Must be called with mySituation.muGPS held.
+func ubxSupersedesNMEA(sentence string) bool {
+	if len(sentence) != 5 || sentence[0] != 'G' {
+		return false
+	}
+	switch sentence[2:] {
+	case "GGA", "RMC", "VTG", "GST":
+		return !ubxLastNavPVT.IsZero() && stratuxClock.Since(ubxLastNavPVT) < ubxNavTimeout
+	case "GSA", "GSV":
+		return !ubxLastNavSat.IsZero() && stratuxClock.Since(ubxLastNavSat) < ubxNavTimeout
+	}
+	return false
+}
+
+/*
+processUBXMessage decodes a binary UBX message from a u-blox receiver into mySituation and Satellites.
+
+return is true if the message was used.
+*/
+func processUBXMessage(b []byte) (msgUsed bool) {
+	return processUBXMessageLow(b, false)
+}
+
+func processUBXMessageLow(b []byte, fakeGpsTimeToCurr bool) (msgUsed bool) {
+	mySituation.muGPS.Lock()
+	TraceLog.Record(CONTEXT_UBX, []byte(hex.EncodeToString(b)))
+	gnssSources.begin(GNSS_SOURCE_SERIAL)
+
+	defer func() {
+		gnssSources.end()
+		if msgUsed || globalSettings.DEBUG {
+			registerSituationUpdate()
+		}
+		mySituation.muGPS.Unlock()
+	}()
+
+	class, id, payload, ok := parseUBXFrame(b)
+	if !ok || class != UBX_CLASS_NAV {
+		return false
+	}
+
+	mySituation.GPSLastValidNMEAMessageTime = stratuxClock.Time
+	mySituation.GPSLastValidNMEAMessage = fmt.Sprintf("UBX %02X-%02X", class, id)
+	globalStatus.GPS_detected_type = (globalStatus.GPS_detected_type & 0x0f) | GPS_PROTOCOL_UBX
+
+	switch id {
+	case UBX_NAV_PVT:
+		return processUBXNavPVT(payload, fakeGpsTimeToCurr)
+	case UBX_NAV_SAT:
+		return processUBXNavSat(payload)
+	case UBX_NAV_DOP:
+		return processUBXNavDOP(payload)
+	case UBX_NAV_TIMEUTC:
+		return processUBXNavTimeUTC(payload, fakeGpsTimeToCurr)
+	}
+	return false
+}
+
+// UBX-NAV-PVT: navigation position velocity time solution. 84 bytes on u-blox 7, 92 bytes on u-blox 8 and newer.
+func processUBXNavPVT(p []byte, fakeGpsTimeToCurr bool) bool {
+	if len(p) < 84 {
+		return false
+	}
+	ubxLastNavPVT = stratuxClock.Time
+
+	valid := p[11]
+	fixType := p[20]
+	flags := p[21]
+	if flags&0x01 == 0 || fixType < 2 || fixType > 4 { // No gnssFixOK, or no/dead reckoning only/time only fix.
+		return false
+	}
+
+	tmpSituation := mySituation // If we decide to not use the data in this message, then don't make incomplete changes in mySituation.
+	thisGpsPerf := gpsPerf
+	thisGpsPerf.stratuxTime = stratuxClock.Milliseconds
+	thisGpsPerf.msgType = "NAV-PVT"
+
+	hour, min, sec := int(p[8]), int(p[9]), int(p[10])
+	nano := int32(binary.LittleEndian.Uint32(p[16:20]))
+	tmpSituation.GPSLastFixSinceMidnightUTC = float32(3600*hour+60*min+sec) + float32(nano)/1e9
+	thisGpsPerf.nmeaTime = tmpSituation.GPSLastFixSinceMidnightUTC
+
+	if valid&0x07 == 0x07 { // validDate, validTime and fullyResolved.
+		year := int(binary.LittleEndian.Uint16(p[4:6]))
+		gpsTime := time.Date(year, time.Month(p[6]), int(p[7]), hour, min, sec, 0, time.UTC).Add(time.Duration(nano))
+		gpsTime = gpsTime.Add(gpsTimeOffsetPpsMs) // rough estimate for PPS offset
+		if fakeGpsTimeToCurr {
+			gpsTime = time.Now().UTC()
+		}
+		setGPSTime(&tmpSituation, gpsTime)
+	}
+
+	if flags&0x02 != 0 { // diffSoln: SBAS/DGNSS corrections applied.
+		tmpSituation.GPSFixQuality = 2
+	} else {
+		tmpSituation.GPSFixQuality = 1
+	}
+	if ubxLastNavSat.IsZero() || stratuxClock.Since(ubxLastNavSat) >= ubxNavTimeout {
+		tmpSituation.GPSSatellites = uint16(p[23]) // Otherwise counted from NAV-SAT.
+	}
+
+	tmpSituation.GPSLongitude = float32(float64(int32(binary.LittleEndian.Uint32(p[24:28]))) * 1e-7)
+	tmpSituation.GPSLatitude = float32(float64(int32(binary.LittleEndian.Uint32(p[28:32]))) * 1e-7)
+	height := float64(int32(binary.LittleEndian.Uint32(p[32:36]))) / 1000 // m above ellipsoid
+	hMSL := float64(int32(binary.LittleEndian.Uint32(p[36:40]))) / 1000   // m above MSL
+	tmpSituation.GPSAltitudeMSL = float32(hMSL * 3.28084)
+	tmpSituation.GPSHeightAboveEllipsoid = float32(height * 3.28084)
+	tmpSituation.GPSGeoidSep = tmpSituation.GPSHeightAboveEllipsoid - tmpSituation.GPSAltitudeMSL
+	thisGpsPerf.alt = tmpSituation.GPSAltitudeMSL
+
+	// hAcc/vAcc are 1-sigma estimates. We use 2-sigma (~95%).
+	hAcc := float64(binary.LittleEndian.Uint32(p[40:44])) / 1000
+	vAcc := float64(binary.LittleEndian.Uint32(p[44:48])) / 1000
+	tmpSituation.GPSHorizontalAccuracy = float32(2 * hAcc)
+	tmpSituation.GPSVerticalAccuracy = float32(2 * vAcc)
+	tmpSituation.GPSNACp = calculateNACp(tmpSituation.GPSHorizontalAccuracy)
+	tmpSituation.GPSLastAccuracyTime = stratuxClock.Time
+
+	velD := float64(int32(binary.LittleEndian.Uint32(p[56:60]))) / 1000 // m/s, positive down
+	tmpSituation.GPSVerticalSpeed = float32(-velD * 3.28084)
+	thisGpsPerf.vv = tmpSituation.GPSVerticalSpeed
+
+	groundspeed := float64(int32(binary.LittleEndian.Uint32(p[60:64]))) / 1000 * 1.943844 // Knots.
+	tmpSituation.GPSGroundSpeed = groundspeed
+	thisGpsPerf.gsf = float32(groundspeed)
+	tc := float64(int32(binary.LittleEndian.Uint32(p[64:68]))) * 1e-5
+	if groundspeed > 3 { //TODO: use average groundspeed over last n seconds to avoid random "jumps"
+		tc = math.Mod(tc+360, 360)
+		setTrueCourse(uint16(groundspeed), tc)
+		tmpSituation.GPSTrueCourse = float32(tc)
+		thisGpsPerf.coursef = float32(tc)
+	} else {
+		// Negligible movement. Don't update course, but do use the slow speed.
+		thisGpsPerf.coursef = -999.9
+	}
+
+	tmpSituation.GPSPositionDOP = float32(binary.LittleEndian.Uint16(p[76:78])) / 100
+
+	tmpSituation.GPSLastFixLocalTime = stratuxClock.Time
+	tmpSituation.GPSLastGroundTrackTime = stratuxClock.Time
+
+	// We've made it this far, so that means we've processed "everything" and can now make the change to mySituation.
+	mySituation = tmpSituation
+
+	recordGPSPerf(thisGpsPerf)
+
+	setDataLogTimeWithGPS(mySituation)
+	return true
+}
+
+// ubxSatelliteID maps a UBX gnssId/svId pair onto the satellite naming and NMEA numbering used by the GSV/GSA parser.
+func ubxSatelliteID(gnssId, svId uint8) (svStr string, nmeaId int, svType uint8) {
+	switch gnssId {
+	case 0:
+		return fmt.Sprintf("G%d", svId), int(svId), SAT_TYPE_GPS
+	case 1:
+		return fmt.Sprintf("S%d", svId), int(svId) - 87, SAT_TYPE_SBAS
+	case 2:
+		return fmt.Sprintf("E%d", svId), int(svId) + 300, SAT_TYPE_GALILEO
+	case 3:
+		return fmt.Sprintf("B%d", svId), int(svId) + 400, SAT_TYPE_BEIDOU
+	case 5:
+		return fmt.Sprintf("Q%d", svId), int(svId) + 192, SAT_TYPE_QZSS
+	case 6:
+		return fmt.Sprintf("R%d", svId), int(svId) + 64, SAT_TYPE_GLONASS
+	}
+	return fmt.Sprintf("U%d", svId), int(svId), SAT_TYPE_UNKNOWN
+}
+
+// UBX-NAV-SAT: satellite information. 8 byte header plus 12 bytes per satellite.
+func processUBXNavSat(p []byte) bool {
+	if len(p) < 8 {
+		return false
+	}
+	numSvs := int(p[5])
+	if len(p) < 8+12*numSvs {
+		return false
+	}
+	ubxLastNavSat = stratuxClock.Time
+
+	// START OF PROTECTED BLOCK
+	mySituation.muSatellite.Lock()
+	for i := 0; i < numSvs; i++ {
+		sv := p[8+12*i : 20+12*i]
+		svStr, nmeaId, svType := ubxSatelliteID(sv[0], sv[1])
+
+		var thisSatellite SatelliteInfo
+		if val, ok := Satellites[svStr]; ok { // if we've already seen this satellite identifier, copy it in to do updates
+			thisSatellite = val
+		} else {
+			thisSatellite.SatelliteID = svStr
+			if nmeaId < 0 || nmeaId > 255 {
+				thisSatellite.SatelliteNMEA = 255 // Use max value if out of range
+			} else {
+				thisSatellite.SatelliteNMEA = uint8(nmeaId)
+			}
+			thisSatellite.Type = svType
+		}
+		thisSatellite.TimeLastTracked = stratuxClock.Time
+
+		cno := sv[2]
+		if cno > 127 {
+			cno = 127
+		}
+		thisSatellite.Signal = int8(cno)
+		if cno > 0 {
+			thisSatellite.TimeLastSeen = stratuxClock.Time
+		}
+		flags := binary.LittleEndian.Uint32(sv[8:12])
+		if (flags>>8)&0x07 == 0 { // orbitSource: no orbit information, elevation and azimuth unknown.
+			thisSatellite.Elevation = -999
+			thisSatellite.Azimuth = -999
+		} else {
+			thisSatellite.Elevation = int16(int8(sv[3]))
+			thisSatellite.Azimuth = int16(binary.LittleEndian.Uint16(sv[4:6]))
+		}
+		thisSatellite.InSolution = flags&0x08 != 0 // svUsed
+		if thisSatellite.InSolution {
+			thisSatellite.TimeLastSolution = stratuxClock.Time
+		}
+
+		Satellites[thisSatellite.SatelliteID] = thisSatellite // Update constellation with this satellite
+	}
+	updateConstellation()
+	mySituation.muSatellite.Unlock()
+	// END OF PROTECTED BLOCK
+	return true
+}
+
+// UBX-NAV-DOP: dilution of precision.
+func processUBXNavDOP(p []byte) bool {
+	if len(p) < 18 {
+		return false
+	}
+	mySituation.GPSPositionDOP = float32(binary.LittleEndian.Uint16(p[6:8])) / 100
+	mySituation.GPSVerticalDOP = float32(binary.LittleEndian.Uint16(p[10:12])) / 100
+	mySituation.GPSHorizontalDOP = float32(binary.LittleEndian.Uint16(p[12:14])) / 100
+	return true
+}
+
+// UBX-NAV-TIMEUTC: UTC time solution. Also available without a position fix.
+func processUBXNavTimeUTC(p []byte, fakeGpsTimeToCurr bool) bool {
+	if len(p) < 20 {
+		return false
+	}
+	if p[19]&0x04 == 0 { // validUTC
+		return false
+	}
+	nano := int32(binary.LittleEndian.Uint32(p[8:12]))
+	year := int(binary.LittleEndian.Uint16(p[12:14]))
+	gpsTime := time.Date(year, time.Month(p[14]), int(p[15]), int(p[16]), int(p[17]), int(p[18]), 0, time.UTC).Add(time.Duration(nano))
+	gpsTime = gpsTime.Add(gpsTimeOffsetPpsMs) // rough estimate for PPS offset
+	if fakeGpsTimeToCurr {
+		gpsTime = time.Now().UTC()
+	}
+	setGPSTime(&mySituation, gpsTime)
+	return true
+}
@@ -0,0 +1,294 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	gps_ubx_test.go: Unit tests for UBX binary navigation input and NMEA/UBX stream framing.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func resetUBXState() {
+	resetGPSState()
+	mySituation.muGPS.Lock()
+	ubxLastNavPVT = time.Time{}
+	ubxLastNavSat = time.Time{}
+	mySituation.muGPS.Unlock()
+	mySituation.muGPSPerformance.Lock()
+	myGPSPerfStats = make([]gpsPerfStats, 0)
+	mySituation.muGPSPerformance.Unlock()
+	mySituation.muSatellite.Lock()
+	Satellites = make(map[string]SatelliteInfo)
+	mySituation.muSatellite.Unlock()
+}
+
+type testNavPVT struct {
+	fixType  byte
+	flags    byte
+	numSV    byte
+	lat, lon float64
+	height   int32 // mm
+	hMSL     int32 // mm
+	hAcc     uint32
+	vAcc     uint32
+	velD     int32 // mm/s
+	gSpeed   int32 // mm/s
+	headMot  float64
+	pDOP     uint16
+}
+
+func makeTestNavPVT(v testNavPVT) []byte {
+	p := make([]byte, 92)
+	binary.LittleEndian.PutUint16(p[4:], 2025)
+	p[6], p[7], p[8], p[9], p[10] = 6, 1, 12, 30, 15
+	p[11] = 0x07
+	binary.LittleEndian.PutUint32(p[16:], uint32(int32(500000000)))
+	p[20] = v.fixType
+	p[21] = v.flags
+	p[23] = v.numSV
+	binary.LittleEndian.PutUint32(p[24:], uint32(int32(math.Round(v.lon*1e7))))
+	binary.LittleEndian.PutUint32(p[28:], uint32(int32(math.Round(v.lat*1e7))))
+	binary.LittleEndian.PutUint32(p[32:], uint32(v.height))
+	binary.LittleEndian.PutUint32(p[36:], uint32(v.hMSL))
+	binary.LittleEndian.PutUint32(p[40:], v.hAcc)
+	binary.LittleEndian.PutUint32(p[44:], v.vAcc)
+	binary.LittleEndian.PutUint32(p[56:], uint32(v.velD))
+	binary.LittleEndian.PutUint32(p[60:], uint32(v.gSpeed))
+	binary.LittleEndian.PutUint32(p[64:], uint32(int32(math.Round(v.headMot*1e5))))
+	binary.LittleEndian.PutUint16(p[76:], v.pDOP)
+	return makeUBXCFG(UBX_CLASS_NAV, UBX_NAV_PVT, uint16(len(p)), p)
+}
+
+func TestScanNMEAUBX(t *testing.T) {
+	ubx := makeUBXCFG(UBX_CLASS_NAV, UBX_NAV_DOP, 4, []byte{1, 2, 3, 4})
+	corrupted := append([]byte{}, ubx...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	var stream []byte
+	stream = append(stream, "$GPRMC,1\r\n"...)
+	stream = append(stream, ubx...)
+	stream = append(stream, "$GPGGA,2\r\n"...)
+	stream = append(stream, 0xB5, 0x00) // Stray sync character.
+	stream = append(stream, corrupted...)
+	stream = append(stream, "$GPVTG,3"...)
+	stream = append(stream, ubx...) // Directly follows a sentence without line end.
+	stream = append(stream, "$GPGSA,4"...)
+
+	// Garbage, stray sync characters and the corrupted message are skipped or end up in front of the next
+	// sentence, which gpsSerialReader() separates at the '$'.
+	want := [][]byte{[]byte("$GPRMC,1"), ubx, []byte("$GPGGA,2"), []byte("$GPVTG,3"), ubx, []byte("$GPGSA,4")}
+
+	for _, oneByte := range []bool{false, true} {
+		r := bytes.NewReader(stream)
+		scanner := bufio.NewScanner(r)
+		if oneByte {
+			scanner = bufio.NewScanner(iotest.OneByteReader(r))
+		}
+		scanner.Split(scanNMEAUBX)
+		got := make([][]byte, 0)
+		for scanner.Scan() {
+			tok := append([]byte{}, scanner.Bytes()...)
+			if isUBXFrame(tok) {
+				got = append(got, tok)
+			} else if i := bytes.IndexByte(tok, '$'); i >= 0 {
+				got = append(got, tok[i:])
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("oneByte=%v: got %d tokens %q, want %d", oneByte, len(got), got, len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Errorf("oneByte=%v: token %d = %q, want %q", oneByte, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestParseUBXFrame(t *testing.T) {
+	frame := makeUBXCFG(UBX_CLASS_NAV, UBX_NAV_DOP, 3, []byte{7, 8, 9})
+	class, id, payload, ok := parseUBXFrame(frame)
+	if !ok || class != UBX_CLASS_NAV || id != UBX_NAV_DOP || !bytes.Equal(payload, []byte{7, 8, 9}) {
+		t.Errorf("parseUBXFrame = %x %x %v %v", class, id, payload, ok)
+	}
+	bad := append([]byte{}, frame...)
+	bad[7] ^= 0x01
+	if _, _, _, ok := parseUBXFrame(bad); ok {
+		t.Error("frame with bad checksum accepted")
+	}
+	if _, _, _, ok := parseUBXFrame(frame[:len(frame)-1]); ok {
+		t.Error("truncated frame accepted")
+	}
+}
+
+func TestProcessUBXNavPVT(t *testing.T) {
+	resetUBXState()
+	frame := makeTestNavPVT(testNavPVT{
+		fixType: 3, flags: 0x03, numSV: 14,
+		lat: 47.123456, lon: -122.654321,
+		height: 100000, hMSL: 120000,
+		hAcc: 1500, vAcc: 2500,
+		velD: -2540, gSpeed: 51444, headMot: 270.5, pDOP: 123,
+	})
+	if !processUBXMessageLow(frame, true) {
+		t.Fatal("NAV-PVT not used")
+	}
+
+	if math.Abs(float64(mySituation.GPSLatitude)-47.123456) > 1e-5 || math.Abs(float64(mySituation.GPSLongitude)+122.654321) > 1e-5 {
+		t.Errorf("position = %f,%f", mySituation.GPSLatitude, mySituation.GPSLongitude)
+	}
+	if mySituation.GPSFixQuality != 2 {
+		t.Errorf("GPSFixQuality = %d, want 2 (diffSoln)", mySituation.GPSFixQuality)
+	}
+	if mySituation.GPSSatellites != 14 {
+		t.Errorf("GPSSatellites = %d, want 14", mySituation.GPSSatellites)
+	}
+	if math.Abs(float64(mySituation.GPSAltitudeMSL)-393.7) > 0.1 || math.Abs(float64(mySituation.GPSGeoidSep)+65.6) > 0.1 {
+		t.Errorf("alt MSL = %f, geoid sep = %f", mySituation.GPSAltitudeMSL, mySituation.GPSGeoidSep)
+	}
+	if mySituation.GPSHorizontalAccuracy != 3 || mySituation.GPSVerticalAccuracy != 5 {
+		t.Errorf("accuracy = %f/%f, want 3/5", mySituation.GPSHorizontalAccuracy, mySituation.GPSVerticalAccuracy)
+	}
+	if mySituation.GPSNACp != calculateNACp(3) {
+		t.Errorf("GPSNACp = %d", mySituation.GPSNACp)
+	}
+	if math.Abs(float64(mySituation.GPSVerticalSpeed)-8.333) > 0.01 {
+		t.Errorf("GPSVerticalSpeed = %f ft/s, want 8.33 (climbing)", mySituation.GPSVerticalSpeed)
+	}
+	if math.Abs(mySituation.GPSGroundSpeed-100) > 0.01 || math.Abs(float64(mySituation.GPSTrueCourse)-270.5) > 0.001 {
+		t.Errorf("gs = %f, track = %f", mySituation.GPSGroundSpeed, mySituation.GPSTrueCourse)
+	}
+	if mySituation.GPSPositionDOP != 1.23 {
+		t.Errorf("GPSPositionDOP = %f", mySituation.GPSPositionDOP)
+	}
+	if mySituation.GPSLastFixSinceMidnightUTC != 12*3600+30*60+15.5 {
+		t.Errorf("GPSLastFixSinceMidnightUTC = %f", mySituation.GPSLastFixSinceMidnightUTC)
+	}
+	if globalStatus.GPS_detected_type&0xf0 != GPS_PROTOCOL_UBX {
+		t.Errorf("GPS_detected_type = %x", globalStatus.GPS_detected_type)
+	}
+	if n := len(myGPSPerfStats); n != 1 || myGPSPerfStats[0].msgType != "NAV-PVT" {
+		t.Errorf("gps perf stats = %+v", myGPSPerfStats)
+	}
+}
+
+func TestProcessUBXNavPVTNoFix(t *testing.T) {
+	resetUBXState()
+	tests := []struct {
+		name    string
+		fixType byte
+		flags   byte
+	}{
+		{"No fix", 0, 0x01},
+		{"Dead reckoning only", 1, 0x01},
+		{"Time only", 5, 0x01},
+		{"gnssFixOK not set", 3, 0x00},
+	}
+	for _, tt := range tests {
+		frame := makeTestNavPVT(testNavPVT{fixType: tt.fixType, flags: tt.flags, lat: 10, lon: 10})
+		if processUBXMessageLow(frame, true) {
+			t.Errorf("%s: message used", tt.name)
+		}
+		if mySituation.GPSLatitude != 0 {
+			t.Errorf("%s: position updated", tt.name)
+		}
+	}
+}
+
+func TestProcessUBXNavSat(t *testing.T) {
+	resetUBXState()
+	p := make([]byte, 8+3*12)
+	p[4] = 1
+	p[5] = 3
+	// GPS 5, used in solution.
+	copy(p[8:], []byte{0, 5, 42, 45, 0x2C, 0x01, 0, 0, 0x0F, 0x01, 0, 0})
+	// GLONASS 3, tracked, not used.
+	copy(p[20:], []byte{6, 3, 30, 0xF6, 0x5A, 0x00, 0, 0, 0x04, 0x01, 0, 0})
+	// SBAS 131, no orbit info.
+	copy(p[32:], []byte{1, 131, 0, 0, 0, 0, 0, 0, 0x00, 0x00, 0, 0})
+	if !processUBXMessageLow(makeUBXCFG(UBX_CLASS_NAV, UBX_NAV_SAT, uint16(len(p)), p), true) {
+		t.Fatal("NAV-SAT not used")
+	}
+
+	g5 := Satellites["G5"]
+	if !g5.InSolution || g5.Signal != 42 || g5.Elevation != 45 || g5.Azimuth != 300 || g5.Type != SAT_TYPE_GPS || g5.SatelliteNMEA != 5 {
+		t.Errorf("G5 = %+v", g5)
+	}
+	r3 := Satellites["R3"]
+	if r3.InSolution || r3.Elevation != -10 || r3.Azimuth != 90 || r3.Type != SAT_TYPE_GLONASS || r3.SatelliteNMEA != 67 {
+		t.Errorf("R3 = %+v", r3)
+	}
+	s131 := Satellites["S131"]
+	if s131.Elevation != -999 || s131.SatelliteNMEA != 44 || s131.Type != SAT_TYPE_SBAS {
+		t.Errorf("S131 = %+v", s131)
+	}
+	if mySituation.GPSSatellites != 1 || mySituation.GPSSatellitesTracked != 3 || mySituation.GPSSatellitesSeen != 2 {
+		t.Errorf("satellites = %d/%d/%d, want 1/3/2", mySituation.GPSSatellites, mySituation.GPSSatellitesTracked, mySituation.GPSSatellitesSeen)
+	}
+}
+
+func TestProcessUBXNavDOP(t *testing.T) {
+	resetUBXState()
+	p := make([]byte, 18)
+	binary.LittleEndian.PutUint16(p[6:], 180)  // pDOP
+	binary.LittleEndian.PutUint16(p[10:], 150) // vDOP
+	binary.LittleEndian.PutUint16(p[12:], 95)  // hDOP
+	if !processUBXMessageLow(makeUBXCFG(UBX_CLASS_NAV, UBX_NAV_DOP, 18, p), true) {
+		t.Fatal("NAV-DOP not used")
+	}
+	if mySituation.GPSPositionDOP != 1.8 || mySituation.GPSVerticalDOP != 1.5 || mySituation.GPSHorizontalDOP != 0.95 {
+		t.Errorf("DOP = %f/%f/%f", mySituation.GPSPositionDOP, mySituation.GPSHorizontalDOP, mySituation.GPSVerticalDOP)
+	}
+}
+
+func TestUBXSupersedesNMEA(t *testing.T) {
+	resetUBXState()
+	gga := appendNmeaChecksum("$GPGGA,123015.00,4707.40736,N,12239.25926,W,1,08,1.0,120.0,M,-20.0,M,,")
+
+	if !processNMEALineLow(gga, true) {
+		t.Fatal("GGA not used without UBX")
+	}
+	processUBXMessageLow(makeTestNavPVT(testNavPVT{fixType: 3, flags: 0x01, lat: 1, lon: 2}), true)
+	if processNMEALineLow(gga, true) {
+		t.Error("GGA used while NAV-PVT is received")
+	}
+	if mySituation.GPSLatitude != 1 {
+		t.Errorf("GPSLatitude = %f, NMEA overwrote UBX position", mySituation.GPSLatitude)
+	}
+	// Fall back to NMEA when UBX stops.
+	mySituation.muGPS.Lock()
+	ubxLastNavPVT = stratuxClock.Time.Add(-ubxNavTimeout - time.Second)
+	mySituation.muGPS.Unlock()
+	if !processNMEALineLow(gga, true) {
+		t.Error("GGA not used after UBX timeout")
+	}
+}
+
+func TestMakeUbloxNavMsgConfig(t *testing.T) {
+	for _, enable := range []bool{true, false} {
+		cmds := makeUbloxNavMsgConfig(enable)
+		if len(cmds) != 4 {
+			t.Fatalf("got %d commands, want 4", len(cmds))
+		}
+		for _, c := range cmds {
+			class, id, payload, ok := parseUBXFrame(c)
+			if !ok || class != 0x06 || id != 0x01 || len(payload) != 8 || payload[0] != UBX_CLASS_NAV {
+				t.Errorf("bad CFG-MSG %x", c)
+				continue
+			}
+			if enabled := payload[3] != 0 && payload[5] != 0; enabled != enable {
+				t.Errorf("enable=%v: CFG-MSG %x", enable, c)
+			}
+		}
+	}
+}
@@ -71,6 +71,9 @@ func resetGPSState() {
 	globalStatus.GPS_satellites_seen = 0
 	globalStatus.GPS_connected = false
 
+	// Forget GNSS sources from earlier tests
+	gnssSources = newGNSSSourceManager()
+
 	// Initialize Satellites map
 	if Satellites == nil {
 		Satellites = make(map[string]SatelliteInfo)
@@ -443,6 +446,41 @@ func TestGPSAltitudeConversion(t *testing.T) {
 	}
 }
 
+// TestGPSGGAGeoidFallback tests the geoid model for receivers that don't report the geoid separation
+func TestGPSGGAGeoidFallback(t *testing.T) {
+	// Geoid near Munich is about 47 m above the ellipsoid.
+	tests := []struct {
+		name       string
+		alt, sep   string
+		wantMSL    float64 // ft
+		wantSep    float64 // ft
+		toleranceF float64
+	}{
+		{"Receiver geoid", "545.4", "46.9", 545.4 * 3.28084, 46.9 * 3.28084, 1},
+		{"No separation field", "592.3", "", 545.4 * 3.28084, 46.9 * 3.28084, 15},
+		{"Zero separation", "592.3", "0.0", 545.4 * 3.28084, 46.9 * 3.28084, 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGPSState()
+			defer resetGPSState()
+			nmea := appendNmeaChecksum("$GPGGA,123519.00,4807.038,N,01131.000,E,1,08,0.9," + tt.alt + ",M," + tt.sep + ",M,,")
+			if !processNMEALineLow(nmea, true) {
+				t.Fatalf("GGA rejected: %s", nmea)
+			}
+			mySituation.muGPS.Lock()
+			msl, sep, hae := float64(mySituation.GPSAltitudeMSL), float64(mySituation.GPSGeoidSep), float64(mySituation.GPSHeightAboveEllipsoid)
+			mySituation.muGPS.Unlock()
+			if math.Abs(msl-tt.wantMSL) > tt.toleranceF || math.Abs(sep-tt.wantSep) > tt.toleranceF {
+				t.Errorf("MSL = %.0f ft, sep = %.0f ft, want %.0f, %.0f", msl, sep, tt.wantMSL, tt.wantSep)
+			}
+			if math.Abs(hae-(msl+sep)) > 0.1 {
+				t.Errorf("HAE = %.0f ft, MSL + sep = %.0f ft", hae, msl+sep)
+			}
+		})
+	}
+}
+
 // TestGPSLastValidMessage tests that last valid NMEA message is stored
 func TestGPSLastValidMessage(t *testing.T) {
 	resetGPSState()
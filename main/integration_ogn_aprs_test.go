@@ -260,6 +260,36 @@ func TestOGNTrafficParsing(t *testing.T) {
 		ti.Lat, ti.Lng, ti.Track, ti.Speed)
 }
 
+// TestOGNGeoidConversion tests that GNSS altitudes of OGN traffic are reported as HAE, whichever one the tracker sends
+func TestOGNGeoidConversion(t *testing.T) {
+	// Geoid near Oxford is about 47 m above the ellipsoid.
+	tests := []struct {
+		name    string
+		alts    string
+		wantHAE float64 // ft
+	}{
+		{"MSL", `"alt_msl_m":124.5`, (124.5 + 47) * 3.28084},
+		{"HAE", `"alt_hae_m":171.5`, 171.5 * 3.28084},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetOGNAPRSState()
+			msg := `{"sys":"OGN","time":1728907200.5,"addr":"395F39","addr_type":1,"acft_type":"1","lat_deg":51.7657533,"lon_deg":-1.1918533,` + tt.alts + `,"track_deg":57.0,"speed_mps":15.4}`
+			parseOgnMessage(msg, true)
+			trafficMutex.Lock()
+			defer trafficMutex.Unlock()
+			if len(traffic) != 1 {
+				t.Fatalf("Expected 1 traffic target, got %d", len(traffic))
+			}
+			for _, ti := range traffic {
+				if !ti.AltIsGNSS || math.Abs(float64(ti.Alt)-tt.wantHAE) > 20 {
+					t.Errorf("Alt = %d (GNSS %v), want ~%.0f ft HAE", ti.Alt, ti.AltIsGNSS, tt.wantHAE)
+				}
+			}
+		})
+	}
+}
+
 // TestOGNAddressTypes tests OGN address type handling (ICAO vs FLARM)
 func TestOGNAddressTypes(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,486 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	magcal.go: Magnetometer hard/soft iron calibration and tilt compensated magnetic heading.
+	 The calibration is guided through /calibrateMag: start it, rotate the Stratux slowly through all
+	 orientations until the coverage is complete, then finish it. An ellipsoid is fitted to the samples and
+	 stored in the settings. The World Magnetic Model (common/wmm.go) converts between magnetic and true heading.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/stratux/goflying/ahrs"
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	magCalMinSamples      = 300
+	magCalMaxSamples      = 3000
+	magCalMinCoverage     = 0.75 // Fraction of the 26 directions seen.
+	magCalMaxFitError     = 0.05 // RMS deviation of the calibrated samples from the sphere, relative.
+	magCalTimeout         = 5 * time.Minute
+	magCalCoverageBins    = 26
+	magDeclinationMaxAge  = time.Hour
+	magDeclinationMaxMove = 20 // nm
+
+	MAGCAL_IDLE       = "idle"
+	MAGCAL_COLLECTING = "collecting"
+	MAGCAL_DONE       = "done"
+	MAGCAL_FAILED     = "failed"
+)
+
+// MagCalibration is the ellipsoid fitted to the magnetometer readings: calibrated = SoftIron * (raw - HardIron)
+// lies on a sphere with radius FieldStrength. Zero if not calibrated.
+type MagCalibration struct {
+	HardIron      [3]float64    // µT
+	SoftIron      [3][3]float64 // Symmetric.
+	FieldStrength float64       // µT
+	FitError      float64       // RMS relative deviation from the sphere.
+	Time          time.Time
+}
+
+// Valid is whether a calibration has been performed.
+func (c *MagCalibration) Valid() bool {
+	return c.FieldStrength > 0
+}
+
+// Apply corrects a magnetometer reading (in the sensor frame).
+func (c *MagCalibration) Apply(m [3]float64) (res [3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			res[i] += c.SoftIron[i][j] * (m[j] - c.HardIron[j])
+		}
+	}
+	return
+}
+
+// Magnetometer axes in the accelerometer/gyro (sensor) frame, as signed 1-based magnetometer axis indexes.
+var (
+	magAxesAK8963  = [3]int{2, 1, -3}  // MPU-9250
+	magAxesAK09916 = [3]int{1, -2, -3} // ICM-20948
+	magAxesLSM9DS1 = [3]int{-1, 2, 3}  // LSM9DS1
+	magAxesBNO085  = [3]int{1, 2, 3}   // BNO085, calibrated field in the accelerometer's axes
+	imuMagAxes     = magAxesAK8963
+)
+
+// mapMagAxes converts a magnetometer reading into the sensor frame.
+func mapMagAxes(axes [3]int, m1, m2, m3 float64) (res [3]float64) {
+	m := [3]float64{m1, m2, m3}
+	for i, a := range axes {
+		if a < 0 {
+			res[i] = -m[-a-1]
+		} else {
+			res[i] = m[a-1]
+		}
+	}
+	return
+}
+
+// magCalibrator collects the samples of a calibration run.
+type magCalibrator struct {
+	mu       sync.Mutex
+	State    string
+	Samples  int
+	Coverage float64 // 0..1
+	Message  string
+	samples  [][3]float64
+	started  time.Time
+}
+
+var magCal = magCalibrator{State: MAGCAL_IDLE}
+
+func (c *magCalibrator) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.State = MAGCAL_COLLECTING
+	c.Samples = 0
+	c.Coverage = 0
+	c.Message = "Rotate the Stratux slowly through all orientations"
+	c.samples = c.samples[:0]
+	c.started = stratuxClock.Time
+	log.Printf("AHRS Info: magnetometer calibration started\n")
+}
+
+func (c *magCalibrator) cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.State = MAGCAL_IDLE
+	c.Message = ""
+	c.samples = nil
+}
+
+// addSample records a magnetometer reading in the sensor frame, uncalibrated.
+func (c *magCalibrator) addSample(m [3]float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.State != MAGCAL_COLLECTING {
+		return
+	}
+	if stratuxClock.Since(c.started) > magCalTimeout {
+		c.State = MAGCAL_FAILED
+		c.Message = "Timed out, not enough orientations covered"
+		c.samples = nil
+		return
+	}
+	if len(c.samples) >= magCalMaxSamples {
+		// Cycle through the buffer, overwriting the oldest samples.
+		c.samples[c.Samples%magCalMaxSamples] = m
+	} else {
+		c.samples = append(c.samples, m)
+	}
+	c.Samples++
+	if c.Samples%10 == 0 {
+		c.Coverage = magCoverage(c.samples)
+	}
+}
+
+// finish fits the calibration to the samples collected and stores it in the settings.
+func (c *magCalibrator) finish() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.State != MAGCAL_COLLECTING {
+		return errors.New("no calibration running")
+	}
+	c.Coverage = magCoverage(c.samples)
+	if len(c.samples) < magCalMinSamples || c.Coverage < magCalMinCoverage {
+		return fmt.Errorf("not enough data yet: %d samples, %.0f%% coverage", len(c.samples), c.Coverage*100)
+	}
+	cal, err := fitMagEllipsoid(c.samples)
+	c.samples = nil
+	if err != nil {
+		c.State = MAGCAL_FAILED
+		c.Message = err.Error()
+		return err
+	}
+	cal.Time = time.Now()
+	globalSettings.MagCalibration = cal
+	saveSettings()
+	c.State = MAGCAL_DONE
+	c.Message = fmt.Sprintf("Calibrated: field %.1f µT, fit error %.1f%%", cal.FieldStrength, cal.FitError*100)
+	log.Printf("AHRS Info: magnetometer calibration: hard iron %v, soft iron %v, field %.1f uT, fit error %.3f\n",
+		cal.HardIron, cal.SoftIron, cal.FieldStrength, cal.FitError)
+	return nil
+}
+
+// magCoverage is the fraction of the 26 directions (cube faces, edges and corners) seen from the center of the samples.
+func magCoverage(samples [][3]float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	lo, hi := samples[0], samples[0]
+	for _, s := range samples {
+		for i := range s {
+			lo[i] = math.Min(lo[i], s[i])
+			hi[i] = math.Max(hi[i], s[i])
+		}
+	}
+	var seen [27]bool
+	for _, s := range samples {
+		var d [3]float64
+		var norm float64
+		for i := range s {
+			d[i] = s[i] - (lo[i]+hi[i])/2
+			norm += d[i] * d[i]
+		}
+		if norm == 0 {
+			continue
+		}
+		norm = math.Sqrt(norm)
+		bin := 0
+		for i := range d {
+			b := 1
+			if d[i]/norm < -0.5 {
+				b = 0
+			} else if d[i]/norm > 0.5 {
+				b = 2
+			}
+			bin = bin*3 + b
+		}
+		seen[bin] = true
+	}
+	n := 0
+	for i, s := range seen {
+		if s && i != 13 { // 13 is the center.
+			n++
+		}
+	}
+	return float64(n) / magCalCoverageBins
+}
+
+// fitMagEllipsoid fits a general ellipsoid a x² + b y² + c z² + 2d xy + 2e xz + 2f yz + 2g x + 2h y + 2i z = 1 by least squares.
+func fitMagEllipsoid(samples [][3]float64) (cal MagCalibration, err error) {
+	if len(samples) < 9 {
+		return cal, errors.New("not enough samples")
+	}
+	// Normal equations, scaled to keep them well conditioned.
+	var scale float64
+	for _, s := range samples {
+		scale = math.Max(scale, math.Max(math.Abs(s[0]), math.Max(math.Abs(s[1]), math.Abs(s[2]))))
+	}
+	if scale == 0 {
+		return cal, errors.New("no magnetometer readings")
+	}
+	var ata [9][9]float64
+	var atb [9]float64
+	for _, s := range samples {
+		x, y, z := s[0]/scale, s[1]/scale, s[2]/scale
+		row := [9]float64{x * x, y * y, z * z, 2 * x * y, 2 * x * z, 2 * y * z, 2 * x, 2 * y, 2 * z}
+		for i := range row {
+			for j := range row {
+				ata[i][j] += row[i] * row[j]
+			}
+			atb[i] += row[i]
+		}
+	}
+	v, err := solveLinear9(ata, atb)
+	if err != nil {
+		return cal, errors.New("samples don't span an ellipsoid, rotate through more orientations")
+	}
+	a := [3][3]float64{{v[0], v[3], v[4]}, {v[3], v[1], v[5]}, {v[4], v[5], v[2]}}
+	ainv, ok := invert3(a)
+	if !ok {
+		return cal, errors.New("degenerate ellipsoid")
+	}
+	var center [3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			center[i] -= ainv[i][j] * v[6+j]
+		}
+	}
+	k := 1.0
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			k += center[i] * a[i][j] * center[j]
+		}
+	}
+	// (x - center)ᵀ (a/k) (x - center) = 1. Its square root maps the ellipsoid onto the unit sphere.
+	vals, vecs := symEigen3(a)
+	det := 1.0
+	for i := range vals {
+		vals[i] /= k
+		if vals[i] <= 0 {
+			return cal, errors.New("samples don't fit an ellipsoid, keep away from metal and electronics")
+		}
+		det *= vals[i]
+	}
+	radius := math.Pow(det, -1.0/6) // Geometric mean radius, so the calibrated field keeps its magnitude.
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for n := 0; n < 3; n++ {
+				cal.SoftIron[i][j] += vecs[i][n] * math.Sqrt(vals[n]) * vecs[j][n] * radius
+			}
+		}
+		cal.HardIron[i] = center[i] * scale
+	}
+	cal.FieldStrength = radius * scale
+
+	var sum float64
+	for _, s := range samples {
+		c := cal.Apply(s)
+		r := math.Sqrt(c[0]*c[0]+c[1]*c[1]+c[2]*c[2]) / cal.FieldStrength
+		sum += (r - 1) * (r - 1)
+	}
+	cal.FitError = math.Sqrt(sum / float64(len(samples)))
+	if cal.FitError > magCalMaxFitError {
+		return cal, fmt.Errorf("poor fit (%.1f%%), keep away from metal and electronics and try again", cal.FitError*100)
+	}
+	return cal, nil
+}
+
+// solveLinear9 solves a 9x9 linear system by Gaussian elimination with partial pivoting.
+func solveLinear9(a [9][9]float64, b [9]float64) (x [9]float64, err error) {
+	const n = 9
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return x, errors.New("singular")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < n; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c < n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	for r := n - 1; r >= 0; r-- {
+		x[r] = b[r]
+		for c := r + 1; c < n; c++ {
+			x[r] -= a[r][c] * x[c]
+		}
+		x[r] /= a[r][r]
+	}
+	return x, nil
+}
+
+func invert3(m [3][3]float64) (inv [3][3]float64, ok bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-15 {
+		return inv, false
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// Cofactor of m[j][i].
+			r0, r1 := (j+1)%3, (j+2)%3
+			c0, c1 := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[r0][c0]*m[r1][c1] - m[r0][c1]*m[r1][c0]) / det
+		}
+	}
+	return inv, true
+}
+
+// symEigen3 returns the eigenvalues and eigenvectors (columns) of a symmetric 3x3 matrix, with the Jacobi method.
+func symEigen3(a [3][3]float64) (vals [3]float64, vecs [3][3]float64) {
+	vecs = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-30 {
+			break
+		}
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < 3; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 3; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := vecs[k][p], vecs[k][q]
+					vecs[k][p], vecs[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, vecs
+}
+
+// tiltCompensatedHeading returns the magnetic heading from a calibrated magnetometer reading in the sensor frame,
+// rotated into the aircraft frame (x forward, y left, z up) with the sensor quaternion, and the roll and pitch (deg).
+func tiltCompensatedHeading(m [3]float64, sensorQuaternion [4]float64, roll, pitch float64) float64 {
+	f := ahrs.QuaternionToRotationMatrix(sensorQuaternion[0], sensorQuaternion[1], sensorQuaternion[2], sensorQuaternion[3])
+	var a [3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			a[i] += f[i][j] * m[j]
+		}
+	}
+	// Aircraft frame to forward-right-down body axes.
+	x, y, z := a[0], -a[1], -a[2]
+	phi, theta := common.Radians(roll), common.Radians(pitch)
+	xh := x*math.Cos(theta) + y*math.Sin(theta)*math.Sin(phi) + z*math.Sin(theta)*math.Cos(phi)
+	yh := y*math.Cos(phi) - z*math.Sin(phi)
+	return math.Mod(common.Degrees(math.Atan2(-yh, xh))+360, 360)
+}
+
+// magDeclinationCache avoids evaluating the magnetic model for every AHRS update.
+var magDeclinationCache struct {
+	mu       sync.Mutex
+	lat, lon float64
+	decl     float64
+	valid    bool
+	updated  time.Time // stratuxClock
+}
+
+// currentDeclination returns the magnetic declination at the current GPS position, false without a position.
+func currentDeclination() (float64, bool) {
+	if !isGPSValid() {
+		return 0, false
+	}
+	lat, lon := float64(mySituation.GPSLatitude), float64(mySituation.GPSLongitude)
+	c := &magDeclinationCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, _ := common.Distance(lat, lon, c.lat, c.lon); c.updated.IsZero() || d/1852 > magDeclinationMaxMove || stratuxClock.Since(c.updated) > magDeclinationMaxAge {
+		c.decl, c.valid = common.MagneticDeclination(lat, lon, float64(mySituation.GPSHeightAboveEllipsoid), time.Now())
+		c.lat, c.lon = lat, lon
+		c.updated = stratuxClock.Time
+		if !c.valid {
+			addSingleSystemErrorf("wmm-expired", "The World Magnetic Model has expired, magnetic headings may be off. Please update.")
+		}
+	}
+	return c.decl, true
+}
+
+// handleCalibrateMag starts ('s'), finishes ('f'), cancels ('c') or clears ('r') the magnetometer calibration on POST,
+// and returns the calibration status.
+func handleCalibrateMag(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	w.Header().Set("Access-Control-Allow-Method", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+
+	if r.Method == "POST" {
+		action := make([]byte, 1)
+		if n, _ := r.Body.Read(action); n == 0 {
+			http.Error(w, "magnetometer calibration received invalid request", http.StatusBadRequest)
+			return
+		}
+		switch action[0] {
+		case 's':
+			magCal.start()
+		case 'f':
+			if err := magCal.finish(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case 'c':
+			magCal.cancel()
+		case 'r':
+			magCal.cancel()
+			globalSettings.MagCalibration = MagCalibration{}
+			saveSettings()
+		default:
+			http.Error(w, "unknown magnetometer calibration action", http.StatusBadRequest)
+			return
+		}
+	} else if r.Method != "GET" {
+		return
+	}
+
+	magCal.mu.Lock()
+	status := struct {
+		State       string
+		Samples     int
+		Coverage    float64
+		Message     string
+		Calibration MagCalibration
+	}{magCal.State, magCal.Samples, magCal.Coverage, magCal.Message, globalSettings.MagCalibration}
+	magCal.mu.Unlock()
+	statusJSON, _ := json.Marshal(&status)
+	fmt.Fprintf(w, "%s\n", statusJSON)
+}
@@ -0,0 +1,299 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	magcal_test.go: Unit tests for the magnetometer calibration
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// magSphere returns n points evenly spread over a sphere (Fibonacci lattice).
+func magSphere(n int, radius float64) [][3]float64 {
+	res := make([][3]float64, n)
+	golden := math.Pi * (3 - math.Sqrt(5))
+	for i := range res {
+		z := 1 - 2*(float64(i)+0.5)/float64(n)
+		r := math.Sqrt(1 - z*z)
+		res[i] = [3]float64{radius * r * math.Cos(golden*float64(i)), radius * r * math.Sin(golden*float64(i)), radius * z}
+	}
+	return res
+}
+
+// magDistort applies soft iron distortion d and hard iron offset h to the samples.
+func magDistort(samples [][3]float64, d [3][3]float64, h [3]float64) [][3]float64 {
+	res := make([][3]float64, len(samples))
+	for n, s := range samples {
+		for i := 0; i < 3; i++ {
+			res[n][i] = h[i]
+			for j := 0; j < 3; j++ {
+				res[n][i] += d[i][j] * s[j]
+			}
+		}
+	}
+	return res
+}
+
+func magNorm(v [3]float64) float64 {
+	return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+}
+
+func TestMapMagAxes(t *testing.T) {
+	tests := []struct {
+		name string
+		axes [3]int
+		want [3]float64
+	}{
+		{"AK8963", magAxesAK8963, [3]float64{2, 1, -3}},
+		{"AK09916", magAxesAK09916, [3]float64{1, -2, -3}},
+		{"LSM9DS1", magAxesLSM9DS1, [3]float64{-1, 2, 3}},
+		{"Identity", [3]int{1, 2, 3}, [3]float64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := mapMagAxes(tt.axes, 1, 2, 3); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFitMagEllipsoid(t *testing.T) {
+	tests := []struct {
+		name     string
+		softIron [3][3]float64
+		hardIron [3]float64
+	}{
+		{"Sphere", [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, [3]float64{0, 0, 0}},
+		{"Hard iron", [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, [3]float64{30, -12, 85}},
+		{"Axis aligned", [3][3]float64{{1.2, 0, 0}, {0, 0.9, 0}, {0, 0, 1.05}}, [3]float64{-20, 5, 10}},
+		{"Rotated", [3][3]float64{{1.1, 0.08, -0.05}, {0.08, 0.95, 0.03}, {-0.05, 0.03, 1.0}}, [3]float64{12, 40, -33}},
+	}
+	for _, tt := range tests {
+		samples := magDistort(magSphere(500, 50), tt.softIron, tt.hardIron)
+		cal, err := fitMagEllipsoid(samples)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for i := range cal.HardIron {
+			if math.Abs(cal.HardIron[i]-tt.hardIron[i]) > 0.01 {
+				t.Errorf("%s: hard iron %v, want %v", tt.name, cal.HardIron, tt.hardIron)
+				break
+			}
+		}
+		if cal.FitError > 1e-6 {
+			t.Errorf("%s: fit error %f", tt.name, cal.FitError)
+		}
+		for _, s := range samples {
+			if r := magNorm(cal.Apply(s)); math.Abs(r-cal.FieldStrength) > 0.01 {
+				t.Errorf("%s: calibrated magnitude %f, field %f", tt.name, r, cal.FieldStrength)
+				break
+			}
+		}
+		if math.Abs(cal.FieldStrength-50) > 5 {
+			t.Errorf("%s: field strength %f", tt.name, cal.FieldStrength)
+		}
+	}
+
+	// Noise gives a fit error, a flat set of samples gives no fit.
+	noisy := magSphere(500, 50)
+	for i := range noisy {
+		noisy[i][0] += 10 * math.Sin(float64(i)*1.7)
+	}
+	if cal, err := fitMagEllipsoid(noisy); err == nil {
+		t.Errorf("noisy samples fitted, error %f", cal.FitError)
+	}
+	var flat [][3]float64
+	for i := 0; i < 100; i++ {
+		a := float64(i) / 100 * 2 * math.Pi
+		flat = append(flat, [3]float64{50 * math.Cos(a), 50 * math.Sin(a), 0})
+	}
+	if _, err := fitMagEllipsoid(flat); err == nil {
+		t.Errorf("flat samples fitted")
+	}
+	if _, err := fitMagEllipsoid(flat[:5]); err == nil {
+		t.Errorf("5 samples fitted")
+	}
+}
+
+func TestMagCoverage(t *testing.T) {
+	if c := magCoverage(magSphere(500, 50)); c != 1 {
+		t.Errorf("sphere coverage %f", c)
+	}
+	var circle [][3]float64
+	for i := 0; i < 100; i++ {
+		a := float64(i) / 100 * 2 * math.Pi
+		circle = append(circle, [3]float64{50 * math.Cos(a), 50 * math.Sin(a), 0})
+	}
+	// Only the 8 directions in the horizontal plane.
+	if c := magCoverage(circle); math.Abs(c-8.0/26) > 1e-9 {
+		t.Errorf("circle coverage %f", c)
+	}
+	if c := magCoverage(nil); c != 0 {
+		t.Errorf("empty coverage %f", c)
+	}
+}
+
+func TestMagLinearAlgebra(t *testing.T) {
+	m := [3][3]float64{{4, 1, 0.5}, {1, 3, -0.2}, {0.5, -0.2, 2}}
+	inv, ok := invert3(m)
+	if !ok {
+		t.Fatalf("not invertible")
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			var p float64
+			for k := 0; k < 3; k++ {
+				p += m[i][k] * inv[k][j]
+			}
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(p-want) > 1e-12 {
+				t.Errorf("m * inv [%d][%d] = %f", i, j, p)
+			}
+		}
+	}
+	if _, ok := invert3([3][3]float64{{1, 2, 3}, {2, 4, 6}, {0, 0, 1}}); ok {
+		t.Errorf("singular matrix inverted")
+	}
+
+	vals, vecs := symEigen3(m)
+	for n := 0; n < 3; n++ {
+		for i := 0; i < 3; i++ {
+			var mv float64
+			for k := 0; k < 3; k++ {
+				mv += m[i][k] * vecs[k][n]
+			}
+			if math.Abs(mv-vals[n]*vecs[i][n]) > 1e-9 {
+				t.Errorf("eigenpair %d: %f != %f", n, mv, vals[n]*vecs[i][n])
+			}
+		}
+	}
+
+	var a [9][9]float64
+	var want, b [9]float64
+	for i := 0; i < 9; i++ {
+		want[i] = float64(i) - 4
+		for j := 0; j < 9; j++ {
+			a[i][j] = 1 / float64(i+j+1)
+			if i == j {
+				a[i][j] += 1
+			}
+		}
+	}
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			b[i] += a[i][j] * want[j]
+		}
+	}
+	x, err := solveLinear9(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range x {
+		if math.Abs(x[i]-want[i]) > 1e-9 {
+			t.Errorf("x = %v, want %v", x, want)
+			break
+		}
+	}
+	if _, err := solveLinear9([9][9]float64{}, b); err == nil {
+		t.Errorf("singular system solved")
+	}
+}
+
+func TestTiltCompensatedHeading(t *testing.T) {
+	// Earth field in NED: 20 µT north, 45 µT down.
+	earth := [3]float64{20, 0, 45}
+	identity := [4]float64{1, 0, 0, 0}
+	tests := []struct {
+		heading, pitch, roll float64
+	}{
+		{0, 0, 0},
+		{90, 0, 0},
+		{225, 0, 0},
+		{45, 10, 0},
+		{300, 0, 30},
+		{135, -15, -45},
+		{10, 20, 60},
+	}
+	for _, tt := range tests {
+		psi, theta, phi := tt.heading*math.Pi/180, tt.pitch*math.Pi/180, tt.roll*math.Pi/180
+		// NED to forward-right-down body axes.
+		n, e, d := earth[0], earth[1], earth[2]
+		x1, y1 := n*math.Cos(psi)+e*math.Sin(psi), -n*math.Sin(psi)+e*math.Cos(psi)
+		x2, z2 := x1*math.Cos(theta)-d*math.Sin(theta), x1*math.Sin(theta)+d*math.Cos(theta)
+		y3, z3 := y1*math.Cos(phi)+z2*math.Sin(phi), -y1*math.Sin(phi)+z2*math.Cos(phi)
+		// Sensor frame is the aircraft frame: x forward, y left, z up.
+		m := [3]float64{x2, -y3, -z3}
+		got := tiltCompensatedHeading(m, identity, tt.roll, tt.pitch)
+		if math.Abs(simAngleDiff(got, tt.heading)) > 1e-6 {
+			t.Errorf("heading %.0f pitch %.0f roll %.0f: got %f", tt.heading, tt.pitch, tt.roll, got)
+		}
+	}
+}
+
+func TestMagCalibrator(t *testing.T) {
+	resetGPSState()
+	defer resetGPSState()
+	savedLocation, savedSettings := configLocation, globalSettings
+	configLocation = filepath.Join(t.TempDir(), "stratux.conf")
+	defer func() {
+		configLocation, globalSettings = savedLocation, savedSettings
+		magCal.cancel()
+	}()
+
+	post := func(action string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		handleCalibrateMag(w, httptest.NewRequest("POST", "/calibrateMag", strings.NewReader(action)))
+		var status map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w.Code, status
+	}
+
+	if code, _ := post("f"); code != 400 {
+		t.Errorf("finish without start: %d", code)
+	}
+	if _, status := post("s"); status["State"] != MAGCAL_COLLECTING {
+		t.Errorf("started: %v", status)
+	}
+	hardIron := [3]float64{15, -8, 30}
+	samples := magDistort(magSphere(600, 48), [3][3]float64{{1.1, 0, 0}, {0, 0.95, 0}, {0, 0, 1}}, hardIron)
+	for _, s := range samples[:100] {
+		magCal.addSample(s)
+	}
+	if code, _ := post("f"); code != 400 {
+		t.Errorf("finish with 100 samples: %d", code)
+	}
+	for _, s := range samples[100:] {
+		magCal.addSample(s)
+	}
+	code, status := post("f")
+	if code != 200 || status["State"] != MAGCAL_DONE || status["Samples"].(float64) != 600 || status["Coverage"].(float64) != 1 {
+		t.Errorf("finished %d: %v", code, status)
+	}
+	if !globalSettings.MagCalibration.Valid() || math.Abs(globalSettings.MagCalibration.HardIron[2]-30) > 0.01 {
+		t.Errorf("calibration %+v", globalSettings.MagCalibration)
+	}
+	// Samples after the run are ignored.
+	magCal.addSample([3]float64{1, 2, 3})
+	if magCal.Samples != 600 {
+		t.Errorf("sample added while idle")
+	}
+
+	if _, status := post("r"); status["State"] != MAGCAL_IDLE || globalSettings.MagCalibration.Valid() {
+		t.Errorf("reset: %v", status)
+	}
+	if code, _ := post("x"); code != 400 {
+		t.Errorf("unknown action: %d", code)
+	}
+}
@@ -109,6 +109,11 @@ var weatherRawUpdate *uibroadcaster
 The /weather websocket starts off by sending the current buffer of weather messages, then sends updates as they are received.
 */
 func handleWeatherWS(conn *websocket.Conn) {
+	// Send the stored weather first, so the client doesn't have to wait for the next uplink cycle.
+	sendStoredWeather(func(msg []byte) error {
+		_, err := conn.Write(msg)
+		return err
+	})
 	// Subscribe the socket to receive updates.
 	weatherUpdate.AddSocket(conn)
 
@@ -425,6 +430,11 @@ func handleSettingsSetRequest(w http.ResponseWriter, r *http.Request) {
 						globalSettings.OGNI2CTXEnabled = val.(bool)
 					case "GPS_Enabled":
 						globalSettings.GPS_Enabled = val.(bool)
+					case "GPS_UBX_Binary":
+						if globalSettings.GPS_UBX_Binary != val.(bool) {
+							globalSettings.GPS_UBX_Binary = val.(bool)
+							globalStatus.GPS_connected = false // Reconnect to reconfigure the receiver.
+						}
 					case "IMU_Sensor_Enabled":
 						globalSettings.IMU_Sensor_Enabled = val.(bool)
 						if !globalSettings.IMU_Sensor_Enabled && globalStatus.IMUConnected {
@@ -488,6 +498,27 @@ func handleSettingsSetRequest(w http.ResponseWriter, r *http.Request) {
 						globalSettings.WatchList = val.(string)
 					case "GLimits":
 						globalSettings.GLimits = val.(string)
+					case "AHRSFilter":
+						globalSettings.AHRSFilter = val.(string)
+					case "VarioLXWP0":
+						globalSettings.VarioLXWP0 = val.(bool)
+					case "VarioPOV":
+						globalSettings.VarioPOV = val.(bool)
+					case "VarioLK8EX1":
+						globalSettings.VarioLK8EX1 = val.(bool)
+					case "ThermalNMEA":
+						globalSettings.ThermalNMEA = val.(bool)
+					case "CrashDetection":
+						globalSettings.CrashDetection = val.(bool)
+					case "AltimeterSetting":
+						globalSettings.AltimeterSetting = altimeterSettingHPa(val.(float64))
+					case "WindTAS":
+						globalSettings.WindTAS = int(val.(float64))
+					case "ExceedanceLimits":
+						limits := globalSettings.ExceedanceLimits
+						if buf, err := json.Marshal(val); err == nil && json.Unmarshal(buf, &limits) == nil {
+							globalSettings.ExceedanceLimits = limits
+						}
 					case "OwnshipModeS":
 						codes := strings.Split(val.(string), ",")
 						codesFinal := make([]string, 0)
@@ -1304,7 +1335,9 @@ func managementInterface() {
 	http.HandleFunc("/getStatus", handleStatusRequest)
 	http.HandleFunc("/getSituation", handleSituationRequest)
 	http.HandleFunc("/getTowers", handleTowersRequest)
+	http.HandleFunc("/getTowerHistory", handleTowerHistoryRequest)
 	http.HandleFunc("/getSatellites", handleSatellitesRequest)
+	http.HandleFunc("/getGNSSSources", handleGNSSSourcesRequest)
 	http.HandleFunc("/getSettings", handleSettingsGetRequest)
 	http.HandleFunc("/getRegion", handleRegionGet)
 	http.HandleFunc("/setRegion", handleRegionSet)
@@ -1319,6 +1352,7 @@ func managementInterface() {
 	http.HandleFunc("/develmodetoggle", handleDevelModeToggle)
 	http.HandleFunc("/orientAHRS", handleOrientAHRS)
 	http.HandleFunc("/calibrateAHRS", handleCalibrateAHRS)
+	http.HandleFunc("/calibrateMag", handleCalibrateMag)
 	http.HandleFunc("/cageAHRS", handleCageAHRS)
 	http.HandleFunc("/resetGMeter", handleResetGMeter)
 	http.HandleFunc("/deletelogfile", handleDeleteLogFile)
@@ -1328,6 +1362,17 @@ func managementInterface() {
 	http.HandleFunc("/downloaddb", handleDownloadDBRequest)
 	http.HandleFunc("/tiles/tilesets", handleTilesets)
 	http.HandleFunc("/tiles/", handleTile)
+	http.HandleFunc("/api/flights", handleFlightsRequest)
+	http.HandleFunc("/api/flights/", handleFlightsRequest)
+	http.HandleFunc("/api/exceedances", handleExceedancesRequest)
+	http.HandleFunc("/api/crash", handleCrashRequest)
+	http.HandleFunc("/api/crash/cancel", handleCrashRequest)
+	http.HandleFunc("/api/interference", handleInterferenceRequest)
+	http.HandleFunc("/api/interference.geojson", handleInterferenceGeoJSONRequest)
+	http.HandleFunc("/api/thermals", handleThermalsRequest)
+	http.HandleFunc("/api/thermals.geojson", handleThermalsGeoJSONRequest)
+	http.HandleFunc("/api/weather/overlays.geojson", handleWeatherOverlaysRequest)
+	http.HandleFunc("/api/weather/", handleWeatherAPIRequest)
 
 	addr := fmt.Sprintf(":%d", ManagementAddr)
 	log.Printf("web configuration console on port %s", addr)
@@ -248,21 +248,34 @@ func tcpNMEAInListener() {
 func handleNmeaInConnection(c net.Conn) {
 	defer c.Close()
 	reader := bufio.NewReader(c)
-	// Set to fixed GPS_TYPE_NETWORK in the beginning, to override previous detected NMEA types
-	globalStatus.GPS_detected_type = GPS_TYPE_NETWORK
-	globalStatus.GPS_NetworkRemoteIp = strings.Split(c.RemoteAddr().String(), ":")[0]
+	remoteIp := strings.Split(c.RemoteAddr().String(), ":")[0]
+	source := GNSS_SOURCE_NETWORK + remoteIp
+	// A serial GPS that is already running keeps its detected type. Both feed the GNSS source manager.
+	serialGPS := !readyToInitGPS
+	if !serialGPS {
+		// Set to fixed GPS_TYPE_NETWORK in the beginning, to override previous detected NMEA types
+		globalStatus.GPS_detected_type = GPS_TYPE_NETWORK
+	}
+	globalStatus.GPS_NetworkRemoteIp = remoteIp
 	for {
 		globalStatus.GPS_connected = true
-		// Keep detected protocol, only ensure type=network
-		globalStatus.GPS_detected_type = GPS_TYPE_NETWORK | (globalStatus.GPS_detected_type & 0xf0)
+		if !serialGPS {
+			// Keep detected protocol, only ensure type=network
+			globalStatus.GPS_detected_type = GPS_TYPE_NETWORK | (globalStatus.GPS_detected_type & 0xf0)
+		}
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			break
 		}
-		processNMEALine(line)
+		processNMEALineSource(source, line, false)
+	}
+	mySituation.muGPS.Lock()
+	gnssSources.remove(source)
+	mySituation.muGPS.Unlock()
+	if !serialGPS || readyToInitGPS {
+		globalStatus.GPS_connected = false
+		globalStatus.GPS_detected_type = 0
 	}
-	globalStatus.GPS_connected = false
-	globalStatus.GPS_detected_type = 0
 	globalStatus.GPS_NetworkRemoteIp = ""
 }
 
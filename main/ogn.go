@@ -271,9 +271,13 @@ func importOgnTrafficMessage(msg OgnMessage, data string, fakeCurrentTime bool)
 	// To keep the rest of the system as simple as possible, we want to work with barometric altitude everywhere.
 	// To do so, we use our own known geoid separation and pressure difference to compute the expected barometric altitude of the traffic.
 	// Some OGN trackers are equiped with a baro sensor, but older firmwares send wrong data, so we usually can't rely on it.
+	geoidSep := float32(common.GeoidHeightFt(float64(msg.Lat_deg), float64(msg.Lon_deg)))
 	alt := msg.Alt_msl_m * 3.28084
+	hae := msg.Alt_hae_m * 3.28084
 	if alt == 0 {
-		alt = msg.Alt_hae_m*3.28084 - mySituation.GPSGeoidSep
+		alt = hae - geoidSep
+	} else if hae == 0 {
+		hae = alt + geoidSep
 	}
 	if isGPSValid() && isTempPressValid() {
 		ti.Alt = int32(alt - mySituation.GPSAltitudeMSL + mySituation.BaroPressureAltitude)
@@ -284,7 +288,7 @@ func importOgnTrafficMessage(msg OgnMessage, data string, fakeCurrentTime bool)
 		ti.AltIsGNSS = false
 	} else {
 		// Fall back to GNSS alt
-		ti.Alt = int32(alt)
+		ti.Alt = int32(hae)
 		ti.AltIsGNSS = true
 	}
 
@@ -335,6 +339,7 @@ func importOgnTrafficMessage(msg OgnMessage, data string, fakeCurrentTime bool)
 	traffic[key] = ti
 	postProcessTraffic(&ti)
 	registerTrafficUpdate(ti)
+	registerThermalReport(ti)
 	seenTraffic[key] = true
 
 	if globalSettings.DEBUG {
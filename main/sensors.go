@@ -8,7 +8,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/stratux/stratux/sensors/bmp388"
+	"github.com/stratux/stratux/sensors/bmi270"
+	"github.com/stratux/stratux/sensors/bmp581"
+	"github.com/stratux/stratux/sensors/bno085"
+	"github.com/stratux/stratux/sensors/dps310"
+	"github.com/stratux/stratux/sensors/lps22hb"
+	"github.com/stratux/stratux/sensors/lsm6dso"
+	"github.com/stratux/stratux/sensors/lsm9ds1"
+	"github.com/stratux/stratux/sensors/ms5611"
 
 	"github.com/kidoman/embd"
 	_ "github.com/kidoman/embd/host/all"
@@ -23,17 +30,6 @@ const (
 	numRetries uint8 = 50
 	calCLimit        = 0.15
 	calDLimit        = 10.0
-
-	// WHO_AM_I values to differentiate between the different IMUs.
-	MPUREG_WHO_AM_I             = 0x75
-	MPUREG_WHO_AM_I_VAL         = 0x71 // Expected value.
-	MPUREG_WHO_AM_I_VAL_9255    = 0x73 // Expected value for MPU9255, seems to be compatible to 9250
-	MPUREG_WHO_AM_I_VAL_6500    = 0x70 // Expected value for MPU6500, seems to be same as 9250 but without magnetometer
-	MPUREG_WHO_AM_I_VAL_60X0    = 0x68 // Expected value for MPU6000 and MPU6050 (and MPU9150)
-	MPUREG_WHO_AM_I_VAL_UNKNOWN = 0x75 // Unknown MPU found on recent batch of gy91 boards see discussion 182
-	ICMREG_WHO_AM_I             = 0x00
-	ICMREG_WHO_AM_I_VAL         = 0xEA             // Expected value.
-	PRESSURE_WHO_AM_I           = bmp388.RegChipId // Expected address for bosch pressure sensors bmpXXX.
 )
 
 var (
@@ -81,49 +77,53 @@ func pollSensors() {
 }
 
 func initPressureSensor() (ok bool) {
+	info, found := sensors.DetectPressureSensor(&i2cbus)
+	if !found {
+		log.Printf("No pressure sensor found\n")
+		return false
+	}
+	log.Printf("%s detected at 0x%02X\n", info.Model, info.Address)
 
-	v, err := i2cbus.ReadByteFromReg(0x76, PRESSURE_WHO_AM_I)
-
-	if err != nil {
-		v, err = i2cbus.ReadByteFromReg(0x77, PRESSURE_WHO_AM_I)
+	var (
+		reader sensors.PressureReader
+		err    error
+	)
+	switch info.Model {
+	case sensors.PressureSensorBMP388, sensors.PressureSensorBMP390:
+		reader, err = sensors.NewBMP388(&i2cbus, info.Address)
+	case sensors.PressureSensorBMP581:
+		reader, err = sensors.NewBMP581(&i2cbus, info.Address, bmp581.DefaultConfig)
+	case sensors.PressureSensorDPS310:
+		reader, err = sensors.NewDPS310(&i2cbus, info.Address, dps310.DefaultConfig)
+	case sensors.PressureSensorLPS22HB:
+		reader, err = sensors.NewLPS22HB(&i2cbus, info.Address, lps22hb.DefaultConfig)
+	case sensors.PressureSensorMS5611:
+		reader, err = sensors.NewMS5611(&i2cbus, info.Address, ms5611.DefaultConfig)
+	default:
+		reader, err = sensors.NewBMP280(&i2cbus, 100*time.Millisecond)
 	}
 	if err != nil {
-		log.Printf("Error identifying BMP: %s\n", err.Error())
+		log.Printf("Error initializing %s: %s\n", info.Model, err.Error())
 		return false
 	}
-	if v == bmp388.ChipId || v == bmp388.ChipId390 {
-		log.Printf("BMP-388 detected")
-		bmp, err := sensors.NewBMP388(&i2cbus)
-		if err == nil {
-			myPressureReader = bmp
-			return true
-		}
-	} else {
-		log.Printf("using BMP-280")
-		bmp, err := sensors.NewBMP280(&i2cbus, 100*time.Millisecond)
-		if err == nil {
-			myPressureReader = bmp
-			return true
-		}
-	}
-
-	return false
+	myPressureReader = reader
+	return true
 }
 
 func tempAndPressureSender() {
 	var (
-		temp     float64
-		press    float64
-		altLast  = -9999.9
-		altitude float64
-		err      error
-		dt       = 0.1
-		failNum  uint8
+		temp      float64
+		press     float64
+		pressLast float64
+		altLast   = -9999.9
+		altitude  float64
+		err       error
+		dt        = 0.05
+		failNum   uint8
+		v         vario
+		lastTime  time.Time
 	)
 
-	// Initialize variables for rate of climb calc
-	u := 5 / (5 + float32(dt)) // Use 5 sec decay time for rate of climb, slightly faster than typical VSI
-
 	timer := time.NewTicker(time.Duration(1000*dt) * time.Millisecond)
 	for globalSettings.BMP_Sensor_Enabled && globalStatus.BMPConnected {
 		<-timer.C
@@ -152,6 +152,10 @@ func tempAndPressureSender() {
 			}
 			continue
 		}
+		if press == pressLast {
+			continue // Not updated yet, the BMP280 only reads at 10 Hz.
+		}
+		pressLast = press
 
 		altitude = common.CalcAltitude(press, globalSettings.AltitudeOffset)
 		if altitude > 70000 || (isGPSValid() && mySituation.GPSAltitudeMSL != 0 && math.Abs(float64(mySituation.GPSAltitudeMSL)-altitude) > 5000) {
@@ -159,6 +163,13 @@ func tempAndPressureSender() {
 			continue
 		}
 
+		sampleDt := dt
+		if !lastTime.IsZero() {
+			sampleDt = stratuxClock.Time.Sub(lastTime).Seconds()
+		}
+		lastTime = stratuxClock.Time
+		vs, te := v.update(altitude, mySituation.GPSGroundSpeed, isGPSValid(), sampleDt)
+
 		// Update the Situation data.
 		mySituation.muBaro.Lock()
 		mySituation.BaroLastMeasurementTime = stratuxClock.Time
@@ -167,51 +178,59 @@ func tempAndPressureSender() {
 		if altLast < -2000 {
 			altLast = altitude // Initialize
 		}
-		// Assuming timer is reasonably accurate, use a regular ewma
-		mySituation.BaroVerticalSpeed = u*mySituation.BaroVerticalSpeed + (1-u)*float32(altitude-altLast)/(float32(dt)/60)
+		// Use 5 sec decay time for rate of climb, slightly faster than typical VSI
+		u := 5 / (5 + float32(sampleDt))
+		mySituation.BaroVerticalSpeed = u*mySituation.BaroVerticalSpeed + (1-u)*float32(altitude-altLast)/(float32(sampleDt)/60)
+		mySituation.BaroVario = float32(vs)
+		mySituation.BaroTEVario = float32(te)
 		mySituation.BaroSourceType = BARO_TYPE_BMP280
 		mySituation.muBaro.Unlock()
 		altLast = altitude
+
+		sendVarioNMEA()
 	}
 	//mySituation.BaroPressureAltitude = 99999
 	//mySituation.BaroVerticalSpeed = 99999
 }
 
 func initIMU() (ok bool) {
-	// Check if the chip is the ICM-20948 or MPU-9250.
-	v, err := i2cbus.ReadByteFromReg(0x68, ICMREG_WHO_AM_I)
-	if err != nil {
-		log.Printf("Error identifying IMU: %s\n", err.Error())
-		return false
-	}
-	v2, err := i2cbus.ReadByteFromReg(0x68, MPUREG_WHO_AM_I)
-	if err != nil {
-		log.Printf("Error identifying IMU: %s\n", err.Error())
+	info, found := sensors.DetectIMU(&i2cbus)
+	if !found {
+		log.Printf("No IMU found\n")
 		return false
 	}
+	log.Printf("%s detected at 0x%02X\n", info.Model, info.Address)
 
-	if v == ICMREG_WHO_AM_I_VAL {
-		log.Println("ICM-20948 detected.")
-		imu, err := sensors.NewICM20948(&i2cbus)
-		if err == nil {
-			myIMUReader = imu
-			return true
-		}
-	} else if v2 == MPUREG_WHO_AM_I_VAL || v2 == MPUREG_WHO_AM_I_VAL_9255 || v2 == MPUREG_WHO_AM_I_VAL_6500 ||
-		v2 == MPUREG_WHO_AM_I_VAL_60X0 || v2 == MPUREG_WHO_AM_I_VAL_UNKNOWN {
-
-		log.Printf("MPU detected (%02x).\n", v2)
-		imu, err := sensors.NewMPU9250(&i2cbus)
-		if err == nil {
-			myIMUReader = imu
-			return true
-		}
-	} else {
-		log.Printf("Could not identify MPU. v=%02x, v2=%02x.\n", v, v2)
+	var (
+		reader sensors.IMUReader
+		axes   = [3]int{1, 2, 3} // Unused without a magnetometer.
+		err    error
+	)
+	switch info.Model {
+	case sensors.IMUSensorICM20948:
+		reader, err = sensors.NewICM20948(&i2cbus)
+		axes = magAxesAK09916
+	case sensors.IMUSensorLSM6DSO:
+		reader, err = sensors.NewLSM6DSO(&i2cbus, info.Address, lsm6dso.DefaultConfig)
+	case sensors.IMUSensorLSM9DS1:
+		reader, err = sensors.NewLSM9DS1(&i2cbus, info.Address, info.MagAddress, lsm9ds1.DefaultConfig)
+		axes = magAxesLSM9DS1
+	case sensors.IMUSensorBMI270:
+		reader, err = sensors.NewBMI270(&i2cbus, info.Address, bmi270.DefaultConfig, bmi270.ConfigFile)
+	case sensors.IMUSensorBNO085:
+		reader, err = sensors.NewBNO085(&i2cbus, info.Address, bno085.DefaultConfig)
+		axes = magAxesBNO085
+	default:
+		reader, err = sensors.NewMPU9250(&i2cbus)
+		axes = magAxesAK8963
+	}
+	if err != nil {
+		log.Printf("Error initializing %s: %s\n", info.Model, err.Error())
 		return false
 	}
-
-	return false
+	myIMUReader = reader
+	imuMagAxes = axes
+	return true
 }
 
 //FIXME: Shoud be moved to managementinterface.go and standardized on management interface port.
@@ -224,8 +243,9 @@ func sensorAttitudeSender() {
 		failNum              uint8
 	)
 
-	s := ahrs.NewSimpleAHRS()
+	var s ahrsEstimator
 	m := ahrs.NewMeasurement()
+	in := &ahrsInput{Measurement: m}
 	cal = make(chan (string), 1)
 
 	// Set up loggers for analysis
@@ -239,6 +259,13 @@ func sensorAttitudeSender() {
 	// Need a sampling freq faster than 10Hz
 	timer := time.NewTicker(50 * time.Millisecond) // ~20Hz update.
 	for {
+		// Pick the estimator, again whenever the setting changes.
+		if name := ahrsFilterName(globalSettings.AHRSFilter, myIMUReader); s == nil || s.Name() != name {
+			log.Printf("AHRS Info: using the %s attitude filter\n", name)
+			s = newAHRSEstimator(name, myIMUReader)
+			analysisLogger = nil // The new estimator logs other values.
+		}
+
 		// Set sensor gyro calibrations
 		if c, d := &globalSettings.C, &globalSettings.D; d[0]*d[0]+d[1]*d[1]+d[2]*d[2] > 0 {
 			s.SetCalibrations(c, d)
@@ -265,7 +292,8 @@ func sensorAttitudeSender() {
 		failNum = 0
 		<-timer.C
 		time.Sleep(950 * time.Millisecond)
-		for globalSettings.IMU_Sensor_Enabled && globalStatus.IMUConnected {
+		for globalSettings.IMU_Sensor_Enabled && globalStatus.IMUConnected &&
+			ahrsFilterName(globalSettings.AHRSFilter, myIMUReader) == s.Name() {
 			<-timer.C
 
 			// Process calibration and level requests
@@ -328,12 +356,24 @@ func sensorAttitudeSender() {
 				continue
 			}
 			failNum = 0
+			registerCrashAccel(t, m.A1, m.A2, m.A3)
 			if magError != nil {
 				if globalSettings.DEBUG {
 					log.Printf("AHRS Magnetometer Error, not using for this run: %s\n", magError)
 				}
 				m.MValid = false
 			}
+			if m.MValid {
+				// Into the sensor frame, then calibrated for hard and soft iron.
+				mag := mapMagAxes(imuMagAxes, m.M1, m.M2, m.M3)
+				magCal.addSample(mag)
+				if globalSettings.MagCalibration.Valid() {
+					mag = globalSettings.MagCalibration.Apply(mag)
+				} else {
+					m.MValid = false
+				}
+				m.M1, m.M2, m.M3 = mag[0], mag[1], mag[2]
+			}
 
 			// Make the GPS measurements.
 			m.TW = float64(mySituation.GPSLastGroundTrackTime.UnixNano()/1000) / 1e6
@@ -341,15 +381,16 @@ func sensorAttitudeSender() {
 			if m.WValid {
 				m.W1 = mySituation.GPSGroundSpeed * math.Sin(float64(mySituation.GPSTrueCourse)*ahrs.Deg)
 				m.W2 = mySituation.GPSGroundSpeed * math.Cos(float64(mySituation.GPSTrueCourse)*ahrs.Deg)
-				if globalSettings.BMP_Sensor_Enabled && globalStatus.BMPConnected {
-					m.W3 = float64(mySituation.BaroVerticalSpeed * 60 / 6076.12)
-				} else {
-					m.W3 = float64(mySituation.GPSVerticalSpeed) * 3600 / 6076.12
-				}
 			}
+			in.GPSVSValid = m.WValid
+			in.GPSVS = float64(mySituation.GPSVerticalSpeed) * 3600 / 6076.12
+			in.BaroVSValid = globalSettings.BMP_Sensor_Enabled && globalStatus.BMPConnected
+			in.BaroVS = float64(mySituation.BaroVerticalSpeed * 60 / 6076.12)
+			in.TBaro = float64(mySituation.BaroLastMeasurementTime.UnixNano()/1000) / 1e6
+			in.Declination, in.DeclinationValid = currentDeclination()
 
 			// Run the AHRS calculations.
-			s.Compute(m)
+			s.Compute(in)
 
 			// If we have valid AHRS info, then update mySituation.
 			mySituation.muAttitude.Lock()
@@ -362,8 +403,19 @@ func sensorAttitudeSender() {
 					mySituation.AHRSGyroHeading /= ahrs.Deg
 				}
 
-				//TODO westphae: until magnetometer calibration is performed, no mag heading
 				mySituation.AHRSMagHeading = ahrs.Invalid
+				if m.MValid {
+					mySituation.AHRSMagHeading = tiltCompensatedHeading([3]float64{m.M1, m.M2, m.M3},
+						globalSettings.SensorQuaternion, mySituation.AHRSRoll, mySituation.AHRSPitch)
+					// Without a GPS track (on the ground, hovering) the heading comes from the magnetometer.
+					if in.DeclinationValid && isAHRSInvalidValue(mySituation.AHRSGyroHeading) {
+						mySituation.AHRSGyroHeading = common.MagneticToTrue(mySituation.AHRSMagHeading, in.Declination)
+					}
+				}
+				if fusion, ok := s.(*fusionEstimator); ok {
+					// The sensor hub's own heading beats the tilt compensation with our attitude.
+					mySituation.AHRSMagHeading = fusion.magHeading
+				}
 				mySituation.AHRSSlipSkid = s.SlipSkid()
 				mySituation.AHRSTurnRate = s.RateOfTurn()
 				mySituation.AHRSGLoad = s.GLoad()
@@ -388,6 +440,7 @@ func sensorAttitudeSender() {
 				mySituation.AHRSLastAttitudeTime = time.Time{}
 				s.Reset()
 			}
+			mySituation.AHRSFilter = s.Health()
 			mySituation.muAttitude.Unlock()
 
 			makeAHRSGDL90Report() // Send whether or not valid - the function will invalidate the values as appropriate
@@ -422,6 +475,26 @@ func sensorAttitudeSender() {
 	}
 }
 
+// fusedAttitude converts an on-chip fusion quaternion, which rotates the sensor frame into east-north-up, into
+// roll, pitch and magnetic heading in degrees of the aircraft, given the sensor's mounting.
+func fusedAttitude(q, sensorQuaternion [4]float64) (roll, pitch, heading float64) {
+	ws := ahrs.QuaternionToRotationMatrix(q[0], q[1], q[2], q[3])
+	f := ahrs.QuaternionToRotationMatrix(sensorQuaternion[0], sensorQuaternion[1], sensorQuaternion[2], sensorQuaternion[3])
+	// Columns of the aircraft to world rotation: the forward, left and up axes in east-north-up.
+	var wa [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				wa[i][j] += ws[i][k] * f[j][k]
+			}
+		}
+	}
+	pitch = common.Degrees(math.Asin(math.Max(-1, math.Min(1, wa[2][0]))))
+	roll = common.Degrees(math.Atan2(wa[2][1], wa[2][2]))
+	heading = math.Mod(common.Degrees(math.Atan2(wa[0][0], wa[1][0]))+360, 360)
+	return
+}
+
 func updateExtraLogging() {
 	logMap["GPSNACp"] = float64(mySituation.GPSNACp)
 	logMap["GPSTrueCourse"] = mySituation.GPSTrueCourse
@@ -538,6 +611,10 @@ func updateAHRSStatus() {
 		if imu && analysisLogger != nil {
 			msg += 1 << 4
 		}
+		// Attitude filter is converged and consistent
+		if imu && mySituation.AHRSFilter.Healthy {
+			msg += 1 << 5
+		}
 		mySituation.AHRSStatus = msg
 	}
 }
@@ -0,0 +1,105 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	sensors_test.go: Unit tests for the IMU attitude helpers
+*/
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors"
+	"github.com/stratux/stratux/sensors/bmi270"
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+// axisQuaternion is the rotation by angle degrees about the unit axis.
+func axisQuaternion(angle float64, axis [3]float64) [4]float64 {
+	s, c := math.Sincos(angle * math.Pi / 360)
+	return [4]float64{c, s * axis[0], s * axis[1], s * axis[2]}
+}
+
+func TestFusedAttitude(t *testing.T) {
+	mountings := []struct {
+		name string
+		f    [4]float64 // Sensor to aircraft frame.
+	}{
+		{"Aligned", [4]float64{1, 0, 0, 0}},
+		{"Turned 90°", axisQuaternion(90, [3]float64{0, 0, 1})},
+		{"Upside down", axisQuaternion(180, [3]float64{1, 0, 0})},
+		{"Standing on its side", axisQuaternion(-90, [3]float64{0, 1, 0})},
+	}
+	attitudes := []struct {
+		heading, pitch, roll float64
+	}{
+		{0, 0, 0},
+		{90, 0, 0},
+		{250, 0, 0},
+		{45, 10, 0},
+		{300, 0, 30},
+		{135, -15, -45},
+		{10, 20, 60},
+	}
+	for _, m := range mountings {
+		for _, a := range attitudes {
+			// Aircraft to east-north-up: heading is clockwise from north, pitch is nose up about the left wing,
+			// roll is right wing down about the nose.
+			q := axisQuaternion(90-a.heading, [3]float64{0, 0, 1})
+			q = ahrsQuaternionProduct(q, axisQuaternion(-a.pitch, [3]float64{0, 1, 0}))
+			q = ahrsQuaternionProduct(q, axisQuaternion(a.roll, [3]float64{1, 0, 0}))
+			q = ahrsQuaternionProduct(q, m.f) // Sensor to east-north-up.
+
+			roll, pitch, heading := fusedAttitude(q, m.f)
+			if math.Abs(roll-a.roll) > 1e-9 || math.Abs(pitch-a.pitch) > 1e-9 || math.Abs(simAngleDiff(heading, a.heading)) > 1e-9 {
+				t.Errorf("%s, %+v: roll %f pitch %f heading %f", m.name, a, roll, pitch, heading)
+			}
+		}
+	}
+}
+
+// TestInitIMUBMI270 finds a BMI270 that only starts with Bosch's configuration file uploaded.
+func TestInitIMUBMI270(t *testing.T) {
+	regs := i2cemu.NewRegisters(map[byte]byte{bmi270.RegChipId: bmi270.ChipId})
+	regs.FIFO = map[byte]bool{bmi270.RegInitData: true}
+	var uploaded []byte
+	var pos int
+	regs.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		switch reg {
+		case bmi270.RegInitAddr1:
+			pos = 2 * (int(r.Regs[bmi270.RegInitAddr0]&0x0F) | int(value)<<4)
+		case bmi270.RegInitData:
+			for len(uploaded) <= pos {
+				uploaded = append(uploaded, 0)
+			}
+			uploaded[pos] = value
+			pos++
+		case bmi270.RegInitCtrl:
+			if value == 1 && len(uploaded) == 8192 && bytes.Equal(uploaded, bmi270.ConfigFile) {
+				r.Regs[bmi270.RegInternalStatus] = bmi270.InitOk
+			}
+		}
+	}
+	// 1 G at 8192 LSB/G.
+	regs.Set(bmi270.RegData, 0, 0, 0, 0, 0x00, 0x20, 0, 0, 0, 0, 0, 0)
+	bus := i2cemu.NewBus()
+	bus.Attach(bmi270.AddressAlt, regs)
+
+	origBus, origReader, origAxes := i2cbus, myIMUReader, imuMagAxes
+	defer func() { i2cbus, myIMUReader, imuMagAxes = origBus, origReader, origAxes }()
+	i2cbus = *bus.I2CBus()
+	if !initIMU() {
+		t.Fatalf("no IMU, %d bytes of the configuration file uploaded", len(uploaded))
+	}
+	defer myIMUReader.Close()
+	if _, ok := myIMUReader.(*sensors.BMI270); !ok {
+		t.Fatalf("reader %T", myIMUReader)
+	}
+	if _, _, _, _, a1, a2, a3, _, _, _, err, _ := myIMUReader.ReadOne(); err != nil || a1 != 0 || a2 != 0 || math.Abs(a3-1) > 0.01 {
+		t.Errorf("accel %f %f %f, %v", a1, a2, a3, err)
+	}
+}
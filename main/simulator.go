@@ -0,0 +1,529 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	simulator.go: Route driven ownship simulator for bench testing without GPS reception (-sim <route>).
+	 Flies the route with standard rate turns and synthesizes NMEA (fed through the normal NMEA parser),
+	 baro altitude and a consistent AHRS attitude, plus optional scripted traffic on intercept courses.
+
+	 The route is a GPX file (route, track or waypoints; <ele> is used as altitude) or JSON:
+	 {
+	   "Name": "KOSH pattern", "QNH": 1020, "Loop": true,
+	   "Waypoints": [{"Lat": 43.98, "Lon": -88.56, "Alt": 1000, "Speed": 90}, ...],
+	   "Traffic": [{"Tail": "N12345", "Start": 30, "Bearing": 90, "Speed": 120, "RelAlt": 200, "CPATime": 60}]
+	 }
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	GNSS_SOURCE_SIMULATOR = "simulator"
+
+	simTickInterval    = 200 * time.Millisecond
+	simSatelliteEvery  = 5 // Ticks between GSA/GSV sets.
+	simDefaultSpeed    = 100.0
+	simDefaultAltitude = 3000.0
+	simStandardRate    = 3.0  // deg/s
+	simTurnRateAccel   = 1.5  // deg/s², i.e. two seconds to roll into a standard rate turn.
+	simSpeedAccel      = 2.0  // kts/s
+	simMaxVerticalRate = 1000 // fpm
+	simVerticalAccel   = 200  // fpm/s
+	simWaypointRadius  = 0.2  // nm
+	simStdPressure     = 1013.25
+
+	simAddressBlockScripted  = 0xF00000
+	simAddressBlockFlightSim = 0xF10000
+)
+
+// SimWaypoint is a route point. Speed is the ground speed on the leg to this waypoint.
+type SimWaypoint struct {
+	Lat   float64
+	Lon   float64
+	Alt   float64 // ft MSL
+	Speed float64 // kts
+}
+
+// SimTraffic is a scripted target that appears at Start and flies straight to meet the ownship at the
+// closest point of approach (CPA), assuming the ownship doesn't turn meanwhile.
+type SimTraffic struct {
+	Tail         string
+	Icao         string  // Hex, e.g. "A1B2C3". Made up from the tail if empty.
+	Start        float64 // s after the simulation start.
+	Bearing      float64 // deg, where the target comes from relative to the ownship track: 0 head-on, 90 from the right, 180 from behind.
+	Speed        float64 // kts
+	RelAlt       float64 // ft above the ownship at the CPA.
+	CPATime      float64 // s from Start to the CPA.
+	MissDistance float64 // nm, to the right of the ownship at the CPA. Negative to the left.
+	Duration     float64 // s the target is shown. Defaults to twice CPATime.
+}
+
+type SimRoute struct {
+	Name      string
+	QNH       float64 // hPa, for the baro altitude. Defaults to standard pressure.
+	Loop      bool    // After the last waypoint, start over at the first one. Otherwise circle the last one.
+	Waypoints []SimWaypoint
+	Traffic   []SimTraffic
+}
+
+// simTarget is a scripted target once its straight line course has been worked out.
+type simTarget struct {
+	SimTraffic
+	icao      uint32
+	lat, lon  float64 // at Start
+	track     float64
+	alt       float64 // ft MSL
+	startTime float64
+}
+
+type simulator struct {
+	route    SimRoute
+	next     int // Index of the waypoint we're flying to.
+	orbiting bool
+	elapsed  float64 // s
+	lat, lon float64
+	alt      float64 // ft MSL
+	gs       float64 // kts
+	track    float64 // deg true
+	vs       float64 // fpm
+	turnRate float64 // deg/s, right positive
+	pending  []SimTraffic
+	targets  []simTarget
+	ticks    int
+}
+
+// gpxFile is the subset of GPX 1.1 the simulator reads.
+type gpxFile struct {
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat float64  `xml:"lat,attr"`
+	Lon float64  `xml:"lon,attr"`
+	Ele *float64 `xml:"ele"` // m
+}
+
+// parseGPXRoute takes the first route of a GPX file, else its first track, else its waypoints.
+func parseGPXRoute(data []byte) (SimRoute, error) {
+	var gpx gpxFile
+	if err := xml.Unmarshal(data, &gpx); err != nil {
+		return SimRoute{}, err
+	}
+	points := gpx.Waypoints
+	if len(gpx.Tracks) > 0 && len(gpx.Tracks[0].Segments) > 0 {
+		points = gpx.Tracks[0].Segments[0].Points
+	}
+	if len(gpx.Routes) > 0 {
+		points = gpx.Routes[0].Points
+	}
+	var route SimRoute
+	alt := simDefaultAltitude
+	for _, p := range points {
+		if p.Ele != nil {
+			alt = *p.Ele * 3.28084
+		}
+		route.Waypoints = append(route.Waypoints, SimWaypoint{Lat: p.Lat, Lon: p.Lon, Alt: alt})
+	}
+	return route, nil
+}
+
+// loadSimRoute reads a JSON or GPX route file and fills in the defaults.
+func loadSimRoute(fileName string) (SimRoute, error) {
+	var route SimRoute
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return route, err
+	}
+	if strings.EqualFold(filepath.Ext(fileName), ".gpx") {
+		route, err = parseGPXRoute(data)
+		route.Name = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	} else {
+		err = json.Unmarshal(data, &route)
+	}
+	if err != nil {
+		return route, err
+	}
+	if len(route.Waypoints) < 2 {
+		return route, errors.New("route needs at least two waypoints")
+	}
+	if route.QNH == 0 {
+		route.QNH = simStdPressure
+	}
+	for i := range route.Waypoints {
+		if route.Waypoints[i].Speed <= 0 {
+			route.Waypoints[i].Speed = simDefaultSpeed
+		}
+	}
+	return route, nil
+}
+
+// newSimulator puts the ownship on the first waypoint, heading for the second one.
+func newSimulator(route SimRoute) *simulator {
+	s := &simulator{route: route, next: 1}
+	first := route.Waypoints[0]
+	s.lat, s.lon, s.alt = first.Lat, first.Lon, first.Alt
+	s.gs = route.Waypoints[1].Speed
+	_, s.track = common.Distance(first.Lat, first.Lon, route.Waypoints[1].Lat, route.Waypoints[1].Lon)
+	s.pending = append(s.pending, route.Traffic...)
+	sort.SliceStable(s.pending, func(i, j int) bool { return s.pending[i].Start < s.pending[j].Start })
+	return s
+}
+
+func simClamp(v, limit float64) float64 {
+	return math.Max(-limit, math.Min(limit, v))
+}
+
+// simAngleDiff returns a-b in -180..180.
+func simAngleDiff(a, b float64) float64 {
+	return math.Mod(a-b+540, 360) - 180
+}
+
+// step advances the simulation by dt seconds.
+func (s *simulator) step(dt float64) {
+	s.elapsed += dt
+	wp := s.route.Waypoints[s.next]
+	dist, brg := common.Distance(s.lat, s.lon, wp.Lat, wp.Lon)
+	distNM := dist / 1852
+
+	s.gs += simClamp(wp.Speed-s.gs, simSpeedAccel*dt)
+
+	// Climb or descend to reach the waypoint altitude when getting there.
+	minutes := distNM / math.Max(s.gs, 1) * 60
+	if s.orbiting {
+		minutes = 0.5
+	}
+	wantVS := simClamp((wp.Alt-s.alt)/math.Max(minutes, 0.1), simMaxVerticalRate)
+	s.vs += simClamp(wantVS-s.vs, simVerticalAccel*dt)
+	s.alt += s.vs * dt / 60
+
+	// Turn towards the waypoint at up to standard rate, or circle it.
+	wantRate := simClamp(simAngleDiff(brg, s.track)/2, simStandardRate)
+	if s.orbiting {
+		wantRate = simStandardRate
+	}
+	s.turnRate += simClamp(wantRate-s.turnRate, simTurnRateAccel*dt)
+	s.track = math.Mod(s.track+s.turnRate*dt+360, 360)
+
+	s.lat, s.lon = calcLocationForBearingDistance(s.lat, s.lon, s.track, s.gs*dt/3600)
+
+	// Waypoint passed when close, or when it is behind us within a turn diameter.
+	turnRadius := s.gs / 3600 / common.Radians(simStandardRate)
+	passed := distNM < simWaypointRadius || (distNM < 2*turnRadius && math.Abs(simAngleDiff(brg, s.track)) > 90)
+	if !s.orbiting && passed {
+		s.next++
+		if s.next == len(s.route.Waypoints) {
+			if s.route.Loop {
+				s.next = 0
+			} else {
+				s.next--
+				s.orbiting = true
+			}
+		}
+	}
+
+	// Scripted traffic that is due.
+	for len(s.pending) > 0 && s.pending[0].Start <= s.elapsed {
+		s.targets = append(s.targets, s.launchTarget(s.pending[0]))
+		s.pending = s.pending[1:]
+	}
+}
+
+// attitude returns the roll (deg, right positive), pitch (deg) and load factor of a coordinated turn / climb.
+func (s *simulator) attitude() (roll, pitch, gLoad float64) {
+	v := s.gs * 0.514444 // m/s
+	roll = common.Degrees(math.Atan(v * common.Radians(s.turnRate) / 9.80665))
+	if s.gs > 1 {
+		pitch = common.Degrees(math.Atan(s.vs / (s.gs * 101.269))) // Flight path angle, fpm over ground speed in ft/min.
+	}
+	return roll, pitch, 1 / math.Cos(common.Radians(roll))
+}
+
+// pressureAltitude converts an MSL altitude with the route's QNH.
+func (s *simulator) pressureAltitude(alt float64) float64 {
+	return alt + common.CalcAltitude(s.route.QNH, 0)
+}
+
+// simMadeUpAddress returns a stable made up ICAO address for a target name in one of the otherwise unused 0xFxxxxx blocks.
+func simMadeUpAddress(block uint32, name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return block | h.Sum32()&0xFFFF
+}
+
+// launchTarget works out the straight course of a scripted target meeting the ownship at the CPA.
+func (s *simulator) launchTarget(t SimTraffic) simTarget {
+	if t.Duration <= 0 {
+		t.Duration = 2 * t.CPATime
+	}
+	target := simTarget{SimTraffic: t, startTime: s.elapsed}
+	if icao, err := strconv.ParseUint(t.Icao, 16, 24); err == nil {
+		target.icao = uint32(icao)
+	} else {
+		target.icao = simMadeUpAddress(simAddressBlockScripted, t.Tail)
+	}
+	cpaLat, cpaLon := calcLocationForBearingDistance(s.lat, s.lon, s.track, s.gs*t.CPATime/3600)
+	if t.MissDistance != 0 {
+		cpaLat, cpaLon = calcLocationForBearingDistance(cpaLat, cpaLon, s.track+90, t.MissDistance)
+	}
+	from := math.Mod(s.track+t.Bearing+360, 360)
+	target.lat, target.lon = calcLocationForBearingDistance(cpaLat, cpaLon, from, t.Speed*t.CPATime/3600)
+	target.track = math.Mod(from+180, 360)
+	target.alt = s.alt + s.vs*t.CPATime/60 + t.RelAlt
+	return target
+}
+
+// position returns where a target is at the current simulation time, false once its duration is over.
+func (t *simTarget) position(elapsed float64) (lat, lon float64, ok bool) {
+	dt := elapsed - t.startTime
+	if dt > t.Duration {
+		return 0, 0, false
+	}
+	lat, lon = calcLocationForBearingDistance(t.lat, t.lon, t.track, t.Speed*dt/3600)
+	return lat, lon, true
+}
+
+// simNMEAPosition formats a position as the ddmm.mmmmm,N,dddmm.mmmmm,E NMEA fields.
+func simNMEAPosition(lat, lon float64) string {
+	ns, ew := "N", "E"
+	if lat < 0 {
+		ns, lat = "S", -lat
+	}
+	if lon < 0 {
+		ew, lon = "W", -lon
+	}
+	latDeg, lonDeg := math.Floor(lat), math.Floor(lon)
+	return fmt.Sprintf("%02.0f%08.5f,%s,%03.0f%08.5f,%s", latDeg, (lat-latDeg)*60, ns, lonDeg, (lon-lonDeg)*60, ew)
+}
+
+// simNMEASentences synthesizes the sentences of a GNSS receiver at UTC time now, with the GSA/GSV set if satellites is set.
+func simNMEASentences(now time.Time, lat, lon, alt, gs, track float64, satellites bool) []string {
+	now = now.UTC()
+	hms := now.Format("150405") + fmt.Sprintf(".%02d", now.Nanosecond()/10000000)
+	pos := simNMEAPosition(lat, lon)
+	geoidSep := common.GeoidHeight(lat, lon)
+	sentences := []string{
+		fmt.Sprintf("$GPRMC,%s,A,%s,%.1f,%.1f,%s,,,A", hms, pos, gs, track, now.Format("020106")),
+		fmt.Sprintf("$GPGGA,%s,%s,1,10,0.8,%.1f,M,%.1f,M,,", hms, pos, alt/3.28084, geoidSep),
+		fmt.Sprintf("$GPGST,%s,1.0,1.0,0.8,30.0,1.0,1.0,1.5", hms),
+	}
+	if satellites {
+		sentences = append(sentences,
+			"$GPGSA,A,3,02,05,07,09,13,15,18,20,27,30,,,1.4,0.8,1.1",
+			"$GPGSV,3,1,10,02,65,045,45,05,40,120,42,07,25,200,38,09,55,300,44",
+			"$GPGSV,3,2,10,13,15,080,34,15,70,180,47,18,30,250,39,20,10,330,31",
+			"$GPGSV,3,3,10,27,45,010,43,30,20,150,36")
+	}
+	for i, sentence := range sentences {
+		sentences[i] = appendNmeaChecksum(sentence)
+	}
+	return sentences
+}
+
+// nmeaSentences synthesizes the GNSS receiver output for the current state.
+func (s *simulator) nmeaSentences(now time.Time) []string {
+	return simNMEASentences(now, s.lat, s.lon, s.alt, s.gs, s.track, s.ticks%simSatelliteEvery == 0)
+}
+
+// simSensors is what the baro sensor and the AHRS would report.
+type simSensors struct {
+	pressureAlt   float64 // ft
+	verticalSpeed float64 // fpm
+	temperature   float64 // °C
+	roll, pitch   float64 // deg
+	heading       float64 // deg true
+	magHeading    float64 // deg magnetic
+	slipSkid      float64 // deg
+	turnRate      float64 // deg/s
+	gLoad         float64
+}
+
+// simPublishGNSS feeds synthesized NMEA sentences through the normal NMEA parser.
+func simPublishGNSS(source string, sentences []string) {
+	// Looks like a network GPS, so the GPS poller doesn't look for a serial one.
+	globalStatus.GPS_connected = true
+	globalStatus.GPS_detected_type = GPS_TYPE_NETWORK | GPS_PROTOCOL_NMEA
+	for _, sentence := range sentences {
+		processNMEALineSource(source, sentence, false)
+	}
+}
+
+// simPublishSensors sets the baro and attitude in mySituation as if they came from the I2C sensors, and sends the AHRS reports.
+func simPublishSensors(sensors simSensors) {
+	mySituation.muBaro.Lock()
+	mySituation.BaroLastMeasurementTime = stratuxClock.Time
+	mySituation.BaroTemperature = float32(sensors.temperature)
+	mySituation.BaroPressureAltitude = float32(sensors.pressureAlt)
+	mySituation.BaroVerticalSpeed = float32(sensors.verticalSpeed)
+	mySituation.BaroVario = float32(sensors.verticalSpeed)
+	mySituation.BaroTEVario = float32(sensors.verticalSpeed)
+	mySituation.BaroSourceType = BARO_TYPE_BMP280
+	mySituation.muBaro.Unlock()
+
+	mySituation.muAttitude.Lock()
+	mySituation.AHRSRoll = sensors.roll
+	mySituation.AHRSPitch = sensors.pitch
+	mySituation.AHRSGyroHeading = sensors.heading
+	mySituation.AHRSMagHeading = sensors.magHeading
+	mySituation.AHRSSlipSkid = sensors.slipSkid
+	mySituation.AHRSTurnRate = sensors.turnRate
+	mySituation.AHRSGLoad = sensors.gLoad
+	if sensors.gLoad < mySituation.AHRSGLoadMin || mySituation.AHRSGLoadMin == 0 {
+		mySituation.AHRSGLoadMin = sensors.gLoad
+	}
+	if sensors.gLoad > mySituation.AHRSGLoadMax {
+		mySituation.AHRSGLoadMax = sensors.gLoad
+	}
+	mySituation.AHRSLastAttitudeTime = stratuxClock.Time
+	mySituation.muAttitude.Unlock()
+	globalStatus.IMUConnected = true
+	globalStatus.BMPConnected = true
+
+	makeAHRSGDL90Report()
+	makeAHRSSimReport()
+	makeAHRSLevilReport()
+	sendVarioNMEA()
+}
+
+// publish feeds the current state into mySituation (through the NMEA parser), the AHRS reports and the traffic.
+func (s *simulator) publish() {
+	simPublishGNSS(GNSS_SOURCE_SIMULATOR, s.nmeaSentences(time.Now()))
+	roll, pitch, gLoad := s.attitude()
+	decl, _ := common.MagneticDeclination(s.lat, s.lon, s.alt, time.Now())
+	simPublishSensors(simSensors{
+		pressureAlt:   s.pressureAltitude(s.alt),
+		verticalSpeed: s.vs,
+		temperature:   15 - 1.98*s.alt/1000,
+		roll:          roll,
+		pitch:         pitch,
+		heading:       s.track,
+		magHeading:    common.TrueToMagnetic(s.track, decl),
+		turnRate:      s.turnRate,
+		gLoad:         gLoad,
+	})
+	s.publishTraffic()
+}
+
+// simTrafficReport is a simulated target as a transponder would report it.
+type simTrafficReport struct {
+	icao     uint32
+	tail     string
+	lat, lon float64
+	alt      float64 // ft, pressure altitude
+	track    float64
+	speed    float64 // kts
+	vvel     float64 // fpm
+	onGround bool
+}
+
+// simUpdateTraffic inserts a simulated target as ADS-B traffic. trafficMutex must be held.
+func simUpdateTraffic(r simTrafficReport, ownLat, ownLon float64) {
+	var ti TrafficInfo
+	if val, ok := traffic[r.icao]; ok {
+		ti = val
+	}
+	ti.Icao_addr = r.icao
+	ti.Addr_type = 0
+	ti.TargetType = TARGET_TYPE_ADSB
+	ti.Emitter_category = 1
+	ti.Tail = r.tail
+	ti.Lat = float32(r.lat)
+	ti.Lng = float32(r.lon)
+	ti.Position_valid = true
+	ti.ExtrapolatedPosition = false
+	ti.Alt = int32(r.alt)
+	ti.AltIsGNSS = false
+	ti.Track = float32(r.track)
+	ti.Speed = uint16(r.speed)
+	ti.Speed_valid = true
+	ti.Vvel = int16(r.vvel)
+	ti.OnGround = r.onGround
+	ti.NACp = 8
+	ti.NIC = 8
+	ti.Timestamp = time.Now()
+	ti.Last_seen = stratuxClock.Time
+	ti.Last_alt = stratuxClock.Time
+	ti.Last_speed = stratuxClock.Time
+	ti.Last_source = TRAFFIC_SOURCE_1090ES
+	ti.Distance, ti.Bearing = common.Distance(ownLat, ownLon, r.lat, r.lon)
+	ti.BearingDist_valid = true
+
+	postProcessTraffic(&ti)
+	traffic[ti.Icao_addr] = ti
+	registerTrafficUpdate(ti)
+	seenTraffic[ti.Icao_addr] = true
+}
+
+func (s *simulator) publishTraffic() {
+	trafficMutex.Lock()
+	defer trafficMutex.Unlock()
+	active := s.targets[:0]
+	for _, t := range s.targets {
+		lat, lon, ok := t.position(s.elapsed)
+		if !ok {
+			continue
+		}
+		active = append(active, t)
+		simUpdateTraffic(simTrafficReport{
+			icao:  t.icao,
+			tail:  t.Tail,
+			lat:   lat,
+			lon:   lon,
+			alt:   s.pressureAltitude(t.alt),
+			track: t.track,
+			speed: t.Speed,
+		}, s.lat, s.lon)
+	}
+	s.targets = active
+}
+
+// simulatorRun flies the route in real time.
+func simulatorRun(s *simulator) {
+	ticker := time.NewTicker(simTickInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.step(simTickInterval.Seconds())
+		s.publish()
+		s.ticks++
+	}
+}
+
+// initSimulator starts the simulator with a route file. Real GNSS and I2C sensors must not be started with it.
+func initSimulator(fileName string) error {
+	route, err := loadSimRoute(fileName)
+	if err != nil {
+		return err
+	}
+	s := newSimulator(route)
+	log.Printf("Simulator: flying route %s with %d waypoints and %d scripted targets\n", route.Name, len(route.Waypoints), len(route.Traffic))
+	addSingleSystemErrorf("simulator", "Simulator mode: ownship and traffic are simulated (route %s). Not for navigation.", route.Name)
+	go updateAHRSStatus()
+	go simulatorRun(s)
+	return nil
+}
@@ -0,0 +1,255 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	simulator_test.go: Unit tests for the route driven ownship simulator
+*/
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+// simTestRoute: east from KOSH, climbing, then a 90° left turn to the north, descending.
+func simTestRoute() SimRoute {
+	kosh := SimWaypoint{Lat: 43.9844, Lon: -88.557, Alt: 1000, Speed: 100}
+	eastLat, eastLon := calcLocationForBearingDistance(kosh.Lat, kosh.Lon, 90, 10)
+	northLat, northLon := calcLocationForBearingDistance(eastLat, eastLon, 0, 10)
+	return SimRoute{
+		Name: "test",
+		QNH:  simStdPressure,
+		Waypoints: []SimWaypoint{
+			kosh,
+			{Lat: eastLat, Lon: eastLon, Alt: 3000, Speed: 100},
+			{Lat: northLat, Lon: northLon, Alt: 2000, Speed: 100},
+		},
+	}
+}
+
+func TestSimulatorFliesRoute(t *testing.T) {
+	route := simTestRoute()
+	s := newSimulator(route)
+	var maxRoll, maxPitch, minPitch float64
+	for i := 0; i < 30*60*5 && !s.orbiting; i++ {
+		s.step(0.2)
+		roll, pitch, gLoad := s.attitude()
+		maxRoll = math.Max(maxRoll, math.Abs(roll))
+		maxPitch = math.Max(maxPitch, pitch)
+		minPitch = math.Min(minPitch, pitch)
+		if math.Abs(gLoad-1/math.Cos(common.Radians(roll))) > 1e-9 {
+			t.Fatalf("gLoad %f inconsistent with roll %f", gLoad, roll)
+		}
+	}
+	if !s.orbiting {
+		t.Fatalf("route not completed, next waypoint %d", s.next)
+	}
+	last := route.Waypoints[2]
+	if d, _ := common.Distance(s.lat, s.lon, last.Lat, last.Lon); d/1852 > simWaypointRadius {
+		t.Errorf("ended %.2f nm from the last waypoint", d/1852)
+	}
+	// Standard rate bank at 100 kts is ~15.4°.
+	if maxRoll < 14 || maxRoll > 16.5 {
+		t.Errorf("max bank %.1f°, want standard rate", maxRoll)
+	}
+	// Climbing 2000 ft over 10 nm at 100 kts is ~330 fpm, a 1.9° flight path angle. Descending 1000 ft is -0.9°.
+	if math.Abs(maxPitch-1.9) > 0.3 || math.Abs(minPitch+0.9) > 0.3 {
+		t.Errorf("pitch %.1f..%.1f°", minPitch, maxPitch)
+	}
+	if math.Abs(s.alt-last.Alt) > 50 {
+		t.Errorf("altitude %.0f ft at the last waypoint, want %.0f", s.alt, last.Alt)
+	}
+
+	// Circling the last waypoint.
+	for i := 0; i < 60*5; i++ {
+		s.step(0.2)
+	}
+	if d, _ := common.Distance(s.lat, s.lon, last.Lat, last.Lon); d/1852 > 2 {
+		t.Errorf("orbit %.2f nm from the last waypoint", d/1852)
+	}
+	if roll, _, _ := s.attitude(); roll < 14 {
+		t.Errorf("bank %.1f° while circling", roll)
+	}
+}
+
+func TestSimulatorLoop(t *testing.T) {
+	route := simTestRoute()
+	route.Loop = true
+	s := newSimulator(route)
+	visited := map[int]bool{}
+	for i := 0; i < 30*60*5; i++ {
+		s.step(0.2)
+		visited[s.next] = true
+	}
+	if s.orbiting || len(visited) != 3 {
+		t.Errorf("orbiting = %v, visited %v", s.orbiting, visited)
+	}
+}
+
+func TestSimulatorNMEA(t *testing.T) {
+	resetNMEA4State()
+	defer resetNMEA4State()
+
+	globalStatus.GPS_connected = true
+	s := newSimulator(simTestRoute())
+	for i := 0; i < 10; i++ {
+		s.step(0.2)
+	}
+	for _, sentence := range s.nmeaSentences(time.Now()) {
+		if !processNMEALineSource(GNSS_SOURCE_SIMULATOR, sentence, false) {
+			t.Errorf("%s not used", sentence)
+		}
+	}
+	mySituation.muGPS.Lock()
+	defer mySituation.muGPS.Unlock()
+	if !isGPSValid() {
+		t.Fatalf("no valid fix")
+	}
+	tests := []struct {
+		name      string
+		got, want float64
+		tolerance float64
+	}{
+		{"Latitude", float64(mySituation.GPSLatitude), s.lat, 1e-5},
+		{"Longitude", float64(mySituation.GPSLongitude), s.lon, 1e-5},
+		{"Altitude", float64(mySituation.GPSAltitudeMSL), s.alt, 0.5},
+		{"HAE", float64(mySituation.GPSHeightAboveEllipsoid), s.alt + common.GeoidHeightFt(s.lat, s.lon), 0.5},
+		{"Ground speed", mySituation.GPSGroundSpeed, s.gs, 0.1},
+		{"Track", float64(mySituation.GPSTrueCourse), s.track, 0.1},
+		{"Satellites", float64(mySituation.GPSSatellites), 10, 0},
+		{"NACp", float64(mySituation.GPSNACp), 11, 0},
+	}
+	for _, tt := range tests {
+		if math.Abs(tt.got-tt.want) > tt.tolerance {
+			t.Errorf("%s = %f, want %f", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSimulatorPressureAltitude(t *testing.T) {
+	s := newSimulator(simTestRoute())
+	if pa := s.pressureAltitude(5000); pa != 5000 {
+		t.Errorf("standard pressure: %f", pa)
+	}
+	s.route.QNH = 1020
+	if pa := s.pressureAltitude(5000); math.Abs(pa-(5000-186)) > 5 {
+		t.Errorf("QNH 1020: %f", pa)
+	}
+}
+
+func TestSimTrafficIntercept(t *testing.T) {
+	tests := []struct {
+		name    string
+		traffic SimTraffic
+	}{
+		{"Head-on", SimTraffic{Tail: "HEADON", Start: 10, Bearing: 0, Speed: 120, CPATime: 60}},
+		{"From the right, above", SimTraffic{Tail: "RIGHT", Start: 5, Bearing: 90, Speed: 150, RelAlt: 300, CPATime: 90}},
+		{"Overtaking, left miss", SimTraffic{Tail: "BEHIND", Icao: "A1B2C3", Start: 1, Bearing: 180, Speed: 160, CPATime: 45, MissDistance: -0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A long straight leg, level.
+			route := simTestRoute()
+			route.Waypoints[1] = route.Waypoints[0]
+			route.Waypoints[1].Lat, route.Waypoints[1].Lon = calcLocationForBearingDistance(route.Waypoints[0].Lat, route.Waypoints[0].Lon, 90, 50)
+			route.Waypoints = route.Waypoints[:2]
+			route.Traffic = []SimTraffic{tt.traffic}
+			s := newSimulator(route)
+
+			for s.elapsed < tt.traffic.Start+tt.traffic.CPATime-0.01 {
+				s.step(0.2)
+			}
+			if len(s.targets) != 1 {
+				t.Fatalf("%d targets", len(s.targets))
+			}
+			target := s.targets[0]
+			lat, lon, ok := target.position(s.elapsed)
+			if !ok {
+				t.Fatalf("target gone at the CPA")
+			}
+			d, brg := common.Distance(s.lat, s.lon, lat, lon)
+			if math.Abs(d/1852-math.Abs(tt.traffic.MissDistance)) > 0.05 {
+				t.Errorf("CPA distance %.2f nm, want %.2f", d/1852, math.Abs(tt.traffic.MissDistance))
+			}
+			if tt.traffic.MissDistance < 0 && math.Abs(simAngleDiff(brg, s.track+270)) > 10 {
+				t.Errorf("target at bearing %.0f, want left of track %.0f", brg, s.track)
+			}
+			if math.Abs(target.alt-s.alt-tt.traffic.RelAlt) > 20 {
+				t.Errorf("relative altitude %.0f ft, want %.0f", target.alt-s.alt, tt.traffic.RelAlt)
+			}
+			if tt.traffic.Icao == "A1B2C3" && target.icao != 0xA1B2C3 {
+				t.Errorf("icao %X", target.icao)
+			}
+
+			// Gone after its duration.
+			for s.elapsed < tt.traffic.Start+2*tt.traffic.CPATime+1 {
+				s.step(0.2)
+			}
+			if _, _, ok := target.position(s.elapsed); ok {
+				t.Errorf("target still shown after its duration")
+			}
+		})
+	}
+}
+
+func TestLoadSimRoute(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"route.gpx": `<?xml version="1.0"?><gpx version="1.1"><wpt lat="1" lon="1"/>
+			<rte><rtept lat="43.98" lon="-88.55"><ele>304.8</ele></rtept><rtept lat="44.1" lon="-88.4"/></rte></gpx>`,
+		"track.gpx": `<?xml version="1.0"?><gpx version="1.1"><trk><trkseg>
+			<trkpt lat="43.98" lon="-88.55"/><trkpt lat="44.0" lon="-88.5"><ele>609.6</ele></trkpt><trkpt lat="44.1" lon="-88.4"/></trkseg></trk></gpx>`,
+		"route.json": `{"Name": "json", "Loop": true, "Waypoints": [{"Lat": 43.98, "Lon": -88.55, "Alt": 800}, {"Lat": 44.1, "Lon": -88.4, "Alt": 2500, "Speed": 120}]}`,
+		"short.json": `{"Waypoints": [{"Lat": 43.98, "Lon": -88.55}]}`,
+		"bad.json":   `{"Waypoints": `,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file      string
+		wantErr   bool
+		wantName  string
+		wantAlts  []float64
+		wantSpeed float64 // of the last waypoint
+	}{
+		{"route.gpx", false, "route", []float64{1000, 1000}, simDefaultSpeed},
+		{"track.gpx", false, "track", []float64{simDefaultAltitude, 2000, 2000}, simDefaultSpeed},
+		{"route.json", false, "json", []float64{800, 2500}, 120},
+		{"short.json", true, "", nil, 0},
+		{"bad.json", true, "", nil, 0},
+		{"missing.json", true, "", nil, 0},
+	}
+	for _, tt := range tests {
+		route, err := loadSimRoute(filepath.Join(dir, tt.file))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.file, err)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if route.Name != tt.wantName || route.QNH != simStdPressure || len(route.Waypoints) != len(tt.wantAlts) {
+			t.Errorf("%s: %+v", tt.file, route)
+			continue
+		}
+		for i, alt := range tt.wantAlts {
+			if math.Abs(route.Waypoints[i].Alt-alt) > 0.01 {
+				t.Errorf("%s: waypoint %d altitude %f, want %f", tt.file, i, route.Waypoints[i].Alt, alt)
+			}
+		}
+		if route.Waypoints[len(route.Waypoints)-1].Speed != tt.wantSpeed {
+			t.Errorf("%s: speed %f", tt.file, route.Waypoints[len(route.Waypoints)-1].Speed)
+		}
+	}
+}
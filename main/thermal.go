@@ -0,0 +1,321 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	thermal.go: Thermal map from OGN/FLARM traffic. Gliders and hang/paragliders that circle with a sustained
+	 climb mark a thermal, reports within thermalClusterRadius of each other are one thermal with its average
+	 climb, altitude band and age. Served as /api/thermals and as GeoJSON points at /api/thermals.geojson, and
+	 sent to glider computers as $GPWPL waypoints if enabled.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	thermalCirclingRate   = 6.0              // deg/s
+	thermalCirclingPause  = 10 * time.Second // Not circling this long ends the climb.
+	thermalMinCircling    = 20 * time.Second // Circling this long with...
+	thermalMinClimb       = 0.3              // ... this average climb (m/s) gives a report.
+	thermalClusterRadius  = 600.0            // m
+	thermalMaxAge         = 20 * time.Minute
+	thermalNMEAInterval   = 10 * time.Second
+	thermalNMEAMaxAge     = 10 * time.Minute
+	thermalNMEAMaxDist    = 30000.0 // m
+	thermalMaxGap         = 30 * time.Second
+	thermalAircraftExpiry = 5 * time.Minute
+)
+
+// thermalEmitters are the emitter categories that circle in thermals: glider, hang glider/paraglider.
+var thermalEmitters = map[uint8]bool{9: true, 12: true}
+
+// Thermal is a cluster of climbs, as returned by /api/thermals.
+type Thermal struct {
+	ID        int
+	Lat       float64
+	Lon       float64
+	Climb     float64 // m/s, average of the reports, newer ones weigh more.
+	MaxClimb  float64 // m/s
+	Bottom    float64 // ft MSL, lowest and highest altitude of a circling aircraft in it
+	Top       float64
+	Aircraft  int // Number of different aircraft that climbed in it.
+	Reports   int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Age       float64 // s since LastSeen.
+	Distance  float64 // m from ownship, -1 without GPS.
+
+	aircraft map[uint32]bool
+}
+
+// thermalAircraft follows one aircraft's circling.
+type thermalAircraft struct {
+	last          time.Time
+	lastTrack     float64
+	turnRate      float64 // deg/s, smoothed
+	lastCircling  time.Time
+	windowStart   time.Time
+	lat, lon      float64 // Sums over the window.
+	climb         float64
+	n             int
+	bottom, top   float64
+	windowStarted bool
+}
+
+// thermalReport is a traffic update for the thermal map.
+type thermalReport struct {
+	addr     uint32
+	time     time.Time
+	lat, lon float64
+	alt      float64 // ft
+	climb    float64 // m/s
+	track    float64
+	turnRate float64 // deg/s, 0 if unknown
+}
+
+type thermalMap struct {
+	mu       sync.Mutex
+	aircraft map[uint32]*thermalAircraft
+	thermals []*Thermal
+	lastID   int
+}
+
+var thermals = newThermalMap()
+
+func newThermalMap() *thermalMap {
+	return &thermalMap{aircraft: make(map[uint32]*thermalAircraft)}
+}
+
+// Add follows an aircraft's circling and adds a climb to the map when it circled long enough.
+func (m *thermalMap) Add(r thermalReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.aircraft[r.addr]
+	if a != nil && !r.time.After(a.last) {
+		return // Same report from another receiver.
+	}
+	if a == nil || r.time.Sub(a.last) > thermalMaxGap {
+		m.aircraft[r.addr] = &thermalAircraft{last: r.time, lastTrack: r.track}
+		return
+	}
+	dt := r.time.Sub(a.last).Seconds()
+	rate := r.turnRate
+	if rate == 0 {
+		// PFLAA rarely has a turn rate, take the track change.
+		rate = (math.Mod(r.track-a.lastTrack+540, 360) - 180) / dt
+	}
+	a.turnRate += dt / (5 + dt) * (rate - a.turnRate)
+	a.last, a.lastTrack = r.time, r.track
+
+	if math.Abs(a.turnRate) >= thermalCirclingRate {
+		a.lastCircling = r.time
+	} else if r.time.Sub(a.lastCircling) > thermalCirclingPause {
+		a.windowStarted = false
+		return
+	}
+	if !a.windowStarted {
+		*a = thermalAircraft{last: a.last, lastTrack: a.lastTrack, turnRate: a.turnRate, lastCircling: a.lastCircling,
+			windowStart: r.time, windowStarted: true, bottom: r.alt, top: r.alt}
+	}
+	a.lat += r.lat
+	a.lon += r.lon
+	a.climb += r.climb
+	a.n++
+	a.bottom, a.top = math.Min(a.bottom, r.alt), math.Max(a.top, r.alt)
+	if r.time.Sub(a.windowStart) < thermalMinCircling {
+		return
+	}
+	n := float64(a.n)
+	if climb := a.climb / n; climb >= thermalMinClimb {
+		m.addClimb(r.addr, r.time, a.lat/n, a.lon/n, climb, a.bottom, a.top)
+	}
+	// Next window.
+	a.windowStarted = false
+}
+
+// addClimb adds the average of a circling window to the nearest thermal, or makes a new one.
+func (m *thermalMap) addClimb(addr uint32, t time.Time, lat, lon, climb, bottom, top float64) {
+	var nearest *Thermal
+	nearestDist := thermalClusterRadius
+	for _, th := range m.thermals {
+		if d, _, _, _ := common.DistRect(lat, lon, th.Lat, th.Lon); d <= nearestDist {
+			nearest, nearestDist = th, d
+		}
+	}
+	if nearest == nil {
+		m.lastID++
+		m.thermals = append(m.thermals, &Thermal{ID: m.lastID, Lat: lat, Lon: lon, Climb: climb, MaxClimb: climb,
+			Bottom: bottom, Top: top, Aircraft: 1, Reports: 1, FirstSeen: t, LastSeen: t, aircraft: map[uint32]bool{addr: true}})
+		return
+	}
+	// Thermals drift with the wind, follow the newer reports.
+	const a = 0.3
+	nearest.Lat += a * (lat - nearest.Lat)
+	nearest.Lon += a * (lon - nearest.Lon)
+	nearest.Climb += a * (climb - nearest.Climb)
+	nearest.MaxClimb = math.Max(nearest.MaxClimb, climb)
+	nearest.Bottom, nearest.Top = math.Min(nearest.Bottom, bottom), math.Max(nearest.Top, top)
+	nearest.LastSeen = t
+	nearest.Reports++
+	nearest.aircraft[addr] = true
+	nearest.Aircraft = len(nearest.aircraft)
+}
+
+// Prune removes old thermals and aircraft we don't hear anymore.
+func (m *thermalMap) Prune(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.thermals[:0]
+	for _, th := range m.thermals {
+		if now.Sub(th.LastSeen) <= thermalMaxAge {
+			kept = append(kept, th)
+		}
+	}
+	m.thermals = kept
+	for addr, a := range m.aircraft {
+		if now.Sub(a.last) > thermalAircraftExpiry {
+			delete(m.aircraft, addr)
+		}
+	}
+}
+
+// List returns the thermals, nearest first with a position, otherwise newest first.
+func (m *thermalMap) List(now time.Time, posValid bool, lat, lon float64) []Thermal {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]Thermal, 0, len(m.thermals))
+	for _, th := range m.thermals {
+		t := *th
+		t.aircraft = nil
+		t.Age = now.Sub(t.LastSeen).Seconds()
+		t.Distance = -1
+		if posValid {
+			t.Distance, _, _, _ = common.DistRect(lat, lon, t.Lat, t.Lon)
+		}
+		ret = append(ret, t)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if posValid {
+			return ret[i].Distance < ret[j].Distance
+		}
+		return ret[i].LastSeen.After(ret[j].LastSeen)
+	})
+	return ret
+}
+
+func (t Thermal) geoJSON() geoJSONFeature {
+	return geoJSONFeature{
+		Type:     "Feature",
+		Id:       fmt.Sprintf("%d", t.ID),
+		Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{t.Lon, t.Lat}},
+		Properties: map[string]interface{}{
+			"climb":     math.Round(t.Climb*10) / 10,
+			"maxClimb":  math.Round(t.MaxClimb*10) / 10,
+			"bottom":    math.Round(t.Bottom),
+			"top":       math.Round(t.Top),
+			"aircraft":  t.Aircraft,
+			"reports":   t.Reports,
+			"firstSeen": geoJSONTime(t.FirstSeen),
+			"lastSeen":  geoJSONTime(t.LastSeen),
+			"age":       math.Round(t.Age),
+		},
+	}
+}
+
+// makeThermalWPLString formats a thermal as NMEA waypoint, named with its number and climb, e.g. TH12+2.1.
+func makeThermalWPLString(t Thermal) string {
+	latDir, lonDir := "N", "E"
+	lat, lon := t.Lat, t.Lon
+	if lat < 0 {
+		lat, latDir = -lat, "S"
+	}
+	if lon < 0 {
+		lon, lonDir = -lon, "W"
+	}
+	latDeg, lonDeg := math.Floor(lat), math.Floor(lon)
+	msg := fmt.Sprintf("$GPWPL,%02.0f%07.4f,%s,%03.0f%07.4f,%s,TH%d%+.1f", latDeg, (lat-latDeg)*60, latDir,
+		lonDeg, (lon-lonDeg)*60, lonDir, t.ID, t.Climb)
+	return appendNmeaChecksum(msg) + "\r\n"
+}
+
+// registerThermalReport feeds an OGN/FLARM traffic update into the thermal map.
+func registerThermalReport(ti TrafficInfo) {
+	if !ti.Position_valid || ti.OnGround || ti.Last_source != TRAFFIC_SOURCE_OGN || !thermalEmitters[ti.Emitter_category] {
+		return
+	}
+	thermals.Add(thermalReport{
+		addr:     ti.Icao_addr,
+		time:     ti.Last_seen,
+		lat:      float64(ti.Lat),
+		lon:      float64(ti.Lng),
+		alt:      float64(ti.Alt),
+		climb:    float64(ti.Vvel) / 196.85,
+		track:    float64(ti.Track),
+		turnRate: float64(ti.TurnRate),
+	})
+}
+
+func ownshipThermals(now time.Time) []Thermal {
+	mySituation.muGPS.Lock()
+	valid := isGPSValid()
+	lat, lon := float64(mySituation.GPSLatitude), float64(mySituation.GPSLongitude)
+	mySituation.muGPS.Unlock()
+	return thermals.List(now, valid, lat, lon)
+}
+
+var thermalLastSent time.Time
+
+// updateThermals prunes the map and sends the thermals nearby to the glider computers.
+func updateThermals(now time.Time) {
+	thermals.Prune(now)
+	if !globalSettings.ThermalNMEA || now.Sub(thermalLastSent) < thermalNMEAInterval {
+		return
+	}
+	thermalLastSent = now
+	for _, t := range ownshipThermals(now) {
+		if t.Distance >= 0 && t.Distance <= thermalNMEAMaxDist && now.Sub(t.LastSeen) <= thermalNMEAMaxAge {
+			sendNetFLARM(makeThermalWPLString(t), thermalNMEAInterval, 2)
+		}
+	}
+}
+
+// AJAX call - /api/thermals. Responds with the thermals, nearest first.
+func handleThermalsRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	list := ownshipThermals(stratuxClock.Time)
+	listJSON, err := json.Marshal(&list)
+	if err != nil {
+		log.Printf("Error sending thermals JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", listJSON)
+}
+
+// AJAX call - /api/thermals.geojson. The thermals as GeoJSON points.
+func handleThermalsGeoJSONRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	w.Header().Set("Content-Type", "application/geo+json")
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0)}
+	for _, t := range ownshipThermals(stratuxClock.Time) {
+		fc.Features = append(fc.Features, t.geoJSON())
+	}
+	fcJSON, err := json.Marshal(&fc)
+	if err != nil {
+		log.Printf("Error sending thermals GeoJSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", fcJSON)
+}
@@ -0,0 +1,190 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	thermal_test.go: Unit tests for the thermal map from OGN/FLARM traffic.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+// circlingReports are 1 Hz reports of an aircraft circling at 20°/s with radius 80 m around lat/lon.
+// withRate false leaves out the turn rate like most PFLAA sentences.
+func circlingReports(addr uint32, start time.Time, secs int, lat, lon, alt, climb float64, withRate bool) []thermalReport {
+	var ret []thermalReport
+	for i := 0; i < secs; i++ {
+		a := float64(i) * 20
+		r := thermalReport{
+			addr:  addr,
+			time:  start.Add(time.Duration(i) * time.Second),
+			lat:   lat + 80*math.Cos(a*math.Pi/180)/111120,
+			lon:   lon + 80*math.Sin(a*math.Pi/180)/(111120*math.Cos(lat*math.Pi/180)),
+			alt:   alt + climb*3.28084*float64(i),
+			climb: climb,
+			track: math.Mod(a+90, 360),
+		}
+		if withRate {
+			r.turnRate = 20
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+func TestThermalDetection(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var straight []thermalReport
+	for i := 0; i < 60; i++ {
+		straight = append(straight, thermalReport{addr: 1, time: start.Add(time.Duration(i) * time.Second),
+			lat: 47.5 + float64(i)*0.0003, lon: 8.5, alt: 3000, climb: 2, track: 0})
+	}
+	tests := []struct {
+		name    string
+		reports []thermalReport
+		want    int
+	}{
+		{"Circling climb", circlingReports(1, start, 60, 47.5, 8.5, 3000, 1.5, true), 1},
+		{"Circling climb, turn rate from track", circlingReports(1, start, 60, 47.5, 8.5, 3000, 1.5, false), 1},
+		{"Circling in sink", circlingReports(1, start, 60, 47.5, 8.5, 3000, -0.8, true), 0},
+		{"Too short", circlingReports(1, start, 15, 47.5, 8.5, 3000, 1.5, true), 0},
+		{"Straight climb", straight, 0},
+	}
+
+	for _, tt := range tests {
+		m := newThermalMap()
+		for _, r := range tt.reports {
+			m.Add(r)
+		}
+		list := m.List(start.Add(time.Minute), false, 0, 0)
+		if len(list) != tt.want {
+			t.Errorf("%s: %d thermals, want %d: %+v", tt.name, len(list), tt.want, list)
+			continue
+		}
+		if tt.want == 0 {
+			continue
+		}
+		th := list[0]
+		if math.Abs(th.Climb-1.5) > 0.01 || th.Reports != 2 || th.Aircraft != 1 || th.Distance != -1 {
+			t.Errorf("%s: %+v", tt.name, th)
+		}
+		// The average position is the centre of the circle.
+		if d, _, _, _ := common.DistRect(th.Lat, th.Lon, 47.5, 8.5); d > 20 {
+			t.Errorf("%s: %.0f m from the centre", tt.name, d)
+		}
+		// From the first report with a turn rate to the end of the second window.
+		if th.Bottom < 3000 || th.Bottom > 3010 || th.Top < 3200 || th.Top > 3220 {
+			t.Errorf("%s: altitude band %.0f-%.0f ft", tt.name, th.Bottom, th.Top)
+		}
+	}
+}
+
+func TestThermalClustering(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newThermalMap()
+	var reports []thermalReport
+	reports = append(reports, circlingReports(1, start, 25, 47.5, 8.5, 3000, 1, true)...)
+	reports = append(reports, circlingReports(2, start, 25, 47.502, 8.5, 4000, 3, true)...) // 220 m north.
+	reports = append(reports, circlingReports(3, start, 25, 47.55, 8.5, 3000, 2, true)...)  // 5.5 km north.
+	for _, r := range reports {
+		m.Add(r)
+	}
+	// Ownship south of both, the near thermal comes first.
+	list := m.List(start.Add(25*time.Second), true, 47.4, 8.5)
+	if len(list) != 2 {
+		t.Fatalf("%d thermals, want 2: %+v", len(list), list)
+	}
+	near, far := list[0], list[1]
+	if near.Aircraft != 2 || near.Reports != 2 || near.MaxClimb != 3 || near.Climb <= 1 || near.Climb >= 3 ||
+		near.Bottom < 3000 || near.Bottom > 3010 || near.Top < 4200 {
+		t.Errorf("merged thermal %+v", near)
+	}
+	if near.Distance < 11000 || near.Distance > 11400 || far.Distance < 16500 || far.Aircraft != 1 {
+		t.Errorf("distances %.0f, %.0f m", near.Distance, far.Distance)
+	}
+	// The windows end with the 22nd report.
+	if near.Age != 3 {
+		t.Errorf("age %f", near.Age)
+	}
+
+	m.Prune(start.Add(thermalMaxAge + 10*time.Second))
+	if list := m.List(start, false, 0, 0); len(list) != 2 {
+		t.Errorf("%d thermals before their age", len(list))
+	}
+	m.Prune(start.Add(thermalMaxAge + time.Minute))
+	if list := m.List(start, false, 0, 0); len(list) != 0 || len(m.aircraft) != 0 {
+		t.Errorf("%d thermals, %d aircraft after their age", len(list), len(m.aircraft))
+	}
+}
+
+func TestMakeThermalWPLString(t *testing.T) {
+	tests := []struct {
+		thermal Thermal
+		want    string
+	}{
+		{Thermal{ID: 3, Lat: 47.5, Lon: 8.25, Climb: 2.14}, "$GPWPL,4730.0000,N,00815.0000,E,TH3+2.1*6E\r\n"},
+		{Thermal{ID: 12, Lat: -33.75, Lon: -70.5, Climb: 0.5}, "$GPWPL,3345.0000,S,07030.0000,W,TH12+0.5*5E\r\n"},
+	}
+	for _, tt := range tests {
+		if got := makeThermalWPLString(tt.thermal); got != tt.want {
+			t.Errorf("makeThermalWPLString(%+v) = %q, want %q", tt.thermal, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterThermalReport(t *testing.T) {
+	resetGPSState()
+	orig := thermals
+	thermals = newThermalMap()
+	defer func() { thermals = orig }()
+
+	for _, r := range circlingReports(0x123456, time.Now(), 25, 47.5, 8.5, 3000, 1.5, true) {
+		ti := TrafficInfo{Icao_addr: r.addr, Position_valid: true, Lat: float32(r.lat), Lng: float32(r.lon),
+			Alt: int32(r.alt), Vvel: int16(r.climb * 196.85), Track: float32(r.track), TurnRate: float32(r.turnRate),
+			Emitter_category: 9, Last_source: TRAFFIC_SOURCE_OGN, Last_seen: r.time}
+		registerThermalReport(ti)
+		// A powered aircraft circling with it doesn't count.
+		ti.Icao_addr = 0x654321
+		ti.Emitter_category = 1
+		registerThermalReport(ti)
+	}
+
+	w := httptest.NewRecorder()
+	handleThermalsGeoJSONRequest(w, httptest.NewRequest("GET", "/api/thermals.geojson", nil))
+	var fc struct {
+		Type     string
+		Features []struct {
+			Id       string
+			Geometry struct {
+				Type        string
+				Coordinates [2]float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &fc); err != nil {
+		t.Fatalf("invalid JSON: %v: %s", err, w.Body.String())
+	}
+	if len(fc.Features) != 1 || fc.Features[0].Properties["aircraft"] != 1.0 || fc.Features[0].Properties["climb"] != 1.5 {
+		t.Fatalf("unexpected collection: %s", w.Body.String())
+	}
+	if g := fc.Features[0].Geometry; g.Type != "Point" || math.Abs(g.Coordinates[0]-8.5) > 0.001 || math.Abs(g.Coordinates[1]-47.5) > 0.001 {
+		t.Errorf("geometry = %+v", g)
+	}
+
+	w = httptest.NewRecorder()
+	handleThermalsRequest(w, httptest.NewRequest("GET", "/api/thermals", nil))
+	var list []Thermal
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].ID != 1 {
+		t.Errorf("thermals = %s", w.Body.String())
+	}
+}
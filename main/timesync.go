@@ -0,0 +1,267 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	timesync.go: Feeds GPS time to chrony/ntpd through the NTP shared memory driver.
+	 Unit 0 gets the (coarse) GPS time from NMEA/UBX, unit 1 the PPS edges from /dev/pps0 if a PPS line
+	 is connected. chrony then disciplines the system clock and serves NTP to Wi-Fi clients.
+	 Without a time service we fall back to stepping the clock with `date -s`.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	ntpSHMKeyBase   = 0x4E545030 // "NTP0", SHM unit 0. Unit n is at ntpSHMKeyBase + n.
+	ntpSHMUnitGPS   = 0
+	ntpSHMUnitPPS   = 1
+	ntpSHMPrecGPS   = -1  // ~0.5 s, log2 seconds.
+	ntpSHMPrecPPS   = -20 // ~1 us
+	ipcCreate       = 01000
+	ppsDevice       = "/dev/pps0"
+	ppsFetchTimeout = 2 // seconds
+	ppsMaxGPSAge    = 10 * time.Second
+	ppsMaxAmbiguity = 400 * time.Millisecond // PPS edge must be this close to the second GPS time says it is.
+	timeSyncTimeout = 5 * time.Second
+
+	TIME_SOURCE_GPS     = "GPS"
+	TIME_SOURCE_GPS_PPS = "GPS+PPS"
+)
+
+// ntpSHMLayout holds the field offsets of ntpd's struct shmTime, which depend on the size of time_t.
+type ntpSHMLayout struct {
+	size  int // sizeof(struct shmTime)
+	timeT int // sizeof(time_t)
+	// Field offsets.
+	mode, count, clockSec, clockUSec, recvSec, recvUSec, leap, precision, nsamples, valid, clockNSec, recvNSec int
+}
+
+// ntpSHMLayoutFor returns the struct shmTime layout for a platform with timeTSize bytes time_t (long on Linux).
+func ntpSHMLayoutFor(timeTSize int) ntpSHMLayout {
+	if timeTSize == 8 {
+		return ntpSHMLayout{size: 96, mode: 0, count: 4, clockSec: 8, clockUSec: 16, recvSec: 24, recvUSec: 32, leap: 36, precision: 40, nsamples: 44, valid: 48, clockNSec: 52, recvNSec: 56, timeT: 8}
+	}
+	return ntpSHMLayout{size: 80, mode: 0, count: 4, clockSec: 8, clockUSec: 12, recvSec: 16, recvUSec: 20, leap: 24, precision: 28, nsamples: 32, valid: 36, clockNSec: 40, recvNSec: 44, timeT: 4}
+}
+
+// writeNTPSHMSample stores a sample in a struct shmTime using mode 1: the reader discards it if count changed while reading.
+// clock is the true time, received the system time at which it was valid.
+func writeNTPSHMSample(buf []byte, l ntpSHMLayout, clock, received time.Time, precision int32) {
+	putInt32 := func(off int, v int32) { binary.LittleEndian.PutUint32(buf[off:], uint32(v)) }
+	putTime := func(off int, v int64) {
+		if l.timeT == 8 {
+			binary.LittleEndian.PutUint64(buf[off:], uint64(v))
+		} else {
+			binary.LittleEndian.PutUint32(buf[off:], uint32(v))
+		}
+	}
+	count := int32(binary.LittleEndian.Uint32(buf[l.count:]))
+	putInt32(l.mode, 1)
+	putInt32(l.count, count+1)
+	putInt32(l.valid, 0)
+	putTime(l.clockSec, clock.Unix())
+	putInt32(l.clockUSec, int32(clock.Nanosecond()/1000))
+	putInt32(l.clockNSec, int32(clock.Nanosecond()))
+	putTime(l.recvSec, received.Unix())
+	putInt32(l.recvUSec, int32(received.Nanosecond()/1000))
+	putInt32(l.recvNSec, int32(received.Nanosecond()))
+	putInt32(l.leap, 0)
+	putInt32(l.precision, precision)
+	putInt32(l.nsamples, 3)
+	putInt32(l.count, count+2)
+	putInt32(l.valid, 1)
+}
+
+// ntpSHMTimeTSize returns the size of time_t of the time service, from the size of the segment it created for the
+// unit: 96 bytes with 64 bit time_t, 80 with 32 bit. 32 bit Raspberry Pi OS has moved to 64 bit time_t (t64), which
+// Go's syscall doesn't know about. Without a segment yet, it is Go's idea of time_t.
+func ntpSHMTimeTSize(key int) int {
+	_, _, errno := syscall.Syscall(syscall.SYS_SHMGET, uintptr(key), uintptr(ntpSHMLayoutFor(8).size), 0)
+	switch errno {
+	case 0:
+		return 8
+	case syscall.EINVAL: // Smaller than that.
+		return 4
+	}
+	return int(unsafe.Sizeof(syscall.Timespec{}.Sec))
+}
+
+// attachNTPSHM attaches (creating if needed) the shared memory segment of an NTP SHM unit.
+func attachNTPSHM(unit int, l ntpSHMLayout) ([]byte, error) {
+	id, _, errno := syscall.Syscall(syscall.SYS_SHMGET, uintptr(ntpSHMKeyBase+unit), uintptr(l.size), ipcCreate|0600)
+	if errno != 0 {
+		return nil, errno
+	}
+	addr, _, errno := syscall.Syscall(syscall.SYS_SHMAT, id, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), l.size), nil
+}
+
+type timeSyncState struct {
+	mu              sync.Mutex
+	layout          ntpSHMLayout
+	shmGPS          []byte // nil if not attached.
+	shmPPS          []byte
+	lastGPSTime     time.Time // Last GPS time, and the system time it was valid at.
+	lastGPSReceived time.Time
+	lastGPSLocal    time.Time // stratuxClock
+	lastPPSLocal    time.Time // stratuxClock
+	offset          time.Duration
+	service         string
+}
+
+var timeSync timeSyncState
+
+// timeServiceRunning returns the name of the running NTP daemon, if any. It is only checked at startup,
+// stratux.service is ordered after chrony.service and ntp.service so that the daemon is up by then.
+func timeServiceRunning() string {
+	for name, pidFile := range map[string]string{"chrony": "/run/chrony/chronyd.pid", "ntpd": "/run/ntpd.pid"} {
+		if _, err := os.Stat(pidFile); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// initTimeSync attaches the NTP SHM units and starts the PPS reader, if there is a time service to feed.
+func initTimeSync() {
+	service := timeServiceRunning()
+	if service == "" {
+		log.Printf("No NTP time service running, setting the system clock from GPS directly\n")
+		return
+	}
+	l := ntpSHMLayoutFor(ntpSHMTimeTSize(ntpSHMKeyBase + ntpSHMUnitGPS))
+	shmGPS, err := attachNTPSHM(ntpSHMUnitGPS, l)
+	if err != nil {
+		log.Printf("Can't attach NTP SHM unit %d, setting the system clock from GPS directly: %s\n", ntpSHMUnitGPS, err.Error())
+		return
+	}
+	timeSync.mu.Lock()
+	timeSync.layout = l
+	timeSync.shmGPS = shmGPS
+	timeSync.service = service
+	timeSync.mu.Unlock()
+	log.Printf("Feeding GPS time to %s via NTP SHM\n", service)
+
+	if _, err := os.Stat(ppsDevice); err == nil {
+		shmPPS, err := attachNTPSHM(ntpSHMUnitPPS, l)
+		if err != nil {
+			log.Printf("Can't attach NTP SHM unit %d: %s\n", ntpSHMUnitPPS, err.Error())
+			return
+		}
+		timeSync.mu.Lock()
+		timeSync.shmPPS = shmPPS
+		timeSync.mu.Unlock()
+		go ppsReader(ppsDevice)
+	}
+}
+
+// feedTimeService passes a GPS time, valid at system time received, to the time service.
+// Returns false if there is no time service and the caller has to set the clock itself.
+func feedTimeService(gpsTime, received time.Time) bool {
+	timeSync.mu.Lock()
+	defer timeSync.mu.Unlock()
+	timeSync.lastGPSTime = gpsTime
+	timeSync.lastGPSReceived = received
+	timeSync.lastGPSLocal = stratuxClock.Time
+	if timeSync.lastPPSLocal.IsZero() || stratuxClock.Since(timeSync.lastPPSLocal) > timeSyncTimeout {
+		timeSync.offset = gpsTime.Sub(received)
+	}
+	if timeSync.shmGPS == nil {
+		return false
+	}
+	writeNTPSHMSample(timeSync.shmGPS, timeSync.layout, gpsTime, received, ntpSHMPrecGPS)
+	return true
+}
+
+// ppsSecond returns the GPS second that starts at a PPS edge, using the last GPS time to number it.
+func ppsSecond(edge, gpsTime, gpsReceived time.Time) (time.Time, bool) {
+	if gpsTime.IsZero() || edge.Sub(gpsReceived) > ppsMaxGPSAge || gpsReceived.Sub(edge) > ppsMaxGPSAge {
+		return time.Time{}, false
+	}
+	estimate := gpsTime.Add(edge.Sub(gpsReceived))
+	second := estimate.Round(time.Second)
+	if d := estimate.Sub(second); d > ppsMaxAmbiguity || d < -ppsMaxAmbiguity {
+		return time.Time{}, false
+	}
+	return second, true
+}
+
+// ppsRegisterEdge records a PPS edge captured by the kernel at system time edge.
+func ppsRegisterEdge(edge time.Time) {
+	timeSync.mu.Lock()
+	defer timeSync.mu.Unlock()
+	second, ok := ppsSecond(edge, timeSync.lastGPSTime, timeSync.lastGPSReceived)
+	if !ok {
+		return
+	}
+	timeSync.lastPPSLocal = stratuxClock.Time
+	timeSync.offset = second.Sub(edge)
+	if timeSync.shmPPS != nil {
+		writeNTPSHMSample(timeSync.shmPPS, timeSync.layout, second, edge, ntpSHMPrecPPS)
+	}
+}
+
+// ppsReader waits for PPS edges with the PPS_FETCH ioctl of the Linux PPS API.
+func ppsReader(device string) {
+	f, err := os.Open(device)
+	if err != nil {
+		log.Printf("Can't open PPS device %s: %s\n", device, err.Error())
+		return
+	}
+	defer f.Close()
+	log.Printf("Using PPS from %s\n", device)
+	// _IOWR('p', 0xa4, struct pps_fdata *): the size in the request code is the size of a pointer.
+	ppsFetch := uintptr(0xC00070A4) | unsafe.Sizeof(uintptr(0))<<16
+	var lastSeq uint32
+	for {
+		// struct pps_fdata: pps_kinfo (assert_sequence, clear_sequence, assert_tu, clear_tu, current_mode), then the timeout.
+		var fdata [64]byte
+		binary.LittleEndian.PutUint64(fdata[48:], ppsFetchTimeout)
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ppsFetch, uintptr(unsafe.Pointer(&fdata[0])))
+		if errno == syscall.EINTR || errno == syscall.ETIMEDOUT {
+			continue
+		} else if errno != 0 {
+			log.Printf("PPS_FETCH on %s failed: %s\n", device, errno.Error())
+			return
+		}
+		seq := binary.LittleEndian.Uint32(fdata[0:])
+		if seq == lastSeq {
+			continue
+		}
+		lastSeq = seq
+		sec := int64(binary.LittleEndian.Uint64(fdata[8:]))
+		nsec := int64(int32(binary.LittleEndian.Uint32(fdata[16:])))
+		ppsRegisterEdge(time.Unix(sec, nsec))
+	}
+}
+
+// updateTimeSyncStatus publishes the current time source and offset in the status.
+func updateTimeSyncStatus() {
+	timeSync.mu.Lock()
+	defer timeSync.mu.Unlock()
+	globalStatus.Time_service = timeSync.service
+	switch {
+	case !timeSync.lastPPSLocal.IsZero() && stratuxClock.Since(timeSync.lastPPSLocal) < timeSyncTimeout:
+		globalStatus.Time_source = TIME_SOURCE_GPS_PPS
+	case !timeSync.lastGPSLocal.IsZero() && stratuxClock.Since(timeSync.lastGPSLocal) < timeSyncTimeout:
+		globalStatus.Time_source = TIME_SOURCE_GPS
+	default:
+		globalStatus.Time_source = ""
+	}
+	globalStatus.Time_offset_ms = math.Round(float64(timeSync.offset)/float64(time.Microsecond)) / 1000
+}
@@ -0,0 +1,136 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	timesync_test.go: Unit tests for the NTP SHM encoding and PPS second numbering.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriteNTPSHMSample(t *testing.T) {
+	clock := time.Date(2025, 6, 1, 12, 0, 1, 0, time.UTC)
+	received := time.Date(2025, 6, 1, 12, 0, 0, 987654321, time.UTC)
+	for _, timeT := range []int{4, 8} {
+		l := ntpSHMLayoutFor(timeT)
+		buf := make([]byte, l.size)
+		binary.LittleEndian.PutUint32(buf[l.count:], 41)
+		writeNTPSHMSample(buf, l, clock, received, ntpSHMPrecPPS)
+
+		getInt32 := func(off int) int32 { return int32(binary.LittleEndian.Uint32(buf[off:])) }
+		getTime := func(off int) int64 {
+			if timeT == 8 {
+				return int64(binary.LittleEndian.Uint64(buf[off:]))
+			}
+			return int64(getInt32(off))
+		}
+		tests := []struct {
+			name      string
+			got, want int64
+		}{
+			{"mode", int64(getInt32(l.mode)), 1},
+			{"count", int64(getInt32(l.count)), 43},
+			{"valid", int64(getInt32(l.valid)), 1},
+			{"clockSec", getTime(l.clockSec), clock.Unix()},
+			{"clockUSec", int64(getInt32(l.clockUSec)), 0},
+			{"recvSec", getTime(l.recvSec), received.Unix()},
+			{"recvUSec", int64(getInt32(l.recvUSec)), 987654},
+			{"recvNSec", int64(getInt32(l.recvNSec)), 987654321},
+			{"precision", int64(getInt32(l.precision)), ntpSHMPrecPPS},
+		}
+		for _, tt := range tests {
+			if tt.got != tt.want {
+				t.Errorf("time_t %d bytes: %s = %d, want %d", timeT, tt.name, tt.got, tt.want)
+			}
+		}
+	}
+}
+
+func TestPPSSecond(t *testing.T) {
+	gpsTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	// NMEA for 12:00:00 received 250 ms late, the system clock is 2 hours and 100 ms behind.
+	received := gpsTime.Add(-2*time.Hour - 100*time.Millisecond + 250*time.Millisecond)
+	tests := []struct {
+		name   string
+		edge   time.Time
+		want   time.Time
+		wantOK bool
+	}{
+		{"Next second", received.Add(750 * time.Millisecond), gpsTime.Add(time.Second), true},
+		{"Few seconds later", received.Add(3750 * time.Millisecond), gpsTime.Add(4 * time.Second), true},
+		{"Jittery edge", received.Add(900 * time.Millisecond), gpsTime.Add(time.Second), true},
+		{"Ambiguous", received.Add(500 * time.Millisecond), time.Time{}, false},
+		{"GPS time too old", received.Add(15 * time.Second), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ppsSecond(tt.edge, gpsTime, received)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("%s: ppsSecond = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if _, ok := ppsSecond(received, time.Time{}, time.Time{}); ok {
+		t.Errorf("PPS numbered without GPS time")
+	}
+}
+
+func TestTimeSyncStatus(t *testing.T) {
+	defer func() { timeSync = timeSyncState{} }()
+	timeSync = timeSyncState{}
+	updateTimeSyncStatus()
+	if globalStatus.Time_source != "" {
+		t.Errorf("Time_source = %q without GPS", globalStatus.Time_source)
+	}
+
+	// No time service: the caller sets the clock itself.
+	gpsTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if feedTimeService(gpsTime, gpsTime.Add(-1500*time.Millisecond)) {
+		t.Errorf("feedTimeService claims a time service")
+	}
+	updateTimeSyncStatus()
+	if globalStatus.Time_source != TIME_SOURCE_GPS || globalStatus.Time_offset_ms != 1500 {
+		t.Errorf("Time_source = %q, Time_offset_ms = %f", globalStatus.Time_source, globalStatus.Time_offset_ms)
+	}
+
+	// With a time service, PPS takes over the offset.
+	l := ntpSHMLayoutFor(8)
+	timeSync.layout = l
+	timeSync.shmGPS = make([]byte, l.size)
+	timeSync.shmPPS = make([]byte, l.size)
+	if !feedTimeService(gpsTime, gpsTime.Add(-1500*time.Millisecond)) {
+		t.Errorf("feedTimeService ignores the time service")
+	}
+	ppsRegisterEdge(gpsTime.Add(-500*time.Millisecond - 20*time.Microsecond))
+	updateTimeSyncStatus()
+	if globalStatus.Time_source != TIME_SOURCE_GPS_PPS || globalStatus.Time_offset_ms != 1500.02 {
+		t.Errorf("Time_source = %q, Time_offset_ms = %f", globalStatus.Time_source, globalStatus.Time_offset_ms)
+	}
+	if binary.LittleEndian.Uint32(timeSync.shmPPS[l.valid:]) != 1 {
+		t.Errorf("no PPS sample written")
+	}
+}
+
+func TestNTPSHMTimeTSize(t *testing.T) {
+	key := 0x53545800 + syscall.Getpid()&0xFF // Not an NTP unit.
+	if got := ntpSHMTimeTSize(key); got != 4 && got != 8 {
+		t.Errorf("without a segment: %d", got)
+	}
+	for _, timeT := range []int{4, 8} {
+		size := ntpSHMLayoutFor(timeT).size
+		id, _, errno := syscall.Syscall(syscall.SYS_SHMGET, uintptr(key), uintptr(size), ipcCreate|0600)
+		if errno != 0 {
+			t.Skipf("no SysV shared memory: %v", errno)
+		}
+		got := ntpSHMTimeTSize(key)
+		syscall.Syscall(syscall.SYS_SHMCTL, id, 0, 0) // IPC_RMID
+		if got != timeT {
+			t.Errorf("segment of %d bytes: time_t of %d bytes, want %d", size, got, timeT)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	towers.go: FIS-B ground station health. Per-tower product inventory and uplink slot usage,
+	 a persisted history of all towers ever received, and "no FIS-B" / "no TIS-B" coverage alerts.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/uatparse"
+)
+
+const (
+	towerHistoryFile         = "stratux-towers.json"
+	towerHistorySaveInterval = 1 * time.Minute
+	towerSlotWindow          = 2 * time.Minute // An uplink slot counts as used if seen within this window.
+	fisbOutageAlertTime      = 5 * time.Minute // Alert if no uplink has been received for this long.
+	tisbOutageAlertTime      = 5 * time.Minute // Alert if in FIS-B coverage but no TIS-B/ADS-R target for this long.
+	fisbCoverageTimeout      = 1 * time.Minute // We consider ourselves out of FIS-B coverage after this long without an uplink.
+	tisbClientTimeout        = 1 * time.Minute // Ownship is a TIS-B client if listed in a service status frame within this window.
+)
+
+// Per-tower product inventory entry.
+type ADSBTowerProduct struct {
+	Product_id uint32
+	Name       string
+	Last_seen  time.Time
+	Count      uint64
+}
+
+// Entry of the persisted tower history. Times are wall clock.
+type ADSBTowerHistory struct {
+	Lat                 float64
+	Lng                 float64
+	TISB_site_id        uint8
+	First_seen          time.Time
+	Last_seen           time.Time
+	Signal_strength_max float64
+	Messages_total      uint64
+	Products            []uint32
+}
+
+var towerHistory map[string]ADSBTowerHistory // (lat,lng) -> ADSBTowerHistory
+var towerHistoryMutex sync.Mutex
+var towerHistoryDirty bool
+var towerHistoryFileName string
+
+// FIS-B/TIS-B coverage tracking, in stratuxClock time.
+var coverageMutex sync.Mutex
+var lastFISBUplink time.Time
+var fisbCoverageStart time.Time
+var lastTISBTarget time.Time
+var lastOwnshipServiced time.Time
+
+// registerTowerUplink updates the per-tower inventory and the tower history with a decoded uplink message.
+func registerTowerUplink(towerid string, uatMsg *uatparse.UATMsg, signalStrength float64) {
+	now := stratuxClock.Time
+
+	ADSBTowerMutex.Lock()
+	twr, ok := ADSBTowers[towerid]
+	if !ok {
+		twr.Lat = uatMsg.Lat
+		twr.Lng = uatMsg.Lon
+		twr.Signal_strength_max = -999
+	}
+	if twr.First_seen.IsZero() {
+		twr.First_seen = now
+	}
+	if twr.Products == nil {
+		twr.Products = make(map[uint32]ADSBTowerProduct)
+	}
+	if twr.slotsSeen == nil {
+		twr.slotsSeen = make(map[uint8]time.Time)
+	}
+	twr.Last_seen = now
+	twr.Messages_total++
+	twr.TISB_site_id = uatMsg.TISBSiteID
+	twr.slotsSeen[uatMsg.SlotID] = now
+	twr.Slots_used = twr.Slots_used[:0]
+	for slot, t := range twr.slotsSeen {
+		if now.Sub(t) > towerSlotWindow {
+			delete(twr.slotsSeen, slot)
+			continue
+		}
+		twr.Slots_used = append(twr.Slots_used, slot)
+	}
+	sort.Slice(twr.Slots_used, func(i, j int) bool { return twr.Slots_used[i] < twr.Slots_used[j] })
+
+	productIds := make([]uint32, 0, len(uatMsg.Frames))
+	for _, f := range uatMsg.Frames {
+		if f.Frame_type != 0 {
+			continue // Only FIS-B APDUs carry a product id.
+		}
+		p, ok := twr.Products[f.Product_id]
+		if !ok {
+			p.Product_id = f.Product_id
+			p.Name = getProductNameFromId(int(f.Product_id))
+		}
+		p.Last_seen = now
+		p.Count++
+		twr.Products[f.Product_id] = p
+		productIds = append(productIds, f.Product_id)
+	}
+	ADSBTowers[towerid] = twr
+	ADSBTowerMutex.Unlock()
+
+	coverageMutex.Lock()
+	if lastFISBUplink.IsZero() || now.Sub(lastFISBUplink) > fisbCoverageTimeout {
+		fisbCoverageStart = now
+	}
+	lastFISBUplink = now
+	coverageMutex.Unlock()
+
+	updateTowerHistory(towerid, twr.Lat, twr.Lng, uatMsg.TISBSiteID, signalStrength, productIds, time.Now())
+}
+
+// updateTowerHistory records a reception of the given tower in the persisted history.
+func updateTowerHistory(towerid string, lat, lng float64, siteId uint8, signalStrength float64, productIds []uint32, now time.Time) {
+	towerHistoryMutex.Lock()
+	defer towerHistoryMutex.Unlock()
+	if towerHistory == nil {
+		towerHistory = make(map[string]ADSBTowerHistory)
+	}
+	h, ok := towerHistory[towerid]
+	if !ok {
+		h.Lat = lat
+		h.Lng = lng
+		h.First_seen = now
+		h.Signal_strength_max = -999
+	}
+	h.TISB_site_id = siteId
+	h.Last_seen = now
+	h.Messages_total++
+	if signalStrength > h.Signal_strength_max {
+		h.Signal_strength_max = signalStrength
+	}
+	for _, id := range productIds {
+		i := sort.Search(len(h.Products), func(i int) bool { return h.Products[i] >= id })
+		if i < len(h.Products) && h.Products[i] == id {
+			continue
+		}
+		h.Products = append(h.Products, 0)
+		copy(h.Products[i+1:], h.Products[i:])
+		h.Products[i] = id
+	}
+	towerHistory[towerid] = h
+	towerHistoryDirty = true
+}
+
+// registerTISBTargetReceived is called for every TIS-B or ADS-R target report received via UAT.
+func registerTISBTargetReceived() {
+	coverageMutex.Lock()
+	lastTISBTarget = stratuxClock.Time
+	coverageMutex.Unlock()
+}
+
+// registerTISBServiceStatus is called for every TIS-B/ADS-R Service Status frame received. The ground
+// station lists all aircraft it currently considers clients, i.e. provides TIS-B/ADS-R traffic for.
+func registerTISBServiceStatus(targets []uatparse.ServiceStatusTarget) {
+	addrs := ownshipAddresses()
+	for _, t := range targets {
+		for _, a := range addrs {
+			if t.Addr == a {
+				coverageMutex.Lock()
+				lastOwnshipServiced = stratuxClock.Time
+				coverageMutex.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// ownshipAddresses returns the ICAO addresses the user has configured for the ownship transponder.
+func ownshipAddresses() []uint32 {
+	ret := make([]uint32, 0)
+	for _, code := range strings.Split(globalSettings.OwnshipModeS, ",") {
+		addr, err := strconv.ParseUint(strings.TrimSpace(code), 16, 24)
+		if err != nil || addr == 0 || addr == 0xF00000 {
+			continue
+		}
+		ret = append(ret, uint32(addr))
+	}
+	return ret
+}
+
+// isOwnshipConfigured returns true if the user has entered the ICAO code of the ownship transponder.
+func isOwnshipConfigured() bool {
+	return len(ownshipAddresses()) > 0
+}
+
+// updateTowerHealth updates the FIS-B/TIS-B status fields and raises or clears the coverage alerts.
+func updateTowerHealth(now time.Time) {
+	coverageMutex.Lock()
+	lastUplink := lastFISBUplink
+	coverageStart := fisbCoverageStart
+	lastTarget := lastTISBTarget
+	lastServiced := lastOwnshipServiced
+	coverageMutex.Unlock()
+
+	if lastUplink.IsZero() {
+		globalStatus.FISB_last_uplink_age = -1
+	} else {
+		globalStatus.FISB_last_uplink_age = int64(now.Sub(lastUplink).Seconds())
+	}
+	inCoverage := !lastUplink.IsZero() && now.Sub(lastUplink) <= fisbCoverageTimeout
+	globalStatus.TISB_service = inCoverage && !lastTarget.IsZero() && now.Sub(lastTarget) <= tisbOutageAlertTime
+	globalStatus.TISB_ownship_client = isOwnshipConfigured() && !lastServiced.IsZero() && now.Sub(lastServiced) <= tisbClientTimeout
+
+	if globalSettings.UAT_Enabled && !lastUplink.IsZero() && now.Sub(lastUplink) >= fisbOutageAlertTime {
+		updateSingleSystemErrorf("fisb-outage", "No FIS-B uplink received for %d minutes. Weather data may be outdated.", int(now.Sub(lastUplink).Minutes()))
+	} else {
+		removeSingleSystemError("fisb-outage")
+	}
+
+	// TIS-B/ADS-R is only uplinked for clients that transmit ADS-B out. Measure from whichever is later:
+	// the last TIS-B target or the time we entered FIS-B coverage. If the ground station lists us as a client,
+	// there is simply no traffic to report.
+	since := coverageStart
+	if lastTarget.After(since) {
+		since = lastTarget
+	}
+	if globalSettings.UAT_Enabled && isOwnshipConfigured() && inCoverage && !globalStatus.TISB_ownship_client && now.Sub(since) >= tisbOutageAlertTime {
+		updateSingleSystemErrorf("tisb-outage", "No TIS-B service for ownship for %d minutes. Check transponder and ADS-B out.", int(now.Sub(since).Minutes()))
+	} else {
+		removeSingleSystemError("tisb-outage")
+	}
+}
+
+// Save the tower history, if anything changed.
+func saveTowerHistory() error {
+	towerHistoryMutex.Lock()
+	if !towerHistoryDirty || len(towerHistoryFileName) == 0 {
+		towerHistoryMutex.Unlock()
+		return nil
+	}
+	buf, err := json.Marshal(&towerHistory)
+	towerHistoryDirty = false
+	towerHistoryMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	tmpFile := towerHistoryFileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, towerHistoryFileName)
+}
+
+// Load the tower history saved by a previous run.
+func loadTowerHistory() error {
+	buf, err := ioutil.ReadFile(towerHistoryFileName)
+	if err != nil {
+		return err
+	}
+	hist := make(map[string]ADSBTowerHistory)
+	if err := json.Unmarshal(buf, &hist); err != nil {
+		return err
+	}
+	towerHistoryMutex.Lock()
+	towerHistory = hist
+	towerHistoryDirty = false
+	towerHistoryMutex.Unlock()
+	return nil
+}
+
+func towerHistorySaver() {
+	ticker := time.NewTicker(towerHistorySaveInterval)
+	for {
+		<-ticker.C
+		if err := saveTowerHistory(); err != nil {
+			log.Printf("Failed to save tower history %s: %s\n", towerHistoryFileName, err.Error())
+		}
+	}
+}
+
+func initTowerHistory(fname string) {
+	towerHistoryFileName = fname
+	towerHistory = make(map[string]ADSBTowerHistory)
+	if err := loadTowerHistory(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to load tower history %s: %s\n", fname, err.Error())
+	}
+	go towerHistorySaver()
+}
+
+// AJAX call - /getTowerHistory. Responds with all ADS-B ground towers ever received, including previous runs.
+func handleTowerHistoryRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+
+	towerHistoryMutex.Lock()
+	historyJSON, err := json.Marshal(&towerHistory)
+	towerHistoryMutex.Unlock()
+	if err != nil {
+		log.Printf("Error sending tower history JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", historyJSON)
+}
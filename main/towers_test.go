@@ -0,0 +1,315 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	towers_test.go: Tests for FIS-B ground station health tracking.
+*/
+
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/uatparse"
+)
+
+func setupTowersTest(t *testing.T) {
+	if stratuxClock == nil {
+		stratuxClock = NewMonotonic()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if ADSBTowerMutex == nil {
+		ADSBTowerMutex = &sync.Mutex{}
+	}
+	if systemErrsMutex == nil {
+		systemErrsMutex = &sync.Mutex{}
+	}
+	if systemErrs == nil {
+		systemErrs = make(map[string]string)
+	}
+
+	origTowers := ADSBTowers
+	origHistory := towerHistory
+	origHistoryFile := towerHistoryFileName
+	origSettings := globalSettings
+	origStatus := globalStatus
+	t.Cleanup(func() {
+		ADSBTowers = origTowers
+		towerHistory = origHistory
+		towerHistoryFileName = origHistoryFile
+		globalSettings = origSettings
+		globalStatus = origStatus
+		removeSingleSystemError("fisb-outage")
+		removeSingleSystemError("tisb-outage")
+		coverageMutex.Lock()
+		lastFISBUplink = time.Time{}
+		fisbCoverageStart = time.Time{}
+		lastTISBTarget = time.Time{}
+		lastOwnshipServiced = time.Time{}
+		coverageMutex.Unlock()
+	})
+
+	ADSBTowers = make(map[string]ADSBTower)
+	towerHistory = make(map[string]ADSBTowerHistory)
+	towerHistoryFileName = ""
+	globalStatus = status{}
+	globalStatus.Errors = make([]string, 0)
+	coverageMutex.Lock()
+	lastFISBUplink = time.Time{}
+	fisbCoverageStart = time.Time{}
+	lastTISBTarget = time.Time{}
+	lastOwnshipServiced = time.Time{}
+	coverageMutex.Unlock()
+}
+
+func makeTowerTestMsg(slot, site uint8, products ...uint32) *uatparse.UATMsg {
+	msg := &uatparse.UATMsg{Lat: 43.5, Lon: -88.5, SlotID: slot, TISBSiteID: site}
+	for _, p := range products {
+		msg.Frames = append(msg.Frames, &uatparse.UATFrame{Frame_type: 0, Product_id: p})
+	}
+	return msg
+}
+
+func hasSystemError(substr string) bool {
+	for _, e := range globalStatus.Errors {
+		if strings.Contains(e, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegisterTowerUplink(t *testing.T) {
+	setupTowersTest(t)
+
+	registerTowerUplink("twr1", makeTowerTestMsg(3, 7, 413, 63), -20)
+	registerTowerUplink("twr1", makeTowerTestMsg(4, 7, 413), -10)
+
+	twr, ok := ADSBTowers["twr1"]
+	if !ok {
+		t.Fatal("tower not registered")
+	}
+	if twr.Messages_total != 2 {
+		t.Errorf("Messages_total = %d, want 2", twr.Messages_total)
+	}
+	if twr.TISB_site_id != 7 {
+		t.Errorf("TISB_site_id = %d, want 7", twr.TISB_site_id)
+	}
+	if len(twr.Slots_used) != 2 || twr.Slots_used[0] != 3 || twr.Slots_used[1] != 4 {
+		t.Errorf("Slots_used = %v, want [3 4]", twr.Slots_used)
+	}
+	if p := twr.Products[413]; p.Count != 2 || p.Name != getProductNameFromId(413) {
+		t.Errorf("product 413 = %+v, want Count 2", p)
+	}
+	if p := twr.Products[63]; p.Count != 1 {
+		t.Errorf("product 63 count = %d, want 1", p.Count)
+	}
+	if twr.First_seen.IsZero() || twr.Last_seen.Before(twr.First_seen) {
+		t.Errorf("bad First_seen/Last_seen: %v / %v", twr.First_seen, twr.Last_seen)
+	}
+
+	h := towerHistory["twr1"]
+	if h.Messages_total != 2 || h.Signal_strength_max != -10 {
+		t.Errorf("history = %+v, want 2 messages, max -10", h)
+	}
+	if len(h.Products) != 2 || h.Products[0] != 63 || h.Products[1] != 413 {
+		t.Errorf("history products = %v, want [63 413]", h.Products)
+	}
+}
+
+func TestTowerHistorySaveLoad(t *testing.T) {
+	setupTowersTest(t)
+	towerHistoryFileName = filepath.Join(t.TempDir(), towerHistoryFile)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	updateTowerHistory("twr1", 43.5, -88.5, 2, -15, []uint32{413, 8}, now)
+	if err := saveTowerHistory(); err != nil {
+		t.Fatalf("saveTowerHistory: %v", err)
+	}
+	if towerHistoryDirty {
+		t.Error("history still dirty after save")
+	}
+	if _, err := os.Stat(towerHistoryFileName); err != nil {
+		t.Fatalf("history file not written: %v", err)
+	}
+
+	towerHistory = nil
+	if err := loadTowerHistory(); err != nil {
+		t.Fatalf("loadTowerHistory: %v", err)
+	}
+	h, ok := towerHistory["twr1"]
+	if !ok {
+		t.Fatal("tower missing after load")
+	}
+	if h.Lat != 43.5 || h.TISB_site_id != 2 || !h.Last_seen.Equal(now) {
+		t.Errorf("loaded history = %+v", h)
+	}
+	if len(h.Products) != 2 || h.Products[0] != 8 {
+		t.Errorf("loaded products = %v, want [8 413]", h.Products)
+	}
+}
+
+func TestUpdateTowerHealthFISBOutage(t *testing.T) {
+	setupTowersTest(t)
+	globalSettings.UAT_Enabled = true
+
+	now := stratuxClock.Time
+	updateTowerHealth(now)
+	if globalStatus.FISB_last_uplink_age != -1 {
+		t.Errorf("FISB_last_uplink_age = %d, want -1 before first uplink", globalStatus.FISB_last_uplink_age)
+	}
+	if hasSystemError("No FIS-B") {
+		t.Error("FIS-B alert raised before any uplink was received")
+	}
+
+	coverageMutex.Lock()
+	lastFISBUplink = now.Add(-7 * time.Minute)
+	coverageMutex.Unlock()
+	updateTowerHealth(now)
+	if globalStatus.FISB_last_uplink_age != 420 {
+		t.Errorf("FISB_last_uplink_age = %d, want 420", globalStatus.FISB_last_uplink_age)
+	}
+	if !hasSystemError("No FIS-B uplink received for 7 minutes") {
+		t.Errorf("expected FIS-B outage alert, got %v", globalStatus.Errors)
+	}
+
+	// Message text is updated in place.
+	updateTowerHealth(now.Add(2 * time.Minute))
+	if !hasSystemError("for 9 minutes") || hasSystemError("for 7 minutes") {
+		t.Errorf("expected updated alert text, got %v", globalStatus.Errors)
+	}
+
+	coverageMutex.Lock()
+	lastFISBUplink = now
+	coverageMutex.Unlock()
+	updateTowerHealth(now)
+	if hasSystemError("No FIS-B") {
+		t.Error("FIS-B alert not cleared after uplink")
+	}
+}
+
+func TestUpdateTowerHealthTISB(t *testing.T) {
+	setupTowersTest(t)
+	globalSettings.UAT_Enabled = true
+
+	now := stratuxClock.Time
+	coverageMutex.Lock()
+	lastFISBUplink = now
+	fisbCoverageStart = now.Add(-10 * time.Minute)
+	coverageMutex.Unlock()
+
+	tests := []struct {
+		name       string
+		ownship    string
+		lastTarget time.Duration
+		wantAlert  bool
+		wantTISB   bool
+	}{
+		{"No ownship configured", "F00000", 0, false, false},
+		{"Ownship, never any TIS-B", "A12345", 0, true, false},
+		{"Ownship, recent TIS-B", "A12345", 1 * time.Minute, false, true},
+		{"Ownship, stale TIS-B", "A12345", 6 * time.Minute, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globalSettings.OwnshipModeS = tt.ownship
+			coverageMutex.Lock()
+			if tt.lastTarget == 0 {
+				lastTISBTarget = time.Time{}
+			} else {
+				lastTISBTarget = now.Add(-tt.lastTarget)
+			}
+			coverageMutex.Unlock()
+			updateTowerHealth(now)
+			if got := hasSystemError("No TIS-B service"); got != tt.wantAlert {
+				t.Errorf("alert = %v, want %v (%v)", got, tt.wantAlert, globalStatus.Errors)
+			}
+			if globalStatus.TISB_service != tt.wantTISB {
+				t.Errorf("TISB_service = %v, want %v", globalStatus.TISB_service, tt.wantTISB)
+			}
+		})
+	}
+}
+
+func TestHandleTowerHistoryRequest(t *testing.T) {
+	setupTowersTest(t)
+	updateTowerHistory("(43.500000,-88.500000)", 43.5, -88.5, 1, -20, []uint32{413}, time.Now())
+
+	w := httptest.NewRecorder()
+	handleTowerHistoryRequest(w, httptest.NewRequest("GET", "/getTowerHistory", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "(43.500000,-88.500000)") || !strings.Contains(body, "\"Products\":[413]") {
+		t.Errorf("unexpected response: %s", body)
+	}
+}
+
+func TestRegisterTISBServiceStatus(t *testing.T) {
+	setupTowersTest(t)
+	globalSettings.UAT_Enabled = true
+	globalSettings.OwnshipModeS = "A12345, ABCDEF"
+
+	now := stratuxClock.Time
+	coverageMutex.Lock()
+	lastFISBUplink = now
+	fisbCoverageStart = now.Add(-10 * time.Minute)
+	coverageMutex.Unlock()
+
+	// Other aircraft served only.
+	registerTISBServiceStatus([]uatparse.ServiceStatusTarget{{Addr_type: 0, Addr: 0x123456}})
+	updateTowerHealth(stratuxClock.Time)
+	if globalStatus.TISB_ownship_client {
+		t.Error("TISB_ownship_client set for foreign address")
+	}
+	if !hasSystemError("No TIS-B service") {
+		t.Error("expected TIS-B alert when ownship is not a client")
+	}
+
+	// Second configured ownship code is listed.
+	registerTISBServiceStatus([]uatparse.ServiceStatusTarget{{Addr_type: 0, Addr: 0x123456}, {Addr_type: 0, Addr: 0xABCDEF}})
+	updateTowerHealth(stratuxClock.Time)
+	if !globalStatus.TISB_ownship_client {
+		t.Error("TISB_ownship_client not set")
+	}
+	if hasSystemError("No TIS-B service") {
+		t.Error("TIS-B alert should be cleared while ownship is a client")
+	}
+
+	// Client status expires.
+	updateTowerHealth(stratuxClock.Time.Add(2 * time.Minute))
+	if globalStatus.TISB_ownship_client {
+		t.Error("TISB_ownship_client did not expire")
+	}
+}
+
+func TestOwnshipAddresses(t *testing.T) {
+	setupTowersTest(t)
+	tests := []struct {
+		codes string
+		want  []uint32
+	}{
+		{"", []uint32{}},
+		{"F00000", []uint32{}},
+		{"A12345", []uint32{0xA12345}},
+		{"a12345, 0ABCDE ,xyz", []uint32{0xA12345, 0x0ABCDE}},
+	}
+	for _, tt := range tests {
+		globalSettings.OwnshipModeS = tt.codes
+		got := ownshipAddresses()
+		if len(got) != len(tt.want) {
+			t.Errorf("ownshipAddresses(%q) = %v, want %v", tt.codes, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ownshipAddresses(%q) = %v, want %v", tt.codes, got, tt.want)
+			}
+		}
+	}
+}
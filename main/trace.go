@@ -9,6 +9,7 @@ package main
 import (
 	"compress/gzip"
 	"encoding/csv"
+	"encoding/hex"
 	"log"
 	"os"
 	"sync"
@@ -31,6 +32,7 @@ type TraceLogger struct {
 const (
 	CONTEXT_AIS         = "ais"
 	CONTEXT_NMEA        = "nmea"
+	CONTEXT_UBX         = "ubx"
 	CONTEXT_APRS        = "aprs"
 	CONTEXT_OGN_RX      = "ogn-rx"
 	CONTEXT_DUMP1090    = "dump1090"
@@ -172,6 +174,11 @@ func injectTraceMessage(context string, ts time.Time, data []byte) {
 	} else if context == CONTEXT_NMEA {
 		globalStatus.GPS_connected = true
 		processNMEALineLow(string(data), true)
+	} else if context == CONTEXT_UBX {
+		if msg, err := hex.DecodeString(string(data)); err == nil {
+			globalStatus.GPS_connected = true
+			processUBXMessageLow(msg, true)
+		}
 	} else if context == CONTEXT_APRS {
 		parseAprsMessage(string(data), true)
 	} else if context == CONTEXT_OGN_RX {
@@ -96,7 +96,7 @@ type TrafficInfo struct {
 	Lng                 float32   // decimal common.Degrees, east positive
 	Alt                 int32     // Pressure altitude, feet
 	GnssDiffFromBaroAlt int32     // GNSS altitude above WGS84 datum. Reported in TC 20-22 messages
-	AltIsGNSS           bool      // Pressure alt = 0; GNSS alt = 1
+	AltIsGNSS           bool      // Pressure alt = 0; GNSS alt (HAE) = 1
 	NIC                 int       // Navigation Integrity Category.
 	NACp                int       // Navigation Accuracy Category for Position.
 	Track               float32   // common.Degrees true
@@ -132,6 +132,8 @@ type TrafficInfo struct {
 	DistanceEstimatedLastTs time.Time // Used to compute moving average
 	ReceivedMsgs            uint64    // Number of messages received by this aircraft
 	IsStratux               bool      // Target is equipped with a Stratux that transmits via OGN tracker
+
+	UATInfo *UATTargetInfo `json:",omitempty"` // Supplemental UAT ADS-B data (mode status, target state, aux. state vector). nil for non-UAT targets.
 	//FIXME: Rename variables for consistency, especially "Last_".
 }
 
@@ -606,8 +608,12 @@ func makeTrafficReportMsg(ti TrafficInfo) []byte {
 	// GDL90 expects barometric altitude in traffic reports
 	var baroAlt int32
 	if ti.AltIsGNSS && isTempPressValid() {
-		// Convert from GPS geoid height to barometric altitude
-		baroAlt = ti.Alt - int32(mySituation.GPSGeoidSep)
+		// Convert from GPS ellipsoid height to MSL at the traffic's position, then to barometric altitude
+		geoidSep := mySituation.GPSGeoidSep
+		if ti.Position_valid {
+			geoidSep = float32(common.GeoidHeightFt(float64(ti.Lat), float64(ti.Lng)))
+		}
+		baroAlt = ti.Alt - int32(geoidSep)
 		baroAlt = baroAlt - int32(mySituation.GPSAltitudeMSL) + int32(mySituation.BaroPressureAltitude)
 	} else {
 		baroAlt = ti.Alt
@@ -770,59 +776,15 @@ func parseDownlinkReport(s string, signalLevel int) {
 		ti.NACp = int((frame[25] >> 4) & 0x0F)
 		ti.PriorityStatus = (frame[23] >> 5) & 0x07
 
-		// Following section is future-use for debugging and / or additional status info on UAT traffic. Message parsing needs testing.
-
-		if globalSettings.DEBUG {
-			//declaration for mode status flags -- parse for debug logging
-			var status_sil byte
-			//var status_transmit_mso byte
-			var status_sda byte
-			var status_nacv byte
-			//var status_nicbaro byte
-			//var status_sil_supp byte
-			//var status_geom_vert_acc byte
-			//var status_sa_flag byte
-			var capability_uat_in bool
-			var capability_1090_in bool
-			//var capability_tcas bool
-			//var capability_cdti bool
-			//var opmode_tcas_active bool
-			//var opmode_ident_active bool
-			//var opmode_rec_atc_serv bool
-
-			// these are present in v1 and v2 messages
-			status_sil = frame[23] & 0x03
-			//status_transmit_mso = frame[24] >> 2
-			status_nacv = (frame[25] >> 1) & 0x07
-			//status_nicbaro = frame[25] & 0x01
-
-			// other status and capability bits are different between v1 and v2
-			if uat_version == 2 {
-				status_sda = frame[24] & 0x03
-				capability_uat_in = (frame[26] >> 7) != 0
-				capability_1090_in = ((frame[26] >> 6) & 0x01) != 0
-				//capability_tcas = ((frame[26] >> 5) & 0x01) != 0
-				//opmode_tcas_active = ((frame[26] >> 4) & 0x01) != 0
-				//opmode_ident_active = ((frame[26] >> 3) & 0x01) != 0
-				//opmode_rec_atc_serv = ((frame[26] >> 2) & 0x01) != 0
-				//status_sil_supp = frame[26] & 0x01
-				//status_geom_vert_acc = (frame[27] >> 6) & 0x03
-				//status_sa_flag = (frame[27] >> 5) & 0x01
-
-			} else if uat_version == 1 {
-				//capability_cdti = (frame[26] >> 7) != 0
-				//capability_tcas = ((frame[26] >> 6) & 0x01) != 0
-				//opmode_tcas_active = ((frame[26] >> 5) & 0x01) != 0
-				//opmode_ident_active = ((frame[26] >> 4) & 0x01) != 0
-				//opmode_rec_atc_serv = ((frame[26] >> 3) & 0x01) != 0
-			}
-
-			log.Printf("Supplemental UAT Mode Status for %06X: Version = %d; SIL = %d; SDA = %d; NACv = %d; 978 In = %v; 1090 In = %v\n", icao_addr, uat_version, status_sil, status_sda, status_nacv, capability_uat_in, capability_1090_in)
-		}
 	}
 
 	ti.NIC = int(frame[11] & 0x0F)
 
+	ti.UATInfo = decodeUATTargetInfo(frame, ti.UATInfo)
+	if globalSettings.DEBUG && (msg_type == 1 || msg_type == 3) {
+		logUATTargetInfo(icao_addr, ti.UATInfo)
+	}
+
 	var power float64
 	if signalLevel > 0 {
 		power = 20 * (math.Log10(float64(signalLevel) / 1000)) // reported amplitude is 0-1000. Normalize to max = 1 and do amplitude dB calculation (20 dB per decade)
@@ -845,6 +807,9 @@ func parseDownlinkReport(s string, signalLevel int) {
 			ti.TargetType = TARGET_TYPE_ADSR
 		}
 	}
+	if ti.TargetType != TARGET_TYPE_ADSB {
+		registerTISBTargetReceived()
+	}
 
 	// This is a hack to show the source of the traffic on moving maps.
 	if globalSettings.DisplayTrafficSource {
@@ -1014,25 +979,13 @@ func parseDownlinkReport(s string, signalLevel int) {
 
 	//	fmt.Printf("ns_vel %d, ew_vel %d, track %d, speed_valid %t, speed %d, vvel_geo %t, vvel %d\n", ns_vel, ew_vel, track, speed_valid, speed, vvel_geo, vvel)
 
-	/*
-		utc_coupled := false
-		tisb_site_id := uint8(0)
-
-		if (uint8(frame[0]) & 7) == 2 || (uint8(frame[0]) & 7) == 3 { //TODO: Meaning?
-			tisb_site_id = uint8(frame[16]) & 0x0f
-		} else {
-			utc_coupled = (uint8(frame[16]) & 0x08) != 0
-		}
-	*/
-
-	//	fmt.Printf("tisb_site_id %d, utc_coupled %t\n", tisb_site_id, utc_coupled)
-
 	ti.Timestamp = time.Now()
 
 	ti.Last_source = TRAFFIC_SOURCE_UAT
 	postProcessTraffic(&ti)
 	traffic[ti.Icao_addr] = ti
 	registerTrafficUpdate(ti)
+	registerInterferenceReport(ti)
 	seenTraffic[ti.Icao_addr] = true // Mark as seen.
 }
 
@@ -1387,6 +1340,7 @@ func parseDump1090Message(buf string) {
 	postProcessTraffic(&ti)
 	traffic[ti.Icao_addr] = ti // Update information on this ICAO code.
 	registerTrafficUpdate(ti)
+	registerInterferenceReport(ti)
 	seenTraffic[ti.Icao_addr] = true // Mark as seen.
 	//log.Printf("%v\n",traffic)
 	trafficMutex.Unlock()
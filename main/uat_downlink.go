@@ -0,0 +1,276 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	uat_downlink.go: Decoding of the UAT ADS-B payload elements that are not part of TrafficInfo:
+	 the remaining state vector bits, Mode Status, Auxiliary State Vector and Target State (DO-282B, payload types 0-10).
+*/
+
+package main
+
+import (
+	"log"
+)
+
+// Track/heading type of the state vector.
+const (
+	UAT_TT_INVALID      = 0
+	UAT_TT_TRACK        = 1
+	UAT_TT_MAG_HEADING  = 2
+	UAT_TT_TRUE_HEADING = 3
+)
+
+// Frame lengths of basic and long UAT ADS-B messages, without FEC.
+const (
+	UAT_MSG_SHORT_LENGTH = 18
+	UAT_MSG_LONG_LENGTH  = 34
+)
+
+// Widths (m) of ground vehicles, indexed by the length/width code of the state vector.
+var uatVehicleWidths = [16]float32{11.5, 23, 28.5, 34, 33, 38, 39.5, 45, 45, 52, 59.5, 67, 72.5, 80, 80, 90}
+
+// UATTargetInfo holds everything decoded from UAT ADS-B messages that doesn't have a place in TrafficInfo.
+// Elements keep their last received value, since not every payload type carries every element.
+type UATTargetInfo struct {
+	Payload_type uint8
+	UAT_version  uint8 // From Mode Status.
+
+	// State vector.
+	UTC_coupled      bool
+	TISB_site_id     uint8 // Only for TIS-B targets (address qualifier 2 or 3).
+	Track_type       uint8 // UAT_TT_*
+	Vvel_is_GNSS     bool  // Vertical velocity source is geometric altitude.
+	Dimensions_valid bool  // Ground vehicles only.
+	Length_m         float32
+	Width_m          float32
+	Position_offset  bool // GPS antenna offset applied.
+
+	// Mode Status.
+	Has_MS               bool
+	SIL                  uint8
+	SIL_supplement       bool // v2: probability per sample instead of per hour.
+	SDA                  uint8
+	Transmit_MSO         uint8
+	NACv                 uint8
+	NIC_baro             bool
+	GVA                  uint8 // v2: geometric vertical accuracy.
+	Single_antenna       bool  // v2
+	Capability_UAT_in    bool  // v1: CDTI.
+	Capability_1090ES_in bool  // v2
+	Capability_TCAS      bool
+	TCAS_RA_active       bool
+	IDENT_active         bool
+	ATC_services         bool
+	Heading_magnetic     bool // v1: heading reference direction.
+	Callsign_is_flightid bool // CSID. False: callsign field holds the Mode 3/A code (v2).
+
+	// Auxiliary State Vector.
+	Has_AUXSV             bool
+	Secondary_alt_valid   bool
+	Secondary_alt         int32
+	Secondary_alt_is_GNSS bool
+
+	// Target State.
+	Has_TS                 bool
+	Selected_alt_valid     bool
+	Selected_alt           int32 // feet
+	Selected_alt_is_FMS    bool  // Selected altitude from FMS rather than MCP/FCU.
+	Baro_setting_valid     bool
+	Baro_setting           float32 // hPa
+	Selected_heading_valid bool
+	Selected_heading       float32 // degrees
+	Modes_valid            bool
+	Autopilot_engaged      bool
+	VNAV_engaged           bool
+	Alt_hold_engaged       bool
+	Approach_mode          bool
+	LNAV_engaged           bool
+}
+
+// Payload types that contain the given element (DO-282B, Table 2-10).
+func uatPayloadHasMS(payloadType uint8) bool {
+	return payloadType == 1 || payloadType == 3
+}
+
+func uatPayloadHasAUXSV(payloadType uint8) bool {
+	return payloadType == 1 || payloadType == 2 || payloadType == 5 || payloadType == 6
+}
+
+// uatTargetStateOffset returns the frame offset of the Target State element, or -1 if the payload type has none.
+func uatTargetStateOffset(payloadType uint8) int {
+	switch payloadType {
+	case 3, 4:
+		return 29
+	case 6:
+		return 24
+	}
+	return -1
+}
+
+// decodeUATTargetInfo decodes a UAT ADS-B message. Elements not present in this payload type are kept from prev.
+func decodeUATTargetInfo(frame []byte, prev *UATTargetInfo) *UATTargetInfo {
+	var info UATTargetInfo
+	if prev != nil {
+		info = *prev
+	}
+	if len(frame) < UAT_MSG_SHORT_LENGTH {
+		return &info
+	}
+
+	info.Payload_type = (frame[0] >> 3) & 0x1f
+	addrType := frame[0] & 0x07
+
+	decodeUATStateVector(frame, addrType, &info)
+
+	if len(frame) < UAT_MSG_LONG_LENGTH {
+		return &info
+	}
+	if uatPayloadHasMS(info.Payload_type) {
+		decodeUATModeStatus(frame, &info)
+	}
+	if uatPayloadHasAUXSV(info.Payload_type) {
+		decodeUATAuxStateVector(frame, &info)
+	}
+	if offset := uatTargetStateOffset(info.Payload_type); offset >= 0 {
+		decodeUATTargetState(frame[offset:offset+5], &info)
+	}
+	return &info
+}
+
+// State vector bits not handled by parseDownlinkReport.
+func decodeUATStateVector(frame []byte, addrType byte, info *UATTargetInfo) {
+	airgroundState := (frame[12] >> 6) & 0x03
+	info.Track_type = UAT_TT_INVALID
+	info.Dimensions_valid = false
+	switch airgroundState {
+	case 0, 1: // Subsonic, supersonic.
+		rawNs := ((uint16(frame[12]) & 0x1f) << 6) | ((uint16(frame[13]) & 0xfc) >> 2)
+		rawEw := ((uint16(frame[13]) & 0x03) << 9) | (uint16(frame[14]) << 1) | ((uint16(frame[15]) & 0x80) >> 7)
+		if rawNs&0x3ff != 0 && rawEw&0x3ff != 0 && (rawNs&0x3ff != 1 || rawEw&0x3ff != 1) {
+			info.Track_type = UAT_TT_TRACK
+		}
+		rawVvel := ((uint16(frame[15]) & 0x7f) << 4) | ((uint16(frame[16]) & 0xf0) >> 4)
+		info.Vvel_is_GNSS = (rawVvel & 0x400) == 0
+	case 2: // Ground.
+		rawTrack := ((uint16(frame[13]) & 0x03) << 9) | (uint16(frame[14]) << 1) | ((uint16(frame[15]) & 0x80) >> 7)
+		info.Track_type = uint8((rawTrack & 0x0600) >> 9)
+		info.Dimensions_valid = true
+		info.Length_m = float32(15 + 10*((frame[15]&0x38)>>3))
+		info.Width_m = uatVehicleWidths[(frame[15]&0x78)>>3]
+		info.Position_offset = (frame[15] & 0x04) != 0
+	}
+
+	if addrType == 2 || addrType == 3 {
+		info.UTC_coupled = false
+		info.TISB_site_id = frame[16] & 0x0f
+	} else {
+		info.UTC_coupled = (frame[16] & 0x08) != 0
+		info.TISB_site_id = 0
+	}
+}
+
+// Mode Status element, frame bytes 17-28. The capability and operational mode bits differ between UAT v1 and v2.
+func decodeUATModeStatus(frame []byte, info *UATTargetInfo) {
+	info.Has_MS = true
+	info.UAT_version = (frame[23] >> 2) & 0x07
+	info.SIL = frame[23] & 0x03
+	info.Transmit_MSO = (frame[24] >> 2) & 0x3f
+	info.NACv = (frame[25] >> 1) & 0x07
+	info.NIC_baro = (frame[25] & 0x01) != 0
+	info.Callsign_is_flightid = ((frame[26] >> 1) & 0x01) != 0
+
+	if info.UAT_version >= 2 {
+		info.SDA = frame[24] & 0x03
+		info.Capability_UAT_in = (frame[26] & 0x80) != 0
+		info.Capability_1090ES_in = (frame[26] & 0x40) != 0
+		info.Capability_TCAS = (frame[26] & 0x20) != 0
+		info.TCAS_RA_active = (frame[26] & 0x10) != 0
+		info.IDENT_active = (frame[26] & 0x08) != 0
+		info.ATC_services = (frame[26] & 0x04) != 0
+		info.SIL_supplement = (frame[26] & 0x01) != 0
+		info.GVA = (frame[27] >> 6) & 0x03
+		info.Single_antenna = (frame[27] & 0x20) != 0
+		info.Heading_magnetic = false
+	} else {
+		info.SDA = 0
+		info.Capability_UAT_in = (frame[26] & 0x80) != 0
+		info.Capability_1090ES_in = false
+		info.Capability_TCAS = (frame[26] & 0x40) != 0
+		info.TCAS_RA_active = (frame[26] & 0x20) != 0
+		info.IDENT_active = (frame[26] & 0x10) != 0
+		info.ATC_services = (frame[26] & 0x08) != 0
+		info.Heading_magnetic = (frame[26] & 0x04) != 0
+		info.SIL_supplement = false
+		info.GVA = 0
+		info.Single_antenna = false
+	}
+}
+
+// Auxiliary State Vector element, frame bytes 29-33. The secondary altitude is of the type the state vector doesn't report.
+func decodeUATAuxStateVector(frame []byte, info *UATTargetInfo) {
+	info.Has_AUXSV = true
+	rawAlt := (int32(frame[29]) << 4) | ((int32(frame[30]) & 0xf0) >> 4)
+	info.Secondary_alt_valid = rawAlt != 0
+	if info.Secondary_alt_valid {
+		info.Secondary_alt = ((rawAlt - 1) * 25) - 1000
+		info.Secondary_alt_is_GNSS = (frame[9] & 0x01) == 0
+	}
+}
+
+// Target State element (5 bytes):
+//
+//	bit 0      selected altitude type (1 = FMS)
+//	bits 1-11  selected altitude, (N-1)*32 ft, 0 = no data
+//	bits 12-20 barometric pressure setting, 800+(N-1)*0.8 hPa, 0 = no data
+//	bit 21     selected heading status, bit 22 sign, bits 23-30 selected heading (180/256 deg)
+//	bit 31     mode indicator status
+//	bits 32-36 autopilot, VNAV, altitude hold, approach, LNAV engaged
+func decodeUATTargetState(ts []byte, info *UATTargetInfo) {
+	info.Has_TS = true
+	v := (uint64(ts[0]) << 32) | (uint64(ts[1]) << 24) | (uint64(ts[2]) << 16) | (uint64(ts[3]) << 8) | uint64(ts[4])
+	bits := func(start, n uint) uint64 {
+		return (v >> (40 - start - n)) & ((1 << n) - 1)
+	}
+
+	info.Selected_alt_is_FMS = bits(0, 1) != 0
+	rawAlt := bits(1, 11)
+	info.Selected_alt_valid = rawAlt != 0
+	if info.Selected_alt_valid {
+		info.Selected_alt = int32(rawAlt-1) * 32
+	}
+
+	rawBaro := bits(12, 9)
+	info.Baro_setting_valid = rawBaro != 0
+	if info.Baro_setting_valid {
+		info.Baro_setting = 800 + float32(rawBaro-1)*0.8
+	}
+
+	info.Selected_heading_valid = bits(21, 1) != 0
+	if info.Selected_heading_valid {
+		hdg := float32(bits(23, 8)) * 180 / 256
+		if bits(22, 1) != 0 {
+			hdg += 180
+		}
+		info.Selected_heading = hdg
+	}
+
+	info.Modes_valid = bits(31, 1) != 0
+	info.Autopilot_engaged = info.Modes_valid && bits(32, 1) != 0
+	info.VNAV_engaged = info.Modes_valid && bits(33, 1) != 0
+	info.Alt_hold_engaged = info.Modes_valid && bits(34, 1) != 0
+	info.Approach_mode = info.Modes_valid && bits(35, 1) != 0
+	info.LNAV_engaged = info.Modes_valid && bits(36, 1) != 0
+}
+
+// logUATTargetInfo writes the supplemental UAT status of a target to the debug log.
+func logUATTargetInfo(icao uint32, info *UATTargetInfo) {
+	log.Printf("Supplemental UAT Mode Status for %06X: Version = %d; SIL = %d; SDA = %d; NACv = %d; 978 In = %v; 1090 In = %v; TCAS = %v; ATC = %v\n",
+		icao, info.UAT_version, info.SIL, info.SDA, info.NACv, info.Capability_UAT_in, info.Capability_1090ES_in, info.Capability_TCAS, info.ATC_services)
+	if info.Has_TS {
+		log.Printf("UAT Target State for %06X: Sel. alt = %d (valid %v, FMS %v); Baro = %.1f (valid %v); Sel. hdg = %.1f (valid %v); AP %v VNAV %v ALT %v APP %v LNAV %v\n",
+			icao, info.Selected_alt, info.Selected_alt_valid, info.Selected_alt_is_FMS, info.Baro_setting, info.Baro_setting_valid,
+			info.Selected_heading, info.Selected_heading_valid, info.Autopilot_engaged, info.VNAV_engaged, info.Alt_hold_engaged, info.Approach_mode, info.LNAV_engaged)
+	}
+}
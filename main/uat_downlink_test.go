@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// encodeTargetState packs a Target State element, the reverse of decodeUATTargetState.
+func encodeTargetState(fms bool, rawAlt, rawBaro uint64, hdgValid, hdgSign bool, rawHdg uint64, modesValid bool, modes uint64) []byte {
+	var v uint64
+	put := func(start, n uint, val uint64) {
+		v |= (val & ((1 << n) - 1)) << (40 - start - n)
+	}
+	b2u := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	put(0, 1, b2u(fms))
+	put(1, 11, rawAlt)
+	put(12, 9, rawBaro)
+	put(21, 1, b2u(hdgValid))
+	put(22, 1, b2u(hdgSign))
+	put(23, 8, rawHdg)
+	put(31, 1, b2u(modesValid))
+	put(32, 5, modes)
+	return []byte{byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func TestDecodeUATTargetState(t *testing.T) {
+	tests := []struct {
+		name      string
+		ts        []byte
+		wantAlt   int32
+		altValid  bool
+		fms       bool
+		wantBaro  float32
+		baroValid bool
+		wantHdg   float32
+		hdgValid  bool
+		ap, vnav  bool
+		althold   bool
+		app, lnav bool
+	}{
+		{
+			name: "No data",
+			ts:   encodeTargetState(false, 0, 0, false, false, 0, false, 0),
+		},
+		{
+			name:     "MCP altitude 9984 ft, QNH 1013.6, heading 90, AP+ALT",
+			ts:       encodeTargetState(false, 313, 268, true, false, 128, true, 0x14),
+			wantAlt:  9984,
+			altValid: true, wantBaro: 1013.6, baroValid: true,
+			wantHdg: 90, hdgValid: true,
+			ap: true, althold: true,
+		},
+		{
+			name:     "FMS altitude, heading 270, VNAV+APP+LNAV",
+			ts:       encodeTargetState(true, 1001, 0, true, true, 128, true, 0x0b),
+			wantAlt:  32000,
+			altValid: true, fms: true,
+			wantHdg: 270, hdgValid: true,
+			vnav: true, app: true, lnav: true,
+		},
+		{
+			name: "Mode bits ignored without mode status",
+			ts:   encodeTargetState(false, 0, 0, false, false, 0, false, 0x1f),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info UATTargetInfo
+			decodeUATTargetState(tt.ts, &info)
+			if !info.Has_TS {
+				t.Error("Has_TS not set")
+			}
+			if info.Selected_alt_valid != tt.altValid || (tt.altValid && info.Selected_alt != tt.wantAlt) {
+				t.Errorf("selected alt = %d (valid %v), want %d (valid %v)", info.Selected_alt, info.Selected_alt_valid, tt.wantAlt, tt.altValid)
+			}
+			if info.Selected_alt_is_FMS != tt.fms {
+				t.Errorf("Selected_alt_is_FMS = %v, want %v", info.Selected_alt_is_FMS, tt.fms)
+			}
+			if info.Baro_setting_valid != tt.baroValid || (tt.baroValid && (info.Baro_setting < tt.wantBaro-0.05 || info.Baro_setting > tt.wantBaro+0.05)) {
+				t.Errorf("baro = %.2f (valid %v), want %.2f (valid %v)", info.Baro_setting, info.Baro_setting_valid, tt.wantBaro, tt.baroValid)
+			}
+			if info.Selected_heading_valid != tt.hdgValid || (tt.hdgValid && info.Selected_heading != tt.wantHdg) {
+				t.Errorf("heading = %.1f (valid %v), want %.1f (valid %v)", info.Selected_heading, info.Selected_heading_valid, tt.wantHdg, tt.hdgValid)
+			}
+			if info.Autopilot_engaged != tt.ap || info.VNAV_engaged != tt.vnav || info.Alt_hold_engaged != tt.althold ||
+				info.Approach_mode != tt.app || info.LNAV_engaged != tt.lnav {
+				t.Errorf("modes AP %v VNAV %v ALT %v APP %v LNAV %v, want %v %v %v %v %v",
+					info.Autopilot_engaged, info.VNAV_engaged, info.Alt_hold_engaged, info.Approach_mode, info.LNAV_engaged,
+					tt.ap, tt.vnav, tt.althold, tt.app, tt.lnav)
+			}
+		})
+	}
+}
+
+func TestDecodeUATModeStatusVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		version byte
+		b24     byte
+		b26     byte
+		b27     byte
+		check   func(t *testing.T, info *UATTargetInfo)
+	}{
+		{
+			name: "v2 capabilities", version: 2, b24: 0x4e, b26: 0xe5, b27: 0xa0,
+			check: func(t *testing.T, info *UATTargetInfo) {
+				if info.SDA != 2 || info.Transmit_MSO != 19 {
+					t.Errorf("SDA = %d, MSO = %d, want 2, 19", info.SDA, info.Transmit_MSO)
+				}
+				if !info.Capability_UAT_in || !info.Capability_1090ES_in || !info.Capability_TCAS || info.TCAS_RA_active {
+					t.Errorf("bad v2 capabilities: %+v", info)
+				}
+				if info.IDENT_active || !info.ATC_services || !info.SIL_supplement || info.Callsign_is_flightid {
+					t.Errorf("bad v2 operational modes: %+v", info)
+				}
+				if info.GVA != 2 || !info.Single_antenna {
+					t.Errorf("GVA = %d, SA = %v, want 2, true", info.GVA, info.Single_antenna)
+				}
+			},
+		},
+		{
+			name: "v1 capabilities", version: 1, b24: 0x03, b26: 0x5e, b27: 0xff,
+			check: func(t *testing.T, info *UATTargetInfo) {
+				if info.SDA != 0 || info.GVA != 0 || info.Single_antenna || info.Capability_1090ES_in {
+					t.Errorf("v2-only fields set for v1: %+v", info)
+				}
+				if info.Capability_UAT_in || !info.Capability_TCAS || info.TCAS_RA_active || !info.IDENT_active {
+					t.Errorf("bad v1 capabilities: %+v", info)
+				}
+				if !info.ATC_services || !info.Heading_magnetic || !info.Callsign_is_flightid {
+					t.Errorf("bad v1 operational modes: %+v", info)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := make([]byte, UAT_MSG_LONG_LENGTH)
+			frame[0] = 1 << 3
+			frame[23] = (tt.version << 2) | 0x03
+			frame[24] = tt.b24
+			frame[25] = 0x0b // NACv 5, NICbaro 1
+			frame[26] = tt.b26
+			frame[27] = tt.b27
+			info := decodeUATTargetInfo(frame, nil)
+			if !info.Has_MS || info.UAT_version != tt.version || info.SIL != 3 || info.NACv != 5 || !info.NIC_baro {
+				t.Errorf("bad common mode status: %+v", info)
+			}
+			tt.check(t, info)
+		})
+	}
+}
+
+func TestDecodeUATTargetInfoPayloadTypes(t *testing.T) {
+	ts := encodeTargetState(false, 101, 0, false, false, 0, false, 0) // 3200 ft
+	tests := []struct {
+		payloadType uint8
+		wantMS      bool
+		wantAUXSV   bool
+		wantTS      bool
+	}{
+		{0, false, false, false},
+		{1, true, true, false},
+		{2, false, true, false},
+		{3, true, false, true},
+		{4, false, false, true},
+		{5, false, true, false},
+		{6, false, true, true},
+		{7, false, false, false},
+		{10, false, false, false},
+	}
+	for _, tt := range tests {
+		frame := make([]byte, UAT_MSG_LONG_LENGTH)
+		frame[0] = tt.payloadType << 3
+		if offset := uatTargetStateOffset(tt.payloadType); offset >= 0 {
+			copy(frame[offset:], ts)
+		}
+		if tt.wantAUXSV {
+			frame[29] = 0x0c // Secondary altitude 4000 ft.
+			frame[30] = 0x90
+		}
+		info := decodeUATTargetInfo(frame, nil)
+		if info.Payload_type != tt.payloadType || info.Has_MS != tt.wantMS || info.Has_AUXSV != tt.wantAUXSV || info.Has_TS != tt.wantTS {
+			t.Errorf("payload %d: MS %v AUXSV %v TS %v, want %v %v %v", tt.payloadType, info.Has_MS, info.Has_AUXSV, info.Has_TS, tt.wantMS, tt.wantAUXSV, tt.wantTS)
+		}
+		if tt.wantTS && info.Selected_alt != 3200 {
+			t.Errorf("payload %d: selected alt = %d, want 3200", tt.payloadType, info.Selected_alt)
+		}
+		if tt.wantAUXSV && (!info.Secondary_alt_valid || info.Secondary_alt != 4000 || !info.Secondary_alt_is_GNSS) {
+			t.Errorf("payload %d: secondary alt = %d (valid %v, GNSS %v), want 4000 GNSS", tt.payloadType, info.Secondary_alt, info.Secondary_alt_valid, info.Secondary_alt_is_GNSS)
+		}
+	}
+
+	// Short frames only decode the state vector.
+	info := decodeUATTargetInfo(make([]byte, UAT_MSG_SHORT_LENGTH), nil)
+	if info.Has_MS || info.Has_AUXSV || info.Has_TS {
+		t.Errorf("short frame decoded long elements: %+v", info)
+	}
+}
+
+func TestDecodeUATStateVectorExtras(t *testing.T) {
+	// Ground vehicle: track type true heading, dimension code 5, position offset. TIS-B site 9.
+	frame := make([]byte, UAT_MSG_SHORT_LENGTH)
+	frame[0] = (0 << 3) | 3
+	frame[12] = 0x80
+	frame[13] = 0x03 // track type bits
+	frame[15] = (5 << 3) | 0x04
+	frame[16] = 0x09
+	info := decodeUATTargetInfo(frame, nil)
+	if info.Track_type != UAT_TT_TRUE_HEADING {
+		t.Errorf("Track_type = %d, want %d", info.Track_type, UAT_TT_TRUE_HEADING)
+	}
+	if !info.Dimensions_valid || info.Length_m != 65 || info.Width_m != 38 || !info.Position_offset {
+		t.Errorf("dimensions = %.1f x %.1f (valid %v, offset %v), want 65 x 38", info.Length_m, info.Width_m, info.Dimensions_valid, info.Position_offset)
+	}
+	if info.TISB_site_id != 9 || info.UTC_coupled {
+		t.Errorf("TISB_site_id = %d, UTC_coupled = %v, want 9, false", info.TISB_site_id, info.UTC_coupled)
+	}
+
+	// ADS-B target, airborne, UTC coupled, baro vertical rate.
+	frame = make([]byte, UAT_MSG_SHORT_LENGTH)
+	frame[13] = 0x04 // N/S velocity raw 1 -> 0 kt
+	frame[14] = 0x10 // E/W velocity != 0
+	frame[15] = 0x40 // vertical rate source baro
+	frame[16] = 0x08
+	info = decodeUATTargetInfo(frame, nil)
+	if !info.UTC_coupled || info.TISB_site_id != 0 {
+		t.Errorf("UTC_coupled = %v, TISB_site_id = %d, want true, 0", info.UTC_coupled, info.TISB_site_id)
+	}
+	if info.Track_type != UAT_TT_TRACK || info.Vvel_is_GNSS {
+		t.Errorf("Track_type = %d, Vvel_is_GNSS = %v, want track, baro", info.Track_type, info.Vvel_is_GNSS)
+	}
+}
+
+func TestParseDownlinkReportUATInfo(t *testing.T) {
+	resetUATDownlinkState()
+
+	// Payload type 3 (HDR SV MS TS) followed by type 0: target state must be kept.
+	frame := make([]byte, UAT_MSG_LONG_LENGTH)
+	frame[0] = 3 << 3
+	frame[1], frame[2], frame[3] = 0xA0, 0xB0, 0xC0
+	frame[23] = 2 << 2
+	copy(frame[29:], encodeTargetState(false, 157, 0, false, false, 0, true, 0x10)) // 4992 ft, AP
+	parseDownlinkReport("-"+hex.EncodeToString(frame), 100)
+
+	frame0 := make([]byte, UAT_MSG_SHORT_LENGTH)
+	frame0[0] = 0
+	frame0[1], frame0[2], frame0[3] = 0xA0, 0xB0, 0xC0
+	parseDownlinkReport("-"+hex.EncodeToString(frame0), 100)
+
+	trafficMutex.Lock()
+	ti, ok := traffic[0xA0B0C0]
+	trafficMutex.Unlock()
+	if !ok {
+		t.Fatal("target not found")
+	}
+	if ti.UATInfo == nil {
+		t.Fatal("UATInfo not set")
+	}
+	if ti.UATInfo.Payload_type != 0 || !ti.UATInfo.Has_TS || ti.UATInfo.Selected_alt != 4992 || !ti.UATInfo.Autopilot_engaged {
+		t.Errorf("UATInfo = %+v", ti.UATInfo)
+	}
+	if ti.UATInfo.UAT_version != 2 {
+		t.Errorf("UAT_version = %d, want 2", ti.UATInfo.UAT_version)
+	}
+}
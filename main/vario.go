@@ -0,0 +1,190 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	vario.go: Variometer for glider computers. A Kalman filter on the baro altitude gives a vario that reacts
+	 within about a second, a second one on the total energy altitude (with GPS ground speed, there is no
+	 airspeed) compensates for stick thermals. The results are sent as $LXWP0, OpenVario $POV and LK8EX1 to
+	 the FLARM NMEA connections if enabled, $LXWP0 also carries the wind from wind.go.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	varioNMEAInterval = 200 * time.Millisecond
+	varioAltSigma     = 0.25 // m, baro altitude noise
+	varioAccelSigma   = 1.5  // m/s², vertical acceleration the filter follows
+	varioMaxGap       = 2.0  // s without samples after which the filter starts over
+	varioGravity      = 9.80665
+	varioFtPerM       = 3.28084
+	varioMsPerKt      = 0.514444
+)
+
+// varioFilter estimates altitude and climb rate from altitude samples. The state is altitude and climb rate,
+// the climb rate is modelled as a random walk driven by white acceleration noise.
+type varioFilter struct {
+	initialized bool
+	h, v        float64       // m, m/s
+	p           [2][2]float64 // State covariance.
+}
+
+func (f *varioFilter) reset() {
+	f.initialized = false
+}
+
+// update adds an altitude sample (m) dt seconds after the last one and returns the climb rate (m/s).
+func (f *varioFilter) update(h, dt float64) float64 {
+	if !f.initialized || dt <= 0 || dt > varioMaxGap {
+		f.initialized = true
+		f.h, f.v = h, 0
+		f.p = [2][2]float64{{varioAltSigma * varioAltSigma, 0}, {0, 1}}
+		return f.v
+	}
+
+	// Predict.
+	f.h += f.v * dt
+	q := varioAccelSigma * varioAccelSigma
+	dt2 := dt * dt
+	p00 := f.p[0][0] + dt*(f.p[0][1]+f.p[1][0]) + dt2*f.p[1][1] + q*dt2*dt2/4
+	p01 := f.p[0][1] + dt*f.p[1][1] + q*dt2*dt/2
+	p11 := f.p[1][1] + q*dt2
+	f.p = [2][2]float64{{p00, p01}, {p01, p11}}
+
+	// Correct with the altitude.
+	s := f.p[0][0] + varioAltSigma*varioAltSigma
+	k0, k1 := f.p[0][0]/s, f.p[1][0]/s
+	y := h - f.h
+	f.h += k0 * y
+	f.v += k1 * y
+	f.p = [2][2]float64{
+		{(1 - k0) * f.p[0][0], (1 - k0) * f.p[0][1]},
+		{f.p[1][0] - k1*f.p[0][0], f.p[1][1] - k1*f.p[0][1]},
+	}
+	return f.v
+}
+
+// vario runs the plain and total energy filters.
+type vario struct {
+	baro, te varioFilter
+}
+
+// update adds a pressure altitude sample (ft) and returns the climb rate and the total energy compensated
+// climb rate in ft/min. Without a ground speed, the latter is the plain climb rate.
+func (v *vario) update(altitude, groundSpeed float64, speedValid bool, dt float64) (vs, te float64) {
+	h := altitude / varioFtPerM
+	vs = v.baro.update(h, dt) * 60 * varioFtPerM
+	if !speedValid {
+		v.te.reset()
+		return vs, vs
+	}
+	speed := groundSpeed * varioMsPerKt
+	te = v.te.update(h+speed*speed/(2*varioGravity), dt) * 60 * varioFtPerM
+	return vs, te
+}
+
+// varioData is what the vario sentences carry.
+type varioData struct {
+	baroValid     bool
+	pressure      float64 // hPa
+	altitude      float64 // ft, pressure altitude
+	te            float64 // ft/min
+	temperature   float64 // °C
+	headingValid  bool
+	heading       float64 // degrees true
+	windValid     bool
+	windDirection float64 // degrees true, where the wind comes from
+	windSpeed     float64 // kts
+}
+
+// makeLXWP0String formats the LX Navigation sentence: logger, IAS km/h, baro altitude m, vario m/s (up to six
+// values), heading, wind direction and wind speed km/h. The airspeed is unknown.
+func makeLXWP0String(d varioData) string {
+	var altitude, vario, heading, windDirection, windSpeed string
+	if d.baroValid {
+		altitude = fmt.Sprintf("%.1f", d.altitude/varioFtPerM)
+		vario = fmt.Sprintf("%.2f", d.te/60/varioFtPerM)
+	}
+	if d.headingValid {
+		heading = fmt.Sprintf("%.0f", d.heading)
+	}
+	if d.windValid {
+		windDirection = fmt.Sprintf("%.0f", d.windDirection)
+		windSpeed = fmt.Sprintf("%.1f", d.windSpeed*1.852)
+	}
+	msg := fmt.Sprintf("$LXWP0,N,,%s,%s,,,,,,%s,%s,%s", altitude, vario, heading, windDirection, windSpeed)
+	return appendNmeaChecksum(msg) + "\r\n"
+}
+
+// makePOVString formats the OpenVario sentence: static pressure hPa, total energy vario m/s and temperature °C.
+func makePOVString(d varioData) string {
+	msg := fmt.Sprintf("$POV,P,%.2f,E,%.2f,T,%.1f", d.pressure, d.te/60/varioFtPerM, d.temperature)
+	return appendNmeaChecksum(msg) + "\r\n"
+}
+
+// makeLK8EX1String formats the LK8000 sentence: pressure Pa, altitude m (ignored with pressure), vario cm/s,
+// temperature °C and battery, 999 as Stratux doesn't know its battery.
+func makeLK8EX1String(d varioData) string {
+	msg := fmt.Sprintf("$LK8EX1,%d,%d,%d,%d,999,", int(math.Round(d.pressure*100)), int(math.Round(d.altitude/varioFtPerM)),
+		int(math.Round(d.te/60/varioFtPerM*100)), int(math.Round(d.temperature)))
+	return appendNmeaChecksum(msg) + "\r\n"
+}
+
+var varioLastSent time.Time
+
+// sendVarioNMEA sends the enabled vario sentences, at most every varioNMEAInterval. Without a baro, $LXWP0 still
+// goes out for the wind.
+func sendVarioNMEA() {
+	if !globalSettings.VarioLXWP0 && !globalSettings.VarioPOV && !globalSettings.VarioLK8EX1 {
+		return
+	}
+	if stratuxClock.Since(varioLastSent) < varioNMEAInterval {
+		return
+	}
+
+	var d varioData
+	// Only sources with a vertical speed.
+	d.baroValid = isTempPressValid() && (mySituation.BaroSourceType == BARO_TYPE_BMP280 || mySituation.BaroSourceType == BARO_TYPE_OGNTRACKER)
+	d.windDirection, d.windSpeed, d.windValid = currentWind()
+	if !d.baroValid && !(globalSettings.VarioLXWP0 && d.windValid) {
+		return
+	}
+	varioLastSent = stratuxClock.Time
+
+	if d.baroValid {
+		mySituation.muBaro.Lock()
+		d.altitude = float64(mySituation.BaroPressureAltitude)
+		d.te = float64(mySituation.BaroTEVario)
+		d.temperature = float64(mySituation.BaroTemperature)
+		mySituation.muBaro.Unlock()
+		d.pressure = common.CalcPressure(d.altitude, globalSettings.AltitudeOffset)
+	}
+
+	mySituation.muAttitude.Lock()
+	if isAHRSValid() && !isAHRSInvalidValue(mySituation.AHRSGyroHeading) {
+		d.heading, d.headingValid = mySituation.AHRSGyroHeading, true
+	}
+	mySituation.muAttitude.Unlock()
+
+	if globalSettings.VarioLXWP0 {
+		sendNetFLARM(makeLXWP0String(d), time.Second, 1)
+	}
+	if !d.baroValid {
+		return
+	}
+	if globalSettings.VarioPOV {
+		sendNetFLARM(makePOVString(d), time.Second, 1)
+	}
+	if globalSettings.VarioLK8EX1 {
+		sendNetFLARM(makeLK8EX1String(d), time.Second, 1)
+	}
+}
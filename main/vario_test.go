@@ -0,0 +1,141 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	vario_test.go: Unit tests for the vario filter and sentences
+*/
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// varioRun feeds 20 Hz altitude samples (ft) with noise to a new vario and returns the climb rates (ft/min)
+// at every sample.
+func varioRun(seconds float64, altitude, groundSpeed func(t float64) float64, noise float64) (vs, te []float64) {
+	var v vario
+	r := rand.New(rand.NewSource(1))
+	const dt = 0.05
+	for t := 0.0; t < seconds; t += dt {
+		speed := 0.0
+		if groundSpeed != nil {
+			speed = groundSpeed(t)
+		}
+		a, b := v.update(altitude(t)+r.NormFloat64()*noise, speed, groundSpeed != nil, dt)
+		vs = append(vs, a)
+		te = append(te, b)
+	}
+	return vs, te
+}
+
+func TestVarioFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		altitude func(t float64) float64 // ft
+		want     float64                 // ft/min after 2.5 s
+	}{
+		{"Level", func(t float64) float64 { return 3000 }, 0},
+		{"Climb", func(t float64) float64 { return 3000 + 400*t/60 }, 400},
+		// A thermal entered after 1 s, 2 m/s.
+		{"Thermal", func(t float64) float64 { return 3000 + math.Max(0, t-1)*2*varioFtPerM }, 2 * 60 * varioFtPerM},
+		{"Sink", func(t float64) float64 { return 3000 - 1000*t/60 }, -1000},
+	}
+	for _, tt := range tests {
+		vs, _ := varioRun(5, tt.altitude, nil, 0.6)
+		// Settled 1.5 s after the change, with the noise of a BMP388 within 0.3 m/s.
+		for i := 50; i < len(vs); i++ {
+			if math.Abs(vs[i]-tt.want) > 60 {
+				t.Errorf("%s: %.0f ft/min after %.2f s, want %.0f", tt.name, vs[i], float64(i)*0.05, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestVarioTotalEnergy(t *testing.T) {
+	// Pulling up from 100 to 80 kts converts speed to 159 ft of altitude, without changing the energy.
+	v0, v1 := 100.0, 80.0
+	gain := ((v0*v0 - v1*v1) * varioMsPerKt * varioMsPerKt) / (2 * varioGravity) * varioFtPerM
+	speed := func(t float64) float64 { return v0 - (v0-v1)*math.Min(1, math.Max(0, t-2)/4) }
+	altitude := func(t float64) float64 {
+		s := speed(t)
+		return 3000 + ((v0*v0-s*s)*varioMsPerKt*varioMsPerKt)/(2*varioGravity)*varioFtPerM
+	}
+	if math.Abs(altitude(10)-3000-gain) > 1e-6 {
+		t.Fatalf("test altitude %f", altitude(10))
+	}
+	vs, te := varioRun(8, altitude, speed, 0)
+	var maxVS, maxTE float64
+	for i := range vs {
+		maxVS = math.Max(maxVS, vs[i])
+		maxTE = math.Max(maxTE, math.Abs(te[i]))
+	}
+	if maxVS < 1000 || maxTE > 100 {
+		t.Errorf("zoom climb: vario up to %.0f ft/min, total energy %.0f ft/min", maxVS, maxTE)
+	}
+
+	// Without GPS, there is no compensation.
+	vs, te = varioRun(8, altitude, nil, 0)
+	for i := range vs {
+		if vs[i] != te[i] {
+			t.Fatalf("uncompensated %.0f, %.0f", vs[i], te[i])
+		}
+	}
+}
+
+func TestVarioSentences(t *testing.T) {
+	climb := varioData{baroValid: true, pressure: 843.08, altitude: 5000, te: 300, temperature: 21.5, heading: 275, headingValid: true}
+	sink := varioData{baroValid: true, pressure: 843.08, altitude: 5000, te: -100, temperature: 21.5}
+	wind := varioData{windValid: true, windDirection: 250, windSpeed: 15}
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"LXWP0", makeLXWP0String(climb), "$LXWP0,N,,1524.0,1.52,,,,,,275,,*59\r\n"},
+		{"LXWP0 without heading", makeLXWP0String(sink), "$LXWP0,N,,1524.0,-0.51,,,,,,,,*46\r\n"},
+		{"LXWP0 with only wind", makeLXWP0String(wind), "$LXWP0,N,,,,,,,,,,250,27.8*49\r\n"},
+		{"POV", makePOVString(climb), "$POV,P,843.08,E,1.52,T,21.5*11\r\n"},
+		{"LK8EX1", makeLK8EX1String(climb), "$LK8EX1,84308,1524,152,22,999,*29\r\n"},
+	}
+	for _, tt := range tests {
+		if tt.s != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, tt.s, tt.want)
+		}
+	}
+}
+
+// The OGN tracker's $POGNB is parsed with muGPS held and sends the vario sentences right away.
+func TestVarioFromPOGNB(t *testing.T) {
+	resetGPSState()
+	if netMutex == nil {
+		netMutex = &sync.Mutex{}
+	}
+	origSettings := globalSettings
+	defer func() { globalSettings = origSettings }()
+	globalSettings.VarioLXWP0 = true
+	varioLastSent = time.Time{}
+	mySituation.muBaro.Lock()
+	mySituation.BaroSourceType = BARO_TYPE_NONE
+	mySituation.BaroLastMeasurementTime = time.Time{}
+	mySituation.muBaro.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		done <- processNMEALine(appendNmeaChecksum("$POGNB,22.0,+29.1,100972.3,3.8,+29.4,+87.2,-0.04,+32.6,"))
+	}()
+	select {
+	case used := <-done:
+		if !used || mySituation.BaroSourceType != BARO_TYPE_OGNTRACKER || varioLastSent.IsZero() {
+			t.Errorf("used %t, baro source %d, vario sent at %s", used, mySituation.BaroSourceType, varioLastSent)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("$POGNB deadlocked")
+	}
+}
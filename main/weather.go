@@ -0,0 +1,550 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	weather.go: In-memory store of the latest FIS-B weather products (METAR, TAF, PIREP, winds aloft,
+	 NOTAM, AIRMET/SIGMET, graphical overlays, NEXRAD reception), persisted to disk across restarts and queryable
+	 through /api/weather/*.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	weatherStoreFile         = "stratux-weather.json"
+	weatherStoreSaveInterval = 1 * time.Minute
+	weatherDefaultRadiusNm   = 50.0
+)
+
+// Maximum age of a stored report before it is dropped, per report type.
+var weatherMaxAge = map[string]time.Duration{
+	"METAR":  3 * time.Hour,
+	"TAF":    30 * time.Hour,
+	"PIREP":  3 * time.Hour,
+	"WINDS":  12 * time.Hour,
+	"NOTAM":  48 * time.Hour,
+	"AIRMET": 12 * time.Hour,
+	"SIGMET": 12 * time.Hour,
+}
+
+const weatherDefaultMaxAge = 12 * time.Hour
+
+// WeatherReport is a WeatherMessage as sent on the /weather websocket, plus where it applies and
+// which tower delivered it.
+type WeatherReport struct {
+	WeatherMessage
+	Lat            float64
+	Lon            float64
+	Position_valid bool
+	Position_src   string // "airport" if looked up in the airport db, "tower" if approximated by the uplink station.
+	ADSBTowerID    string
+}
+
+// NEXRADStatus records when a NEXRAD composite was last received.
+type NEXRADStatus struct {
+	Product           string // "Regional" or "CONUS".
+	LastReceived      time.Time
+	Age_seconds       int64
+	Blocks_last_cycle uint32 // Blocks received in the last 10 minutes.
+	blockTimes        []time.Time
+}
+
+type weatherStore struct {
+	mu       sync.Mutex
+	reports  map[string]map[string]WeatherReport // Type -> location -> latest report.
+	nexrad   map[string]*NEXRADStatus
+	overlays map[string]WeatherOverlay // Graphical overlays by product/location/report/record.
+	pending  *weatherStoreFileFormat   // Loaded, but not yet aged by the GPS time, see restore.
+	dirty    bool
+	file     string
+}
+
+var weatherReports *weatherStore
+
+func newWeatherStore(fname string) *weatherStore {
+	return &weatherStore{
+		reports:  make(map[string]map[string]WeatherReport),
+		nexrad:   make(map[string]*NEXRADStatus),
+		overlays: make(map[string]WeatherOverlay),
+		file:     fname,
+	}
+}
+
+// normalizeWeatherType maps the FIS-B text report types onto the categories used by the store.
+func normalizeWeatherType(t string) string {
+	t = strings.ToUpper(t)
+	switch t {
+	case "METAR", "SPECI":
+		return "METAR"
+	case "TAF", "TAF.AMD":
+		return "TAF"
+	case "PIREP", "UA", "UUA":
+		return "PIREP"
+	case "WINDS":
+		return "WINDS"
+	case "NOTAM", "NOTAM-D", "FDC", "TFR":
+		return "NOTAM"
+	case "AIRMET", "G-AIRMET":
+		return "AIRMET"
+	case "SIGMET", "CONV-SIGMET", "CWA", "WST":
+		return "SIGMET"
+	}
+	return t
+}
+
+// locate resolves the position of a report: the airport db first, then the tower that sent it.
+func (report *WeatherReport) locate(towerLat, towerLon float64, towerValid bool) {
+	if apt, ok := lookupAirport(report.Location); ok {
+		report.Lat = apt.Lat
+		report.Lon = apt.Lon
+		report.Position_valid = true
+		report.Position_src = "airport"
+	} else if towerValid {
+		report.Lat = towerLat
+		report.Lon = towerLon
+		report.Position_valid = true
+		report.Position_src = "tower"
+	}
+}
+
+// Add stores a report, replacing any older report of the same type for the same location.
+func (store *weatherStore) Add(report WeatherReport) {
+	typ := normalizeWeatherType(report.Type)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.reports[typ]; !ok {
+		store.reports[typ] = make(map[string]WeatherReport)
+	}
+	// Keep the older report if the FIS-B repeat cycle sends the same one again - only update reception time.
+	if old, ok := store.reports[typ][report.Location]; ok && old.Time == report.Time && old.Data == report.Data {
+		old.LocaltimeReceived = report.LocaltimeReceived
+		store.reports[typ][report.Location] = old
+		return
+	}
+	store.reports[typ][report.Location] = report
+	store.dirty = true
+}
+
+// AddNEXRAD records the reception of a NEXRAD block for the given FIS-B product id.
+func (store *weatherStore) AddNEXRAD(productId uint32, t time.Time) {
+	var name string
+	switch productId {
+	case 63:
+		name = "Regional"
+	case 64:
+		name = "CONUS"
+	default:
+		return
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	st, ok := store.nexrad[name]
+	if !ok {
+		st = &NEXRADStatus{Product: name}
+		store.nexrad[name] = st
+	}
+	st.LastReceived = t
+	st.blockTimes = append(st.blockTimes, t)
+	store.dirty = true
+}
+
+// Prune drops all reports older than their type's maximum age, and overlays that have expired.
+func (store *weatherStore) Prune(now time.Time) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for typ, locs := range store.reports {
+		maxAge, ok := weatherMaxAge[typ]
+		if !ok {
+			maxAge = weatherDefaultMaxAge
+		}
+		for loc, r := range locs {
+			if now.Sub(r.LocaltimeReceived) > maxAge {
+				delete(locs, loc)
+				store.dirty = true
+			}
+		}
+	}
+	for _, st := range store.nexrad {
+		recent := make([]time.Time, 0, len(st.blockTimes))
+		for _, t := range st.blockTimes {
+			if now.Sub(t) <= 10*time.Minute {
+				recent = append(recent, t)
+			}
+		}
+		st.blockTimes = recent
+	}
+	store.pruneOverlays(now, time.Now().UTC())
+}
+
+// weatherQuery selects reports by station, bounding box or radius. An empty query matches everything.
+type weatherQuery struct {
+	Stations []string
+	HasBbox  bool
+	MinLat   float64
+	MinLon   float64
+	MaxLat   float64
+	MaxLon   float64
+	HasNear  bool
+	Lat      float64
+	Lon      float64
+	RadiusNm float64
+}
+
+func (q *weatherQuery) matches(r WeatherReport) bool {
+	if len(q.Stations) > 0 {
+		found := false
+		for _, s := range q.Stations {
+			if strings.EqualFold(s, r.Location) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.HasBbox {
+		if !r.Position_valid || r.Lat < q.MinLat || r.Lat > q.MaxLat {
+			return false
+		}
+		if q.MinLon <= q.MaxLon {
+			if r.Lon < q.MinLon || r.Lon > q.MaxLon {
+				return false
+			}
+		} else if r.Lon < q.MinLon && r.Lon > q.MaxLon { // Box crosses the antimeridian.
+			return false
+		}
+	}
+	if q.HasNear {
+		if !r.Position_valid {
+			return false
+		}
+		dist, _ := common.Distance(q.Lat, q.Lon, r.Lat, r.Lon)
+		if math.IsNaN(dist) { // acos() rounding for identical points.
+			dist = 0
+		}
+		if dist/1852.0 > q.RadiusNm {
+			return false
+		}
+	}
+	return true
+}
+
+// parseWeatherQuery reads ?station=, ?bbox=minLon,minLat,maxLon,maxLat and ?near=lat,lon&radius=nm.
+func parseWeatherQuery(values map[string][]string) (q weatherQuery, err error) {
+	get := func(key string) string {
+		if v, ok := values[key]; ok && len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	if s := get("station"); s != "" {
+		for _, st := range strings.Split(s, ",") {
+			if st = strings.TrimSpace(st); st != "" {
+				q.Stations = append(q.Stations, strings.ToUpper(st))
+			}
+		}
+	}
+	if s := get("bbox"); s != "" {
+		v, err := parseFloatList(s, 4)
+		if err != nil {
+			return q, fmt.Errorf("invalid bbox '%s': %s", s, err.Error())
+		}
+		q.HasBbox = true
+		q.MinLon, q.MinLat, q.MaxLon, q.MaxLat = v[0], v[1], v[2], v[3]
+		if q.MinLat > q.MaxLat {
+			return q, fmt.Errorf("invalid bbox '%s': min latitude above max latitude", s)
+		}
+	}
+	if s := get("near"); s != "" {
+		v, err := parseFloatList(s, 2)
+		if err != nil {
+			return q, fmt.Errorf("invalid near '%s': %s", s, err.Error())
+		}
+		q.HasNear = true
+		q.Lat, q.Lon = v[0], v[1]
+		q.RadiusNm = weatherDefaultRadiusNm
+		if r := get("radius"); r != "" {
+			q.RadiusNm, err = strconv.ParseFloat(r, 64)
+			if err != nil || q.RadiusNm <= 0 {
+				return q, fmt.Errorf("invalid radius '%s'", r)
+			}
+		}
+	}
+	return q, nil
+}
+
+func parseFloatList(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma separated values", n)
+	}
+	ret := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = f
+	}
+	return ret, nil
+}
+
+// Query returns all matching reports of the given type ("" for all types), newest first.
+func (store *weatherStore) Query(typ string, q weatherQuery) []WeatherReport {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ret := make([]WeatherReport, 0)
+	for t, locs := range store.reports {
+		if typ != "" && t != typ {
+			continue
+		}
+		for _, r := range locs {
+			if q.matches(r) {
+				ret = append(ret, r)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].LocaltimeReceived.After(ret[j].LocaltimeReceived)
+	})
+	return ret
+}
+
+// NEXRAD returns the reception status of all NEXRAD products seen so far.
+func (store *weatherStore) NEXRAD(now time.Time) []NEXRADStatus {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ret := make([]NEXRADStatus, 0, len(store.nexrad))
+	for _, st := range store.nexrad {
+		s := *st
+		s.Age_seconds = int64(now.Sub(st.LastReceived).Seconds())
+		s.Blocks_last_cycle = uint32(len(st.blockTimes))
+		s.blockTimes = nil
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Product < ret[j].Product })
+	return ret
+}
+
+// weatherStoreFileFormat is the store on disk. The reception times are on the stratuxClock of the run that saved
+// it, Saved and SavedClock relate that clock to the GPS time.
+type weatherStoreFileFormat struct {
+	Saved      time.Time // GPS time at saving.
+	SavedClock time.Time // stratuxClock at saving.
+	Reports    []WeatherReport
+	NEXRAD     []NEXRADStatus
+	Overlays   []WeatherOverlay
+}
+
+// weatherRealTime returns the GPS time, or the zero time if there hasn't been a GPS time fix yet.
+func weatherRealTime() time.Time {
+	if !stratuxClock.HasRealTimeReference() {
+		return time.Time{}
+	}
+	return stratuxClock.RealTime
+}
+
+// Save writes the store to disk if anything changed since the last save. Without the GPS time (realNow zero) the
+// reports couldn't be aged on the next start, so the previous file is kept instead.
+func (store *weatherStore) Save(now, realNow time.Time) error {
+	store.mu.Lock()
+	if !store.dirty || realNow.IsZero() || store.pending != nil {
+		store.mu.Unlock()
+		return nil
+	}
+	data := weatherStoreFileFormat{Saved: realNow, SavedClock: now}
+	for _, locs := range store.reports {
+		for _, r := range locs {
+			data.Reports = append(data.Reports, r)
+		}
+	}
+	for _, st := range store.nexrad {
+		data.NEXRAD = append(data.NEXRAD, NEXRADStatus{Product: st.Product, LastReceived: st.LastReceived})
+	}
+	for _, o := range store.overlays {
+		data.Overlays = append(data.Overlays, o)
+	}
+	store.dirty = false
+	store.mu.Unlock()
+
+	buf, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+	tmpFile := store.file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, store.file)
+}
+
+// Load reads a previously saved store. Its reception times are on the stratuxClock of the previous run, which
+// on a Pi without RTC resumes close to the last shutdown. The reports are kept aside until the GPS time is known
+// and restore() can tell their age.
+func (store *weatherStore) Load() error {
+	buf, err := ioutil.ReadFile(store.file)
+	if err != nil {
+		return err
+	}
+	var data weatherStoreFileFormat
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return err
+	}
+	if data.Saved.IsZero() {
+		return fmt.Errorf("saved without GPS time, dropped")
+	}
+	store.mu.Lock()
+	store.pending = &data
+	store.mu.Unlock()
+	return nil
+}
+
+// restore adds the loaded reports, with their reception times moved to the current stratuxClock by the GPS time
+// that passed since saving. Reports received in the meantime are kept. Those too old by now are dropped.
+func (store *weatherStore) restore(now, realNow time.Time) {
+	store.mu.Lock()
+	data := store.pending
+	store.pending = nil
+	if data == nil {
+		store.mu.Unlock()
+		return
+	}
+	shift := now.Sub(data.SavedClock) - realNow.Sub(data.Saved)
+	for _, r := range data.Reports {
+		r.LocaltimeReceived = r.LocaltimeReceived.Add(shift)
+		typ := normalizeWeatherType(r.Type)
+		if _, ok := store.reports[typ]; !ok {
+			store.reports[typ] = make(map[string]WeatherReport)
+		}
+		if _, ok := store.reports[typ][r.Location]; !ok {
+			store.reports[typ][r.Location] = r
+		}
+	}
+	for _, o := range data.Overlays {
+		o.LocaltimeReceived = o.LocaltimeReceived.Add(shift)
+		if _, ok := store.overlays[o.key()]; !ok {
+			store.overlays[o.key()] = o
+		}
+	}
+	for _, st := range data.NEXRAD {
+		s := st
+		s.LastReceived = s.LastReceived.Add(shift)
+		if _, ok := store.nexrad[s.Product]; !ok {
+			store.nexrad[s.Product] = &s
+		}
+	}
+	store.mu.Unlock()
+	store.Prune(now)
+}
+
+// registerNEXRADReceived records the reception of a FIS-B frame for NEXRAD age tracking.
+func registerNEXRADReceived(productId uint32) {
+	if weatherReports != nil {
+		weatherReports.AddNEXRAD(productId, stratuxClock.Time)
+	}
+}
+
+func weatherStoreSaver() {
+	ticker := time.NewTicker(weatherStoreSaveInterval)
+	for {
+		<-ticker.C
+		if realNow := weatherRealTime(); !realNow.IsZero() {
+			weatherReports.restore(stratuxClock.Time, realNow)
+		}
+		weatherReports.Prune(stratuxClock.Time)
+		if err := weatherReports.Save(stratuxClock.Time, weatherRealTime()); err != nil {
+			log.Printf("Failed to save weather store %s: %s\n", weatherReports.file, err.Error())
+		}
+	}
+}
+
+// registerWeatherReport adds a decoded FIS-B text report to the store. Position comes from the
+// airport db, or the uplink station as a fallback.
+func registerWeatherReport(wm WeatherMessage, towerLat, towerLon float64, towerValid bool) {
+	if weatherReports == nil {
+		return
+	}
+	var report WeatherReport
+	report.WeatherMessage = wm
+	if towerValid {
+		report.ADSBTowerID = fmt.Sprintf("(%f,%f)", towerLat, towerLon)
+	}
+	report.locate(towerLat, towerLon, towerValid)
+	weatherReports.Add(report)
+}
+
+// sendStoredWeather replays the current store to a newly connected /weather client, so it doesn't
+// have to wait for the next FIS-B cycle.
+func sendStoredWeather(send func([]byte) error) {
+	if weatherReports == nil {
+		return
+	}
+	reports := weatherReports.Query("", weatherQuery{})
+	// Send oldest first so that clients end up with the newest report per station.
+	for i := len(reports) - 1; i >= 0; i-- {
+		msg, _ := json.Marshal(&reports[i].WeatherMessage)
+		if err := send(msg); err != nil {
+			return
+		}
+	}
+}
+
+// AJAX call - /api/weather/<type>. Responds with the stored reports of that type ("all" for every type).
+// Optional filters: ?station=KXYZ[,KABC], ?bbox=minLon,minLat,maxLon,maxLat, ?near=lat,lon&radius=nm.
+// /api/weather/nexrad responds with the NEXRAD reception status instead.
+func handleWeatherAPIRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	if weatherReports == nil {
+		http.Error(w, "weather store not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	typ := strings.ToUpper(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/weather/"), "/"))
+	var ret interface{}
+	switch typ {
+	case "NEXRAD":
+		ret = weatherReports.NEXRAD(stratuxClock.Time)
+	case "", "ALL":
+		typ = ""
+		fallthrough
+	default:
+		q, err := parseWeatherQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ret = weatherReports.Query(normalizeWeatherType(typ), q)
+	}
+	weatherJSON, err := json.Marshal(ret)
+	if err != nil {
+		log.Printf("Error sending weather JSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", weatherJSON)
+}
+
+func initWeatherStore(fname string) {
+	weatherReports = newWeatherStore(fname)
+	if err := weatherReports.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to load weather store %s: %s\n", fname, err.Error())
+	}
+	go weatherStoreSaver()
+}
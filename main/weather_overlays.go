@@ -0,0 +1,399 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	weather_overlays.go: Decoded FIS-B graphical overlays (AIRMET, SIGMET, TFR, SUA, ...) and their
+	 export as GeoJSON through /api/weather/overlays.geojson.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratux/stratux/common"
+	"github.com/stratux/stratux/uatparse"
+)
+
+// Overlay type by FIS-B product id.
+var overlayProductTypes = map[uint32]string{
+	8:  "NOTAM",
+	11: "AIRMET",
+	12: "SIGMET",
+	13: "SUA",
+	14: "G-AIRMET",
+	15: "CWA",
+	16: "NOTAM-TRA",
+	17: "NOTAM-TMOA",
+}
+
+// WeatherOverlay is one decoded graphical overlay record. Valid_from/Valid_to are zero if the
+// record doesn't specify them (UFN).
+type WeatherOverlay struct {
+	Product_id        uint32
+	Type              string
+	Location          string
+	Report_number     uint16
+	Report_year       uint16
+	Record_id         uint8
+	Object_type       uint8
+	Object_status     uint8
+	Geometry          string // "Polygon", "LineString" or "Point".
+	Points            []uatparse.GeoPoint
+	Alt_floor         int32 // Feet.
+	Alt_ceiling       int32 // Feet.
+	Alt_AGL           bool
+	Start             string // As sent: "MM-DD HH:MM", "DD HH:MM" or "HH:MM" (UTC).
+	End               string
+	Valid_from        time.Time
+	Valid_to          time.Time
+	LocaltimeReceived time.Time
+}
+
+func (o *WeatherOverlay) key() string {
+	return fmt.Sprintf("%d/%s/%d/%d/%d", o.Product_id, o.Location, o.Report_year, o.Report_number, o.Record_id)
+}
+
+// validAt returns true if the overlay is in effect at the given (UTC) time.
+func (o *WeatherOverlay) validAt(t time.Time) bool {
+	if !o.Valid_from.IsZero() && t.Before(o.Valid_from) {
+		return false
+	}
+	if !o.Valid_to.IsZero() && t.After(o.Valid_to) {
+		return false
+	}
+	return true
+}
+
+// bounds returns the bounding box of all vertices.
+func (o *WeatherOverlay) bounds() (minLat, minLon, maxLat, maxLon float64) {
+	for i, p := range o.Points {
+		if i == 0 || p.Lat < minLat {
+			minLat = p.Lat
+		}
+		if i == 0 || p.Lat > maxLat {
+			maxLat = p.Lat
+		}
+		if i == 0 || p.Lon < minLon {
+			minLon = p.Lon
+		}
+		if i == 0 || p.Lon > maxLon {
+			maxLon = p.Lon
+		}
+	}
+	return
+}
+
+// newWeatherOverlay builds an overlay from a decoded uatparse frame. Validity times are resolved
+// relative to now (UTC), since FIS-B only sends the day/month and time of day.
+func newWeatherOverlay(f *uatparse.UATFrame, now time.Time) (o WeatherOverlay, ok bool) {
+	if len(f.Points) == 0 {
+		return o, false
+	}
+	o.Product_id = f.Product_id
+	o.Type, ok = overlayProductTypes[f.Product_id]
+	if !ok {
+		o.Type = getProductNameFromId(int(f.Product_id))
+	}
+	o.Location = f.LocationIdentifier
+	o.Report_number = f.ReportNumber
+	o.Report_year = f.ReportYear
+	o.Record_id = f.OverlayRecordID
+	o.Object_type = f.ObjectType
+	o.Object_status = f.ObjectStatus
+	switch f.GeometryOption {
+	case 5, 6:
+		o.Geometry = "LineString"
+	case 9:
+		o.Geometry = "Point"
+	default:
+		o.Geometry = "Polygon"
+	}
+	o.Points = f.Points
+	o.Alt_floor = f.AltFloor
+	o.Alt_ceiling = f.AltCeiling
+	switch f.GeometryOption {
+	case 4, 6, 8, 9:
+		o.Alt_AGL = true
+	}
+	o.Start = f.ReportStart
+	o.End = f.ReportEnd
+	o.Valid_from, _ = parseOverlayTime(f.ReportStart, now)
+	o.Valid_to, _ = parseOverlayTime(f.ReportEnd, now)
+	return o, true
+}
+
+// parseOverlayTime resolves a FIS-B overlay date ("MM-DD HH:MM", "DD HH:MM" or "HH:MM", UTC) to the
+// point in time closest to now.
+func parseOverlayTime(s string, now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	var month, day, hour, min int
+	var candidates []time.Time
+	if n, _ := fmt.Sscanf(s, "%d-%d %d:%d", &month, &day, &hour, &min); n == 4 {
+		for y := now.Year() - 1; y <= now.Year()+1; y++ {
+			candidates = append(candidates, time.Date(y, time.Month(month), day, hour, min, 0, 0, time.UTC))
+		}
+	} else if n, _ := fmt.Sscanf(s, "%d %d:%d", &day, &hour, &min); n == 3 {
+		for m := int(now.Month()) - 1; m <= int(now.Month())+1; m++ {
+			candidates = append(candidates, time.Date(now.Year(), time.Month(m), day, hour, min, 0, 0, time.UTC))
+		}
+	} else if n, _ := fmt.Sscanf(s, "%d:%d", &hour, &min); n == 2 {
+		for d := now.Day() - 1; d <= now.Day()+1; d++ {
+			candidates = append(candidates, time.Date(now.Year(), now.Month(), d, hour, min, 0, 0, time.UTC))
+		}
+	} else {
+		return time.Time{}, false
+	}
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if math.Abs(c.Sub(now).Seconds()) < math.Abs(best.Sub(now).Seconds()) {
+			best = c
+		}
+	}
+	return best, true
+}
+
+// sameContent tells if two versions of a record are the same. Valid_from and Valid_to aren't compared, they
+// follow from Start and End and the date they were decoded on.
+func (o *WeatherOverlay) sameContent(other WeatherOverlay) bool {
+	if o.Geometry != other.Geometry || o.Object_type != other.Object_type || o.Object_status != other.Object_status ||
+		o.Alt_floor != other.Alt_floor || o.Alt_ceiling != other.Alt_ceiling || o.Alt_AGL != other.Alt_AGL ||
+		o.Start != other.Start || o.End != other.End || len(o.Points) != len(other.Points) {
+		return false
+	}
+	for i := range o.Points {
+		if o.Points[i] != other.Points[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AddOverlay stores an overlay, replacing an older version of the same record.
+func (store *weatherStore) AddOverlay(o WeatherOverlay) {
+	k := o.key()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	// Same record repeated by the FIS-B cycle - only update reception time.
+	if old, ok := store.overlays[k]; ok && old.sameContent(o) {
+		old.LocaltimeReceived = o.LocaltimeReceived
+		store.overlays[k] = old
+		return
+	}
+	store.overlays[k] = o
+	store.dirty = true
+}
+
+// pruneOverlays drops overlays that have expired or weren't repeated within their type's maximum age. The
+// reception age is on the stratuxClock (now), the end of validity is a UTC time from the uplink (utcNow).
+// Must be called with store.mu held.
+func (store *weatherStore) pruneOverlays(now, utcNow time.Time) {
+	for k, o := range store.overlays {
+		maxAge, ok := weatherMaxAge[normalizeWeatherType(o.Type)]
+		if !ok {
+			maxAge = weatherDefaultMaxAge
+		}
+		if now.Sub(o.LocaltimeReceived) > maxAge || (!o.Valid_to.IsZero() && utcNow.After(o.Valid_to)) {
+			delete(store.overlays, k)
+			store.dirty = true
+		}
+	}
+}
+
+// overlayMatches applies the station, bbox and radius filters of a weather query to an overlay.
+func (q *weatherQuery) overlayMatches(o WeatherOverlay) bool {
+	if len(q.Stations) > 0 {
+		found := false
+		for _, s := range q.Stations {
+			if strings.EqualFold(s, o.Location) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.HasBbox {
+		minLat, minLon, maxLat, maxLon := o.bounds()
+		if maxLat < q.MinLat || minLat > q.MaxLat {
+			return false
+		}
+		if q.MinLon <= q.MaxLon {
+			if maxLon < q.MinLon || minLon > q.MaxLon {
+				return false
+			}
+		} else if maxLon < q.MinLon && minLon > q.MaxLon { // Box crosses the antimeridian.
+			return false
+		}
+	}
+	if q.HasNear {
+		near := false
+		for _, p := range o.Points {
+			dist, _ := common.Distance(q.Lat, q.Lon, p.Lat, p.Lon)
+			if math.IsNaN(dist) || dist/1852.0 <= q.RadiusNm {
+				near = true
+				break
+			}
+		}
+		if !near {
+			return false
+		}
+	}
+	return true
+}
+
+// overlayProductMatches returns true if the overlay is one of the given products, by type name
+// ("AIRMET", "TFR", ...) or by FIS-B product id. An empty list matches everything.
+func overlayProductMatches(products []string, o WeatherOverlay) bool {
+	if len(products) == 0 {
+		return true
+	}
+	for _, p := range products {
+		if strings.EqualFold(p, o.Type) || p == strconv.Itoa(int(o.Product_id)) ||
+			normalizeWeatherType(p) == normalizeWeatherType(o.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlays returns all overlays valid at the given UTC time that match the query and product filter.
+func (store *weatherStore) Overlays(utcNow time.Time, q weatherQuery, products []string) []WeatherOverlay {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ret := make([]WeatherOverlay, 0)
+	for _, o := range store.overlays {
+		if o.validAt(utcNow) && overlayProductMatches(products, o) && q.overlayMatches(o) {
+			ret = append(ret, o)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key() < ret[j].key() })
+	return ret
+}
+
+// registerWeatherOverlay adds a decoded FIS-B graphical overlay to the store.
+func registerWeatherOverlay(f *uatparse.UATFrame) {
+	if weatherReports == nil {
+		return
+	}
+	o, ok := newWeatherOverlay(f, time.Now())
+	if !ok {
+		return
+	}
+	o.LocaltimeReceived = stratuxClock.Time
+	weatherReports.AddOverlay(o)
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Id         string                 `json:"id,omitempty"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+func geoJSONTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// geoJSON converts the overlay into a GeoJSON feature. Polygons are closed as the spec requires.
+func (o *WeatherOverlay) geoJSON() geoJSONFeature {
+	coords := make([][2]float64, 0, len(o.Points)+1)
+	for _, p := range o.Points {
+		coords = append(coords, [2]float64{p.Lon, p.Lat})
+	}
+	var geom geoJSONGeometry
+	switch {
+	case o.Geometry == "Point" || len(coords) == 1:
+		geom = geoJSONGeometry{Type: "Point", Coordinates: coords[0]}
+	case o.Geometry == "LineString" || len(coords) < 3:
+		geom = geoJSONGeometry{Type: "LineString", Coordinates: coords}
+	default:
+		if coords[0] != coords[len(coords)-1] {
+			coords = append(coords, coords[0])
+		}
+		geom = geoJSONGeometry{Type: "Polygon", Coordinates: [][][2]float64{coords}}
+	}
+	altRef := "MSL"
+	if o.Alt_AGL {
+		altRef = "AGL"
+	}
+	return geoJSONFeature{
+		Type:     "Feature",
+		Id:       o.key(),
+		Geometry: geom,
+		Properties: map[string]interface{}{
+			"product":       o.Type,
+			"product_id":    o.Product_id,
+			"location":      o.Location,
+			"report_number": o.Report_number,
+			"report_year":   o.Report_year,
+			"record_id":     o.Record_id,
+			"object_type":   o.Object_type,
+			"object_status": o.Object_status,
+			"alt_floor":     o.Alt_floor,
+			"alt_ceiling":   o.Alt_ceiling,
+			"alt_reference": altRef,
+			"valid_from":    geoJSONTime(o.Valid_from),
+			"valid_to":      geoJSONTime(o.Valid_to),
+		},
+	}
+}
+
+// AJAX call - /api/weather/overlays.geojson. Responds with all currently valid graphical FIS-B products as
+// a GeoJSON FeatureCollection. Optional filters: ?product=AIRMET,SIGMET,TFR (type names or product ids) plus
+// the ?station=, ?bbox= and ?near= filters of /api/weather/<type>.
+func handleWeatherOverlaysRequest(w http.ResponseWriter, r *http.Request) {
+	setNoCache(w)
+	setJSONHeaders(w)
+	w.Header().Set("Content-Type", "application/geo+json")
+	if weatherReports == nil {
+		http.Error(w, "weather store not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	values := r.URL.Query()
+	q, err := parseWeatherQuery(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var products []string
+	for _, p := range strings.Split(values.Get("product"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			products = append(products, p)
+		}
+	}
+
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0)}
+	for _, o := range weatherReports.Overlays(time.Now().UTC(), q, products) {
+		fc.Features = append(fc.Features, o.geoJSON())
+	}
+	overlaysJSON, err := json.Marshal(&fc)
+	if err != nil {
+		log.Printf("Error sending weather overlay GeoJSON data: %s\n", err.Error())
+	}
+	fmt.Fprintf(w, "%s\n", overlaysJSON)
+}
@@ -0,0 +1,273 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	weather_overlays_test.go: Unit tests for FIS-B graphical overlays and the GeoJSON export.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/uatparse"
+)
+
+func makeTestOverlayFrame(productId uint32, loc string, report uint16, geometry uint8, start, end string, points ...uatparse.GeoPoint) *uatparse.UATFrame {
+	return &uatparse.UATFrame{
+		Product_id:         productId,
+		LocationIdentifier: loc,
+		ReportNumber:       report,
+		ReportYear:         25,
+		OverlayRecordID:    1,
+		GeometryOption:     geometry,
+		Points:             points,
+		AltFloor:           0,
+		AltCeiling:         18000,
+		ReportStart:        start,
+		ReportEnd:          end,
+	}
+}
+
+var testOverlaySquare = []uatparse.GeoPoint{{Lat: 43, Lon: -89}, {Lat: 44, Lon: -89}, {Lat: 44, Lon: -88}, {Lat: 43, Lon: -88}}
+
+func TestParseOverlayTime(t *testing.T) {
+	now := time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC)
+	tests := []struct {
+		s    string
+		want time.Time
+		ok   bool
+	}{
+		{"01-01 12:00", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), true},
+		{"12-31 18:00", time.Date(2024, 12, 31, 18, 0, 0, 0, time.UTC), true},
+		{"31 23:00", time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC), true},
+		{"02 06:00", time.Date(2025, 1, 2, 6, 0, 0, 0, time.UTC), true},
+		{"23:30", time.Date(2024, 12, 31, 23, 30, 0, 0, time.UTC), true},
+		{"04:15", time.Date(2025, 1, 1, 4, 15, 0, 0, time.UTC), true},
+		{"", time.Time{}, false},
+		{"garbage", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseOverlayTime(tt.s, now)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseOverlayTime(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewWeatherOverlay(t *testing.T) {
+	now := time.Date(2025, 6, 13, 14, 0, 0, 0, time.UTC)
+	o, ok := newWeatherOverlay(makeTestOverlayFrame(8, "ZMP", 7, 8, "13 12:00", "13 18:00", testOverlaySquare...), now)
+	if !ok {
+		t.Fatal("newWeatherOverlay failed")
+	}
+	if o.Type != "NOTAM" || o.Geometry != "Polygon" || !o.Alt_AGL {
+		t.Errorf("overlay = %+v", o)
+	}
+	if !o.Valid_from.Equal(time.Date(2025, 6, 13, 12, 0, 0, 0, time.UTC)) || !o.Valid_to.Equal(time.Date(2025, 6, 13, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("validity = %v - %v", o.Valid_from, o.Valid_to)
+	}
+	if !o.validAt(now) || o.validAt(now.Add(5*time.Hour)) || o.validAt(now.Add(-3*time.Hour)) {
+		t.Error("validAt wrong")
+	}
+	if _, ok := newWeatherOverlay(makeTestOverlayFrame(11, "ZMP", 1, 3, "", ""), now); ok {
+		t.Error("overlay without points accepted")
+	}
+}
+
+func TestWeatherStoreOverlays(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now().UTC()
+	received := stratuxClock.Time
+
+	add := func(f *uatparse.UATFrame) {
+		o, _ := newWeatherOverlay(f, now)
+		o.LocaltimeReceived = received
+		store.AddOverlay(o)
+	}
+	add(makeTestOverlayFrame(11, "ZMP", 1, 3, "", "", testOverlaySquare...))
+	add(makeTestOverlayFrame(12, "ZDV", 2, 3, "", "", uatparse.GeoPoint{Lat: 39, Lon: -105}, uatparse.GeoPoint{Lat: 40, Lon: -105}, uatparse.GeoPoint{Lat: 40, Lon: -104}))
+	add(makeTestOverlayFrame(8, "ZMP", 3, 9, "", "", uatparse.GeoPoint{Lat: 43.9, Lon: -88.5}))
+	// Already expired.
+	expired := makeTestOverlayFrame(11, "ZMP", 4, 3, "", now.Add(-time.Hour).Format("15:04"), testOverlaySquare...)
+	add(expired)
+	// Repeated record doesn't duplicate.
+	add(makeTestOverlayFrame(11, "ZMP", 1, 3, "", "", testOverlaySquare...))
+
+	tests := []struct {
+		name     string
+		query    string
+		products []string
+		want     int
+	}{
+		{"All", "", nil, 3},
+		{"Product type", "", []string{"AIRMET"}, 1},
+		{"Product type alias", "", []string{"TFR"}, 1},
+		{"Product id", "", []string{"12"}, 1},
+		{"Bbox overlapping", "bbox=-88.6,43.8,-87,45", nil, 2},
+		{"Bbox outside", "bbox=-80,30,-70,35", nil, 0},
+		{"Near", "near=39.5,-104.5&radius=50", nil, 1},
+		{"Station", "station=zmp", nil, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/weather/overlays.geojson?"+tt.query, nil)
+			q, err := parseWeatherQuery(r.URL.Query())
+			if err != nil {
+				t.Fatalf("parseWeatherQuery: %v", err)
+			}
+			if got := store.Overlays(now, q, tt.products); len(got) != tt.want {
+				t.Errorf("got %d overlays, want %d: %+v", len(got), tt.want, got)
+			}
+		})
+	}
+
+	// Expired overlays and those not repeated in time are pruned.
+	store.Prune(now)
+	store.mu.Lock()
+	n := len(store.overlays)
+	store.mu.Unlock()
+	if n != 3 {
+		t.Errorf("%d overlays after prune, want 3", n)
+	}
+	store.Prune(received.Add(13 * time.Hour))
+	store.mu.Lock()
+	n = len(store.overlays)
+	store.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d overlays after prune, want 1 (NOTAM)", n)
+	}
+}
+
+func TestWeatherStoreOverlayAmended(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now().UTC()
+	o, _ := newWeatherOverlay(makeTestOverlayFrame(11, "ZMP", 1, 3, "", "", testOverlaySquare...), now)
+	o.LocaltimeReceived = stratuxClock.Time
+	store.AddOverlay(o)
+
+	// Same number of vertices, one moved, and new altitudes.
+	moved := append([]uatparse.GeoPoint(nil), testOverlaySquare...)
+	moved[2].Lat += 0.5
+	amended, _ := newWeatherOverlay(makeTestOverlayFrame(11, "ZMP", 1, 3, "", "", moved...), now)
+	amended.Alt_ceiling = o.Alt_ceiling + 2000
+	amended.LocaltimeReceived = stratuxClock.Time
+	store.AddOverlay(amended)
+
+	got := store.Overlays(now, weatherQuery{}, nil)
+	if len(got) != 1 || got[0].Points[2] != moved[2] || got[0].Alt_ceiling != amended.Alt_ceiling {
+		t.Errorf("amended overlay not stored: %+v", got)
+	}
+}
+
+// Valid_to is UTC, the reception time is on the stratuxClock, which starts at boot.
+func TestWeatherStoreOverlaysPruneClocks(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	utcNow := time.Date(2025, 6, 13, 14, 0, 0, 0, time.UTC)
+	boot := time.Time{}.Add(2 * time.Hour)
+	var keys []string
+	for i, end := range []string{"13:00", "15:00"} {
+		o, _ := newWeatherOverlay(makeTestOverlayFrame(11, "ZMP", uint16(i+1), 3, "", end, testOverlaySquare...), utcNow)
+		o.LocaltimeReceived = boot
+		store.AddOverlay(o)
+		keys = append(keys, o.key())
+	}
+	store.mu.Lock()
+	store.pruneOverlays(boot.Add(time.Minute), utcNow)
+	_, expired := store.overlays[keys[0]]
+	n := len(store.overlays)
+	store.mu.Unlock()
+	if expired || n != 1 {
+		t.Errorf("%d overlays after prune, expired one kept: %t", n, expired)
+	}
+}
+
+func TestWeatherStoreOverlaysSaveLoad(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	o, _ := newWeatherOverlay(makeTestOverlayFrame(11, "ZMP", 1, 3, "", "", testOverlaySquare...), time.Now())
+	o.LocaltimeReceived = stratuxClock.Time
+	store.AddOverlay(o)
+	if err := store.Save(stratuxClock.Time, time.Now()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := newWeatherStore(store.file)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	loaded.restore(stratuxClock.Time, time.Now())
+	if got := loaded.Overlays(time.Now().UTC(), weatherQuery{}, nil); len(got) != 1 || len(got[0].Points) != 4 {
+		t.Errorf("loaded overlays = %+v", got)
+	}
+}
+
+func TestHandleWeatherOverlaysRequest(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	orig := weatherReports
+	weatherReports = store
+	defer func() { weatherReports = orig }()
+
+	for _, f := range []*uatparse.UATFrame{
+		makeTestOverlayFrame(11, "ZMP", 1, 3, "", "", testOverlaySquare...),
+		makeTestOverlayFrame(12, "ZMP", 2, 5, "", "", testOverlaySquare[:2]...),
+		makeTestOverlayFrame(8, "ZMP", 3, 9, "", "", uatparse.GeoPoint{Lat: 43.9, Lon: -88.5}),
+	} {
+		registerWeatherOverlay(f)
+	}
+
+	w := httptest.NewRecorder()
+	handleWeatherOverlaysRequest(w, httptest.NewRequest("GET", "/api/weather/overlays.geojson", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var fc struct {
+		Type     string
+		Features []struct {
+			Type     string
+			Geometry struct {
+				Type        string
+				Coordinates json.RawMessage
+			}
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &fc); err != nil {
+		t.Fatalf("invalid JSON: %v: %s", err, w.Body.String())
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 3 {
+		t.Fatalf("unexpected collection: %s", w.Body.String())
+	}
+	geoms := make(map[string]json.RawMessage)
+	for _, f := range fc.Features {
+		geoms[f.Geometry.Type] = f.Geometry.Coordinates
+		if f.Properties["alt_ceiling"] != 18000.0 || f.Properties["valid_to"] != nil {
+			t.Errorf("properties = %v", f.Properties)
+		}
+	}
+	var ring [][][2]float64
+	if err := json.Unmarshal(geoms["Polygon"], &ring); err != nil || len(ring) != 1 || len(ring[0]) != 5 || ring[0][0] != ring[0][4] {
+		t.Errorf("polygon not closed: %s", geoms["Polygon"])
+	} else if ring[0][0] != [2]float64{-89, 43} {
+		t.Errorf("coordinates not lon,lat: %v", ring[0][0])
+	}
+	if _, ok := geoms["LineString"]; !ok {
+		t.Error("LineString missing")
+	}
+	if string(geoms["Point"]) != "[-88.5,43.9]" {
+		t.Errorf("Point = %s", geoms["Point"])
+	}
+
+	w = httptest.NewRecorder()
+	handleWeatherOverlaysRequest(w, httptest.NewRequest("GET", "/api/weather/overlays.geojson?bbox=1,2,3", nil))
+	if w.Code != 400 {
+		t.Errorf("invalid bbox: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,447 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	weather_test.go: Unit tests for the FIS-B weather store and /api/weather queries.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupWeatherTest installs a small airport db and returns an empty store writing to a temp dir.
+func setupWeatherTest(t *testing.T) (*weatherStore, func()) {
+	if stratuxClock == nil {
+		stratuxClock = NewMonotonic()
+		time.Sleep(20 * time.Millisecond)
+	}
+	tmpDir, err := ioutil.TempDir("", "stratux-weather-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	csv := `"id","ident","type","name","latitude_deg","longitude_deg","elevation_ft","gps_code"
+1,"KOSH","medium_airport","Wittman Regional",43.9844,-88.557,808,"KOSH"
+2,"KMSN","medium_airport","Dane County Regional",43.1399,-89.3375,887,"KMSN"
+3,"KDEN","large_airport","Denver Intl",39.8617,-104.6731,5434,"KDEN"
+4,"WI99","heliport","Some Heliport",43.99,-88.56,800,""
+`
+	airportDbMutex.Lock()
+	airportDb, err = parseAirportCSV(strings.NewReader(csv))
+	airportDbLoaded = true
+	airportDbMutex.Unlock()
+	if err != nil {
+		t.Fatalf("parseAirportCSV failed: %v", err)
+	}
+	store := newWeatherStore(filepath.Join(tmpDir, weatherStoreFile))
+	return store, func() {
+		os.RemoveAll(tmpDir)
+		airportDbMutex.Lock()
+		airportDb = nil
+		airportDbLoaded = false
+		airportDbMutex.Unlock()
+	}
+}
+
+func makeTestReport(typ, loc, tm, data string, received time.Time) WeatherReport {
+	var r WeatherReport
+	r.Type = typ
+	r.Location = loc
+	r.Time = tm
+	r.Data = data
+	r.LocaltimeReceived = received
+	r.locate(0, 0, false)
+	return r
+}
+
+// TestParseAirportCSV tests column lookup by header name and gps_code aliases
+func TestParseAirportCSV(t *testing.T) {
+	csv := `"ident","name","latitude_deg","longitude_deg","type","gps_code"
+"06C","Schaumburg Regional",41.989,-88.101,"small_airport","KO6C"
+"XXXX","Closed field",1,1,"closed",""
+"BAD","Bad coords","x","y","small_airport",""
+`
+	db, err := parseAirportCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("parseAirportCSV failed: %v", err)
+	}
+	if len(db) != 2 {
+		t.Errorf("Expected 2 entries (ident + gps_code), got %d", len(db))
+	}
+	if apt, ok := db["KO6C"]; !ok || apt.Ident != "06C" {
+		t.Errorf("gps_code alias not found: %+v", apt)
+	}
+	if _, ok := db["XXXX"]; ok {
+		t.Errorf("Closed airport should be skipped")
+	}
+}
+
+// TestLookupAirport tests identifier lookup including 3-letter US identifiers
+func TestLookupAirport(t *testing.T) {
+	_, cleanup := setupWeatherTest(t)
+	defer cleanup()
+
+	if apt, ok := lookupAirport("kosh"); !ok || apt.Name != "Wittman Regional" {
+		t.Errorf("lookupAirport(kosh) = %+v, %v", apt, ok)
+	}
+	if _, ok := lookupAirport("MSN"); !ok {
+		t.Errorf("lookupAirport(MSN) should resolve to KMSN")
+	}
+	if _, ok := lookupAirport("ZZZZ"); ok {
+		t.Errorf("lookupAirport(ZZZZ) should fail")
+	}
+}
+
+// TestFindNearestAirport tests nearest airport search and heliport filtering
+func TestFindNearestAirport(t *testing.T) {
+	_, cleanup := setupWeatherTest(t)
+	defer cleanup()
+
+	apt, dist, ok := findNearestAirport(43.99, -88.56, 10, false)
+	if !ok || apt.Ident != "KOSH" {
+		t.Errorf("Expected KOSH, got %+v (ok=%v)", apt, ok)
+	}
+	if dist > 1.0 {
+		t.Errorf("Expected distance < 1nm, got %f", dist)
+	}
+	apt, _, ok = findNearestAirport(43.99, -88.56, 10, true)
+	if !ok || apt.Ident != "WI99" {
+		t.Errorf("Expected heliport WI99 with includeAll, got %+v", apt)
+	}
+	if _, _, ok = findNearestAirport(0, 0, 50, true); ok {
+		t.Errorf("Expected no airport near 0,0")
+	}
+}
+
+// TestNormalizeWeatherType tests mapping of FIS-B report types to store categories
+func TestNormalizeWeatherType(t *testing.T) {
+	tests := map[string]string{
+		"METAR":   "METAR",
+		"SPECI":   "METAR",
+		"TAF.AMD": "TAF",
+		"taf":     "TAF",
+		"PIREP":   "PIREP",
+		"WINDS":   "WINDS",
+		"NOTAM":   "NOTAM",
+		"WST":     "SIGMET",
+		"OTHER":   "OTHER",
+	}
+	for in, expected := range tests {
+		if got := normalizeWeatherType(in); got != expected {
+			t.Errorf("normalizeWeatherType(%s) = %s, expected %s", in, got, expected)
+		}
+	}
+}
+
+// TestWeatherStoreAddReplace tests that only the latest report per station is kept
+func TestWeatherStoreAddReplace(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+
+	store.Add(makeTestReport("METAR", "KOSH", "121753Z", "AUTO 27010KT 10SM CLR", now.Add(-time.Hour)))
+	store.Add(makeTestReport("SPECI", "KOSH", "121853Z", "AUTO 27015G25KT 3SM BR", now))
+	store.Add(makeTestReport("TAF", "KOSH", "121720Z", "1218/1318 27010KT P6SM", now))
+
+	metars := store.Query("METAR", weatherQuery{})
+	if len(metars) != 1 {
+		t.Fatalf("Expected 1 METAR, got %d", len(metars))
+	}
+	if metars[0].Time != "121853Z" || metars[0].Type != "SPECI" {
+		t.Errorf("Expected newer SPECI to replace METAR, got %+v", metars[0])
+	}
+	if !metars[0].Position_valid || metars[0].Position_src != "airport" {
+		t.Errorf("Expected position from airport db, got %+v", metars[0])
+	}
+	if all := store.Query("", weatherQuery{}); len(all) != 2 {
+		t.Errorf("Expected 2 reports in total, got %d", len(all))
+	}
+}
+
+// TestWeatherStoreRepeatedReport tests that an identical repeat only refreshes the receive time
+func TestWeatherStoreRepeatedReport(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+
+	store.Add(makeTestReport("METAR", "KMSN", "121853Z", "27010KT", now.Add(-5*time.Minute)))
+	store.dirty = false
+	store.Add(makeTestReport("METAR", "KMSN", "121853Z", "27010KT", now))
+	if store.dirty {
+		t.Errorf("Repeated report should not mark the store dirty")
+	}
+	if r := store.Query("METAR", weatherQuery{}); !r[0].LocaltimeReceived.Equal(now) {
+		t.Errorf("Receive time not refreshed: %v", r[0].LocaltimeReceived)
+	}
+}
+
+// TestWeatherStorePrune tests expiry of old reports per type
+func TestWeatherStorePrune(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+
+	store.Add(makeTestReport("METAR", "KOSH", "120553Z", "old", now.Add(-4*time.Hour)))
+	store.Add(makeTestReport("TAF", "KOSH", "120520Z", "still valid", now.Add(-4*time.Hour)))
+	store.Add(makeTestReport("METAR", "KMSN", "120853Z", "new", now))
+	store.Prune(now)
+
+	if r := store.Query("METAR", weatherQuery{}); len(r) != 1 || r[0].Location != "KMSN" {
+		t.Errorf("Expected only KMSN METAR after prune, got %+v", r)
+	}
+	if r := store.Query("TAF", weatherQuery{}); len(r) != 1 {
+		t.Errorf("TAF should survive 4 hours, got %d", len(r))
+	}
+}
+
+// TestWeatherQueryFilters tests station, bbox and radius queries
+func TestWeatherQueryFilters(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+
+	store.Add(makeTestReport("METAR", "KOSH", "121853Z", "a", now))
+	store.Add(makeTestReport("METAR", "KMSN", "121853Z", "b", now))
+	store.Add(makeTestReport("METAR", "KDEN", "121853Z", "c", now))
+	store.Add(makeTestReport("METAR", "KUNK", "121853Z", "no position", now))
+
+	tests := []struct {
+		name     string
+		params   map[string][]string
+		expected []string
+	}{
+		{"station", map[string][]string{"station": {"kosh"}}, []string{"KOSH"}},
+		{"station list", map[string][]string{"station": {"KOSH,KDEN"}}, []string{"KDEN", "KOSH"}},
+		{"bbox wisconsin", map[string][]string{"bbox": {"-92,42,-87,47"}}, []string{"KMSN", "KOSH"}},
+		{"near oshkosh default radius", map[string][]string{"near": {"44.0,-88.5"}}, []string{"KOSH"}},
+		{"near oshkosh 100nm", map[string][]string{"near": {"44.0,-88.5"}, "radius": {"100"}}, []string{"KMSN", "KOSH"}},
+		{"no filter", map[string][]string{}, []string{"KDEN", "KMSN", "KOSH", "KUNK"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := parseWeatherQuery(tc.params)
+			if err != nil {
+				t.Fatalf("parseWeatherQuery failed: %v", err)
+			}
+			res := store.Query("METAR", q)
+			locs := make([]string, 0)
+			for _, r := range res {
+				locs = append(locs, r.Location)
+			}
+			if len(locs) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, locs)
+			}
+			for _, e := range tc.expected {
+				if !strings.Contains(strings.Join(locs, ","), e) {
+					t.Errorf("Expected %s in %v", e, locs)
+				}
+			}
+		})
+	}
+}
+
+// TestParseWeatherQueryErrors tests rejection of malformed parameters
+func TestParseWeatherQueryErrors(t *testing.T) {
+	bad := []map[string][]string{
+		{"bbox": {"1,2,3"}},
+		{"bbox": {"-92,47,-87,42"}},
+		{"near": {"abc,def"}},
+		{"near": {"44,-88"}, "radius": {"-5"}},
+	}
+	for _, params := range bad {
+		if _, err := parseWeatherQuery(params); err == nil {
+			t.Errorf("Expected error for %v", params)
+		}
+	}
+}
+
+// TestWeatherBboxAntimeridian tests boxes crossing 180 degrees longitude
+func TestWeatherBboxAntimeridian(t *testing.T) {
+	q := weatherQuery{HasBbox: true, MinLon: 170, MinLat: -50, MaxLon: -170, MaxLat: -30}
+	inside := WeatherReport{Lat: -40, Lon: 175, Position_valid: true}
+	outside := WeatherReport{Lat: -40, Lon: 0, Position_valid: true}
+	if !q.matches(inside) {
+		t.Errorf("Expected lon 175 inside antimeridian box")
+	}
+	if q.matches(outside) {
+		t.Errorf("Expected lon 0 outside antimeridian box")
+	}
+}
+
+// TestWeatherStoreNEXRAD tests NEXRAD reception tracking
+func TestWeatherStoreNEXRAD(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+
+	store.AddNEXRAD(63, now.Add(-15*time.Minute))
+	store.AddNEXRAD(63, now.Add(-2*time.Minute))
+	store.AddNEXRAD(64, now.Add(-1*time.Minute))
+	store.AddNEXRAD(413, now) // Not NEXRAD.
+	store.Prune(now)
+
+	st := store.NEXRAD(now)
+	if len(st) != 2 {
+		t.Fatalf("Expected 2 NEXRAD products, got %d", len(st))
+	}
+	if st[1].Product != "Regional" || st[1].Age_seconds != 120 || st[1].Blocks_last_cycle != 1 {
+		t.Errorf("Unexpected regional status: %+v", st[1])
+	}
+}
+
+// TestWeatherStoreSaveLoad tests persistence across restarts
+func TestWeatherStoreSaveLoad(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+	gpsTime := time.Date(2025, 6, 12, 19, 0, 0, 0, time.UTC)
+
+	store.Add(makeTestReport("METAR", "KOSH", "121853Z", "27010KT", now))
+	store.Add(makeTestReport("PIREP", "KMSN", "121840Z", "OV MSN FL080 TB MOD", now.Add(-4*time.Hour)))
+	store.AddNEXRAD(64, now)
+	if err := store.Save(now, time.Time{}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(store.file); !os.IsNotExist(err) {
+		t.Fatalf("Saved without GPS time: %v", err)
+	}
+	if err := store.Save(now, gpsTime); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// The clock of the next run starts over, an hour later.
+	later := now.Add(-10 * time.Hour)
+	restored := newWeatherStore(store.file)
+	if err := restored.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if r := restored.Query("", weatherQuery{}); len(r) != 0 {
+		t.Errorf("Reports before the GPS time is known: %+v", r)
+	}
+	restored.Add(makeTestReport("METAR", "KMSN", "122000Z", "VRB03KT", later))
+	restored.restore(later, gpsTime.Add(time.Hour))
+	r := restored.Query("METAR", weatherQuery{})
+	if len(r) != 2 || r[0].Location != "KMSN" || r[1].Location != "KOSH" || !r[1].LocaltimeReceived.Equal(later.Add(-time.Hour)) {
+		t.Errorf("Expected the KOSH METAR from an hour ago and the new KMSN METAR after the reload, got %+v", r)
+	}
+	if r := restored.Query("PIREP", weatherQuery{}); len(r) != 0 {
+		t.Errorf("Expected the old PIREP to be dropped, got %+v", r)
+	}
+	if n := restored.NEXRAD(later); len(n) != 1 || n[0].Product != "CONUS" || n[0].Age_seconds != 3600 {
+		t.Errorf("Expected CONUS NEXRAD status after reload, got %+v", n)
+	}
+}
+
+// TestWeatherStoreLoadStale tests that reports saved days ago don't come back as current, whatever the clock
+func TestWeatherStoreLoadStale(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	now := time.Now()
+	gpsTime := time.Date(2025, 6, 12, 19, 0, 0, 0, time.UTC)
+
+	store.Add(makeTestReport("METAR", "KOSH", "121853Z", "27010KT A3002", now))
+	store.Add(makeTestReport("TAF", "KOSH", "121720Z", "27010KT", now))
+	if err := store.Save(now, gpsTime); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	restored := newWeatherStore(store.file)
+	if err := restored.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	// Without RTC the clock resumes right where it stopped.
+	restored.restore(now.Add(time.Minute), gpsTime.Add(2*24*time.Hour))
+	if r := restored.Query("", weatherQuery{}); len(r) != 0 {
+		t.Errorf("Expected the reports from two days ago to be dropped, got %+v", r)
+	}
+	if _, ok := nearestMETARAltimeter(restored, 43.9, -88.5, now.Add(time.Minute)); ok {
+		t.Error("Altimeter setting from a METAR two days old")
+	}
+}
+
+// TestSendStoredWeather tests replay of the store to new websocket clients
+func TestSendStoredWeather(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	oldStore := weatherReports
+	weatherReports = store
+	defer func() { weatherReports = oldStore }()
+	now := time.Now()
+
+	store.Add(makeTestReport("METAR", "KOSH", "121853Z", "a", now.Add(-time.Minute)))
+	store.Add(makeTestReport("TAF", "KOSH", "121720Z", "b", now))
+
+	var mu sync.Mutex
+	msgs := make([]WeatherMessage, 0)
+	sendStoredWeather(func(b []byte) error {
+		var wm WeatherMessage
+		if err := json.Unmarshal(b, &wm); err != nil {
+			t.Errorf("Invalid JSON sent: %s", b)
+		}
+		mu.Lock()
+		msgs = append(msgs, wm)
+		mu.Unlock()
+		return nil
+	})
+	if len(msgs) != 2 || msgs[0].Type != "METAR" || msgs[1].Type != "TAF" {
+		t.Errorf("Expected METAR then TAF, got %+v", msgs)
+	}
+}
+
+// TestHandleWeatherAPIRequest tests the /api/weather/ HTTP handler
+func TestHandleWeatherAPIRequest(t *testing.T) {
+	store, cleanup := setupWeatherTest(t)
+	defer cleanup()
+	oldStore := weatherReports
+	weatherReports = store
+	defer func() { weatherReports = oldStore }()
+
+	store.Add(makeTestReport("METAR", "KOSH", "121853Z", "a", stratuxClock.Time))
+	store.Add(makeTestReport("TAF", "KMSN", "121720Z", "b", stratuxClock.Time))
+	store.AddNEXRAD(63, stratuxClock.Time)
+
+	req := httptest.NewRequest("GET", "/api/weather/metar?station=KOSH", nil)
+	w := httptest.NewRecorder()
+	handleWeatherAPIRequest(w, req)
+	var reports []WeatherReport
+	if err := json.Unmarshal(w.Body.Bytes(), &reports); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Location != "KOSH" || reports[0].Lat == 0 {
+		t.Errorf("Unexpected response: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/weather/all", nil)
+	w = httptest.NewRecorder()
+	handleWeatherAPIRequest(w, req)
+	json.Unmarshal(w.Body.Bytes(), &reports)
+	if len(reports) != 2 {
+		t.Errorf("Expected 2 reports for /all, got %d", len(reports))
+	}
+
+	req = httptest.NewRequest("GET", "/api/weather/nexrad", nil)
+	w = httptest.NewRecorder()
+	handleWeatherAPIRequest(w, req)
+	var nexrad []NEXRADStatus
+	json.Unmarshal(w.Body.Bytes(), &nexrad)
+	if len(nexrad) != 1 || nexrad[0].Product != "Regional" {
+		t.Errorf("Unexpected NEXRAD response: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/weather/metar?bbox=1,2", nil)
+	w = httptest.NewRecorder()
+	handleWeatherAPIRequest(w, req)
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for malformed bbox, got %d", w.Code)
+	}
+}
@@ -0,0 +1,299 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	wind.go: Wind estimation. While circling, the GPS ground velocity describes a circle around the wind vector
+	 with the true airspeed as radius, a full circle gives a fit. In straight flight the wind is the difference
+	 between ground velocity and air velocity, from the magnetometer heading and the entered true airspeed (or
+	 the one found while circling). The GPS only AHRS heading follows the track and can't be used for that.
+	 The result is in mySituation.Wind* and goes out in $LXWP0, see vario.go.
+*/
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	windSampleInterval = 200 * time.Millisecond
+	windMinSpeed       = 20.0 // kts, below that the track is no good and we're probably on the ground
+	windCirclingRate   = 4.0  // deg/s of track change to count as circling
+	windStraightRate   = 2.0  // deg/s of track change still considered straight flight
+	windRateTau        = 1.0  // s, smoothing of the track change rate against GPS noise
+	windTurnPause      = 3 * time.Second
+	windMaxGap         = 3 * time.Second
+	windMinPoints      = 8
+	windCirclingHold   = 5 * time.Minute // A circling estimate beats the straight flight estimate this long.
+	windCirclingTAS    = 30 * time.Minute
+	windStraightTau    = 30.0 // s, smoothing of the straight flight estimate
+	windStraightMin    = 30.0 // s of straight flight before its estimate is published
+	windMaxAge         = 30 * time.Minute
+
+	WIND_METHOD_CIRCLING = "circling"
+	WIND_METHOD_STRAIGHT = "straight"
+)
+
+// windSample is a GPS fix for the wind estimator, heading only with a magnetometer.
+type windSample struct {
+	time         time.Time
+	groundSpeed  float64 // kts
+	track        float64 // degrees true
+	heading      float64 // degrees true
+	headingValid bool
+}
+
+// windVector returns the east and north components of a speed in a direction.
+func windVector(speed, direction float64) (x, y float64) {
+	s, c := math.Sincos(common.Radians(direction))
+	return speed * s, speed * c
+}
+
+type windEstimator struct {
+	last windSample
+	rate float64 // Smoothed track change, deg/s.
+
+	// Circling.
+	circle   [][2]float64 // Ground velocities of the current circle, east and north kts.
+	turned   float64      // Track change of the current circle, degrees, positive to the right.
+	lastTurn time.Time
+	tas      float64 // Radius of the last fit, kts.
+	tasTime  time.Time
+
+	// Straight flight.
+	straightX, straightY float64
+	straightTime         float64 // s
+
+	// Current estimate, the vector the wind blows to.
+	x, y         float64
+	quality      uint8 // 0 no estimate, 1 (poor) to 5
+	method       string
+	updated      time.Time
+	circlingTime time.Time // Last circling estimate.
+}
+
+// update adds a fix. tasSetting is the entered true airspeed, 0 if none. It returns whether the estimate changed.
+func (w *windEstimator) update(s windSample, tasSetting float64) bool {
+	last := w.last
+	w.last = s
+	if s.groundSpeed < windMinSpeed || last.time.IsZero() || last.groundSpeed < windMinSpeed ||
+		!s.time.After(last.time) || s.time.Sub(last.time) > windMaxGap {
+		w.circle, w.turned, w.rate = nil, 0, 0
+		if s.time.Sub(last.time) > windMaxGap {
+			w.straightTime = 0
+		}
+		return false
+	}
+	dt := s.time.Sub(last.time).Seconds()
+	diff := math.Mod(s.track-last.track+540, 360) - 180
+	w.rate += dt / (windRateTau + dt) * (diff/dt - w.rate)
+	rate := w.rate
+	vx, vy := windVector(s.groundSpeed, s.track)
+
+	changed := false
+	turning := math.Abs(rate) >= windCirclingRate
+	if turning && w.turned*rate < 0 {
+		// Reversed the turn, start over.
+		w.circle, w.turned = nil, 0
+	}
+	// Fixes with a slower track change still are on the circle.
+	if turning || (len(w.circle) > 0 && s.time.Sub(w.lastTurn) <= windTurnPause) {
+		if len(w.circle) == 0 {
+			lx, ly := windVector(last.groundSpeed, last.track)
+			w.circle = append(w.circle, [2]float64{lx, ly})
+		}
+		w.circle = append(w.circle, [2]float64{vx, vy})
+		w.turned += diff
+		if turning {
+			w.lastTurn = s.time
+		}
+		if math.Abs(w.turned) >= 360 {
+			changed = w.fitCircle(s.time)
+			w.circle, w.turned = [][2]float64{{vx, vy}}, 0
+		}
+	} else {
+		w.circle, w.turned = nil, 0
+	}
+
+	if math.Abs(rate) < windStraightRate && s.headingValid {
+		tas, quality := tasSetting, uint8(2)
+		if tas <= 0 && !w.tasTime.IsZero() && s.time.Sub(w.tasTime) < windCirclingTAS {
+			tas, quality = w.tas, 1
+		}
+		if tas >= windMinSpeed {
+			ax, ay := windVector(tas, s.heading)
+			if w.straightTime == 0 {
+				w.straightX, w.straightY = vx-ax, vy-ay
+			} else {
+				a := dt / (windStraightTau + dt)
+				w.straightX += a * (vx - ax - w.straightX)
+				w.straightY += a * (vy - ay - w.straightY)
+			}
+			w.straightTime += dt
+			if w.straightTime >= windStraightMin && (w.circlingTime.IsZero() || s.time.Sub(w.circlingTime) > windCirclingHold) {
+				w.x, w.y, w.quality, w.method, w.updated = w.straightX, w.straightY, quality, WIND_METHOD_STRAIGHT, s.time
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// fitCircle fits the wind to the current circle.
+func (w *windEstimator) fitCircle(t time.Time) bool {
+	cx, cy, r, rms, ok := fitWindCircle(w.circle)
+	if !ok || math.Hypot(cx, cy) >= r {
+		return false
+	}
+	quality := windCircleQuality(rms, r)
+	if quality == 0 {
+		return false
+	}
+	if w.method == WIND_METHOD_CIRCLING && t.Sub(w.circlingTime) < windCirclingHold {
+		// Average with the previous circle, weighted by quality.
+		qn, qp := float64(quality), float64(w.quality)
+		cx = (cx*qn + w.x*qp) / (qn + qp)
+		cy = (cy*qn + w.y*qp) / (qn + qp)
+	}
+	w.x, w.y, w.quality, w.method, w.updated, w.circlingTime = cx, cy, quality, WIND_METHOD_CIRCLING, t, t
+	w.tas, w.tasTime = r, t
+	// Straight flight continues from here.
+	w.straightX, w.straightY = cx, cy
+	return true
+}
+
+// wind returns where the wind comes from (degrees true), its speed (kts) and quality, 0 without an estimate.
+func (w *windEstimator) wind(now time.Time) (direction, speed float64, quality uint8) {
+	if w.quality == 0 || now.Sub(w.updated) > windMaxAge {
+		return 0, 0, 0
+	}
+	direction = math.Mod(common.Degrees(math.Atan2(w.x, w.y))+180+360, 360)
+	return direction, math.Hypot(w.x, w.y), w.quality
+}
+
+// fitWindCircle is a least squares circle fit (Kåsa) to the points, returning the center, radius and RMS
+// distance of the points from the circle.
+func fitWindCircle(points [][2]float64) (cx, cy, r, rms float64, ok bool) {
+	if len(points) < windMinPoints {
+		return
+	}
+	// Solve for x²+y² + D x + E y + F = 0, relative to the mean for numerical stability.
+	var mx, my float64
+	for _, p := range points {
+		mx += p[0]
+		my += p[1]
+	}
+	n := float64(len(points))
+	mx, my = mx/n, my/n
+	var sxx, sxy, syy, sxz, syz, sz float64
+	for _, p := range points {
+		x, y := p[0]-mx, p[1]-my
+		z := x*x + y*y
+		sxx += x * x
+		sxy += x * y
+		syy += y * y
+		sxz += x * z
+		syz += y * z
+		sz += z
+	}
+	// With centered points the normal equations for D and E don't depend on F.
+	det := sxx*syy - sxy*sxy
+	if math.Abs(det) < 1e-9 {
+		return
+	}
+	d := (-sxz*syy + syz*sxy) / det
+	e := (-syz*sxx + sxz*sxy) / det
+	f := -sz / n
+	cx, cy = -d/2, -e/2
+	r2 := cx*cx + cy*cy - f
+	if r2 <= 0 {
+		return
+	}
+	r = math.Sqrt(r2)
+	for _, p := range points {
+		dr := math.Hypot(p[0]-mx-cx, p[1]-my-cy) - r
+		rms += dr * dr
+	}
+	return cx + mx, cy + my, r, math.Sqrt(rms / n), true
+}
+
+// windCircleQuality rates a fit by how round the circle was, 0 for no good.
+func windCircleQuality(rms, r float64) uint8 {
+	switch rel := rms / r; {
+	case rel < 0.03:
+		return 5
+	case rel < 0.06:
+		return 4
+	case rel < 0.1:
+		return 3
+	case rel < 0.15:
+		return 2
+	case rel < 0.25:
+		return 1
+	}
+	return 0
+}
+
+var windEstimate windEstimator
+
+// windCurrent is a copy of the estimate in mySituation. It has its own mutex, sendVarioNMEA() is also called from
+// the NMEA parser with muGPS held.
+var windCurrent struct {
+	mu        sync.Mutex
+	direction float64
+	speed     float64
+	valid     bool
+}
+
+// currentWind returns the last wind estimate.
+func currentWind() (direction, speed float64, valid bool) {
+	windCurrent.mu.Lock()
+	defer windCurrent.mu.Unlock()
+	return windCurrent.direction, windCurrent.speed, windCurrent.valid
+}
+
+func windEstimatorLoop() {
+	ticker := time.NewTicker(windSampleInterval)
+	var lastFix time.Time
+	for range ticker.C {
+		mySituation.muAttitude.Lock()
+		magHeading := mySituation.AHRSMagHeading
+		headingValid := !isAHRSInvalidValue(magHeading) && stratuxClock.Since(mySituation.AHRSLastAttitudeTime) < time.Second
+		mySituation.muAttitude.Unlock()
+
+		mySituation.muGPS.Lock()
+		if isGPSValid() && mySituation.GPSLastGroundTrackTime.After(lastFix) {
+			lastFix = mySituation.GPSLastGroundTrackTime
+			s := windSample{
+				time:        mySituation.GPSLastGroundTrackTime,
+				groundSpeed: mySituation.GPSGroundSpeed,
+				track:       float64(mySituation.GPSTrueCourse),
+			}
+			if decl, ok := currentDeclination(); ok && headingValid {
+				s.heading, s.headingValid = common.MagneticToTrue(magHeading, decl), true
+			}
+			windEstimate.update(s, float64(globalSettings.WindTAS))
+		}
+		direction, speed, quality := windEstimate.wind(stratuxClock.Time)
+		mySituation.WindDirection, mySituation.WindSpeed, mySituation.WindQuality = direction, speed, quality
+		mySituation.WindMethod = ""
+		if quality > 0 {
+			mySituation.WindMethod = windEstimate.method
+		}
+		mySituation.muGPS.Unlock()
+
+		windCurrent.mu.Lock()
+		windCurrent.direction, windCurrent.speed, windCurrent.valid = direction, speed, quality > 0
+		windCurrent.mu.Unlock()
+	}
+}
+
+func initWindEstimator() {
+	go windEstimatorLoop()
+}
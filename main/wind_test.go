@@ -0,0 +1,194 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	wind_test.go: Unit tests for the wind estimator
+*/
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+// windFlight flies with a true airspeed through a wind, 5 GPS fixes per second.
+type windFlight struct {
+	w                 windEstimator
+	r                 *rand.Rand
+	t                 time.Time
+	heading           float64 // degrees true
+	tas               float64 // kts
+	windFrom, windKts float64
+	noise             float64 // kts
+	magnetometer      bool
+	headingError      float64 // degrees
+	tasSetting        float64
+}
+
+func newWindFlight(windFrom, windKts float64) *windFlight {
+	return &windFlight{r: rand.New(rand.NewSource(1)), t: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), tas: 50,
+		windFrom: windFrom, windKts: windKts}
+}
+
+// fly for seconds turning at rate degrees per second.
+func (f *windFlight) fly(seconds, rate float64) {
+	const dt = 0.2
+	for i := 0; i < int(seconds/dt); i++ {
+		f.t = f.t.Add(200 * time.Millisecond)
+		f.heading = math.Mod(f.heading+rate*dt+360, 360)
+		ax, ay := windVector(f.tas, f.heading)
+		wx, wy := windVector(f.windKts, f.windFrom+180)
+		gx, gy := ax+wx+f.r.NormFloat64()*f.noise, ay+wy+f.r.NormFloat64()*f.noise
+		f.w.update(windSample{
+			time:         f.t,
+			groundSpeed:  math.Hypot(gx, gy),
+			track:        math.Mod(common.Degrees(math.Atan2(gx, gy))+360, 360),
+			heading:      math.Mod(f.heading+f.headingError+360, 360),
+			headingValid: f.magnetometer,
+		}, f.tasSetting)
+	}
+}
+
+func TestFitWindCircle(t *testing.T) {
+	var points [][2]float64
+	for a := 0.0; a < 360; a += 30 {
+		x, y := windVector(50, a)
+		points = append(points, [2]float64{x + 10, y - 5})
+	}
+	cx, cy, r, rms, ok := fitWindCircle(points)
+	if !ok || math.Abs(cx-10) > 1e-9 || math.Abs(cy+5) > 1e-9 || math.Abs(r-50) > 1e-9 || rms > 1e-9 {
+		t.Errorf("circle %f %f r %f rms %f", cx, cy, r, rms)
+	}
+	if _, _, _, _, ok := fitWindCircle(points[:windMinPoints-1]); ok {
+		t.Errorf("fit with %d points", windMinPoints-1)
+	}
+	// All on a line.
+	if _, _, _, _, ok := fitWindCircle([][2]float64{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {0, 5}, {0, 6}, {0, 7}, {0, 8}}); ok {
+		t.Errorf("fit to a line")
+	}
+}
+
+func TestWindCircling(t *testing.T) {
+	tests := []struct {
+		name              string
+		windFrom, windKts float64
+		rate              float64
+		noise             float64
+		minQuality        uint8
+	}{
+		{"West wind, right turns", 270, 15, 15, 0.5, 4},
+		{"North wind, left turns", 10, 8, -18, 0.5, 4},
+		{"Calm", 0, 0, 15, 0.5, 4},
+		{"Strong wind, noisy GPS", 135, 25, 12, 1.5, 3},
+	}
+	for _, tt := range tests {
+		f := newWindFlight(tt.windFrom, tt.windKts)
+		f.noise = tt.noise
+		f.fly(10, 0)
+		if _, _, q := f.w.wind(f.t); q != 0 {
+			t.Errorf("%s: estimate before circling", tt.name)
+		}
+		f.fly(3*360/math.Abs(tt.rate), tt.rate)
+		direction, speed, quality := f.w.wind(f.t)
+		if quality < tt.minQuality || f.w.method != WIND_METHOD_CIRCLING {
+			t.Errorf("%s: quality %d, method %s", tt.name, quality, f.w.method)
+		}
+		if math.Abs(speed-tt.windKts) > 1.5 || (tt.windKts > 0 && math.Abs(simAngleDiff(direction, tt.windFrom)) > 5) {
+			t.Errorf("%s: %.0f° %.1f kts, want %.0f° %.1f kts", tt.name, direction, speed, tt.windFrom, tt.windKts)
+		}
+		if math.Abs(f.w.tas-f.tas) > 1.5 {
+			t.Errorf("%s: true airspeed %.1f", tt.name, f.w.tas)
+		}
+	}
+}
+
+func TestWindCirclingInterrupted(t *testing.T) {
+	f := newWindFlight(270, 15)
+	// Reversing the turn after 300° gives no circle.
+	f.fly(20, 15)
+	f.fly(20, -15)
+	if _, _, q := f.w.wind(f.t); q != 0 {
+		t.Errorf("estimate from reversed turns")
+	}
+	// Neither does a turn with a pause.
+	f = newWindFlight(270, 15)
+	f.fly(12, 15)
+	f.fly(5, 0)
+	f.fly(12, 15)
+	if _, _, q := f.w.wind(f.t); q != 0 {
+		t.Errorf("estimate from interrupted turn")
+	}
+	// Or taxiing in circles.
+	f = newWindFlight(270, 15)
+	f.tas = 5
+	f.fly(60, 15)
+	if _, _, q := f.w.wind(f.t); q != 0 {
+		t.Errorf("estimate on the ground")
+	}
+}
+
+func TestWindStraight(t *testing.T) {
+	tests := []struct {
+		name         string
+		tasSetting   float64
+		circleFirst  bool
+		headingError float64
+		quality      uint8 // 0 for no estimate.
+		maxError     float64
+	}{
+		{"Entered airspeed", 100, false, 0, 2, 0.5},
+		{"Heading 3° off", 100, false, 3, 2, 6},
+		{"No airspeed", 0, false, 0, 0, 0},
+		// The circling airspeed is 50 kts, flying 100 kts gives a poor estimate.
+		{"Circling airspeed", 0, true, 0, 1, 50},
+	}
+	for _, tt := range tests {
+		f := newWindFlight(250, 20)
+		f.magnetometer = true
+		f.headingError = tt.headingError
+		f.tasSetting = tt.tasSetting
+		if tt.circleFirst {
+			f.fly(60, 15)
+			f.heading = 0
+		}
+		f.tas = 100
+		f.fly(windCirclingHold.Seconds()+60, 0)
+		direction, speed, quality := f.w.wind(f.t)
+		if quality != tt.quality {
+			t.Errorf("%s: quality %d, want %d", tt.name, quality, tt.quality)
+			continue
+		}
+		if quality == 0 {
+			continue
+		}
+		wx, wy := windVector(speed, direction)
+		ex, ey := windVector(20, 250)
+		if e := math.Hypot(wx-ex, wy-ey); f.w.method != WIND_METHOD_STRAIGHT || e > tt.maxError {
+			t.Errorf("%s: %.0f° %.1f kts by %s, %.1f kts off", tt.name, direction, speed, f.w.method, e)
+		}
+	}
+}
+
+func TestWindCirclingBeatsStraight(t *testing.T) {
+	f := newWindFlight(250, 20)
+	f.magnetometer = true
+	f.tasSetting = 100
+	f.fly(60, 15)
+	// A wrong heading doesn't spoil the circling estimate within the hold time.
+	f.headingError = 20
+	f.tas = 100
+	f.fly(60, 0)
+	direction, speed, _ := f.w.wind(f.t)
+	if f.w.method != WIND_METHOD_CIRCLING || math.Abs(simAngleDiff(direction, 250)) > 5 || math.Abs(speed-20) > 1.5 {
+		t.Errorf("%.0f° %.1f kts by %s", direction, speed, f.w.method)
+	}
+	if _, _, q := f.w.wind(f.t.Add(windMaxAge + time.Second)); q != 0 {
+		t.Errorf("estimate didn't expire")
+	}
+}
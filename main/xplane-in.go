@@ -0,0 +1,388 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file, herein included
+	as part of this header.
+
+	xplane-in.go: Flight simulator input (-flightsim <udp port>). Takes the ownship position, attitude and baro
+	 altitude from X-Plane or FlightGear and feeds them into mySituation as if they came from the GNSS receiver
+	 and the I2C sensors, so the regular GDL90, AHRS and FLARM outputs drive the EFBs for instrument training.
+	 The sim's AI/multiplayer aircraft are injected as traffic.
+
+	 Accepted on the same port:
+	 - X-Plane "DATA" output (groups 3 speeds, 4 Mach/VVI/g-load, 6 atmosphere: aircraft, 16 angular velocities,
+	   17 pitch/roll/headings, 18 AoA/sideslip/paths, 20 lat/lon/alt).
+	 - X-Plane "RPOS" position output.
+	 - ForeFlight style XGPS/XATT/XTRAFFIC, as sent by X-Plane's ForeFlight output including its AI traffic.
+	 - FlightGear generic protocol lines, see docs/flightgear/stratux.xml.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+const (
+	GNSS_SOURCE_FLIGHTSIM = "flightsim"
+
+	flightSimTimeout        = 2 * time.Second
+	flightSimUnused         = -999 // X-Plane DATA value of unused fields.
+	flightSimDataRecordSize = 36   // int32 group index and 8 float32 values.
+	flightSimRPOSSize       = 5 + 3*8 + 10*4
+	flightGearOwnshipFields = 14
+	flightGearTargetFields  = 7
+	inHgToHPa               = 33.8639
+)
+
+// flightSimOwnship is the ownship state, merged from all packets received.
+type flightSimOwnship struct {
+	lat, lon        float64
+	alt             float64 // ft MSL
+	pressureAlt     float64 // ft
+	havePressureAlt bool
+	temperature     float64 // °C, outside air
+	haveTemperature bool
+	gs              float64 // kts
+	track           float64 // deg true
+	vs              float64 // fpm
+	heading         float64 // deg true
+	magHeading      float64 // deg magnetic
+	haveMagHeading  bool
+	pitch, roll     float64 // deg
+	slipSkid        float64 // deg
+	turnRate        float64 // deg/s
+	haveTurnRate    bool
+	gLoad           float64
+	lastUpdate      time.Time // stratuxClock
+}
+
+type flightSimInput struct {
+	mu          sync.Mutex
+	own         flightSimOwnship
+	lastHeading float64
+	ticks       int
+}
+
+// pressureOffset is what to add to an MSL altitude in the sim's atmosphere to get a pressure altitude.
+func (own *flightSimOwnship) pressureOffset() float64 {
+	if !own.havePressureAlt {
+		return 0
+	}
+	return own.pressureAlt - own.alt
+}
+
+// parseXPlaneDATA reads an X-Plane "DATA" packet. Returns false if it's not one.
+func parseXPlaneDATA(buf []byte, own *flightSimOwnship) bool {
+	if len(buf) < 5 || string(buf[:4]) != "DATA" || (len(buf)-5)%flightSimDataRecordSize != 0 {
+		return false
+	}
+	for rec := buf[5:]; len(rec) >= flightSimDataRecordSize; rec = rec[flightSimDataRecordSize:] {
+		group := int32(binary.LittleEndian.Uint32(rec))
+		var v [8]float64
+		for i := range v {
+			v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[4+4*i:])))
+		}
+		used := func(i int) bool { return v[i] != flightSimUnused }
+		switch group {
+		case 3: // Vind kias, Vind keas, Vtrue ktas, Vtrue ktgs, -, Vind mph, Vtrue mphas, Vtrue mphgs
+			if used(3) {
+				own.gs = v[3]
+			}
+		case 4: // Mach, -, VVI fpm, -, Gload normal, Gload axial, Gload side
+			if used(2) {
+				own.vs = v[2]
+			}
+			if used(4) {
+				own.gLoad = v[4]
+			}
+		case 6: // AMprs inHg, AMtmp degC, ... Group 7 starts with the altimeter setting, not the ambient pressure.
+			if used(0) && v[0] > 0 {
+				own.pressureAlt = common.CalcAltitude(v[0]*inHgToHPa, 0)
+				own.havePressureAlt = true
+			}
+			if used(1) {
+				own.temperature = v[1]
+				own.haveTemperature = true
+			}
+		case 16: // Q, P, R rad/s
+			if used(2) {
+				own.turnRate = common.Degrees(v[2])
+				own.haveTurnRate = true
+			}
+		case 17: // pitch, roll, hding true, hding mag
+			own.pitch, own.roll, own.heading = v[0], v[1], v[2]
+			if used(3) {
+				own.magHeading = v[3]
+				own.haveMagHeading = true
+			}
+		case 18: // alpha, beta, hpath, vpath, -, -, -, slip
+			if used(2) {
+				own.track = math.Mod(v[2]+360, 360)
+			}
+			if used(1) {
+				own.slipSkid = v[1]
+			}
+		case 20: // lat, lon, alt ftmsl, alt ftagl, on runwy, alt ind, ...
+			own.lat, own.lon, own.alt = v[0], v[1], v[2]
+		}
+	}
+	return true
+}
+
+// parseXPlaneRPOS reads an X-Plane "RPOS" packet: lon, lat, elevation (m MSL) as doubles, then AGL, pitch,
+// true heading, roll, the east/up/south velocities (m/s) and the roll/pitch/yaw rates (rad/s) as floats.
+func parseXPlaneRPOS(buf []byte, own *flightSimOwnship) bool {
+	if len(buf) < flightSimRPOSSize || string(buf[:4]) != "RPOS" {
+		return false
+	}
+	d := func(i int) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(buf[5+8*i:])) }
+	f := func(i int) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[5+24+4*i:]))) }
+	own.lon, own.lat, own.alt = d(0), d(1), d(2)*3.28084
+	own.pitch, own.heading, own.roll = f(1), f(2), f(3)
+	east, up, south := f(4), f(5), f(6)
+	own.gs = math.Hypot(east, south) * 1.94384
+	own.track = math.Mod(common.Degrees(math.Atan2(east, -south))+360, 360)
+	own.vs = up * 196.850
+	own.turnRate = common.Degrees(f(9))
+	own.haveTurnRate = true
+	return true
+}
+
+// flightSimTargetAddress maps a sim's target ID to an ICAO address. Small numbers are AI aircraft indexes.
+func flightSimTargetAddress(id string) uint32 {
+	if n, err := strconv.ParseUint(id, 10, 32); err == nil && n > 0xFF && n <= 0xFFFFFF {
+		return uint32(n)
+	}
+	return simMadeUpAddress(simAddressBlockFlightSim, id)
+}
+
+// parseForeFlightSim reads the ForeFlight style messages X-Plane sends, ignoring our own (XGPSStratux etc.).
+// Target altitudes are MSL.
+func parseForeFlightSim(msg string, own *flightSimOwnship) ([]simTrafficReport, bool) {
+	x := strings.Split(strings.TrimSpace(msg), ",")
+	if strings.HasSuffix(x[0], "Stratux") {
+		return nil, false
+	}
+	v := make([]float64, len(x))
+	for i := 1; i < len(x); i++ {
+		v[i], _ = strconv.ParseFloat(x[i], 64)
+	}
+	switch {
+	case strings.HasPrefix(x[0], "XGPS") && len(x) >= 6: // lon, lat, alt m MSL, track, gs m/s
+		own.lon, own.lat, own.alt, own.track, own.gs = v[1], v[2], v[3]*3.28084, v[4], v[5]*1.94384
+		return nil, true
+	case strings.HasPrefix(x[0], "XATT") && len(x) >= 4: // heading, pitch, roll, ...
+		own.heading, own.pitch, own.roll = v[1], v[2], v[3]
+		return nil, true
+	case strings.HasPrefix(x[0], "XTRAFFIC") && len(x) >= 10: // id, lat, lon, alt ft, vs fpm, airborne, heading, kts, callsign
+		return []simTrafficReport{{
+			icao:     flightSimTargetAddress(x[1]),
+			tail:     strings.TrimSpace(x[9]),
+			lat:      v[2],
+			lon:      v[3],
+			alt:      v[4],
+			vvel:     v[5],
+			onGround: x[6] == "0",
+			track:    v[7],
+			speed:    v[8],
+		}}, true
+	}
+	return nil, false
+}
+
+// parseFlightGearLine reads a line of the stratux FlightGear generic protocol: the ownship fields, then
+// callsign, lat, lon, alt ft, heading, kts, vs fps of each multiplayer slot. Target altitudes are MSL.
+func parseFlightGearLine(line string, own *flightSimOwnship) ([]simTrafficReport, bool) {
+	x := strings.Split(strings.TrimSpace(line), ",")
+	if len(x) < flightGearOwnshipFields || (len(x)-flightGearOwnshipFields)%flightGearTargetFields != 0 {
+		return nil, false
+	}
+	var v [flightGearOwnshipFields]float64
+	for i := range v {
+		var err error
+		if v[i], err = strconv.ParseFloat(x[i], 64); err != nil {
+			return nil, false
+		}
+	}
+	own.lat, own.lon, own.alt = v[0], v[1], v[2]
+	own.pressureAlt, own.havePressureAlt = v[3], true
+	own.gs, own.track, own.vs = v[4], v[5], v[6]*60
+	own.heading, own.magHeading, own.haveMagHeading = v[7], v[8], true
+	own.pitch, own.roll, own.slipSkid = v[9], v[10], v[11]
+	own.turnRate, own.haveTurnRate = v[12], true
+	own.gLoad = v[13]
+
+	var targets []simTrafficReport
+	for t := x[flightGearOwnshipFields:]; len(t) >= flightGearTargetFields; t = t[flightGearTargetFields:] {
+		callsign := strings.TrimSpace(t[0])
+		lat, err1 := strconv.ParseFloat(t[1], 64)
+		lon, err2 := strconv.ParseFloat(t[2], 64)
+		if callsign == "" || err1 != nil || err2 != nil || (lat == 0 && lon == 0) {
+			continue // Empty slot.
+		}
+		alt, _ := strconv.ParseFloat(t[3], 64)
+		track, _ := strconv.ParseFloat(t[4], 64)
+		speed, _ := strconv.ParseFloat(t[5], 64)
+		vs, _ := strconv.ParseFloat(t[6], 64)
+		targets = append(targets, simTrafficReport{
+			icao:     flightSimTargetAddress(callsign),
+			tail:     callsign,
+			lat:      lat,
+			lon:      lon,
+			alt:      alt,
+			track:    track,
+			speed:    speed,
+			vvel:     vs * 60,
+			onGround: speed < 30,
+		})
+	}
+	return targets, true
+}
+
+// handlePacket merges a received packet into the ownship state and updates the traffic it carries.
+func (f *flightSimInput) handlePacket(buf []byte) bool {
+	f.mu.Lock()
+	own := &f.own
+	var targets []simTrafficReport
+	ok := parseXPlaneDATA(buf, own) || parseXPlaneRPOS(buf, own)
+	if !ok {
+		for _, line := range strings.Split(string(buf), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			t, lineOk := parseForeFlightSim(line, own)
+			if !lineOk {
+				t, lineOk = parseFlightGearLine(line, own)
+			}
+			ok = ok || lineOk
+			targets = append(targets, t...)
+		}
+	}
+	if ok {
+		own.lastUpdate = stratuxClock.Time
+	}
+	ownLat, ownLon, offset := own.lat, own.lon, own.pressureOffset()
+	f.mu.Unlock()
+
+	if len(targets) > 0 {
+		trafficMutex.Lock()
+		for _, t := range targets {
+			t.alt += offset
+			simUpdateTraffic(t, ownLat, ownLon)
+		}
+		trafficMutex.Unlock()
+	}
+	return ok
+}
+
+// sensors returns what the baro sensor and AHRS would report, dt seconds after the last call.
+func (f *flightSimInput) sensors(dt float64) simSensors {
+	own := &f.own
+	s := simSensors{
+		pressureAlt:   own.alt,
+		verticalSpeed: own.vs,
+		temperature:   15 - 1.98*own.alt/1000,
+		roll:          own.roll,
+		pitch:         own.pitch,
+		heading:       own.heading,
+		slipSkid:      own.slipSkid,
+		turnRate:      own.turnRate,
+		gLoad:         own.gLoad,
+	}
+	if own.havePressureAlt {
+		s.pressureAlt = own.pressureAlt
+	}
+	if own.haveTemperature {
+		s.temperature = own.temperature
+	}
+	if own.haveMagHeading {
+		s.magHeading = own.magHeading
+	} else {
+		decl, _ := common.MagneticDeclination(own.lat, own.lon, own.alt, time.Now())
+		s.magHeading = common.TrueToMagnetic(own.heading, decl)
+	}
+	if !own.haveTurnRate && dt > 0 {
+		s.turnRate = simAngleDiff(own.heading, f.lastHeading) / dt
+	}
+	if s.gLoad == 0 {
+		s.gLoad = 1 / math.Cos(common.Radians(own.roll))
+	}
+	f.lastHeading = own.heading
+	return s
+}
+
+// snapshot returns the NMEA sentences and the sensor values to publish, false if the sim stopped sending.
+func (f *flightSimInput) snapshot(now time.Time, dt float64) ([]string, simSensors, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.own.lastUpdate.IsZero() || stratuxClock.Since(f.own.lastUpdate) > flightSimTimeout {
+		return nil, simSensors{}, false
+	}
+	own := f.own
+	sentences := simNMEASentences(now, own.lat, own.lon, own.alt, own.gs, own.track, f.ticks%simSatelliteEvery == 0)
+	f.ticks++
+	return sentences, f.sensors(dt), true
+}
+
+// publish feeds the ownship state into mySituation, as long as the sim is sending.
+func (f *flightSimInput) publish(dt float64) {
+	sentences, sensors, ok := f.snapshot(time.Now(), dt)
+	if !ok {
+		return
+	}
+	simPublishGNSS(GNSS_SOURCE_FLIGHTSIM, sentences)
+	simPublishSensors(sensors)
+}
+
+func flightSimListen(conn net.PacketConn, f *flightSimInput) {
+	buf := make([]byte, 65536)
+	var warned bool
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil || n == 0 {
+			continue
+		}
+		if !f.handlePacket(buf[:n]) && !warned {
+			log.Printf("Flight simulator input: ignoring unknown packet %q\n", buf[:common.IMin(n, 16)])
+			warned = true
+		}
+	}
+}
+
+func flightSimRun(f *flightSimInput) {
+	ticker := time.NewTicker(simTickInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		f.publish(simTickInterval.Seconds())
+	}
+}
+
+// initFlightSimInput listens for flight simulator packets. Real GNSS and I2C sensors must not be started with it.
+func initFlightSimInput(port int) error {
+	if port <= 0 || port > 65535 {
+		return errors.New("invalid port")
+	}
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	f := &flightSimInput{}
+	log.Printf("Flight simulator input: listening for X-Plane/FlightGear on udp:%d\n", port)
+	addSingleSystemErrorf("flightsim", "Flight simulator mode: ownship and traffic come from a flight simulator on UDP port %d. Not for navigation.", port)
+	go updateAHRSStatus()
+	go flightSimListen(conn, f)
+	go flightSimRun(f)
+	return nil
+}
@@ -0,0 +1,259 @@
+/*
+	Copyright (c) 2025 Stratux Development Team
+	Distributable under the terms of The "BSD New" License
+	that can be found in the LICENSE file.
+
+	xplane-in_test.go: Unit tests for the X-Plane / FlightGear input
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/common"
+)
+
+// xplaneDATA builds an X-Plane DATA packet from group index -> values.
+func xplaneDATA(groups map[int32][]float32) []byte {
+	buf := []byte("DATA*")
+	for group, values := range groups {
+		rec := make([]byte, flightSimDataRecordSize)
+		binary.LittleEndian.PutUint32(rec, uint32(group))
+		for i := 0; i < 8; i++ {
+			v := float32(flightSimUnused)
+			if i < len(values) {
+				v = values[i]
+			}
+			binary.LittleEndian.PutUint32(rec[4+4*i:], math.Float32bits(v))
+		}
+		buf = append(buf, rec...)
+	}
+	return buf
+}
+
+func xplaneRPOS(lon, lat, eleM float64, floats [10]float32) []byte {
+	buf := []byte("RPOS4")
+	for _, d := range []float64{lon, lat, eleM} {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(d))
+	}
+	for _, f := range floats {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+	}
+	return buf
+}
+
+func TestParseXPlaneDATA(t *testing.T) {
+	var own flightSimOwnship
+	packet := xplaneDATA(map[int32][]float32{
+		3:  {110, 110, 115, 120},
+		4:  {0.17, flightSimUnused, 500, flightSimUnused, 1.2},
+		6:  {25.22, 5},
+		7:  {29.92}, // Altimeter setting, ignored.
+		16: {0, 0, 0.0523599},
+		17: {3.5, -15, 270, 268},
+		18: {2, 0.5, 265},
+		20: {43.98, -88.55, 4500, 3700},
+	})
+	if !parseXPlaneDATA(packet, &own) {
+		t.Fatalf("not parsed")
+	}
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"Latitude", own.lat, 43.98},
+		{"Longitude", own.lon, -88.55},
+		{"Altitude", own.alt, 4500},
+		{"Ground speed", own.gs, 120},
+		{"Track", own.track, 265},
+		{"Vertical speed", own.vs, 500},
+		{"G load", own.gLoad, 1.2},
+		{"Pressure altitude", own.pressureAlt, 4652.05}, // 25.22 inHg is 854.05 hPa
+		{"Pressure offset", own.pressureOffset(), 152.05},
+		{"Temperature", own.temperature, 5},
+		{"Turn rate", own.turnRate, 3},
+		{"Pitch", own.pitch, 3.5},
+		{"Roll", own.roll, -15},
+		{"Heading", own.heading, 270},
+		{"Magnetic heading", own.magHeading, 268},
+		{"Slip", own.slipSkid, 0.5},
+	}
+	for _, tt := range tests {
+		if math.Abs(tt.got-tt.want) > 0.01+math.Abs(tt.want)*1e-5 {
+			t.Errorf("%s = %f, want %f", tt.name, tt.got, tt.want)
+		}
+	}
+	if !own.havePressureAlt || !own.haveMagHeading || !own.haveTurnRate {
+		t.Errorf("flags not set: %+v", own)
+	}
+
+	for _, bad := range [][]byte{[]byte("DATA"), []byte("DATA*123"), []byte("RPOS4")} {
+		if parseXPlaneDATA(bad, &own) {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestParseXPlaneRPOS(t *testing.T) {
+	var own flightSimOwnship
+	// 50 m/s north, 5 m/s climb: south velocity is negative.
+	packet := xplaneRPOS(-88.55, 43.98, 1000, [10]float32{300, 2, 5, -10, 0, 5, -50, 0, 0, -0.05})
+	if !parseXPlaneRPOS(packet, &own) {
+		t.Fatalf("not parsed")
+	}
+	if math.Abs(own.lat-43.98) > 1e-9 || math.Abs(own.lon+88.55) > 1e-9 || math.Abs(own.alt-3280.84) > 0.01 {
+		t.Errorf("position %f %f %f", own.lat, own.lon, own.alt)
+	}
+	if math.Abs(own.gs-97.19) > 0.01 || math.Abs(simAngleDiff(own.track, 0)) > 0.01 || math.Abs(own.vs-984.25) > 0.01 {
+		t.Errorf("gs %f track %f vs %f", own.gs, own.track, own.vs)
+	}
+	if own.pitch != 2 || own.heading != 5 || own.roll != -10 || math.Abs(own.turnRate+2.865) > 0.01 {
+		t.Errorf("attitude %+v", own)
+	}
+	if parseXPlaneRPOS(packet[:len(packet)-1], &own) {
+		t.Errorf("short packet parsed")
+	}
+}
+
+func TestParseForeFlightSim(t *testing.T) {
+	tests := []struct {
+		msg         string
+		ok          bool
+		wantTargets int
+	}{
+		{"XGPSX-Plane,-88.55,43.98,1000.0,90.5,51.44", true, 0},
+		{"XATTX-Plane,92.0,1.5,-3.0", true, 0},
+		{"XTRAFFICX-Plane,1,44.0,-88.5,3500,-500,1,180,120,N12345", true, 1},
+		{"XTRAFFICX-Plane,11189196,44.0,-88.5,3500,-500,0,180,10,N12345", true, 1},
+		{"XGPSStratux,-88.55,43.98,1000.0,90.5,51.44", false, 0},
+		{"XTRAFFICStratux,1,44.0,-88.5,3500,-500,1,180,120,N12345", false, 0},
+		{"XGPSX-Plane,-88.55", false, 0},
+	}
+	for _, tt := range tests {
+		var own flightSimOwnship
+		targets, ok := parseForeFlightSim(tt.msg, &own)
+		if ok != tt.ok || len(targets) != tt.wantTargets {
+			t.Errorf("%s: ok %v, %d targets", tt.msg, ok, len(targets))
+		}
+	}
+
+	var own flightSimOwnship
+	parseForeFlightSim("XGPSX-Plane,-88.55,43.98,1000.0,90.5,51.44", &own)
+	if own.lat != 43.98 || own.lon != -88.55 || math.Abs(own.alt-3280.84) > 0.01 || own.track != 90.5 || math.Abs(own.gs-100) > 0.01 {
+		t.Errorf("XGPS: %+v", own)
+	}
+
+	targets, _ := parseForeFlightSim("XTRAFFICX-Plane,11189196,44.0,-88.5,3500,-500,0,180,10,N12345", &own)
+	want := simTrafficReport{icao: 0xAABBCC, tail: "N12345", lat: 44, lon: -88.5, alt: 3500, vvel: -500, onGround: true, track: 180, speed: 10}
+	if targets[0] != want {
+		t.Errorf("XTRAFFIC: %+v, want %+v", targets[0], want)
+	}
+	targets, _ = parseForeFlightSim("XTRAFFICX-Plane,1,44.0,-88.5,3500,-500,1,180,120,N12345", &own)
+	if targets[0].icao&0xFF0000 != simAddressBlockFlightSim {
+		t.Errorf("AI aircraft address %X", targets[0].icao)
+	}
+}
+
+func TestParseFlightGearLine(t *testing.T) {
+	const ownship = "43.980000,-88.550000,4500,4400,120.0,265.0,8.33,270.0,268.0,3.5,-15.0,0.5,3.00,1.04"
+	tests := []struct {
+		name        string
+		line        string
+		ok          bool
+		wantTargets int
+	}{
+		{"Ownship only", ownship, true, 0},
+		{"With traffic", ownship + ",N123,44.000000,-88.500000,5000,180,110,-5.0,,0.000000,0.000000,0,0,0,0.0", true, 1},
+		{"Wrong field count", ownship + ",N123", false, 0},
+		{"Not numeric", "XGPS" + ownship[4:], false, 0},
+		{"Too short", "1,2,3", false, 0},
+	}
+	for _, tt := range tests {
+		var own flightSimOwnship
+		targets, ok := parseFlightGearLine(tt.line, &own)
+		if ok != tt.ok || len(targets) != tt.wantTargets {
+			t.Errorf("%s: ok %v, %d targets", tt.name, ok, len(targets))
+		}
+	}
+
+	var own flightSimOwnship
+	targets, _ := parseFlightGearLine(tests[1].line, &own)
+	if own.alt != 4500 || own.pressureAlt != 4400 || math.Abs(own.vs-499.8) > 0.01 || own.turnRate != 3 || own.gLoad != 1.04 {
+		t.Errorf("ownship %+v", own)
+	}
+	if targets[0].tail != "N123" || targets[0].alt != 5000 || targets[0].vvel != -300 || targets[0].onGround {
+		t.Errorf("target %+v", targets[0])
+	}
+}
+
+func TestFlightSimHandlePacket(t *testing.T) {
+	resetGPSState()
+	defer resetGPSState()
+	if trafficMutex == nil {
+		trafficMutex = &sync.Mutex{}
+	}
+	traffic = make(map[uint32]TrafficInfo)
+	seenTraffic = make(map[uint32]bool)
+	defer func() {
+		traffic = make(map[uint32]TrafficInfo)
+		seenTraffic = make(map[uint32]bool)
+	}()
+
+	f := &flightSimInput{}
+	if f.handlePacket([]byte("garbage")) {
+		t.Errorf("garbage accepted")
+	}
+	// Ownship at 4500 ft MSL, 4400 ft pressure altitude; traffic at 5000 ft MSL is at 4900 ft pressure altitude.
+	line := "43.980000,-88.550000,4500,4400,120.0,265.0,8.33,270.0,268.0,3.5,-15.0,0.5,3.00,1.04,N123,44.000000,-88.500000,5000,180,110,-5.0\n"
+	if !f.handlePacket([]byte(line)) {
+		t.Fatalf("FlightGear line not accepted")
+	}
+	ti, ok := traffic[flightSimTargetAddress("N123")]
+	if !ok {
+		t.Fatalf("target not inserted")
+	}
+	if ti.Alt != 4900 || ti.Tail != "N123" || !ti.Position_valid || ti.Distance < 4000 || ti.Distance > 5000 {
+		t.Errorf("target %+v", ti)
+	}
+
+	// The published GNSS sentences go through the NMEA parser.
+	globalStatus.GPS_connected = true
+	sentences, sensors, ok := f.snapshot(time.Now(), 0.2)
+	if !ok {
+		t.Fatalf("nothing to publish")
+	}
+	for _, sentence := range sentences {
+		processNMEALineSource(GNSS_SOURCE_FLIGHTSIM, sentence, false)
+	}
+	mySituation.muGPS.Lock()
+	valid := isGPSValid()
+	lat, alt := mySituation.GPSLatitude, mySituation.GPSAltitudeMSL
+	mySituation.muGPS.Unlock()
+	if !valid || math.Abs(float64(lat)-43.98) > 1e-5 || math.Abs(float64(alt)-4500) > 0.5 {
+		t.Errorf("GPS valid %v at %f, %f ft", valid, lat, alt)
+	}
+	if sensors.pressureAlt != 4400 || sensors.roll != -15 || sensors.magHeading != 268 || sensors.turnRate != 3 {
+		t.Errorf("sensors %+v", sensors)
+	}
+
+	// Nothing once the sim stops sending.
+	f.own.lastUpdate = stratuxClock.Time.Add(-2 * flightSimTimeout)
+	if _, _, ok := f.snapshot(time.Now(), 0.2); ok {
+		t.Errorf("stale state published")
+	}
+}
+
+func TestFlightSimSensorDefaults(t *testing.T) {
+	f := &flightSimInput{lastHeading: 80}
+	f.own = flightSimOwnship{alt: 5000, heading: 90, roll: 60}
+	s := f.sensors(2)
+	decl, _ := common.MagneticDeclination(0, 0, 5000, time.Now())
+	if s.pressureAlt != 5000 || math.Abs(s.magHeading-common.TrueToMagnetic(90, decl)) > 1e-9 || s.turnRate != 5 || math.Abs(s.gLoad-2) > 1e-9 || math.Abs(s.temperature-5.1) > 1e-9 {
+		t.Errorf("%+v", s)
+	}
+}
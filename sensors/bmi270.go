@@ -0,0 +1,30 @@
+package sensors
+
+import (
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/bmi270"
+)
+
+// BMI270 represents a Bosch BMI270 attached to the I2C bus and satisfies the IMUReader interface.
+// It has no magnetometer.
+type BMI270 struct {
+	imuPoller
+	sensor *bmi270.BMI270
+}
+
+// NewBMI270 uploads configFile to the BMI270 at address, configures it and begins reading it.
+func NewBMI270(i2cbus *embd.I2CBus, address byte, config bmi270.Config, configFile []byte) (*BMI270, error) {
+	sensor := &bmi270.BMI270{Bus: i2cbus, Address: address, ConfigFile: configFile}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &BMI270{sensor: sensor}
+	m.sample = func() (s imuSample) {
+		s.g, s.a, s.err = sensor.Read()
+		s.magErr = errNoMag
+		return
+	}
+	m.sleep = sensor.Sleep
+	m.start(imuPollInterval)
+	return m, nil
+}
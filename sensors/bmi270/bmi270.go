@@ -0,0 +1,157 @@
+package bmi270
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite  = errors.New("bmi270: failed to configure sensor, check connection")
+	errConfig       = errors.New("bmi270: invalid configuration")
+	errInit         = errors.New("bmi270: configuration file upload failed")
+	errNoTemp       = errors.New("bmi270: no temperature reading")
+	ErrNoConfigFile = errors.New("bmi270: no configuration file")
+	ErrNotConnected = errors.New("bmi270: not connected")
+)
+
+type DataRate byte
+type AccelRange byte
+type GyroRange byte
+
+type Config struct {
+	ODR   DataRate
+	Accel AccelRange
+	Gyro  GyroRange
+}
+
+// DefaultConfig matches the InvenSense IMUs: 100 readings per second, ±4 G and 250 °/s.
+var DefaultConfig = Config{ODR: Odr100, Accel: Accel4G, Gyro: Gyro250}
+
+// BMI270 wraps the I2C connection and configuration values for the BMI270.
+type BMI270 struct {
+	Bus        *embd.I2CBus
+	Address    uint8
+	Config     Config
+	ConfigFile []byte // Bosch's configuration file, uploaded by Configure.
+}
+
+// Configure resets the sensor, uploads the configuration file and starts continuous measurements.
+func (d *BMI270) Configure(config Config) error {
+	if config.ODR < Odr25 || config.ODR > Odr400 || config.Accel > Accel16G || config.Gyro > Gyro125 {
+		return errConfig
+	}
+	if len(d.ConfigFile) == 0 {
+		return ErrNoConfigFile
+	}
+	d.Config = config
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+	if err := d.writeRegister(RegCmd, SoftReset); err != nil {
+		return errConfigWrite
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := d.upload(); err != nil {
+		return err
+	}
+
+	for _, w := range [][2]byte{
+		{RegAccConf, AccConfPerf | AccConfBwNormal | byte(config.ODR)},
+		{RegAccRange, byte(config.Accel)},
+		{RegGyrConf, GyrConfPerf | GyrConfBwNormal | byte(config.ODR)},
+		{RegGyrRange, byte(config.Gyro)},
+		{RegPwrCtrl, PwrCtrlTemp | PwrCtrlAcc | PwrCtrlGyr},
+		{RegPwrConf, PwrConfWakeup},
+	} {
+		if err := d.writeRegister(w[0], w[1]); err != nil {
+			return errConfigWrite
+		}
+	}
+	return nil
+}
+
+// upload writes the configuration file in bursts, as in the datasheet's initialization example.
+func (d *BMI270) upload() error {
+	if err := d.writeRegister(RegPwrConf, 0); err != nil { // Advanced power save off.
+		return errConfigWrite
+	}
+	time.Sleep(time.Millisecond)
+	if err := d.writeRegister(RegInitCtrl, 0); err != nil {
+		return errConfigWrite
+	}
+	for i := 0; i < len(d.ConfigFile); i += initChunk {
+		end := i + initChunk
+		if end > len(d.ConfigFile) {
+			end = len(d.ConfigFile)
+		}
+		word := i / 2
+		if err := (*d.Bus).WriteToReg(d.Address, RegInitAddr0, []byte{byte(word & 0x0F), byte(word >> 4)}); err != nil {
+			return errConfigWrite
+		}
+		if err := (*d.Bus).WriteToReg(d.Address, RegInitData, d.ConfigFile[i:end]); err != nil {
+			return errConfigWrite
+		}
+	}
+	if err := d.writeRegister(RegInitCtrl, 1); err != nil {
+		return errConfigWrite
+	}
+	for n := 0; n < 25; n++ {
+		v, err := d.readRegister(RegInternalStatus, 1)
+		if err == nil && v[0]&InitStatusMask == InitOk {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return errInit
+}
+
+// Connected is whether a BMI270 answers at the address.
+func (d *BMI270) Connected() bool {
+	data, err := d.readRegister(RegChipId, 1)
+	return err == nil && data[0] == ChipId
+}
+
+// Read returns the latest angular rates in degrees per second and accelerations in G.
+func (d *BMI270) Read() (gyro, accel [3]float64, err error) {
+	buf, err := d.readRegister(RegData, 12)
+	if err != nil {
+		return gyro, accel, ErrNotConnected
+	}
+	as := float64(int(1) << (14 - d.Config.Accel)) // 16384 LSB/g at ±2 G
+	gs := 16.4 * float64(int(1)<<d.Config.Gyro)    // 16.4 LSB/dps at 2000 dps
+	for i := 0; i < 3; i++ {
+		accel[i] = float64(int16(uint16(buf[2*i+1])<<8|uint16(buf[2*i]))) / as
+		gyro[i] = float64(int16(uint16(buf[2*i+7])<<8|uint16(buf[2*i+6]))) / gs
+	}
+	return gyro, accel, nil
+}
+
+// Temperature returns the die temperature in degrees C.
+func (d *BMI270) Temperature() (float64, error) {
+	buf, err := d.readRegister(RegTemp, 2)
+	if err != nil {
+		return 0, ErrNotConnected
+	}
+	raw := uint16(buf[1])<<8 | uint16(buf[0])
+	if raw == TempInvalid {
+		return 0, errNoTemp
+	}
+	return 23 + float64(int16(raw))/512, nil
+}
+
+// Sleep turns the accelerometer, gyroscope and temperature sensor off.
+func (d *BMI270) Sleep() error {
+	return d.writeRegister(RegPwrCtrl, 0)
+}
+
+func (d *BMI270) readRegister(register byte, len int) (data []byte, err error) {
+	data = make([]byte, len)
+	err = (*d.Bus).ReadFromReg(d.Address, register, data)
+	return
+}
+
+func (d *BMI270) writeRegister(register byte, data byte) error {
+	return (*d.Bus).WriteToReg(d.Address, register, []byte{data})
+}
@@ -0,0 +1,151 @@
+package bmi270
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+// newTestBMI270 emulates the configuration upload: INIT_DATA writes land at the word address in INIT_ADDR,
+// and INIT_CTRL reports success if the uploaded file is the expected one.
+func newTestBMI270(file []byte) (*BMI270, *i2cemu.Registers, *[]byte) {
+	regs := i2cemu.NewRegisters(map[byte]byte{RegChipId: ChipId})
+	regs.FIFO = map[byte]bool{RegInitData: true}
+	uploaded := make([]byte, 0, len(file))
+	var pos int
+	regs.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		switch reg {
+		case RegInitAddr1:
+			pos = 2 * (int(r.Regs[RegInitAddr0]&0x0F) | int(value)<<4)
+		case RegInitData:
+			for len(uploaded) <= pos {
+				uploaded = append(uploaded, 0)
+			}
+			uploaded[pos] = value
+			pos++
+		case RegInitCtrl:
+			if value == 1 && bytes.Equal(uploaded, file) {
+				r.Regs[RegInternalStatus] = InitOk
+			}
+		}
+	}
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, regs)
+	return &BMI270{Bus: bus.I2CBus(), Address: Address}, regs, &uploaded
+}
+
+func testConfigFile(n int) []byte {
+	file := make([]byte, n)
+	for i := range file {
+		file[i] = byte(i*7 + i/256)
+	}
+	return file
+}
+
+func TestBMI270Configure(t *testing.T) {
+	file := testConfigFile(8192)
+	d, regs, uploaded := newTestBMI270(file)
+	d.ConfigFile = file
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatalf("%v, %d bytes uploaded", err, len(*uploaded))
+	}
+	if regs.Writes[0] != (i2cemu.RegWrite{Reg: RegCmd, Value: SoftReset}) {
+		t.Errorf("no soft reset: %v", regs.Writes[0])
+	}
+	want := map[byte]byte{
+		RegAccConf:  0xA8,
+		RegAccRange: 0x01,
+		RegGyrConf:  0xE8,
+		RegGyrRange: 0x03,
+		RegPwrCtrl:  0x0E,
+		RegPwrConf:  PwrConfWakeup,
+	}
+	for reg, v := range want {
+		if regs.Regs[reg] != v {
+			t.Errorf("register %02X = %02X, want %02X", reg, regs.Regs[reg], v)
+		}
+	}
+
+	// A file that isn't a whole number of bursts.
+	file = testConfigFile(300)
+	d, _, _ = newTestBMI270(file)
+	d.ConfigFile = file
+	if err := d.Configure(Config{ODR: Odr200, Accel: Accel16G, Gyro: Gyro2000}); err != nil {
+		t.Errorf("300 byte file: %v", err)
+	}
+}
+
+func TestBMI270ConfigureErrors(t *testing.T) {
+	file := testConfigFile(256)
+	tests := []struct {
+		name    string
+		config  Config
+		file    []byte
+		wantErr error
+	}{
+		{"No file", DefaultConfig, nil, ErrNoConfigFile},
+		{"Rate too low", Config{ODR: 5}, file, errConfig},
+		{"Rate too high", Config{ODR: 0x0B}, file, errConfig},
+		{"Invalid gyro range", Config{ODR: Odr100, Gyro: 5}, file, errConfig},
+		{"Upload rejected", DefaultConfig, testConfigFile(254), errInit},
+	}
+	for _, tt := range tests {
+		d, _, _ := newTestBMI270(file)
+		d.ConfigFile = tt.file
+		if err := d.Configure(tt.config); err != tt.wantErr {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	d, regs, _ := newTestBMI270(file)
+	d.ConfigFile = file
+	regs.Regs[RegChipId] = 0xEA // ICM-20948
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("ICM-20948 accepted")
+	}
+}
+
+func TestBMI270Read(t *testing.T) {
+	d, regs, _ := newTestBMI270(nil)
+	d.Config = DefaultConfig
+	// Accel 0, -8192, 8192; gyro 1312, 0, -131.
+	regs.Set(RegData, 0, 0, 0x00, 0xE0, 0x00, 0x20, 0x20, 0x05, 0, 0, 0x7D, 0xFF)
+	regs.Set(RegTemp, 0x00, 0x02)
+	gyro, accel, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [6]float64{10, 0, -131 / 131.2, 0, -1, 1}
+	got := [6]float64{gyro[0], gyro[1], gyro[2], accel[0], accel[1], accel[2]}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("read %v, want %v", got, want)
+			break
+		}
+	}
+	if temp, err := d.Temperature(); err != nil || temp != 24 {
+		t.Errorf("temperature %f, %v", temp, err)
+	}
+	regs.Set(RegTemp, 0x00, 0x80)
+	if _, err := d.Temperature(); err == nil {
+		t.Errorf("invalid temperature accepted")
+	}
+	d.Sleep()
+	if regs.Regs[RegPwrCtrl] != 0 {
+		t.Errorf("not powered down")
+	}
+}
+
+func TestBMI270ConfigFile(t *testing.T) {
+	// 8 kB, starting with the jump table of the Bosch configuration file.
+	if len(ConfigFile) != 8192 || !bytes.Equal(ConfigFile[:8], []byte{0xC8, 0x2E, 0x00, 0x2E, 0x80, 0x2E, 0x3D, 0xB1}) {
+		t.Errorf("configuration file of %d bytes, starting with % X", len(ConfigFile), ConfigFile[:8])
+	}
+	d, _, uploaded := newTestBMI270(ConfigFile)
+	d.ConfigFile = ConfigFile
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Errorf("%v, %d bytes uploaded", err, len(*uploaded))
+	}
+}
@@ -0,0 +1,12 @@
+package bmi270
+
+import (
+	_ "embed"
+)
+
+// ConfigFile is Bosch's configuration file for the BMI270 (bmi270_config_file in bmi270.c of the BMI270 Sensor
+// API v2.71.8, https://github.com/boschsensortec/BMI270_SensorAPI), which has to be uploaded after every power up.
+// Copyright (c) Bosch Sensortec GmbH, under the BSD-3-Clause license in LICENSE.bosch.
+//
+//go:embed bmi270_config.bin
+var ConfigFile []byte
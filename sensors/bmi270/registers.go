@@ -0,0 +1,77 @@
+// Package bmi270 provides a driver for Bosch's BMI270 6 axis accelerometer and gyroscope.
+// The datasheet can be found here: https://www.bosch-sensortec.com/media/boschsensortec/downloads/datasheets/bst-bmi270-ds000.pdf
+//
+// The BMI270 needs Bosch's configuration file (bmi270_config_file in the BMI270 Sensor API) uploaded after every
+// power up before it measures. It is embedded as ConfigFile, see config.go.
+package bmi270
+
+const (
+	Address    byte = 0x68 // SDO low
+	AddressAlt byte = 0x69 // SDO high
+)
+
+const (
+	RegChipId         byte = 0x00
+	RegErr            byte = 0x02
+	RegStatus         byte = 0x03 // data ready flags
+	RegData           byte = 0x0C // ACC_X_LSB .. ACC_Z_MSB, followed by the gyroscope
+	RegGyro           byte = 0x12 // GYR_X_LSB .. GYR_Z_MSB
+	RegInternalStatus byte = 0x21 // initialization status
+	RegTemp           byte = 0x22 // 16 bit two's complement, 512 LSB/K, 0 is 23 C
+	RegAccConf        byte = 0x40 // accelerometer data rate, bandwidth, performance mode
+	RegAccRange       byte = 0x41
+	RegGyrConf        byte = 0x42 // gyroscope data rate, bandwidth, performance modes
+	RegGyrRange       byte = 0x43
+	RegInitCtrl       byte = 0x59 // starts the configuration upload
+	RegInitAddr0      byte = 0x5B // configuration word address, bits 3..0
+	RegInitAddr1      byte = 0x5C // configuration word address, bits 11..4
+	RegInitData       byte = 0x5E // configuration upload, burst writes stay on this register
+	RegPwrConf        byte = 0x7C // advanced power save, FIFO self wake up
+	RegPwrCtrl        byte = 0x7D // sensor enables
+	RegCmd            byte = 0x7E
+)
+
+const (
+	ChipId          byte   = 0x24 // correct response if reading from the chip id register
+	SoftReset       byte   = 0xB6
+	InitOk          byte   = 0x01 // INTERNAL_STATUS message after a successful configuration upload
+	InitStatusMask  byte   = 0x0F
+	PwrConfWakeup   byte   = 0x02 // FIFO self wake up, advanced power save off
+	PwrCtrlTemp     byte   = 0x08
+	PwrCtrlAcc      byte   = 0x04
+	PwrCtrlGyr      byte   = 0x02
+	AccConfPerf     byte   = 0x80 // performance optimized filtering
+	AccConfBwNormal byte   = 0x20 // normal bandwidth, 3 dB at ~0.4 ODR
+	GyrConfPerf     byte   = 0xC0 // performance optimized filtering and noise
+	GyrConfBwNormal byte   = 0x20
+	TempInvalid     uint16 = 0x8000
+)
+
+// Output data rates in Hz, for both the accelerometer and the gyroscope.
+const (
+	Odr25 DataRate = iota + 6
+	Odr50
+	Odr100
+	Odr200
+	Odr400
+)
+
+// Accelerometer full scale.
+const (
+	Accel2G AccelRange = iota
+	Accel4G
+	Accel8G
+	Accel16G
+)
+
+// Gyroscope full scale in degrees per second.
+const (
+	Gyro2000 GyroRange = iota
+	Gyro1000
+	Gyro500
+	Gyro250
+	Gyro125
+)
+
+// initChunk is the configuration upload burst size, must be even.
+const initChunk = 128
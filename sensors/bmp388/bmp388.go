@@ -171,6 +171,21 @@ func (d *BMP388) ReadPressure() (float64, error) {
 	compPress := ((uint64(partialData4) * 25) / uint64(1099511627776))
 	return float64(compPress) / 10000, nil
 }
+
+// Read returns the temperature and pressure in degrees C and mbar.
+func (d *BMP388) Read() (temperature, pressure float64, err error) {
+	if temperature, err = d.ReadTemperature(); err != nil {
+		return
+	}
+	pressure, err = d.ReadPressure()
+	return
+}
+
+// Sleep puts the sensor into sleep mode.
+func (d *BMP388) Sleep() error {
+	return d.SetMode(Sleep)
+}
+
 func (d *BMP388) Connected() bool {
 	data, err := d.readRegister(RegChipId, 1)
 	return err == nil && (data[0] == ChipId || data[0] == ChipId390) // returns true if i2c comm was good and response equals 0x50/0x60
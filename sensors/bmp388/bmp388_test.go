@@ -0,0 +1,99 @@
+package bmp388
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+// testCalibration holds the coefficients T1 27473, T2 19287, T3 -7, P1 1277, P2 -2445, P3 35, P4 1, P5 19802,
+// P6 23926, P7 3, P8 -9, P9 16068, P10 8, P11 -60.
+var testCalibration = []byte{0x51, 0x6B, 0x57, 0x4B, 0xF9, 0xFD, 0x04, 0x73, 0xF6, 0x23, 0x01, 0x5A, 0x4D, 0x76,
+	0x5D, 0x03, 0xF7, 0xC4, 0x3E, 0x08, 0xC4}
+
+func newTestBMP388() (*BMP388, *i2cemu.Registers) {
+	regs := i2cemu.NewRegisters(map[byte]byte{RegChipId: ChipId})
+	regs.Set(RegCali, testCalibration...)
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, regs)
+	return &BMP388{Bus: bus.I2CBus(), Address: Address}, regs
+}
+
+func TestBMP388Configure(t *testing.T) {
+	d, regs := newTestBMP388()
+	config := Config{Pressure: Sampling8X, Temperature: Sampling1X, Mode: Normal, ODR: Odr50, IIR: Coeff3}
+	if err := d.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	want := map[byte]byte{RegPwrCtrl: 0x33, RegOSR: 0x03, RegODR: 0x02, RegIIR: 0x04}
+	for reg, v := range want {
+		if got, _ := regs.LastWrite(reg); got != v {
+			t.Errorf("register %02X = %02X, want %02X", reg, got, v)
+		}
+	}
+	if d.cali.t3 != -7 || d.cali.p2 != -2445 || d.cali.p6 != 23926 || d.cali.p11 != -60 {
+		t.Errorf("calibration %+v", d.cali)
+	}
+
+	regs.Regs[RegErr] = 0x04
+	if err := d.Configure(config); err != errConfig {
+		t.Errorf("configuration error not reported: %v", err)
+	}
+}
+
+func TestBMP388Read(t *testing.T) {
+	tests := []struct {
+		name                  string
+		rawT, rawP            []byte
+		temperature, pressure float64
+	}{
+		// Expected values from the floating point compensation in the datasheet.
+		{"Warm", []byte{0xE0, 0xA5, 0x7E}, []byte{0x80, 0x23, 0x43}, 22.717, 1010.123},
+		{"Cool", []byte{0xC0, 0x04, 0x77}, []byte{0x80, 0x23, 0x43}, 13.761, 990.280},
+	}
+	for _, tt := range tests {
+		d, regs := newTestBMP388()
+		if err := d.Configure(Config{}); err != nil {
+			t.Fatal(err)
+		}
+		regs.Set(RegTemp, tt.rawT...)
+		regs.Set(RegPress, tt.rawP...)
+		temperature, pressure, err := d.Read()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// Temperature is truncated to 0.01 °C.
+		if math.Abs(temperature-tt.temperature) > 0.01 || math.Abs(pressure-tt.pressure) > 0.001 {
+			t.Errorf("%s: %.3f °C %.4f hPa, want %.3f %.3f", tt.name, temperature, pressure, tt.temperature, tt.pressure)
+		}
+	}
+}
+
+func TestBMP388Modes(t *testing.T) {
+	d, regs := newTestBMP388()
+	if err := d.Configure(Config{Mode: Forced}); err != nil {
+		t.Fatal(err)
+	}
+	// Forced mode triggers a measurement for every read.
+	regs.Writes = nil
+	d.ReadTemperature()
+	if len(regs.Writes) != 1 || regs.Writes[0] != (i2cemu.RegWrite{Reg: RegPwrCtrl, Value: 0x17}) {
+		t.Errorf("forced read writes %v", regs.Writes)
+	}
+	d.Sleep()
+	if v, _ := regs.LastWrite(RegPwrCtrl); v != 0x03 {
+		t.Errorf("sleep wrote %02X", v)
+	}
+
+	for _, id := range []byte{ChipId, ChipId390, 0x58} {
+		regs.Regs[RegChipId] = id
+		if d.Connected() != (id != 0x58) {
+			t.Errorf("chip id %02X", id)
+		}
+	}
+	if _, err := d.ReadPressure(); err != ErrNotConnected {
+		t.Errorf("read from wrong chip: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package sensors
+
+import (
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/bmp581"
+)
+
+// BMP581 represents a BMP581 or BMP585 attached to the I2C bus and satisfies the PressureReader interface.
+type BMP581 struct {
+	pressurePoller
+	sensor *bmp581.BMP581
+}
+
+// NewBMP581 configures the BMP581 or BMP585 at address and begins reading it.
+func NewBMP581(i2cbus *embd.I2CBus, address byte, config bmp581.Config) (*BMP581, error) {
+	sensor := &bmp581.BMP581{Bus: i2cbus, Address: address}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &BMP581{sensor: sensor}
+	m.driver = sensor
+	m.sleep = sensor.Sleep
+	m.start(100 * time.Millisecond)
+	return m, nil
+}
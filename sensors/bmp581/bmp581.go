@@ -0,0 +1,123 @@
+package bmp581
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite  = errors.New("bmp581: failed to configure sensor, check connection")
+	errConfig       = errors.New("bmp581: oversampling doesn't fit the output data rate, try reducing ODR")
+	errNVM          = errors.New("bmp581: NVM not ready or in error after reset")
+	ErrNotConnected = errors.New("bmp581: not connected")
+)
+
+type Oversampling byte
+type Mode byte
+type OutputDataRate byte
+type FilterCoefficient byte
+type Config struct {
+	Pressure       Oversampling
+	Temperature    Oversampling
+	ODR            OutputDataRate
+	PressureIIR    FilterCoefficient
+	TemperatureIIR FilterCoefficient
+}
+
+// DefaultConfig is the datasheet's suggestion for drones: 50 Hz, low noise.
+var DefaultConfig = Config{Pressure: Sampling16X, Temperature: Sampling1X, ODR: Odr50, PressureIIR: Coeff3, TemperatureIIR: Coeff1}
+
+// BMP581 wraps the I2C connection and configuration values for the BMP581. Unlike the BMP388, the data registers
+// hold compensated values.
+type BMP581 struct {
+	Bus     *embd.I2CBus
+	Address uint8
+	Config  Config
+}
+
+// Configure resets the sensor and starts measurements in normal mode.
+func (d *BMP581) Configure(config Config) (err error) {
+	if config.Pressure > Sampling128X || config.Temperature > Sampling128X || config.ODR > 0x1F ||
+		config.PressureIIR > Coeff127 || config.TemperatureIIR > Coeff127 {
+		return errConfig
+	}
+	d.Config = config
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+	if err = d.writeRegister(RegCmd, SoftReset); err != nil {
+		return errConfigWrite
+	}
+	time.Sleep(2 * time.Millisecond)
+	status, err := d.readRegister(RegStatus, 1)
+	if err != nil || status[0]&(StatusNVMReady|StatusNVMError) != StatusNVMReady {
+		return errNVM
+	}
+	// Reading clears the power on reset flag.
+	if _, err = d.readRegister(RegIntStatus, 1); err != nil {
+		return errConfigWrite
+	}
+
+	// The configuration may only be changed in standby.
+	if err = d.writeRegister(RegODRConfig, ODRDeepDisable|byte(Standby)); err != nil {
+		return errConfigWrite
+	}
+	dsp, err := d.readRegister(RegDSPConfig, 1)
+	if err != nil {
+		return errConfigWrite
+	}
+	writes := [][2]byte{
+		{RegDSPConfig, dsp[0] | DSPShadowIIRT | DSPShadowIIRP},
+		{RegDSPIIR, byte(config.PressureIIR)<<3 | byte(config.TemperatureIIR)},
+		{RegOSRConfig, OSRPressEnable | byte(config.Pressure)<<3 | byte(config.Temperature)},
+		{RegODRConfig, ODRDeepDisable | byte(config.ODR)<<2 | byte(Normal)},
+	}
+	for _, w := range writes {
+		if err = d.writeRegister(w[0], w[1]); err != nil {
+			return errConfigWrite
+		}
+	}
+
+	eff, err := d.readRegister(RegOSREff, 1)
+	if err != nil {
+		return errConfigWrite
+	}
+	if eff[0]&OSREffValid == 0 {
+		return errConfig
+	}
+	return nil
+}
+
+// Connected is whether a BMP581 or BMP585 answers at the address.
+func (d *BMP581) Connected() bool {
+	data, err := d.readRegister(RegChipId, 1)
+	return err == nil && (data[0] == ChipId || data[0] == ChipId585)
+}
+
+// Read returns the latest temperature and pressure in degrees C and mbar.
+func (d *BMP581) Read() (temperature, pressure float64, err error) {
+	buf, err := d.readRegister(RegTemp, 6)
+	if err != nil {
+		return 0, 0, ErrNotConnected
+	}
+	rawTemp := int32(uint32(buf[2])<<24|uint32(buf[1])<<16|uint32(buf[0])<<8) >> 8 // Sign extend the 24 bits.
+	rawPress := uint32(buf[5])<<16 | uint32(buf[4])<<8 | uint32(buf[3])
+	return float64(rawTemp) / 65536, float64(rawPress) / 6400, nil
+}
+
+// Sleep puts the sensor into standby.
+func (d *BMP581) Sleep() error {
+	return d.writeRegister(RegODRConfig, ODRDeepDisable|byte(d.Config.ODR)<<2|byte(Standby))
+}
+
+func (d *BMP581) readRegister(register byte, len int) (data []byte, err error) {
+	data = make([]byte, len)
+	err = (*d.Bus).ReadFromReg(d.Address, register, data)
+	return
+}
+
+func (d *BMP581) writeRegister(register byte, data byte) error {
+	return (*d.Bus).WriteToReg(d.Address, register, []byte{data})
+}
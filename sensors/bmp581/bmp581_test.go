@@ -0,0 +1,119 @@
+package bmp581
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+func newTestBMP581() (*BMP581, *i2cemu.Registers) {
+	regs := i2cemu.NewRegisters(map[byte]byte{
+		RegChipId:    ChipId,
+		RegIntStatus: IntStatusPOR,
+		RegStatus:    StatusNVMReady,
+		RegDSPConfig: 0x21, // Reset value, must be kept.
+		RegOSREff:    OSREffValid,
+	})
+	regs.OnRead = func(r *i2cemu.Registers, reg byte) {
+		if reg == RegIntStatus {
+			r.Regs[RegIntStatus] = 0
+		}
+	}
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, regs)
+	return &BMP581{Bus: bus.I2CBus(), Address: Address}, regs
+}
+
+func TestBMP581Configure(t *testing.T) {
+	d, regs := newTestBMP581()
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		reg, want byte
+	}{
+		{"Reset", RegCmd, SoftReset},
+		{"DSP", RegDSPConfig, 0x2B},
+		{"IIR", RegDSPIIR, 0x11},
+		{"OSR", RegOSRConfig, 0x60},
+		{"ODR", RegODRConfig, 0xBD},
+	}
+	for _, tt := range tests {
+		if v, ok := regs.LastWrite(tt.reg); !ok || v != tt.want {
+			t.Errorf("%s: %02X, want %02X", tt.name, v, tt.want)
+		}
+	}
+	// Configured in standby.
+	var modes []byte
+	for _, w := range regs.Writes {
+		if w.Reg == RegODRConfig {
+			modes = append(modes, w.Value&0x03)
+		}
+	}
+	if len(modes) != 2 || modes[0] != byte(Standby) || modes[1] != byte(Normal) {
+		t.Errorf("power modes %v", modes)
+	}
+	if regs.Regs[RegIntStatus] != 0 {
+		t.Errorf("POR flag not cleared")
+	}
+
+	d.Sleep()
+	if regs.Regs[RegODRConfig]&0x03 != byte(Standby) {
+		t.Errorf("not in standby after Sleep")
+	}
+}
+
+func TestBMP581Read(t *testing.T) {
+	tests := []struct {
+		name      string
+		regs      []byte
+		wantTemp  float64
+		wantPress float64
+	}{
+		// 21.5 C is 0x158000, 101325 Pa is 0x62F340.
+		{"Standard", []byte{0x00, 0x80, 0x15, 0x40, 0xF3, 0x62}, 21.5, 1013.25},
+		// -10.25 C is 0xF5C000.
+		{"Cold", []byte{0x00, 0xC0, 0xF5, 0x00, 0x00, 0x40}, -10.25, 655.36},
+	}
+	for _, tt := range tests {
+		d, regs := newTestBMP581()
+		regs.Set(RegTemp, tt.regs...)
+		temp, press, err := d.Read()
+		if err != nil || math.Abs(temp-tt.wantTemp) > 1e-9 || math.Abs(press-tt.wantPress) > 1e-9 {
+			t.Errorf("%s: %f C, %f mbar, %v", tt.name, temp, press, err)
+		}
+	}
+}
+
+func TestBMP581Errors(t *testing.T) {
+	d, regs := newTestBMP581()
+	regs.Regs[RegChipId] = ChipId585
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Errorf("BMP585: %v", err)
+	}
+
+	regs.Regs[RegOSREff] = 0
+	if err := d.Configure(Config{Pressure: Sampling128X, ODR: Odr240}); err != errConfig {
+		t.Errorf("oversampling too high for the rate: %v", err)
+	}
+	if err := d.Configure(Config{ODR: 0x20}); err != errConfig {
+		t.Errorf("invalid rate: %v", err)
+	}
+
+	regs.Regs[RegStatus] = StatusNVMReady | StatusNVMError
+	if err := d.Configure(DefaultConfig); err != errNVM {
+		t.Errorf("NVM error: %v", err)
+	}
+
+	// A BMP388 has its chip id at 0x00, 0x01 reads as 0.
+	regs.Regs[RegChipId] = 0
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("BMP388 accepted")
+	}
+	d.Address = AddressAlt
+	if _, _, err := d.Read(); err != ErrNotConnected {
+		t.Errorf("read from missing sensor: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package bmp581 provides a driver for Bosch's BMP581 (and BMP585) digital temperature & pressure sensor.
+// The datasheet can be found here: https://www.bosch-sensortec.com/media/boschsensortec/downloads/datasheets/bst-bmp581-ds004.pdf
+package bmp581
+
+const (
+	Address    byte = 0x47 // SDO high (default on most breakouts)
+	AddressAlt byte = 0x46 // SDO low
+)
+
+const (
+	RegChipId    byte = 0x01 // useful for checking the connection
+	RegRevId     byte = 0x02
+	RegTemp      byte = 0x1D // TEMP_DATA_XLSB..MSB, 24 bit two's complement, 65536 LSB/C
+	RegPress     byte = 0x20 // PRESS_DATA_XLSB..MSB, 24 bit unsigned, 64 LSB/Pa
+	RegIntStatus byte = 0x27 // power on reset complete flag, clears on read
+	RegStatus    byte = 0x28 // NVM status
+	RegDSPConfig byte = 0x30 // where the IIR filtered data goes
+	RegDSPIIR    byte = 0x31 // IIR filter coefficients
+	RegOSRConfig byte = 0x36 // oversampling and pressure enable
+	RegODRConfig byte = 0x37 // output data rate and power mode
+	RegOSREff    byte = 0x38 // effective oversampling, shows whether the ODR can be met
+	RegCmd       byte = 0x7E // miscellaneous command register
+)
+
+const (
+	ChipId         byte = 0x50 // correct response if reading from chip id register
+	ChipId585      byte = 0x51 // BMP585 is register compatible
+	SoftReset      byte = 0xB6 // command to reset all user configuration
+	IntStatusPOR   byte = 0x10
+	StatusNVMReady byte = 0x02
+	StatusNVMError byte = 0x04
+	DSPShadowIIRT  byte = 0x02 // data registers get the IIR filtered temperature
+	DSPShadowIIRP  byte = 0x08 // data registers get the IIR filtered pressure
+	OSRPressEnable byte = 0x40
+	ODRDeepDisable byte = 0x80
+	OSREffValid    byte = 0x80 // the configured oversampling fits the output data rate
+)
+
+// Power modes.
+const (
+	Standby Mode = iota
+	Normal
+	Forced
+	NonStop
+)
+
+// Increasing sampling rate increases precision but also the measurement time. The datasheet has a table of
+// suggested values for oversampling, output data rates, and iir filter coefficients by use case.
+const (
+	Sampling1X Oversampling = iota
+	Sampling2X
+	Sampling4X
+	Sampling8X
+	Sampling16X
+	Sampling32X
+	Sampling64X
+	Sampling128X
+)
+
+// Output data rates in Hz in normal mode (a selection of the 32 available).
+const (
+	Odr240 OutputDataRate = 0x00
+	Odr120 OutputDataRate = 0x08
+	Odr100 OutputDataRate = 0x0A
+	Odr50  OutputDataRate = 0x0F
+	Odr25  OutputDataRate = 0x14
+	Odr10  OutputDataRate = 0x17
+	Odr5   OutputDataRate = 0x18
+	Odr1   OutputDataRate = 0x1C
+)
+
+// IIR filter coefficients, higher values means steadier measurements but slower reaction times
+const (
+	Coeff0 FilterCoefficient = iota
+	Coeff1
+	Coeff3
+	Coeff7
+	Coeff15
+	Coeff31
+	Coeff63
+	Coeff127
+)
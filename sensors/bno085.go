@@ -0,0 +1,68 @@
+package sensors
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/bno085"
+)
+
+const standardGravity = 9.80665 // m/s² per G
+
+var errNoOrientation = errors.New("BNO085 has no reliable orientation")
+
+// BNO085 represents a CEVA BNO085 attached to the I2C bus. It satisfies the IMUReader interface with its
+// calibrated sensor reports, and the FusionReader interface with its rotation vector.
+type BNO085 struct {
+	imuPoller
+	sensor *bno085.BNO085
+	muData sync.Mutex
+	data   bno085.Data
+}
+
+// NewBNO085 configures the BNO085 at address and begins reading it.
+func NewBNO085(i2cbus *embd.I2CBus, address byte, config bno085.Config) (*BNO085, error) {
+	sensor := &bno085.BNO085{Bus: i2cbus, Address: address}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &BNO085{sensor: sensor}
+	m.sample = m.readSample
+	m.sleep = sensor.Sleep
+	m.start(imuPollInterval)
+	return m, nil
+}
+
+func (m *BNO085) readSample() (s imuSample) {
+	data, err := m.sensor.Read()
+	m.muData.Lock()
+	m.data = data
+	m.muData.Unlock()
+	if err != nil {
+		return imuSample{err: err, magErr: err}
+	}
+	if !data.HaveAccel || !data.HaveGyro {
+		s.err = errNoSample
+	}
+	if !data.HaveMag {
+		s.magErr = errNoSample
+	}
+	for i := 0; i < 3; i++ {
+		s.g[i] = data.Gyro[i] * 180 / math.Pi
+		s.a[i] = data.Accel[i] / standardGravity
+		s.m[i] = data.Mag[i]
+	}
+	return
+}
+
+// Orientation returns the BNO085's rotation vector, once the sensor hub trusts it.
+func (m *BNO085) Orientation() (q [4]float64, headingAccuracy float64, err error) {
+	m.muData.Lock()
+	defer m.muData.Unlock()
+	if !m.data.HaveRotation || m.data.RotationStatus == bno085.Unreliable {
+		return q, 0, errNoOrientation
+	}
+	return m.data.Quaternion, m.data.HeadingAccuracy * 180 / math.Pi, nil
+}
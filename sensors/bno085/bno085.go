@@ -0,0 +1,208 @@
+package bno085
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite  = errors.New("bno085: failed to configure sensor, check connection")
+	errConfig       = errors.New("bno085: invalid configuration")
+	errPacket       = errors.New("bno085: invalid packet")
+	ErrNotConnected = errors.New("bno085: not connected")
+)
+
+type Config struct {
+	Interval    time.Duration // Accelerometer, gyroscope and rotation vector report interval.
+	MagInterval time.Duration // Magnetometer report interval.
+}
+
+// DefaultConfig gives 100 motion reports and 40 magnetometer reports per second.
+var DefaultConfig = Config{Interval: 10 * time.Millisecond, MagInterval: 25 * time.Millisecond}
+
+// Data holds the latest reports of each kind.
+type Data struct {
+	Accel [3]float64 // m/s², including gravity
+	Gyro  [3]float64 // rad/s
+	Mag   [3]float64 // µT
+	// Quaternion (real, i, j, k) rotates the sensor frame into the world frame (east, north, up), north being
+	// magnetic north.
+	Quaternion      [4]float64
+	HeadingAccuracy float64 // Estimated heading accuracy of Quaternion, radians.
+	MagAccuracy     Accuracy
+	RotationStatus  Accuracy
+	// Which reports have been received since Configure.
+	HaveAccel, HaveGyro, HaveMag, HaveRotation bool
+}
+
+// BNO085 wraps the I2C connection, configuration values and SHTP state of the BNO085.
+type BNO085 struct {
+	Bus     *embd.I2CBus
+	Address uint8
+	Config  Config
+	Data    Data
+	seq     [6]byte
+	sleep   func(time.Duration)
+}
+
+// Configure resets the sensor hub and enables the accelerometer, gyroscope, magnetometer and rotation vector reports.
+func (d *BNO085) Configure(config Config) error {
+	if config.Interval <= 0 || config.MagInterval <= 0 || config.Interval > time.Second || config.MagInterval > time.Second {
+		return errConfig
+	}
+	d.Config = config
+	d.Data = Data{}
+	if d.sleep == nil {
+		d.sleep = time.Sleep
+	}
+
+	if err := d.writePacket(ChannelExecutable, []byte{ExecReset}); err != nil {
+		return ErrNotConnected
+	}
+	d.seq = [6]byte{}
+	d.sleep(300 * time.Millisecond) // Boot, the hub then sends its advertisement and a reset complete.
+	for n := 0; n < 32; n++ {
+		ch, _, err := d.readPacket()
+		if err != nil {
+			return ErrNotConnected
+		}
+		if ch < 0 {
+			break
+		}
+	}
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+
+	for _, f := range []struct {
+		report   byte
+		interval time.Duration
+	}{
+		{ReportAccelerometer, config.Interval},
+		{ReportGyroscope, config.Interval},
+		{ReportMagneticField, config.MagInterval},
+		{ReportRotationVector, config.Interval},
+	} {
+		if err := d.setFeature(f.report, f.interval); err != nil {
+			return errConfigWrite
+		}
+	}
+	return nil
+}
+
+// Connected is whether a sensor hub answers a product id request at the address.
+func (d *BNO085) Connected() bool {
+	if d.sleep == nil {
+		d.sleep = time.Sleep
+	}
+	if err := d.writePacket(ChannelControl, []byte{ReportProductIdRequest, 0}); err != nil {
+		return false
+	}
+	for n := 0; n < 20; n++ {
+		ch, payload, err := d.readPacket()
+		if err != nil {
+			return false
+		}
+		switch {
+		case ch < 0:
+			d.sleep(5 * time.Millisecond)
+		case ch == int(ChannelControl) && len(payload) > 0 && payload[0] == ReportProductIdResponse:
+			return true
+		case ch == int(ChannelReports):
+			d.parseReports(payload)
+		}
+	}
+	return false
+}
+
+// Read processes the pending reports and returns the latest data.
+func (d *BNO085) Read() (Data, error) {
+	for n := 0; n < 32; n++ {
+		ch, payload, err := d.readPacket()
+		if err != nil {
+			return d.Data, err
+		}
+		if ch < 0 {
+			break
+		}
+		if ch == int(ChannelReports) || ch == int(ChannelWake) {
+			d.parseReports(payload)
+		}
+	}
+	return d.Data, nil
+}
+
+// Sleep puts the sensor hub to sleep.
+func (d *BNO085) Sleep() error {
+	return d.writePacket(ChannelExecutable, []byte{ExecSleep})
+}
+
+func (d *BNO085) setFeature(report byte, interval time.Duration) error {
+	us := uint32(interval / time.Microsecond)
+	cmd := make([]byte, 17)
+	cmd[0] = ReportSetFeature
+	cmd[1] = report
+	cmd[5], cmd[6], cmd[7], cmd[8] = byte(us), byte(us>>8), byte(us>>16), byte(us>>24)
+	return d.writePacket(ChannelControl, cmd)
+}
+
+// parseReports decodes an input report packet, a sequence of timestamps and sensor reports.
+func (d *BNO085) parseReports(p []byte) {
+	q := func(i int, qpoint uint) float64 {
+		return float64(int16(uint16(p[i+1])<<8|uint16(p[i]))) / float64(int(1)<<qpoint)
+	}
+	for len(p) > 0 {
+		n, ok := reportLength[p[0]]
+		if !ok || len(p) < n {
+			return // Unknown report, its length is unknown too.
+		}
+		status := Accuracy(p[2] & 0x03)
+		switch p[0] {
+		case ReportAccelerometer:
+			d.Data.Accel = [3]float64{q(4, 8), q(6, 8), q(8, 8)}
+			d.Data.HaveAccel = true
+		case ReportGyroscope:
+			d.Data.Gyro = [3]float64{q(4, 9), q(6, 9), q(8, 9)}
+			d.Data.HaveGyro = true
+		case ReportMagneticField:
+			d.Data.Mag = [3]float64{q(4, 4), q(6, 4), q(8, 4)}
+			d.Data.MagAccuracy = status
+			d.Data.HaveMag = true
+		case ReportRotationVector:
+			d.Data.Quaternion = [4]float64{q(10, 14), q(4, 14), q(6, 14), q(8, 14)}
+			d.Data.HeadingAccuracy = q(12, 12)
+			d.Data.RotationStatus = status
+			d.Data.HaveRotation = true
+		}
+		p = p[n:]
+	}
+}
+
+// readPacket reads the header of the next packet, then the whole packet. Without a packet the channel is -1.
+func (d *BNO085) readPacket() (channel int, payload []byte, err error) {
+	hdr, err := (*d.Bus).ReadBytes(d.Address, 4)
+	if err != nil {
+		return -1, nil, err
+	}
+	n := int(uint16(hdr[0])|uint16(hdr[1])<<8) & 0x7FFF
+	if n == 0 {
+		return -1, nil, nil
+	}
+	if n < 4 || n > maxPacket {
+		return -1, nil, errPacket
+	}
+	p, err := (*d.Bus).ReadBytes(d.Address, n)
+	if err != nil {
+		return -1, nil, err
+	}
+	return int(p[2]), p[4:], nil
+}
+
+func (d *BNO085) writePacket(channel byte, payload []byte) error {
+	n := len(payload) + 4
+	p := append([]byte{byte(n), byte(n >> 8), channel, d.seq[channel]}, payload...)
+	d.seq[channel]++
+	return (*d.Bus).WriteBytes(d.Address, p)
+}
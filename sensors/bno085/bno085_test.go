@@ -0,0 +1,126 @@
+package bno085
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+// newTestBNO085 emulates the sensor hub's answers to a reset and a product id request, and records the
+// enabled features and their intervals in µs.
+func newTestBNO085() (*BNO085, *i2cemu.SHTP, map[byte]uint32) {
+	hub := &i2cemu.SHTP{}
+	features := make(map[byte]uint32)
+	hub.OnPacket = func(s *i2cemu.SHTP, channel byte, payload []byte) {
+		switch {
+		case channel == ChannelExecutable && payload[0] == ExecReset:
+			s.Queue(ChannelCommand, make([]byte, 272)) // Advertisement
+			s.Queue(ChannelExecutable, []byte{ExecResetComplete})
+		case channel == ChannelControl && payload[0] == ReportProductIdRequest:
+			s.Queue(ChannelControl, []byte{ReportProductIdResponse, 0, 3, 2, 0x54, 0x39, 0x62, 0x01, 7, 0, 0, 0, 0, 0, 0, 0})
+		case channel == ChannelControl && payload[0] == ReportSetFeature:
+			features[payload[1]] = uint32(payload[5]) | uint32(payload[6])<<8 | uint32(payload[7])<<16 | uint32(payload[8])<<24
+		}
+	}
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, hub)
+	return &BNO085{Bus: bus.I2CBus(), Address: Address, sleep: func(time.Duration) {}}, hub, features
+}
+
+func TestBNO085Configure(t *testing.T) {
+	d, hub, features := newTestBNO085()
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Received[0][2] != ChannelExecutable || hub.Received[0][4] != ExecReset {
+		t.Errorf("no reset: % X", hub.Received[0])
+	}
+	want := map[byte]uint32{
+		ReportAccelerometer:  10000,
+		ReportGyroscope:      10000,
+		ReportMagneticField:  25000,
+		ReportRotationVector: 10000,
+	}
+	for report, us := range want {
+		if features[report] != us {
+			t.Errorf("report %02X interval %d µs, want %d", report, features[report], us)
+		}
+	}
+	// Sequence numbers count per channel.
+	if last := hub.Received[len(hub.Received)-1]; last[3] != 4 {
+		t.Errorf("control channel sequence number %d", last[3])
+	}
+
+	for _, c := range []Config{{}, {Interval: time.Millisecond}, {Interval: time.Millisecond, MagInterval: 2 * time.Second}} {
+		if err := d.Configure(c); err != errConfig {
+			t.Errorf("%+v accepted", c)
+		}
+	}
+}
+
+func TestBNO085Read(t *testing.T) {
+	d, hub, _ := newTestBNO085()
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := d.Read(); err != nil || data.HaveAccel || data.HaveRotation {
+		t.Errorf("data before any report: %+v, %v", data, err)
+	}
+
+	hub.Queue(ChannelReports, []byte{
+		ReportBaseTimestamp, 0x10, 0, 0, 0,
+		ReportAccelerometer, 1, 0x03, 0, 0, 0, 0, 0, 0x00, 0x0A, // 0, 0, 2560 Q8
+		ReportGyroscope, 1, 0x03, 0, 0x00, 0x02, 0x00, 0xFE, 0, 0, // 512, -512, 0 Q9
+	})
+	hub.Queue(ChannelReports, []byte{
+		ReportBaseTimestamp, 0x10, 0, 0, 0,
+		ReportMagneticField, 1, 0x02, 0, 0x40, 0x01, 0, 0, 0xC0, 0xFE, // 320, 0, -320 Q4
+		ReportRotationVector, 1, 0x03, 0, 0, 0, 0, 0, 0x00, 0x20, 0x00, 0x20, 0x00, 0x10, // k, real 8192 Q14, 4096 Q12
+		0x7F, 1, 2, 3, // An unknown report ends the packet.
+	})
+	data, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.HaveAccel || !data.HaveGyro || !data.HaveMag || !data.HaveRotation {
+		t.Fatalf("reports missing: %+v", data)
+	}
+	if data.Accel != [3]float64{0, 0, 10} || data.Gyro != [3]float64{1, -1, 0} || data.Mag != [3]float64{20, 0, -20} {
+		t.Errorf("accel %v gyro %v mag %v", data.Accel, data.Gyro, data.Mag)
+	}
+	if data.Quaternion != [4]float64{0.5, 0, 0, 0.5} || data.HeadingAccuracy != 1 {
+		t.Errorf("quaternion %v accuracy %f", data.Quaternion, data.HeadingAccuracy)
+	}
+	if data.MagAccuracy != AccuracyMedium || data.RotationStatus != AccuracyHigh {
+		t.Errorf("status %d %d", data.MagAccuracy, data.RotationStatus)
+	}
+	if hub.Pending() != 0 {
+		t.Errorf("%d packets not read", hub.Pending())
+	}
+
+	// A truncated report is ignored.
+	hub.Queue(ChannelReports, []byte{ReportAccelerometer, 2, 0x03, 0, 0, 0})
+	if data, _ := d.Read(); data.Accel[2] != 10 {
+		t.Errorf("truncated report used: %v", data.Accel)
+	}
+
+	d.Sleep()
+	if last := hub.Received[len(hub.Received)-1]; last[2] != ChannelExecutable || last[4] != ExecSleep {
+		t.Errorf("not asleep: % X", last)
+	}
+}
+
+func TestBNO085NotConnected(t *testing.T) {
+	d, _, _ := newTestBNO085()
+	d.Address = AddressAlt
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("empty address accepted")
+	}
+	// Something at the address that isn't a sensor hub.
+	d, hub, _ := newTestBNO085()
+	hub.OnPacket = nil
+	if d.Connected() {
+		t.Errorf("silent device accepted")
+	}
+}
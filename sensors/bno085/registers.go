@@ -0,0 +1,75 @@
+// Package bno085 provides a driver for the CEVA (Hillcrest) BNO085/BNO080 9 axis IMU with on-chip sensor fusion.
+// The BNO085 has no registers, it talks the SH-2 protocol over SHTP packets.
+// The datasheet can be found here: https://www.ceva-ip.com/wp-content/uploads/2019/10/BNO080_085-Datasheet.pdf
+// and the SH-2 reference manual here: https://www.ceva-ip.com/wp-content/uploads/2019/10/SH-2-Reference-Manual.pdf
+package bno085
+
+const (
+	Address    byte = 0x4A // SA0 low
+	AddressAlt byte = 0x4B // SA0 high (Adafruit and SparkFun boards)
+)
+
+// SHTP channels.
+const (
+	ChannelCommand    byte = 0
+	ChannelExecutable byte = 1
+	ChannelControl    byte = 2 // SH-2 sensor hub control
+	ChannelReports    byte = 3 // input sensor reports
+	ChannelWake       byte = 4 // wake input sensor reports
+	ChannelGyroRV     byte = 5 // gyro integrated rotation vector
+)
+
+// Executable channel commands and responses.
+const (
+	ExecReset         byte = 1
+	ExecOn            byte = 2
+	ExecSleep         byte = 3
+	ExecResetComplete byte = 1
+)
+
+// SH-2 control and input report ids.
+const (
+	ReportProductIdRequest  byte = 0xF9
+	ReportProductIdResponse byte = 0xF8
+	ReportSetFeature        byte = 0xFD
+	ReportGetFeatureResp    byte = 0xFC
+	ReportBaseTimestamp     byte = 0xFB
+	ReportTimestampRebase   byte = 0xFA
+
+	ReportAccelerometer      byte = 0x01 // m/s², Q8
+	ReportGyroscope          byte = 0x02 // calibrated, rad/s, Q9
+	ReportMagneticField      byte = 0x03 // calibrated, µT, Q4
+	ReportLinearAcceleration byte = 0x04
+	ReportRotationVector     byte = 0x05 // unit quaternion, Q14, and heading accuracy in radians, Q12
+	ReportGravity            byte = 0x06
+	ReportGyroUncalibrated   byte = 0x07
+	ReportGameRotationVector byte = 0x08
+	ReportGeomagneticRV      byte = 0x09
+)
+
+// Report lengths including the 4 byte report header, for the reports the driver may see.
+var reportLength = map[byte]int{
+	ReportAccelerometer:      10,
+	ReportGyroscope:          10,
+	ReportMagneticField:      10,
+	ReportLinearAcceleration: 10,
+	ReportRotationVector:     14,
+	ReportGravity:            10,
+	ReportGyroUncalibrated:   16,
+	ReportGameRotationVector: 12,
+	ReportGeomagneticRV:      14,
+	ReportTimestampRebase:    5,
+	ReportBaseTimestamp:      5,
+}
+
+// Accuracy is the status of a report, as the sensor hub rates its calibration.
+type Accuracy byte
+
+const (
+	Unreliable Accuracy = iota
+	AccuracyLow
+	AccuracyMedium
+	AccuracyHigh
+)
+
+const maxPacket = 1024 // The largest packet the driver accepts, the advertisement is about 280 bytes.
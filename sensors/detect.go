@@ -0,0 +1,166 @@
+package sensors
+
+import (
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/bmi270"
+	"github.com/stratux/stratux/sensors/bmp388"
+	"github.com/stratux/stratux/sensors/bmp581"
+	"github.com/stratux/stratux/sensors/bno085"
+	"github.com/stratux/stratux/sensors/dps310"
+	"github.com/stratux/stratux/sensors/lps22hb"
+	"github.com/stratux/stratux/sensors/lsm6dso"
+	"github.com/stratux/stratux/sensors/lsm9ds1"
+	"github.com/stratux/stratux/sensors/ms5611"
+)
+
+// Pressure sensor models recognized by DetectPressureSensor.
+const (
+	PressureSensorBMP280  = "BMP280"
+	PressureSensorBMP388  = "BMP388"
+	PressureSensorBMP390  = "BMP390"
+	PressureSensorBMP581  = "BMP581"
+	PressureSensorDPS310  = "DPS310"
+	PressureSensorLPS22HB = "LPS22HB"
+	PressureSensorMS5611  = "MS5611"
+)
+
+const (
+	bmp280RegChipId = 0xD0
+	bmp280ChipId    = 0x58
+	bme280ChipId    = 0x60
+)
+
+// PressureSensorInfo identifies a pressure sensor found on the bus.
+type PressureSensorInfo struct {
+	Model   string
+	Address byte
+}
+
+// DetectPressureSensor probes the I2C bus for a supported pressure sensor by address and chip id.
+// Several sensors share the addresses 0x76/0x77, so the chip id registers are checked in an order where
+// reading one chip's id register can't be mistaken for another's.
+func DetectPressureSensor(i2cbus *embd.I2CBus) (info PressureSensorInfo, ok bool) {
+	bus := *i2cbus
+	for _, addr := range []byte{bmp581.Address, bmp581.AddressAlt} {
+		if v, err := bus.ReadByteFromReg(addr, bmp581.RegChipId); err == nil && (v == bmp581.ChipId || v == bmp581.ChipId585) {
+			return PressureSensorInfo{PressureSensorBMP581, addr}, true
+		}
+	}
+	for _, addr := range []byte{lps22hb.Address, lps22hb.AddressAlt} {
+		if v, err := bus.ReadByteFromReg(addr, lps22hb.RegWhoAmI); err == nil && v == lps22hb.WhoAmI {
+			return PressureSensorInfo{PressureSensorLPS22HB, addr}, true
+		}
+	}
+
+	var responding []byte
+	for _, addr := range []byte{0x76, 0x77} {
+		v, err := bus.ReadByteFromReg(addr, bmp388.RegChipId)
+		if err != nil {
+			continue
+		}
+		responding = append(responding, addr)
+		switch v {
+		case bmp388.ChipId:
+			return PressureSensorInfo{PressureSensorBMP388, addr}, true
+		case bmp388.ChipId390:
+			return PressureSensorInfo{PressureSensorBMP390, addr}, true
+		}
+		if v, err := bus.ReadByteFromReg(addr, dps310.RegProductId); err == nil && v == dps310.ProductId {
+			return PressureSensorInfo{PressureSensorDPS310, addr}, true
+		}
+		if v, err := bus.ReadByteFromReg(addr, bmp280RegChipId); err == nil && (v == bmp280ChipId || v == bme280ChipId) {
+			return PressureSensorInfo{PressureSensorBMP280, addr}, true
+		}
+		// The MS5611 has no id, but a PROM with a valid CRC is specific enough.
+		ms := ms5611.MS5611{Bus: i2cbus, Address: addr}
+		if ms.Connected() {
+			return PressureSensorInfo{PressureSensorMS5611, addr}, true
+		}
+	}
+	if len(responding) > 0 {
+		// Something answers where the BMP280 lives, early BMP280 samples have other chip ids.
+		return PressureSensorInfo{PressureSensorBMP280, responding[0]}, true
+	}
+	return info, false
+}
+
+// IMU models recognized by DetectIMU.
+const (
+	IMUSensorBMI270   = "BMI270"
+	IMUSensorBNO085   = "BNO085"
+	IMUSensorICM20948 = "ICM-20948"
+	IMUSensorLSM6DSO  = "LSM6DSO"
+	IMUSensorLSM9DS1  = "LSM9DS1"
+	IMUSensorMPU9250  = "MPU-9250"
+)
+
+// WHO_AM_I values to differentiate between the InvenSense IMUs, which the goflying drivers expect at 0x68.
+const (
+	invensenseAddress = 0x68
+	icmRegWhoAmI      = 0x00
+	icmWhoAmI         = 0xEA
+	mpuRegWhoAmI      = 0x75
+)
+
+var mpuWhoAmI = map[byte]bool{
+	0x71: true, // MPU-9250
+	0x73: true, // MPU-9255, seems to be compatible to 9250
+	0x70: true, // MPU-6500, seems to be same as 9250 but without magnetometer
+	0x68: true, // MPU-6000 and MPU-6050 (and MPU-9150)
+	0x75: true, // Unknown MPU found on recent batch of gy91 boards see discussion 182
+}
+
+// IMUInfo identifies an IMU found on the bus. MagAddress is only set for IMUs with a separately addressed
+// magnetometer.
+type IMUInfo struct {
+	Model      string
+	Address    byte
+	MagAddress byte
+}
+
+// DetectIMU probes the I2C bus for a supported IMU by address and WHO_AM_I/chip id.
+func DetectIMU(i2cbus *embd.I2CBus) (info IMUInfo, ok bool) {
+	bus := *i2cbus
+	for _, addr := range []byte{bno085.AddressAlt, bno085.Address} {
+		bno := bno085.BNO085{Bus: i2cbus, Address: addr}
+		if bno.Connected() {
+			return IMUInfo{Model: IMUSensorBNO085, Address: addr}, true
+		}
+	}
+	for _, addr := range []byte{lsm9ds1.Address, lsm9ds1.AddressAlt} {
+		v, err := bus.ReadByteFromReg(addr, lsm9ds1.RegWhoAmI) // Same register on the LSM6DSO.
+		if err != nil {
+			continue
+		}
+		switch v {
+		case lsm6dso.WhoAmI:
+			return IMUInfo{Model: IMUSensorLSM6DSO, Address: addr}, true
+		case lsm9ds1.WhoAmI:
+			for _, magAddr := range []byte{lsm9ds1.MagAddress, lsm9ds1.MagAddressAlt} {
+				if m, err := bus.ReadByteFromReg(magAddr, lsm9ds1.RegWhoAmI); err == nil && m == lsm9ds1.WhoAmIM {
+					return IMUInfo{Model: IMUSensorLSM9DS1, Address: addr, MagAddress: magAddr}, true
+				}
+			}
+		}
+	}
+	for _, addr := range []byte{bmi270.Address, bmi270.AddressAlt} {
+		// On the MPU-9250/6050 register 0x00 holds self test data, which can look like any chip id. Rule out
+		// the InvenSense IMUs by their WHO_AM_I first.
+		if addr == invensenseAddress {
+			if v, err := bus.ReadByteFromReg(addr, mpuRegWhoAmI); err == nil && mpuWhoAmI[v] {
+				return IMUInfo{Model: IMUSensorMPU9250, Address: addr}, true
+			}
+		}
+		v, err := bus.ReadByteFromReg(addr, icmRegWhoAmI) // Also the BMI270 chip id register.
+		if err != nil {
+			continue
+		}
+		switch {
+		case v == icmWhoAmI && addr == invensenseAddress:
+			return IMUInfo{Model: IMUSensorICM20948, Address: addr}, true
+		case v == bmi270.ChipId:
+			return IMUInfo{Model: IMUSensorBMI270, Address: addr}, true
+		}
+	}
+	return info, false
+}
@@ -0,0 +1,97 @@
+package sensors
+
+import (
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+	"github.com/stratux/stratux/sensors/ms5611"
+)
+
+// testMS5611 returns an emulated MS5611 with the datasheet's calibration.
+func testMS5611() *i2cemu.MS5611 {
+	prom := [8]uint16{0x0042, 40127, 36924, 23317, 23282, 33464, 28312, 0x1230}
+	prom[7] |= uint16(ms5611.CRC4(prom))
+	return &i2cemu.MS5611{PROM: prom, D1: 9085466, D2: 8569150}
+}
+
+func TestDetectPressureSensor(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices map[byte]i2cemu.Device
+		want    PressureSensorInfo
+		ok      bool
+	}{
+		{"Nothing", nil, PressureSensorInfo{}, false},
+		{"BMP388", map[byte]i2cemu.Device{0x76: i2cemu.NewRegisters(map[byte]byte{0x00: 0x50})}, PressureSensorInfo{PressureSensorBMP388, 0x76}, true},
+		{"BMP390", map[byte]i2cemu.Device{0x77: i2cemu.NewRegisters(map[byte]byte{0x00: 0x60})}, PressureSensorInfo{PressureSensorBMP390, 0x77}, true},
+		{"BMP280", map[byte]i2cemu.Device{0x77: i2cemu.NewRegisters(map[byte]byte{0xD0: 0x58})}, PressureSensorInfo{PressureSensorBMP280, 0x77}, true},
+		{"Unknown at 0x76", map[byte]i2cemu.Device{0x76: i2cemu.NewRegisters(nil)}, PressureSensorInfo{PressureSensorBMP280, 0x76}, true},
+		{"DPS310", map[byte]i2cemu.Device{0x77: i2cemu.NewRegisters(map[byte]byte{0x0D: 0x10})}, PressureSensorInfo{PressureSensorDPS310, 0x77}, true},
+		{"MS5611", map[byte]i2cemu.Device{0x77: testMS5611()}, PressureSensorInfo{PressureSensorMS5611, 0x77}, true},
+		{"LPS22HB", map[byte]i2cemu.Device{0x5D: i2cemu.NewRegisters(map[byte]byte{0x0F: 0xB1})}, PressureSensorInfo{PressureSensorLPS22HB, 0x5D}, true},
+		{"LPS22HH", map[byte]i2cemu.Device{0x5C: i2cemu.NewRegisters(map[byte]byte{0x0F: 0xB3})}, PressureSensorInfo{}, false},
+		{"BMP581", map[byte]i2cemu.Device{0x47: i2cemu.NewRegisters(map[byte]byte{0x01: 0x50})}, PressureSensorInfo{PressureSensorBMP581, 0x47}, true},
+		{"BMP585", map[byte]i2cemu.Device{0x46: i2cemu.NewRegisters(map[byte]byte{0x01: 0x51})}, PressureSensorInfo{PressureSensorBMP581, 0x46}, true},
+		{"BMP581 and BMP280", map[byte]i2cemu.Device{
+			0x47: i2cemu.NewRegisters(map[byte]byte{0x01: 0x50}),
+			0x76: i2cemu.NewRegisters(map[byte]byte{0xD0: 0x58}),
+		}, PressureSensorInfo{PressureSensorBMP581, 0x47}, true},
+		{"IMU only", map[byte]i2cemu.Device{0x68: i2cemu.NewRegisters(map[byte]byte{0x75: 0x71})}, PressureSensorInfo{}, false},
+	}
+	for _, tt := range tests {
+		bus := i2cemu.NewBus()
+		for addr, dev := range tt.devices {
+			bus.Attach(addr, dev)
+		}
+		got, ok := DetectPressureSensor(bus.I2CBus())
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: %+v %v, want %+v", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+func TestDetectIMU(t *testing.T) {
+	lsm9ds1Mag := func() i2cemu.Device { return i2cemu.NewRegisters(map[byte]byte{0x0F: 0x3D}) }
+	tests := []struct {
+		name    string
+		devices map[byte]i2cemu.Device
+		want    IMUInfo
+		ok      bool
+	}{
+		{"Nothing", nil, IMUInfo{}, false},
+		{"BNO085", map[byte]i2cemu.Device{0x4A: testBNO085()}, IMUInfo{IMUSensorBNO085, 0x4A, 0}, true},
+		{"BNO085 and MPU-9250", map[byte]i2cemu.Device{
+			0x4B: testBNO085(),
+			0x68: i2cemu.NewRegisters(map[byte]byte{0x75: 0x71}),
+		}, IMUInfo{IMUSensorBNO085, 0x4B, 0}, true},
+		{"LSM6DSO", map[byte]i2cemu.Device{0x6A: i2cemu.NewRegisters(map[byte]byte{0x0F: 0x6C})}, IMUInfo{IMUSensorLSM6DSO, 0x6A, 0}, true},
+		{"LSM9DS1", map[byte]i2cemu.Device{
+			0x6B: i2cemu.NewRegisters(map[byte]byte{0x0F: 0x68}),
+			0x1E: lsm9ds1Mag(),
+		}, IMUInfo{IMUSensorLSM9DS1, 0x6B, 0x1E}, true},
+		{"LSM9DS1 alternate addresses", map[byte]i2cemu.Device{
+			0x6A: i2cemu.NewRegisters(map[byte]byte{0x0F: 0x68}),
+			0x1C: lsm9ds1Mag(),
+		}, IMUInfo{IMUSensorLSM9DS1, 0x6A, 0x1C}, true},
+		{"LSM9DS1 without magnetometer", map[byte]i2cemu.Device{0x6B: i2cemu.NewRegisters(map[byte]byte{0x0F: 0x68})}, IMUInfo{}, false},
+		{"BMI270", map[byte]i2cemu.Device{0x69: i2cemu.NewRegisters(map[byte]byte{0x00: 0x24})}, IMUInfo{IMUSensorBMI270, 0x69, 0}, true},
+		{"ICM-20948", map[byte]i2cemu.Device{0x68: testICM20948()}, IMUInfo{IMUSensorICM20948, 0x68, 0}, true},
+		{"ICM-20948 at 0x69", map[byte]i2cemu.Device{0x69: testICM20948()}, IMUInfo{}, false},
+		{"MPU-9250", map[byte]i2cemu.Device{0x68: testMPU9250()}, IMUInfo{IMUSensorMPU9250, 0x68, 0}, true},
+		{"MPU-6050", map[byte]i2cemu.Device{0x68: i2cemu.NewRegisters(map[byte]byte{0x75: 0x68})}, IMUInfo{IMUSensorMPU9250, 0x68, 0}, true},
+		{"MPU-6050 with self test data like a BMI270 chip id", map[byte]i2cemu.Device{0x68: i2cemu.NewRegisters(map[byte]byte{0x00: 0x24, 0x75: 0x68})}, IMUInfo{IMUSensorMPU9250, 0x68, 0}, true},
+		{"BMI270 at 0x68", map[byte]i2cemu.Device{0x68: i2cemu.NewRegisters(map[byte]byte{0x00: 0x24})}, IMUInfo{IMUSensorBMI270, 0x68, 0}, true},
+		{"Unknown at 0x68", map[byte]i2cemu.Device{0x68: i2cemu.NewRegisters(map[byte]byte{0x75: 0x12})}, IMUInfo{}, false},
+		{"Pressure sensor only", map[byte]i2cemu.Device{0x76: i2cemu.NewRegisters(map[byte]byte{0xD0: 0x58})}, IMUInfo{}, false},
+	}
+	for _, tt := range tests {
+		bus := i2cemu.NewBus()
+		for addr, dev := range tt.devices {
+			bus.Attach(addr, dev)
+		}
+		got, ok := DetectIMU(bus.I2CBus())
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: %+v %v, want %+v", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package sensors
+
+import (
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/dps310"
+)
+
+// DPS310 represents a DPS310 or DPS368 attached to the I2C bus and satisfies the PressureReader interface.
+type DPS310 struct {
+	pressurePoller
+	sensor *dps310.DPS310
+}
+
+// NewDPS310 configures the DPS310 or DPS368 at address and begins reading it.
+func NewDPS310(i2cbus *embd.I2CBus, address byte, config dps310.Config) (*DPS310, error) {
+	sensor := &dps310.DPS310{Bus: i2cbus, Address: address}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &DPS310{sensor: sensor}
+	m.driver = sensor
+	m.sleep = sensor.Sleep
+	m.start(100 * time.Millisecond)
+	return m, nil
+}
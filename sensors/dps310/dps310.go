@@ -0,0 +1,177 @@
+package dps310
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite  = errors.New("dps310: failed to configure sensor, check connection")
+	errConfig       = errors.New("dps310: measurements don't fit the rate, reduce the oversampling or rate")
+	errNotReady     = errors.New("dps310: sensor or coefficients not ready")
+	ErrNotConnected = errors.New("dps310: not connected")
+)
+
+type Oversampling byte
+type Rate byte
+
+type Config struct {
+	Pressure        Oversampling
+	Temperature     Oversampling
+	PressureRate    Rate
+	TemperatureRate Rate
+}
+
+// DefaultConfig gives 16 low noise pressure readings per second.
+var DefaultConfig = Config{Pressure: Sampling8X, Temperature: Sampling1X, PressureRate: Rate16, TemperatureRate: Rate4}
+
+// DPS310 wraps the I2C connection and configuration values for the DPS310.
+type DPS310 struct {
+	Bus     *embd.I2CBus
+	Address uint8
+	Config  Config
+	cali    calibrationCoefficients
+}
+
+type calibrationCoefficients struct {
+	c0, c1                  int32
+	c00, c10                int32
+	c01, c11, c20, c21, c30 int32
+}
+
+// scaleFactors are the compensation scale factors kT/kP by oversampling.
+var scaleFactors = [8]float64{524288, 1572864, 3670016, 7864320, 253952, 516096, 1040384, 2088960}
+
+// measurementTime is the time one measurement takes by oversampling, in ms.
+var measurementTime = [8]float64{3.6, 5.2, 8.4, 14.8, 27.6, 53.2, 104.4, 206.8}
+
+// twosComplement sign extends an n bit value.
+func twosComplement(v uint32, bits uint) int32 {
+	if v&(1<<(bits-1)) != 0 {
+		return int32(v) - int32(1<<bits)
+	}
+	return int32(v)
+}
+
+// Configure resets the sensor, reads its calibration coefficients and starts continuous measurements.
+func (d *DPS310) Configure(config Config) (err error) {
+	if config.Pressure > Sampling128X || config.Temperature > Sampling128X || config.PressureRate > Rate128 || config.TemperatureRate > Rate128 {
+		return errConfig
+	}
+	busy := float64(int(1)<<config.PressureRate)*measurementTime[config.Pressure] +
+		float64(int(1)<<config.TemperatureRate)*measurementTime[config.Temperature]
+	if busy >= 1000 {
+		return errConfig
+	}
+	d.Config = config
+
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+	if err = d.writeRegister(RegReset, SoftReset); err != nil {
+		return errConfigWrite
+	}
+	// Wait for the sensor to come back up and load its coefficients, 40 ms according to the datasheet.
+	ready := false
+	for n := 0; n < 10 && !ready; n++ {
+		time.Sleep(5 * time.Millisecond)
+		status, err := d.readRegister(RegMeasCfg, 1)
+		ready = err == nil && status[0]&(CoefReady|SensorReady) == CoefReady|SensorReady
+	}
+	if !ready {
+		return errNotReady
+	}
+
+	buf, err := d.readRegister(RegCoef, 18)
+	if err != nil {
+		return errConfigWrite
+	}
+	d.cali.c0 = twosComplement(uint32(buf[0])<<4|uint32(buf[1])>>4, 12)
+	d.cali.c1 = twosComplement(uint32(buf[1]&0x0F)<<8|uint32(buf[2]), 12)
+	d.cali.c00 = twosComplement(uint32(buf[3])<<12|uint32(buf[4])<<4|uint32(buf[5])>>4, 20)
+	d.cali.c10 = twosComplement(uint32(buf[5]&0x0F)<<16|uint32(buf[6])<<8|uint32(buf[7]), 20)
+	d.cali.c01 = int32(int16(uint16(buf[8])<<8 | uint16(buf[9])))
+	d.cali.c11 = int32(int16(uint16(buf[10])<<8 | uint16(buf[11])))
+	d.cali.c20 = int32(int16(uint16(buf[12])<<8 | uint16(buf[13])))
+	d.cali.c21 = int32(int16(uint16(buf[14])<<8 | uint16(buf[15])))
+	d.cali.c30 = int32(int16(uint16(buf[16])<<8 | uint16(buf[17])))
+
+	// The temperature has to be measured with the sensor the coefficients were calibrated with.
+	src, err := d.readRegister(RegCoefSource, 1)
+	if err != nil {
+		return errConfigWrite
+	}
+	tmpCfg := byte(config.TemperatureRate)<<4 | byte(config.Temperature)
+	if src[0]&0x80 != 0 {
+		tmpCfg |= TmpExternal
+	}
+	var cfg byte
+	if config.Pressure > Sampling8X {
+		cfg |= PrsShift
+	}
+	if config.Temperature > Sampling8X {
+		cfg |= TmpShift
+	}
+
+	writes := [][2]byte{
+		// Work around the chip bug where the temperature reads twice the real value (~60 C at room temperature)
+		// after a reset, as done by the Infineon reference driver.
+		{0x0E, 0xA5}, {0x0F, 0x96}, {0x62, 0x02}, {0x0E, 0x00}, {0x0F, 0x00},
+		{RegPrsCfg, byte(config.PressureRate)<<4 | byte(config.Pressure)},
+		{RegTmpCfg, tmpCfg},
+		{RegCfg, cfg},
+		{RegMeasCfg, ModeContinuous},
+	}
+	for _, w := range writes {
+		if err = d.writeRegister(w[0], w[1]); err != nil {
+			return errConfigWrite
+		}
+	}
+	return nil
+}
+
+// Connected is whether a DPS310 answers at the address.
+func (d *DPS310) Connected() bool {
+	data, err := d.readRegister(RegProductId, 1)
+	return err == nil && data[0] == ProductId
+}
+
+// Read returns the latest temperature and pressure in degrees C and mbar.
+func (d *DPS310) Read() (temperature, pressure float64, err error) {
+	buf, err := d.readRegister(RegPressure, 6)
+	if err != nil {
+		return 0, 0, ErrNotConnected
+	}
+	rawPress := twosComplement(uint32(buf[0])<<16|uint32(buf[1])<<8|uint32(buf[2]), 24)
+	rawTemp := twosComplement(uint32(buf[3])<<16|uint32(buf[4])<<8|uint32(buf[5]), 24)
+	temperature, pressure = d.compensate(rawPress, rawTemp)
+	return temperature, pressure / 100, nil
+}
+
+// compensate applies the datasheet's compensation, giving degrees C and Pa.
+func (d *DPS310) compensate(rawPress, rawTemp int32) (temperature, pressure float64) {
+	c := d.cali
+	t := float64(rawTemp) / scaleFactors[d.Config.Temperature]
+	p := float64(rawPress) / scaleFactors[d.Config.Pressure]
+	temperature = float64(c.c0)*0.5 + float64(c.c1)*t
+	pressure = float64(c.c00) + p*(float64(c.c10)+p*(float64(c.c20)+p*float64(c.c30))) +
+		t*float64(c.c01) + t*p*(float64(c.c11)+p*float64(c.c21))
+	return
+}
+
+// Sleep stops the measurements.
+func (d *DPS310) Sleep() error {
+	return d.writeRegister(RegMeasCfg, ModeIdle)
+}
+
+func (d *DPS310) readRegister(register byte, len int) (data []byte, err error) {
+	data = make([]byte, len)
+	err = (*d.Bus).ReadFromReg(d.Address, register, data)
+	return
+}
+
+func (d *DPS310) writeRegister(register byte, data byte) error {
+	return (*d.Bus).WriteToReg(d.Address, register, []byte{data})
+}
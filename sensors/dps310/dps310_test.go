@@ -0,0 +1,106 @@
+package dps310
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+// testCoefficients encodes c0 = 40, c1 = -8, c00 = 80000, c10 = -50000, c01 = -2000, c11 = 1000, c20 = -1000, c21 = 50, c30 = 100.
+var testCoefficients = []byte{
+	0x02, 0x8F, 0xF8, // c0, c1
+	0x13, 0x88, 0x0F, 0x3C, 0xB0, // c00, c10
+	0xF8, 0x30, 0x03, 0xE8, 0xFC, 0x18, 0x00, 0x32, 0x00, 0x64, // c01, c11, c20, c21, c30
+}
+
+func newTestDPS310() (*DPS310, *i2cemu.Registers) {
+	regs := i2cemu.NewRegisters(map[byte]byte{
+		RegProductId:  ProductId,
+		RegMeasCfg:    CoefReady | SensorReady,
+		RegCoefSource: 0x80,
+	})
+	regs.Set(RegCoef, testCoefficients...)
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, regs)
+	return &DPS310{Bus: bus.I2CBus(), Address: Address}, regs
+}
+
+func TestDPS310Configure(t *testing.T) {
+	d, regs := newTestDPS310()
+	if err := d.Configure(Config{Pressure: Sampling16X, Temperature: Sampling2X, PressureRate: Rate8, TemperatureRate: Rate1}); err != nil {
+		t.Fatal(err)
+	}
+	want := d.cali
+	if want != (calibrationCoefficients{40, -8, 80000, -50000, -2000, 1000, -1000, 50, 100}) {
+		t.Errorf("coefficients %+v", want)
+	}
+	tests := []struct {
+		name      string
+		reg, want byte
+	}{
+		{"Reset", RegReset, SoftReset},
+		{"Pressure", RegPrsCfg, 0x34},
+		{"Temperature", RegTmpCfg, 0x81},
+		{"Shift", RegCfg, PrsShift},
+		{"Mode", RegMeasCfg, ModeContinuous},
+	}
+	for _, tt := range tests {
+		if v, ok := regs.LastWrite(tt.reg); !ok || v != tt.want {
+			t.Errorf("%s: %02X, want %02X", tt.name, v, tt.want)
+		}
+	}
+
+	d.Sleep()
+	if regs.Regs[RegMeasCfg] != ModeIdle {
+		t.Errorf("not idle after Sleep")
+	}
+}
+
+func TestDPS310Read(t *testing.T) {
+	d, regs := newTestDPS310()
+	if err := d.Configure(Config{Pressure: Sampling16X, Temperature: Sampling2X, PressureRate: Rate8, TemperatureRate: Rate1}); err != nil {
+		t.Fatal(err)
+	}
+	// Scaled raw values of -0.5 (pressure, 16x) and 0.25 (temperature, 2x).
+	regs.Set(RegPressure, 0xFE, 0x10, 0x00, 0x06, 0x00, 0x00)
+	temp, press, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// T = 40 / 2 - 8 * 0.25 = 18 C.
+	// P = 80000 - 0.5 * (-50000 - 0.5 * (-1000 - 0.5 * 100)) + 0.25 * -2000 + 0.25 * -0.5 * (1000 - 0.5 * 50) = 104115.625 Pa.
+	if math.Abs(temp-18) > 1e-9 || math.Abs(press-1041.15625) > 1e-9 {
+		t.Errorf("%f C, %f mbar", temp, press)
+	}
+}
+
+func TestDPS310Errors(t *testing.T) {
+	d, regs := newTestDPS310()
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"Too slow", Config{Pressure: Sampling64X, PressureRate: Rate16}},
+		{"Invalid", Config{Pressure: 8}},
+	}
+	for _, tt := range tests {
+		if err := d.Configure(tt.config); err != errConfig {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	regs.Regs[RegMeasCfg] = SensorReady
+	if err := d.Configure(DefaultConfig); err != errNotReady {
+		t.Errorf("coefficients not ready: %v", err)
+	}
+
+	regs.Regs[RegProductId] = 0x58
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("wrong product id accepted")
+	}
+	d.Address = AddressAlt
+	if _, _, err := d.Read(); err != ErrNotConnected {
+		t.Errorf("read from missing sensor: %v", err)
+	}
+}
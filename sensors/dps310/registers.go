@@ -0,0 +1,58 @@
+// Package dps310 provides a driver for the Infineon DPS310 (and compatible DPS368) barometric pressure sensor.
+// The datasheet can be found here: https://www.infineon.com/dgdl/Infineon-DPS310-DataSheet-v01_02-EN.pdf
+package dps310
+
+const (
+	Address    byte = 0x77 // SDO high (default)
+	AddressAlt byte = 0x76 // SDO low
+)
+
+const (
+	RegPressure   byte = 0x00 // PSR_B2..B0, 24 bit two's complement
+	RegTemp       byte = 0x03 // TMP_B2..B0, 24 bit two's complement
+	RegPrsCfg     byte = 0x06 // pressure rate and oversampling
+	RegTmpCfg     byte = 0x07 // temperature sensor, rate and oversampling
+	RegMeasCfg    byte = 0x08 // status and measurement mode
+	RegCfg        byte = 0x09 // interrupts, result shifts, FIFO
+	RegReset      byte = 0x0C // soft reset and FIFO flush
+	RegProductId  byte = 0x0D // product and revision id
+	RegCoef       byte = 0x10 // 18 bytes of calibration coefficients
+	RegCoefSource byte = 0x28 // temperature sensor used for the calibration
+)
+
+const (
+	ProductId      byte = 0x10 // correct response if reading from product id register
+	SoftReset      byte = 0x09
+	CoefReady      byte = 0x80
+	SensorReady    byte = 0x40
+	TmpExternal    byte = 0x80 // use the MEMS element temperature sensor
+	TmpShift       byte = 0x08 // must be set for temperature oversampling above 8x
+	PrsShift       byte = 0x04 // must be set for pressure oversampling above 8x
+	ModeIdle       byte = 0x00
+	ModeContinuous byte = 0x07 // continuous pressure and temperature
+)
+
+// Oversampling trades noise against measurement time. The DPS310 pressure noise is 0.5 Pa (5 cm) at 16x.
+const (
+	Sampling1X Oversampling = iota
+	Sampling2X
+	Sampling4X
+	Sampling8X
+	Sampling16X
+	Sampling32X
+	Sampling64X
+	Sampling128X
+)
+
+// Measurement rates in Hz in continuous mode. The rate times the measurement time of pressure and temperature
+// together must be below one second.
+const (
+	Rate1 Rate = iota
+	Rate2
+	Rate4
+	Rate8
+	Rate16
+	Rate32
+	Rate64
+	Rate128
+)
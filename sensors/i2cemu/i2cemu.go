@@ -0,0 +1,298 @@
+// Package i2cemu provides an in-memory I2C bus implementing embd.I2CBus, so sensor drivers can be tested
+// without hardware. Devices are attached at an address and see the raw I2C transfers: a register read is
+// a write of the register address followed by a read, a register write is a write of the register address
+// followed by the data.
+package i2cemu
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kidoman/embd"
+)
+
+// Device is a chip attached to the bus.
+type Device interface {
+	Write(data []byte) error // Write handles a write transfer.
+	Read(buf []byte) error   // Read fills buf from a read transfer.
+}
+
+// Bus is an emulated I2C bus. It satisfies embd.I2CBus, whose ReadByte/WriteByte signatures go vet's
+// stdmethods check complains about (CI only vets main and common).
+type Bus struct {
+	mu      sync.Mutex
+	devices map[byte]Device
+	closed  bool
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{devices: make(map[byte]Device)}
+}
+
+// I2CBus returns the bus as the interface pointer the drivers take.
+func (b *Bus) I2CBus() *embd.I2CBus {
+	var i2cbus embd.I2CBus = b
+	return &i2cbus
+}
+
+// Attach connects a device at addr, replacing any device already there.
+func (b *Bus) Attach(addr byte, dev Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices[addr] = dev
+}
+
+// Detach disconnects the device at addr.
+func (b *Bus) Detach(addr byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.devices, addr)
+}
+
+func (b *Bus) device(addr byte) (Device, error) {
+	if b.closed {
+		return nil, fmt.Errorf("i2cemu: bus closed")
+	}
+	dev, ok := b.devices[addr]
+	if !ok {
+		// What the Linux driver reports when nobody acknowledges the address.
+		return nil, fmt.Errorf("i2cemu: no device at 0x%02X: remote I/O error", addr)
+	}
+	return dev, nil
+}
+
+func (b *Bus) write(addr byte, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dev, err := b.device(addr)
+	if err != nil {
+		return err
+	}
+	return dev.Write(data)
+}
+
+func (b *Bus) read(addr byte, buf []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dev, err := b.device(addr)
+	if err != nil {
+		return err
+	}
+	return dev.Read(buf)
+}
+
+// writeRead is a combined transfer (repeated start), as used for register reads.
+func (b *Bus) writeRead(addr byte, data, buf []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dev, err := b.device(addr)
+	if err != nil {
+		return err
+	}
+	if err := dev.Write(data); err != nil {
+		return err
+	}
+	return dev.Read(buf)
+}
+
+// ReadByte reads a byte from the given address.
+func (b *Bus) ReadByte(addr byte) (byte, error) {
+	buf := make([]byte, 1)
+	err := b.read(addr, buf)
+	return buf[0], err
+}
+
+// ReadBytes reads a slice of bytes from the given address.
+func (b *Bus) ReadBytes(addr byte, num int) ([]byte, error) {
+	buf := make([]byte, num)
+	err := b.read(addr, buf)
+	return buf, err
+}
+
+// WriteByte writes a byte to the given address.
+func (b *Bus) WriteByte(addr, value byte) error {
+	return b.write(addr, []byte{value})
+}
+
+// WriteBytes writes a slice bytes to the given address.
+func (b *Bus) WriteBytes(addr byte, value []byte) error {
+	return b.write(addr, value)
+}
+
+// ReadFromReg reads len(value) bytes from the given address and register.
+func (b *Bus) ReadFromReg(addr, reg byte, value []byte) error {
+	return b.writeRead(addr, []byte{reg}, value)
+}
+
+// ReadByteFromReg reads a byte from the given address and register.
+func (b *Bus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	buf := make([]byte, 1)
+	err := b.ReadFromReg(addr, reg, buf)
+	return buf[0], err
+}
+
+// ReadWordFromReg reads a big endian word from the given address and register, like embd's Linux driver.
+func (b *Bus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	buf := make([]byte, 2)
+	err := b.ReadFromReg(addr, reg, buf)
+	return uint16(buf[0])<<8 | uint16(buf[1]), err
+}
+
+// WriteToReg writes len(value) bytes to the given address and register.
+func (b *Bus) WriteToReg(addr, reg byte, value []byte) error {
+	return b.write(addr, append([]byte{reg}, value...))
+}
+
+// WriteByteToReg writes a byte to the given address and register.
+func (b *Bus) WriteByteToReg(addr, reg, value byte) error {
+	return b.write(addr, []byte{reg, value})
+}
+
+// WriteWordToReg writes a big endian word to the given address and register.
+func (b *Bus) WriteWordToReg(addr, reg byte, value uint16) error {
+	return b.write(addr, []byte{reg, byte(value >> 8), byte(value)})
+}
+
+// Close releases the bus; all transfers fail afterwards.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+// Registers is a Device with a plain 256 byte register file and an auto-incrementing register pointer,
+// which is how most sensors behave. The hooks model registers with side effects.
+type Registers struct {
+	Regs    [256]byte
+	Writes  []RegWrite                          // Every register write, in order.
+	OnWrite func(r *Registers, reg, value byte) // Called after a register has been written.
+	OnRead  func(r *Registers, reg byte)        // Called before a register is read.
+	// AutoIncrement, if set, is the register address bit some chips use to ask for auto increment. The bit is
+	// stripped from the address, and without it multi byte transfers stay on the same register.
+	AutoIncrement byte
+	// FIFO lists registers the pointer doesn't move on from, like data FIFOs that are read or written in bursts.
+	FIFO map[byte]bool
+	ptr  byte
+	hold bool
+}
+
+// RegWrite is a logged register write.
+type RegWrite struct {
+	Reg, Value byte
+}
+
+// NewRegisters returns a register file with the given initial contents.
+func NewRegisters(init map[byte]byte) *Registers {
+	r := &Registers{}
+	for reg, v := range init {
+		r.Regs[reg] = v
+	}
+	return r
+}
+
+// Set stores values starting at reg, without invoking the hooks.
+func (r *Registers) Set(reg byte, values ...byte) {
+	for i, v := range values {
+		r.Regs[reg+byte(i)] = v
+	}
+}
+
+// Write sets the register pointer to data[0] and writes the rest of data from there.
+func (r *Registers) Write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	r.ptr = data[0]
+	r.hold = false
+	if r.AutoIncrement != 0 {
+		r.ptr &^= r.AutoIncrement
+		r.hold = data[0]&r.AutoIncrement == 0
+	}
+	for _, v := range data[1:] {
+		reg := r.ptr
+		r.Regs[reg] = v
+		r.Writes = append(r.Writes, RegWrite{reg, v})
+		if r.OnWrite != nil {
+			r.OnWrite(r, reg, v)
+		}
+		r.next()
+	}
+	return nil
+}
+
+// Read reads from the register pointer on.
+func (r *Registers) Read(buf []byte) error {
+	for i := range buf {
+		if r.OnRead != nil {
+			r.OnRead(r, r.ptr)
+		}
+		buf[i] = r.Regs[r.ptr]
+		r.next()
+	}
+	return nil
+}
+
+func (r *Registers) next() {
+	if !r.hold && !r.FIFO[r.ptr] {
+		r.ptr++
+	}
+}
+
+// LastWrite returns the value last written to reg, and whether it was written at all.
+func (r *Registers) LastWrite(reg byte) (byte, bool) {
+	for i := len(r.Writes) - 1; i >= 0; i-- {
+		if r.Writes[i].Reg == reg {
+			return r.Writes[i].Value, true
+		}
+	}
+	return 0, false
+}
+
+// Banked is a Device whose register file is switched by a bank select register, like the InvenSense
+// ICM-20948's REG_BANK_SEL. The select register is reachable from every bank.
+type Banked struct {
+	Banks     []*Registers
+	SelectReg byte
+	Shift     uint // Position of the bank number in the select register.
+	bank      int
+	ptr       byte
+}
+
+// NewBanked returns n empty banks switched by selectReg.
+func NewBanked(n int, selectReg byte, shift uint) *Banked {
+	b := &Banked{SelectReg: selectReg, Shift: shift}
+	for i := 0; i < n; i++ {
+		b.Banks = append(b.Banks, NewRegisters(nil))
+	}
+	return b
+}
+
+// Bank returns the selected bank number.
+func (b *Banked) Bank() int {
+	return b.bank
+}
+
+func (b *Banked) Write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	b.ptr = data[0]
+	for _, v := range data[1:] {
+		if b.ptr == b.SelectReg {
+			b.bank = int(v>>b.Shift) % len(b.Banks)
+		}
+		b.Banks[b.bank].Write([]byte{b.ptr, v})
+		b.ptr++
+	}
+	return nil
+}
+
+func (b *Banked) Read(buf []byte) error {
+	r := b.Banks[b.bank]
+	r.Write([]byte{b.ptr})
+	err := r.Read(buf)
+	b.ptr += byte(len(buf))
+	return err
+}
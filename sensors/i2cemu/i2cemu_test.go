@@ -0,0 +1,170 @@
+package i2cemu
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd"
+)
+
+var _ embd.I2CBus = (*Bus)(nil)
+
+func TestRegisters(t *testing.T) {
+	bus := NewBus()
+	regs := NewRegisters(map[byte]byte{0x0F: 0xB1, 0x28: 1, 0x29: 2, 0x2A: 3})
+	bus.Attach(0x5C, regs)
+
+	if v, err := bus.ReadByteFromReg(0x5C, 0x0F); err != nil || v != 0xB1 {
+		t.Errorf("ReadByteFromReg = %X, %v", v, err)
+	}
+	buf := make([]byte, 3)
+	if err := bus.ReadFromReg(0x5C, 0x28, buf); err != nil || buf[0] != 1 || buf[1] != 2 || buf[2] != 3 {
+		t.Errorf("ReadFromReg = %v, %v", buf, err)
+	}
+	if w, err := bus.ReadWordFromReg(0x5C, 0x28); err != nil || w != 0x0102 {
+		t.Errorf("ReadWordFromReg = %X, %v", w, err)
+	}
+
+	var hooked []byte
+	regs.OnWrite = func(r *Registers, reg, value byte) {
+		hooked = append(hooked, reg)
+	}
+	bus.WriteToReg(0x5C, 0x10, []byte{0x50, 0x10})
+	bus.WriteWordToReg(0x5C, 0x20, 0xABCD)
+	if regs.Regs[0x10] != 0x50 || regs.Regs[0x11] != 0x10 || regs.Regs[0x20] != 0xAB || regs.Regs[0x21] != 0xCD {
+		t.Errorf("registers not written: % X", regs.Regs[0x10:0x22])
+	}
+	if len(hooked) != 4 || hooked[1] != 0x11 {
+		t.Errorf("OnWrite called for %v", hooked)
+	}
+	if v, ok := regs.LastWrite(0x11); !ok || v != 0x10 {
+		t.Errorf("LastWrite = %X, %v", v, ok)
+	}
+	if _, ok := regs.LastWrite(0x12); ok {
+		t.Errorf("LastWrite of unwritten register")
+	}
+
+	// A plain read continues from the register pointer.
+	bus.WriteByte(0x5C, 0x29)
+	if v, err := bus.ReadByte(0x5C); err != nil || v != 2 {
+		t.Errorf("ReadByte = %X, %v", v, err)
+	}
+}
+
+func TestMissingDevice(t *testing.T) {
+	bus := NewBus()
+	if _, err := bus.ReadByteFromReg(0x76, 0); err == nil {
+		t.Errorf("read from empty address")
+	}
+	bus.Attach(0x76, NewRegisters(nil))
+	if _, err := bus.ReadByteFromReg(0x76, 0); err != nil {
+		t.Errorf("read from attached device: %v", err)
+	}
+	bus.Detach(0x76)
+	if err := bus.WriteByteToReg(0x76, 0, 0); err == nil {
+		t.Errorf("write to detached device")
+	}
+	bus.Attach(0x76, NewRegisters(nil))
+	bus.Close()
+	if _, err := bus.ReadBytes(0x76, 1); err == nil {
+		t.Errorf("read from closed bus")
+	}
+}
+
+func TestRegistersAutoIncrementBit(t *testing.T) {
+	bus := NewBus()
+	regs := NewRegisters(map[byte]byte{0x28: 1, 0x29: 2})
+	regs.AutoIncrement = 0x80
+	bus.Attach(0x1C, regs)
+
+	buf := make([]byte, 2)
+	bus.ReadFromReg(0x1C, 0x28, buf)
+	if buf[0] != 1 || buf[1] != 1 {
+		t.Errorf("read without the flag: % X", buf)
+	}
+	bus.ReadFromReg(0x1C, 0xA8, buf)
+	if buf[0] != 1 || buf[1] != 2 {
+		t.Errorf("read with the flag: % X", buf)
+	}
+	bus.WriteToReg(0x1C, 0xA0, []byte{5, 6})
+	if regs.Regs[0x20] != 5 || regs.Regs[0x21] != 6 {
+		t.Errorf("write with the flag: % X", regs.Regs[0x20:0x22])
+	}
+}
+
+func TestBanked(t *testing.T) {
+	bus := NewBus()
+	b := NewBanked(4, 0x7F, 4)
+	b.Banks[0].Set(0x00, 0xEA)
+	b.Banks[2].Set(0x00, 0x42)
+	bus.Attach(0x68, b)
+
+	if v, _ := bus.ReadByteFromReg(0x68, 0x00); v != 0xEA {
+		t.Errorf("bank 0 register 0 = %X", v)
+	}
+	bus.WriteByteToReg(0x68, 0x7F, 2<<4)
+	if b.Bank() != 2 {
+		t.Errorf("bank %d selected", b.Bank())
+	}
+	if v, _ := bus.ReadByteFromReg(0x68, 0x00); v != 0x42 {
+		t.Errorf("bank 2 register 0 = %X", v)
+	}
+	bus.WriteByteToReg(0x68, 0x14, 0x07)
+	if v, ok := b.Banks[2].LastWrite(0x14); !ok || v != 0x07 || b.Banks[0].Regs[0x14] != 0 {
+		t.Errorf("write went to the wrong bank")
+	}
+	bus.WriteByteToReg(0x68, 0x7F, 0)
+	if v, _ := bus.ReadByteFromReg(0x68, 0x00); v != 0xEA {
+		t.Errorf("back in bank 0, register 0 = %X", v)
+	}
+}
+
+func TestSHTP(t *testing.T) {
+	bus := NewBus()
+	s := &SHTP{}
+	var channels []byte
+	s.OnPacket = func(s *SHTP, channel byte, payload []byte) {
+		channels = append(channels, channel)
+		if channel == 2 && payload[0] == 0xF9 {
+			s.Queue(2, []byte{0xF8, 0x00, 3, 2})
+		}
+	}
+	bus.Attach(0x4A, s)
+
+	if hdr, _ := bus.ReadBytes(0x4A, 4); hdr[0] != 0 || hdr[1] != 0 {
+		t.Errorf("empty queue read % X", hdr)
+	}
+	bus.WriteBytes(0x4A, []byte{6, 0, 2, 0, 0xF9, 0})
+	if len(channels) != 1 || channels[0] != 2 || len(s.Received) != 1 {
+		t.Errorf("packet not received: %v", channels)
+	}
+	// The header is peeked, the full read takes the packet.
+	hdr, _ := bus.ReadBytes(0x4A, 4)
+	if hdr[0] != 8 || hdr[2] != 2 || s.Pending() != 1 {
+		t.Errorf("header % X, %d pending", hdr, s.Pending())
+	}
+	p, _ := bus.ReadBytes(0x4A, 8)
+	if p[4] != 0xF8 || p[6] != 3 || s.Pending() != 0 {
+		t.Errorf("packet % X, %d pending", p, s.Pending())
+	}
+	s.Queue(2, []byte{1})
+	if p, _ := bus.ReadBytes(0x4A, 5); p[3] != 1 {
+		t.Errorf("sequence number %d", p[3])
+	}
+}
+
+func TestRegistersFIFO(t *testing.T) {
+	bus := NewBus()
+	regs := NewRegisters(nil)
+	regs.FIFO = map[byte]bool{0x5E: true}
+	var data []byte
+	regs.OnWrite = func(r *Registers, reg, value byte) {
+		if reg == 0x5E {
+			data = append(data, value)
+		}
+	}
+	bus.Attach(0x68, regs)
+	bus.WriteToReg(0x68, 0x5E, []byte{1, 2, 3})
+	if len(data) != 3 || data[2] != 3 || regs.Regs[0x5F] != 0 {
+		t.Errorf("burst write to the FIFO: % X", data)
+	}
+}
@@ -0,0 +1,44 @@
+package i2cemu
+
+// MS5611 emulates the command interface of the TE MS5611 pressure sensor, which has no registers.
+// D1 and D2 are the raw pressure and temperature the conversions return.
+type MS5611 struct {
+	PROM     [8]uint16
+	D1, D2   uint32
+	Commands []byte // Every command received, in order.
+	cmd      byte
+	result   uint32
+}
+
+func (m *MS5611) Write(data []byte) error {
+	for _, cmd := range data {
+		m.cmd = cmd
+		m.Commands = append(m.Commands, cmd)
+		switch cmd & 0xF0 {
+		case 0x40:
+			m.result = m.D1
+		case 0x50:
+			m.result = m.D2
+		}
+	}
+	return nil
+}
+
+func (m *MS5611) Read(buf []byte) error {
+	var data []byte
+	switch {
+	case m.cmd == 0x00: // ADC read, 0 unless a conversion was started.
+		data = []byte{byte(m.result >> 16), byte(m.result >> 8), byte(m.result)}
+		m.result = 0
+	case m.cmd >= 0xA0 && m.cmd <= 0xAE: // PROM read
+		w := m.PROM[(m.cmd-0xA0)/2]
+		data = []byte{byte(w >> 8), byte(w)}
+	}
+	for i := range buf {
+		buf[i] = 0
+		if i < len(data) {
+			buf[i] = data[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package i2cemu
+
+// SHTP emulates the packet interface of the CEVA/Hillcrest sensor hubs (BNO080/BNO085), which have no registers.
+// Every transfer is an SHTP packet: a 4 byte header (little endian length including the header, channel,
+// sequence number) followed by the payload. A read returns the oldest queued packet from its start; a read
+// shorter than the packet only peeks, so the host can read the header first and then the whole packet.
+type SHTP struct {
+	Received [][]byte                                    // Every packet written by the host, header included.
+	OnPacket func(s *SHTP, channel byte, payload []byte) // Called for every packet written by the host.
+	queue    [][]byte
+	seq      [8]byte
+}
+
+// Queue adds a packet for the host to read.
+func (s *SHTP) Queue(channel byte, payload []byte) {
+	n := len(payload) + 4
+	p := append([]byte{byte(n), byte(n >> 8), channel, s.seq[channel&7]}, payload...)
+	s.seq[channel&7]++
+	s.queue = append(s.queue, p)
+}
+
+// Pending is the number of queued packets.
+func (s *SHTP) Pending() int {
+	return len(s.queue)
+}
+
+func (s *SHTP) Write(data []byte) error {
+	if len(data) < 4 {
+		return nil
+	}
+	p := append([]byte(nil), data...)
+	s.Received = append(s.Received, p)
+	n := int(uint16(p[0])|uint16(p[1])<<8) & 0x7FFF
+	if n > len(p) {
+		n = len(p)
+	}
+	if s.OnPacket != nil && n >= 4 {
+		s.OnPacket(s, p[2], p[4:n])
+	}
+	return nil
+}
+
+func (s *SHTP) Read(buf []byte) error {
+	for i := range buf {
+		buf[i] = 0
+	}
+	if len(s.queue) == 0 {
+		return nil // An empty header: nothing to read.
+	}
+	p := s.queue[0]
+	copy(buf, p)
+	if len(buf) >= len(p) {
+		s.queue = s.queue[1:]
+	}
+	return nil
+}
@@ -15,3 +15,10 @@ type IMUReader interface {
 	// Close stops reading the MPU.
 	Close()
 }
+
+// FusionReader is implemented by IMUs that run their own sensor fusion, such as the BNO085.
+type FusionReader interface {
+	// Orientation returns the rotation from the sensor frame to the world frame (east, north, up), north being
+	// magnetic north, as a quaternion (real, i, j, k), and the estimated heading accuracy in degrees.
+	Orientation() (q [4]float64, headingAccuracy float64, err error)
+}
@@ -0,0 +1,135 @@
+package sensors
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const imuPollInterval = 10 * time.Millisecond
+
+// imuSample is one reading of an IMU: angular rates in degrees per second, accelerations in G and the magnetic
+// field in µT, each in the chip's own axes.
+type imuSample struct {
+	t       time.Time
+	g, a, m [3]float64
+	err     error // Reading gyroscope/accelerometer.
+	magErr  error
+}
+
+// imuPoller reads an IMU periodically and implements the IMUReader interface on top of it. Like the goflying
+// drivers, Read averages the readings since the last call.
+type imuPoller struct {
+	sample  func() imuSample
+	sleep   func() error // Puts the sensor to sleep on Close, may be nil.
+	mu      sync.Mutex
+	last    imuSample
+	sum     imuSample
+	n, nMag int
+	running bool
+	stop    chan struct{}
+}
+
+var (
+	errIMUStopped = errors.New("IMU is not running")
+	errNoMag      = errors.New("IMU has no magnetometer")
+	errNoSample   = errors.New("IMU has no reading yet")
+)
+
+// start takes a first reading, so the values are valid right away, and then polls in the background.
+func (p *imuPoller) start(freq time.Duration) {
+	p.read()
+	p.running = true
+	p.stop = make(chan struct{})
+	go p.run(freq)
+}
+
+func (p *imuPoller) run(freq time.Duration) {
+	clock := time.NewTicker(freq)
+	defer clock.Stop()
+	for {
+		select {
+		case <-clock.C:
+			p.read()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *imuPoller) read() {
+	s := p.sample()
+	s.t = time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = s
+	if s.err != nil {
+		return
+	}
+	p.n++
+	for i := 0; i < 3; i++ {
+		p.sum.g[i] += s.g[i]
+		p.sum.a[i] += s.a[i]
+	}
+	if s.magErr == nil {
+		p.nMag++
+		for i := 0; i < 3; i++ {
+			p.sum.m[i] += s.m[i]
+		}
+	}
+}
+
+// Read returns the average (since last reading) time, Gyro X-Y-Z, Accel X-Y-Z, Mag X-Y-Z,
+// error reading Gyro/Accel, and error reading Mag.
+func (p *imuPoller) Read() (T int64, G1, G2, G3, A1, A2, A3, M1, M2, M3 float64, GAError, MagError error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, errIMUStopped, errIMUStopped
+	}
+	avg := p.last
+	if p.n > 0 {
+		avg.err = nil
+		for i := 0; i < 3; i++ {
+			avg.g[i] = p.sum.g[i] / float64(p.n)
+			avg.a[i] = p.sum.a[i] / float64(p.n)
+		}
+	}
+	if p.nMag > 0 {
+		avg.magErr = nil
+		for i := 0; i < 3; i++ {
+			avg.m[i] = p.sum.m[i] / float64(p.nMag)
+		}
+	}
+	p.sum, p.n, p.nMag = imuSample{}, 0, 0
+	return avg.values()
+}
+
+// ReadOne returns the most recent time, Gyro X-Y-Z, Accel X-Y-Z, Mag X-Y-Z,
+// error reading Gyro/Accel, and error reading Mag.
+func (p *imuPoller) ReadOne() (T int64, G1, G2, G3, A1, A2, A3, M1, M2, M3 float64, GAError, MagError error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, errIMUStopped, errIMUStopped
+	}
+	return p.last.values()
+}
+
+func (s imuSample) values() (T int64, G1, G2, G3, A1, A2, A3, M1, M2, M3 float64, GAError, MagError error) {
+	return s.t.UnixNano(), s.g[0], s.g[1], s.g[2], s.a[0], s.a[1], s.a[2], s.m[0], s.m[1], s.m[2], s.err, s.magErr
+}
+
+// Close stops reading the IMU.
+func (p *imuPoller) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return
+	}
+	p.running = false
+	close(p.stop)
+	if p.sleep != nil {
+		p.sleep()
+	}
+}
@@ -0,0 +1,299 @@
+package sensors
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/sensors/bmi270"
+	"github.com/stratux/stratux/sensors/bno085"
+	"github.com/stratux/stratux/sensors/i2cemu"
+	"github.com/stratux/stratux/sensors/lsm6dso"
+	"github.com/stratux/stratux/sensors/lsm9ds1"
+)
+
+func TestIMUPoller(t *testing.T) {
+	var s imuSample
+	slept := 0
+	p := &imuPoller{sample: func() imuSample { return s }, sleep: func() error { slept++; return nil }}
+	if _, _, _, _, _, _, _, _, _, _, err, _ := p.Read(); err != errIMUStopped {
+		t.Errorf("not started: %v", err)
+	}
+
+	s = imuSample{g: [3]float64{1, 0, 0}, a: [3]float64{0, 0, 1}, m: [3]float64{20, 0, -40}}
+	p.start(time.Hour)
+	s.g[0], s.m[0] = 3, 30
+	p.read()
+	_, g1, _, _, _, _, a3, m1, _, _, err, magErr := p.Read()
+	if g1 != 2 || a3 != 1 || m1 != 25 || err != nil || magErr != nil {
+		t.Errorf("average: g1 %f a3 %f m1 %f, %v %v", g1, a3, m1, err, magErr)
+	}
+
+	// Failed readings don't count. Without new readings, Read returns the last one.
+	s.magErr = errNoMag
+	p.read()
+	s.err = errors.New("bus error")
+	p.read()
+	_, g1, _, _, _, _, _, m1, _, _, err, magErr = p.Read()
+	if g1 != 3 || err != nil || magErr != errNoMag {
+		t.Errorf("with failed readings: g1 %f m1 %f, %v %v", g1, m1, err, magErr)
+	}
+	if _, _, _, _, _, _, _, _, _, _, err, _ := p.Read(); err == nil {
+		t.Errorf("no new readings, no error")
+	}
+	if _, _, _, _, _, _, _, _, _, _, err, _ := p.ReadOne(); err != s.err {
+		t.Errorf("ReadOne: %v", err)
+	}
+
+	p.Close()
+	p.Close()
+	if slept != 1 {
+		t.Errorf("put to sleep %d times", slept)
+	}
+	if _, _, _, _, _, _, _, _, _, _, err, _ := p.ReadOne(); err != errIMUStopped {
+		t.Errorf("closed: %v", err)
+	}
+}
+
+// testIMUValues checks the first reading of an IMUReader against angular rates in deg/s and accelerations in G.
+func testIMUValues(t *testing.T, name string, imu IMUReader, g, a [3]float64) {
+	t.Helper()
+	_, g1, g2, g3, a1, a2, a3, _, _, _, err, _ := imu.ReadOne()
+	got := [6]float64{g1, g2, g3, a1, a2, a3}
+	want := [6]float64{g[0], g[1], g[2], a[0], a[1], a[2]}
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > 0.01 {
+			t.Errorf("%s: gyro/accel %v, want %v", name, got, want)
+			break
+		}
+	}
+}
+
+func TestNewLSM6DSO(t *testing.T) {
+	regs := i2cemu.NewRegisters(map[byte]byte{lsm6dso.RegWhoAmI: lsm6dso.WhoAmI})
+	regs.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		r.Regs[lsm6dso.RegCtrl3C] &^= lsm6dso.Ctrl3SoftReset
+	}
+	// 10 deg/s roll at 8.75 mdps/LSB, 1 G at 0.122 mG/LSB.
+	regs.Set(lsm6dso.RegGyro, 0x77, 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x20)
+	bus := i2cemu.NewBus()
+	bus.Attach(lsm6dso.AddressAlt, regs)
+
+	if _, err := NewLSM6DSO(bus.I2CBus(), lsm6dso.Address, lsm6dso.DefaultConfig); err == nil {
+		t.Errorf("LSM6DSO at an empty address")
+	}
+	m, err := NewLSM6DSO(bus.I2CBus(), lsm6dso.AddressAlt, lsm6dso.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIMUValues(t, "LSM6DSO", m, [3]float64{10, 0, 0}, [3]float64{0, 0, 0.999})
+	if _, _, _, _, _, _, _, _, _, _, _, magErr := m.ReadOne(); magErr != errNoMag {
+		t.Errorf("LSM6DSO mag: %v", magErr)
+	}
+	m.Close()
+	if v, _ := regs.LastWrite(lsm6dso.RegCtrl1XL); v != 0 {
+		t.Errorf("LSM6DSO not powered down: CTRL1_XL %02X", v)
+	}
+}
+
+func TestNewLSM9DS1(t *testing.T) {
+	ag := i2cemu.NewRegisters(map[byte]byte{lsm9ds1.RegWhoAmI: lsm9ds1.WhoAmI})
+	ag.Set(lsm9ds1.RegGyro, 0x77, 0x04, 0, 0, 0, 0)  // 10 deg/s at 8.75 mdps/LSB
+	ag.Set(lsm9ds1.RegAccel, 0, 0, 0, 0, 0x00, 0x20) // 1 G at 0.122 mG/LSB
+	mag := i2cemu.NewRegisters(map[byte]byte{lsm9ds1.RegWhoAmI: lsm9ds1.WhoAmIM})
+	mag.AutoIncrement = lsm9ds1.RegAutoIncM
+	ag.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		r.Regs[lsm9ds1.RegCtrl8] &^= lsm9ds1.Ctrl8SoftReset
+	}
+	mag.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		r.Regs[lsm9ds1.RegCtrl2M] &^= lsm9ds1.Ctrl2MSoftRst
+	}
+	mag.Set(lsm9ds1.RegMag, 0xC5, 0x0D, 0, 0, 0x3B, 0xE4) // 49.35 µT north, -99.53 µT down at 0.14 mG/LSB
+	bus := i2cemu.NewBus()
+	bus.Attach(lsm9ds1.Address, ag)
+	bus.Attach(lsm9ds1.MagAddress, mag)
+
+	m, err := NewLSM9DS1(bus.I2CBus(), lsm9ds1.Address, lsm9ds1.MagAddress, lsm9ds1.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	testIMUValues(t, "LSM9DS1", m, [3]float64{10, 0, 0}, [3]float64{0, 0, 0.999})
+	_, _, _, _, _, _, _, m1, m2, m3, _, magErr := m.ReadOne()
+	if magErr != nil || math.Abs(m1-49.35) > 1e-9 || m2 != 0 || math.Abs(m3+99.526) > 1e-9 {
+		t.Errorf("LSM9DS1 mag %f %f %f, %v", m1, m2, m3, magErr)
+	}
+
+	bus.Detach(lsm9ds1.MagAddress)
+	if _, err := NewLSM9DS1(bus.I2CBus(), lsm9ds1.Address, lsm9ds1.MagAddress, lsm9ds1.DefaultConfig); err == nil {
+		t.Errorf("LSM9DS1 without magnetometer")
+	}
+}
+
+func TestNewBMI270(t *testing.T) {
+	regs := i2cemu.NewRegisters(map[byte]byte{bmi270.RegChipId: bmi270.ChipId})
+	regs.FIFO = map[byte]bool{bmi270.RegInitData: true}
+	regs.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		if reg == bmi270.RegInitCtrl && value == 1 {
+			r.Regs[bmi270.RegInternalStatus] = bmi270.InitOk
+		}
+	}
+	// 1 G at 8192 LSB/G, 10 deg/s at 131.2 LSB/deg/s.
+	regs.Set(bmi270.RegData, 0, 0, 0, 0, 0x00, 0x20, 0x1F, 0x05, 0, 0, 0, 0)
+	bus := i2cemu.NewBus()
+	bus.Attach(bmi270.Address, regs)
+
+	if _, err := NewBMI270(bus.I2CBus(), bmi270.Address, bmi270.DefaultConfig, nil); err == nil {
+		t.Errorf("BMI270 without configuration file")
+	}
+	m, err := NewBMI270(bus.I2CBus(), bmi270.Address, bmi270.DefaultConfig, make([]byte, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	testIMUValues(t, "BMI270", m, [3]float64{10, 0, 0}, [3]float64{0, 0, 1})
+	if _, _, _, _, _, _, _, _, _, _, _, magErr := m.ReadOne(); magErr != errNoMag {
+		t.Errorf("BMI270 mag: %v", magErr)
+	}
+}
+
+// testBNO085 emulates a sensor hub that answers resets and product id requests.
+func testBNO085() *i2cemu.SHTP {
+	return &i2cemu.SHTP{OnPacket: func(s *i2cemu.SHTP, channel byte, payload []byte) {
+		switch {
+		case channel == bno085.ChannelExecutable && payload[0] == bno085.ExecReset:
+			s.Queue(bno085.ChannelExecutable, []byte{bno085.ExecResetComplete})
+		case channel == bno085.ChannelControl && payload[0] == bno085.ReportProductIdRequest:
+			s.Queue(bno085.ChannelControl, []byte{bno085.ReportProductIdResponse, 0, 3, 2, 0x54, 0x39, 0x62, 0x01, 7, 0, 0, 0, 0, 0, 0, 0})
+		}
+	}}
+}
+
+func TestNewBNO085(t *testing.T) {
+	hub := testBNO085()
+	bus := i2cemu.NewBus()
+	bus.Attach(bno085.AddressAlt, hub)
+
+	m, err := NewBNO085(bus.I2CBus(), bno085.AddressAlt, bno085.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, _, _, _, _, _, _, _, _, _, err, _ := m.ReadOne(); err != errNoSample {
+		t.Errorf("reading before any report: %v", err)
+	}
+	if _, _, err := m.Orientation(); err != errNoOrientation {
+		t.Errorf("orientation before any report: %v", err)
+	}
+
+	hub.Queue(bno085.ChannelReports, []byte{
+		bno085.ReportAccelerometer, 1, 0x03, 0, 0, 0, 0, 0, 0xCE, 0x09, // 9.80 m/s² Q8
+		bno085.ReportGyroscope, 1, 0x03, 0, 0x59, 0x00, 0, 0, 0, 0, // 0.174 rad/s Q9
+		bno085.ReportMagneticField, 1, 0x03, 0, 0x20, 0x03, 0, 0, 0xC0, 0xF9, // 50, 0, -100 µT Q4
+		bno085.ReportRotationVector, 1, 0x02, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x40, 0x3C, 0x00, // identity, 0.0147 rad Q12
+	})
+	m.read()
+	testIMUValues(t, "BNO085", m, [3]float64{9.96, 0, 0}, [3]float64{0, 0, 0.9998})
+	if _, _, _, _, _, _, _, m1, _, m3, _, magErr := m.ReadOne(); m1 != 50 || m3 != -100 || magErr != nil {
+		t.Errorf("BNO085 mag %f %f, %v", m1, m3, magErr)
+	}
+	q, acc, err := m.Orientation()
+	if q != [4]float64{1, 0, 0, 0} || math.Abs(acc-0.84) > 0.01 || err != nil {
+		t.Errorf("orientation %v ±%f, %v", q, acc, err)
+	}
+
+	// An unreliable rotation vector isn't used.
+	hub.Queue(bno085.ChannelReports, []byte{bno085.ReportRotationVector, 2, 0x00, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x40, 0x3C, 0x00})
+	m.read()
+	if _, _, err := m.Orientation(); err != errNoOrientation {
+		t.Errorf("unreliable orientation: %v", err)
+	}
+}
+
+// testMPU9250 returns an emulated MPU-9250 level and rolling at 10 deg/s, with its magnetometer reading
+// 30, -30, 90 µT through the I2C master's external sensor registers.
+func testMPU9250() *i2cemu.Registers {
+	regs := i2cemu.NewRegisters(map[byte]byte{mpuRegWhoAmI: 0x71})
+	// Gyro bias calibration bursts into the DMP memory register.
+	regs.FIFO = map[byte]bool{0x6F: true, 0x74: true}
+	regs.Set(0x10, 0x80, 0x80, 0x80)       // Magnetometer sensitivity adjustment
+	regs.Set(0x3B, 0, 0, 0, 0, 0x20, 0x00) // 1 G at 8192 LSB/G
+	regs.Set(0x43, 0x05, 0x1F, 0, 0, 0, 0) // 10 deg/s at 131 LSB/deg/s
+	regs.Set(0x49, 0x00, 0x64, 0xFF, 0x9C, 0x01, 0x2C, 0)
+	return regs
+}
+
+func TestNewMPU9250(t *testing.T) {
+	regs := testMPU9250()
+	bus := i2cemu.NewBus()
+	bus.Attach(invensenseAddress, regs)
+
+	m, err := NewMPU9250(bus.I2CBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	time.Sleep(100 * time.Millisecond)
+	_, g1, g2, g3, a1, a2, a3, m1, m2, m3, err, magErr := m.Read()
+	if err != nil || magErr != nil {
+		t.Fatal(err, magErr)
+	}
+	if math.Abs(g1-10) > 0.01 || g2 != 0 || g3 != 0 || a1 != 0 || a2 != 0 || math.Abs(a3-1) > 0.001 {
+		t.Errorf("MPU-9250 gyro %f %f %f accel %f %f %f", g1, g2, g3, a1, a2, a3)
+	}
+	if math.Abs(m1-30) > 0.01 || math.Abs(m2+30) > 0.01 || math.Abs(m3-90) > 0.01 {
+		t.Errorf("MPU-9250 mag %f %f %f", m1, m2, m3)
+	}
+	// 50 Hz sample rate, 4 G range.
+	if v, _ := regs.LastWrite(0x19); v != 19 {
+		t.Errorf("SMPLRT_DIV %d", v)
+	}
+	if v, _ := regs.LastWrite(0x1C); v != 0x08 {
+		t.Errorf("ACCEL_CONFIG %02X", v)
+	}
+}
+
+// testICM20948 returns an emulated ICM-20948 level and rolling at 10 deg/s.
+func testICM20948() *i2cemu.Banked {
+	icm := i2cemu.NewBanked(4, 0x7F, 4)
+	icm.Banks[0].Set(icmRegWhoAmI, icmWhoAmI)
+	icm.Banks[0].Set(0x2D, 0, 0, 0, 0, 0x20, 0x00) // 1 G at 8192 LSB/G
+	icm.Banks[0].Set(0x33, 0x05, 0x1F, 0, 0, 0, 0) // 10 deg/s at 131 LSB/deg/s
+	return icm
+}
+
+func TestNewICM20948(t *testing.T) {
+	icm := testICM20948()
+	bus := i2cemu.NewBus()
+	bus.Attach(invensenseAddress, icm)
+
+	m, err := NewICM20948(bus.I2CBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	// Readings taken while the filters were set up in bank 2 are zero.
+	m.Read()
+	time.Sleep(100 * time.Millisecond)
+	_, g1, _, _, _, _, a3, _, _, _, err, magErr := m.Read()
+	if err != nil || math.Abs(g1-10) > 0.01 || math.Abs(a3-1) > 0.001 {
+		t.Errorf("ICM-20948 gyro %f accel %f, %v", g1, a3, err)
+	}
+	if magErr == nil {
+		t.Errorf("ICM-20948 magnetometer is disabled, no error")
+	}
+	// 50 Hz sample rate, 4 G range, set in bank 2.
+	if v, _ := icm.Banks[2].LastWrite(0x00); v != 21 {
+		t.Errorf("GYRO_SMPLRT_DIV %d", v)
+	}
+	if v, _ := icm.Banks[2].LastWrite(0x14); v&0x06 != 0x02 {
+		t.Errorf("ACCEL_CONFIG %02X", v)
+	}
+	if icm.Bank() != 0 {
+		t.Errorf("left in bank %d", icm.Bank())
+	}
+}
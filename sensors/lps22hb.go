@@ -0,0 +1,27 @@
+package sensors
+
+import (
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/lps22hb"
+)
+
+// LPS22HB represents a LPS22HB attached to the I2C bus and satisfies the PressureReader interface.
+type LPS22HB struct {
+	pressurePoller
+	sensor *lps22hb.LPS22HB
+}
+
+// NewLPS22HB configures the LPS22HB at address and begins reading it.
+func NewLPS22HB(i2cbus *embd.I2CBus, address byte, config lps22hb.Config) (*LPS22HB, error) {
+	sensor := &lps22hb.LPS22HB{Bus: i2cbus, Address: address}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &LPS22HB{sensor: sensor}
+	m.driver = sensor
+	m.sleep = sensor.Sleep
+	m.start(100 * time.Millisecond)
+	return m, nil
+}
@@ -0,0 +1,102 @@
+package lps22hb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite  = errors.New("lps22hb: failed to configure sensor, check connection")
+	errConfig       = errors.New("lps22hb: invalid configuration")
+	errSoftReset    = errors.New("lps22hb: failed to perform a soft reset")
+	ErrNotConnected = errors.New("lps22hb: not connected")
+)
+
+type DataRate byte
+type LowPass byte
+
+type Config struct {
+	ODR DataRate
+	LPF LowPass
+}
+
+// DefaultConfig gives 25 readings per second, filtered down to a bandwidth of ~3 Hz.
+var DefaultConfig = Config{ODR: Odr25, LPF: LPFOdr9}
+
+// LPS22HB wraps the I2C connection and configuration values for the LPS22HB.
+type LPS22HB struct {
+	Bus     *embd.I2CBus
+	Address uint8
+	Config  Config
+}
+
+// Configure resets the sensor and starts continuous measurements.
+func (d *LPS22HB) Configure(config Config) error {
+	if config.ODR == OneShot || config.ODR > Odr75 || config.LPF > LPFOdr20 {
+		return errConfig
+	}
+	d.Config = config
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+	if err := d.writeRegister(RegCtrl2, Ctrl2AddrInc|Ctrl2SoftReset); err != nil {
+		return errConfigWrite
+	}
+	reset := false
+	for n := 0; n < 10 && !reset; n++ {
+		v, err := d.readRegister(RegCtrl2, 1)
+		reset = err == nil && v[0]&Ctrl2SoftReset == 0
+		if !reset {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !reset {
+		return errSoftReset
+	}
+
+	ctrl1 := byte(config.ODR)<<4 | Ctrl1BDU
+	switch config.LPF {
+	case LPFOdr9:
+		ctrl1 |= Ctrl1LPFEnable
+	case LPFOdr20:
+		ctrl1 |= Ctrl1LPFEnable | Ctrl1LPFStrong
+	}
+	if err := d.writeRegister(RegCtrl1, ctrl1); err != nil {
+		return errConfigWrite
+	}
+	return nil
+}
+
+// Connected is whether an LPS22HB answers at the address.
+func (d *LPS22HB) Connected() bool {
+	data, err := d.readRegister(RegWhoAmI, 1)
+	return err == nil && data[0] == WhoAmI
+}
+
+// Read returns the latest temperature and pressure in degrees C and mbar.
+func (d *LPS22HB) Read() (temperature, pressure float64, err error) {
+	buf, err := d.readRegister(RegPressure, 5)
+	if err != nil {
+		return 0, 0, ErrNotConnected
+	}
+	rawPress := int32(uint32(buf[2])<<24|uint32(buf[1])<<16|uint32(buf[0])<<8) >> 8 // Sign extend the 24 bits.
+	rawTemp := int16(uint16(buf[4])<<8 | uint16(buf[3]))
+	return float64(rawTemp) / 100, float64(rawPress) / 4096, nil
+}
+
+// Sleep puts the sensor into power down.
+func (d *LPS22HB) Sleep() error {
+	return d.writeRegister(RegCtrl1, Ctrl1BDU)
+}
+
+func (d *LPS22HB) readRegister(register byte, len int) (data []byte, err error) {
+	data = make([]byte, len)
+	err = (*d.Bus).ReadFromReg(d.Address, register, data)
+	return
+}
+
+func (d *LPS22HB) writeRegister(register byte, data byte) error {
+	return (*d.Bus).WriteToReg(d.Address, register, []byte{data})
+}
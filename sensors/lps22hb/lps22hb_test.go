@@ -0,0 +1,91 @@
+package lps22hb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+func newTestLPS22HB() (*LPS22HB, *i2cemu.Registers) {
+	regs := i2cemu.NewRegisters(map[byte]byte{RegWhoAmI: WhoAmI, RegCtrl2: Ctrl2AddrInc})
+	// The soft reset bit clears itself.
+	regs.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		if reg == RegCtrl2 {
+			r.Regs[RegCtrl2] &^= Ctrl2SoftReset
+		}
+	}
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, regs)
+	return &LPS22HB{Bus: bus.I2CBus(), Address: Address}, regs
+}
+
+func TestLPS22HBConfigure(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		wantCtrl1 byte
+		wantErr   error
+	}{
+		{"Default", DefaultConfig, 0x3A, nil},
+		{"No filter", Config{ODR: Odr75}, 0x52, nil},
+		{"Strong filter", Config{ODR: Odr1, LPF: LPFOdr20}, 0x1E, nil},
+		{"One shot", Config{ODR: OneShot}, 0, errConfig},
+		{"Invalid rate", Config{ODR: 6}, 0, errConfig},
+	}
+	for _, tt := range tests {
+		d, regs := newTestLPS22HB()
+		if err := d.Configure(tt.config); err != tt.wantErr {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if v, _ := regs.LastWrite(RegCtrl1); v != tt.wantCtrl1 {
+			t.Errorf("%s: CTRL_REG1 %02X, want %02X", tt.name, v, tt.wantCtrl1)
+		}
+		if tt.wantErr == nil {
+			if v, _ := regs.LastWrite(RegCtrl2); v&Ctrl2SoftReset == 0 {
+				t.Errorf("%s: no soft reset", tt.name)
+			}
+		}
+	}
+}
+
+func TestLPS22HBRead(t *testing.T) {
+	tests := []struct {
+		name      string
+		regs      []byte
+		wantPress float64
+		wantTemp  float64
+	}{
+		// 0x3FF58D / 4096 hPa, 0x094C / 100 C.
+		{"Room", []byte{0x8D, 0xF5, 0x3F, 0x4C, 0x09}, 1023.3469, 23.80},
+		{"Below zero", []byte{0x00, 0x00, 0x30, 0xB4, 0xFE}, 768, -3.32},
+		// The 24 bit value is sign extended.
+		{"Negative", []byte{0x00, 0xF0, 0xFF, 0x00, 0x00}, -1, 0},
+	}
+	for _, tt := range tests {
+		d, regs := newTestLPS22HB()
+		regs.Set(RegPressure, tt.regs...)
+		temp, press, err := d.Read()
+		if err != nil || math.Abs(press-tt.wantPress) > 1e-4 || math.Abs(temp-tt.wantTemp) > 1e-9 {
+			t.Errorf("%s: %f C, %f mbar, %v", tt.name, temp, press, err)
+		}
+	}
+}
+
+func TestLPS22HBNotConnected(t *testing.T) {
+	d, regs := newTestLPS22HB()
+	regs.Regs[RegWhoAmI] = 0xB3 // LPS22HH
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("LPS22HH accepted")
+	}
+	regs.Regs[RegWhoAmI] = WhoAmI
+	regs.OnWrite = nil // The reset never completes.
+	if err := d.Configure(DefaultConfig); err != errSoftReset {
+		t.Errorf("stuck reset: %v", err)
+	}
+	d.Address = AddressAlt
+	if _, _, err := d.Read(); err != ErrNotConnected {
+		t.Errorf("read from missing sensor: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Package lps22hb provides a driver for the ST LPS22HB MEMS barometric pressure sensor.
+// The datasheet can be found here: https://www.st.com/resource/en/datasheet/lps22hb.pdf
+package lps22hb
+
+const (
+	Address    byte = 0x5C // SA0 low
+	AddressAlt byte = 0x5D // SA0 high
+)
+
+const (
+	RegWhoAmI   byte = 0x0F
+	RegCtrl1    byte = 0x10 // output data rate, low pass filter, block data update
+	RegCtrl2    byte = 0x11 // boot, address auto increment, soft reset, one shot
+	RegResConf  byte = 0x1A // low current mode
+	RegStatus   byte = 0x27 // data available flags
+	RegPressure byte = 0x28 // PRESS_OUT_XL, L, H: 24 bit two's complement, 4096 LSB/hPa
+	RegTemp     byte = 0x2B // TEMP_OUT_L, H: 16 bit two's complement, 100 LSB/C
+)
+
+const (
+	WhoAmI         byte = 0xB1 // correct response if reading from the WHO_AM_I register
+	Ctrl1LPFEnable byte = 0x08
+	Ctrl1LPFStrong byte = 0x04 // bandwidth ODR/20 instead of ODR/9
+	Ctrl1BDU       byte = 0x02 // don't update the output registers until all bytes have been read
+	Ctrl2AddrInc   byte = 0x10
+	Ctrl2SoftReset byte = 0x04
+)
+
+// Output data rates in Hz. The LPS22HB has no oversampling setting, the noise is set by the rate and low pass filter.
+const (
+	OneShot DataRate = iota
+	Odr1
+	Odr10
+	Odr25
+	Odr50
+	Odr75
+)
+
+// Low pass filter on the pressure output, the LPS22HB equivalent of an IIR filter.
+const (
+	LPFOff LowPass = iota
+	LPFOdr9
+	LPFOdr20
+)
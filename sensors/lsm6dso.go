@@ -0,0 +1,30 @@
+package sensors
+
+import (
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/lsm6dso"
+)
+
+// LSM6DSO represents an ST LSM6DSO attached to the I2C bus and satisfies the IMUReader interface.
+// It has no magnetometer.
+type LSM6DSO struct {
+	imuPoller
+	sensor *lsm6dso.LSM6DSO
+}
+
+// NewLSM6DSO configures the LSM6DSO at address and begins reading it.
+func NewLSM6DSO(i2cbus *embd.I2CBus, address byte, config lsm6dso.Config) (*LSM6DSO, error) {
+	sensor := &lsm6dso.LSM6DSO{Bus: i2cbus, Address: address}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &LSM6DSO{sensor: sensor}
+	m.sample = func() (s imuSample) {
+		s.g, s.a, s.err = sensor.Read()
+		s.magErr = errNoMag
+		return
+	}
+	m.sleep = sensor.Sleep
+	m.start(imuPollInterval)
+	return m, nil
+}
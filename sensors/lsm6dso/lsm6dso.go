@@ -0,0 +1,120 @@
+package lsm6dso
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite  = errors.New("lsm6dso: failed to configure sensor, check connection")
+	errConfig       = errors.New("lsm6dso: invalid configuration")
+	errSoftReset    = errors.New("lsm6dso: failed to perform a soft reset")
+	ErrNotConnected = errors.New("lsm6dso: not connected")
+)
+
+type DataRate byte
+type AccelRange byte
+type GyroRange byte
+
+type Config struct {
+	ODR   DataRate
+	Accel AccelRange
+	Gyro  GyroRange
+}
+
+// DefaultConfig matches the InvenSense IMUs: 104 readings per second, ±4 G and 250 °/s, accelerations filtered
+// down to ~26 Hz.
+var DefaultConfig = Config{ODR: Odr104, Accel: Accel4G, Gyro: Gyro250}
+
+// LSM6DSO wraps the I2C connection and configuration values for the LSM6DSO.
+type LSM6DSO struct {
+	Bus     *embd.I2CBus
+	Address uint8
+	Config  Config
+}
+
+// Configure resets the sensor and starts continuous measurements.
+func (d *LSM6DSO) Configure(config Config) error {
+	if config.ODR == PowerDown || config.ODR > Odr416 || config.Accel > Accel8G || config.Gyro > Gyro2000 {
+		return errConfig
+	}
+	d.Config = config
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+	if err := d.writeRegister(RegCtrl3C, Ctrl3AddrInc|Ctrl3SoftReset); err != nil {
+		return errConfigWrite
+	}
+	reset := false
+	for n := 0; n < 10 && !reset; n++ {
+		v, err := d.readRegister(RegCtrl3C, 1)
+		reset = err == nil && v[0]&Ctrl3SoftReset == 0
+		if !reset {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !reset {
+		return errSoftReset
+	}
+
+	for _, w := range [][2]byte{
+		{RegCtrl3C, Ctrl3BDU | Ctrl3AddrInc},
+		{RegCtrl8XL, 0},
+		{RegCtrl1XL, byte(config.ODR)<<4 | byte(config.Accel)<<2 | Ctrl1LPF2},
+		{RegCtrl2G, byte(config.ODR)<<4 | byte(config.Gyro)<<2},
+	} {
+		if err := d.writeRegister(w[0], w[1]); err != nil {
+			return errConfigWrite
+		}
+	}
+	return nil
+}
+
+// Connected is whether an LSM6DSO answers at the address.
+func (d *LSM6DSO) Connected() bool {
+	data, err := d.readRegister(RegWhoAmI, 1)
+	return err == nil && data[0] == WhoAmI
+}
+
+// Read returns the latest angular rates in degrees per second and accelerations in G.
+func (d *LSM6DSO) Read() (gyro, accel [3]float64, err error) {
+	buf, err := d.readRegister(RegGyro, 12)
+	if err != nil {
+		return gyro, accel, ErrNotConnected
+	}
+	gs, as := gyroSensitivity[d.Config.Gyro]/1000, accelSensitivity[d.Config.Accel]/1000
+	for i := 0; i < 3; i++ {
+		gyro[i] = float64(int16(uint16(buf[2*i+1])<<8|uint16(buf[2*i]))) * gs
+		accel[i] = float64(int16(uint16(buf[2*i+7])<<8|uint16(buf[2*i+6]))) * as
+	}
+	return gyro, accel, nil
+}
+
+// Temperature returns the die temperature in degrees C.
+func (d *LSM6DSO) Temperature() (float64, error) {
+	buf, err := d.readRegister(RegTemp, 2)
+	if err != nil {
+		return 0, ErrNotConnected
+	}
+	return 25 + float64(int16(uint16(buf[1])<<8|uint16(buf[0])))/256, nil
+}
+
+// Sleep powers down the accelerometer and the gyroscope.
+func (d *LSM6DSO) Sleep() error {
+	if err := d.writeRegister(RegCtrl1XL, 0); err != nil {
+		return err
+	}
+	return d.writeRegister(RegCtrl2G, 0)
+}
+
+func (d *LSM6DSO) readRegister(register byte, len int) (data []byte, err error) {
+	data = make([]byte, len)
+	err = (*d.Bus).ReadFromReg(d.Address, register, data)
+	return
+}
+
+func (d *LSM6DSO) writeRegister(register byte, data byte) error {
+	return (*d.Bus).WriteToReg(d.Address, register, []byte{data})
+}
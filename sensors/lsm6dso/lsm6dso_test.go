@@ -0,0 +1,99 @@
+package lsm6dso
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+func newTestLSM6DSO() (*LSM6DSO, *i2cemu.Registers) {
+	regs := i2cemu.NewRegisters(map[byte]byte{RegWhoAmI: WhoAmI, RegCtrl3C: Ctrl3AddrInc})
+	// The soft reset bit clears itself.
+	regs.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		if reg == RegCtrl3C {
+			r.Regs[RegCtrl3C] &^= Ctrl3SoftReset
+		}
+	}
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, regs)
+	return &LSM6DSO{Bus: bus.I2CBus(), Address: Address}, regs
+}
+
+func TestLSM6DSOConfigure(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           Config
+		wantXL, wantGyro byte
+		wantErr          error
+	}{
+		{"Default", DefaultConfig, 0x4A, 0x40, nil},
+		{"Aerobatic", Config{ODR: Odr208, Accel: Accel16G, Gyro: Gyro2000}, 0x56, 0x5C, nil},
+		{"Power down", Config{ODR: PowerDown}, 0, 0, errConfig},
+		{"Invalid rate", Config{ODR: 7}, 0, 0, errConfig},
+		{"Invalid range", Config{ODR: Odr104, Accel: 4}, 0, 0, errConfig},
+	}
+	for _, tt := range tests {
+		d, regs := newTestLSM6DSO()
+		if err := d.Configure(tt.config); err != tt.wantErr {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.wantErr != nil {
+			continue
+		}
+		xl, _ := regs.LastWrite(RegCtrl1XL)
+		g, _ := regs.LastWrite(RegCtrl2G)
+		if xl != tt.wantXL || g != tt.wantGyro {
+			t.Errorf("%s: CTRL1_XL %02X CTRL2_G %02X, want %02X %02X", tt.name, xl, g, tt.wantXL, tt.wantGyro)
+		}
+		if regs.Writes[0].Value&Ctrl3SoftReset == 0 {
+			t.Errorf("%s: no soft reset", tt.name)
+		}
+		if regs.Regs[RegCtrl3C]&Ctrl3BDU == 0 {
+			t.Errorf("%s: no block data update", tt.name)
+		}
+	}
+}
+
+func TestLSM6DSORead(t *testing.T) {
+	d, regs := newTestLSM6DSO()
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	// Gyro 1000, -1000, 0; accel 0, -16384, 8197.
+	regs.Set(RegGyro, 0xE8, 0x03, 0x18, 0xFC, 0, 0, 0, 0, 0x00, 0xC0, 0x05, 0x20)
+	regs.Set(RegTemp, 0x00, 0xFE)
+	gyro, accel, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [6]float64{8.75, -8.75, 0, 0, -1.998848, 1.000034}
+	got := [6]float64{gyro[0], gyro[1], gyro[2], accel[0], accel[1], accel[2]}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("read %v, want %v", got, want)
+			break
+		}
+	}
+	if temp, err := d.Temperature(); err != nil || temp != 23 {
+		t.Errorf("temperature %f, %v", temp, err)
+	}
+
+	d.Sleep()
+	if regs.Regs[RegCtrl1XL] != 0 || regs.Regs[RegCtrl2G] != 0 {
+		t.Errorf("not powered down")
+	}
+}
+
+func TestLSM6DSONotConnected(t *testing.T) {
+	d, regs := newTestLSM6DSO()
+	regs.Regs[RegWhoAmI] = 0x69 // LSM6DS3
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("LSM6DS3 accepted")
+	}
+	d.Address = AddressAlt
+	if _, _, err := d.Read(); err != ErrNotConnected {
+		t.Errorf("read from an empty address: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Package lsm6dso provides a driver for the ST LSM6DSO (and compatible LSM6DSOX) 6 axis accelerometer and gyroscope.
+// The datasheet can be found here: https://www.st.com/resource/en/datasheet/lsm6dso.pdf
+package lsm6dso
+
+const (
+	Address    byte = 0x6A // SA0 low
+	AddressAlt byte = 0x6B // SA0 high
+)
+
+const (
+	RegWhoAmI  byte = 0x0F
+	RegCtrl1XL byte = 0x10 // accelerometer data rate, full scale, second low pass filter
+	RegCtrl2G  byte = 0x11 // gyroscope data rate and full scale
+	RegCtrl3C  byte = 0x12 // reboot, block data update, address auto increment, soft reset
+	RegCtrl8XL byte = 0x17 // accelerometer filter bandwidth
+	RegStatus  byte = 0x1E // data available flags
+	RegTemp    byte = 0x20 // OUT_TEMP_L, H: 16 bit two's complement, 256 LSB/C, 0 is 25 C
+	RegGyro    byte = 0x22 // OUTX_L_G .. OUTZ_H_G, followed by the accelerometer
+	RegAccel   byte = 0x28 // OUTX_L_A .. OUTZ_H_A
+)
+
+const (
+	WhoAmI         byte = 0x6C // correct response if reading from the WHO_AM_I register
+	Ctrl1LPF2      byte = 0x02 // accelerometer second low pass filter, ODR/4 with CTRL8_XL at 0
+	Ctrl3BDU       byte = 0x40 // don't update the output registers until all bytes have been read
+	Ctrl3AddrInc   byte = 0x04
+	Ctrl3SoftReset byte = 0x01
+)
+
+// Output data rates in Hz, for both the accelerometer and the gyroscope.
+const (
+	PowerDown DataRate = iota
+	Odr12p5
+	Odr26
+	Odr52
+	Odr104
+	Odr208
+	Odr416
+)
+
+// Accelerometer full scale. The register encoding isn't in order of range.
+const (
+	Accel2G AccelRange = iota
+	Accel16G
+	Accel4G
+	Accel8G
+)
+
+// Gyroscope full scale in degrees per second.
+const (
+	Gyro250 GyroRange = iota
+	Gyro500
+	Gyro1000
+	Gyro2000
+)
+
+// Sensitivities in mg/LSB and mdps/LSB, indexed by range.
+var (
+	accelSensitivity = [4]float64{0.061, 0.488, 0.122, 0.244}
+	gyroSensitivity  = [4]float64{8.75, 17.5, 35, 70}
+)
@@ -0,0 +1,30 @@
+package sensors
+
+import (
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/lsm9ds1"
+)
+
+// LSM9DS1 represents an ST LSM9DS1 attached to the I2C bus and satisfies the IMUReader interface.
+type LSM9DS1 struct {
+	imuPoller
+	sensor *lsm9ds1.LSM9DS1
+}
+
+// NewLSM9DS1 configures the LSM9DS1 accelerometer/gyroscope at address and magnetometer at magAddress and
+// begins reading them.
+func NewLSM9DS1(i2cbus *embd.I2CBus, address, magAddress byte, config lsm9ds1.Config) (*LSM9DS1, error) {
+	sensor := &lsm9ds1.LSM9DS1{Bus: i2cbus, Address: address, MagAddress: magAddress}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &LSM9DS1{sensor: sensor}
+	m.sample = func() (s imuSample) {
+		s.g, s.a, s.err = sensor.Read()
+		s.m, s.magErr = sensor.ReadMag()
+		return
+	}
+	m.sleep = sensor.Sleep
+	m.start(imuPollInterval)
+	return m, nil
+}
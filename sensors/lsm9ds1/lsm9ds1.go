@@ -0,0 +1,166 @@
+package lsm9ds1
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errConfigWrite     = errors.New("lsm9ds1: failed to configure sensor, check connection")
+	errConfig          = errors.New("lsm9ds1: invalid configuration")
+	errSoftReset       = errors.New("lsm9ds1: failed to perform a soft reset")
+	ErrNotConnected    = errors.New("lsm9ds1: not connected")
+	ErrMagNotConnected = errors.New("lsm9ds1: magnetometer not connected")
+)
+
+type DataRate byte
+type AccelRange byte
+type GyroRange byte
+type MagDataRate byte
+type MagRange byte
+
+type Config struct {
+	ODR    DataRate
+	Accel  AccelRange
+	Gyro   GyroRange
+	MagODR MagDataRate
+	Mag    MagRange
+}
+
+// DefaultConfig matches the InvenSense IMUs: 119 readings per second, ±4 G and 245 °/s. The magnetometer
+// gives 40 readings per second at ±4 gauss, well above the ~0.65 gauss of the earth's field.
+var DefaultConfig = Config{ODR: Odr119, Accel: Accel4G, Gyro: Gyro245, MagODR: MagOdr40, Mag: Mag4}
+
+// LSM9DS1 wraps the I2C connections and configuration values for the LSM9DS1.
+type LSM9DS1 struct {
+	Bus        *embd.I2CBus
+	Address    uint8
+	MagAddress uint8
+	Config     Config
+}
+
+// Configure resets the accelerometer/gyroscope and the magnetometer and starts continuous measurements.
+func (d *LSM9DS1) Configure(config Config) error {
+	if config.ODR == PowerDown || config.ODR > Odr952 || config.Accel > Accel8G || config.Gyro > Gyro2000 ||
+		config.Gyro == 2 || config.MagODR > MagOdr80 || config.Mag > Mag16 {
+		return errConfig
+	}
+	d.Config = config
+	if !d.Connected() {
+		return ErrNotConnected
+	}
+	if !d.MagConnected() {
+		return ErrMagNotConnected
+	}
+
+	if err := d.writeRegister(d.Address, RegCtrl8, Ctrl8AddrInc|Ctrl8SoftReset); err != nil {
+		return errConfigWrite
+	}
+	if err := d.writeRegister(d.MagAddress, RegCtrl2M, Ctrl2MSoftRst); err != nil {
+		return errConfigWrite
+	}
+	reset := false
+	for n := 0; n < 10 && !reset; n++ {
+		v, err := d.readRegister(d.Address, RegCtrl8, 1)
+		m, errm := d.readRegister(d.MagAddress, RegCtrl2M, 1)
+		reset = err == nil && errm == nil && v[0]&Ctrl8SoftReset == 0 && m[0]&Ctrl2MSoftRst == 0
+		if !reset {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !reset {
+		return errSoftReset
+	}
+
+	for _, w := range [][3]byte{
+		{d.Address, RegCtrl8, Ctrl8BDU | Ctrl8AddrInc},
+		// The accelerometer runs at the gyroscope's rate, its anti-aliasing filter is set by the rate.
+		{d.Address, RegCtrl6XL, byte(config.ODR)<<5 | byte(config.Accel)<<3},
+		{d.Address, RegCtrl1G, byte(config.ODR)<<5 | byte(config.Gyro)<<3},
+		{d.MagAddress, RegCtrl1M, Ctrl1MTempComp | Ctrl1MUltraXY | byte(config.MagODR)<<2},
+		{d.MagAddress, RegCtrl2M, byte(config.Mag) << 5},
+		{d.MagAddress, RegCtrl4M, Ctrl4MUltraZ},
+		{d.MagAddress, RegCtrl5M, Ctrl5MBDU},
+		{d.MagAddress, RegCtrl3M, 0}, // Continuous conversion.
+	} {
+		if err := d.writeRegister(w[0], w[1], w[2]); err != nil {
+			return errConfigWrite
+		}
+	}
+	return nil
+}
+
+// Connected is whether the LSM9DS1 accelerometer/gyroscope answers at the address.
+func (d *LSM9DS1) Connected() bool {
+	data, err := d.readRegister(d.Address, RegWhoAmI, 1)
+	return err == nil && data[0] == WhoAmI
+}
+
+// MagConnected is whether the LSM9DS1 magnetometer answers at the magnetometer address.
+func (d *LSM9DS1) MagConnected() bool {
+	data, err := d.readRegister(d.MagAddress, RegWhoAmI, 1)
+	return err == nil && data[0] == WhoAmIM
+}
+
+// Read returns the latest angular rates in degrees per second and accelerations in G.
+func (d *LSM9DS1) Read() (gyro, accel [3]float64, err error) {
+	g, err := d.readRegister(d.Address, RegGyro, 6)
+	if err != nil {
+		return gyro, accel, ErrNotConnected
+	}
+	a, err := d.readRegister(d.Address, RegAccel, 6)
+	if err != nil {
+		return gyro, accel, ErrNotConnected
+	}
+	gs, as := gyroSensitivity[d.Config.Gyro]/1000, accelSensitivity[d.Config.Accel]/1000
+	for i := 0; i < 3; i++ {
+		gyro[i] = float64(int16(uint16(g[2*i+1])<<8|uint16(g[2*i]))) * gs
+		accel[i] = float64(int16(uint16(a[2*i+1])<<8|uint16(a[2*i]))) * as
+	}
+	return gyro, accel, nil
+}
+
+// ReadMag returns the latest magnetic field in µT, in the magnetometer's axes.
+func (d *LSM9DS1) ReadMag() (mag [3]float64, err error) {
+	m, err := d.readRegister(d.MagAddress, RegMag|RegAutoIncM, 6)
+	if err != nil {
+		return mag, ErrMagNotConnected
+	}
+	ms := magSensitivity[d.Config.Mag] / 10 // 1 mgauss is 0.1 µT
+	for i := 0; i < 3; i++ {
+		mag[i] = float64(int16(uint16(m[2*i+1])<<8|uint16(m[2*i]))) * ms
+	}
+	return mag, nil
+}
+
+// Temperature returns the die temperature in degrees C.
+func (d *LSM9DS1) Temperature() (float64, error) {
+	buf, err := d.readRegister(d.Address, RegTemp, 2)
+	if err != nil {
+		return 0, ErrNotConnected
+	}
+	return 25 + float64(int16(uint16(buf[1])<<8|uint16(buf[0])))/16, nil
+}
+
+// Sleep powers down the accelerometer, the gyroscope and the magnetometer.
+func (d *LSM9DS1) Sleep() error {
+	if err := d.writeRegister(d.Address, RegCtrl1G, 0); err != nil {
+		return err
+	}
+	if err := d.writeRegister(d.Address, RegCtrl6XL, 0); err != nil {
+		return err
+	}
+	return d.writeRegister(d.MagAddress, RegCtrl3M, Ctrl3MPowerOff)
+}
+
+func (d *LSM9DS1) readRegister(address, register byte, len int) (data []byte, err error) {
+	data = make([]byte, len)
+	err = (*d.Bus).ReadFromReg(address, register, data)
+	return
+}
+
+func (d *LSM9DS1) writeRegister(address, register byte, data byte) error {
+	return (*d.Bus).WriteToReg(address, register, []byte{data})
+}
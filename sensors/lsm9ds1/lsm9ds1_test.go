@@ -0,0 +1,116 @@
+package lsm9ds1
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+func newTestLSM9DS1() (*LSM9DS1, *i2cemu.Registers, *i2cemu.Registers) {
+	ag := i2cemu.NewRegisters(map[byte]byte{RegWhoAmI: WhoAmI, RegCtrl8: Ctrl8AddrInc})
+	mag := i2cemu.NewRegisters(map[byte]byte{RegWhoAmI: WhoAmIM})
+	mag.AutoIncrement = RegAutoIncM
+	// The soft reset bits clear themselves.
+	ag.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		if reg == RegCtrl8 {
+			r.Regs[RegCtrl8] &^= Ctrl8SoftReset
+		}
+	}
+	mag.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		if reg == RegCtrl2M {
+			r.Regs[RegCtrl2M] &^= Ctrl2MSoftRst
+		}
+	}
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, ag)
+	bus.Attach(MagAddress, mag)
+	return &LSM9DS1{Bus: bus.I2CBus(), Address: Address, MagAddress: MagAddress}, ag, mag
+}
+
+func TestLSM9DS1Configure(t *testing.T) {
+	tests := []struct {
+		name                 string
+		config               Config
+		wantXL, wantG, wantM byte
+		wantErr              error
+	}{
+		{"Default", DefaultConfig, 0x70, 0x60, 0xF8, nil},
+		{"Aerobatic", Config{ODR: Odr238, Accel: Accel16G, Gyro: Gyro2000, MagODR: MagOdr80, Mag: Mag8}, 0x88, 0x98, 0xFC, nil},
+		{"Power down", Config{ODR: PowerDown}, 0, 0, 0, errConfig},
+		{"Gyro range 2", Config{ODR: Odr119, Gyro: 2}, 0, 0, 0, errConfig},
+		{"Invalid mag range", Config{ODR: Odr119, Mag: 4}, 0, 0, 0, errConfig},
+	}
+	for _, tt := range tests {
+		d, ag, mag := newTestLSM9DS1()
+		if err := d.Configure(tt.config); err != tt.wantErr {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.wantErr != nil {
+			continue
+		}
+		xl, _ := ag.LastWrite(RegCtrl6XL)
+		g, _ := ag.LastWrite(RegCtrl1G)
+		m, _ := mag.LastWrite(RegCtrl1M)
+		if xl != tt.wantXL || g != tt.wantG || m != tt.wantM {
+			t.Errorf("%s: CTRL_REG6_XL %02X CTRL_REG1_G %02X CTRL_REG1_M %02X, want %02X %02X %02X",
+				tt.name, xl, g, m, tt.wantXL, tt.wantG, tt.wantM)
+		}
+		if v, _ := mag.LastWrite(RegCtrl2M); v != byte(tt.config.Mag)<<5 {
+			t.Errorf("%s: CTRL_REG2_M %02X", tt.name, v)
+		}
+		if mag.Regs[RegCtrl3M] != 0 || mag.Regs[RegCtrl5M] != Ctrl5MBDU || ag.Regs[RegCtrl8] != Ctrl8BDU|Ctrl8AddrInc {
+			t.Errorf("%s: magnetometer not continuous or no block data update", tt.name)
+		}
+	}
+}
+
+func TestLSM9DS1Read(t *testing.T) {
+	d, ag, mag := newTestLSM9DS1()
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	ag.Set(RegGyro, 0xE8, 0x03, 0, 0, 0x18, 0xFC)  // 1000, 0, -1000
+	ag.Set(RegAccel, 0, 0, 0x00, 0xC0, 0x05, 0x20) // 0, -16384, 8197
+	ag.Set(RegTemp, 0x20, 0x00)                    // 32
+	mag.Set(RegMag, 0xE8, 0x03, 0x00, 0x00, 0x18, 0xFC)
+
+	gyro, accel, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [6]float64{8.75, 0, -8.75, 0, -1.998848, 1.000034}
+	got := [6]float64{gyro[0], gyro[1], gyro[2], accel[0], accel[1], accel[2]}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("read %v, want %v", got, want)
+			break
+		}
+	}
+	// The register address must carry the auto increment bit, or all three axes read as X.
+	m, err := d.ReadMag()
+	if err != nil || math.Abs(m[0]-14) > 1e-9 || m[1] != 0 || math.Abs(m[2]+14) > 1e-9 {
+		t.Errorf("mag %v, %v", m, err)
+	}
+	if temp, err := d.Temperature(); err != nil || temp != 27 {
+		t.Errorf("temperature %f, %v", temp, err)
+	}
+
+	d.Sleep()
+	if ag.Regs[RegCtrl1G] != 0 || mag.Regs[RegCtrl3M] != Ctrl3MPowerOff {
+		t.Errorf("not powered down")
+	}
+}
+
+func TestLSM9DS1NotConnected(t *testing.T) {
+	d, _, mag := newTestLSM9DS1()
+	mag.Regs[RegWhoAmI] = 0
+	if !d.Connected() || d.MagConnected() || d.Configure(DefaultConfig) != ErrMagNotConnected {
+		t.Errorf("missing magnetometer accepted")
+	}
+	d.Address = AddressAlt
+	if d.Connected() || d.Configure(DefaultConfig) != ErrNotConnected {
+		t.Errorf("empty address accepted")
+	}
+}
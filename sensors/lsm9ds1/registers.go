@@ -0,0 +1,98 @@
+// Package lsm9ds1 provides a driver for the ST LSM9DS1 9 axis IMU. The accelerometer/gyroscope and the
+// magnetometer are separate I2C devices in the same package.
+// The datasheet can be found here: https://www.st.com/resource/en/datasheet/lsm9ds1.pdf
+package lsm9ds1
+
+const (
+	Address       byte = 0x6B // accelerometer and gyroscope, SDO_AG high (default on most boards)
+	AddressAlt    byte = 0x6A // SDO_AG low
+	MagAddress    byte = 0x1E // SDO_M high
+	MagAddressAlt byte = 0x1C // SDO_M low
+)
+
+// Accelerometer and gyroscope registers.
+const (
+	RegWhoAmI   byte = 0x0F
+	RegCtrl1G   byte = 0x10 // gyroscope data rate, full scale, bandwidth
+	RegTemp     byte = 0x15 // OUT_TEMP_L, H: 16 bit two's complement, 16 LSB/C, 0 is 25 C
+	RegStatus   byte = 0x17 // data available flags
+	RegGyro     byte = 0x18 // OUT_X_L_G .. OUT_Z_H_G
+	RegCtrl6XL  byte = 0x20 // accelerometer data rate, full scale, bandwidth
+	RegCtrl8    byte = 0x22 // reboot, block data update, address auto increment, soft reset
+	RegAccel    byte = 0x28 // OUT_X_L_XL .. OUT_Z_H_XL
+	RegCtrl1M   byte = 0x20 // magnetometer temperature compensation, XY performance, data rate
+	RegCtrl2M   byte = 0x21 // magnetometer full scale, reboot, soft reset
+	RegCtrl3M   byte = 0x22 // magnetometer operating mode
+	RegCtrl4M   byte = 0x23 // magnetometer Z performance
+	RegCtrl5M   byte = 0x24 // magnetometer block data update
+	RegStatusM  byte = 0x27
+	RegMag      byte = 0x28 // OUT_X_L_M .. OUT_Z_H_M
+	RegAutoIncM byte = 0x80 // the magnetometer only auto increments with this bit set in the register address
+)
+
+const (
+	WhoAmI         byte = 0x68 // correct response if reading from the accelerometer/gyroscope WHO_AM_I register
+	WhoAmIM        byte = 0x3D // correct response if reading from the magnetometer WHO_AM_I register
+	Ctrl8BDU       byte = 0x40 // don't update the output registers until all bytes have been read
+	Ctrl8AddrInc   byte = 0x04
+	Ctrl8SoftReset byte = 0x01
+	Ctrl1MTempComp byte = 0x80
+	Ctrl1MUltraXY  byte = 0x60 // ultra high performance on X and Y
+	Ctrl2MSoftRst  byte = 0x04
+	Ctrl3MPowerOff byte = 0x03
+	Ctrl4MUltraZ   byte = 0x0C // ultra high performance on Z
+	Ctrl5MBDU      byte = 0x40
+)
+
+// Output data rates in Hz of the gyroscope, the accelerometer runs at the same rate.
+const (
+	PowerDown DataRate = iota
+	Odr14p9
+	Odr59p5
+	Odr119
+	Odr238
+	Odr476
+	Odr952
+)
+
+// Accelerometer full scale. The register encoding isn't in order of range.
+const (
+	Accel2G AccelRange = iota
+	Accel16G
+	Accel4G
+	Accel8G
+)
+
+// Gyroscope full scale in degrees per second. 2 is not used.
+const (
+	Gyro245  GyroRange = 0
+	Gyro500  GyroRange = 1
+	Gyro2000 GyroRange = 3
+)
+
+// Magnetometer output data rates in Hz.
+const (
+	MagOdr0p625 MagDataRate = iota
+	MagOdr1p25
+	MagOdr2p5
+	MagOdr5
+	MagOdr10
+	MagOdr20
+	MagOdr40
+	MagOdr80
+)
+
+// Magnetometer full scale in gauss.
+const (
+	Mag4 MagRange = iota
+	Mag8
+	Mag12
+	Mag16
+)
+
+// Sensitivities in mg/LSB, mdps/LSB and mgauss/LSB, indexed by range.
+var (
+	accelSensitivity = [4]float64{0.061, 0.732, 0.122, 0.244}
+	gyroSensitivity  = [4]float64{8.75, 17.5, 0, 70}
+	magSensitivity   = [4]float64{0.14, 0.29, 0.43, 0.58}
+)
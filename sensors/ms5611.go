@@ -0,0 +1,26 @@
+package sensors
+
+import (
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/stratux/stratux/sensors/ms5611"
+)
+
+// MS5611 represents a MS5611 attached to the I2C bus and satisfies the PressureReader interface.
+type MS5611 struct {
+	pressurePoller
+	sensor *ms5611.MS5611
+}
+
+// NewMS5611 configures the MS5611 at address and begins reading it.
+func NewMS5611(i2cbus *embd.I2CBus, address byte, config ms5611.Config) (*MS5611, error) {
+	sensor := &ms5611.MS5611{Bus: i2cbus, Address: address}
+	if err := sensor.Configure(config); err != nil {
+		return nil, err
+	}
+	m := &MS5611{sensor: sensor}
+	m.driver = sensor
+	m.start(100 * time.Millisecond)
+	return m, nil
+}
@@ -0,0 +1,170 @@
+package ms5611
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	errPROM         = errors.New("ms5611: invalid PROM contents (CRC mismatch)")
+	errConfig       = errors.New("ms5611: invalid oversampling")
+	ErrNotConnected = errors.New("ms5611: not connected")
+)
+
+type Oversampling byte
+
+type Config struct {
+	Pressure    Oversampling
+	Temperature Oversampling // Temperature changes slowly, a low oversampling keeps the update rate up.
+}
+
+// DefaultConfig gives low noise pressure at about 45 readings per second.
+var DefaultConfig = Config{Pressure: OSR4096, Temperature: OSR1024}
+
+// MS5611 wraps the I2C connection and configuration values for the MS5611.
+type MS5611 struct {
+	Bus     *embd.I2CBus
+	Address uint8
+	Config  Config
+	prom    [8]uint16 // C0 (factory data), C1..C6 calibration coefficients, C7 (CRC)
+	sleep   func(time.Duration)
+}
+
+// conversionTime is the maximum ADC conversion time per oversampling, from the datasheet.
+func conversionTime(osr Oversampling) time.Duration {
+	switch osr {
+	case OSR256:
+		return 600 * time.Microsecond
+	case OSR512:
+		return 1170 * time.Microsecond
+	case OSR1024:
+		return 2280 * time.Microsecond
+	case OSR2048:
+		return 4540 * time.Microsecond
+	case OSR4096:
+		return 9040 * time.Microsecond
+	}
+	return 0
+}
+
+// Configure resets the sensor and reads its calibration PROM.
+func (d *MS5611) Configure(config Config) error {
+	if conversionTime(config.Pressure) == 0 || conversionTime(config.Temperature) == 0 {
+		return errConfig
+	}
+	d.Config = config
+	if d.sleep == nil {
+		d.sleep = time.Sleep
+	}
+	if err := (*d.Bus).WriteByte(d.Address, CmdReset); err != nil {
+		return ErrNotConnected
+	}
+	d.sleep(3 * time.Millisecond) // PROM reload after reset.
+	prom, err := d.readPROM()
+	if err != nil {
+		return err
+	}
+	d.prom = prom
+	return nil
+}
+
+// Connected is whether an MS5611 with a valid PROM answers at the address.
+func (d *MS5611) Connected() bool {
+	_, err := d.readPROM()
+	return err == nil
+}
+
+func (d *MS5611) readPROM() (prom [8]uint16, err error) {
+	for i := range prom {
+		if prom[i], err = (*d.Bus).ReadWordFromReg(d.Address, CmdPROMRead+byte(2*i)); err != nil {
+			return prom, ErrNotConnected
+		}
+	}
+	allSame := true
+	for _, w := range prom[1:] {
+		allSame = allSame && w == prom[0]
+	}
+	if allSame || CRC4(prom) != byte(prom[7]&0x0F) {
+		return prom, errPROM
+	}
+	return prom, nil
+}
+
+// CRC4 computes the PROM checksum, per TE application note AN520.
+func CRC4(prom [8]uint16) byte {
+	var rem uint16
+	prom[7] &= 0xFF00
+	for cnt := 0; cnt < 16; cnt++ {
+		if cnt%2 == 1 {
+			rem ^= prom[cnt>>1] & 0x00FF
+		} else {
+			rem ^= prom[cnt>>1] >> 8
+		}
+		for bit := 8; bit > 0; bit-- {
+			if rem&0x8000 != 0 {
+				rem = (rem << 1) ^ 0x3000
+			} else {
+				rem <<= 1
+			}
+		}
+	}
+	return byte((rem >> 12) & 0x0F)
+}
+
+func (d *MS5611) convert(cmd byte, osr Oversampling) (int64, error) {
+	if err := (*d.Bus).WriteByte(d.Address, cmd|byte(osr)); err != nil {
+		return 0, err
+	}
+	d.sleep(conversionTime(osr))
+	buf := make([]byte, 3)
+	if err := (*d.Bus).ReadFromReg(d.Address, CmdADCRead, buf); err != nil {
+		return 0, err
+	}
+	raw := int64(buf[0])<<16 | int64(buf[1])<<8 | int64(buf[2])
+	if raw == 0 {
+		// The ADC returns 0 if it was read during a conversion or no conversion was started.
+		return 0, errors.New("ms5611: conversion not ready")
+	}
+	return raw, nil
+}
+
+// Read converts temperature and pressure and returns them in degrees C and mbar.
+func (d *MS5611) Read() (temperature, pressure float64, err error) {
+	d2, err := d.convert(CmdConvertD2, d.Config.Temperature)
+	if err != nil {
+		return
+	}
+	d1, err := d.convert(CmdConvertD1, d.Config.Pressure)
+	if err != nil {
+		return
+	}
+	temp, press := d.compensate(d1, d2)
+	return float64(temp) / 100, float64(press) / 100, nil
+}
+
+// compensate applies the datasheet's first and second order compensation to raw pressure d1 and raw temperature d2,
+// giving the temperature in 0.01 degrees C and pressure in 0.01 mbar.
+func (d *MS5611) compensate(d1, d2 int64) (temp, press int64) {
+	c := d.prom
+	dT := d2 - int64(c[5])<<8
+	temp = 2000 + dT*int64(c[6])>>23
+	off := int64(c[2])<<16 + (int64(c[4])*dT)>>7
+	sens := int64(c[1])<<15 + (int64(c[3])*dT)>>8
+
+	if temp < 2000 {
+		t2 := (dT * dT) >> 31
+		off2 := 5 * (temp - 2000) * (temp - 2000) / 2
+		sens2 := 5 * (temp - 2000) * (temp - 2000) / 4
+		if temp < -1500 {
+			off2 += 7 * (temp + 1500) * (temp + 1500)
+			sens2 += 11 * (temp + 1500) * (temp + 1500) / 2
+		}
+		temp -= t2
+		off -= off2
+		sens -= sens2
+	}
+	press = (d1*sens>>21 - off) >> 15
+	return
+}
@@ -0,0 +1,107 @@
+package ms5611
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/sensors/i2cemu"
+)
+
+// datasheetPROM has the example calibration values of the datasheet, with a valid CRC.
+func datasheetPROM() [8]uint16 {
+	prom := [8]uint16{0x0042, 40127, 36924, 23317, 23282, 33464, 28312, 0x1230}
+	prom[7] |= uint16(CRC4(prom))
+	return prom
+}
+
+func newTestMS5611(f *i2cemu.MS5611) *MS5611 {
+	bus := i2cemu.NewBus()
+	bus.Attach(Address, f)
+	return &MS5611{Bus: bus.I2CBus(), Address: Address, sleep: func(time.Duration) {}}
+}
+
+func TestMS5611Read(t *testing.T) {
+	// The datasheet example: D1 9085466, D2 8569150 is 20.07 C, 1000.09 mbar.
+	f := &i2cemu.MS5611{PROM: datasheetPROM(), D1: 9085466, D2: 8569150}
+	d := newTestMS5611(f)
+	if err := d.Configure(Config{Pressure: OSR4096, Temperature: OSR256}); err != nil {
+		t.Fatal(err)
+	}
+	if f.Commands[0] != CmdReset {
+		t.Errorf("no reset: % X", f.Commands)
+	}
+	f.Commands = nil
+	temp, press, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(temp-20.07) > 1e-9 || math.Abs(press-1000.09) > 1e-9 {
+		t.Errorf("%.2f C, %.2f mbar", temp, press)
+	}
+	if len(f.Commands) != 4 || f.Commands[0] != CmdConvertD2|byte(OSR256) || f.Commands[2] != CmdConvertD1|byte(OSR4096) {
+		t.Errorf("commands % X", f.Commands)
+	}
+}
+
+func TestMS5611Compensate(t *testing.T) {
+	d := &MS5611{prom: datasheetPROM()}
+	tests := []struct {
+		name      string
+		d1, d2    int64
+		wantTemp  int64
+		wantPress int64
+	}{
+		{"Datasheet", 9085466, 8569150, 2007, 100009},
+		// Below 20 C the second order compensation kicks in.
+		{"Cold", 9085466, 8300000, 1066, 98189},
+		{"Very cold", 9085466, 7500000, -2130, 91910},
+	}
+	for _, tt := range tests {
+		temp, press := d.compensate(tt.d1, tt.d2)
+		if temp != tt.wantTemp || press != tt.wantPress {
+			t.Errorf("%s: %d, %d, want %d, %d", tt.name, temp, press, tt.wantTemp, tt.wantPress)
+		}
+	}
+}
+
+func TestMS5611PROM(t *testing.T) {
+	bad := datasheetPROM()
+	bad[3]++
+	tests := []struct {
+		name string
+		prom [8]uint16
+		ok   bool
+	}{
+		{"Valid", datasheetPROM(), true},
+		{"CRC mismatch", bad, false},
+		{"Blank", [8]uint16{}, false},
+		{"Erased", [8]uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}, false},
+	}
+	for _, tt := range tests {
+		d := newTestMS5611(&i2cemu.MS5611{PROM: tt.prom})
+		if err := d.Configure(DefaultConfig); (err == nil) != tt.ok || d.Connected() != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	// Nothing on the bus.
+	d := &MS5611{Bus: i2cemu.NewBus().I2CBus(), Address: Address}
+	if err := d.Configure(DefaultConfig); err != ErrNotConnected || d.Connected() {
+		t.Errorf("missing sensor: %v", err)
+	}
+	if err := d.Configure(Config{Pressure: 0x03}); err != errConfig {
+		t.Errorf("invalid oversampling: %v", err)
+	}
+}
+
+func TestMS5611ConversionNotReady(t *testing.T) {
+	f := &i2cemu.MS5611{PROM: datasheetPROM(), D2: 8569150}
+	d := newTestMS5611(f)
+	if err := d.Configure(DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Read(); err == nil {
+		t.Errorf("no error for an empty ADC result")
+	}
+}
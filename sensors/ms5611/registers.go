@@ -0,0 +1,27 @@
+// Package ms5611 provides a driver for the TE Connectivity MS5611-01BA03 barometric pressure sensor.
+// The datasheet can be found here: https://www.te.com/commerce/DocumentDelivery/DDEController?Action=showdoc&DocId=Data+Sheet%7FMS5611-01BA03%7FB3%7Fpdf%7FEnglish%7FENG_DS_MS5611-01BA03_B3.pdf
+package ms5611
+
+const (
+	Address    byte = 0x77 // CSB low
+	AddressAlt byte = 0x76 // CSB high
+)
+
+// The MS5611 has no registers, it is driven by commands.
+const (
+	CmdReset     byte = 0x1E
+	CmdConvertD1 byte = 0x40 // pressure conversion, or'ed with the oversampling
+	CmdConvertD2 byte = 0x50 // temperature conversion, or'ed with the oversampling
+	CmdADCRead   byte = 0x00 // read the 24 bit result of the last conversion
+	CmdPROMRead  byte = 0xA0 // read a 16 bit PROM word, plus 2 * word index (0..7)
+)
+
+// Oversampling trades resolution and noise against conversion time. Pressure at 4096 has a resolution of 0.012 mbar (10 cm),
+// which is what variometers use.
+const (
+	OSR256  Oversampling = 0x00
+	OSR512  Oversampling = 0x02
+	OSR1024 Oversampling = 0x04
+	OSR2048 Oversampling = 0x06
+	OSR4096 Oversampling = 0x08
+)
@@ -0,0 +1,91 @@
+package sensors
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// pressureDriver is a low level pressure sensor driver that reads temperature and pressure together.
+type pressureDriver interface {
+	Read() (temperature, pressure float64, err error)
+}
+
+// pressurePoller reads a pressureDriver periodically and implements the PressureReader interface on top of it.
+type pressurePoller struct {
+	driver      pressureDriver
+	sleep       func() error // Puts the sensor to sleep on Close, may be nil.
+	mu          sync.Mutex
+	temperature float64
+	pressure    float64
+	err         error
+	running     bool
+	stop        chan struct{}
+}
+
+var errPollerStopped = errors.New("pressure sensor is not running")
+
+// start takes a first reading, so the values are valid right away, and then polls in the background.
+func (p *pressurePoller) start(freq time.Duration) {
+	p.read()
+	p.running = true
+	p.stop = make(chan struct{})
+	go p.run(freq)
+}
+
+func (p *pressurePoller) run(freq time.Duration) {
+	clock := time.NewTicker(freq)
+	defer clock.Stop()
+	for {
+		select {
+		case <-clock.C:
+			p.read()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *pressurePoller) read() {
+	t, press, err := p.driver.Read()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	if err == nil {
+		p.temperature, p.pressure = t, press
+	}
+}
+
+// Temperature returns the current temperature in degrees C.
+func (p *pressurePoller) Temperature() (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return 0, errPollerStopped
+	}
+	return p.temperature, p.err
+}
+
+// Pressure returns the current pressure in mbar.
+func (p *pressurePoller) Pressure() (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return 0, errPollerStopped
+	}
+	return p.pressure, p.err
+}
+
+// Close stops the measurements.
+func (p *pressurePoller) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return
+	}
+	p.running = false
+	close(p.stop)
+	if p.sleep != nil {
+		p.sleep()
+	}
+}
@@ -0,0 +1,157 @@
+package sensors
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stratux/stratux/sensors/bmp388"
+	"github.com/stratux/stratux/sensors/i2cemu"
+	"github.com/stratux/stratux/sensors/lps22hb"
+	"github.com/stratux/stratux/sensors/ms5611"
+)
+
+type stubPressureDriver struct {
+	temp, press float64
+	err         error
+}
+
+func (s *stubPressureDriver) Read() (float64, float64, error) {
+	return s.temp, s.press, s.err
+}
+
+func TestPressurePoller(t *testing.T) {
+	stub := &stubPressureDriver{temp: 15, press: 1013.25}
+	slept := false
+	p := &pressurePoller{driver: stub, sleep: func() error { slept = true; return nil }}
+	if _, err := p.Pressure(); err == nil {
+		t.Errorf("not started, no error")
+	}
+
+	// Valid right after starting.
+	p.start(time.Hour)
+	if press, err := p.Pressure(); press != 1013.25 || err != nil {
+		t.Errorf("Pressure() = %f, %v", press, err)
+	}
+
+	// A failed read keeps the last values and reports the error.
+	stub.err = errors.New("bus error")
+	stub.press = 0
+	p.read()
+	if press, err := p.Pressure(); press != 1013.25 || err == nil {
+		t.Errorf("after a failed read: %f, %v", press, err)
+	}
+	stub.err = nil
+	stub.temp = 16
+	p.read()
+	if temp, err := p.Temperature(); temp != 16 || err != nil {
+		t.Errorf("Temperature() = %f, %v", temp, err)
+	}
+
+	p.Close()
+	p.Close()
+	if !slept {
+		t.Errorf("sensor not put to sleep")
+	}
+	if _, err := p.Temperature(); err == nil {
+		t.Errorf("closed, no error")
+	}
+}
+
+func TestNewPressureReaders(t *testing.T) {
+	bus := i2cemu.NewBus()
+	bus.Attach(ms5611.Address, testMS5611())
+	lps := i2cemu.NewRegisters(map[byte]byte{lps22hb.RegWhoAmI: lps22hb.WhoAmI})
+	lps.Set(lps22hb.RegPressure, 0x00, 0x50, 0x3F, 0xC4, 0x09) // 1013 hPa, 25 C
+	lps.OnWrite = func(r *i2cemu.Registers, reg, value byte) {
+		r.Regs[lps22hb.RegCtrl2] &^= lps22hb.Ctrl2SoftReset
+	}
+	bus.Attach(lps22hb.Address, lps)
+
+	m, err := NewMS5611(bus.I2CBus(), ms5611.Address, ms5611.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	temp, _ := m.Temperature()
+	press, _ := m.Pressure()
+	if math.Abs(temp-20.07) > 1e-9 || math.Abs(press-1000.09) > 1e-9 {
+		t.Errorf("MS5611: %f C, %f mbar", temp, press)
+	}
+
+	l, err := NewLPS22HB(bus.I2CBus(), lps22hb.Address, lps22hb.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, _ = l.Temperature()
+	press, _ = l.Pressure()
+	if temp != 25 || press != 1013 {
+		t.Errorf("LPS22HB: %f C, %f mbar", temp, press)
+	}
+	l.Close()
+	if v, _ := lps.LastWrite(lps22hb.RegCtrl1); v>>4 != 0 {
+		t.Errorf("LPS22HB not powered down: CTRL_REG1 %02X", v)
+	}
+
+	if _, err := NewMS5611(bus.I2CBus(), ms5611.AddressAlt, ms5611.DefaultConfig); err == nil {
+		t.Errorf("MS5611 at an empty address")
+	}
+}
+
+func TestNewBMP388(t *testing.T) {
+	regs := i2cemu.NewRegisters(map[byte]byte{bmp388.RegChipId: bmp388.ChipId390})
+	regs.Set(bmp388.RegCali, 0x51, 0x6B, 0x57, 0x4B, 0xF9, 0xFD, 0x04, 0x73, 0xF6, 0x23, 0x01, 0x5A, 0x4D, 0x76,
+		0x5D, 0x03, 0xF7, 0xC4, 0x3E, 0x08, 0xC4)
+	regs.Set(bmp388.RegPress, 0x80, 0x23, 0x43, 0xE0, 0xA5, 0x7E)
+	bus := i2cemu.NewBus()
+	bus.Attach(0x77, regs)
+
+	if _, err := NewBMP388(bus.I2CBus(), 0x76); err != bmp388.ErrNotConnected {
+		t.Errorf("BMP388 at an empty address: %v", err)
+	}
+	b, err := NewBMP388(bus.I2CBus(), 0x77)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, _ := b.Temperature()
+	press, _ := b.Pressure()
+	if temp != 22.71 || math.Abs(press-1010.1233) > 1e-9 {
+		t.Errorf("BMP388: %f C, %f mbar", temp, press)
+	}
+	b.Close()
+	if v, _ := regs.LastWrite(bmp388.RegPwrCtrl); v != byte(bmp388.Sleep)|bmp388.PwrPress|bmp388.PwrTemp {
+		t.Errorf("BMP388 not asleep: PWR_CTRL %02X", v)
+	}
+}
+
+func TestNewBMP280(t *testing.T) {
+	// Calibration and readings of the datasheet's example.
+	regs := i2cemu.NewRegisters(map[byte]byte{0xD0: 0x58})
+	regs.Set(0x88, 0x70, 0x6B, 0x43, 0x67, 0x18, 0xFC, 0x7D, 0x8E, 0x43, 0xD6, 0xD0, 0x0B, 0x27, 0x0B, 0x8C, 0x00,
+		0xF9, 0xFF, 0x8C, 0x3C, 0xF8, 0xC6, 0x70, 0x17)
+	regs.Set(0xF7, 0x65, 0x5A, 0xC0, 0x7E, 0xED, 0x00)
+	bus := i2cemu.NewBus()
+	bus.Attach(0x77, regs) // Found after trying 0x76.
+
+	b, err := NewBMP280(bus.I2CBus(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	var press float64
+	for n := 0; n < 50 && press == 0; n++ {
+		time.Sleep(20 * time.Millisecond)
+		press, _ = b.Pressure()
+	}
+	temp, _ := b.Temperature()
+	if temp != 25.08 || math.Abs(press-1006.5325390625) > 1e-9 {
+		t.Errorf("BMP280: %f C, %f mbar", temp, press)
+	}
+	// Normal mode, 16x oversampling, 16x filter, 62.5 ms standby.
+	ctrl, _ := regs.LastWrite(0xF4)
+	config, _ := regs.LastWrite(0xF5)
+	if ctrl != 0xB7 || config != 0x30 {
+		t.Errorf("BMP280 ctrl_meas %02X config %02X", ctrl, config)
+	}
+}
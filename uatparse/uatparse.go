@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -62,8 +63,32 @@ type UATFrame struct {
 	ReportStart        string
 	ReportEnd          string
 
+	// For graphical overlays (Aero_FISB_ProdDef 6.22).
+	OverlayRecordID uint8
+	ObjectType      uint8
+	ObjectStatus    uint8
+	GeometryOption  uint8 // Geometry overlay option. 4, 6, 8 and 9 are AGL, others MSL.
+	AltFloor        int32 // Lowest altitude of the overlay, feet.
+	AltCeiling      int32 // Highest altitude of the overlay, feet.
+
 	// For NEXRAD.
 	NEXRAD []NEXRADBlock
+
+	// For TIS-B/ADS-R Service Status frames: aircraft the ground station is providing service to.
+	ServiceStatus []ServiceStatusTarget
+}
+
+// Information frame types (DO-282B, Table 2-14).
+const (
+	INFO_FRAME_TYPE_FISB           = 0
+	INFO_FRAME_TYPE_SERVICE_STATUS = 15
+)
+
+// Entry of a TIS-B/ADS-R Service Status frame ("TIS-B heartbeat"): one 4 byte entry per client,
+// the address qualifier in the low three bits of the first byte followed by the 24 bit address.
+type ServiceStatusTarget struct {
+	Addr_type uint8
+	Addr      uint32
 }
 
 type UATMsg struct {
@@ -76,6 +101,11 @@ type UATMsg struct {
 	Lat    float64
 	Lon    float64
 	Frames []*UATFrame
+	// Uplink header fields (DO-282B, Table 2-13).
+	UTCCoupled   bool
+	AppDataValid bool
+	SlotID       uint8 // Data channel (uplink slot) used by the ground station, 0-31.
+	TISBSiteID   uint8 // TIS-B site ID of the ground station, 0 if not set.
 }
 
 func dlac_decode(data []byte, data_len uint32) string {
@@ -243,11 +273,35 @@ func airmetLatLng(lat_raw, lng_raw int32, alt bool) (float64, float64) {
 	return lat, lng
 }
 
+// Approximates the ellipse of a circular prism with a polygon. Radii are in NM, alpha is the
+// rotation of the ellipse in degrees.
+func ellipsePoints(lat, lng, r_lat, r_lng, alpha float64, alt int32) []GeoPoint {
+	const n = 36
+	points := make([]GeoPoint, 0, n)
+	a := alpha * math.Pi / 180
+	cosLat := math.Cos(lat * math.Pi / 180)
+	if cosLat < 0.01 {
+		cosLat = 0.01
+	}
+	for i := 0; i < n; i++ {
+		t := 2 * math.Pi * float64(i) / n
+		x := r_lng * math.Cos(t) // East, NM.
+		y := r_lat * math.Sin(t) // North, NM.
+		east := x*math.Cos(a) + y*math.Sin(a)
+		north := -x*math.Sin(a) + y*math.Cos(a)
+		points = append(points, GeoPoint{Lat: lat + north/60, Lon: lng + east/(60*cosLat), Alt: alt})
+	}
+	return points
+}
+
 //TODO: Ignoring flags (segmentation, etc.)
 // Aero_FISB_ProdDef_Rev4.pdf
 // Decode product IDs 8-13.
 func (f *UATFrame) decodeAirmet() {
 	// APDU header: 48 bits  (3-3) - assume no segmentation.
+	if len(f.FISB_data) < 6 {
+		return
+	}
 
 	record_format := (uint8(f.FISB_data[0]) & 0xF0) >> 4
 	f.RecordFormat = record_format
@@ -283,6 +337,9 @@ func (f *UATFrame) decodeAirmet() {
 	*/
 	switch record_format {
 	case 2:
+		if len(f.FISB_data) < 11 {
+			return
+		}
 		record_length := (uint16(f.FISB_data[6]) << 8) | uint16(f.FISB_data[7])
 		if len(f.FISB_data)-int(record_length) < 6 {
 			fmt.Fprintf(ioutil.Discard, "FISB record not long enough: record_length=%d, len(f.FISB_data)=%d\n", record_length, len(f.FISB_data))
@@ -306,6 +363,10 @@ func (f *UATFrame) decodeAirmet() {
 	case 8:
 		// (6-1). (6.22 - Graphical Overlay Record Format).
 		record_data := f.FISB_data[6:] // Start after the record header.
+		if len(record_data) < 7 {
+			fmt.Fprintf(ioutil.Discard, "graphical overlay record too short: %d\n", len(record_data))
+			return
+		}
 		record_length := (uint16(record_data[0]) << 2) | ((uint16(record_data[1]) & 0xC0) >> 6)
 		fmt.Fprintf(ioutil.Discard, "record_length=%d\n", record_length)
 		// Report identifier = report number + report year.
@@ -316,20 +377,27 @@ func (f *UATFrame) decodeAirmet() {
 		f.ReportYear = report_year
 		fmt.Fprintf(ioutil.Discard, "report_year=%d\n", report_year)
 		overlay_record_identifier := ((uint8(record_data[4]) & 0x1E) >> 1) + 1 // Document instructs to add 1.
+		f.OverlayRecordID = overlay_record_identifier
 		fmt.Fprintf(ioutil.Discard, "overlay_record_identifier=%d\n", overlay_record_identifier)
 		object_label_flag := uint8(record_data[4] & 0x01)
 		fmt.Fprintf(ioutil.Discard, "object_label_flag=%d\n", object_label_flag)
 
 		if object_label_flag == 0 { // Numeric index.
-			object_label := (uint8(record_data[5]) << 8) | uint8(record_data[6])
+			object_label := (uint16(record_data[5]) << 8) | uint16(record_data[6])
 			record_data = record_data[7:]
 			fmt.Fprintf(ioutil.Discard, "object_label=%d\n", object_label)
 		} else {
+			if len(record_data) < 14 {
+				return
+			}
 			object_label := dlac_decode(record_data[5:], 9)
 			record_data = record_data[14:]
 			fmt.Fprintf(ioutil.Discard, "object_label=%s\n", object_label)
 		}
 
+		if len(record_data) < 2 {
+			return
+		}
 		element_flag := (uint8(record_data[0]) & 0x80) >> 7
 		fmt.Fprintf(ioutil.Discard, "element_flag=%d\n", element_flag)
 		qualifier_flag := (uint8(record_data[0]) & 0x40) >> 6
@@ -340,15 +408,20 @@ func (f *UATFrame) decodeAirmet() {
 		fmt.Fprintf(ioutil.Discard, "object_element=%d\n", object_element)
 
 		object_type := (uint8(record_data[1]) & 0xF0) >> 4
+		f.ObjectType = object_type
 		fmt.Fprintf(ioutil.Discard, "object_type=%d\n", object_type)
 
 		object_status := uint8(record_data[1]) & 0x0F
+		f.ObjectStatus = object_status
 		fmt.Fprintf(ioutil.Discard, "object_status=%d\n", object_status)
 
 		//FIXME
 		if qualifier_flag == 0 { //TODO: Check.
 			record_data = record_data[2:]
 		} else {
+			if len(record_data) < 5 {
+				return
+			}
 			object_qualifier := (uint32(record_data[2]) << 16) | (uint32(record_data[3]) << 8) | uint32(record_data[4])
 			fmt.Fprintf(ioutil.Discard, "object_qualifier=%d\n", object_qualifier)
 			fmt.Fprintf(ioutil.Discard, "%02x%02x%02x\n", record_data[2], record_data[3], record_data[4])
@@ -362,11 +435,15 @@ func (f *UATFrame) decodeAirmet() {
 		//	//			record_data = record_data[4:]
 		//}
 
+		if len(record_data) < 2 {
+			return
+		}
 		record_applicability_options := (uint8(record_data[0]) & 0xC0) >> 6
 		fmt.Fprintf(ioutil.Discard, "record_applicability_options=%d\n", record_applicability_options)
 		date_time_format := (uint8(record_data[0]) & 0x30) >> 4
 		fmt.Fprintf(ioutil.Discard, "date_time_format=%d\n", date_time_format)
 		geometry_overlay_options := uint8(record_data[0]) & 0x0F
+		f.GeometryOption = geometry_overlay_options
 		fmt.Fprintf(ioutil.Discard, "geometry_overlay_options=%d\n", geometry_overlay_options)
 
 		overlay_operator := (uint8(record_data[1]) & 0xC0) >> 6
@@ -380,12 +457,21 @@ func (f *UATFrame) decodeAirmet() {
 		case 0: // No times given. UFN.
 			record_data = record_data[2:]
 		case 1: // Start time only. WEF.
+			if len(record_data) < 6 {
+				return
+			}
 			f.ReportStart = airmetParseDate(record_data[2:], date_time_format)
 			record_data = record_data[6:]
 		case 2: // End time only. TIL.
+			if len(record_data) < 6 {
+				return
+			}
 			f.ReportEnd = airmetParseDate(record_data[2:], date_time_format)
 			record_data = record_data[6:]
 		case 3: // Both start and end times. WEF.
+			if len(record_data) < 10 {
+				return
+			}
 			f.ReportStart = airmetParseDate(record_data[2:], date_time_format)
 			f.ReportEnd = airmetParseDate(record_data[6:], date_time_format)
 			record_data = record_data[10:]
@@ -393,7 +479,11 @@ func (f *UATFrame) decodeAirmet() {
 
 		// Now we have the vertices.
 		switch geometry_overlay_options {
-		case 3: // Extended Range 3D Polygon (MSL).
+		case 3, 4, 5, 6: // Extended Range 3D Polygon (3 = MSL, 4 = AGL), Extended Range 3D Polyline (5 = MSL, 6 = AGL).
+			if len(record_data) < 6*int(overlay_vertices_count) {
+				fmt.Fprintf(ioutil.Discard, "invalid data: %d vertices need %d bytes; %d seen.\n", overlay_vertices_count, 6*int(overlay_vertices_count), len(record_data))
+				return
+			}
 			points := make([]GeoPoint, 0) // Slice containing all of the points.
 			fmt.Fprintf(ioutil.Discard, "%d\n", len(record_data))
 			for i := 0; i < int(overlay_vertices_count); i++ {
@@ -412,8 +502,14 @@ func (f *UATFrame) decodeAirmet() {
 				point.Lon = lng
 				point.Alt = alt
 				points = append(points, point)
-				f.Points = points
+				if i == 0 || alt < f.AltFloor {
+					f.AltFloor = alt
+				}
+				if i == 0 || alt > f.AltCeiling {
+					f.AltCeiling = alt
+				}
 			}
+			f.Points = points
 		case 9: // Extended Range 3D Point (AGL). p.47.
 			if len(record_data) < 6 {
 				fmt.Fprintf(ioutil.Discard, "invalid data: Extended Range 3D Point. Should be 6 bytes; %d seen.\n", len(record_data))
@@ -433,6 +529,8 @@ func (f *UATFrame) decodeAirmet() {
 				point.Lon = lng
 				point.Alt = alt
 				f.Points = []GeoPoint{point}
+				f.AltFloor = alt
+				f.AltCeiling = alt
 			}
 		case 7, 8: // Extended Range Circular Prism (7 = MSL, 8 = AGL)
 			if len(record_data) < 14 {
@@ -446,7 +544,6 @@ func (f *UATFrame) decodeAirmet() {
 
 				alt_bot_raw := (int32(record_data[9]) & 0xFE) >> 1
 				alt_top_raw := ((int32(record_data[9]) & 0x01) << 6) | ((int32(record_data[10]) & 0xFC) >> 2)
-
 				r_lng_raw := ((int32(record_data[10]) & 0x03) << 7) | ((int32(record_data[11]) & 0xFE) >> 1)
 				r_lat_raw := ((int32(record_data[11]) & 0x01) << 8) | int32(record_data[12])
 				alpha := int32(record_data[13])
@@ -471,6 +568,10 @@ func (f *UATFrame) decodeAirmet() {
 				fmt.Fprintf(ioutil.Discard, "r_lng, r_lat = %f, %f\n", r_lng, r_lat)
 
 				fmt.Fprintf(ioutil.Discard, "alpha=%d\n", alpha)
+
+				f.Points = ellipsePoints(lat_bot, lng_bot, r_lat, r_lng, float64(alpha), alt_bot)
+				f.AltFloor = alt_bot
+				f.AltCeiling = alt_top
 			}
 		default:
 			fmt.Fprintf(ioutil.Discard, "unknown geometry: %d\n", geometry_overlay_options)
@@ -482,15 +583,29 @@ func (f *UATFrame) decodeAirmet() {
 	fmt.Fprintf(ioutil.Discard, "\n\n\n")
 }
 
+func (f *UATFrame) decodeServiceStatus() {
+	for i := 0; i+4 <= len(f.Raw_data); i += 4 {
+		var t ServiceStatusTarget
+		t.Addr_type = f.Raw_data[i] & 0x07
+		t.Addr = (uint32(f.Raw_data[i+1]) << 16) | (uint32(f.Raw_data[i+2]) << 8) | uint32(f.Raw_data[i+3])
+		f.ServiceStatus = append(f.ServiceStatus, t)
+	}
+}
+
 func (f *UATFrame) decodeInfoFrame() {
 
+	if f.Frame_type == INFO_FRAME_TYPE_SERVICE_STATUS {
+		f.decodeServiceStatus()
+		return // No product id.
+	}
+
 	if len(f.Raw_data) < 2 {
 		return // Can't determine Product_id.
 	}
 
 	f.Product_id = ((uint32(f.Raw_data[0]) & 0x1f) << 6) | (uint32(f.Raw_data[1]) >> 2)
 
-	if f.Frame_type != 0 {
+	if f.Frame_type != INFO_FRAME_TYPE_FISB {
 		return // Not FIS-B.
 	}
 
@@ -499,10 +614,11 @@ func (f *UATFrame) decodeInfoFrame() {
 	switch f.Product_id {
 	case 413:
 		f.decodeTextFrame()
-		/*
-			case 8, 11, 13:
-				f.decodeAirmet()
-		*/
+	case 8, 11, 12, 13, 14, 15, 16, 17:
+		// Graphical overlays only. Text records of these products are not handed out as text reports.
+		if len(f.FISB_data) > 0 && (f.FISB_data[0]&0xF0)>>4 == 8 {
+			f.decodeAirmet()
+		}
 	case 63, 64:
 		f.decodeNexradFrame()
 
@@ -537,10 +653,11 @@ func (u *UATMsg) DecodeUplink() error {
 	u.Lat = lat
 	u.Lon = lon
 
-	//	utc_coupled := (uint32(frame[6]) & 0x80) != 0
+	u.UTCCoupled = (uint32(frame[6]) & 0x80) != 0
 	app_data_valid := (uint32(frame[6]) & 0x20) != 0
-	//	slot_id := uint32(frame[6]) & 0x1f
-	//	tisb_site_id := uint32(frame[7]) >> 4
+	u.AppDataValid = app_data_valid
+	u.SlotID = uint8(frame[6] & 0x1f)
+	u.TISBSiteID = uint8(frame[7] >> 4)
 
 	//	logger.Printf("position_valid=%t, %.04f, %.04f, %t, %t, %d, %d\n", position_valid, lat, lon, utc_coupled, app_data_valid, slot_id, tisb_site_id)
 
@@ -1,6 +1,7 @@
 package uatparse
 
 import (
+	"math"
 	"strings"
 	"testing"
 )
@@ -666,3 +667,182 @@ func TestBlockLocationScaleFactors(t *testing.T) {
 		})
 	}
 }
+
+// TestDecodeUplinkHeader tests decoding of the uplink header fields
+func TestDecodeUplinkHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		byte6        byte
+		byte7        byte
+		utcCoupled   bool
+		appDataValid bool
+		slotID       uint8
+		tisbSiteID   uint8
+	}{
+		{"All clear", 0x00, 0x00, false, false, 0, 0},
+		{"UTC coupled, slot 5, site 3", 0x85, 0x30, true, false, 5, 3},
+		{"App data valid, slot 31, site 15", 0x3f, 0xf0, false, true, 31, 15},
+		{"Low nibble of byte 7 ignored", 0x01, 0x2f, false, false, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := make([]byte, UPLINK_FRAME_DATA_BYTES)
+			frame[6] = tt.byte6
+			frame[7] = tt.byte7
+			hexStr := ""
+			for _, b := range frame {
+				hexStr += string("0123456789abcdef"[b>>4]) + string("0123456789abcdef"[b&0x0f])
+			}
+			u, err := New("+" + hexStr + ";")
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			if err := u.DecodeUplink(); err != nil {
+				t.Fatalf("DecodeUplink() error: %v", err)
+			}
+			if u.UTCCoupled != tt.utcCoupled {
+				t.Errorf("UTCCoupled = %v, want %v", u.UTCCoupled, tt.utcCoupled)
+			}
+			if u.AppDataValid != tt.appDataValid {
+				t.Errorf("AppDataValid = %v, want %v", u.AppDataValid, tt.appDataValid)
+			}
+			if u.SlotID != tt.slotID {
+				t.Errorf("SlotID = %d, want %d", u.SlotID, tt.slotID)
+			}
+			if u.TISBSiteID != tt.tisbSiteID {
+				t.Errorf("TISBSiteID = %d, want %d", u.TISBSiteID, tt.tisbSiteID)
+			}
+		})
+	}
+}
+
+// TestDecodeServiceStatus tests decoding of TIS-B/ADS-R Service Status information frames
+func TestDecodeServiceStatus(t *testing.T) {
+	frame := make([]byte, UPLINK_FRAME_DATA_BYTES)
+	frame[6] = 0x20 // App data valid.
+	// Information frame: length 9, type 15. Two entries plus one trailing byte.
+	payload := []byte{0x00, 0xA1, 0x23, 0x45, 0x02, 0xAB, 0xCD, 0xEF, 0xFF}
+	frame[8] = byte(len(payload) >> 1)
+	frame[9] = byte((len(payload)&1)<<7) | INFO_FRAME_TYPE_SERVICE_STATUS
+	copy(frame[10:], payload)
+
+	hexStr := ""
+	for _, b := range frame {
+		hexStr += string("0123456789abcdef"[b>>4]) + string("0123456789abcdef"[b&0x0f])
+	}
+	u, err := New("+" + hexStr + ";")
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if err := u.DecodeUplink(); err != nil {
+		t.Fatalf("DecodeUplink() error: %v", err)
+	}
+	if len(u.Frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(u.Frames))
+	}
+	f := u.Frames[0]
+	if f.Frame_type != INFO_FRAME_TYPE_SERVICE_STATUS {
+		t.Errorf("Frame_type = %d, want %d", f.Frame_type, INFO_FRAME_TYPE_SERVICE_STATUS)
+	}
+	if f.Product_id != 0 {
+		t.Errorf("Product_id = %d, want 0 for service status frame", f.Product_id)
+	}
+	want := []ServiceStatusTarget{{Addr_type: 0, Addr: 0xA12345}, {Addr_type: 2, Addr: 0xABCDEF}}
+	if len(f.ServiceStatus) != len(want) {
+		t.Fatalf("ServiceStatus = %+v, want %+v", f.ServiceStatus, want)
+	}
+	for i := range want {
+		if f.ServiceStatus[i] != want[i] {
+			t.Errorf("ServiceStatus[%d] = %+v, want %+v", i, f.ServiceStatus[i], want[i])
+		}
+	}
+}
+
+// encodeExtendedVertex packs a vertex the way Extended Range 3D Polygon/Polyline/Point records carry it.
+func encodeExtendedVertex(lat, lng float64, alt int32) []byte {
+	if lng < 0 {
+		lng += 360
+	}
+	if lat < 0 {
+		lat += 180
+	}
+	lat_raw := int32(math.Round(lat / 0.000687))
+	lng_raw := int32(math.Round(lng / 0.000687))
+	alt_raw := alt / 100
+	return []byte{
+		byte(lng_raw >> 11),
+		byte(lng_raw >> 3),
+		byte((lng_raw&0x07)<<5) | byte((lat_raw>>14)&0x1F),
+		byte(lat_raw >> 6),
+		byte((lat_raw&0x3F)<<2) | byte((alt_raw>>8)&0x03),
+		byte(alt_raw),
+	}
+}
+
+func TestDecodeAirmetGraphicalPolygon(t *testing.T) {
+	data := []byte{0x80, 0x10, 0x00, 0x00, 0x00, 0x00} // Graphical overlay, one record.
+	// Record length, report number 123, report year 25, overlay record 1, numeric object label.
+	data = append(data, 0x00, 0x00, 123, 25<<1, 0x00, 0x00, 0x01)
+	data = append(data, 0x00, 0x12) // No qualifier; object type 1, status 2.
+	// Start and end time (day, hours, minutes), Extended Range 3D Polygon (MSL), 3 vertices.
+	data = append(data, 0xE3, 0x02, 13, 12, 0, 0, 13, 18, 30, 0)
+	data = append(data, encodeExtendedVertex(43.5, -88.5, 1000)...)
+	data = append(data, encodeExtendedVertex(44.0, -88.0, 1000)...)
+	data = append(data, encodeExtendedVertex(43.0, -88.0, 12000)...)
+
+	f := &UATFrame{FISB_data: data}
+	f.decodeAirmet()
+
+	if f.ReportNumber != 123 || f.ReportYear != 25 || f.OverlayRecordID != 1 {
+		t.Errorf("report = %d/%d record %d, want 123/25 record 1", f.ReportNumber, f.ReportYear, f.OverlayRecordID)
+	}
+	if f.ObjectType != 1 || f.ObjectStatus != 2 {
+		t.Errorf("object type/status = %d/%d, want 1/2", f.ObjectType, f.ObjectStatus)
+	}
+	if f.GeometryOption != 3 {
+		t.Errorf("GeometryOption = %d, want 3", f.GeometryOption)
+	}
+	if f.ReportStart != "13 12:00" || f.ReportEnd != "13 18:30" {
+		t.Errorf("start/end = %q/%q", f.ReportStart, f.ReportEnd)
+	}
+	if len(f.Points) != 3 {
+		t.Fatalf("got %d points, want 3", len(f.Points))
+	}
+	if math.Abs(f.Points[0].Lat-43.5) > 0.001 || math.Abs(f.Points[0].Lon+88.5) > 0.001 {
+		t.Errorf("first point = %+v, want 43.5,-88.5", f.Points[0])
+	}
+	if f.AltFloor != 1000 || f.AltCeiling != 12000 {
+		t.Errorf("floor/ceiling = %d/%d, want 1000/12000", f.AltFloor, f.AltCeiling)
+	}
+}
+
+func TestDecodeAirmetTruncated(t *testing.T) {
+	data := []byte{0x80, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 123, 25 << 1, 0x00, 0x00, 0x01, 0x00, 0x12, 0xE3, 0x02, 13, 12}
+	for i := 0; i <= len(data); i++ {
+		f := &UATFrame{FISB_data: data[:i]}
+		f.decodeAirmet() // Must not panic.
+		if len(f.Points) != 0 {
+			t.Errorf("len %d: got points from truncated record", i)
+		}
+	}
+}
+
+func TestEllipsePoints(t *testing.T) {
+	points := ellipsePoints(40.0, -100.0, 6.0, 3.0, 0, 500)
+	if len(points) != 36 {
+		t.Fatalf("got %d points, want 36", len(points))
+	}
+	// alpha = 0: first point due east by r_lng, a quarter around due north by r_lat.
+	if math.Abs(points[0].Lat-40.0) > 1e-9 || math.Abs(points[0].Lon-(-100.0+3.0/(60*math.Cos(40*math.Pi/180)))) > 1e-9 {
+		t.Errorf("points[0] = %+v", points[0])
+	}
+	if math.Abs(points[9].Lat-40.1) > 1e-9 || math.Abs(points[9].Lon+100.0) > 1e-9 {
+		t.Errorf("points[9] = %+v, want 40.1,-100", points[9])
+	}
+	for _, p := range points {
+		if p.Alt != 500 {
+			t.Errorf("Alt = %d, want 500", p.Alt)
+		}
+	}
+}
@@ -4,6 +4,7 @@ var URL_HOST_PROTOCOL       = window.location.protocol + "//";
 
 var URL_AHRS_CAGE           = URL_HOST_PROTOCOL + URL_HOST_BASE + "/cageAHRS";
 var URL_AHRS_CAL            = URL_HOST_PROTOCOL + URL_HOST_BASE + "/calibrateAHRS";
+var URL_AHRS_MAGCAL         = URL_HOST_PROTOCOL + URL_HOST_BASE + "/calibrateMag";
 var URL_AHRS_ORIENT         = URL_HOST_PROTOCOL + URL_HOST_BASE + "/orientAHRS";
 var URL_DELETEAHRSLOGFILES  = URL_HOST_PROTOCOL + URL_HOST_BASE + "/deleteahrslogfiles";
 var URL_DELETELOGFILE       = URL_HOST_PROTOCOL + URL_HOST_BASE + "/deletelogfile";
@@ -11,6 +12,8 @@ var URL_DEV_TOGGLE_GET      = URL_HOST_PROTOCOL + URL_HOST_BASE + "/develmodetog
 var URL_DOWNLOADAHRSLOGFILES = URL_HOST_PROTOCOL + URL_HOST_BASE + "/downloadahrslogs";
 var URL_DOWNLOADDB          = URL_HOST_PROTOCOL + URL_HOST_BASE + "/downloaddb";
 var URL_DOWNLOADLOGFILE     = URL_HOST_PROTOCOL + URL_HOST_BASE + "/downloadlog";
+var URL_FLIGHTS_GET         = URL_HOST_PROTOCOL + URL_HOST_BASE + "/api/flights";
+var URL_CRASH_CANCEL        = URL_HOST_PROTOCOL + URL_HOST_BASE + "/api/crash/cancel";
 var URL_GMETER_RESET        = URL_HOST_PROTOCOL + URL_HOST_BASE + "/resetGMeter";
 var URL_REBOOT              = URL_HOST_PROTOCOL + URL_HOST_BASE + "/reboot";
 var URL_RESTARTAPP          = URL_HOST_PROTOCOL + URL_HOST_BASE + "/restart";
@@ -182,6 +182,10 @@ function GPSCtrl($rootScope, $scope, $state, $http, $interval) {
         $scope.gps_track = situation.GPSTrueCourse.toFixed(1);
         $scope.gps_speed = situation.GPSGroundSpeed.toFixed(1);
         $scope.gps_vert_speed = situation.GPSVerticalSpeed.toFixed(1);
+        $scope.wind_quality = situation.WindQuality;
+        $scope.wind_direction = situation.WindDirection.toFixed(0);
+        $scope.wind_speed = situation.WindSpeed.toFixed(0);
+        $scope.wind_method = situation.WindMethod;
         if ($scope.gps_lat == 0 && $scope.gps_lon == 0) {
             $scope.gps_lat = "--";
             $scope.gps_lon = "--";
@@ -201,9 +205,16 @@ function GPSCtrl($rootScope, $scope, $state, $http, $interval) {
         $scope.gps_time = Date.parse(situation.GPSLastGPSTimeStratuxTime);
         if ($scope.gps_time - $scope.press_time < 1000) {
             $scope.ahrs_alt = Math.round(situation.BaroPressureAltitude.toFixed(0));
+            $scope.baro_ind_alt = situation.BaroQNH > 0 ? situation.BaroIndicatedAltitude.toFixed(0) : "---";
+            $scope.baro_density_alt = situation.BaroDensityAltitude !== 0 ? situation.BaroDensityAltitude.toFixed(0) : "---";
         } else {
             $scope.ahrs_alt = "---";
+            $scope.baro_ind_alt = "---";
+            $scope.baro_density_alt = "---";
         }
+        $scope.baro_qnh = situation.BaroQNH > 0 ? situation.BaroQNH.toFixed(1) : "";
+        $scope.baro_qnh_inhg = (situation.BaroQNH / 33.8639).toFixed(2);
+        $scope.baro_qnh_source = situation.BaroQNHSource;
 
         $scope.ahrs_time = Date.parse(situation.AHRSLastAttitudeTime);
         if ($scope.gps_time - $scope.ahrs_time < 1000) {
@@ -239,6 +250,10 @@ function GPSCtrl($rootScope, $scope, $state, $http, $interval) {
                 gMeter.update(situation.AHRSGLoad, situation.AHRSGLoadMin, situation.AHRSGLoadMax);
             }
 
+            $scope.ahrs_filter = situation.AHRSFilter.Filter;
+            $scope.ahrs_filter_healthy = situation.AHRSFilter.Healthy;
+            $scope.ahrs_filter_sigma = situation.AHRSFilter.RollPitchSigma > 0 ? situation.AHRSFilter.RollPitchSigma.toFixed(1) : "";
+
             if (situation.AHRSTurnRate > 360) {
                 $scope.ahrs_turn_rate = "--";
             } else if (situation.AHRSTurnRate > 0.6031) {
@@ -254,6 +269,7 @@ function GPSCtrl($rootScope, $scope, $state, $http, $interval) {
             $scope.ahrs_heading_mag = "---";
             $scope.ahrs_gload = "--";
             $scope.ahrs_turn_rate = "--";
+            $scope.ahrs_filter = "";
         }
 
         if (situation.AHRSStatus & 0x01) {
@@ -390,6 +406,7 @@ function GPSCtrl($rootScope, $scope, $state, $http, $interval) {
         }
         // stop polling for gps/ahrs status
         $interval.cancel(updateSatellites);
+        $interval.cancel(updateMagCal);
     };
 
     // GPS/AHRS Controller tasks go here
@@ -436,6 +453,37 @@ function GPSCtrl($rootScope, $scope, $state, $http, $interval) {
         }
     };
 
+    // magnetometer calibration: start, rotate the Stratux through all orientations, then finish
+    $scope.MagCal = {};
+
+    function getMagCal() {
+        $http.get(URL_AHRS_MAGCAL).then(function (response) {
+            $scope.MagCal = response.data;
+        });
+    }
+    getMagCal();
+    var updateMagCal = $interval(function () {
+        if ($scope.MagCal.State === 'collecting') {
+            getMagCal();
+        }
+    }, 1000);
+
+    function postMagCal(action) {
+        $http.post(URL_AHRS_MAGCAL, action).then(function (response) {
+            $scope.MagCal = response.data;
+        }, function (response) {
+            $scope.MagCal.Message = response.data;
+        });
+    }
+
+    $scope.MagCalibrate = function() {
+        postMagCal($scope.MagCal.State === 'collecting' ? 'f' : 's');
+    };
+
+    $scope.MagCalCancel = function() {
+        postMagCal('c');
+    };
+
     $scope.GMeterReset = function() {
         $http.post(URL_GMETER_RESET).then(function (response) {
             // do nothing
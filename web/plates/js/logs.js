@@ -8,4 +8,15 @@ function LogsCtrl($scope, $state, $http) {
 	// just a couple environment variables that may bve useful for dev/debugging but otherwise not significant
 	$scope.userAgent = navigator.userAgent;
     $scope.deviceViewport = 'screen = ' + window.screen.width + ' x ' + window.screen.height;
+
+	$scope.flights = [];
+	$http.get(URL_FLIGHTS_GET).then(function (response) {
+		var flights = response.data || [];
+		flights.forEach(function (flight) {
+			var end = flight.InProgress ? new Date() : new Date(flight.Landing);
+			var minutes = Math.max(0, Math.round((end - new Date(flight.Takeoff)) / 60000));
+			flight.Duration = Math.floor(minutes / 60) + ':' + ('0' + (minutes % 60)).slice(-2);
+		});
+		$scope.flights = flights;
+	});
 }
@@ -260,8 +260,9 @@ function SettingsCtrl($rootScope, $scope, $state, $location, $window, $http) {
 
 	$scope.$parent.helppage = 'plates/settings-help.html';
 
-	var toggles = ['UAT_Enabled', 'ES_Enabled', 'OGN_Enabled', 'AIS_Enabled', 'APRS_Enabled', 'Ping_Enabled', 'Pong_Enabled', 'OGNI2CTXEnabled', 'GPS_Enabled', 'IMU_Sensor_Enabled',
-		'BMP_Sensor_Enabled', 'DisplayTrafficSource', 'DEBUG', 'ReplayLog', 'TraceLog', 'AHRSLog', 'PersistentLogging', 'GDL90MSLAlt_Enabled', 'EstimateBearinglessDist', 'DarkMode'];
+	var toggles = ['UAT_Enabled', 'ES_Enabled', 'OGN_Enabled', 'AIS_Enabled', 'APRS_Enabled', 'Ping_Enabled', 'Pong_Enabled', 'OGNI2CTXEnabled', 'GPS_Enabled', 'GPS_UBX_Binary', 'IMU_Sensor_Enabled',
+		'BMP_Sensor_Enabled', 'DisplayTrafficSource', 'DEBUG', 'ReplayLog', 'TraceLog', 'AHRSLog', 'PersistentLogging', 'GDL90MSLAlt_Enabled', 'EstimateBearinglessDist', 'DarkMode',
+		'VarioLXWP0', 'VarioPOV', 'VarioLK8EX1', 'ThermalNMEA', 'CrashDetection'];
 
 	var settings = {};
 	for (var i = 0; i < toggles.length; i++) {
@@ -299,6 +300,7 @@ function SettingsCtrl($rootScope, $scope, $state, $location, $window, $http) {
 		$scope.Ping_Enabled = settings.Ping_Enabled;
 		$scope.Pong_Enabled = settings.Pong_Enabled;
 		$scope.GPS_Enabled = settings.GPS_Enabled;
+		$scope.GPS_UBX_Binary = settings.GPS_UBX_Binary;
 		$scope.OGNI2CTXEnabled = settings.OGNI2CTXEnabled;
 
 		$scope.IMU_Sensor_Enabled = settings.IMU_Sensor_Enabled;
@@ -317,8 +319,17 @@ function SettingsCtrl($rootScope, $scope, $state, $location, $window, $http) {
 		$scope.OwnshipModeS = settings.OwnshipModeS;
 		$scope.DeveloperMode = settings.DeveloperMode;
 		$scope.GLimits = settings.GLimits;
+		$scope.AHRSFilter = settings.AHRSFilter;
+		$scope.ExceedanceLimits = angular.copy(settings.ExceedanceLimits);
 		$scope.GDL90MSLAlt_Enabled = settings.GDL90MSLAlt_Enabled;
 		$scope.EstimateBearinglessDist = settings.EstimateBearinglessDist
+		$scope.VarioLXWP0 = settings.VarioLXWP0;
+		$scope.VarioPOV = settings.VarioPOV;
+		$scope.VarioLK8EX1 = settings.VarioLK8EX1;
+		$scope.WindTAS = settings.WindTAS;
+		$scope.ThermalNMEA = settings.ThermalNMEA;
+		$scope.AltimeterSetting = settings.AltimeterSetting;
+		$scope.CrashDetection = settings.CrashDetection;
 		$scope.StaticIps = settings.StaticIps;
 
 		$scope.WiFiCountry = settings.WiFiCountry;
@@ -500,6 +511,28 @@ function SettingsCtrl($rootScope, $scope, $state, $location, $window, $http) {
 		}
 	};
 
+	$scope.updateAltimeterSetting = function () {
+		if ($scope.AltimeterSetting !== undefined && $scope.AltimeterSetting !== null && $scope.AltimeterSetting !== settings["AltimeterSetting"]) {
+			settings["AltimeterSetting"] = parseFloat($scope.AltimeterSetting);
+			var newsettings = {
+				"AltimeterSetting": settings["AltimeterSetting"]
+			};
+			// console.log(angular.toJson(newsettings));
+			setSettings(angular.toJson(newsettings));
+		}
+	};
+
+	$scope.updateWindTAS = function () {
+		if ($scope.WindTAS !== undefined && $scope.WindTAS !== null && $scope.WindTAS !== settings["WindTAS"]) {
+			settings["WindTAS"] = parseInt($scope.WindTAS);
+			var newsettings = {
+				"WindTAS": settings["WindTAS"]
+			};
+			// console.log(angular.toJson(newsettings));
+			setSettings(angular.toJson(newsettings));
+		}
+	};
+
 	$scope.updateGLimits = function () {
 		if ($scope.GLimits !== settings["GLimits"]) {
 			settings["GLimits"] = $scope.GLimits;
@@ -511,6 +544,32 @@ function SettingsCtrl($rootScope, $scope, $state, $location, $window, $http) {
 		}
 	};
 
+	$scope.updateAHRSFilter = function () {
+		if ($scope.AHRSFilter !== settings["AHRSFilter"]) {
+			settings["AHRSFilter"] = $scope.AHRSFilter;
+			var newsettings = {
+				"AHRSFilter": settings["AHRSFilter"]
+			};
+			// console.log(angular.toJson(newsettings));
+			setSettings(angular.toJson(newsettings));
+		}
+	};
+
+	$scope.updateExceedanceLimits = function () {
+		if ($scope.ExceedanceLimits && !angular.equals($scope.ExceedanceLimits, settings["ExceedanceLimits"])) {
+			var limits = {};
+			angular.forEach($scope.ExceedanceLimits, function (value, key) {
+				limits[key] = (value === undefined || value === null) ? 0 : parseFloat(value);
+			});
+			settings["ExceedanceLimits"] = limits;
+			var newsettings = {
+				"ExceedanceLimits": limits
+			};
+			// console.log(angular.toJson(newsettings));
+			setSettings(angular.toJson(newsettings));
+		}
+	};
+
 	$scope.postShutdown = function () {
 		$window.location.href = "/";
 		$location.path('/home');
@@ -137,12 +137,20 @@ function StatusCtrl($rootScope, $scope, $state, $http, $interval, craftService)
 			}
 			$scope.GPS_hardware = tempGpsHardwareString;
 			$scope.GPS_NetworkRemoteIp = status.GPS_NetworkRemoteIp;
+			$scope.GPS_source = status.GPS_source;
+			$scope.GPS_integrity_alerts = status.GPS_integrity_alerts || [];
+			$scope.Time_source = status.Time_source;
+			$scope.Time_service = status.Time_service;
+			$scope.Time_offset_ms = status.Time_offset_ms;
 			var gpsProtocol = (status.GPS_detected_type >> 4);
 			var tempGpsProtocolString = "Not communicating";
 			switch(gpsProtocol) {
 				case 1:
 					tempGpsProtocolString = "NMEA protocol";
 					break;
+				case 2:
+					tempGpsProtocolString = "UBX binary protocol";
+					break;
 				default:
 					tempGpsProtocolString = "Not communicating";
 			}
@@ -158,6 +166,8 @@ function StatusCtrl($rootScope, $scope, $state, $http, $interval, craftService)
 			$scope.UAT_PIREP_total = status.UAT_PIREP_total;
 			$scope.UAT_NOTAM_total = status.UAT_NOTAM_total;
 			$scope.UAT_OTHER_total = status.UAT_OTHER_total;
+			$scope.CrashState = status.CrashState;
+			$scope.CrashCountdown = status.CrashCountdown;
 			// Errors array.
 			if (status.Errors.length > 0) {
 				$scope.visible_errors = true;
@@ -188,6 +198,14 @@ function StatusCtrl($rootScope, $scope, $state, $http, $interval, craftService)
 		};
 	}
 
+	$scope.CancelCrash = function () {
+		$http.post(URL_CRASH_CANCEL).then(function (response) {
+			// do nothing
+		}, function (response) {
+			// do nothing
+		});
+	};
+
 	function setRegion(val) {
 		// Simple POST request example (note: response is asynchronous)
 		var jsonData = {};